@@ -0,0 +1,199 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"l2tp-manager/internal/database"
+	"l2tp-manager/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SilenceRequest 静默请求，minutes为0表示取消静默
+type SilenceRequest struct {
+	Minutes int `json:"minutes" binding:"gte=0"`
+}
+
+// parseAlertRuleID 解析告警规则ID路径参数
+func parseAlertRuleID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的规则ID",
+		})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// GetAlertMetrics 获取支持的告警指标
+func (h *Handler) GetAlertMetrics(c *gin.Context) {
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    services.AlertMetrics,
+	})
+}
+
+// GetAlertRules 获取告警规则列表
+func (h *Handler) GetAlertRules(c *gin.Context) {
+	rules, err := h.AlertService.ListRules()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: "获取告警规则失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    rules,
+	})
+}
+
+// CreateAlertRule 创建告警规则
+func (h *Handler) CreateAlertRule(c *gin.Context) {
+	var req database.AlertRule
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if err := h.AlertService.CreateRule(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, req.ServerID, "alert_rule_create", "success", req.Name)
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "告警规则创建成功",
+		Data:    req,
+	})
+}
+
+// UpdateAlertRule 更新告警规则
+func (h *Handler) UpdateAlertRule(c *gin.Context) {
+	id, ok := parseAlertRuleID(c)
+	if !ok {
+		return
+	}
+
+	var req database.AlertRule
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	rule, err := h.AlertService.UpdateRule(id, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, rule.ServerID, "alert_rule_update", "success", rule.Name)
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "告警规则更新成功",
+		Data:    rule,
+	})
+}
+
+// DeleteAlertRule 删除告警规则
+func (h *Handler) DeleteAlertRule(c *gin.Context) {
+	id, ok := parseAlertRuleID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.AlertService.DeleteRule(id); err != nil {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, 0, "alert_rule_delete", "success", strconv.FormatUint(uint64(id), 10))
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "告警规则已删除",
+	})
+}
+
+// SilenceAlertRule 静默告警规则指定分钟数，期间触发的告警只记录不通知
+func (h *Handler) SilenceAlertRule(c *gin.Context) {
+	id, ok := parseAlertRuleID(c)
+	if !ok {
+		return
+	}
+
+	var req SilenceRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	var until time.Time
+	if req.Minutes > 0 {
+		until = time.Now().Add(time.Duration(req.Minutes) * time.Minute)
+	}
+	rule, err := h.AlertService.Silence(id, until)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	message := "已取消静默"
+	if req.Minutes > 0 {
+		message = "已静默至 " + until.Format("2006-01-02 15:04")
+	}
+	h.audit(c, rule.ServerID, "alert_rule_silence", "success", rule.Name+" "+message)
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: message,
+		Data:    rule,
+	})
+}
+
+// GetAlertHistory 查询告警历史
+func (h *Handler) GetAlertHistory(c *gin.Context) {
+	ruleID, _ := strconv.ParseUint(c.Query("rule_id"), 10, 32)
+	serverID, _ := strconv.ParseUint(c.Query("server_id"), 10, 32)
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+
+	records, err := h.AlertService.History(services.AlertHistoryQuery{
+		RuleID:   uint(ruleID),
+		ServerID: uint(serverID),
+		State:    c.Query("state"),
+		Limit:    limit,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: "获取告警历史失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    records,
+	})
+}
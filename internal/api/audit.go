@@ -0,0 +1,32 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetAuditLogs 获取审计日志
+func (h *Handler) GetAuditLogs(c *gin.Context) {
+	serverID, _ := strconv.ParseUint(c.Query("server_id"), 10, 32)
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	logs, err := h.AuditService.List(uint(serverID), c.Query("action"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: "获取审计日志失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    logs,
+	})
+}
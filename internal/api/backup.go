@@ -0,0 +1,119 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"l2tp-manager/internal/database"
+	"l2tp-manager/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListBackups 列出备份文件
+func (h *Handler) ListBackups(c *gin.Context) {
+	backups, err := h.BackupService.ListBackups()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: "获取备份列表失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    backups,
+	})
+}
+
+// DownloadBackup 下载备份文件
+func (h *Handler) DownloadBackup(c *gin.Context) {
+	name := c.Param("name")
+	fullPath, err := h.BackupService.BackupPath(name)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.FileAttachment(fullPath, name)
+}
+
+// DeleteBackup 删除备份文件
+func (h *Handler) DeleteBackup(c *gin.Context) {
+	if err := h.BackupService.DeleteBackup(c.Param("name")); err != nil {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "备份已删除",
+	})
+}
+
+// GetBackupPolicy 获取自动备份策略
+func (h *Handler) GetBackupPolicy(c *gin.Context) {
+	policy, err := h.BackupService.GetPolicy()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: "获取备份策略失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    services.MaskPolicy(policy),
+	})
+}
+
+// UpdateBackupPolicy 更新自动备份策略
+func (h *Handler) UpdateBackupPolicy(c *gin.Context) {
+	var req database.BackupPolicy
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	policy, err := h.BackupService.UpdatePolicy(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "备份策略已更新",
+		Data:    services.MaskPolicy(policy),
+	})
+}
+
+// RunBackupPolicy 按当前策略立即执行一次自动备份
+func (h *Handler) RunBackupPolicy(c *gin.Context) {
+	name, err := h.BackupService.RunPolicy()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: fmt.Sprintf("备份失败: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "数据库备份成功",
+		Data:    gin.H{"backup_file": name},
+	})
+}
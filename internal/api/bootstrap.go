@@ -0,0 +1,255 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"l2tp-manager/internal/database"
+	"l2tp-manager/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BootstrapTokenCreated 创建注册令牌的响应，令牌只返回这一次
+type BootstrapTokenCreated struct {
+	Token   *database.BootstrapToken `json:"token"`
+	Secret  string                   `json:"secret"`
+	Command string                   `json:"command"` // 在落地机上以root执行的一键注册命令
+}
+
+// parsePendingID 解析登记记录ID路径参数
+func parsePendingID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的登记记录ID",
+		})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// bootstrapToken 从Authorization: Bearer请求头或token查询参数读取注册令牌
+func bootstrapToken(c *gin.Context) string {
+	if header := c.GetHeader("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+	return c.Query("token")
+}
+
+// GetBootstrapTokens 注册令牌列表
+func (h *Handler) GetBootstrapTokens(c *gin.Context) {
+	tokens, err := h.Bootstrap.ListTokens()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: "获取注册令牌失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    tokens,
+	})
+}
+
+// CreateBootstrapToken 创建注册令牌并生成一键注册命令
+func (h *Handler) CreateBootstrapToken(c *gin.Context) {
+	var req services.BootstrapTokenRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	token, secret, err := h.Bootstrap.CreateToken(req, c.GetString("username"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, 0, "bootstrap_token_create", "success", token.Name)
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "注册令牌已创建，请妥善保存，之后无法再次查看",
+		Data: BootstrapTokenCreated{
+			Token:   token,
+			Secret:  secret,
+			Command: "curl -fsSL '" + panelBaseURL(c) + "/api/v1/bootstrap/script?token=" + secret + "' | sh",
+		},
+	})
+}
+
+// DeleteBootstrapToken 撤销注册令牌
+func (h *Handler) DeleteBootstrapToken(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的注册令牌ID",
+		})
+		return
+	}
+	if err := h.Bootstrap.RevokeToken(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, 0, "bootstrap_token_delete", "success", c.Param("id"))
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "注册令牌已撤销",
+	})
+}
+
+// GetBootstrapScript 返回落地机注册脚本，通过token查询参数认证
+func (h *Handler) GetBootstrapScript(c *gin.Context) {
+	script, err := h.Bootstrap.Script(bootstrapToken(c), panelBaseURL(c))
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrBootstrapToken) {
+			status = http.StatusUnauthorized
+		}
+		// 以脚本形式返回错误，管道执行时输出原因并退出
+		c.String(status, "#!/bin/sh\necho '%s' >&2\nexit 1\n", err.Error())
+		return
+	}
+	c.Data(http.StatusOK, "text/x-shellscript; charset=utf-8", []byte(script))
+}
+
+// RegisterExitNode 注册脚本上报落地机信息，登记为待审核服务器
+func (h *Handler) RegisterExitNode(c *gin.Context) {
+	var req services.RegisterRequest
+	if err := c.ShouldBind(&req); err != nil {
+		bindError(c, err)
+		return
+	}
+
+	pending, err := h.Bootstrap.Register(bootstrapToken(c), req, c.ClientIP())
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrBootstrapToken) {
+			status = http.StatusUnauthorized
+		}
+		c.JSON(status, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.AuditService.RecordFrom(c.ClientIP(), 0, "exit_node_register", "bootstrap", "success", pending.Host)
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "已登记，等待管理员审核",
+		Data: gin.H{
+			"id":   pending.ID,
+			"host": pending.Host,
+		},
+	})
+}
+
+// GetPendingServers 通过注册脚本登记的落地机
+func (h *Handler) GetPendingServers(c *gin.Context) {
+	servers, err := h.Bootstrap.ListPending(c.DefaultQuery("status", services.PendingStatusPending))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: "获取登记记录失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    servers,
+	})
+}
+
+// ApprovePendingServer 审核通过：以登记的地址和SSH信息创建服务器，请求体为服务器的其余配置
+func (h *Handler) ApprovePendingServer(c *gin.Context) {
+	id, ok := parsePendingID(c)
+	if !ok {
+		return
+	}
+	var server database.L2TPServer
+	if !bindJSON(c, &server) {
+		return
+	}
+	if server.L2TPPort <= 0 || server.L2TPPort > 65535 {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "中转端口必须在1-65535之间",
+		})
+		return
+	}
+
+	pending, err := h.Bootstrap.Approve(id, &server)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.RoutingService.AddL2TPServer(&server)
+	if err := h.L2TPService.RecordRevision(&server, nil, "create", c.GetString("username")); err != nil {
+		c.Error(err)
+	}
+	h.audit(c, server.ID, "exit_node_approve", "success", pending.Host)
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "已创建服务器",
+		Data:    server,
+	})
+}
+
+// RejectPendingServer 拒绝登记
+func (h *Handler) RejectPendingServer(c *gin.Context) {
+	id, ok := parsePendingID(c)
+	if !ok {
+		return
+	}
+	pending, err := h.Bootstrap.Reject(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, 0, "exit_node_reject", "success", pending.Host)
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "已拒绝",
+		Data:    pending,
+	})
+}
+
+// GetPanelSSHKey 面板SSH公钥，加入落地机的authorized_keys后面板可免密码管理该服务器
+func (h *Handler) GetPanelSSHKey(c *gin.Context) {
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data: gin.H{
+			"public_key": h.Bootstrap.PublicKey(),
+		},
+	})
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"l2tp-manager/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExportRequest 配置导出请求
+type ExportRequest struct {
+	Passphrase string `json:"passphrase"` // 可选，非空时加密敏感字段
+}
+
+// ImportRequest 配置导入请求
+type ImportRequest struct {
+	Mode       string                 `json:"mode" binding:"omitempty,oneof=skip overwrite rename"` // skip/overwrite/rename，默认skip
+	Passphrase string                 `json:"passphrase"`
+	Bundle     *services.ConfigBundle `json:"bundle" binding:"required"`
+}
+
+// ExportConfig 导出完整配置包(JSON文件)
+func (h *Handler) ExportConfig(c *gin.Context) {
+	var req ExportRequest
+	if c.Request.ContentLength > 0 {
+		if !bindJSON(c, &req) {
+			return
+		}
+	}
+
+	bundle, err := h.BundleService.Export(req.Passphrase)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: fmt.Sprintf("导出失败: %v", err),
+		})
+		return
+	}
+
+	h.audit(c, 0, "config_export", "success",
+		fmt.Sprintf("导出 %d 个服务器，加密: %t", len(bundle.Servers), bundle.Encryption != nil))
+
+	filename := fmt.Sprintf("l2tp_export_%s.json", time.Now().Format("20060102_150405"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.JSON(http.StatusOK, bundle)
+}
+
+// ImportConfig 导入配置包
+func (h *Handler) ImportConfig(c *gin.Context) {
+	var req ImportRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = services.ImportModeSkip
+	}
+
+	username := c.GetString("username")
+	result, err := h.BundleService.Import(req.Bundle, req.Passphrase, req.Mode, username)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: fmt.Sprintf("导入失败: %v", err),
+		})
+		return
+	}
+
+	h.audit(c, 0, "config_import", "success",
+		fmt.Sprintf("导入 %d 个服务器，冲突处理: %s", len(result.Servers), req.Mode))
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "配置导入完成",
+		Data:    result,
+	})
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"l2tp-manager/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxGeneratedCredentials 一次最多生成的密钥数
+const maxGeneratedCredentials = 100
+
+// GenerateCredentials 按设置中的长度和字符集生成PSK或用户密码
+func (h *Handler) GenerateCredentials(c *gin.Context) {
+	count := 1
+	if value := c.Query("count"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxGeneratedCredentials {
+			c.JSON(http.StatusBadRequest, ApiResponse{
+				Success: false,
+				Message: "生成数量必须在1到100之间",
+			})
+			return
+		}
+		count = n
+	}
+
+	credentials, err := h.Credentials.Generate(c.Param("kind"), count)
+	if errors.Is(err, services.ErrUnknownCredentialKind) {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: "生成密钥失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "生成成功",
+		Data:    credentials,
+	})
+}
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetDashboard 获取仪表盘首页的汇总数据
+func (h *Handler) GetDashboard(c *gin.Context) {
+	summary, err := h.Dashboard.Summary(tenantID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: "获取仪表盘数据失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    summary,
+	})
+}
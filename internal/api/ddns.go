@@ -0,0 +1,152 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"l2tp-manager/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DDNSTokenCreated 生成上报令牌的响应，令牌只返回这一次
+type DDNSTokenCreated struct {
+	Token     string `json:"token"`
+	UpdateURL string `json:"update_url"` // 落地机定时请求该地址上报当前IP
+}
+
+// parseServerID 解析服务器ID路径参数
+func parseServerID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的服务器ID",
+		})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// GetServerDDNS 服务器转发目标的动态地址状态：域名解析结果和落地机上报的IP
+func (h *Handler) GetServerDDNS(c *gin.Context) {
+	id, ok := parseServerID(c)
+	if !ok {
+		return
+	}
+	server, err := h.l2tp(c).GetServer(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    h.RoutingService.DDNSStatus(server),
+	})
+}
+
+// RotateServerDDNSToken 生成落地机上报IP的令牌，旧令牌立即失效
+func (h *Handler) RotateServerDDNSToken(c *gin.Context) {
+	id, ok := parseServerID(c)
+	if !ok {
+		return
+	}
+	server, token, err := h.L2TPService.RotateDDNSToken(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, server.ID, "ddns_token", "success", server.Name)
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "上报令牌已生成，请妥善保存，之后无法再次查看",
+		Data: DDNSTokenCreated{
+			Token:     token,
+			UpdateURL: panelBaseURL(c) + "/api/v1/ddns/update?token=" + token,
+		},
+	})
+}
+
+// DisableServerDDNS 撤销上报令牌并清除上报的IP，转发目标恢复为落地机地址
+func (h *Handler) DisableServerDDNS(c *gin.Context) {
+	id, ok := parseServerID(c)
+	if !ok {
+		return
+	}
+	server, err := h.L2TPService.DisableDDNS(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.RoutingService.ReloadL2TPServer(server.L2TPPort, server)
+	h.audit(c, server.ID, "ddns_disable", "success", server.Name)
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "已停用IP上报",
+	})
+}
+
+// ReportServerIP 落地机上报当前IP，通过Authorization: Bearer <上报令牌>或token查询参数认证。
+// 未指定ip参数时使用请求的来源地址，IP变化后转发器改为转发到新地址
+func (h *Handler) ReportServerIP(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		token = c.PostForm("token")
+	}
+	if header := c.GetHeader("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		token = strings.TrimPrefix(header, "Bearer ")
+	}
+	ip := c.Query("ip")
+	if ip == "" {
+		ip = c.PostForm("ip")
+	}
+	if ip == "" {
+		ip = c.ClientIP()
+	}
+
+	server, changed, err := h.L2TPService.ReportIP(token, ip)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrDDNSToken) {
+			status = http.StatusUnauthorized
+		}
+		c.JSON(status, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if changed {
+		slog.Info("落地机上报了新的IP", "server", server.Name, "ip", server.ReportedIP)
+		h.RoutingService.ReloadL2TPServer(server.L2TPPort, server)
+		h.audit(c, server.ID, "ddns_update", "success", server.ReportedIP)
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "上报成功",
+		Data: gin.H{
+			"ip":      server.ReportedIP,
+			"changed": changed,
+		},
+	})
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DesiredStateRequest 设置期望状态请求
+type DesiredStateRequest struct {
+	DesiredState string `json:"desired_state" binding:"required,oneof=running stopped"`
+}
+
+// SetDesiredState 设置服务器期望状态，由协调器异步收敛
+func (h *Handler) SetDesiredState(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的服务器ID",
+		})
+		return
+	}
+
+	var req DesiredStateRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if err := h.L2TPService.SetDesiredState(uint(id), req.DesiredState); err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "期望状态已更新，协调器将自动收敛",
+		Data:    gin.H{"desired_state": req.DesiredState},
+	})
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"l2tp-manager/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// diagnosticsTopGoroutines 诊断信息中列出的协程分组数
+const diagnosticsTopGoroutines = 20
+
+// GoroutineGroup 按所在函数分组的协程数
+type GoroutineGroup struct {
+	Function string `json:"function"` // 调用栈中最内层的本程序函数，没有时为最外层函数，无调用栈时为unknown
+	Count    int    `json:"count"`
+}
+
+// MemoryStats 内存和GC统计
+type MemoryStats struct {
+	HeapAllocBytes  uint64    `json:"heap_alloc_bytes"`
+	HeapInuseBytes  uint64    `json:"heap_inuse_bytes"`
+	HeapObjects     uint64    `json:"heap_objects"`
+	StackInuseBytes uint64    `json:"stack_inuse_bytes"`
+	SysBytes        uint64    `json:"sys_bytes"`
+	TotalAllocBytes uint64    `json:"total_alloc_bytes"`
+	NumGC           uint32    `json:"num_gc"`
+	LastGC          time.Time `json:"last_gc"`
+	PauseTotalMs    float64   `json:"pause_total_ms"`
+}
+
+// DBPoolStats 数据库连接池统计
+type DBPoolStats struct {
+	MaxOpen      int   `json:"max_open"`
+	Open         int   `json:"open"`
+	InUse        int   `json:"in_use"`
+	Idle         int   `json:"idle"`
+	WaitCount    int64 `json:"wait_count"`
+	WaitMs       int64 `json:"wait_ms"`
+	MaxIdleClose int64 `json:"max_idle_closed"`
+	MaxLifeClose int64 `json:"max_lifetime_closed"`
+}
+
+// Diagnostics 运行诊断信息，用于排查协程和连接泄漏
+type Diagnostics struct {
+	GeneratedAt       time.Time                     `json:"generated_at"`
+	GoVersion         string                        `json:"go_version"`
+	Goroutines        int                           `json:"goroutines"`
+	GoroutineGroups   []GoroutineGroup              `json:"goroutine_groups"` // 协程最多的分组
+	Memory            MemoryStats                   `json:"memory"`
+	SSHSessions       []services.SSHSession         `json:"ssh_sessions"`
+	Forwarders        []services.ForwarderInfo      `json:"forwarders"`
+	ProxyForwarders   []services.ProxyForwarderInfo `json:"proxy_forwarders"`
+	WebSocketClients  int                           `json:"websocket_clients"`
+	RunningOperations int                           `json:"running_operations"` // 进行中的启动/停止/重启操作
+	DBPool            *DBPoolStats                  `json:"db_pool,omitempty"`
+}
+
+// GetDiagnostics 获取协程、内存、SSH连接、转发器、WebSocket连接和数据库连接池等运行诊断信息
+func (h *Handler) GetDiagnostics(c *gin.Context) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	report := Diagnostics{
+		GeneratedAt:     time.Now(),
+		GoVersion:       runtime.Version(),
+		Goroutines:      runtime.NumGoroutine(),
+		GoroutineGroups: goroutineGroups(diagnosticsTopGoroutines),
+		Memory: MemoryStats{
+			HeapAllocBytes:  mem.HeapAlloc,
+			HeapInuseBytes:  mem.HeapInuse,
+			HeapObjects:     mem.HeapObjects,
+			StackInuseBytes: mem.StackInuse,
+			SysBytes:        mem.Sys,
+			TotalAllocBytes: mem.TotalAlloc,
+			NumGC:           mem.NumGC,
+			PauseTotalMs:    float64(mem.PauseTotalNs) / float64(time.Millisecond),
+		},
+		SSHSessions:       services.ActiveSSHSessions(),
+		Forwarders:        h.RoutingService.Forwarders(),
+		ProxyForwarders:   h.RoutingService.ProxyForwarders(),
+		WebSocketClients:  h.WSManager.ClientCount(),
+		RunningOperations: h.L2TPService.RunningOperations(),
+	}
+	if mem.LastGC > 0 {
+		report.Memory.LastGC = time.Unix(0, int64(mem.LastGC))
+	}
+	if sqlDB, err := h.DB.DB(); err == nil {
+		stats := sqlDB.Stats()
+		report.DBPool = &DBPoolStats{
+			MaxOpen:      stats.MaxOpenConnections,
+			Open:         stats.OpenConnections,
+			InUse:        stats.InUse,
+			Idle:         stats.Idle,
+			WaitCount:    stats.WaitCount,
+			WaitMs:       stats.WaitDuration.Milliseconds(),
+			MaxIdleClose: stats.MaxIdleClosed,
+			MaxLifeClose: stats.MaxLifetimeClosed,
+		}
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取诊断信息成功",
+		Data:    report,
+	})
+}
+
+// goroutineGroups 按调用栈中最内层的本程序函数统计协程数，返回数量最多的limit组
+func goroutineGroups(limit int) []GoroutineGroup {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		return nil
+	}
+
+	// debug=1格式中相同调用栈的协程合为一段："<数量> @ <地址>..."，之后每帧一行 "#\t<地址>\t<函数>+<偏移>\t<文件>:<行>"
+	counts := make(map[string]int)
+	count, function, outermost := 0, "", ""
+	flush := func() {
+		if count == 0 {
+			return
+		}
+		if function == "" {
+			function = outermost
+		}
+		if function == "" {
+			function = "unknown"
+		}
+		counts[function] += count
+		count, function, outermost = 0, "", ""
+	}
+	scanner := bufio.NewScanner(&buf)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if n, _, ok := strings.Cut(line, " @ "); ok {
+			flush()
+			count, _ = strconv.Atoi(n)
+			continue
+		}
+		fields := strings.Fields(line)
+		if count == 0 || len(fields) < 3 || fields[0] != "#" {
+			continue
+		}
+		name := fields[2]
+		if i := strings.LastIndex(name, "+0x"); i > 0 {
+			name = name[:i]
+		}
+		outermost = name
+		if function == "" && (strings.HasPrefix(name, "l2tp-manager/") || strings.HasPrefix(name, "main.")) {
+			function = name
+		}
+	}
+	flush()
+
+	groups := make([]GoroutineGroup, 0, len(counts))
+	for function, count := range counts {
+		groups = append(groups, GoroutineGroup{Function: function, Count: count})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		return groups[i].Function < groups[j].Function
+	})
+	if len(groups) > limit {
+		groups = groups[:limit]
+	}
+	return groups
+}
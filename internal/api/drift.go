@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetDriftedServers 存在配置漂移的服务器
+func (h *Handler) GetDriftedServers(c *gin.Context) {
+	reports, err := h.Drift.List(tenantID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: "获取配置漂移列表失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    reports,
+	})
+}
+
+// GetServerDrift 服务器的配置漂移检测结果，refresh=true时立即通过SSH检测
+func (h *Handler) GetServerDrift(c *gin.Context) {
+	id, ok := parseServerID(c)
+	if !ok {
+		return
+	}
+	report, err := h.Drift.Get(c.Request.Context(), id, c.Query("refresh") == "true")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    report,
+	})
+}
+
+// ReapplyServer 按面板配置重新部署落地机，消除配置漂移
+func (h *Handler) ReapplyServer(c *gin.Context) {
+	id, ok := parseServerID(c)
+	if !ok {
+		return
+	}
+	server, err := h.Drift.Reapply(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, server.ID, "drift_reapply", "success", server.Name)
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "正在按面板配置重新部署",
+	})
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"l2tp-manager/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseTimeRange 解析since/until查询参数
+func parseTimeRange(c *gin.Context) (time.Time, time.Time, bool) {
+	since, ok := parseTimeParam(c.Query("since"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的开始时间",
+		})
+		return since, since, false
+	}
+	until, ok := parseTimeParam(c.Query("until"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的结束时间",
+		})
+		return since, until, false
+	}
+	return since, until, true
+}
+
+// streamTable 设置下载响应头并流式写出表格
+func streamTable(c *gin.Context, name string, export func(w services.TableWriter) error) {
+	format := c.DefaultQuery("format", services.ExportFormatCSV)
+	writer, contentType, err := services.NewTableWriter(format, c.Writer)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	filename := fmt.Sprintf("%s_%s.%s", name, time.Now().Format("20060102_150405"), format)
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	// 响应已开始输出，出错时只能记录日志
+	if err := export(writer); err != nil {
+		slog.Error("导出失败", "name", name, "error", err)
+		return
+	}
+	if err := writer.Close(); err != nil {
+		slog.Error("导出失败", "name", name, "error", err)
+	}
+}
+
+// ExportTraffic 导出流量数据(CSV/XLSX/PDF)
+func (h *Handler) ExportTraffic(c *gin.Context) {
+	serverID, ok := h.trafficServerID(c)
+	if !ok {
+		return
+	}
+	granularity := c.DefaultQuery("granularity", services.GranularityHour)
+	if granularity != "raw" && granularity != services.GranularityHour && granularity != services.GranularityDay {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的导出粒度，可选值: raw/hour/day",
+		})
+		return
+	}
+
+	since, until, ok := parseTimeRange(c)
+	if !ok {
+		return
+	}
+
+	streamTable(c, "traffic", func(w services.TableWriter) error {
+		return h.l2tp(c).ExportTraffic(w, services.TrafficExportQuery{
+			ServerID:    serverID,
+			Granularity: granularity,
+			Since:       since,
+			Until:       until,
+		})
+	})
+}
+
+// ExportServers 导出服务器清单(CSV/XLSX/PDF)
+func (h *Handler) ExportServers(c *gin.Context) {
+	since, until, ok := parseTimeRange(c)
+	if !ok {
+		return
+	}
+
+	streamTable(c, "servers", func(w services.TableWriter) error {
+		return h.l2tp(c).ExportInventory(w, since, until, tenantID(c))
+	})
+}
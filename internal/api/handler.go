@@ -1,15 +1,17 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"l2tp-manager/internal/database"
+	"l2tp-manager/internal/logger"
 	"l2tp-manager/internal/services"
 	"net/http"
 	"strconv"
-	"time"
 	"os"
-	"path/filepath"
 	"io"
+	"log/slog"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -21,20 +23,108 @@ type Handler struct {
 	L2TPService    *services.L2TPService
 	RoutingService *services.RoutingService
 	WSManager      *services.WSManager
+	AuditService   *services.AuditService
+	BackupService  *services.BackupService
+	BundleService  *services.BundleService
+	Settings       *services.SettingsService
+	Notifications  *services.NotificationService
+	WebhookService *services.WebhookService
+	LoginMonitor   *services.LoginMonitor
+	AlertService   *services.AlertService
+	Dashboard      *services.DashboardService
+	Search         *services.SearchService
+	Update         *services.UpdateService
+	Restart        *services.RestartManager
+	Agents         *services.AgentHub
+	RelayNodes     *services.RelayNodeService
+	Proxies        *services.ProxyService
+	Bootstrap      *services.BootstrapService
+	Usage          *services.UsageService
+	Tenants        *services.TenantService
+	PortPools      *services.PortPoolService
+	Drift          *services.DriftService
+	Images         *services.ImageService
+	Uptime         *services.UptimeService
+	Synthetic      *services.SyntheticService
+	Timeline       *services.TimelineService
+	Preferences    *services.PreferenceService
+	Jobs           *services.JobService
+	Credentials    *services.CredentialService
+	NATChecks      *services.NATCheckService
+	Knock          *services.KnockService
+	Leader         *services.LeaderElector
+	Lifecycle      *services.Lifecycle
+	Errors         *services.ErrorReporter
+	Build          services.BuildInfo
+	LogBuffer      *logger.Buffer
 	DB             *gorm.DB
 }
 
 // NewHandler 新API处理器
-func NewHandler(authService *services.AuthService, l2tpService *services.L2TPService, routingService *services.RoutingService, wsManager *services.WSManager, db *gorm.DB) *Handler {
+func NewHandler(authService *services.AuthService, l2tpService *services.L2TPService, routingService *services.RoutingService, wsManager *services.WSManager, auditService *services.AuditService, backupService *services.BackupService, bundleService *services.BundleService, settings *services.SettingsService, notifications *services.NotificationService, webhookService *services.WebhookService, loginMonitor *services.LoginMonitor, alertService *services.AlertService, dashboard *services.DashboardService, search *services.SearchService, update *services.UpdateService, restart *services.RestartManager, agents *services.AgentHub, relayNodes *services.RelayNodeService, proxies *services.ProxyService, bootstrap *services.BootstrapService, usage *services.UsageService, tenants *services.TenantService, portPools *services.PortPoolService, drift *services.DriftService, images *services.ImageService, uptime *services.UptimeService, synthetic *services.SyntheticService, timeline *services.TimelineService, preferences *services.PreferenceService, jobs *services.JobService, credentials *services.CredentialService, natChecks *services.NATCheckService, knock *services.KnockService, leader *services.LeaderElector, lifecycle *services.Lifecycle, errorReporter *services.ErrorReporter, build services.BuildInfo, logBuffer *logger.Buffer, db *gorm.DB) *Handler {
 	return &Handler{
 		AuthService:    authService,
 		L2TPService:    l2tpService,
 		RoutingService: routingService,
 		WSManager:      wsManager,
+		AuditService:   auditService,
+		BackupService:  backupService,
+		BundleService:  bundleService,
+		Settings:       settings,
+		Notifications:  notifications,
+		WebhookService: webhookService,
+		LoginMonitor:   loginMonitor,
+		AlertService:   alertService,
+		Dashboard:      dashboard,
+		Search:         search,
+		Update:         update,
+		Restart:        restart,
+		Agents:         agents,
+		RelayNodes:     relayNodes,
+		Proxies:        proxies,
+		Bootstrap:      bootstrap,
+		Usage:          usage,
+		Tenants:        tenants,
+		PortPools:      portPools,
+		Drift:          drift,
+		Images:         images,
+		Uptime:         uptime,
+		Synthetic:      synthetic,
+		Timeline:       timeline,
+		Preferences:    preferences,
+		Jobs:           jobs,
+		Credentials:    credentials,
+		NATChecks:      natChecks,
+		Knock:          knock,
+		Leader:         leader,
+		Lifecycle:      lifecycle,
+		Errors:         errorReporter,
+		Build:          build,
+		LogBuffer:      logBuffer,
 		DB:             db,
 	}
 }
 
+// l2tp 绑定请求上下文的服务器服务，客户端断开时中止进行中的数据库查询和SSH命令。
+// 只用于查询类调用，修改类操作一旦开始需执行完，仍使用h.L2TPService
+func (h *Handler) l2tp(c *gin.Context) *services.L2TPService {
+	return h.L2TPService.WithContext(c.Request.Context())
+}
+
+// panelBaseURL 请求所用的面板地址，用于生成落地机访问面板的链接
+func panelBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + c.GetString("base_path")
+}
+
+// audit 以当前登录用户记录审计日志，附带请求的客户端IP
+func (h *Handler) audit(c *gin.Context, serverID uint, action, result, detail string) {
+	h.AuditService.RecordFrom(c.ClientIP(), serverID, action, c.GetString("username"), result, detail)
+}
+
 // LoginRequest 登录请求结构
 type LoginRequest struct {
 	Username string `json:"username" binding:"required"`
@@ -53,23 +143,33 @@ type LoginResponse struct {
 type User struct {
 	ID       uint   `json:"id"`
 	Username string `json:"username"`
+	TenantID uint   `json:"tenant_id"` // 所属租户，0表示平台管理员
 }
 
-// ApiResponse 通用API响应结构
+// ApiResponse 通用API响应结构。失败时code为稳定的错误码(未指定时按HTTP状态码补充)，
+// 字段校验失败时errors列出各字段的错误
 type ApiResponse struct {
-	Success bool        `json:"success"`
-	Message string      `json:"message"`
-	Data    interface{} `json:"data,omitempty"`
+	Success bool         `json:"success"`
+	Message string       `json:"message"`
+	Code    string       `json:"code,omitempty"`
+	Errors  []FieldError `json:"errors,omitempty"`
+	Data    interface{}  `json:"data,omitempty"`
+}
+
+// PagedResponse 分页API响应结构
+type PagedResponse struct {
+	Success  bool        `json:"success"`
+	Message  string      `json:"message"`
+	Data     interface{} `json:"data"`
+	Total    int64       `json:"total"`
+	Page     int         `json:"page"`
+	PageSize int         `json:"page_size"`
 }
 
 // Login 用户登录
 func (h *Handler) Login(c *gin.Context) {
 	var req LoginRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, LoginResponse{
-			Success: false,
-			Message: "请求参数错误",
-		})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -93,8 +193,17 @@ func (h *Handler) Login(c *gin.Context) {
 		return
 	}
 
+	// 租户停用后其用户不能登录
+	if err := h.Tenants.Active(user.TenantID); err != nil {
+		c.JSON(http.StatusForbidden, LoginResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
 	// 生成JWT令牌
-	token, err := h.AuthService.GenerateToken(user.ID, user.Username)
+	token, err := h.AuthService.GenerateToken(user.ID, user.Username, user.TenantID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, LoginResponse{
 			Success: false,
@@ -103,6 +212,9 @@ func (h *Handler) Login(c *gin.Context) {
 		return
 	}
 
+	// 记录登录来源，新IP登录时发送告警
+	h.LoginMonitor.Observe(user.ID, user.Username, c.ClientIP())
+
 	c.JSON(http.StatusOK, LoginResponse{
 		Success: true,
 		Message: "登录成功",
@@ -110,6 +222,7 @@ func (h *Handler) Login(c *gin.Context) {
 		User: User{
 			ID:       user.ID,
 			Username: user.Username,
+			TenantID: user.TenantID,
 		},
 	})
 }
@@ -126,6 +239,15 @@ func (h *Handler) RefreshToken(c *gin.Context) {
 	}
 
 	token := authHeader[7:]
+	if claims, err := h.AuthService.ValidateToken(token); err == nil {
+		if err := h.Tenants.Active(claims.TenantID); err != nil {
+			c.JSON(http.StatusForbidden, ApiResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+	}
 	newToken, err := h.AuthService.RefreshToken(token)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, ApiResponse{
@@ -142,37 +264,66 @@ func (h *Handler) RefreshToken(c *gin.Context) {
 	})
 }
 
-// GetServers 获取所有L2TP服务器
+// GetServers 获取L2TP服务器列表，支持分页、过滤和排序
 func (h *Handler) GetServers(c *gin.Context) {
-	servers, err := h.L2TPService.GetServers()
+	query := services.ServerListQuery{
+		Sort:    c.Query("sort"),
+		Status:  c.Query("status"),
+		Keyword: c.Query("q"),
+	}
+	if query.TenantID = tenantID(c); query.TenantID == 0 {
+		tenant, _ := strconv.ParseUint(c.Query("tenant_id"), 10, 32)
+		query.TenantID = uint(tenant)
+	}
+	query.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	query.PageSize, _ = strconv.Atoi(c.DefaultQuery("page_size", "0"))
+	if query.PageSize < 0 || query.PageSize > 500 {
+		query.PageSize = 500
+	}
+	if expiredStr := c.Query("expired"); expiredStr != "" {
+		expired, err := strconv.ParseBool(expiredStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ApiResponse{
+				Success: false,
+				Message: "expired参数无效",
+			})
+			return
+		}
+		query.Expired = &expired
+	}
+
+	servers, total, err := h.l2tp(c).ListServers(query)
+	if errors.Is(err, services.ErrUnsupportedSort) {
+		fieldError(c, "sort", "oneof", err.Error())
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ApiResponse{
-			Success: false,
-			Message: "获取服务器列表失败",
-		})
+		internalError(c, "获取服务器列表失败", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, ApiResponse{
-		Success: true,
-		Message: "获取成功",
-		Data:    servers,
+	c.JSON(http.StatusOK, PagedResponse{
+		Success:  true,
+		Message:  "获取成功",
+		Data:     servers,
+		Total:    total,
+		Page:     query.Page,
+		PageSize: query.PageSize,
 	})
 }
 
-// CreateServer 创建L2TP服务器
+// CreateServer 创建L2TP服务器。携带Idempotency-Key请求头时，相同请求的重试返回首次创建的服务器
 func (h *Handler) CreateServer(c *gin.Context) {
 	var server database.L2TPServer
-	if err := c.ShouldBindJSON(&server); err != nil {
-		c.JSON(http.StatusBadRequest, ApiResponse{
-			Success: false,
-			Message: fmt.Sprintf("请求参数错误: %v", err),
-		})
+	if !bindJSON(c, &server) {
 		return
 	}
 
-	// 验证必填字段
-	if server.Name == "" || server.Host == "" || server.Username == "" || server.Password == "" {
+	// 验证必填字段，SSH密码为空时使用面板密钥登录
+	if server.Name == "" || server.Host == "" || server.Username == "" {
 		c.JSON(http.StatusBadRequest, ApiResponse{
 			Success: false,
 			Message: "请填写完整的服务器信息",
@@ -180,8 +331,8 @@ func (h *Handler) CreateServer(c *gin.Context) {
 		return
 	}
 
-	// 验证中转端口
-	if server.L2TPPort <= 0 {
+	// 验证中转端口，为0时从端口池分配
+	if server.L2TPPort < 0 || server.L2TPPort > 65535 {
 		c.JSON(http.StatusBadRequest, ApiResponse{
 			Success: false,
 			Message: "请输入有效的中转端口",
@@ -189,14 +340,57 @@ func (h *Handler) CreateServer(c *gin.Context) {
 		return
 	}
 
-	// 创建服务器
-	if err := h.L2TPService.CreateServer(&server); err != nil {
+	// 验证定时重启计划
+	if server.RestartSchedule != "" {
+		if _, err := services.ParseCron(server.RestartSchedule); err != nil {
+			c.JSON(http.StatusBadRequest, ApiResponse{
+				Success: false,
+				Message: fmt.Sprintf("定时重启计划无效: %v", err),
+			})
+			return
+		}
+	}
+
+	// 租户用户创建的服务器属于其租户，平台管理员可通过tenant_id指定
+	if tenant := tenantID(c); tenant != 0 {
+		server.TenantID = tenant
+	}
+
+	// 创建服务器，幂等键按请求体判断重试是否为同一请求
+	body := c.MustGet(gin.BodyBytesKey).([]byte)
+	owner := services.IdempotencyOwner{TenantID: tenantID(c), UserID: c.GetUint("user_id")}
+	replayed, err := h.l2tp(c).CreateServerIdempotent(&server, owner, c.GetHeader("Idempotency-Key"), services.HashRequest(body))
+	if errors.Is(err, services.ErrIdempotencyMismatch) {
+		c.JSON(http.StatusUnprocessableEntity, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if respondConflict(c, err) {
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusBadRequest, ApiResponse{
 			Success: false,
 			Message: err.Error(),
 		})
 		return
 	}
+	if replayed {
+		c.Header("Idempotent-Replayed", "true")
+		c.JSON(http.StatusOK, ApiResponse{
+			Success: true,
+			Message: "服务器创建成功",
+			Data:    server,
+		})
+		return
+	}
+
+	// 记录初始配置修订
+	if err := h.L2TPService.RecordRevision(&server, nil, "create", c.GetString("username")); err != nil {
+		slog.Error("记录配置修订失败", "server_id", server.ID, "error", err)
+	}
 
 	// 添加到路由服务
 	h.RoutingService.AddL2TPServer(&server)
@@ -208,6 +402,82 @@ func (h *Handler) CreateServer(c *gin.Context) {
 	})
 }
 
+// GetServer 获取单个服务器
+func (h *Handler) GetServer(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的服务器ID",
+		})
+		return
+	}
+
+	server, err := h.l2tp(c).GetServer(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    server,
+	})
+}
+
+// LookupServer 按external_id、name或l2tp_port精确查找唯一的服务器，未匹配返回404，匹配到多个返回409
+func (h *Handler) LookupServer(c *gin.Context) {
+	lookup := services.ServerLookup{
+		ExternalID: c.Query("external_id"),
+		Name:       c.Query("name"),
+		TenantID:   tenantID(c),
+	}
+	if portStr := c.Query("l2tp_port"); portStr != "" {
+		port, err := strconv.Atoi(portStr)
+		if err != nil || port <= 0 {
+			c.JSON(http.StatusBadRequest, ApiResponse{
+				Success: false,
+				Message: "l2tp_port参数无效",
+			})
+			return
+		}
+		lookup.L2TPPort = port
+	}
+
+	server, err := h.l2tp(c).LookupServer(lookup)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: "服务器不存在",
+		})
+		return
+	case errors.Is(err, services.ErrServerAmbiguous):
+		c.JSON(http.StatusConflict, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    server,
+	})
+}
+
 // UpdateServer 更新L2TP服务器
 func (h *Handler) UpdateServer(c *gin.Context) {
 	idStr := c.Param("id")
@@ -221,16 +491,35 @@ func (h *Handler) UpdateServer(c *gin.Context) {
 	}
 
 	var server database.L2TPServer
-	if err := c.ShouldBindJSON(&server); err != nil {
-		c.JSON(http.StatusBadRequest, ApiResponse{
+	if !bindJSON(c, &server) {
+		return
+	}
+
+	// 验证定时重启计划
+	if server.RestartSchedule != "" {
+		if _, err := services.ParseCron(server.RestartSchedule); err != nil {
+			c.JSON(http.StatusBadRequest, ApiResponse{
+				Success: false,
+				Message: fmt.Sprintf("定时重启计划无效: %v", err),
+			})
+			return
+		}
+	}
+
+	before, err := h.l2tp(c).GetServer(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, ApiResponse{
 			Success: false,
-			Message: fmt.Sprintf("请求参数错误: %v", err),
+			Message: "服务器不存在",
 		})
 		return
 	}
 
 	// 更新服务器
 	if err := h.L2TPService.UpdateServer(uint(id), &server); err != nil {
+		if respondConflict(c, err) {
+			return
+		}
 		c.JSON(http.StatusBadRequest, ApiResponse{
 			Success: false,
 			Message: err.Error(),
@@ -238,6 +527,12 @@ func (h *Handler) UpdateServer(c *gin.Context) {
 		return
 	}
 
+	// 记录配置修订并热更新转发器
+	if err := h.L2TPService.RecordRevision(&server, before, "update", c.GetString("username")); err != nil {
+		slog.Error("记录配置修订失败", "server_id", server.ID, "error", err)
+	}
+	h.RoutingService.ReloadL2TPServer(before.L2TPPort, &server)
+
 	c.JSON(http.StatusOK, ApiResponse{
 		Success: true,
 		Message: "服务器更新成功",
@@ -257,7 +552,7 @@ func (h *Handler) StartServer(c *gin.Context) {
 	}
 
 	// 获取服务器信息
-	server, err := h.L2TPService.GetServer(uint(id))
+	server, err := h.l2tp(c).GetServer(uint(id))
 	if err != nil {
 		c.JSON(http.StatusNotFound, ApiResponse{
 			Success: false,
@@ -275,8 +570,9 @@ func (h *Handler) StartServer(c *gin.Context) {
 		return
 	}
 
-	// 启动服务器
-	if err := h.L2TPService.StartServer(uint(id)); err != nil {
+	// 启动服务器，启动过程在后台任务中执行，进度通过WebSocket推送，也可通过任务接口查询
+	job, err := h.L2TPService.StartServerJob(c.Request.Context(), uint(id))
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, ApiResponse{
 			Success: false,
 			Message: fmt.Sprintf("启动失败: %v", err),
@@ -284,26 +580,23 @@ func (h *Handler) StartServer(c *gin.Context) {
 		return
 	}
 
-	// 更新路由服务状态
-	h.RoutingService.UpdateServerStatus(uint(id), "running")
-
-	// 等待一段时间再检查状态
-	time.Sleep(2 * time.Second)
-
-	// 验证服务器是否真的启动了
-	status, err := h.L2TPService.GetServerStatus(uint(id))
-	if err != nil {
-		c.JSON(http.StatusOK, ApiResponse{
-			Success: true,
-			Message: "服务器启动命令已发送，但无法验证状态",
+	// 手动启动同时更新期望状态，避免协调器反向收敛
+	if err := h.L2TPService.SetDesiredState(uint(id), "running"); err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: fmt.Sprintf("启动任务已创建，但更新期望状态失败: %v", err),
+			Data:    job.View(),
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, ApiResponse{
+	// 更新路由服务状态
+	h.RoutingService.UpdateServerStatus(uint(id), "running")
+
+	c.JSON(http.StatusAccepted, ApiResponse{
 		Success: true,
-		Message: "服务器启动成功",
-		Data:    status,
+		Message: "服务器启动任务已创建",
+		Data:    job.View(),
 	})
 }
 
@@ -320,7 +613,7 @@ func (h *Handler) StopServer(c *gin.Context) {
 	}
 
 	// 获取服务器信息
-	server, err := h.L2TPService.GetServer(uint(id))
+	server, err := h.l2tp(c).GetServer(uint(id))
 	if err != nil {
 		c.JSON(http.StatusNotFound, ApiResponse{
 			Success: false,
@@ -338,8 +631,9 @@ func (h *Handler) StopServer(c *gin.Context) {
 		return
 	}
 
-	// 停止服务器
-	if err := h.L2TPService.StopServer(uint(id)); err != nil {
+	// 停止服务器，停止过程在后台任务中执行
+	job, err := h.L2TPService.StopServerJob(c.Request.Context(), uint(id))
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, ApiResponse{
 			Success: false,
 			Message: fmt.Sprintf("停止失败: %v", err),
@@ -347,26 +641,23 @@ func (h *Handler) StopServer(c *gin.Context) {
 		return
 	}
 
-	// 更新路由服务状态
-	h.RoutingService.UpdateServerStatus(uint(id), "stopped")
-
-	// 等待一段时间再检查状态
-	time.Sleep(1 * time.Second)
-
-	// 验证服务器是否真的停止了
-	status, err := h.L2TPService.GetServerStatus(uint(id))
-	if err != nil {
-		c.JSON(http.StatusOK, ApiResponse{
-			Success: true,
-			Message: "服务器停止命令已发送，但无法验证状态",
+	// 手动停止同时更新期望状态，避免协调器反向收敛
+	if err := h.L2TPService.SetDesiredState(uint(id), "stopped"); err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: fmt.Sprintf("停止任务已创建，但更新期望状态失败: %v", err),
+			Data:    job.View(),
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, ApiResponse{
+	// 更新路由服务状态
+	h.RoutingService.UpdateServerStatus(uint(id), "stopped")
+
+	c.JSON(http.StatusAccepted, ApiResponse{
 		Success: true,
-		Message: "服务器停止成功",
-		Data:    status,
+		Message: "服务器停止任务已创建",
+		Data:    job.View(),
 	})
 }
 
@@ -382,7 +673,8 @@ func (h *Handler) RestartServer(c *gin.Context) {
 		return
 	}
 
-	if err := h.L2TPService.RestartServer(uint(id)); err != nil {
+	job, err := h.L2TPService.RestartServerJob(c.Request.Context(), uint(id))
+	if err != nil {
 		c.JSON(http.StatusBadRequest, ApiResponse{
 			Success: false,
 			Message: err.Error(),
@@ -390,9 +682,10 @@ func (h *Handler) RestartServer(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, ApiResponse{
+	c.JSON(http.StatusAccepted, ApiResponse{
 		Success: true,
-		Message: "服务器重启成功",
+		Message: "服务器重启任务已创建",
+		Data:    job.View(),
 	})
 }
 
@@ -408,7 +701,7 @@ func (h *Handler) GetServerStatus(c *gin.Context) {
 		return
 	}
 
-	status, err := h.L2TPService.GetServerStatus(uint(id))
+	status, err := h.l2tp(c).GetServerStatus(uint(id))
 	if err != nil {
 		c.JSON(http.StatusNotFound, ApiResponse{
 			Success: false,
@@ -444,7 +737,7 @@ func (h *Handler) GetServerLogs(c *gin.Context) {
 	}
 
 	// 获取服务器信息
-	server, err := h.L2TPService.GetServer(uint(id))
+	server, err := h.l2tp(c).GetServer(uint(id))
 	if err != nil {
 		c.JSON(http.StatusNotFound, ApiResponse{
 			Success: false,
@@ -454,8 +747,7 @@ func (h *Handler) GetServerLogs(c *gin.Context) {
 	}
 
 	// 获取日志
-	sshService := services.NewSSHService()
-	logs, err := sshService.GetServerLogs(server, lines)
+	logs, err := h.l2tp(c).SSH().GetServerLogs(server, lines)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ApiResponse{
 			Success: false,
@@ -474,6 +766,29 @@ func (h *Handler) GetServerLogs(c *gin.Context) {
 // GetTrafficStats 获取流量统计
 func (h *Handler) GetTrafficStats(c *gin.Context) {
 	stats := h.RoutingService.GetTrafficStats()
+
+	// 租户用户只能看到自己服务器监听端口的统计(键为 落地机地址:监听端口)
+	if tenant := tenantID(c); tenant != 0 {
+		servers, _, err := h.l2tp(c).ListServers(services.ServerListQuery{TenantID: tenant})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ApiResponse{
+				Success: false,
+				Message: "获取统计失败",
+			})
+			return
+		}
+		allowed := make(map[string]bool)
+		for i := range servers {
+			for _, rule := range services.ForwardRules(&servers[i]) {
+				allowed[fmt.Sprintf("%s:%d", servers[i].Host, rule.ListenPort)] = true
+			}
+		}
+		for key := range stats {
+			if !allowed[key] {
+				delete(stats, key)
+			}
+		}
+	}
 	
 	// 格式化数据
 	formattedStats := make(map[string]interface{})
@@ -506,6 +821,7 @@ func (h *Handler) GetTrafficStats(c *gin.Context) {
 // GetSystemStatus 获取系统状态
 func (h *Handler) GetSystemStatus(c *gin.Context) {
 	status := h.RoutingService.GetSystemStatus()
+	status["build"] = h.Build.Runtime(time.Now())
 	
 	c.JSON(http.StatusOK, ApiResponse{
 		Success: true,
@@ -514,14 +830,19 @@ func (h *Handler) GetSystemStatus(c *gin.Context) {
 	})
 }
 
+// GetVersion 获取面板的版本、构建信息和运行时长
+func (h *Handler) GetVersion(c *gin.Context) {
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    h.Build.Runtime(time.Now()),
+	})
+}
+
 // BackupDatabase 备份数据库（前端未实现）
 func (h *Handler) BackupDatabase(c *gin.Context) {
-	// 创建备份文件名
-	timestamp := time.Now().Format("20060102_150405")
-	backupPath := fmt.Sprintf("backup_%s.db", timestamp)
-	
 	// 执行备份
-	err := database.BackupDatabase(h.DB, backupPath)
+	backupFile, err := h.BackupService.CreateBackup()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ApiResponse{
 			Success: false,
@@ -533,14 +854,14 @@ func (h *Handler) BackupDatabase(c *gin.Context) {
 	c.JSON(http.StatusOK, ApiResponse{
 		Success: true,
 		Message: "数据库备份成功",
-		Data:    gin.H{"backup_file": backupPath},
+		Data:    gin.H{"backup_file": backupFile},
 	})
 }
 
 // RestoreDatabase 恢复数据库
 func (h *Handler) RestoreDatabase(c *gin.Context) {
 	// 处理文件上传
-	file, header, err := c.Request.FormFile("backup_file")
+	file, _, err := c.Request.FormFile("backup_file")
 	if err != nil {
 		c.JSON(http.StatusBadRequest, ApiResponse{
 			Success: false,
@@ -550,9 +871,8 @@ func (h *Handler) RestoreDatabase(c *gin.Context) {
 	}
 	defer file.Close()
 	
-	// 创建临时文件
-	tempPath := filepath.Join(os.TempDir(), header.Filename)
-	tempFile, err := os.Create(tempPath)
+	// 创建临时文件(不使用上传文件名，避免路径穿越)
+	tempFile, err := os.CreateTemp("", "l2tp_restore_*.db")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ApiResponse{
 			Success: false,
@@ -560,8 +880,9 @@ func (h *Handler) RestoreDatabase(c *gin.Context) {
 		})
 		return
 	}
-	defer tempFile.Close()
+	tempPath := tempFile.Name()
 	defer os.Remove(tempPath)
+	defer tempFile.Close()
 	
 	// 复制文件内容
 	_, err = io.Copy(tempFile, file)
@@ -573,19 +894,34 @@ func (h *Handler) RestoreDatabase(c *gin.Context) {
 		return
 	}
 	
+	if err := tempFile.Close(); err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: "保存文件失败",
+		})
+		return
+	}
+	
 	// 执行恢复
-	err = database.RestoreDatabase(tempPath, "l2tp_manager.db")
+	result, err := database.RestoreDatabase(h.DB, tempPath, h.BackupService.Dir())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ApiResponse{
+		c.JSON(http.StatusBadRequest, ApiResponse{
 			Success: false,
 			Message: fmt.Sprintf("恢复失败: %v", err),
 		})
 		return
 	}
+
+	// 重新加载转发器状态和运行时设置
+	h.RoutingService.Reload()
+	if err := h.Settings.Refresh(); err != nil {
+		slog.Error("恢复后重新加载设置失败", "error", err)
+	}
 	
 	c.JSON(http.StatusOK, ApiResponse{
 		Success: true,
 		Message: "数据库恢复成功",
+		Data:    result,
 	})
 } 
 
@@ -602,7 +938,7 @@ func (h *Handler) DeleteServer(c *gin.Context) {
 	}
 
 	// 获取服务器信息
-	server, err := h.L2TPService.GetServer(uint(id))
+	server, err := h.l2tp(c).GetServer(uint(id))
 	if err != nil {
 		c.JSON(http.StatusNotFound, ApiResponse{
 			Success: false,
@@ -613,7 +949,7 @@ func (h *Handler) DeleteServer(c *gin.Context) {
 
 	// 如果服务器正在运行，先停止它
 	if server.Status == "running" {
-		if err := h.L2TPService.StopServer(uint(id)); err != nil {
+		if err := h.L2TPService.StopServer(c.Request.Context(), uint(id)); err != nil {
 			c.JSON(http.StatusInternalServerError, ApiResponse{
 				Success: false,
 				Message: fmt.Sprintf("停止服务器失败: %v", err),
@@ -636,11 +972,11 @@ func (h *Handler) DeleteServer(c *gin.Context) {
 
 	c.JSON(http.StatusOK, ApiResponse{
 		Success: true,
-		Message: "服务器删除成功",
+		Message: "服务器已移入回收站",
 	})
 }
 
 // HandleWebSocket 处理WebSocket连接
 func (h *Handler) HandleWebSocket(c *gin.Context) {
-	h.WSManager.HandleWebSocket(c)
+	h.WSManager.HandleWebSocket(c, h.AuthService)
 } 
\ No newline at end of file
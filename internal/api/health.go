@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"l2tp-manager/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ComponentHealth 组件健康状态
+type ComponentHealth struct {
+	Name      string `json:"name"`
+	Healthy   bool   `json:"healthy"`
+	Message   string `json:"message,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+}
+
+// HealthReport 健康检查报告
+type HealthReport struct {
+	Ready      bool                       `json:"ready"`
+	CheckedAt  time.Time                  `json:"checked_at"`
+	Components []ComponentHealth          `json:"components"`
+	Lifecycle  []services.ComponentStatus `json:"lifecycle"` // 启动流程中各组件的状态
+}
+
+// Healthz 存活检查，进程能处理请求即返回200
+func (h *Handler) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz 就绪检查，启动流程完成且依赖组件全部可用时返回200，否则返回503。
+// 只列出启动流程中各组件的状态和依赖组件是否可用，不暴露错误等细节
+func (h *Handler) Readyz(c *gin.Context) {
+	report := h.checkHealth(c.Request.Context())
+	lifecycle := make(map[string]string, len(report.Lifecycle))
+	for _, component := range report.Lifecycle {
+		lifecycle[component.Name] = component.State
+	}
+	components := make(map[string]string, len(report.Components))
+	for _, component := range report.Components {
+		components[component.Name] = "healthy"
+		if !component.Healthy {
+			components[component.Name] = "unhealthy"
+		}
+	}
+	status, code := "ready", http.StatusOK
+	if !report.Ready {
+		status, code = "not_ready", http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{"status": status, "lifecycle": lifecycle, "components": components})
+}
+
+// GetHealth 获取各组件的健康详情
+func (h *Handler) GetHealth(c *gin.Context) {
+	report := h.checkHealth(c.Request.Context())
+	status := http.StatusOK
+	if !report.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, ApiResponse{
+		Success: report.Ready,
+		Message: "获取健康状态成功",
+		Data:    report,
+	})
+}
+
+// checkHealth 检查启动流程中各组件的状态以及数据库、WebSocket管理器和路由服务，
+// 高可用模式下还检查本实例是否为主节点
+func (h *Handler) checkHealth(ctx context.Context) *HealthReport {
+	report := &HealthReport{Ready: true, CheckedAt: time.Now()}
+	if h.Lifecycle != nil {
+		report.Lifecycle = h.Lifecycle.Status()
+		report.Ready = h.Lifecycle.Ready()
+	}
+	check := func(name string, probe func() (bool, string)) {
+		start := time.Now()
+		healthy, message := probe()
+		report.Components = append(report.Components, ComponentHealth{
+			Name:      name,
+			Healthy:   healthy,
+			Message:   message,
+			LatencyMs: time.Since(start).Milliseconds(),
+		})
+		report.Ready = report.Ready && healthy
+	}
+
+	check("database", func() (bool, string) {
+		sqlDB, err := h.DB.DB()
+		if err != nil {
+			return false, err.Error()
+		}
+		pingCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		defer cancel()
+		if err := sqlDB.PingContext(pingCtx); err != nil {
+			return false, err.Error()
+		}
+		return true, ""
+	})
+	check("websocket", func() (bool, string) {
+		if !h.WSManager.Running() {
+			return false, "WebSocket管理器未运行"
+		}
+		return true, fmt.Sprintf("连接数: %d", h.WSManager.ClientCount())
+	})
+	check("routing", func() (bool, string) {
+		if !h.RoutingService.Started() {
+			return false, "路由服务未启动"
+		}
+		return true, fmt.Sprintf("转发器数: %d", h.RoutingService.ForwarderCount())
+	})
+	if h.Leader.Enabled() {
+		check("leader", func() (bool, string) {
+			if !h.Leader.IsLeader() {
+				return false, fmt.Sprintf("%s 为备用节点", h.Leader.Name())
+			}
+			return true, fmt.Sprintf("%s 为主节点", h.Leader.Name())
+		})
+	}
+	return report
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"l2tp-manager/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ikev2ContentTypes 各格式客户端配置的Content-Type
+var ikev2ContentTypes = map[string]string{
+	services.IKEv2ProfileMobileConfig: "application/x-apple-aspen-config",
+	services.IKEv2ProfileSSwan:        "application/vnd.strongswan.profile",
+	services.IKEv2ProfileP12:          "application/x-pkcs12",
+}
+
+// GetIKEv2CA 下载IKEv2服务器的CA证书，Windows等客户端需导入到受信任的根证书颁发机构
+func (h *Handler) GetIKEv2CA(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的服务器ID",
+		})
+		return
+	}
+
+	server, err := h.l2tp(c).GetServer(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	ca, err := h.L2TPService.IKEv2CA(server.ID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", server.Name+"-ca.crt"))
+	c.Data(http.StatusOK, "application/x-pem-file", []byte(ca))
+}
+
+// GetIKEv2Profile 下载用户的IKEv2客户端配置，format为mobileconfig(默认)、sswan或p12
+func (h *Handler) GetIKEv2Profile(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的服务器ID",
+		})
+		return
+	}
+
+	server, err := h.l2tp(c).GetServer(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	name := c.Param("user")
+	profile, ext, err := h.L2TPService.IKEv2Profile(server.ID, name, c.Query("format"), h.clientEndpoint(c, server))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, server.ID, "ikev2_profile", "success", fmt.Sprintf("下载用户 %s 的IKEv2配置(%s)", name, ext))
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("%s-%s.%s", server.Name, name, ext)))
+	c.Data(http.StatusOK, ikev2ContentTypes[ext], profile)
+}
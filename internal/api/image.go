@@ -0,0 +1,95 @@
+package api
+
+import (
+	"net/http"
+
+	"l2tp-manager/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetServerImages 服务器容器镜像的更新检查结果，updates=true时只返回有可用更新的
+func (h *Handler) GetServerImages(c *gin.Context) {
+	images, err := h.Images.List(c.Query("updates") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: "获取镜像检查结果失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    images,
+	})
+}
+
+// CheckServerImages 立即检查全部运行中服务器的镜像更新
+func (h *Handler) CheckServerImages(c *gin.Context) {
+	if err := h.Images.Check(c.Request.Context()); err != nil {
+		c.JSON(http.StatusConflict, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	images, err := h.Images.List(false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: "获取镜像检查结果失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "检查完成",
+		Data:    images,
+	})
+}
+
+// StartImageRollout 按批次滚动重建服务器容器，升级到镜像的最新版本
+func (h *Handler) StartImageRollout(c *gin.Context) {
+	var req services.RolloutRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	rollout, err := h.Images.StartRollout(c.Request.Context(), req, c.GetString("username"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, 0, "image_rollout", "success", rollout.ID)
+
+	c.JSON(http.StatusAccepted, ApiResponse{
+		Success: true,
+		Message: "滚动升级已开始",
+		Data:    rollout,
+	})
+}
+
+// GetImageRollout 最近一次滚动升级的进度
+func (h *Handler) GetImageRollout(c *gin.Context) {
+	rollout := h.Images.Rollout()
+	if rollout == nil {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: "尚未进行滚动升级",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    rollout,
+	})
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"l2tp-manager/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetJobs 任务列表：进行中和最近结束的服务器操作任务，最新的在前，可按状态、类型和服务器筛选
+func (h *Handler) GetJobs(c *gin.Context) {
+	serverID, _ := strconv.ParseUint(c.Query("server_id"), 10, 32)
+	jobs := h.Jobs.List(services.JobFilter{
+		Status:   c.Query("status"),
+		Kind:     c.Query("kind"),
+		ServerID: uint(serverID),
+	})
+
+	// 租户用户只能看到自己服务器的任务
+	if tenant := tenantID(c); tenant != 0 {
+		owned := jobs[:0]
+		for _, job := range jobs {
+			if h.Tenants.OwnsServer(tenant, job.ServerID) {
+				owned = append(owned, job)
+			}
+		}
+		jobs = owned
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    jobs,
+	})
+}
+
+// GetJob 查询单个任务的状态和结果
+func (h *Handler) GetJob(c *gin.Context) {
+	job, ok := h.Jobs.Get(c.Param("id"))
+	if ok && tenantID(c) != 0 && !h.Tenants.OwnsServer(tenantID(c), job.ServerID) {
+		ok = false
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: "任务不存在",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    job,
+	})
+}
+
+// GetServerOperations 服务器的操作历史：进行中和已结束的启动/停止/重启操作，不含执行过程
+func (h *Handler) GetServerOperations(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的服务器ID",
+		})
+		return
+	}
+
+	operations, err := h.Jobs.ServerOperations(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: "获取操作历史失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    operations,
+	})
+}
+
+// GetServerOperation 服务器的一次操作及其执行过程：执行的命令、输出、退出码和耗时
+func (h *Handler) GetServerOperation(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的服务器ID",
+		})
+		return
+	}
+
+	operation, err := h.Jobs.ServerOperation(uint(id), c.Param("jobId"))
+	if errors.Is(err, services.ErrOperationNotFound) {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: "获取操作记录失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    operation,
+	})
+}
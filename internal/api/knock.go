@@ -0,0 +1,59 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetKnock 获取服务器的端口敲门设置、敲门示例命令和当前放行的来源地址
+func (h *Handler) GetKnock(c *gin.Context) {
+	id, ok := parseServerID(c)
+	if !ok {
+		return
+	}
+	server, err := h.l2tp(c).GetServer(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取端口敲门信息成功",
+		Data:    h.Knock.Info(server, h.clientEndpoint(c, server)),
+	})
+}
+
+// RevokeKnockSources 清空服务器放行的来源地址，之后需要重新敲门才能建立新连接
+func (h *Handler) RevokeKnockSources(c *gin.Context) {
+	id, ok := parseServerID(c)
+	if !ok {
+		return
+	}
+	server, err := h.l2tp(c).GetServer(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := h.Knock.Revoke(server.ID); err != nil {
+		h.audit(c, server.ID, "knock_revoke", "failed", err.Error())
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: "清空放行地址失败: " + err.Error(),
+		})
+		return
+	}
+	h.audit(c, server.ID, "knock_revoke", "success", "")
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "已清空放行的来源地址",
+	})
+}
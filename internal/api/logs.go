@@ -0,0 +1,240 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"l2tp-manager/internal/logger"
+	"l2tp-manager/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// logUpgrader 日志跟随的WebSocket升级器，使用默认同源检查
+var logUpgrader = websocket.Upgrader{}
+
+// parseLogQuery 解析日志查询参数
+func parseLogQuery(c *gin.Context) (logger.Query, bool) {
+	since, until, ok := parseTimeRange(c)
+	if !ok {
+		return logger.Query{}, false
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "200"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的limit参数",
+		})
+		return logger.Query{}, false
+	}
+	afterSeq, _ := strconv.ParseUint(c.Query("after_seq"), 10, 64)
+
+	return logger.Query{
+		MinLevel: logger.ParseLevel(c.DefaultQuery("level", "debug")),
+		Since:    since,
+		Until:    until,
+		Keyword:  c.Query("q"),
+		AfterSeq: afterSeq,
+		Limit:    limit,
+	}, true
+}
+
+// GetAppLogs 查询管理面板自身的近期日志
+func (h *Handler) GetAppLogs(c *gin.Context) {
+	query, ok := parseLogQuery(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取日志成功",
+		Data:    h.LogBuffer.Query(query),
+	})
+}
+
+// FollowAppLogs 通过WebSocket实时推送日志，连接建立时先发送满足条件的历史日志
+func (h *Handler) FollowAppLogs(c *gin.Context) {
+	query, ok := parseLogQuery(c)
+	if !ok {
+		return
+	}
+
+	conn, err := logUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// 先订阅再读取历史，避免两者之间的日志丢失
+	entries, unsubscribe := h.LogBuffer.Subscribe()
+	defer unsubscribe()
+
+	var lastSeq uint64
+	for _, entry := range h.LogBuffer.Query(query) {
+		if err := conn.WriteJSON(entry); err != nil {
+			return
+		}
+		lastSeq = entry.Seq
+	}
+
+	// 读取协程仅用于感知客户端断开
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	// 跟随模式只按级别和关键字过滤，时间范围仅作用于历史日志
+	query.Since, query.Until, query.AfterSeq = time.Time{}, time.Time{}, lastSeq
+	ping := time.NewTicker(30 * time.Second)
+	defer ping.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case entry := <-entries:
+			if !query.Match(entry) {
+				continue
+			}
+			if err := conn.WriteJSON(entry); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(5*time.Second)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// 容器日志流参数
+const (
+	serverLogDefaultTail = 100 // 首次跟随时先推送的行数
+	serverLogMaxTail     = 1000
+	serverLogDefaultRate = 100 // 默认每秒最多推送的行数，超出的行丢弃并提示
+	serverLogMaxRate     = 1000
+)
+
+// logStreamControl 容器日志流的控制消息: {"action":"follow"} 开始/继续跟随，{"action":"stop"} 暂停
+type logStreamControl struct {
+	Action string `json:"action"`
+}
+
+// StreamServerLogs 通过WebSocket实时推送服务器容器日志(docker logs -f)，
+// 连接期间保持一个SSH会话，客户端可发送控制消息暂停和继续
+func (h *Handler) StreamServerLogs(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的服务器ID",
+		})
+		return
+	}
+	tail, err := strconv.Atoi(c.DefaultQuery("tail", strconv.Itoa(serverLogDefaultTail)))
+	if err != nil || tail < 0 || tail > serverLogMaxTail {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "tail参数应为0-" + strconv.Itoa(serverLogMaxTail),
+		})
+		return
+	}
+	linesPerSecond, err := strconv.Atoi(c.DefaultQuery("rate", strconv.Itoa(serverLogDefaultRate)))
+	if err != nil || linesPerSecond <= 0 || linesPerSecond > serverLogMaxRate {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "rate参数应为1-" + strconv.Itoa(serverLogMaxRate),
+		})
+		return
+	}
+
+	server, err := h.l2tp(c).GetServer(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: "服务器不存在",
+		})
+		return
+	}
+
+	conn, err := logUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// 读取协程接收控制消息并感知客户端断开
+	controls := make(chan string)
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			var control logStreamControl
+			if err := conn.ReadJSON(&control); err != nil {
+				return
+			}
+			select {
+			case controls <- control.Action:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	stream := services.NewContainerLogStream(h.L2TPService.SSH(), server, tail, linesPerSecond)
+	if c.DefaultQuery("follow", "true") != "false" {
+		stream.Follow(ctx)
+	}
+
+	write := func(event services.LogStreamEvent) bool {
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		return conn.WriteJSON(event) == nil
+	}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	lastPing := time.Now()
+	for {
+		select {
+		case <-closed:
+			return
+		case action := <-controls:
+			switch action {
+			case "follow":
+				stream.Follow(ctx)
+			case "stop":
+				stream.Stop()
+			default:
+				if !write(services.LogStreamEvent{Type: "status", Status: services.LogStreamError, Message: "未知操作: " + action}) {
+					return
+				}
+			}
+		case event := <-stream.Events():
+			if !write(event) {
+				return
+			}
+		case <-ticker.C:
+			if dropped := stream.TakeDropped(); dropped > 0 {
+				if !write(services.LogStreamEvent{Type: "dropped", Count: dropped}) {
+					return
+				}
+			}
+			if time.Since(lastPing) >= 30*time.Second {
+				lastPing = time.Now()
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(5*time.Second)); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"l2tp-manager/internal/database"
+	"l2tp-manager/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// VacuumDatabase 压缩数据库，返回压缩前后的大小
+func (h *Handler) VacuumDatabase(c *gin.Context) {
+	before, err := database.DatabaseSize(h.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: fmt.Sprintf("读取数据库大小失败: %v", err),
+		})
+		return
+	}
+
+	if err := database.Vacuum(h.DB); err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: fmt.Sprintf("数据库压缩失败: %v", err),
+		})
+		return
+	}
+
+	after, _ := database.DatabaseSize(h.DB)
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "数据库压缩完成",
+		Data: gin.H{
+			"size_before": before,
+			"size_after":  after,
+			"reclaimed":   before - after,
+		},
+	})
+}
+
+// RepairRequest 数据库修复请求
+type RepairRequest struct {
+	Issues []string `json:"issues"` // 要修复的问题类型，为空时修复全部
+}
+
+// CheckDatabase 检查数据库完整性和数据一致性
+func (h *Handler) CheckDatabase(c *gin.Context) {
+	report, err := h.L2TPService.CheckDatabase()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: fmt.Sprintf("数据库检查失败: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "检查完成",
+		Data:    report,
+	})
+}
+
+// RepairDatabase 修复数据库检查发现的问题
+func (h *Handler) RepairDatabase(c *gin.Context) {
+	var req RepairRequest
+	if c.Request.ContentLength > 0 {
+		if !bindJSON(c, &req) {
+			return
+		}
+	}
+
+	fixed, err := h.L2TPService.RepairDatabase(req.Issues)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: fmt.Sprintf("数据库修复失败: %v", err),
+		})
+		return
+	}
+
+	// 端口冲突修复会关闭附加协议，重新加载转发器
+	if fixed[services.IssueDuplicatePorts] > 0 {
+		h.RoutingService.Reload()
+	}
+
+	h.audit(c, 0, "db_repair", "success", fmt.Sprintf("%v", fixed))
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "数据库修复完成",
+		Data:    fixed,
+	})
+}
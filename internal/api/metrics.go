@@ -0,0 +1,17 @@
+package api
+
+import (
+	"log/slog"
+
+	"l2tp-manager/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics 以Prometheus文本格式输出监控指标
+func (h *Handler) Metrics(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := metrics.Default.WriteText(c.Writer); err != nil {
+		slog.Error("输出监控指标失败", "error", err)
+	}
+}
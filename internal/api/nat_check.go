@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RunNATCheck 采样落地机的NAT-T流量，检测中转或出口路径是否丢弃UDP 4500保活包
+func (h *Handler) RunNATCheck(c *gin.Context) {
+	id, ok := parseServerID(c)
+	if !ok {
+		return
+	}
+	duration, _ := strconv.Atoi(c.DefaultQuery("duration", "0"))
+	check, err := h.NATChecks.Run(c.Request.Context(), id, duration)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	result := "success"
+	message := "NAT-T检测未发现问题"
+	if len(check.Warnings) > 0 {
+		result, message = "failed", "NAT-T检测发现问题: "+strings.Join(check.Warnings, "；")
+	}
+	h.audit(c, id, "nat_check", result, strings.Join(check.Warnings, "；"))
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: message,
+		Data:    check,
+	})
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+
+	"l2tp-manager/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NotificationChannelInfo 通知渠道及其事件路由
+type NotificationChannelInfo struct {
+	Name     string `json:"name"`
+	RouteKey string `json:"route_key"` // 通过运行时设置修改事件路由
+	Events   string `json:"events"`    // 逗号分隔，为空表示全部
+}
+
+// GetNotificationChannels 获取通知渠道和事件路由
+func (h *Handler) GetNotificationChannels(c *gin.Context) {
+	channels := []NotificationChannelInfo{}
+	for _, name := range h.Notifications.Channels() {
+		key := services.RouteSettingKey(name)
+		channels = append(channels, NotificationChannelInfo{Name: name, RouteKey: key, Events: h.Settings.Get(key)})
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data: gin.H{
+			"channels": channels,
+			"events":   services.NotificationEvents,
+		},
+	})
+}
+
+// TestNotificationChannel 向指定渠道发送测试消息
+func (h *Handler) TestNotificationChannel(c *gin.Context) {
+	channel := c.Param("channel")
+	if err := h.Notifications.Test(channel); err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "测试消息发送失败: " + err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, 0, "notification_test", "success", channel)
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "测试消息已发送",
+	})
+}
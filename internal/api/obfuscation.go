@@ -0,0 +1,36 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetObfuscationClientConfig 下载客户端辅助程序的Xray配置，在客户端一侧解开流量混淆
+func (h *Handler) GetObfuscationClientConfig(c *gin.Context) {
+	id, ok := parseServerID(c)
+	if !ok {
+		return
+	}
+	server, err := h.l2tp(c).GetServer(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	config, err := h.L2TPService.ObfuscationClientConfig(server.ID, h.clientEndpoint(c, server), c.Query("listen"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", server.Name+"-obfuscation.json"))
+	c.Data(http.StatusOK, "application/json", []byte(config))
+}
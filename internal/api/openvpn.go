@@ -0,0 +1,45 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetOpenVPNProfile 下载OpenVPN服务器的客户端配置文件(.ovpn)，所有用户共用，登录时使用各自的用户名密码
+func (h *Handler) GetOpenVPNProfile(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的服务器ID",
+		})
+		return
+	}
+
+	server, err := h.l2tp(c).GetServer(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	profile, err := h.L2TPService.OpenVPNProfile(server.ID, h.clientEndpoint(c, server))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, server.ID, "openvpn_profile", "success", "下载OpenVPN客户端配置")
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", server.Name+".ovpn"))
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(profile))
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"l2tp-manager/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PatchServer 部分更新服务器，只修改请求中提供的字段
+func (h *Handler) PatchServer(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的服务器ID",
+		})
+		return
+	}
+
+	// 拒绝未知字段，避免status等不可修改字段被静默忽略
+	var patch services.ServerPatch
+	if !bindStrictJSON(c, &patch) {
+		return
+	}
+
+	before, server, err := h.L2TPService.PatchServer(uint(id), &patch)
+	if respondConflict(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	// 记录配置修订并热更新转发器
+	if err := h.L2TPService.RecordRevision(server, before, "update", c.GetString("username")); err != nil {
+		slog.Error("记录配置修订失败", "server_id", server.ID, "error", err)
+	}
+	h.RoutingService.ReloadL2TPServer(before.L2TPPort, server)
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "服务器更新成功",
+		Data:    server,
+	})
+}
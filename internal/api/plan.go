@@ -0,0 +1,37 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PlanServerOperation 预览服务器操作将执行的命令和转发变更(不实际执行)
+func (h *Handler) PlanServerOperation(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的服务器ID",
+		})
+		return
+	}
+
+	action := c.DefaultQuery("action", "start")
+	plan, err := h.L2TPService.PlanOperation(uint(id), action)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "生成执行计划成功",
+		Data:    plan,
+	})
+}
@@ -0,0 +1,187 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"l2tp-manager/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parsePortPoolID 解析路径中的端口池ID
+func parsePortPoolID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的端口池ID",
+		})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// GetPortPools 端口池列表及使用情况
+func (h *Handler) GetPortPools(c *gin.Context) {
+	pools, err := h.PortPools.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: "获取端口池列表失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    pools,
+	})
+}
+
+// GetAvailablePortPools 当前用户创建服务器时可自动分配端口的端口池
+func (h *Handler) GetAvailablePortPools(c *gin.Context) {
+	pools, err := h.PortPools.Available(tenantID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: "获取端口池列表失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    pools,
+	})
+}
+
+// CreatePortPool 创建端口池
+func (h *Handler) CreatePortPool(c *gin.Context) {
+	var req services.PortPoolRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	pool, err := h.PortPools.Create(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, 0, "port_pool_create", "success", fmt.Sprintf("%s %d-%d 租户ID %d", pool.Name, pool.StartPort, pool.EndPort, pool.TenantID))
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "端口池创建成功",
+		Data:    pool,
+	})
+}
+
+// UpdatePortPool 修改端口池
+func (h *Handler) UpdatePortPool(c *gin.Context) {
+	id, ok := parsePortPoolID(c)
+	if !ok {
+		return
+	}
+	var req services.PortPoolRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	pool, err := h.PortPools.Update(id, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, 0, "port_pool_update", "success", fmt.Sprintf("%s %d-%d 租户ID %d", pool.Name, pool.StartPort, pool.EndPort, pool.TenantID))
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "端口池已更新",
+		Data:    pool,
+	})
+}
+
+// DeletePortPool 删除端口池
+func (h *Handler) DeletePortPool(c *gin.Context) {
+	id, ok := parsePortPoolID(c)
+	if !ok {
+		return
+	}
+	if err := h.PortPools.Delete(id); err != nil {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, 0, "port_pool_delete", "success", fmt.Sprintf("端口池ID %d", id))
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "端口池已删除",
+	})
+}
+
+// GetPorts 端口登记表：面板自身、服务器中转端口(含回收站)和代理入站占用的端口，可按端口查询占用者
+func (h *Handler) GetPorts(c *gin.Context) {
+	port, _ := strconv.Atoi(c.Query("port"))
+	owners, err := h.PortPools.Ports(port)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: "获取端口占用失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    owners,
+	})
+}
+
+// respondConflict 端口或外部ID已被占用时返回409，data为占用的资源，返回是否已响应。
+// 占用的资源属于其他租户(或平台)时租户用户只能看到已被占用，看不到资源的ID和名称
+func respondConflict(c *gin.Context, err error) bool {
+	var owner services.PortOwner
+	var message, redacted string
+	var portConflict *services.PortConflictError
+	var externalIDConflict *services.ExternalIDConflictError
+	switch {
+	case errors.As(err, &portConflict):
+		owner, message, redacted = portConflict.Owner, portConflict.Error(), portConflict.Redacted()
+	case errors.As(err, &externalIDConflict):
+		owner, message, redacted = externalIDConflict.Owner, externalIDConflict.Error(), externalIDConflict.Redacted()
+	default:
+		return false
+	}
+
+	if !owner.VisibleTo(tenantID(c)) {
+		c.JSON(http.StatusConflict, ApiResponse{
+			Success: false,
+			Message: redacted,
+		})
+		return true
+	}
+	c.JSON(http.StatusConflict, ApiResponse{
+		Success: false,
+		Message: message,
+		Data:    owner,
+	})
+	return true
+}
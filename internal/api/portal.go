@@ -0,0 +1,138 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"l2tp-manager/internal/database"
+	"l2tp-manager/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PortalTokenCreated 创建门户令牌的响应，令牌只返回这一次
+type PortalTokenCreated struct {
+	Token  *database.PortalToken `json:"token"`
+	Secret string                `json:"secret"`
+	URL    string                `json:"url"` // 发给客户的门户链接，令牌位于#之后，不会出现在服务器访问日志中
+}
+
+// GetPortalTokens 服务器的客户门户令牌列表
+func (h *Handler) GetPortalTokens(c *gin.Context) {
+	id, ok := parseServerID(c)
+	if !ok {
+		return
+	}
+	tokens, err := h.L2TPService.ListPortalTokens(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: "获取访问令牌失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    tokens,
+	})
+}
+
+// CreatePortalToken 为服务器创建客户门户令牌
+func (h *Handler) CreatePortalToken(c *gin.Context) {
+	id, ok := parseServerID(c)
+	if !ok {
+		return
+	}
+	var req services.PortalTokenRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	token, secret, err := h.L2TPService.CreatePortalToken(id, req, c.GetString("username"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, id, "portal_token_create", "success", token.Name)
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "访问链接已创建，请妥善保存，之后无法再次查看",
+		Data: PortalTokenCreated{
+			Token:  token,
+			Secret: secret,
+			URL:    panelBaseURL(c) + "/portal#" + secret,
+		},
+	})
+}
+
+// DeletePortalToken 撤销客户门户令牌
+func (h *Handler) DeletePortalToken(c *gin.Context) {
+	id, ok := parseServerID(c)
+	if !ok {
+		return
+	}
+	tokenID, err := strconv.ParseUint(c.Param("tokenId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的访问令牌ID",
+		})
+		return
+	}
+	if err := h.L2TPService.RevokePortalToken(id, uint(tokenID)); err != nil {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, id, "portal_token_delete", "success", c.Param("tokenId"))
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "访问链接已撤销",
+	})
+}
+
+// GetPortal 客户门户数据，通过Authorization: Bearer <门户令牌>认证
+func (h *Handler) GetPortal(c *gin.Context) {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	server, record, err := h.L2TPService.PortalServer(token)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrPortalToken) {
+			status = http.StatusUnauthorized
+		}
+		c.JSON(status, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	view, err := h.L2TPService.PortalView(server, record, h.clientEndpoint(c, server))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: "获取服务器信息失败",
+		})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    view,
+	})
+}
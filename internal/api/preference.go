@@ -0,0 +1,41 @@
+package api
+
+import (
+	"net/http"
+
+	"l2tp-manager/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetPreferences 当前用户的偏好设置
+func (h *Handler) GetPreferences(c *gin.Context) {
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    h.Preferences.Get(c.GetUint("user_id")),
+	})
+}
+
+// UpdatePreferences 更新当前用户的偏好设置，界面语言立即对之后的请求和新建立的WebSocket连接生效
+func (h *Handler) UpdatePreferences(c *gin.Context) {
+	var req services.PreferenceRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	preferences, err := h.Preferences.Update(c.GetUint("user_id"), req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "偏好设置已更新",
+		Data:    preferences,
+	})
+}
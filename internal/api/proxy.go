@@ -0,0 +1,201 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"l2tp-manager/internal/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProxyRequest 创建或更新代理入站的请求
+type ProxyRequest struct {
+	Name         string `json:"name" binding:"required"`
+	Protocol     string `json:"protocol" binding:"omitempty,oneof=socks http"` // socks(默认)/http
+	ListenPort   int    `json:"listen_port" binding:"min=1,max=65535"`         // 中转机监听端口
+	ExitServerID uint   `json:"exit_server_id"`                                // 出口WireGuard服务器
+	ExitPeer     string `json:"exit_peer"`                                     // 中转机连接出口使用的WireGuard用户
+	Accounts     string `json:"accounts"`                                      // 代理账号(JSON格式)，如[{"username":"u1","password":"p1"}]
+	Enabled      *bool  `json:"enabled"`                                       // 默认启用
+}
+
+// proxyInbound 转换为代理入站模型
+func (r *ProxyRequest) proxyInbound() *database.ProxyInbound {
+	proxy := &database.ProxyInbound{
+		Name:         r.Name,
+		Protocol:     r.Protocol,
+		ListenPort:   r.ListenPort,
+		ExitServerID: r.ExitServerID,
+		ExitPeer:     r.ExitPeer,
+		Accounts:     r.Accounts,
+		Enabled:      true,
+	}
+	if r.Enabled != nil {
+		proxy.Enabled = *r.Enabled
+	}
+	return proxy
+}
+
+// parseProxyID 解析代理ID路径参数
+func parseProxyID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的代理ID",
+		})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// GetProxies 获取代理入站列表
+func (h *Handler) GetProxies(c *gin.Context) {
+	proxies, err := h.Proxies.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: "获取代理列表失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    proxies,
+	})
+}
+
+// GetProxy 获取代理入站详情
+func (h *Handler) GetProxy(c *gin.Context) {
+	id, ok := parseProxyID(c)
+	if !ok {
+		return
+	}
+
+	proxy, err := h.Proxies.Get(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    proxy,
+	})
+}
+
+// CreateProxy 创建代理入站
+func (h *Handler) CreateProxy(c *gin.Context) {
+	var req ProxyRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	proxy := req.proxyInbound()
+	if err := h.Proxies.Create(proxy); err != nil {
+		if respondConflict(c, err) {
+			return
+		}
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, proxy.ExitServerID, "proxy_create", "success", fmt.Sprintf("%s(%s:%d)", proxy.Name, proxy.Protocol, proxy.ListenPort))
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "代理创建成功",
+		Data:    proxy,
+	})
+}
+
+// UpdateProxy 更新代理入站
+func (h *Handler) UpdateProxy(c *gin.Context) {
+	id, ok := parseProxyID(c)
+	if !ok {
+		return
+	}
+
+	var req ProxyRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	proxy, err := h.Proxies.Update(id, req.proxyInbound())
+	if respondConflict(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, proxy.ExitServerID, "proxy_update", "success", proxy.Name)
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "代理更新成功",
+		Data:    proxy,
+	})
+}
+
+// DeleteProxy 删除代理入站
+func (h *Handler) DeleteProxy(c *gin.Context) {
+	id, ok := parseProxyID(c)
+	if !ok {
+		return
+	}
+
+	proxy, err := h.Proxies.Delete(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, proxy.ExitServerID, "proxy_delete", "success", proxy.Name)
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "代理已删除",
+	})
+}
+
+// ResetProxyTraffic 清零代理各账号的累计流量
+func (h *Handler) ResetProxyTraffic(c *gin.Context) {
+	id, ok := parseProxyID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.Proxies.ResetTraffic(id); err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, 0, "proxy_traffic_reset", "success", fmt.Sprintf("代理 %d", id))
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "流量已清零",
+	})
+}
@@ -0,0 +1,233 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"l2tp-manager/internal/database"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// agentUpgrader 中转节点不是浏览器，不检查Origin
+var agentUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// RelayNodeCreated 创建节点或重置令牌的响应，令牌只返回这一次
+type RelayNodeCreated struct {
+	Node  *database.RelayNode `json:"node"`
+	Token string              `json:"token"`
+}
+
+// parseRelayNodeID 解析中转节点ID路径参数
+func parseRelayNodeID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的节点ID",
+		})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// AgentConnect 中转节点连接入口，通过Authorization: Bearer <注册令牌>认证；
+// 使用全局AGENT_TOKEN时节点名称取自name查询参数，未登记的节点自动登记
+func (h *Handler) AgentConnect(c *gin.Context) {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	node, err := h.RelayNodes.Authenticate(token, c.Query("name"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	conn, err := agentUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return // Upgrade已写入错误响应
+	}
+	h.Agents.Serve(conn, node, c.ClientIP())
+}
+
+// GetRelayNodes 获取中转节点列表
+func (h *Handler) GetRelayNodes(c *gin.Context) {
+	nodes, err := h.RelayNodes.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: "获取中转节点列表失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    nodes,
+	})
+}
+
+// GetRelayPlacement 推荐放置新服务器的中转节点
+func (h *Handler) GetRelayPlacement(c *gin.Context) {
+	node, err := h.RelayNodes.Placement()
+	if err != nil {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    node,
+	})
+}
+
+// CreateRelayNode 登记中转节点，返回注册令牌
+func (h *Handler) CreateRelayNode(c *gin.Context) {
+	var req database.RelayNode
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	token, err := h.RelayNodes.Create(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, 0, "relay_node_create", "success", req.Name)
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "中转节点已登记，请妥善保存注册令牌，之后无法再次查看",
+		Data:    RelayNodeCreated{Node: &req, Token: token},
+	})
+}
+
+// UpdateRelayNode 更新中转节点
+func (h *Handler) UpdateRelayNode(c *gin.Context) {
+	id, ok := parseRelayNodeID(c)
+	if !ok {
+		return
+	}
+
+	var req database.RelayNode
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	node, err := h.RelayNodes.Update(id, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, 0, "relay_node_update", "success", node.Name)
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "中转节点更新成功",
+		Data:    node,
+	})
+}
+
+// DeleteRelayNode 删除中转节点
+func (h *Handler) DeleteRelayNode(c *gin.Context) {
+	id, ok := parseRelayNodeID(c)
+	if !ok {
+		return
+	}
+
+	node, err := h.RelayNodes.Delete(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, 0, "relay_node_delete", "success", node.Name)
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "中转节点已删除",
+	})
+}
+
+// RotateRelayNodeToken 重新生成节点注册令牌，旧令牌立即失效
+func (h *Handler) RotateRelayNodeToken(c *gin.Context) {
+	id, ok := parseRelayNodeID(c)
+	if !ok {
+		return
+	}
+
+	node, token, err := h.RelayNodes.RotateToken(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, 0, "relay_node_token", "success", node.Name)
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "注册令牌已重置，节点需使用新令牌重新连接",
+		Data:    RelayNodeCreated{Node: node, Token: token},
+	})
+}
+
+// GetServerChain 服务器的转发链：入口、途经的中转节点和落地机，各跳的运行状态、到下一跳的延迟及端到端状态
+func (h *Handler) GetServerChain(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的服务器ID",
+		})
+		return
+	}
+
+	server, err := h.l2tp(c).GetServer(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	chain, err := h.RelayNodes.Chain(server)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    chain,
+	})
+}
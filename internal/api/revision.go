@@ -0,0 +1,79 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetServerRevisions 获取服务器配置修订历史
+func (h *Handler) GetServerRevisions(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的服务器ID",
+		})
+		return
+	}
+
+	revisions, err := h.l2tp(c).GetRevisions(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: "获取修订历史失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    revisions,
+	})
+}
+
+// RollbackServer 回滚服务器配置到指定修订版本
+func (h *Handler) RollbackServer(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的服务器ID",
+		})
+		return
+	}
+
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version <= 0 {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的修订版本号",
+		})
+		return
+	}
+
+	before, server, err := h.L2TPService.RollbackServer(uint(id), version, c.GetString("username"))
+	if respondConflict(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	// 端口或目标地址变化时热更新转发器
+	h.RoutingService.ReloadL2TPServer(before.L2TPPort, server)
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "配置回滚成功",
+		Data:    server,
+	})
+}
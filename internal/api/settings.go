@@ -0,0 +1,61 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetSettings 获取全部设置项及当前生效值
+func (h *Handler) GetSettings(c *gin.Context) {
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    h.Settings.List(),
+	})
+}
+
+// UpdateSettings 批量更新设置，值为null时恢复默认值
+func (h *Handler) UpdateSettings(c *gin.Context) {
+	var req map[string]interface{}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	updates := make(map[string]*string, len(req))
+	var keys []string
+	for key, value := range req {
+		keys = append(keys, key)
+		var text string
+		switch v := value.(type) {
+		case nil:
+			updates[key] = nil
+			continue
+		case float64:
+			// JSON数字解码为float64，按整数格式输出避免科学计数法
+			text = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			text = fmt.Sprint(v)
+		}
+		updates[key] = &text
+	}
+
+	if err := h.Settings.Update(updates); err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, 0, "settings_update", "success", strings.Join(keys, ", "))
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "设置已更新",
+		Data:    h.Settings.List(),
+	})
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RunSyntheticCheck 立即对服务器进行端到端拨测
+func (h *Handler) RunSyntheticCheck(c *gin.Context) {
+	id, ok := parseServerID(c)
+	if !ok {
+		return
+	}
+	record, err := h.Synthetic.Run(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	result := "success"
+	message := "拨测成功"
+	if !record.Success {
+		result, message = "failed", "拨测失败: "+record.Error
+	}
+	h.audit(c, id, "synthetic_check", result, record.Error)
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: message,
+		Data:    record,
+	})
+}
+
+// GetSyntheticChecks 服务器最近的端到端拨测记录
+func (h *Handler) GetSyntheticChecks(c *gin.Context) {
+	id, ok := parseServerID(c)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	records, err := h.Synthetic.History(id, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: "获取拨测记录失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    records,
+	})
+}
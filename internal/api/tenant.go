@@ -0,0 +1,311 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"l2tp-manager/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tenantID 当前登录用户所属的租户，0表示平台管理员
+func tenantID(c *gin.Context) uint {
+	return c.GetUint("tenant_id")
+}
+
+// trafficServerID 解析流量查询的server_id参数。租户用户必须指定自己的服务器，
+// 否则会查询到其他租户的流量
+func (h *Handler) trafficServerID(c *gin.Context) (uint, bool) {
+	serverID, _ := strconv.ParseUint(c.Query("server_id"), 10, 32)
+	tenant := tenantID(c)
+	if tenant == 0 {
+		return uint(serverID), true
+	}
+	if serverID == 0 {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "请指定server_id",
+		})
+		return 0, false
+	}
+	if !h.Tenants.OwnsServer(tenant, uint(serverID)) {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: "服务器不存在",
+		})
+		return 0, false
+	}
+	return uint(serverID), true
+}
+
+// parseTenantID 解析路径中的租户ID
+func parseTenantID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的租户ID",
+		})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// GetCurrentTenant 当前用户所属租户的配额和用量
+func (h *Handler) GetCurrentTenant(c *gin.Context) {
+	tenant := tenantID(c)
+	if tenant == 0 {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: "平台管理员不属于任何租户",
+		})
+		return
+	}
+	usage, err := h.Tenants.Get(tenant)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    usage,
+	})
+}
+
+// GetTenants 租户列表及用量
+func (h *Handler) GetTenants(c *gin.Context) {
+	tenants, err := h.Tenants.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: "获取租户列表失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    tenants,
+	})
+}
+
+// GetTenant 租户详情及用量
+func (h *Handler) GetTenant(c *gin.Context) {
+	id, ok := parseTenantID(c)
+	if !ok {
+		return
+	}
+	usage, err := h.Tenants.Get(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    usage,
+	})
+}
+
+// CreateTenant 创建租户
+func (h *Handler) CreateTenant(c *gin.Context) {
+	var req services.TenantRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	tenant, err := h.Tenants.Create(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, 0, "tenant_create", "success", tenant.Name)
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "租户创建成功",
+		Data:    tenant,
+	})
+}
+
+// UpdateTenant 修改租户
+func (h *Handler) UpdateTenant(c *gin.Context) {
+	id, ok := parseTenantID(c)
+	if !ok {
+		return
+	}
+	var req services.TenantRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	tenant, err := h.Tenants.Update(id, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, 0, "tenant_update", "success", tenant.Name)
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "租户已更新",
+		Data:    tenant,
+	})
+}
+
+// DeleteTenant 删除租户及其用户
+func (h *Handler) DeleteTenant(c *gin.Context) {
+	id, ok := parseTenantID(c)
+	if !ok {
+		return
+	}
+	if err := h.Tenants.Delete(id); err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, 0, "tenant_delete", "success", fmt.Sprintf("租户ID %d", id))
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "租户已删除",
+	})
+}
+
+// GetTenantUsers 租户用户列表
+func (h *Handler) GetTenantUsers(c *gin.Context) {
+	id, ok := parseTenantID(c)
+	if !ok {
+		return
+	}
+	users, err := h.Tenants.ListUsers(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    users,
+	})
+}
+
+// CreateTenantUser 创建租户用户
+func (h *Handler) CreateTenantUser(c *gin.Context) {
+	id, ok := parseTenantID(c)
+	if !ok {
+		return
+	}
+	var req services.TenantUserRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	user, err := h.Tenants.CreateUser(id, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, 0, "tenant_user_create", "success", fmt.Sprintf("租户ID %d 用户 %s", id, user.Username))
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "用户创建成功",
+		Data:    user,
+	})
+}
+
+// DeleteTenantUser 删除租户用户
+func (h *Handler) DeleteTenantUser(c *gin.Context) {
+	id, ok := parseTenantID(c)
+	if !ok {
+		return
+	}
+	userID, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的用户ID",
+		})
+		return
+	}
+
+	if err := h.Tenants.DeleteUser(id, uint(userID)); err != nil {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, 0, "tenant_user_delete", "success", fmt.Sprintf("租户ID %d 用户ID %d", id, userID))
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "用户已删除",
+	})
+}
+
+// AssignTenantServer 将服务器分配给租户，租户ID为0表示收回到平台
+func (h *Handler) AssignTenantServer(c *gin.Context) {
+	id, ok := parseTenantID(c)
+	if !ok {
+		return
+	}
+	serverID, err := strconv.ParseUint(c.Param("serverId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的服务器ID",
+		})
+		return
+	}
+
+	server, err := h.Tenants.AssignServer(uint(serverID), id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, server.ID, "tenant_assign", "success", fmt.Sprintf("分配给租户ID %d", id))
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "服务器已分配",
+		Data:    server,
+	})
+}
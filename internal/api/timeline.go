@@ -0,0 +1,55 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"l2tp-manager/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetServerTimeline 服务器的事件时间线：可用性变化、操作、健康事件、配置修订、告警和拨测失败按时间倒序合并
+func (h *Handler) GetServerTimeline(c *gin.Context) {
+	id, ok := parseServerID(c)
+	if !ok {
+		return
+	}
+	since, ok := parseTimeParam(c.Query("since"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的开始时间",
+		})
+		return
+	}
+	until, ok := parseTimeParam(c.Query("until"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的结束时间",
+		})
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	var types []string
+	if value := c.Query("types"); value != "" {
+		types = strings.Split(value, ",")
+	}
+
+	events, err := h.Timeline.Timeline(id, services.TimelineQuery{Since: since, Until: until, Types: types, Limit: limit})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: "获取时间线失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    events,
+	})
+}
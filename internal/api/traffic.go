@@ -0,0 +1,137 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"l2tp-manager/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseTimeParam 解析时间查询参数，支持RFC3339和Unix秒
+func parseTimeParam(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, true
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+	if sec, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(sec, 0), true
+	}
+	return time.Time{}, false
+}
+
+// GetTrafficLogs 查询流量日志
+func (h *Handler) GetTrafficLogs(c *gin.Context) {
+	serverID, ok := h.trafficServerID(c)
+	if !ok {
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "500"))
+	if err != nil || limit <= 0 || limit > 5000 {
+		limit = 500
+	}
+
+	since, ok := parseTimeParam(c.Query("since"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的开始时间",
+		})
+		return
+	}
+	until, ok := parseTimeParam(c.Query("until"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的结束时间",
+		})
+		return
+	}
+
+	logs, err := h.l2tp(c).GetTrafficLogs(services.TrafficLogQuery{
+		ServerID: serverID,
+		ClientIP: c.Query("client_ip"),
+		Since:    since,
+		Until:    until,
+		Limit:    limit,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: "获取流量日志失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    logs,
+	})
+}
+
+// GetTrafficCountries 按客户端所属国家/地区汇总流量
+func (h *Handler) GetTrafficCountries(c *gin.Context) {
+	serverID, ok := h.trafficServerID(c)
+	if !ok {
+		return
+	}
+	since, ok := parseTimeParam(c.Query("since"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的开始时间",
+		})
+		return
+	}
+	until, ok := parseTimeParam(c.Query("until"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的结束时间",
+		})
+		return
+	}
+
+	countries, err := h.l2tp(c).TrafficByCountry(serverID, since, until)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: "汇总国家流量失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    countries,
+	})
+}
+
+// GetTrafficHistory 获取流量历史时间序列
+func (h *Handler) GetTrafficHistory(c *gin.Context) {
+	serverID, ok := h.trafficServerID(c)
+	if !ok {
+		return
+	}
+
+	history, err := h.l2tp(c).GetTrafficHistory(serverID, c.DefaultQuery("range", "24h"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    history,
+	})
+}
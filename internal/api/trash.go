@@ -0,0 +1,84 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetTrashedServers 获取回收站中的服务器
+func (h *Handler) GetTrashedServers(c *gin.Context) {
+	servers, err := h.l2tp(c).GetTrashedServers(tenantID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: "获取回收站列表失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    servers,
+	})
+}
+
+// RestoreServer 从回收站恢复服务器
+func (h *Handler) RestoreServer(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的服务器ID",
+		})
+		return
+	}
+
+	server, err := h.L2TPService.RestoreServer(uint(id))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	// 重新加入路由服务
+	h.RoutingService.AddL2TPServer(server)
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "服务器恢复成功",
+		Data:    server,
+	})
+}
+
+// PurgeServer 永久删除回收站中的服务器
+func (h *Handler) PurgeServer(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的服务器ID",
+		})
+		return
+	}
+
+	if err := h.L2TPService.PurgeServer(uint(id)); err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: fmt.Sprintf("永久删除失败: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "服务器已永久删除",
+	})
+}
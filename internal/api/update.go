@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"l2tp-manager/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CheckUpdate 检查是否有新版本，只查询不安装
+func (h *Handler) CheckUpdate(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+
+	info, _, err := h.Update.Check(ctx)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "检查完成",
+		Data:    info,
+	})
+}
+
+// ApplyUpdate 安装新版本，成功后返回响应并平滑重启
+func (h *Handler) ApplyUpdate(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Minute)
+	defer cancel()
+
+	info, err := h.Update.Apply(ctx)
+	if errors.Is(err, services.ErrUpdateUnsigned) {
+		c.JSON(http.StatusPreconditionFailed, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		h.audit(c, 0, "system_update", "failed", err.Error())
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: "更新失败: " + err.Error(),
+		})
+		return
+	}
+	if !info.UpdateAvailable {
+		c.JSON(http.StatusOK, ApiResponse{
+			Success: true,
+			Message: "已是最新版本",
+			Data:    info,
+		})
+		return
+	}
+
+	h.audit(c, 0, "system_update", "success", info.CurrentVersion+" -> "+info.LatestVersion)
+	h.Restart.Request(time.Second)
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "新版本已安装，服务即将重启",
+		Data:    info,
+	})
+}
+
+// RestartPanel 平滑重启面板，保留HTTP监听和转发端口
+func (h *Handler) RestartPanel(c *gin.Context) {
+	h.audit(c, 0, "system_restart", "success", "")
+	h.Restart.Request(time.Second)
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "服务即将重启",
+	})
+}
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"l2tp-manager/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// usagePeriodParam 读取period查询参数，默认为上个月
+func usagePeriodParam(c *gin.Context) string {
+	if period := c.Query("period"); period != "" {
+		return period
+	}
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()).AddDate(0, -1, 0).Format("2006-01")
+}
+
+// GetUsageReport 获取已生成的月度用量报告
+func (h *Handler) GetUsageReport(c *gin.Context) {
+	period := usagePeriodParam(c)
+	serverID, _ := strconv.ParseUint(c.Query("server_id"), 10, 32)
+	reports, err := h.Usage.Report(period, uint(serverID))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if len(reports) == 0 && serverID == 0 {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: "该月用量报告尚未生成",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    reports,
+	})
+}
+
+// GenerateUsageReport 生成或重新生成月度用量报告，当月报告为截至目前的用量
+func (h *Handler) GenerateUsageReport(c *gin.Context) {
+	period := usagePeriodParam(c)
+	reports, err := h.Usage.Generate(period)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, 0, "usage_report_generate", "success", period)
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "用量报告已生成",
+		Data:    reports,
+	})
+}
+
+// GetUsagePeriods 已生成用量报告的月份
+func (h *Handler) GetUsagePeriods(c *gin.Context) {
+	periods, err := h.Usage.Periods()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: "获取报告列表失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    periods,
+	})
+}
+
+// ExportUsageReport 导出月度用量报告(CSV/XLSX/PDF)
+func (h *Handler) ExportUsageReport(c *gin.Context) {
+	period := usagePeriodParam(c)
+	if _, _, err := services.ParseUsagePeriod(period); err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	serverID, _ := strconv.ParseUint(c.Query("server_id"), 10, 32)
+
+	streamTable(c, "usage_"+period, func(w services.TableWriter) error {
+		return h.Usage.ExportReport(w, period, uint(serverID))
+	})
+}
+
+// GetAccountUsage 获取L2TP服务器各账号在指定计费周期(默认当前周期)的流量和配额使用情况
+func (h *Handler) GetAccountUsage(c *gin.Context) {
+	id, ok := parseServerID(c)
+	if !ok {
+		return
+	}
+	server, err := h.l2tp(c).GetServer(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	accounts, err := h.Usage.Accounts(server, c.Query("period"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    accounts,
+	})
+}
+
+// CollectAccountUsage 立即从落地机读取账号流量计数，返回各账号本计费周期的流量
+func (h *Handler) CollectAccountUsage(c *gin.Context) {
+	id, ok := parseServerID(c)
+	if !ok {
+		return
+	}
+	server, err := h.l2tp(c).GetServer(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := h.Usage.CollectServer(c.Request.Context(), server); err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	accounts, err := h.Usage.Accounts(server, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "账号流量已更新",
+		Data:    accounts,
+	})
+}
+
+// ResumeAccount 手动恢复因超出流量配额被停用的账号，本计费周期不再因超额停用
+func (h *Handler) ResumeAccount(c *gin.Context) {
+	id, ok := parseServerID(c)
+	if !ok {
+		return
+	}
+	server, err := h.l2tp(c).GetServer(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	username := c.Param("username")
+	if err := h.Usage.ResumeAccount(c.Request.Context(), server, username); err != nil {
+		h.audit(c, server.ID, "account_resume", "failed", username+": "+err.Error())
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	h.audit(c, server.ID, "account_resume", "success", username)
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "账号已恢复，本计费周期不再因超出流量配额停用",
+	})
+}
@@ -0,0 +1,238 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"l2tp-manager/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError 字段级校验错误
+type FieldError struct {
+	Field   string `json:"field"`   // JSON字段路径，如 users[0].username
+	Rule    string `json:"rule"`    // 未通过的校验规则，如 required、max
+	Message string `json:"message"` // 可展示的错误描述
+}
+
+func init() {
+	// 校验错误使用JSON字段名，与请求体一致
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return field.Name
+			}
+			return name
+		})
+	}
+}
+
+// bindJSON 解析并校验JSON请求体(按结构体的binding标签)，失败时返回带错误码和字段错误的400响应。
+// 请求体会被缓存，之后仍可再次读取(如幂等键计算请求摘要)
+func bindJSON(c *gin.Context, obj interface{}) bool {
+	if err := c.ShouldBindBodyWith(obj, binding.JSON); err != nil {
+		bindError(c, err)
+		return false
+	}
+	return true
+}
+
+// bindStrictJSON 与bindJSON相同，但请求体包含结构体中没有的字段时返回校验错误
+func bindStrictJSON(c *gin.Context, obj interface{}) bool {
+	if err := c.ShouldBindBodyWith(obj, strictJSON{}); err != nil {
+		bindError(c, err)
+		return false
+	}
+	return true
+}
+
+// strictJSON 拒绝未知字段的JSON绑定
+type strictJSON struct{}
+
+func (strictJSON) Name() string {
+	return "json"
+}
+
+func (b strictJSON) Bind(req *http.Request, obj interface{}) error {
+	if req == nil || req.Body == nil {
+		return errors.New("invalid request")
+	}
+	return b.decode(req.Body, obj)
+}
+
+func (b strictJSON) BindBody(body []byte, obj interface{}) error {
+	return b.decode(bytes.NewReader(body), obj)
+}
+
+func (strictJSON) decode(r io.Reader, obj interface{}) error {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(obj); err != nil {
+		return err
+	}
+	if binding.Validator == nil {
+		return nil
+	}
+	return binding.Validator.ValidateStruct(obj)
+}
+
+// unknownFieldPrefix encoding/json报告未知字段的错误前缀
+const unknownFieldPrefix = "json: unknown field "
+
+// bindError 将请求解析或校验错误转换为标准错误响应
+func bindError(c *gin.Context, err error) {
+	response := ApiResponse{Success: false, Code: middleware.ErrCodeInvalidRequest}
+
+	var validationErrors validator.ValidationErrors
+	var typeError *json.UnmarshalTypeError
+	var syntaxError *json.SyntaxError
+	switch {
+	case errors.As(err, &validationErrors):
+		response.Code = middleware.ErrCodeValidation
+		for _, e := range validationErrors {
+			response.Errors = append(response.Errors, FieldError{
+				Field:   fieldPath(e),
+				Rule:    e.Tag(),
+				Message: ruleMessage(e),
+			})
+		}
+	case errors.As(err, &typeError):
+		response.Code = middleware.ErrCodeValidation
+		response.Errors = []FieldError{{
+			Field:   typeError.Field,
+			Rule:    "type",
+			Message: fmt.Sprintf("类型错误，应为%s", jsonTypeName(typeError.Type)),
+		}}
+	case errors.As(err, &syntaxError):
+		response.Message = "请求参数错误: 请求体不是有效的JSON"
+	case errors.Is(err, io.EOF):
+		response.Message = "请求参数错误: 请求体为空"
+	case strings.HasPrefix(err.Error(), unknownFieldPrefix):
+		response.Code = middleware.ErrCodeValidation
+		response.Errors = []FieldError{{
+			Field:   strings.Trim(strings.TrimPrefix(err.Error(), unknownFieldPrefix), `"`),
+			Rule:    "unknown",
+			Message: "不支持的字段",
+		}}
+	default:
+		response.Message = "请求参数错误: " + err.Error()
+	}
+
+	if len(response.Errors) > 0 {
+		response.Message = fieldErrorsMessage(response.Errors)
+	}
+	c.JSON(http.StatusBadRequest, response)
+}
+
+// fieldError 返回单个查询参数或字段校验失败的400响应，格式与请求体校验错误一致
+func fieldError(c *gin.Context, field, rule, message string) {
+	errs := []FieldError{{Field: field, Rule: rule, Message: message}}
+	c.JSON(http.StatusBadRequest, ApiResponse{
+		Success: false,
+		Code:    middleware.ErrCodeValidation,
+		Message: fieldErrorsMessage(errs),
+		Errors:  errs,
+	})
+}
+
+// fieldErrorsMessage 字段错误汇总成的可展示描述
+func fieldErrorsMessage(errs []FieldError) string {
+	details := make([]string, 0, len(errs))
+	for _, e := range errs {
+		details = append(details, e.Field+" "+e.Message)
+	}
+	return "请求参数错误: " + strings.Join(details, "; ")
+}
+
+// internalError 记录内部错误并返回500响应，响应中不包含数据库等内部错误的原文
+func internalError(c *gin.Context, message string, err error) {
+	slog.Error(message, "path", c.FullPath(), "error", err)
+	c.JSON(http.StatusInternalServerError, ApiResponse{
+		Success: false,
+		Code:    middleware.ErrCodeInternal,
+		Message: message,
+	})
+}
+
+// fieldPath 校验错误的JSON字段路径，去掉根结构体名
+func fieldPath(e validator.FieldError) string {
+	namespace := e.Namespace()
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[i+1:]
+	}
+	return e.Field()
+}
+
+// ruleMessage 校验规则的中文描述
+func ruleMessage(e validator.FieldError) string {
+	isString := e.Kind() == reflect.String
+	isCollection := e.Kind() == reflect.Slice || e.Kind() == reflect.Map || e.Kind() == reflect.Array
+	switch e.Tag() {
+	case "required":
+		return "不能为空"
+	case "min", "gte":
+		if isString {
+			return fmt.Sprintf("长度不能小于%s", e.Param())
+		}
+		if isCollection {
+			return fmt.Sprintf("至少需要%s项", e.Param())
+		}
+		return fmt.Sprintf("不能小于%s", e.Param())
+	case "max", "lte":
+		if isString {
+			return fmt.Sprintf("长度不能超过%s", e.Param())
+		}
+		if isCollection {
+			return fmt.Sprintf("最多%s项", e.Param())
+		}
+		return fmt.Sprintf("不能大于%s", e.Param())
+	case "gt":
+		return fmt.Sprintf("必须大于%s", e.Param())
+	case "lt":
+		return fmt.Sprintf("必须小于%s", e.Param())
+	case "oneof":
+		return fmt.Sprintf("必须是以下之一: %s", strings.ReplaceAll(e.Param(), " ", ", "))
+	case "ip":
+		return "必须是有效的IP地址"
+	case "hostname_rfc1123", "hostname":
+		return "必须是有效的主机名"
+	case "url", "http_url":
+		return "必须是有效的URL"
+	case "email":
+		return "必须是有效的邮箱地址"
+	case "cidr":
+		return "必须是有效的CIDR网段"
+	}
+	return fmt.Sprintf("未通过校验规则 %s", e.Tag())
+}
+
+// jsonTypeName 字段类型对应的JSON类型名
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "布尔值"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "数字"
+	case reflect.String:
+		return "字符串"
+	case reflect.Slice, reflect.Array:
+		return "数组"
+	}
+	return "对象"
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"l2tp-manager/internal/database"
+	"l2tp-manager/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseWebhookID 解析Webhook ID路径参数
+func parseWebhookID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的Webhook ID",
+		})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// GetWebhookEvents 获取可订阅的事件类型
+func (h *Handler) GetWebhookEvents(c *gin.Context) {
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    services.NotificationEvents,
+	})
+}
+
+// GetWebhooks 获取Webhook列表
+func (h *Handler) GetWebhooks(c *gin.Context) {
+	hooks, err := h.WebhookService.ListWebhooks()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: "获取Webhook列表失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    hooks,
+	})
+}
+
+// CreateWebhook 创建Webhook
+func (h *Handler) CreateWebhook(c *gin.Context) {
+	var req database.Webhook
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if err := h.WebhookService.CreateWebhook(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, 0, "webhook_create", "success", req.Name+" "+req.URL)
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "Webhook创建成功",
+		Data:    services.MaskWebhook(&req),
+	})
+}
+
+// UpdateWebhook 更新Webhook，secret为占位符时保留原值
+func (h *Handler) UpdateWebhook(c *gin.Context) {
+	id, ok := parseWebhookID(c)
+	if !ok {
+		return
+	}
+
+	var req database.Webhook
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	hook, err := h.WebhookService.UpdateWebhook(id, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, 0, "webhook_update", "success", hook.Name+" "+hook.URL)
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "Webhook更新成功",
+		Data:    services.MaskWebhook(hook),
+	})
+}
+
+// DeleteWebhook 删除Webhook
+func (h *Handler) DeleteWebhook(c *gin.Context) {
+	id, ok := parseWebhookID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.WebhookService.DeleteWebhook(id); err != nil {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, 0, "webhook_delete", "success", strconv.FormatUint(uint64(id), 10))
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "Webhook已删除",
+	})
+}
+
+// TestWebhook 发送测试事件并返回投递结果
+func (h *Handler) TestWebhook(c *gin.Context) {
+	id, ok := parseWebhookID(c)
+	if !ok {
+		return
+	}
+
+	delivery, err := h.WebhookService.Test(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	message := "测试消息发送成功"
+	if !delivery.Success {
+		message = "测试消息发送失败: " + delivery.Error
+	}
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: delivery.Success,
+		Message: message,
+		Data:    delivery,
+	})
+}
+
+// GetWebhookDeliveries 获取Webhook投递历史
+func (h *Handler) GetWebhookDeliveries(c *gin.Context) {
+	id, ok := parseWebhookID(c)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+
+	deliveries, err := h.WebhookService.Deliveries(id, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ApiResponse{
+			Success: false,
+			Message: "获取投递记录失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    deliveries,
+	})
+}
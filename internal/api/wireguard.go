@@ -0,0 +1,95 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+
+	"l2tp-manager/internal/database"
+	"l2tp-manager/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// clientEndpoint 客户端配置文件中的中转机地址：优先使用endpoint参数，其次为负责转发的中转节点，否则为访问面板的地址
+func (h *Handler) clientEndpoint(c *gin.Context, server *database.L2TPServer) string {
+	endpoint := c.Query("endpoint")
+	if endpoint == "" && server.RelayNodeID != 0 {
+		if node, err := h.RelayNodes.Get(server.RelayNodeID); err == nil {
+			endpoint = services.RelayNodeAddress(node)
+		}
+	}
+	if endpoint == "" {
+		endpoint = c.Request.Host
+		if host, _, err := net.SplitHostPort(endpoint); err == nil {
+			endpoint = host
+		}
+	}
+	return endpoint
+}
+
+// GetWireGuardPeers 列出WireGuard服务器的客户端(按用户配置生成)
+func (h *Handler) GetWireGuardPeers(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的服务器ID",
+		})
+		return
+	}
+
+	peers, err := h.L2TPService.WireGuardPeers(uint(id))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApiResponse{
+		Success: true,
+		Message: "获取成功",
+		Data:    peers,
+	})
+}
+
+// GetWireGuardConfig 下载WireGuard用户的客户端配置文件
+func (h *Handler) GetWireGuardConfig(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的服务器ID",
+		})
+		return
+	}
+
+	server, err := h.l2tp(c).GetServer(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	name := c.Param("peer")
+	config, err := h.L2TPService.WireGuardClientConfig(server.ID, name, h.clientEndpoint(c, server))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, server.ID, "wireguard_config", "success", fmt.Sprintf("下载用户 %s 的WireGuard配置", name))
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("%s-%s.conf", server.Name, name)))
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(config))
+}
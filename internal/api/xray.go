@@ -0,0 +1,79 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"l2tp-manager/internal/qrcode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// xrayQRCodeScale 分享二维码每个模块的像素数
+const xrayQRCodeScale = 8
+
+// GetXrayShareLink 获取Shadowsocks/VLESS用户的分享链接，format=qrcode时返回二维码PNG图片
+func (h *Handler) GetXrayShareLink(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "无效的服务器ID",
+		})
+		return
+	}
+
+	server, err := h.l2tp(c).GetServer(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	name := c.Param("user")
+	format := c.DefaultQuery("format", "uri")
+	if format != "uri" && format != "qrcode" {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: "format只能是uri或qrcode",
+		})
+		return
+	}
+
+	link, err := h.L2TPService.XrayShareLink(server.ID, name, h.clientEndpoint(c, server))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ApiResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	h.audit(c, server.ID, "xray_share_link", "success", fmt.Sprintf("获取用户 %s 的分享链接(%s)", name, format))
+
+	if format == "uri" {
+		c.JSON(http.StatusOK, ApiResponse{
+			Success: true,
+			Message: "获取成功",
+			Data:    gin.H{"uri": link},
+		})
+		return
+	}
+
+	code, err := qrcode.Encode([]byte(link))
+	if err == nil {
+		var image []byte
+		if image, err = code.PNG(xrayQRCodeScale); err == nil {
+			c.Data(http.StatusOK, "image/png", image)
+			return
+		}
+	}
+	c.JSON(http.StatusInternalServerError, ApiResponse{
+		Success: false,
+		Message: "生成二维码失败: " + err.Error(),
+	})
+}
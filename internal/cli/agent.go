@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"l2tp-manager/internal/logger"
+	"l2tp-manager/internal/services"
+)
+
+// agentCommand 以中转节点模式运行：只运行转发引擎，不使用数据库和配置文件
+func agentCommand() *Command {
+	var panelURL, token, name, forwardMode, geoipPath string
+	return &Command{
+		Name:   "agent",
+		Short:  "以中转节点模式运行，连接面板接收转发配置",
+		Daemon: true,
+		Flags: func(fs *flag.FlagSet) {
+			hostname, _ := os.Hostname()
+			fs.StringVar(&panelURL, "panel", os.Getenv("AGENT_PANEL_URL"), "面板地址，如 https://panel.example.com (AGENT_PANEL_URL)")
+			fs.StringVar(&token, "token", os.Getenv("AGENT_TOKEN"), "节点注册令牌，或面板的全局AGENT_TOKEN (AGENT_TOKEN)")
+			fs.StringVar(&name, "name", envOr("AGENT_NAME", hostname), "节点名称，使用全局AGENT_TOKEN时按该名称登记 (AGENT_NAME)")
+			fs.StringVar(&forwardMode, "forward-mode", envOr("FORWARD_MODE", services.ForwardModeUserspace), "转发方式：userspace 或 kernel(iptables DNAT，需要root权限) (FORWARD_MODE)")
+			fs.StringVar(&geoipPath, "geoip", os.Getenv("GEOIP_PATH"), "GeoIP数据库(geoip.dat)路径，执行服务器的国家访问策略时需要 (GEOIP_PATH)")
+		},
+		Run: func(env *Env, fs *flag.FlagSet) error {
+			if panelURL == "" || token == "" {
+				return usageError(fs, "需要指定 --panel 和 --token")
+			}
+			if !services.ValidAgentName(name) {
+				return usageError(fs, "节点名称只能包含字母、数字、点、下划线和连字符，且不超过64个字符")
+			}
+			if forwardMode != services.ForwardModeUserspace && forwardMode != services.ForwardModeKernel {
+				return usageError(fs, "转发方式只能是 userspace 或 kernel")
+			}
+			logger.Setup(os.Stderr, os.Getenv("LOG_LEVEL"), os.Getenv("LOG_FORMAT"), 0)
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			agent := services.NewRelayAgent(panelURL, token, name, env.Version)
+			agent.SetForwardMode(forwardMode)
+			if geoipPath != "" {
+				geoip, err := services.LoadGeoIP(geoipPath)
+				if err != nil {
+					return err
+				}
+				agent.SetGeoIP(geoip)
+			}
+			return agent.Run(ctx)
+		},
+	}
+}
+
+// envOr 读取环境变量，未设置时返回默认值
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,202 @@
+// Package cli 命令行子命令，用于在不经过HTTP API的情况下管理面板
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+
+	"l2tp-manager/internal/config"
+	"l2tp-manager/internal/database"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// Command 子命令，Run和Subcommands二选一
+type Command struct {
+	Name        string
+	Usage       string // 参数说明，如 "<id|名称>"
+	Short       string // 一行简介
+	Flags       func(fs *flag.FlagSet)
+	Run         func(env *Env, fs *flag.FlagSet) error
+	Subcommands []*Command
+	Daemon      bool // 常驻运行的命令，保留info日志
+}
+
+// Env 子命令的运行环境，按需加载配置和打开数据库
+type Env struct {
+	ConfigFile string
+	Stdout     io.Writer
+	Version    string
+
+	cfg *config.Config
+	db  *gorm.DB
+}
+
+// Config 加载配置
+func (e *Env) Config() (*config.Config, error) {
+	if e.cfg == nil {
+		cfg, err := config.Load(e.ConfigFile)
+		if err != nil {
+			return nil, err
+		}
+		e.cfg = cfg
+	}
+	return e.cfg, nil
+}
+
+// DB 打开配置中的数据库
+func (e *Env) DB() (*gorm.DB, error) {
+	if e.db == nil {
+		cfg, err := e.Config()
+		if err != nil {
+			return nil, err
+		}
+		db, err := database.Initialize(cfg.DatabaseDriver, cfg.DatabaseDSN())
+		if err != nil {
+			return nil, fmt.Errorf("打开数据库失败: %v", err)
+		}
+		// 标准输出留给命令结果(如export)，SQL日志只输出错误到标准错误
+		db.Logger = gormlogger.New(log.New(os.Stderr, "", log.LstdFlags), gormlogger.Config{
+			LogLevel:                  gormlogger.Error,
+			IgnoreRecordNotFoundError: true,
+		})
+		e.db = db
+	}
+	return e.db, nil
+}
+
+// close 关闭数据库
+func (e *Env) close() {
+	if e.db != nil {
+		if sqlDB, err := e.db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}
+}
+
+// errUsage 参数错误，已输出用法说明
+var errUsage = errors.New("参数错误")
+
+// Execute 解析命令行并执行子命令，返回进程退出码。未指定子命令时执行serve以保持原有启动方式
+func Execute(args []string, version string, serve func(cfg *config.Config)) int {
+	env := &Env{Stdout: os.Stdout, Version: version}
+	defer env.close()
+
+	root := &Command{
+		Name:  "l2tp-manager",
+		Short: "L2TP中转管理面板",
+		Subcommands: append([]*Command{{
+			Name:   "serve",
+			Short:  "启动管理面板(默认)",
+			Daemon: true,
+			Run: func(env *Env, fs *flag.FlagSet) error {
+				cfg, err := env.Config()
+				if err != nil {
+					return err
+				}
+				serve(cfg)
+				return nil
+			},
+		}}, commands()...),
+	}
+
+	// 全局参数写在子命令之前，如 l2tp-manager --config config.yaml server list
+	global := newFlagSet(root.Name, env)
+	global.Usage = func() { printUsage(global.Output(), root, root.Name) }
+	if err := global.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	args = global.Args()
+	if len(args) == 0 {
+		args = []string{"serve"}
+	}
+
+	if err := run(env, root, root.Name, args); err != nil {
+		if err != errUsage && err != flag.ErrHelp {
+			fmt.Fprintln(os.Stderr, "错误:", err)
+		}
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 1
+	}
+	return 0
+}
+
+// run 查找并执行子命令
+func run(env *Env, cmd *Command, path string, args []string) error {
+	if len(cmd.Subcommands) > 0 {
+		if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+			printUsage(os.Stderr, cmd, path)
+			if len(args) == 0 {
+				return errUsage
+			}
+			return flag.ErrHelp
+		}
+		for _, sub := range cmd.Subcommands {
+			if sub.Name == args[0] {
+				return run(env, sub, path+" "+sub.Name, args[1:])
+			}
+		}
+		fmt.Fprintf(os.Stderr, "未知的命令 %q\n\n", args[0])
+		printUsage(os.Stderr, cmd, path)
+		return errUsage
+	}
+
+	fs := newFlagSet(path, env)
+	if cmd.Flags != nil {
+		cmd.Flags(fs)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "用法: %s [参数] %s\n\n%s\n", path, cmd.Usage, cmd.Short)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !cmd.Daemon {
+		// 子命令只输出结果，数据库初始化等日志只保留警告以上
+		slog.SetLogLoggerLevel(slog.LevelWarn)
+	}
+	return cmd.Run(env, fs)
+}
+
+// newFlagSet 创建带 --config 参数的参数集
+func newFlagSet(name string, env *Env) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	if env.ConfigFile == "" {
+		env.ConfigFile = os.Getenv("CONFIG_FILE")
+	}
+	fs.StringVar(&env.ConfigFile, "config", env.ConfigFile, "配置文件路径(.yaml/.yml/.toml)，环境变量优先于配置文件")
+	return fs
+}
+
+// printUsage 输出命令及其子命令列表
+func printUsage(w io.Writer, cmd *Command, path string) {
+	fmt.Fprintf(w, "用法: %s [--config 配置文件] <命令>\n\n%s\n\n命令:\n", path, cmd.Short)
+	width := 0
+	for _, sub := range cmd.Subcommands {
+		width = max(width, len(sub.Name))
+	}
+	for _, sub := range cmd.Subcommands {
+		fmt.Fprintf(w, "  %s%s  %s\n", sub.Name, strings.Repeat(" ", width-len(sub.Name)), sub.Short)
+	}
+	fmt.Fprintf(w, "\n使用 \"%s <命令> --help\" 查看命令的参数\n", path)
+}
+
+// usageError 输出用法并返回参数错误
+func usageError(fs *flag.FlagSet, format string, args ...interface{}) error {
+	fmt.Fprintf(fs.Output(), format+"\n\n", args...)
+	fs.Usage()
+	return errUsage
+}
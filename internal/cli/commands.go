@@ -0,0 +1,314 @@
+package cli
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"l2tp-manager/internal/database"
+	"l2tp-manager/internal/logger"
+	"l2tp-manager/internal/services"
+
+	"gorm.io/gorm"
+)
+
+// cliOperator 命令行操作在审计日志中的操作人
+const cliOperator = "cli"
+
+// serverActionTimeout 等待服务器启动/停止完成的最长时间
+const serverActionTimeout = 5 * time.Minute
+
+// commands 除serve外的全部子命令
+func commands() []*Command {
+	var (
+		username, password string
+		passphrase, output string
+	)
+	return []*Command{
+		{
+			Name:  "user",
+			Short: "管理面板登录用户",
+			Subcommands: []*Command{{
+				Name:  "reset-password",
+				Short: "重置登录密码，未指定 --password 时生成随机密码",
+				Flags: func(fs *flag.FlagSet) {
+					fs.StringVar(&username, "username", "admin", "用户名")
+					fs.StringVar(&password, "password", "", "新密码，留空则随机生成")
+				},
+				Run: func(env *Env, fs *flag.FlagSet) error {
+					return resetPassword(env, username, password)
+				},
+			}},
+		},
+		{
+			Name:  "server",
+			Short: "查看和启停L2TP服务器",
+			Subcommands: []*Command{
+				{
+					Name:  "list",
+					Short: "列出服务器",
+					Run: func(env *Env, fs *flag.FlagSet) error {
+						return listServers(env)
+					},
+				},
+				{
+					Name:  "start",
+					Usage: "<id|名称>",
+					Short: "启动服务器",
+					Run: func(env *Env, fs *flag.FlagSet) error {
+						if fs.NArg() != 1 {
+							return usageError(fs, "需要指定一个服务器ID或名称")
+						}
+						return serverAction(env, fs.Arg(0), true)
+					},
+				},
+				{
+					Name:  "stop",
+					Usage: "<id|名称>",
+					Short: "停止服务器",
+					Run: func(env *Env, fs *flag.FlagSet) error {
+						if fs.NArg() != 1 {
+							return usageError(fs, "需要指定一个服务器ID或名称")
+						}
+						return serverAction(env, fs.Arg(0), false)
+					},
+				},
+			},
+		},
+		{
+			Name:  "backup",
+			Short: "立即备份数据库到备份目录",
+			Run: func(env *Env, fs *flag.FlagSet) error {
+				return createBackup(env)
+			},
+		},
+		{
+			Name:  "export",
+			Short: "导出配置包(JSON)，与面板的配置导出格式相同",
+			Flags: func(fs *flag.FlagSet) {
+				fs.StringVar(&passphrase, "passphrase", "", "加密口令，留空则不导出密码等敏感字段")
+				fs.StringVar(&output, "output", "", "输出文件，留空则输出到标准输出")
+			},
+			Run: func(env *Env, fs *flag.FlagSet) error {
+				return exportBundle(env, passphrase, output)
+			},
+		},
+		agentCommand(),
+	}
+}
+
+// resetPassword 重置用户密码，用于找回丢失的管理员密码
+func resetPassword(env *Env, username, password string) error {
+	db, err := env.DB()
+	if err != nil {
+		return err
+	}
+
+	var user database.User
+	result := db.Where("username = ?", username).Limit(1).Find(&user)
+	if result.Error != nil {
+		return fmt.Errorf("查询用户失败: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		var names []string
+		db.Model(&database.User{}).Pluck("username", &names)
+		return fmt.Errorf("用户 %q 不存在，现有用户: %s", username, strings.Join(names, ", "))
+	}
+
+	generated := password == ""
+	if generated {
+		buf := make([]byte, 12)
+		if _, err := rand.Read(buf); err != nil {
+			return fmt.Errorf("生成随机密码失败: %v", err)
+		}
+		password = base64.RawURLEncoding.EncodeToString(buf)
+	}
+
+	if err := db.Model(&user).Update("password", password).Error; err != nil {
+		return fmt.Errorf("更新密码失败: %v", err)
+	}
+	services.NewAuditService(db).Record(0, "password_reset", cliOperator, "success", username)
+
+	if generated {
+		fmt.Fprintf(env.Stdout, "用户 %s 的新密码: %s\n", username, password)
+	} else {
+		fmt.Fprintf(env.Stdout, "用户 %s 的密码已重置\n", username)
+	}
+	return nil
+}
+
+// listServers 以表格形式输出全部服务器
+func listServers(env *Env) error {
+	db, err := env.DB()
+	if err != nil {
+		return err
+	}
+	servers, err := services.NewL2TPService(db, nil, services.NewSSHService()).GetServers()
+	if err != nil {
+		return fmt.Errorf("查询服务器失败: %v", err)
+	}
+
+	w := tabwriter.NewWriter(env.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\t名称\t地址\t端口\t状态\t到期")
+	for _, server := range servers {
+		status := server.Status
+		if server.IsExpired {
+			status += "(已过期)"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\t%s\n", server.ID, server.Name, server.Host, server.L2TPPort,
+			status, server.ExpireDate.Local().Format("2006-01-02"))
+	}
+	return w.Flush()
+}
+
+// findServer 按ID或名称查找服务器
+func findServer(db *gorm.DB, ref string) (*database.L2TPServer, error) {
+	var server database.L2TPServer
+	query := db.Where("name = ?", ref)
+	if id, err := strconv.ParseUint(ref, 10, 32); err == nil {
+		query = db.Where("id = ?", id)
+	}
+	result := query.Limit(1).Find(&server)
+	if result.Error != nil {
+		return nil, fmt.Errorf("查询服务器失败: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("服务器 %q 不存在", ref)
+	}
+	return &server, nil
+}
+
+// serverAction 启动或停止服务器并等待完成。SSH操作在本进程内执行，运行中的面板由协调器同步转发器
+func serverAction(env *Env, ref string, start bool) error {
+	db, err := env.DB()
+	if err != nil {
+		return err
+	}
+	server, err := findServer(db, ref)
+	if err != nil {
+		return err
+	}
+
+	action, status, pending, verb := "stop", "stopped", "stopping", "停止"
+	if start {
+		action, status, pending, verb = "start", "running", "starting", "启动"
+	}
+	if server.Status == status {
+		fmt.Fprintf(env.Stdout, "服务器 %s 已处于%s状态\n", server.Name, status)
+		return nil
+	}
+
+	l2tpService := services.NewL2TPService(db, nil, services.NewSSHService())
+	auditService := services.NewAuditService(db)
+	ctx := logger.WithRequestID(context.Background(), "cli-"+logger.NewRequestID())
+	if start {
+		err = l2tpService.StartServer(ctx, server.ID)
+	} else {
+		err = l2tpService.StopServer(ctx, server.ID)
+	}
+	if err != nil {
+		auditService.Record(server.ID, action, cliOperator, "failed", err.Error())
+		return fmt.Errorf("%s失败: %v", verb, err)
+	}
+	// 与面板操作一致，同时更新期望状态，避免协调器反向收敛
+	l2tpService.SetDesiredState(server.ID, status)
+
+	// 异步任务在本进程中执行，必须等待其完成后再退出
+	fmt.Fprintf(env.Stdout, "服务器 %s 正在%s...\n", server.Name, verb)
+	deadline := time.Now().Add(serverActionTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(time.Second)
+		var current database.L2TPServer
+		if err := db.Select("status").First(&current, server.ID).Error; err != nil {
+			return fmt.Errorf("查询服务器状态失败: %v", err)
+		}
+		switch current.Status {
+		case pending:
+			continue
+		case status:
+			auditService.Record(server.ID, action, cliOperator, "success", "命令行")
+			fmt.Fprintf(env.Stdout, "服务器 %s 已%s\n", server.Name, verb)
+			return nil
+		default:
+			auditService.Record(server.ID, action, cliOperator, "failed", "状态: "+current.Status)
+			return fmt.Errorf("%s失败，当前状态: %s，详情见日志", verb, current.Status)
+		}
+	}
+	return fmt.Errorf("等待%s超时", verb)
+}
+
+// createBackup 立即创建数据库备份
+func createBackup(env *Env) error {
+	cfg, err := env.Config()
+	if err != nil {
+		return err
+	}
+	db, err := env.DB()
+	if err != nil {
+		return err
+	}
+	backupService := services.NewBackupService(db, cfg.BackupDir)
+	name, err := backupService.CreateBackup()
+	if err != nil {
+		return fmt.Errorf("备份失败: %v", err)
+	}
+	services.NewAuditService(db).Record(0, "backup_create", cliOperator, "success", name)
+	fmt.Fprintln(env.Stdout, filepath.Join(backupService.Dir(), name))
+	return nil
+}
+
+// exportBundle 导出配置包
+func exportBundle(env *Env, passphrase, output string) error {
+	cfg, err := env.Config()
+	if err != nil {
+		return err
+	}
+	db, err := env.DB()
+	if err != nil {
+		return err
+	}
+
+	l2tpService := services.NewL2TPService(db, nil, services.NewSSHService())
+	routingService := services.NewRoutingService(nil)
+	backupService := services.NewBackupService(db, cfg.BackupDir)
+	auditService := services.NewAuditService(db)
+	settingsService := services.NewSettingsService(db, cfg.Settings)
+
+	// 设置项由各功能模块注册，与面板一致地创建这些模块，导出的设置才完整
+	notificationService := services.NewNotificationService(settingsService)
+	services.NewTelegramService(db, settingsService, l2tpService, routingService, auditService, cfg.TelegramAPIURL)
+	services.NewEmailService(settingsService)
+	services.NewTrafficReporter(db, settingsService, notificationService)
+	services.NewAlertService(db, settingsService, notificationService)
+
+	bundle, err := services.NewBundleService(db, l2tpService, routingService, backupService, settingsService).Export(passphrase)
+	if err != nil {
+		return fmt.Errorf("导出失败: %v", err)
+	}
+	data, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return fmt.Errorf("导出失败: %v", err)
+	}
+	data = append(data, '\n')
+
+	if output == "" {
+		_, err = env.Stdout.Write(data)
+	} else if err = os.WriteFile(output, data, 0600); err == nil {
+		fmt.Fprintf(os.Stderr, "已导出 %d 个服务器到 %s\n", len(bundle.Servers), output)
+	}
+	if err != nil {
+		return fmt.Errorf("写入导出文件失败: %v", err)
+	}
+	auditService.Record(0, "config_export", cliOperator, "success",
+		fmt.Sprintf("导出 %d 个服务器，加密: %t", len(bundle.Servers), bundle.Encryption != nil))
+	return nil
+}
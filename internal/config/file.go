@@ -0,0 +1,44 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// readFile 按扩展名解析YAML(.yaml/.yml)或TOML(.toml)配置文件
+func readFile(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %v", err)
+	}
+
+	values := make(map[string]interface{})
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		if len(bytes.TrimSpace(data)) == 0 {
+			return values, nil
+		}
+		if err := yaml.Unmarshal(data, &values); err != nil {
+			return nil, fmt.Errorf("%s: YAML格式错误: %v", path, err)
+		}
+	case ".toml":
+		if err := toml.Unmarshal(data, &values); err != nil {
+			var decodeErr *toml.DecodeError
+			if errors.As(err, &decodeErr) {
+				row, col := decodeErr.Position()
+				return nil, fmt.Errorf("%s:%d:%d: TOML格式错误: %v", path, row, col, err)
+			}
+			return nil, fmt.Errorf("%s: TOML格式错误: %v", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("不支持的配置文件格式 %q，请使用 .yaml/.yml 或 .toml", ext)
+	}
+	return values, nil
+}
@@ -1,57 +1,472 @@
 package database
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
 	"os"
 	"time"
 
+	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"github.com/glebarez/sqlite"
 )
 
+// ErrSQLiteOnly 只有SQLite后端支持的操作(文件备份与恢复)
+var ErrSQLiteOnly = errors.New("Postgres后端不支持该操作，请使用pg_dump/pg_restore备份和恢复")
+
 // L2TPServer L2TP落地机模型
 type L2TPServer struct {
 	ID          uint      `gorm:"primaryKey" json:"id"`
-	Name        string    `gorm:"not null" json:"name"`                    // 备注名称
+	ExternalID  string    `gorm:"column:external_id;size:128;uniqueIndex" json:"external_id"` // 稳定的外部ID，创建后不变，供IaC工具引用
+	Name        string    `gorm:"not null;index" json:"name"`              // 备注名称
+	Type        string    `gorm:"column:type;size:16;default:'l2tp';index" json:"type"` // 服务器类型(l2tp/wireguard/openvpn/ikev2)，创建后不变
 	Host        string    `gorm:"not null" json:"host"`                    // 落地机地址
-	Port        int       `gorm:"default:22" json:"port"`                  // SSH端口
+	Port        int       `gorm:"default:22" json:"port" binding:"omitempty,min=1,max=65535"`                  // SSH端口
 	Username    string    `gorm:"not null" json:"username"`                // SSH用户名
-	Password    string    `gorm:"not null" json:"password"`                // SSH密码
-	L2TPPort    int       `gorm:"column:l2tp_port;not null;unique" json:"l2tp_port"`        // 中转机监听端口
+	Password    string    `gorm:"not null" json:"password"`                // SSH密码，为空表示使用面板SSH密钥
+	L2TPPort    int       `gorm:"column:l2tp_port;not null;unique" json:"l2tp_port" binding:"gte=0,lte=65535"`        // 中转机监听端口
 	PSK         string    `gorm:"not null" json:"psk"`                     // 预共享密钥
 	Users       string    `gorm:"type:text" json:"users"`                  // 用户配置(JSON格式)
-	Status      string    `gorm:"default:'stopped'" json:"status"`         // 服务状态
-	ExpireDate  time.Time `gorm:"column:expire_date" json:"expire_date"`   // 到期时间
+	Status      string    `gorm:"default:'stopped';index" json:"status"`   // 服务状态
+	DesiredState string   `gorm:"column:desired_state" json:"desired_state"` // 期望状态(running/stopped)，由协调器收敛
+	InterruptedOperation string `gorm:"column:interrupted_operation" json:"-"` // 因面板关闭而中断的操作(start/stop/restart)，面板启动后恢复执行
+	ExpireDate  time.Time `gorm:"column:expire_date;index" json:"expire_date"` // 到期时间
+	EnableOpenVPN        bool   `gorm:"column:enable_openvpn" json:"enable_openvpn"`                 // 启用OpenVPN协议
+	OpenVPNRelayPort     int    `gorm:"column:openvpn_relay_port" json:"openvpn_relay_port" binding:"gte=0,lte=65535"`         // OpenVPN中转监听端口(UDP)
+	EnableSSTP           bool   `gorm:"column:enable_sstp" json:"enable_sstp"`                       // 启用SSTP协议
+	SSTPRelayPort        int    `gorm:"column:sstp_relay_port" json:"sstp_relay_port" binding:"gte=0,lte=65535"`               // SSTP中转监听端口(TCP)
+	RestartSchedule      string `gorm:"column:restart_schedule" json:"restart_schedule"`              // 定时重启计划(cron表达式)
+	RestartJitter        int    `gorm:"column:restart_jitter;default:0" json:"restart_jitter" binding:"gte=0"`        // 定时重启随机延迟上限(秒)
+	RestartSkipIfClients bool   `gorm:"column:restart_skip_if_clients" json:"restart_skip_if_clients"` // 有客户端连接时跳过定时重启
+	RelayNodeID          uint   `gorm:"column:relay_node_id;default:0;index" json:"relay_node_id"`   // 负责转发的中转节点，0表示由面板本机转发
+	ChainNodes           string `gorm:"column:chain_nodes" json:"chain_nodes"`                       // 入口之后依次经过的中转节点ID(逗号分隔)，为空表示入口直接转发到落地机
+	NextHop              string `gorm:"-" json:"-"`                                                  // 本机转发的下一跳中转节点地址(运行时)，为空表示落地机
+	GeoIPMode            string `gorm:"column:geoip_mode" json:"geoip_mode"`                         // 国家访问策略: 空(不限制)/allow(只允许列出的国家)/deny(拒绝列出的国家)
+	GeoIPCountries       string `gorm:"column:geoip_countries" json:"geoip_countries"`               // 访问策略的国家/地区代码(逗号分隔)，如 CN,HK
+	DDNSTokenHash        string `gorm:"column:ddns_token_hash;index" json:"-"`                  // 落地机上报IP所用令牌的SHA-256，为空表示未启用上报
+	ReportedIP           string `gorm:"column:reported_ip" json:"reported_ip,omitempty"`        // 落地机最近上报的IP，设置后转发目标使用该IP而非host
+	ReportedAt           *time.Time `gorm:"column:reported_at" json:"reported_at,omitempty"`        // 最近一次上报时间
+	ResolvedIP           string `gorm:"-" json:"-"`                                             // 转发目标的实际IP(运行时)：上报的IP或host域名的解析结果，为空表示直接使用host
+	WireGuardPrivateKey  string `gorm:"column:wireguard_private_key" json:"-"`                       // WireGuard服务端私钥
+	WireGuardPeers       string `gorm:"column:wireguard_peers;type:text" json:"-"`                   // WireGuard客户端(JSON格式)，按用户配置生成
+	OpenVPNProto         string `gorm:"column:openvpn_proto" json:"openvpn_proto,omitempty"`         // OpenVPN服务器的传输协议(udp/tcp)
+	PKI                  string `gorm:"column:pki;type:text" json:"-"`                               // 证书类服务器的CA、服务端和客户端证书(JSON格式)
+	IKEv2Auth            string `gorm:"column:ikev2_auth" json:"ikev2_auth,omitempty"`               // IKEv2客户端认证方式(eap/cert)
+	IKEv2Identity        string `gorm:"column:ikev2_identity" json:"ikev2_identity,omitempty"`       // IKEv2服务端标识，客户端连接的中转机域名或IP
+	IKEv2NATPort         int    `gorm:"column:ikev2_nat_port" json:"ikev2_nat_port,omitempty"`       // IKEv2 NAT穿越中转监听端口(UDP)
+	XrayCredentials      string `gorm:"column:xray_credentials;type:text" json:"-"`                  // Shadowsocks/VLESS服务端密钥和用户凭据(JSON格式)，按用户配置生成
+	RealityServerName    string `gorm:"column:reality_server_name" json:"reality_server_name,omitempty"` // VLESS服务器REALITY伪装的目标站点
+	SoftEtherHub         string `gorm:"column:softether_hub" json:"softether_hub,omitempty"`         // L2TP服务器的SoftEther虚拟Hub名称，为空表示DEFAULT
+	SecureNATDisabled    bool   `gorm:"column:securenat_disabled" json:"securenat_disabled"`          // 关闭L2TP服务器的SecureNAT(虚拟NAT和DHCP)
+	SecureNATAddress     string `gorm:"column:securenat_address" json:"securenat_address,omitempty"` // SecureNAT虚拟主机地址(CIDR)，如192.168.30.1/24，为空使用SoftEther默认值
+	DHCPStart            string `gorm:"column:dhcp_start" json:"dhcp_start,omitempty"`               // SecureNAT分配给客户端的地址范围起始
+	DHCPEnd              string `gorm:"column:dhcp_end" json:"dhcp_end,omitempty"`                   // SecureNAT分配给客户端的地址范围结束
+	ClientDNS            string `gorm:"column:client_dns" json:"client_dns,omitempty"`               // 推送给客户端的DNS服务器(逗号分隔)，为空使用默认值
+	DNSDomains           string `gorm:"column:dns_domains" json:"dns_domains,omitempty"`             // 分流DNS域名(逗号分隔)，设置后客户端只将这些域名的查询发送到client_dns
+	NATKeepalive         int    `gorm:"column:nat_keepalive;default:0" json:"nat_keepalive,omitempty"` // NAT保活间隔(秒)，0使用协议默认值
+	KnockEnabled         bool   `gorm:"column:knock_enabled;default:false" json:"knock_enabled"`     // 启用端口敲门，中转端口只接受敲门通过的来源地址
+	KnockSecret          string `gorm:"column:knock_secret" json:"knock_secret,omitempty"`           // 敲门包的HMAC密钥，填写auto时重新生成
+	KnockTTL             int    `gorm:"column:knock_ttl;default:0" json:"knock_ttl,omitempty"`       // 敲门通过的来源地址的有效期(秒)，0使用默认值
+	Obfuscation          string `gorm:"column:obfuscation" json:"obfuscation,omitempty"`             // 流量混淆方式: mkcp/ws，为空表示不混淆
+	ObfuscationPort      int    `gorm:"column:obfuscation_port;default:0" json:"obfuscation_port,omitempty"` // 混淆入口的中转端口
+	ObfuscationKey       string `gorm:"column:obfuscation_key" json:"obfuscation_key,omitempty"`     // 混淆入口的VLESS用户ID，填写auto时重新生成
+	BillingAnchorDay     int    `gorm:"column:billing_anchor_day;default:0" json:"billing_anchor_day,omitempty"` // 计费周期起始日(1-31)，0表示自然月
+	BillingTimezone      string `gorm:"column:billing_timezone" json:"billing_timezone,omitempty"`   // 计费周期使用的时区(IANA名称)，为空使用面板所在时区
+	TenantID             uint   `gorm:"column:tenant_id;default:0;index" json:"tenant_id"`          // 所属租户，0表示属于平台
 	IsExpired   bool      `gorm:"-" json:"is_expired"`                     // 是否已过期(运行时计算)
 	CreatedAt   time.Time `gorm:"column:created_at" json:"created_at"`
 	UpdatedAt   time.Time `gorm:"column:updated_at" json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"column:deleted_at;index" json:"deleted_at,omitempty"` // 软删除时间(回收站)
 }
 
 // TrafficLog 流量日志
 type TrafficLog struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
-	ClientIP  string    `gorm:"column:client_ip;not null" json:"client_ip"`
-	ServerID  uint      `gorm:"column:server_id;not null" json:"server_id"`
+	ClientIP  string    `gorm:"column:client_ip;not null;index" json:"client_ip"`
+	ServerID  uint      `gorm:"column:server_id;not null;index:idx_traffic_server_time,priority:1" json:"server_id"`
 	SrcPort   int       `gorm:"column:src_port" json:"src_port"`
 	DstPort   int       `gorm:"column:dst_port" json:"dst_port"`
 	Bytes     int64     `json:"bytes"`
+	Country   string    `gorm:"column:country;index" json:"country"` // 客户端所属国家/地区代码，未加载GeoIP数据库时为空
+	CreatedAt time.Time `gorm:"column:created_at;index:idx_traffic_server_time,priority:2" json:"created_at"`
+}
+
+// TrafficSample 按小时/天聚合的流量样本
+type TrafficSample struct {
+	ID          uint      `gorm:"primaryKey" json:"-"`
+	ServerID    uint      `gorm:"column:server_id;not null;uniqueIndex:idx_sample_bucket,priority:1" json:"server_id"`
+	Granularity string    `gorm:"not null;uniqueIndex:idx_sample_bucket,priority:2" json:"granularity"` // hour/day
+	Bucket      time.Time `gorm:"not null;uniqueIndex:idx_sample_bucket,priority:3" json:"bucket"`      // 时间桶起点
+	Bytes       int64     `json:"bytes"`
+}
+
+// ServerRevision 服务器配置修订记录
+type ServerRevision struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ServerID  uint      `gorm:"column:server_id;not null;index" json:"server_id"`
+	Version   int       `gorm:"not null" json:"version"`                  // 修订版本号(按服务器递增)
+	Action    string    `gorm:"not null" json:"action"`                   // create/update/rollback
+	Username  string    `json:"username"`                                 // 操作人
+	Snapshot  string    `gorm:"type:text" json:"-"`                       // 修订后的完整配置(JSON)
+	Diff      string    `gorm:"type:text" json:"diff"`                    // 变更字段(JSON)
+	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+}
+
+// AuditLog 审计日志
+type AuditLog struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ServerID  uint      `gorm:"column:server_id;index" json:"server_id,omitempty"` // 关联服务器(可为空)
+	Action    string    `gorm:"not null;index" json:"action"`                      // 操作类型
+	Username  string    `json:"username"`                                          // 操作人(系统任务为system)
+	ClientIP  string    `gorm:"column:client_ip" json:"client_ip,omitempty"`       // 操作来源IP(面板操作)
+	Result    string    `json:"result"`                                            // success/failed/skipped
+	Detail    string    `gorm:"type:text" json:"detail"`
+	CreatedAt time.Time `gorm:"column:created_at;index" json:"created_at"`
+}
+
+// BackupPolicy 自动备份策略(单行配置)
+type BackupPolicy struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	Enabled        bool       `gorm:"default:false" json:"enabled"`
+	Schedule       string     `gorm:"default:'0 3 * * *'" json:"schedule"` // cron表达式，默认每天03:00
+	Retention      int        `gorm:"default:7" json:"retention"`          // 保留的自动备份数量
+	UploadType     string     `json:"upload_type"`                         // 上传目标: 空/s3/sftp/webdav
+	UploadEndpoint string     `json:"upload_endpoint"`                     // S3/WebDAV地址或SFTP主机(host:port)
+	UploadBucket   string     `json:"upload_bucket"`                       // S3存储桶
+	UploadRegion   string     `json:"upload_region"`                       // S3区域
+	UploadPath     string     `json:"upload_path"`                         // 远程目录或对象前缀
+	UploadUsername string     `json:"upload_username"`                     // 用户名或S3 Access Key
+	UploadPassword string     `json:"upload_password"`                     // 密码或S3 Secret Key
+	UploadHostKey  string     `gorm:"type:text" json:"upload_host_key"`    // SFTP主机公钥(ssh-keyscan的输出)或SHA256指纹，必填
+	LastRunAt      *time.Time `json:"last_run_at"`
+	LastResult     string     `gorm:"type:text" json:"last_result"`
+	UpdatedAt      time.Time  `gorm:"column:updated_at" json:"updated_at"`
+}
+
+// Setting 运行时可修改的应用设置(键值对)
+type Setting struct {
+	Key       string    `gorm:"primaryKey" json:"key"`
+	Value     string    `gorm:"type:text" json:"value"`
+	UpdatedAt time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+// Webhook 外发事件回调配置
+type Webhook struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"not null" json:"name" binding:"required"`
+	URL       string    `gorm:"not null" json:"url" binding:"required,url"`
+	Secret    string    `json:"secret"`                      // HMAC签名密钥，为空表示不签名
+	Events    string    `gorm:"type:text" json:"events"`     // 订阅的事件类型，逗号分隔，为空表示全部
+	Enabled   bool      `gorm:"default:true" json:"enabled"`
+	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+// WebhookDelivery Webhook投递记录(每次尝试一条)
+type WebhookDelivery struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	WebhookID  uint      `gorm:"column:webhook_id;not null;index:idx_delivery_webhook_time,priority:1" json:"webhook_id"`
+	DeliveryID string    `gorm:"column:delivery_id;index" json:"delivery_id"` // 同一事件的多次重试共用
+	EventType  string    `gorm:"column:event_type" json:"event_type"`
+	Payload    string    `gorm:"type:text" json:"payload"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `gorm:"column:status_code" json:"status_code"`
+	Success    bool      `json:"success"`
+	Error      string    `gorm:"type:text" json:"error,omitempty"`
+	DurationMs int64     `gorm:"column:duration_ms" json:"duration_ms"`
+	CreatedAt  time.Time `gorm:"column:created_at;index:idx_delivery_webhook_time,priority:2" json:"created_at"`
+}
+
+// AlertRule 告警规则
+type AlertRule struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	Name          string     `gorm:"not null" json:"name" binding:"required"`
+	Metric        string     `gorm:"not null" json:"metric" binding:"required"`                             // status_error/traffic_daily/latency/expiry/traffic_anomaly
+	Threshold     float64    `json:"threshold" binding:"gte=0"`                                          // 流量(GB)/延迟(ms)/剩余天数/标准差倍数
+	Duration      int        `gorm:"default:0" json:"duration" binding:"gte=0"`                          // 条件持续多少秒后触发
+	ServerID      uint       `gorm:"column:server_id;default:0" json:"server_id"`        // 0表示全部服务器
+	Channels      string     `json:"channels"`                                           // 通知渠道，逗号分隔，为空按事件路由分发
+	Enabled       bool       `gorm:"default:true" json:"enabled"`
+	SilencedUntil *time.Time `gorm:"column:silenced_until" json:"silenced_until,omitempty"` // 静默截止时间，期间只记录不通知
+	CreatedAt     time.Time  `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt     time.Time  `gorm:"column:updated_at" json:"updated_at"`
+}
+
+// AlertRecord 告警历史，触发时创建，恢复时写入恢复时间
+type AlertRecord struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	RuleID     uint       `gorm:"column:rule_id;not null;index" json:"rule_id"`
+	RuleName   string     `gorm:"column:rule_name" json:"rule_name"`
+	ServerID   uint       `gorm:"column:server_id;index" json:"server_id"`
+	ServerName string     `gorm:"column:server_name" json:"server_name"`
+	State      string     `gorm:"not null;index" json:"state"` // firing/resolved
+	Value      float64    `json:"value"`                       // 触发时的指标值
+	Message    string     `gorm:"type:text" json:"message"`
+	Silenced   bool       `json:"silenced"` // 触发时规则处于静默期，未发送通知
+	FiredAt    time.Time  `gorm:"column:fired_at;index" json:"fired_at"`
+	ResolvedAt *time.Time `gorm:"column:resolved_at" json:"resolved_at,omitempty"`
+}
+
+// LoginIP 用户登录过的来源IP，用于识别新IP登录
+type LoginIP struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"column:user_id;not null;uniqueIndex:idx_login_ip_user" json:"user_id"`
+	IP        string    `gorm:"column:ip;not null;uniqueIndex:idx_login_ip_user" json:"ip"`
+	FirstSeen time.Time `gorm:"column:first_seen" json:"first_seen"`
+	LastSeen  time.Time `gorm:"column:last_seen" json:"last_seen"`
+}
+
+// RelayNode 中转节点，运行 l2tp-manager agent 的机器，监听指定给它的服务器的转发端口
+type RelayNode struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	Name          string     `gorm:"not null;uniqueIndex" json:"name"`
+	Description   string     `gorm:"type:text" json:"description"`
+	TokenHash     string     `gorm:"column:token_hash;index" json:"-"`                  // 注册令牌的SHA-256，为空表示只能使用全局AGENT_TOKEN连接
+	MaxServers    int        `gorm:"column:max_servers;default:0" json:"max_servers"`      // 最多承载的服务器数，0表示不限
+	BandwidthMbps int        `gorm:"column:bandwidth_mbps;default:0" json:"bandwidth_mbps"` // 出口带宽(Mbps)，供选择节点参考
+	Address       string     `gorm:"column:address" json:"address"`                        // 对外地址，客户端和链式转发的上一跳连接该地址，为空时使用节点连接面板的地址
+	Version       string     `json:"version"`                                                // 以下为节点上报的信息
+	Hostname      string     `json:"hostname"`
+	CPUs          int        `gorm:"column:cpus" json:"cpus"`
+	RemoteAddr    string     `gorm:"column:remote_addr" json:"remote_addr"`
+	LastSeenAt    *time.Time `gorm:"column:last_seen_at" json:"last_seen_at"` // 最近一次心跳
+	CreatedAt     time.Time  `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt     time.Time  `gorm:"column:updated_at" json:"updated_at"`
+}
+
+// ProxyInbound 中转机上的代理入站(SOCKS5/HTTP)，经WireGuard落地机的隧道出口
+type ProxyInbound struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	Name         string    `gorm:"not null;uniqueIndex" json:"name"`
+	Protocol     string    `gorm:"not null" json:"protocol"`                                 // socks/http
+	ListenPort   int       `gorm:"column:listen_port;not null;uniqueIndex" json:"listen_port"` // 中转机监听端口(TCP，SOCKS5同时监听UDP)
+	ExitServerID uint      `gorm:"column:exit_server_id;not null;index" json:"exit_server_id"` // 出口落地机，必须是WireGuard服务器
+	ExitPeer     string    `gorm:"column:exit_peer;not null" json:"exit_peer"`                 // 中转机连接落地机使用的WireGuard用户
+	Accounts     string    `gorm:"type:text" json:"accounts"`                                  // 代理账号(JSON格式，与服务器用户配置相同)
+	Enabled      bool      `json:"enabled"`
+	CreatedAt    time.Time `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt    time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+// ProxyTraffic 代理账号的累计流量
+type ProxyTraffic struct {
+	ID           uint       `gorm:"primaryKey" json:"-"`
+	ProxyID      uint       `gorm:"column:proxy_id;not null;uniqueIndex:idx_proxy_traffic_account,priority:1" json:"proxy_id"`
+	Username     string     `gorm:"not null;uniqueIndex:idx_proxy_traffic_account,priority:2" json:"username"`
+	Uplink       int64      `json:"uplink"`   // 客户端发出的字节数
+	Downlink     int64      `json:"downlink"` // 返回客户端的字节数
+	LastActiveAt *time.Time `gorm:"column:last_active_at" json:"last_active_at"`
+}
+
+// IdempotencyKey 创建和操作请求的幂等键，同一幂等键的重试返回首次创建的资源或首次的响应
+type IdempotencyKey struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	Scope          string    `gorm:"size:64;not null;uniqueIndex:idx_idempotency_owner_key,priority:1" json:"scope"`            // 请求类型，如server_create、action
+	Owner          string    `gorm:"size:64;not null;default:'';uniqueIndex:idx_idempotency_owner_key,priority:2" json:"owner"` // 使用幂等键的租户和用户，不同用户的幂等键互不影响
+	Key            string    `gorm:"column:idempotency_key;size:255;not null;uniqueIndex:idx_idempotency_owner_key,priority:3" json:"key"`
+	RequestHash    string    `gorm:"column:request_hash;not null" json:"request_hash"` // 请求内容的SHA-256，同一幂等键不能用于不同的请求
+	ResourceID     uint      `gorm:"column:resource_id" json:"resource_id"`
+	ResponseStatus int       `gorm:"column:response_status" json:"response_status"` // 操作请求首次响应的状态码，0表示仍在处理
+	ResponseBody   []byte    `gorm:"column:response_body" json:"-"`                 // 操作请求首次响应的内容
+	CreatedAt      time.Time `gorm:"column:created_at;index" json:"created_at"`
+}
+
+// BootstrapToken 落地机自助注册令牌，落地机执行一键命令后登记为待审核服务器
+type BootstrapToken struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"not null" json:"name"`                          // 备注
+	TokenHash string    `gorm:"column:token_hash;not null;uniqueIndex" json:"-"` // 令牌的SHA-256
+	MaxUses   int       `gorm:"column:max_uses;default:1" json:"max_uses"`     // 最多可注册的落地机数，0表示不限
+	Uses      int       `gorm:"default:0" json:"uses"`
+	ExpiresAt time.Time `gorm:"column:expires_at;index" json:"expires_at"`
+	CreatedBy string    `gorm:"column:created_by" json:"created_by"`
 	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
 }
 
+// PendingServer 通过注册脚本登记、等待管理员审核的落地机
+type PendingServer struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	TokenID      uint      `gorm:"column:token_id;index" json:"token_id"`
+	Hostname     string    `json:"hostname"`
+	Host         string    `gorm:"not null;index" json:"host"` // 落地机上报或面板看到的地址
+	SSHPort      int       `gorm:"column:ssh_port" json:"ssh_port"`
+	Username     string    `json:"username"`
+	Password     string    `json:"-"`                                    // 落地机提供的SSH密码，为空表示使用面板SSH密钥
+	KeyInstalled bool      `gorm:"column:key_installed" json:"key_installed"` // 已安装面板SSH公钥
+	OS           string    `gorm:"column:os" json:"os"`
+	Arch         string    `json:"arch"`
+	Docker       bool      `json:"docker"` // 已安装Docker
+	RemoteAddr   string    `gorm:"column:remote_addr" json:"remote_addr"`
+	Status       string    `gorm:"default:'pending';index" json:"status"` // pending/approved/rejected
+	ServerID     uint      `gorm:"column:server_id" json:"server_id,omitempty"` // 审核通过后创建的服务器
+	CreatedAt    time.Time `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt    time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+// PanelKey 面板的SSH密钥，注册脚本把公钥安装到落地机后面板可免密码连接
+type PanelKey struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	PrivateKey string    `gorm:"column:private_key;type:text;not null" json:"-"` // OpenSSH格式私钥
+	PublicKey  string    `gorm:"column:public_key;type:text;not null" json:"public_key"`
+	CreatedAt  time.Time `gorm:"column:created_at" json:"created_at"`
+}
+
+// ServerUsage 服务器按月累计的在线时长，由用量采集定期按服务器状态采样
+type ServerUsage struct {
+	ID             uint   `gorm:"primaryKey" json:"-"`
+	ServerID       uint   `gorm:"column:server_id;not null;uniqueIndex:idx_server_usage_period,priority:1" json:"server_id"`
+	Period         string `gorm:"not null;uniqueIndex:idx_server_usage_period,priority:2" json:"period"` // 月份，如2026-09
+	TrackedSeconds int64  `json:"tracked_seconds"`                                                      // 采样覆盖的时长
+	RunningSeconds int64  `json:"running_seconds"`                                                      // 其中处于运行状态的时长
+}
+
+// AccountUsage L2TP账号按月累计的流量，由落地机SoftEther用户传输计数的增量得到
+type AccountUsage struct {
+	ID            uint       `gorm:"primaryKey" json:"-"`
+	ServerID      uint       `gorm:"column:server_id;not null;uniqueIndex:idx_account_usage,priority:1" json:"server_id"`
+	Username      string     `gorm:"not null;uniqueIndex:idx_account_usage,priority:2" json:"username"`
+	Period        string     `gorm:"not null;uniqueIndex:idx_account_usage,priority:3" json:"period"`
+	Bytes         int64      `json:"bytes"`
+	OutgoingBytes int64      `gorm:"column:outgoing_bytes" json:"outgoing_bytes"` // SoftEther统计的Outgoing方向
+	IncomingBytes int64      `gorm:"column:incoming_bytes" json:"incoming_bytes"` // SoftEther统计的Incoming方向
+	LastCounter   int64      `gorm:"column:last_counter" json:"-"`                // 最近一次读取的累计计数(双向合计)
+	LastOutgoing  int64      `gorm:"column:last_outgoing" json:"-"`
+	LastIncoming  int64      `gorm:"column:last_incoming" json:"-"`
+	Suspended     bool       `gorm:"not null;default:false" json:"suspended"` // 因超出流量配额在落地机上被停用，下一期开始时恢复
+	SuspendedAt   *time.Time `gorm:"column:suspended_at" json:"suspended_at,omitempty"`
+	QuotaOverride bool       `gorm:"column:quota_override;not null;default:false" json:"quota_override"` // 管理员手动恢复，本期不再因超额停用
+	UpdatedAt     time.Time  `gorm:"column:updated_at" json:"updated_at"`
+}
+
+// UsageReport 月度用量报告的一行，Account为空的行是服务器合计
+type UsageReport struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	Period         string    `gorm:"not null;index" json:"period"`
+	ServerID       uint      `gorm:"column:server_id;not null" json:"server_id"`
+	ServerName     string    `json:"server_name"`
+	Account        string    `json:"account"`
+	PeriodStart    time.Time `gorm:"column:period_start" json:"period_start"` // 服务器计费周期的起止时间
+	PeriodEnd      time.Time `gorm:"column:period_end" json:"period_end"`
+	Bytes          int64     `json:"bytes"`
+	RunningSeconds int64     `json:"running_seconds"`
+	UptimePercent  float64   `json:"uptime_percent"` // 在线时长占采样时长的百分比，仅服务器合计行
+	GeneratedAt    time.Time `gorm:"column:generated_at" json:"generated_at"`
+}
+
+// PortalToken 客户门户令牌，持有者可只读查看单台服务器的状态、到期时间、流量和连接方式
+type PortalToken struct {
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	ServerID        uint       `gorm:"column:server_id;not null;index" json:"server_id"`
+	Name            string     `json:"name"`                                           // 备注，如客户名称
+	TokenHash       string     `gorm:"column:token_hash;not null;uniqueIndex" json:"-"` // 令牌的SHA-256
+	ShowCredentials bool       `gorm:"column:show_credentials" json:"show_credentials"` // 门户显示PSK、账号密码和客户端配置
+	Endpoint        string     `json:"endpoint"`                                       // 门户显示的连接地址，为空时与客户端配置下载相同
+	ExpiresAt       *time.Time `gorm:"column:expires_at" json:"expires_at"`            // 为空表示不过期
+	LastUsedAt      *time.Time `gorm:"column:last_used_at" json:"last_used_at"`
+	CreatedBy       string     `json:"created_by"`
+	CreatedAt       time.Time  `gorm:"column:created_at" json:"created_at"`
+}
+
+// Tenant 租户，隔离一组用户和服务器，供一个面板服务多个客户。TenantID为0的用户是平台超级管理员
+type Tenant struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	Name           string    `gorm:"not null;uniqueIndex" json:"name"`
+	MaxServers     int       `gorm:"column:max_servers" json:"max_servers"`            // 服务器数量上限，0表示不限
+	TrafficQuotaGB int64     `gorm:"column:traffic_quota_gb" json:"traffic_quota_gb"`  // 每月流量配额(GB)，0表示不限
+	Disabled       bool      `json:"disabled"`                                         // 停用后租户用户无法登录和访问
+	Note           string    `json:"note"`
+	CreatedAt      time.Time `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt      time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+// PortPool 中转端口池，分配给租户后池内端口只能由该租户的服务器使用，TenantID为0表示平台共享
+type PortPool struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"not null;uniqueIndex" json:"name"`
+	StartPort int       `gorm:"column:start_port" json:"start_port"`
+	EndPort   int       `gorm:"column:end_port" json:"end_port"`
+	TenantID  uint      `gorm:"column:tenant_id;index" json:"tenant_id"`
+	Note      string    `json:"note"`
+	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+// ServerDrift 落地机实际部署与面板配置的比对结果，每台服务器保留最近一次
+type ServerDrift struct {
+	ServerID  uint      `gorm:"primaryKey;autoIncrement:false" json:"server_id"`
+	Drifted   bool      `gorm:"index" json:"drifted"`
+	Items     string    `gorm:"type:text" json:"-"` // 不一致的项目(JSON格式)
+	Error     string    `json:"error,omitempty"`    // 检测失败的原因，如SSH连接失败
+	CheckedAt time.Time `gorm:"column:checked_at" json:"checked_at"`
+}
+
+// ServerImage 服务器落地机容器镜像的更新检查结果
+type ServerImage struct {
+	ServerID        uint      `gorm:"primaryKey;autoIncrement:false" json:"server_id"`
+	Image           string    `json:"image"`
+	CurrentDigest   string    `gorm:"column:current_digest" json:"current_digest"` // 运行中容器所用镜像的摘要
+	LatestDigest    string    `gorm:"column:latest_digest" json:"latest_digest"`   // 镜像仓库中该标签当前的摘要
+	UpdateAvailable bool      `gorm:"column:update_available;index" json:"update_available"`
+	Error           string    `json:"error,omitempty"`
+	CheckedAt       time.Time `gorm:"column:checked_at" json:"checked_at"`
+}
+
+// ServerStatusChange 服务器可用性变化记录，由健康检查和状态变更写入，用于计算可用率
+type ServerStatusChange struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ServerID  uint      `gorm:"column:server_id;not null;index:idx_status_change_server_time,priority:1" json:"server_id"`
+	State     string    `gorm:"not null" json:"state"` // up/down/stopped，stopped期间不计入可用率
+	Reason    string    `json:"reason,omitempty"`
+	ChangedAt time.Time `gorm:"column:changed_at;index:idx_status_change_server_time,priority:2" json:"changed_at"`
+}
+
+// SyntheticCheck 端到端拨测记录：经中转入口建立一次真实的L2TP会话
+type SyntheticCheck struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ServerID  uint      `gorm:"column:server_id;not null;index" json:"server_id"`
+	Endpoint  string    `json:"endpoint"` // 拨测连接的中转入口(地址:端口)
+	Success   bool      `json:"success"`
+	LatencyMs int64     `gorm:"column:latency_ms" json:"latency_ms"` // 从发起连接到PPP会话建立的耗时
+	Error     string    `gorm:"type:text" json:"error,omitempty"`
+	CreatedAt time.Time `gorm:"column:created_at;index" json:"created_at"`
+}
+
+// ServerOperation 服务器启动/停止/重启操作的记录，保存执行的SSH命令及其输出，用于排查失败原因
+type ServerOperation struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	JobID      string    `gorm:"column:job_id;size:64;not null;uniqueIndex" json:"job_id"`
+	ServerID   uint      `gorm:"column:server_id;not null;index" json:"server_id"`
+	Kind       string    `gorm:"not null" json:"kind"`   // start/stop/restart/auto_restart
+	Status     string    `gorm:"not null" json:"status"` // succeeded/failed
+	Step       string    `json:"step,omitempty"`         // 最近完成或失败的步骤
+	Error      string    `gorm:"type:text" json:"error,omitempty"`
+	Duration   float64   `json:"duration"`                           // 执行秒数
+	Transcript string    `gorm:"type:text" json:"-"`                 // 执行记录(JSON)
+	CreatedAt  time.Time `gorm:"column:created_at" json:"created_at"` // 任务创建时间
+	FinishedAt time.Time `gorm:"column:finished_at" json:"finished_at"`
+}
+
 // User 管理员用户
 type User struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
 	Username  string    `gorm:"unique;not null" json:"username"`
 	Password  string    `gorm:"not null" json:"-"`                // 不在JSON中返回密码
+	TenantID  uint      `gorm:"column:tenant_id;default:0;index" json:"tenant_id"` // 所属租户，0表示平台超级管理员
+	Language  string    `gorm:"column:language;size:16" json:"language"`          // 界面语言(zh/en)，为空表示按Accept-Language
 	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
 	UpdatedAt time.Time `gorm:"column:updated_at" json:"updated_at"`
 }
 
-// Initialize 初始化数据库连接和表结构
-func Initialize(databasePath string) (*gorm.DB, error) {
+// Initialize 初始化数据库连接和表结构，driver为sqlite时dsn是数据库文件路径，为postgres时是连接URL
+func Initialize(driver, dsn string) (*gorm.DB, error) {
+	dialector := sqlite.Open(dsn + "?_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=cache_size(-64000)&_pragma=foreign_keys(1)")
+	if driver == "postgres" {
+		dialector = postgres.Open(dsn)
+	}
 
-	dsn := databasePath + "?_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=cache_size(-64000)&_pragma=foreign_keys(1)"
-	
-	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+	db, err := gorm.Open(dialector, &gorm.Config{
 		// 启用事务模式
 		SkipDefaultTransaction: false,
 		// 启用预编译语句缓存
@@ -61,6 +476,11 @@ func Initialize(databasePath string) (*gorm.DB, error) {
 		return nil, err
 	}
 
+	// 记录语句执行耗时指标
+	if err := instrumentQueries(db); err != nil {
+		return nil, err
+	}
+
 	// 获取底层sql.DB来设置连接池
 	sqlDB, err := db.DB()
 	if err != nil {
@@ -72,23 +492,127 @@ func Initialize(databasePath string) (*gorm.DB, error) {
 	sqlDB.SetMaxOpenConns(100)
 	sqlDB.SetConnMaxLifetime(time.Hour)
 
+	// 为升级前的服务器生成外部ID，之后才能创建唯一索引
+	if err := migrateExternalIDs(db); err != nil {
+		return nil, err
+	}
+
 	// 自动迁移表结构
 	err = db.AutoMigrate(
 		&L2TPServer{},
 		&TrafficLog{},
+		&TrafficSample{},
 		&User{},
+		&ServerRevision{},
+		&AuditLog{},
+		&BackupPolicy{},
+		&Setting{},
+		&Webhook{},
+		&WebhookDelivery{},
+		&LoginIP{},
+		&AlertRule{},
+		&AlertRecord{},
+		&RelayNode{},
+		&IdempotencyKey{},
+		&ProxyInbound{},
+		&ProxyTraffic{},
+		&BootstrapToken{},
+		&PendingServer{},
+		&PanelKey{},
+		&Tenant{},
+		&PortPool{},
+		&ServerDrift{},
+		&ServerImage{},
+		&ServerStatusChange{},
+		&SyntheticCheck{},
+		&ServerUsage{},
+		&AccountUsage{},
+		&UsageReport{},
+		&PortalToken{},
+		&ServerOperation{},
 	)
 
 	if err != nil {
 		return nil, err
 	}
 
+	// 幂等键改为按租户和用户区分，删除只按幂等键唯一的旧索引
+	if db.Migrator().HasIndex(&IdempotencyKey{}, "idx_idempotency_scope_key") {
+		if err := db.Migrator().DropIndex(&IdempotencyKey{}, "idx_idempotency_scope_key"); err != nil {
+			return nil, err
+		}
+	}
+
+	// 为升级前的数据补全期望状态，保持原有运行状态不变
+	db.Model(&L2TPServer{}).Where("desired_state IS NULL OR desired_state = ''").
+		Update("desired_state", gorm.Expr("CASE WHEN status IN ('running', 'starting') THEN 'running' ELSE 'stopped' END"))
+
+	// 升级前的服务器均为L2TP类型
+	db.Model(&L2TPServer{}).Where("type IS NULL OR type = ''").Update("type", "l2tp")
+
+	// 按节点名称指定中转节点的旧字段迁移为中转节点记录
+	migrateRelayAgents(db)
+
 	// 创建默认管理员用户
 	createDefaultUser(db)
 
 	return db, nil
 }
 
+// migrateRelayAgents 为relay_agent列中的每个节点名称创建中转节点并改用relay_node_id，完成后删除旧列
+func migrateRelayAgents(db *gorm.DB) {
+	if !db.Migrator().HasColumn(&L2TPServer{}, "relay_agent") {
+		return
+	}
+
+	var names []string
+	db.Unscoped().Model(&L2TPServer{}).Where("relay_agent != ''").Distinct().Pluck("relay_agent", &names)
+	for _, name := range names {
+		node := RelayNode{Name: name}
+		if err := db.Where("name = ?", name).FirstOrCreate(&node).Error; err != nil {
+			slog.Warn("迁移中转节点失败", "name", name, "error", err)
+			return
+		}
+		db.Unscoped().Model(&L2TPServer{}).Where("relay_agent = ?", name).UpdateColumn("relay_node_id", node.ID)
+	}
+	// 模型中已无该字段，Migrator().DropColumn不会生效，直接执行DDL(需先删除该列的索引)
+	db.Exec("DROP INDEX IF EXISTS idx_l2_tp_servers_relay_agent")
+	if err := db.Exec("ALTER TABLE l2_tp_servers DROP COLUMN relay_agent").Error; err != nil {
+		slog.Warn("删除relay_agent列失败", "error", err)
+	}
+}
+
+// migrateExternalIDs 为已有服务器(包括回收站中的)添加并填充external_id列
+func migrateExternalIDs(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&L2TPServer{}) || migrator.HasColumn(&L2TPServer{}, "external_id") {
+		return nil
+	}
+	if err := migrator.AddColumn(&L2TPServer{}, "ExternalID"); err != nil {
+		return err
+	}
+
+	var ids []uint
+	if err := db.Unscoped().Model(&L2TPServer{}).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := db.Unscoped().Model(&L2TPServer{}).Where("id = ?", id).
+			UpdateColumn("external_id", NewExternalID()).Error; err != nil {
+			return err
+		}
+	}
+	slog.Info("已为现有服务器生成外部ID", "count", len(ids))
+	return nil
+}
+
+// NewExternalID 生成服务器外部ID
+func NewExternalID() string {
+	buf := make([]byte, 12)
+	rand.Read(buf)
+	return "srv_" + hex.EncodeToString(buf)
+}
+
 // createDefaultUser 创建默认管理员用户
 func createDefaultUser(db *gorm.DB) {
 	var count int64
@@ -121,26 +645,60 @@ func (l *L2TPServer) BeforeUpdate(tx *gorm.DB) error {
 	return nil
 }
 
-// BeforeCreate GORM v2 钩子函数
+// BeforeCreate GORM v2 钩子函数，未指定外部ID时自动生成
 func (l *L2TPServer) BeforeCreate(tx *gorm.DB) error {
 	l.IsExpired = time.Now().After(l.ExpireDate)
+	if l.ExternalID == "" {
+		l.ExternalID = NewExternalID()
+	}
 	return nil
 }
 
+// IsSQLite 是否为SQLite后端
+func IsSQLite(db *gorm.DB) bool {
+	return db.Dialector.Name() == "sqlite"
+}
+
+// DatabaseSize 返回数据库当前占用的字节数
+func DatabaseSize(db *gorm.DB) (int64, error) {
+	if !IsSQLite(db) {
+		var size int64
+		err := db.Raw("SELECT pg_database_size(current_database())").Scan(&size).Error
+		return size, err
+	}
+
+	var pageCount, pageSize int64
+	if err := db.Raw("PRAGMA page_count").Scan(&pageCount).Error; err != nil {
+		return 0, err
+	}
+	if err := db.Raw("PRAGMA page_size").Scan(&pageSize).Error; err != nil {
+		return 0, err
+	}
+	return pageCount * pageSize, nil
+}
+
+// Vacuum 压缩数据库，回收已删除数据占用的空间
+func Vacuum(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	_, err = sqlDB.Exec("VACUUM")
+	return err
+}
+
 // BackupDatabase 备份数据库
 func BackupDatabase(db *gorm.DB, backupPath string) error {
+	if !IsSQLite(db) {
+		return ErrSQLiteOnly
+	}
 	sqlDB, err := db.DB()
 	if err != nil {
 		return err
 	}
 	
 	// SQLite备份逻辑
-	backupSQL := "VACUUM INTO '" + backupPath + "'"
-	return sqlDB.QueryRow(backupSQL).Err()
+	// VACUUM INTO 需通过Exec执行，QueryRow不会真正执行语句
+	_, err = sqlDB.Exec("VACUUM INTO ?", backupPath)
+	return err
 }
-
-// RestoreDatabase 恢复数据库
-func RestoreDatabase(backupPath, targetPath string) error {
-	// 暂未实现
-	return nil
-} 
\ No newline at end of file
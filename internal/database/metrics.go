@@ -0,0 +1,60 @@
+package database
+
+import (
+	"time"
+
+	"l2tp-manager/internal/logger"
+	"l2tp-manager/internal/metrics"
+
+	"gorm.io/gorm"
+)
+
+// queryStartKey 记录语句开始时间的实例键
+const queryStartKey = "metrics:query_start"
+
+// instrumentQueries 注册GORM回调，记录各类语句的执行耗时
+func instrumentQueries(db *gorm.DB) error {
+	before := func(tx *gorm.DB) {
+		tx.InstanceSet(queryStartKey, time.Now())
+	}
+	after := func(operation string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			start, ok := tx.InstanceGet(queryStartKey)
+			if !ok {
+				return
+			}
+			table := tx.Statement.Table
+			if table == "" {
+				table = "raw"
+			}
+			began := start.(time.Time)
+			duration := time.Since(began)
+			metrics.DBQueryDuration.Observe(duration.Seconds(), operation, table)
+			// 慢请求诊断：语句使用请求上下文时计入该请求的耗时记录
+			logger.TraceFrom(tx.Statement.Context).Add("db", operation+" "+table, began, duration)
+		}
+	}
+
+	callbacks := db.Callback()
+	register := []struct {
+		operation string
+		before    func(name string, fn func(*gorm.DB)) error
+		after     func(name string, fn func(*gorm.DB)) error
+	}{
+		{"create", callbacks.Create().Before("*").Register, callbacks.Create().After("*").Register},
+		{"query", callbacks.Query().Before("*").Register, callbacks.Query().After("*").Register},
+		{"update", callbacks.Update().Before("*").Register, callbacks.Update().After("*").Register},
+		{"delete", callbacks.Delete().Before("*").Register, callbacks.Delete().After("*").Register},
+		{"row", callbacks.Row().Before("*").Register, callbacks.Row().After("*").Register},
+		{"raw", callbacks.Raw().Before("*").Register, callbacks.Raw().After("*").Register},
+	}
+	for _, r := range register {
+		if err := r.before("metrics:before_"+r.operation, before); err != nil {
+			return err
+		}
+		if err := r.after("metrics:after_"+r.operation, after(r.operation)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// requiredTables 有效备份必须包含的表
+var requiredTables = []string{"l2_tp_servers", "users"}
+
+// RestoreResult 数据库恢复结果
+type RestoreResult struct {
+	Tables       map[string]int64 `json:"tables"`        // 已恢复的表及行数
+	Skipped      []string         `json:"skipped"`       // 备份中不存在而保持原样的表
+	SafetyBackup string           `json:"safety_backup"` // 恢复前自动创建的当前数据备份
+}
+
+// ValidateBackup 校验上传的SQLite备份文件：完整性检查和必需表
+func ValidateBackup(backupPath string) error {
+	conn, err := sql.Open("sqlite", "file:"+backupPath+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("无法打开备份文件: %v", err)
+	}
+	defer conn.Close()
+
+	var integrity string
+	if err := conn.QueryRow("PRAGMA integrity_check").Scan(&integrity); err != nil {
+		return fmt.Errorf("备份文件不是有效的SQLite数据库: %v", err)
+	}
+	if integrity != "ok" {
+		return fmt.Errorf("备份文件完整性检查失败: %s", integrity)
+	}
+
+	tables, err := listTables(conn, "main")
+	if err != nil {
+		return err
+	}
+	for _, table := range requiredTables {
+		if !tables[table] {
+			return fmt.Errorf("备份文件缺少必需的表: %s", table)
+		}
+	}
+	return nil
+}
+
+// RestoreDatabase 从备份文件恢复数据：校验后在单个事务内逐表替换数据，保持当前数据库连接不变。
+// 恢复前会在safetyDir中备份当前数据
+func RestoreDatabase(db *gorm.DB, backupPath, safetyDir string) (*RestoreResult, error) {
+	if !IsSQLite(db) {
+		return nil, ErrSQLiteOnly
+	}
+	if err := ValidateBackup(backupPath); err != nil {
+		return nil, err
+	}
+
+	// 恢复前先备份当前数据，便于回退
+	safetyBackup := fmt.Sprintf("pre_restore_%s.db", time.Now().Format("20060102_150405"))
+	if err := os.MkdirAll(safetyDir, 0700); err != nil {
+		return nil, fmt.Errorf("创建备份目录失败: %v", err)
+	}
+	if err := BackupDatabase(db, filepath.Join(safetyDir, safetyBackup)); err != nil {
+		return nil, fmt.Errorf("恢复前备份当前数据失败: %v", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	// ATTACH只对单个连接生效，因此全程使用同一连接
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS restore_src", backupPath); err != nil {
+		return nil, fmt.Errorf("挂载备份文件失败: %v", err)
+	}
+	defer conn.ExecContext(context.Background(), "DETACH DATABASE restore_src")
+
+	result := &RestoreResult{
+		Tables:       make(map[string]int64),
+		SafetyBackup: safetyBackup,
+	}
+
+	// BEGIN IMMEDIATE 立即获取写锁，阻塞其他写入直到恢复完成
+	if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return nil, fmt.Errorf("获取数据库写锁失败: %v", err)
+	}
+	if err := copyTables(ctx, conn, result); err != nil {
+		conn.ExecContext(context.Background(), "ROLLBACK")
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, "COMMIT"); err != nil {
+		conn.ExecContext(context.Background(), "ROLLBACK")
+		return nil, fmt.Errorf("提交恢复事务失败: %v", err)
+	}
+
+	return result, nil
+}
+
+// copyTables 用备份中的数据替换当前库中同名表的数据，只复制双方共有的列
+func copyTables(ctx context.Context, conn *sql.Conn, result *RestoreResult) error {
+	mainTables, err := listTables(conn, "main")
+	if err != nil {
+		return err
+	}
+	srcTables, err := listTables(conn, "restore_src")
+	if err != nil {
+		return err
+	}
+
+	for table := range mainTables {
+		if !srcTables[table] {
+			result.Skipped = append(result.Skipped, table)
+			continue
+		}
+
+		columns, err := commonColumns(ctx, conn, table)
+		if err != nil {
+			return err
+		}
+		if len(columns) == 0 {
+			result.Skipped = append(result.Skipped, table)
+			continue
+		}
+
+		if _, err := conn.ExecContext(ctx, fmt.Sprintf(`DELETE FROM main."%s"`, table)); err != nil {
+			return fmt.Errorf("清空表 %s 失败: %v", table, err)
+		}
+
+		columnList := `"` + strings.Join(columns, `", "`) + `"`
+		res, err := conn.ExecContext(ctx, fmt.Sprintf(`INSERT INTO main."%s" (%s) SELECT %s FROM restore_src."%s"`,
+			table, columnList, columnList, table))
+		if err != nil {
+			return fmt.Errorf("恢复表 %s 失败: %v", table, err)
+		}
+		rows, _ := res.RowsAffected()
+		result.Tables[table] = rows
+	}
+	return nil
+}
+
+// queryer 抽象*sql.DB和*sql.Conn的查询方法
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// listTables 列出指定库中的用户表
+func listTables(q queryer, schema string) (map[string]bool, error) {
+	rows, err := q.QueryContext(context.Background(),
+		fmt.Sprintf("SELECT name FROM %s.sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%%'", schema))
+	if err != nil {
+		return nil, fmt.Errorf("读取表结构失败: %v", err)
+	}
+	defer rows.Close()
+
+	tables := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tables[name] = true
+	}
+	return tables, rows.Err()
+}
+
+// tableColumns 列出表的列名
+func tableColumns(ctx context.Context, q queryer, schema, table string) ([]string, error) {
+	rows, err := q.QueryContext(ctx, fmt.Sprintf(`PRAGMA %s.table_info("%s")`, schema, table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue interface{}
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return nil, err
+		}
+		columns = append(columns, name)
+	}
+	return columns, rows.Err()
+}
+
+// commonColumns 返回当前库和备份中同名表共有的列
+func commonColumns(ctx context.Context, conn *sql.Conn, table string) ([]string, error) {
+	mainColumns, err := tableColumns(ctx, conn, "main", table)
+	if err != nil {
+		return nil, err
+	}
+	srcColumns, err := tableColumns(ctx, conn, "restore_src", table)
+	if err != nil {
+		return nil, err
+	}
+
+	available := make(map[string]bool, len(srcColumns))
+	for _, column := range srcColumns {
+		available[column] = true
+	}
+
+	var columns []string
+	for _, column := range mainColumns {
+		if available[column] {
+			columns = append(columns, column)
+		}
+	}
+	return columns, nil
+}
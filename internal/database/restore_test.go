@@ -0,0 +1,52 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateBackupOpensReadOnly(t *testing.T) {
+	dir := t.TempDir()
+
+	// 不存在的文件以只读方式打开时报错，不会被创建为空数据库
+	missing := filepath.Join(dir, "missing.db")
+	if err := ValidateBackup(missing); err == nil {
+		t.Fatal("不存在的备份文件应校验失败")
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Fatalf("校验不应创建备份文件: %v", err)
+	}
+
+	// 有效的备份在只读文件上也能校验，校验过程不修改文件
+	backup := filepath.Join(dir, "backup.db")
+	db, err := Initialize("sqlite", backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	if _, err := sqlDB.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.Close()
+	os.Remove(backup + "-wal")
+	os.Remove(backup + "-shm")
+
+	before, err := os.ReadFile(backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(backup, 0400); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateBackup(backup); err != nil {
+		t.Fatalf("校验有效的备份失败: %v", err)
+	}
+	after, err := os.ReadFile(backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(before) != string(after) {
+		t.Fatal("校验修改了备份文件")
+	}
+}
@@ -0,0 +1,438 @@
+package grpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"l2tp-manager/internal/database"
+	"l2tp-manager/internal/grpcapi/l2tpv1"
+	"l2tp-manager/internal/services"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+// statsInterval 实时吞吐量的推送间隔，与WebSocket traffic主题一致
+const statsInterval = time.Second
+
+// ListServers 分页查询服务器列表
+func (s *Server) ListServers(ctx context.Context, req *l2tpv1.ListServersRequest) (*l2tpv1.ListServersResponse, error) {
+	query := services.ServerListQuery{
+		Page:     int(req.GetPage()),
+		PageSize: int(req.GetPageSize()),
+		Sort:     req.GetSort(),
+		Status:   req.GetStatus(),
+		Expired:  req.Expired,
+		Keyword:  req.GetQuery(),
+	}
+	if query.Page <= 0 {
+		query.Page = 1
+	}
+	if query.PageSize < 0 || query.PageSize > 500 {
+		query.PageSize = 500
+	}
+
+	servers, total, err := s.l2tp.ListServers(query)
+	if errors.Is(err, services.ErrUnsupportedSort) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		slog.Error("获取服务器列表失败", "error", err)
+		return nil, status.Error(codes.Internal, "获取服务器列表失败")
+	}
+	resp := &l2tpv1.ListServersResponse{
+		Servers:  make([]*l2tpv1.Server, 0, len(servers)),
+		Total:    total,
+		Page:     int32(query.Page),
+		PageSize: int32(query.PageSize),
+	}
+	for i := range servers {
+		resp.Servers = append(resp.Servers, toProtoServer(&servers[i]))
+	}
+	return resp, nil
+}
+
+// GetServer 获取服务器
+func (s *Server) GetServer(ctx context.Context, req *l2tpv1.GetServerRequest) (*l2tpv1.Server, error) {
+	server, err := s.getServer(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return toProtoServer(server), nil
+}
+
+// LookupServer 按外部ID、名称或中转端口精确查找唯一的服务器
+func (s *Server) LookupServer(ctx context.Context, req *l2tpv1.LookupServerRequest) (*l2tpv1.Server, error) {
+	server, err := s.l2tp.LookupServer(services.ServerLookup{
+		ExternalID: req.GetExternalId(),
+		Name:       req.GetName(),
+		L2TPPort:   int(req.GetL2TpPort()),
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, status.Error(codes.NotFound, "服务器不存在")
+	case errors.Is(err, services.ErrServerAmbiguous):
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return toProtoServer(server), nil
+}
+
+// CreateServer 创建服务器并添加转发，校验规则与REST API一致。携带幂等键时相同请求的重试返回首次创建的服务器
+func (s *Server) CreateServer(ctx context.Context, req *l2tpv1.CreateServerRequest) (*l2tpv1.Server, error) {
+	if req.GetServer() == nil {
+		return nil, status.Error(codes.InvalidArgument, "缺少服务器信息")
+	}
+	server := fromProtoServer(req.GetServer())
+	if server.Name == "" || server.Host == "" || server.Username == "" || server.Password == "" {
+		return nil, status.Error(codes.InvalidArgument, "请填写完整的服务器信息")
+	}
+	if server.L2TPPort <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "请输入有效的中转端口")
+	}
+	if err := validateSchedule(server); err != nil {
+		return nil, err
+	}
+
+	// 幂等键按序列化后的服务器信息判断重试是否为同一请求
+	body, err := proto.MarshalOptions{Deterministic: true}.Marshal(req.GetServer())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	replayed, err := s.l2tp.CreateServerIdempotent(server, idempotencyOwner(ctx), req.GetIdempotencyKey(), services.HashRequest(body))
+	if errors.Is(err, services.ErrIdempotencyMismatch) {
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if replayed {
+		return toProtoServer(server), nil
+	}
+	if err := s.l2tp.RecordRevision(server, nil, "create", username(ctx)); err != nil {
+		slog.ErrorContext(ctx, "记录配置修订失败", "server_id", server.ID, "error", err)
+	}
+	s.routing.AddL2TPServer(server)
+	return toProtoServer(server), nil
+}
+
+// UpdateServer 更新服务器配置并热更新转发器。运行状态和创建时间保持不变
+func (s *Server) UpdateServer(ctx context.Context, req *l2tpv1.UpdateServerRequest) (*l2tpv1.Server, error) {
+	if req.GetServer() == nil {
+		return nil, status.Error(codes.InvalidArgument, "缺少服务器信息")
+	}
+	before, err := s.getServer(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	server := fromProtoServer(req.GetServer())
+	if err := validateSchedule(server); err != nil {
+		return nil, err
+	}
+	server.Status = before.Status
+	server.CreatedAt = before.CreatedAt
+
+	if err := s.l2tp.UpdateServer(before.ID, server); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := s.l2tp.RecordRevision(server, before, "update", username(ctx)); err != nil {
+		slog.ErrorContext(ctx, "记录配置修订失败", "server_id", server.ID, "error", err)
+	}
+	s.routing.ReloadL2TPServer(before.L2TPPort, server)
+	return toProtoServer(server), nil
+}
+
+// DeleteServer 将服务器移入回收站，运行中的服务器先停止
+func (s *Server) DeleteServer(ctx context.Context, req *l2tpv1.DeleteServerRequest) (*l2tpv1.DeleteServerResponse, error) {
+	server, err := s.getServer(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	if server.Status == "running" {
+		if err := s.l2tp.StopServer(ctx, server.ID); err != nil {
+			s.record(ctx, server.ID, "delete", "failed", err.Error())
+			return nil, status.Errorf(codes.Internal, "停止服务器失败: %v", err)
+		}
+	}
+
+	s.routing.RemoveL2TPServer(server.L2TPPort)
+	if err := s.l2tp.DeleteServer(server.ID); err != nil {
+		s.record(ctx, server.ID, "delete", "failed", err.Error())
+		return nil, status.Errorf(codes.Internal, "删除失败: %v", err)
+	}
+	s.record(ctx, server.ID, "delete", "success", server.Name)
+	return &l2tpv1.DeleteServerResponse{Message: "服务器已移入回收站"}, nil
+}
+
+// StartServer 启动服务器，启动任务在后台执行，进度通过StreamEvents推送
+func (s *Server) StartServer(ctx context.Context, req *l2tpv1.ServerActionRequest) (*l2tpv1.ServerActionResponse, error) {
+	return s.serverAction(ctx, req.GetId(), "start")
+}
+
+// StopServer 停止服务器
+func (s *Server) StopServer(ctx context.Context, req *l2tpv1.ServerActionRequest) (*l2tpv1.ServerActionResponse, error) {
+	return s.serverAction(ctx, req.GetId(), "stop")
+}
+
+// RestartServer 重启服务器
+func (s *Server) RestartServer(ctx context.Context, req *l2tpv1.ServerActionRequest) (*l2tpv1.ServerActionResponse, error) {
+	return s.serverAction(ctx, req.GetId(), "restart")
+}
+
+// serverAction 执行启动、停止或重启，与面板操作一致同时更新期望状态和转发器状态
+func (s *Server) serverAction(ctx context.Context, id uint32, action string) (*l2tpv1.ServerActionResponse, error) {
+	server, err := s.getServer(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var message, desired string
+	switch action {
+	case "start":
+		if server.Status == "running" {
+			return nil, status.Error(codes.FailedPrecondition, "服务器已在运行中")
+		}
+		err, message, desired = s.l2tp.StartServer(ctx, server.ID), "服务器正在启动", "running"
+	case "stop":
+		if server.Status == "stopped" {
+			return nil, status.Error(codes.FailedPrecondition, "服务器已停止")
+		}
+		err, message, desired = s.l2tp.StopServer(ctx, server.ID), "服务器正在停止", "stopped"
+	default:
+		err, message = s.l2tp.RestartServer(ctx, server.ID), "服务器重启成功"
+	}
+	if err != nil {
+		s.record(ctx, server.ID, action, "failed", err.Error())
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if desired != "" {
+		if err := s.l2tp.SetDesiredState(server.ID, desired); err != nil {
+			s.record(ctx, server.ID, action, "failed", "更新期望状态失败: "+err.Error())
+			return nil, status.Error(codes.Internal, "更新期望状态失败: "+err.Error())
+		}
+		s.routing.UpdateServerStatus(server.ID, desired)
+	}
+	s.record(ctx, server.ID, action, "success", "gRPC")
+
+	resp := &l2tpv1.ServerActionResponse{Message: message}
+	if current, err := s.l2tp.GetServer(server.ID); err == nil {
+		resp.Status = current.Status
+	}
+	return resp, nil
+}
+
+// StreamStats 每秒推送各转发端口的实时吞吐量，直到客户端断开
+func (s *Server) StreamStats(req *l2tpv1.StreamStatsRequest, stream grpc.ServerStreamingServer[l2tpv1.StatsUpdate]) error {
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case now := <-ticker.C:
+			update := &l2tpv1.StatsUpdate{Time: timestamppb.New(now)}
+			for _, sample := range s.routing.Throughput() {
+				if len(req.GetServerIds()) > 0 && !slices.Contains(req.GetServerIds(), uint32(sample.ServerID)) {
+					continue
+				}
+				update.Samples = append(update.Samples, &l2tpv1.Throughput{
+					ServerId: uint32(sample.ServerID),
+					Port:     int32(sample.Port),
+					Uplink:   sample.Uplink,
+					Downlink: sample.Downlink,
+				})
+			}
+			if err := stream.Send(update); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// StreamEvents 推送与WebSocket /ws/status 相同的状态事件，直到客户端断开
+func (s *Server) StreamEvents(req *l2tpv1.StreamEventsRequest, stream grpc.ServerStreamingServer[l2tpv1.Event]) error {
+	events, cancel := s.ws.Listen()
+	defer cancel()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case msg := <-events:
+			if len(req.GetTypes()) > 0 && !slices.Contains(req.GetTypes(), msg.Type) {
+				continue
+			}
+			if len(req.GetServerIds()) > 0 && !slices.Contains(req.GetServerIds(), uint32(msg.ServerID)) {
+				continue
+			}
+			event := &l2tpv1.Event{
+				Seq:      msg.Seq,
+				Type:     msg.Type,
+				Time:     timestamppb.New(msg.Time),
+				ServerId: uint32(msg.ServerID),
+				Status:   msg.Status,
+				Message:  msg.Message,
+			}
+			if msg.Data != nil {
+				data, err := json.Marshal(msg.Data)
+				if err != nil {
+					slog.Warn("序列化事件数据失败", "type", msg.Type, "error", err)
+				}
+				event.Data = data
+			}
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// getServer 获取服务器，不存在时返回NotFound
+func (s *Server) getServer(id uint32) (*database.L2TPServer, error) {
+	if id == 0 {
+		return nil, status.Error(codes.InvalidArgument, "无效的服务器ID")
+	}
+	server, err := s.l2tp.GetServer(uint(id))
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "服务器不存在")
+	}
+	return server, nil
+}
+
+// record 以当前调用的用户和地址记录审计日志
+func (s *Server) record(ctx context.Context, serverID uint, action, result, detail string) {
+	s.audit.RecordFrom(clientIP(ctx), serverID, action, username(ctx), result, detail)
+}
+
+// validateSchedule 校验定时重启计划
+func validateSchedule(server *database.L2TPServer) error {
+	if server.RestartSchedule == "" {
+		return nil
+	}
+	if _, err := services.ParseCron(server.RestartSchedule); err != nil {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("定时重启计划无效: %v", err))
+	}
+	return nil
+}
+
+// toProtoServer 数据库模型转换为protobuf消息
+func toProtoServer(server *database.L2TPServer) *l2tpv1.Server {
+	return &l2tpv1.Server{
+		Id:                   uint32(server.ID),
+		Name:                 server.Name,
+		Host:                 server.Host,
+		Port:                 int32(server.Port),
+		Username:             server.Username,
+		Password:             server.Password,
+		L2TpPort:             int32(server.L2TPPort),
+		Psk:                  server.PSK,
+		Users:                server.Users,
+		Status:               server.Status,
+		DesiredState:         server.DesiredState,
+		ExpireDate:           timestamppb.New(server.ExpireDate),
+		EnableOpenvpn:        server.EnableOpenVPN,
+		OpenvpnRelayPort:     int32(server.OpenVPNRelayPort),
+		EnableSstp:           server.EnableSSTP,
+		SstpRelayPort:        int32(server.SSTPRelayPort),
+		RestartSchedule:      server.RestartSchedule,
+		RestartJitter:        int32(server.RestartJitter),
+		RestartSkipIfClients: server.RestartSkipIfClients,
+		RelayNodeId:          uint32(server.RelayNodeID),
+		IsExpired:            time.Now().After(server.ExpireDate),
+		CreatedAt:            timestamppb.New(server.CreatedAt),
+		UpdatedAt:            timestamppb.New(server.UpdatedAt),
+		ExternalId:           server.ExternalID,
+		Type:                 server.Type,
+		OpenvpnProto:         server.OpenVPNProto,
+		Ikev2Auth:            server.IKEv2Auth,
+		Ikev2Identity:        server.IKEv2Identity,
+		Ikev2NatPort:         int32(server.IKEv2NATPort),
+		RealityServerName:    server.RealityServerName,
+		ChainNodes:           server.ChainNodes,
+		GeoipMode:            server.GeoIPMode,
+		GeoipCountries:       server.GeoIPCountries,
+		SoftetherHub:         server.SoftEtherHub,
+		SecurenatDisabled:    server.SecureNATDisabled,
+		SecurenatAddress:     server.SecureNATAddress,
+		DhcpStart:            server.DHCPStart,
+		DhcpEnd:              server.DHCPEnd,
+		ClientDns:            server.ClientDNS,
+		DnsDomains:           server.DNSDomains,
+		NatKeepalive:         int32(server.NATKeepalive),
+		KnockEnabled:         server.KnockEnabled,
+		KnockSecret:          server.KnockSecret,
+		KnockTtl:             int32(server.KnockTTL),
+		Obfuscation:          server.Obfuscation,
+		ObfuscationPort:      int32(server.ObfuscationPort),
+		ObfuscationKey:       server.ObfuscationKey,
+		BillingAnchorDay:     int32(server.BillingAnchorDay),
+		BillingTimezone:      server.BillingTimezone,
+	}
+}
+
+// fromProtoServer protobuf消息转换为数据库模型，忽略ID、状态和时间戳等只读字段
+func fromProtoServer(server *l2tpv1.Server) *database.L2TPServer {
+	result := &database.L2TPServer{
+		Name:                 server.GetName(),
+		Host:                 server.GetHost(),
+		Port:                 int(server.GetPort()),
+		Username:             server.GetUsername(),
+		Password:             server.GetPassword(),
+		L2TPPort:             int(server.GetL2TpPort()),
+		PSK:                  server.GetPsk(),
+		Users:                server.GetUsers(),
+		DesiredState:         server.GetDesiredState(),
+		EnableOpenVPN:        server.GetEnableOpenvpn(),
+		OpenVPNRelayPort:     int(server.GetOpenvpnRelayPort()),
+		EnableSSTP:           server.GetEnableSstp(),
+		SSTPRelayPort:        int(server.GetSstpRelayPort()),
+		RestartSchedule:      server.GetRestartSchedule(),
+		RestartJitter:        int(server.GetRestartJitter()),
+		RestartSkipIfClients: server.GetRestartSkipIfClients(),
+		RelayNodeID:          uint(server.GetRelayNodeId()),
+		ExternalID:           server.GetExternalId(),
+		Type:                 server.GetType(),
+		OpenVPNProto:         server.GetOpenvpnProto(),
+		IKEv2Auth:            server.GetIkev2Auth(),
+		IKEv2Identity:        server.GetIkev2Identity(),
+		IKEv2NATPort:         int(server.GetIkev2NatPort()),
+		RealityServerName:    server.GetRealityServerName(),
+		ChainNodes:           server.GetChainNodes(),
+		GeoIPMode:            server.GetGeoipMode(),
+		GeoIPCountries:       server.GetGeoipCountries(),
+		SoftEtherHub:         server.GetSoftetherHub(),
+		SecureNATDisabled:    server.GetSecurenatDisabled(),
+		SecureNATAddress:     server.GetSecurenatAddress(),
+		DHCPStart:            server.GetDhcpStart(),
+		DHCPEnd:              server.GetDhcpEnd(),
+		ClientDNS:            server.GetClientDns(),
+		DNSDomains:           server.GetDnsDomains(),
+		NATKeepalive:         int(server.GetNatKeepalive()),
+		KnockEnabled:         server.GetKnockEnabled(),
+		KnockSecret:          server.GetKnockSecret(),
+		KnockTTL:             int(server.GetKnockTtl()),
+		Obfuscation:          server.GetObfuscation(),
+		ObfuscationPort:      int(server.GetObfuscationPort()),
+		ObfuscationKey:       server.GetObfuscationKey(),
+		BillingAnchorDay:     int(server.GetBillingAnchorDay()),
+		BillingTimezone:      server.GetBillingTimezone(),
+	}
+	if server.GetExpireDate() != nil {
+		result.ExpireDate = server.GetExpireDate().AsTime()
+	}
+	if result.Port == 0 {
+		result.Port = 22
+	}
+	return result
+}
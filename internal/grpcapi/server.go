@@ -0,0 +1,175 @@
+// Package grpcapi gRPC管理接口，与REST API共用服务层和JWT认证。
+// 接口定义见 proto/l2tp/v1/panel.proto，修改后重新生成 l2tpv1 包
+package grpcapi
+
+//go:generate protoc -I ../../proto --go_out=../.. --go_opt=module=l2tp-manager --go-grpc_out=../.. --go-grpc_opt=module=l2tp-manager l2tp/v1/panel.proto
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"l2tp-manager/internal/grpcapi/l2tpv1"
+	"l2tp-manager/internal/logger"
+	"l2tp-manager/internal/services"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// Server gRPC管理接口实现
+type Server struct {
+	l2tpv1.UnimplementedPanelServiceServer
+
+	auth    *services.AuthService
+	l2tp    *services.L2TPService
+	routing *services.RoutingService
+	ws      *services.WSManager
+	audit   *services.AuditService
+	leader  *services.LeaderElector
+	grpc    *grpc.Server
+}
+
+// NewServer 创建gRPC管理接口，certFile和keyFile同时设置时使用TLS
+func NewServer(auth *services.AuthService, l2tp *services.L2TPService, routing *services.RoutingService, ws *services.WSManager, audit *services.AuditService, leader *services.LeaderElector, certFile, keyFile string) (*Server, error) {
+	s := &Server{auth: auth, l2tp: l2tp, routing: routing, ws: ws, audit: audit, leader: leader}
+
+	options := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(s.unaryInterceptor),
+		grpc.ChainStreamInterceptor(s.streamInterceptor),
+	}
+	if certFile != "" && keyFile != "" {
+		creds, err := credentials.NewServerTLSFromFile(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, grpc.Creds(creds))
+	}
+
+	s.grpc = grpc.NewServer(options...)
+	l2tpv1.RegisterPanelServiceServer(s.grpc, s)
+	// 支持grpcurl等工具直接列出接口
+	reflection.Register(s.grpc)
+	return s, nil
+}
+
+// Serve 在listener上提供服务，直到Stop
+func (s *Server) Serve(listener net.Listener) error {
+	return s.grpc.Serve(listener)
+}
+
+// Stop 等待进行中的调用结束后关闭，超时后强制关闭(事件流等长连接不会自行结束)
+func (s *Server) Stop(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		s.grpc.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.grpc.Stop()
+	}
+}
+
+// usernameKey 上下文中保存当前用户名的键
+type usernameKey struct{}
+
+// userIDKey 上下文中保存当前用户ID的键
+type userIDKey struct{}
+
+// authenticate 校验metadata中的Bearer令牌，并为调用分配请求ID
+func (s *Server) authenticate(ctx context.Context) (context.Context, error) {
+	if !s.leader.IsLeader() {
+		return nil, status.Error(codes.Unavailable, "当前实例为备用节点，请访问主节点")
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "缺少认证令牌")
+	}
+	token, ok := strings.CutPrefix(values[0], "Bearer ")
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "认证令牌格式错误")
+	}
+	claims, err := s.auth.ValidateToken(token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "无效的认证令牌")
+	}
+	// gRPC接口面向平台自动化，不按租户隔离，只允许平台管理员调用
+	if claims.TenantID != 0 {
+		return nil, status.Error(codes.PermissionDenied, "租户用户不能调用gRPC接口")
+	}
+
+	ctx = context.WithValue(ctx, usernameKey{}, claims.Username)
+	ctx = context.WithValue(ctx, userIDKey{}, claims.UserID)
+	return logger.WithRequestID(ctx, logger.NewRequestID()), nil
+}
+
+// unaryInterceptor 认证并记录普通调用
+func (s *Server) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	slog.InfoContext(ctx, "gRPC调用", "method", info.FullMethod, "username", username(ctx),
+		"client_ip", clientIP(ctx), "code", status.Code(err).String(), "duration", time.Since(start))
+	return resp, err
+}
+
+// authenticatedStream 携带认证后上下文的流
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context 返回认证后的上下文
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// streamInterceptor 认证并记录流式调用
+func (s *Server) streamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authenticate(stream.Context())
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "gRPC流已建立", "method", info.FullMethod, "username", username(ctx), "client_ip", clientIP(ctx))
+	err = handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+	slog.InfoContext(ctx, "gRPC流已结束", "method", info.FullMethod, "code", status.Code(err).String())
+	return err
+}
+
+// username 当前调用的用户名
+func username(ctx context.Context) string {
+	name, _ := ctx.Value(usernameKey{}).(string)
+	return name
+}
+
+// idempotencyOwner 当前调用使用幂等键的用户，gRPC接口只允许平台管理员调用
+func idempotencyOwner(ctx context.Context) services.IdempotencyOwner {
+	userID, _ := ctx.Value(userIDKey{}).(uint)
+	return services.IdempotencyOwner{UserID: userID}
+}
+
+// clientIP 调用方地址
+func clientIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+		return host
+	}
+	return p.Addr.String()
+}
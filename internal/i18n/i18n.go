@@ -0,0 +1,240 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"log/slog"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 支持的语言，消息原文为中文，其他语言从locales目录下的消息目录加载
+const (
+	Chinese = "zh"
+	English = "en"
+	Default = Chinese
+)
+
+// maxDepth 分段翻译的最大递归深度
+const maxDepth = 8
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// template 含占位符{}的消息模板，如 "中转端口 {} 已被使用"
+type template struct {
+	pattern     *regexp.Regexp
+	translation string
+	literal     int // 模板中固定文字的长度，越长越优先匹配
+}
+
+// catalog 一种语言的消息目录
+type catalog struct {
+	messages  map[string]string
+	templates []template
+}
+
+var catalogs = map[string]*catalog{}
+
+// placeholderPattern 译文中的占位符，{}按顺序取值，{N}取第N个(从1开始)
+var placeholderPattern = regexp.MustCompile(`\{(\d*)\}`)
+
+func init() {
+	entries, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		data, err := localeFiles.ReadFile("locales/" + entry.Name())
+		if err != nil {
+			continue
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			slog.Error("解析消息目录失败", "file", entry.Name(), "error", err)
+			continue
+		}
+		catalogs[strings.TrimSuffix(entry.Name(), path.Ext(entry.Name()))] = newCatalog(messages)
+	}
+}
+
+// newCatalog 区分固定消息和含占位符的模板
+func newCatalog(messages map[string]string) *catalog {
+	c := &catalog{messages: make(map[string]string, len(messages))}
+	for source, translation := range messages {
+		if !strings.Contains(source, "{}") {
+			c.messages[source] = translation
+			continue
+		}
+		parts := strings.Split(source, "{}")
+		literal := 0
+		for i, part := range parts {
+			literal += len(part)
+			parts[i] = regexp.QuoteMeta(part)
+		}
+		c.templates = append(c.templates, template{
+			pattern:     regexp.MustCompile("^" + strings.Join(parts, "(.+?)") + "$"),
+			translation: translation,
+			literal:     literal,
+		})
+	}
+	sort.SliceStable(c.templates, func(i, j int) bool { return c.templates[i].literal > c.templates[j].literal })
+	return c
+}
+
+// Languages 支持的语言
+func Languages() []string {
+	languages := []string{Chinese}
+	for lang := range catalogs {
+		languages = append(languages, lang)
+	}
+	sort.Strings(languages[1:])
+	return languages
+}
+
+// Normalize 将语言标签(如 en-US、zh_CN)规范为支持的语言，不支持时返回空字符串
+func Normalize(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	if tag == Chinese {
+		return Chinese
+	}
+	if _, ok := catalogs[tag]; ok {
+		return tag
+	}
+	return ""
+}
+
+// Negotiate 按Accept-Language请求头的权重选择支持的语言，都不支持时返回默认语言
+func Negotiate(acceptLanguage string) string {
+	best, bestQuality := Default, 0.0
+	for _, item := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(item, ";")
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if q, err := strconv.ParseFloat(value, 64); err == nil {
+				quality = q
+			}
+		}
+		lang := Normalize(tag)
+		if lang != "" && quality > bestQuality {
+			best, bestQuality = lang, quality
+		}
+	}
+	return best
+}
+
+// Translate 将中文消息翻译为指定语言。依次尝试完整匹配、按 ": " 和 "; " 分段翻译、模板匹配，
+// 没有译文的部分保留原文
+func Translate(lang, message string) string {
+	c, ok := catalogs[lang]
+	if !ok || message == "" {
+		return message
+	}
+	return c.translate(message, 0)
+}
+
+func (c *catalog) translate(message string, depth int) string {
+	if translation, ok := c.messages[message]; ok {
+		return translation
+	}
+	if depth >= maxDepth {
+		return message
+	}
+	// 先按分隔符拆分(如 "启动失败: SSH连接失败: ...")，任一段有译文时采用，否则再尝试模板
+	for _, separator := range []string{": ", "; "} {
+		parts := strings.Split(message, separator)
+		if len(parts) < 2 {
+			continue
+		}
+		changed := false
+		for i, part := range parts {
+			translated := c.translate(part, depth+1)
+			changed = changed || translated != part
+			parts[i] = translated
+		}
+		if changed {
+			return strings.Join(parts, separator)
+		}
+	}
+	for _, t := range c.templates {
+		match := t.pattern.FindStringSubmatch(message)
+		if match == nil {
+			continue
+		}
+		args := match[1:]
+		next := 0
+		return placeholderPattern.ReplaceAllStringFunc(t.translation, func(placeholder string) string {
+			index := next
+			if n, err := strconv.Atoi(placeholder[1 : len(placeholder)-1]); err == nil {
+				index = n - 1
+			} else {
+				next++
+			}
+			if index < 0 || index >= len(args) {
+				return placeholder
+			}
+			return c.translate(args[index], depth+1)
+		})
+	}
+	return message
+}
+
+// TranslateJSON 翻译JSON响应体顶层的message字段和errors中每项的message字段，
+// 不是JSON对象或没有需要翻译的内容时原样返回
+func TranslateJSON(lang string, body []byte) []byte {
+	if _, ok := catalogs[lang]; !ok {
+		return body
+	}
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return body
+	}
+
+	changed := false
+	if message, ok := translateField(lang, envelope["message"]); ok {
+		envelope["message"] = message
+		changed = true
+	}
+	var details []map[string]json.RawMessage
+	if raw, ok := envelope["errors"]; ok && json.Unmarshal(raw, &details) == nil {
+		for _, detail := range details {
+			if message, ok := translateField(lang, detail["message"]); ok {
+				detail["message"] = message
+				changed = true
+			}
+		}
+		envelope["errors"], _ = json.Marshal(details)
+	}
+	if !changed {
+		return body
+	}
+
+	result, err := json.Marshal(envelope)
+	if err != nil {
+		return body
+	}
+	return result
+}
+
+// translateField 翻译JSON字符串字段，没有变化时返回false
+func translateField(lang string, raw json.RawMessage) (json.RawMessage, bool) {
+	var message string
+	if len(raw) == 0 || json.Unmarshal(raw, &message) != nil || message == "" {
+		return nil, false
+	}
+	translated := Translate(lang, message)
+	if translated == message {
+		return nil, false
+	}
+	data, err := json.Marshal(translated)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
@@ -0,0 +1,239 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry 内存中保存的一条日志
+type Entry struct {
+	Seq     uint64                 `json:"seq"`
+	Time    time.Time              `json:"time"`
+	Level   string                 `json:"level"`
+	Message string                 `json:"message"`
+	Attrs   map[string]interface{} `json:"attrs,omitempty"`
+
+	level slog.Level
+}
+
+// Query 日志查询条件
+type Query struct {
+	MinLevel slog.Level
+	Since    time.Time
+	Until    time.Time
+	Keyword  string // 匹配消息或属性值
+	AfterSeq uint64 // 只返回序号大于该值的日志
+	Limit    int    // 返回最新的N条，<=0表示全部
+}
+
+// Match 判断日志是否满足查询条件(不含Limit)
+func (q Query) Match(e Entry) bool {
+	if e.level < q.MinLevel || e.Seq <= q.AfterSeq {
+		return false
+	}
+	if !q.Since.IsZero() && e.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !e.Time.Before(q.Until) {
+		return false
+	}
+	if q.Keyword != "" {
+		if strings.Contains(e.Message, q.Keyword) {
+			return true
+		}
+		for _, value := range e.Attrs {
+			if strings.Contains(fmt.Sprint(value), q.Keyword) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Buffer 固定容量的环形日志缓冲区，供面板内查看本程序日志
+type Buffer struct {
+	entries     []Entry
+	next        int
+	full        bool
+	seq         uint64
+	subscribers map[chan Entry]struct{}
+	mutex       sync.RWMutex
+}
+
+// NewBuffer 创建日志缓冲区
+func NewBuffer(size int) *Buffer {
+	if size <= 0 {
+		size = 1000
+	}
+	return &Buffer{entries: make([]Entry, size), subscribers: make(map[chan Entry]struct{})}
+}
+
+// add 写入日志并推送给订阅者，订阅者处理不及时则丢弃
+func (b *Buffer) add(e Entry) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.seq++
+	e.Seq = b.seq
+	b.entries[b.next] = e
+	b.next = (b.next + 1) % len(b.entries)
+	if b.next == 0 {
+		b.full = true
+	}
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Query 按条件查询日志，按时间正序返回
+func (b *Buffer) Query(q Query) []Entry {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	ordered := b.entries[:b.next]
+	if b.full {
+		ordered = append(append([]Entry(nil), b.entries[b.next:]...), b.entries[:b.next]...)
+	}
+
+	result := []Entry{}
+	for _, e := range ordered {
+		if q.Match(e) {
+			result = append(result, e)
+		}
+	}
+	if q.Limit > 0 && len(result) > q.Limit {
+		result = result[len(result)-q.Limit:]
+	}
+	return result
+}
+
+// Subscribe 订阅新日志，返回的取消函数用于退订
+func (b *Buffer) Subscribe() (<-chan Entry, func()) {
+	ch := make(chan Entry, 256)
+
+	b.mutex.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mutex.Unlock()
+
+	return ch, func() {
+		b.mutex.Lock()
+		delete(b.subscribers, ch)
+		b.mutex.Unlock()
+	}
+}
+
+// bufferHandler 将日志写入Buffer的slog处理器
+type bufferHandler struct {
+	buffer *Buffer
+	level  slog.Leveler
+	attrs  []slog.Attr
+	prefix string // 分组前缀
+}
+
+func (h *bufferHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *bufferHandler) Handle(ctx context.Context, record slog.Record) error {
+	entry := Entry{Time: record.Time, Level: record.Level.String(), Message: record.Message, level: record.Level}
+	if len(h.attrs) > 0 || record.NumAttrs() > 0 {
+		entry.Attrs = make(map[string]interface{}, len(h.attrs)+record.NumAttrs())
+		for _, attr := range h.attrs {
+			addAttr(entry.Attrs, "", attr)
+		}
+		record.Attrs(func(attr slog.Attr) bool {
+			addAttr(entry.Attrs, h.prefix, attr)
+			return true
+		})
+	}
+	h.buffer.add(entry)
+	return nil
+}
+
+func (h *bufferHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = append([]slog.Attr(nil), h.attrs...)
+	for _, attr := range attrs {
+		attr.Key = h.prefix + attr.Key
+		clone.attrs = append(clone.attrs, attr)
+	}
+	return &clone
+}
+
+func (h *bufferHandler) WithGroup(name string) slog.Handler {
+	clone := *h
+	clone.prefix = h.prefix + name + "."
+	return &clone
+}
+
+// addAttr 展开属性为扁平键值，错误和时长等转为字符串便于JSON输出
+func addAttr(attrs map[string]interface{}, prefix string, attr slog.Attr) {
+	value := attr.Value.Resolve()
+	if value.Kind() == slog.KindGroup {
+		for _, child := range value.Group() {
+			addAttr(attrs, prefix+attr.Key+".", child)
+		}
+		return
+	}
+
+	switch v := value.Any().(type) {
+	case error:
+		attrs[prefix+attr.Key] = v.Error()
+	case time.Duration:
+		attrs[prefix+attr.Key] = v.String()
+	case fmt.Stringer:
+		attrs[prefix+attr.Key] = v.String()
+	default:
+		attrs[prefix+attr.Key] = v
+	}
+}
+
+// teeHandler 同时写入多个处理器
+type teeHandler []slog.Handler
+
+func (t teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range t {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t teeHandler) Handle(ctx context.Context, record slog.Record) error {
+	var firstErr error
+	for _, h := range t {
+		if !h.Enabled(ctx, record.Level) {
+			continue
+		}
+		if err := h.Handle(ctx, record.Clone()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (t teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(teeHandler, len(t))
+	for i, h := range t {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (t teeHandler) WithGroup(name string) slog.Handler {
+	handlers := make(teeHandler, len(t))
+	for i, h := range t {
+		handlers[i] = h.WithGroup(name)
+	}
+	return handlers
+}
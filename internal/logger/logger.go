@@ -0,0 +1,95 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// requestIDKey 上下文中请求ID的键
+type requestIDKey struct{}
+
+// level 全局日志级别，可在运行中通过SetLevel修改
+var level slog.LevelVar
+
+// Setup 按配置初始化全局日志，format为json时输出JSON，否则输出文本。
+// 日志同时写入返回的环形缓冲区，标准库log的输出也会经由该日志处理器
+func Setup(w io.Writer, logLevel, format string, bufferSize int) *Buffer {
+	level.Set(ParseLevel(logLevel))
+	options := &slog.HandlerOptions{Level: &level}
+
+	var handler slog.Handler
+	if strings.EqualFold(format, "json") {
+		handler = slog.NewJSONHandler(w, options)
+	} else {
+		handler = slog.NewTextHandler(w, options)
+	}
+
+	buffer := NewBuffer(bufferSize)
+	tee := teeHandler{handler, &bufferHandler{buffer: buffer, level: options.Level}}
+	slog.SetDefault(slog.New(contextHandler{tee}))
+	return buffer
+}
+
+// SetLevel 修改全局日志级别，用于重新加载配置
+func SetLevel(logLevel string) {
+	level.Set(ParseLevel(logLevel))
+}
+
+// ParseLevel 解析日志级别，无法识别时返回info
+func ParseLevel(level string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// NewRequestID 生成请求ID
+func NewRequestID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// WithRequestID 将请求ID放入上下文，后续使用该上下文的日志都会带上request_id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID 获取上下文中的请求ID
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// contextHandler 从上下文中提取请求ID附加到日志记录
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
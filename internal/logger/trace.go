@@ -0,0 +1,137 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// traceKey 上下文中耗时记录的键
+type traceKey struct{}
+
+// maxSpans 单次记录保留的调用明细条数，超出后只累计汇总
+const maxSpans = 200
+
+// slowLogSpans 慢请求日志中列出的最耗时调用条数
+const slowLogSpans = 10
+
+// slowThreshold 慢请求/慢任务阈值(纳秒)，0表示不记录
+var slowThreshold atomic.Int64
+
+// SetSlowThreshold 设置慢请求阈值，超过阈值的请求和服务器操作输出SSH、数据库等调用的耗时明细
+func SetSlowThreshold(d time.Duration) {
+	slowThreshold.Store(int64(d))
+}
+
+// IsSlow 耗时是否超过慢请求阈值
+func IsSlow(d time.Duration) bool {
+	threshold := time.Duration(slowThreshold.Load())
+	return threshold > 0 && d >= threshold
+}
+
+// Span 一次外部调用(SSH命令、数据库语句等)
+type Span struct {
+	Kind     string        // ssh/db
+	Name     string        // 如 "exec docker pull ..."、"query l2tp_servers"
+	Offset   time.Duration // 相对记录开始的时间
+	Duration time.Duration
+}
+
+// traceTotal 一类调用的次数和总耗时
+type traceTotal struct {
+	count int
+	total time.Duration
+}
+
+// Trace 一次请求或服务器操作中外部调用的耗时记录，各方法对nil安全，未开启记录时调用无开销
+type Trace struct {
+	start  time.Time
+	spans  []Span
+	totals map[string]*traceTotal
+	mutex  sync.Mutex
+}
+
+// NewTrace 开始记录
+func NewTrace() *Trace {
+	return &Trace{start: time.Now(), totals: make(map[string]*traceTotal)}
+}
+
+// WithTrace 将耗时记录放入上下文，使用该上下文的数据库语句会被记录
+func WithTrace(ctx context.Context, trace *Trace) context.Context {
+	return context.WithValue(ctx, traceKey{}, trace)
+}
+
+// TraceFrom 获取上下文中的耗时记录，没有时返回nil
+func TraceFrom(ctx context.Context) *Trace {
+	if ctx == nil {
+		return nil
+	}
+	trace, _ := ctx.Value(traceKey{}).(*Trace)
+	return trace
+}
+
+// Add 记录一次调用
+func (t *Trace) Add(kind, name string, start time.Time, duration time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	total, ok := t.totals[kind]
+	if !ok {
+		total = &traceTotal{}
+		t.totals[kind] = total
+	}
+	total.count++
+	total.total += duration
+	if len(t.spans) < maxSpans {
+		t.spans = append(t.spans, Span{Kind: kind, Name: name, Offset: start.Sub(t.start), Duration: duration})
+	}
+}
+
+// Track 开始一次调用，返回的函数在调用结束时执行
+func (t *Trace) Track(kind, name string) func() {
+	if t == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() { t.Add(kind, name, start, time.Since(start)) }
+}
+
+// LogValue 输出各类调用的次数、总耗时和最耗时的调用明细
+func (t *Trace) LogValue() slog.Value {
+	if t == nil {
+		return slog.GroupValue()
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	kinds := make([]string, 0, len(t.totals))
+	for kind := range t.totals {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	attrs := make([]slog.Attr, 0, len(kinds)+1)
+	for _, kind := range kinds {
+		total := t.totals[kind]
+		attrs = append(attrs, slog.Group(kind, "count", total.count, "total", total.total))
+	}
+
+	slowest := append([]Span(nil), t.spans...)
+	sort.SliceStable(slowest, func(i, j int) bool { return slowest[i].Duration > slowest[j].Duration })
+	if len(slowest) > slowLogSpans {
+		slowest = slowest[:slowLogSpans]
+	}
+	spans := make([]string, len(slowest))
+	for i, span := range slowest {
+		spans[i] = fmt.Sprintf("+%s %s %s (%s)", span.Offset.Round(time.Millisecond), span.Kind, span.Name, span.Duration.Round(time.Millisecond))
+	}
+	if len(spans) > 0 {
+		attrs = append(attrs, slog.Any("slowest", spans))
+	}
+	return slog.GroupValue(attrs...)
+}
@@ -0,0 +1,34 @@
+package metrics
+
+import "time"
+
+// 应用内埋点指标，转发流量和连接数等由业务模块通过NewCollector在抓取时采集
+var (
+	HTTPRequestDuration = NewHistogramVec("l2tp_http_request_duration_seconds",
+		"HTTP请求处理耗时", nil, "method", "route", "status")
+
+	SSHOperationDuration = NewHistogramVec("l2tp_ssh_operation_duration_seconds",
+		"落地机SSH操作耗时", []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}, "operation", "result")
+
+	SSHOperationFailures = NewCounterVec("l2tp_ssh_operation_failures_total",
+		"落地机SSH操作失败次数", "operation")
+
+	DBQueryDuration = NewHistogramVec("l2tp_db_query_duration_seconds",
+		"数据库语句执行耗时", []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 1}, "operation", "table")
+
+	WebSocketDroppedMessages = NewCounterVec("l2tp_websocket_dropped_messages_total",
+		"未能送达WebSocket客户端的消息数", "reason")
+
+	WebSocketEvictedClients = NewCounterVec("l2tp_websocket_evicted_clients_total",
+		"因发送队列积压被断开的WebSocket客户端数")
+)
+
+// ObserveSSH 记录SSH操作耗时，err非空时同时计入失败次数
+func ObserveSSH(operation string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+		SSHOperationFailures.Inc(operation)
+	}
+	SSHOperationDuration.Observe(time.Since(start).Seconds(), operation, result)
+}
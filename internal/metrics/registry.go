@@ -0,0 +1,258 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 指标类型
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+// DefaultBuckets 默认的耗时分桶(秒)
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// metric 可输出为Prometheus文本格式的指标
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+// Registry 指标注册表
+type Registry struct {
+	metrics []metric
+	mutex   sync.Mutex
+}
+
+// Default 默认注册表，/metrics输出其中的全部指标
+var Default = NewRegistry()
+
+// NewRegistry 创建指标注册表
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// register 注册指标
+func (r *Registry) register(m metric) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+// WriteText 以Prometheus文本格式(0.0.4)输出全部指标
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mutex.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mutex.Unlock()
+
+	buf := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(buf)
+	}
+	return buf.Flush()
+}
+
+// Sample 采集函数返回的单个样本
+type Sample struct {
+	Labels []string
+	Value  float64
+}
+
+// CounterVec 带标签的计数器
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+	values map[string]*Sample
+	mutex  sync.Mutex
+}
+
+// NewCounterVec 创建并注册计数器
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{name: name, help: help, labels: labels, values: make(map[string]*Sample)}
+	Default.register(c)
+	return c
+}
+
+// Add 增加计数
+func (c *CounterVec) Add(value float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	sample, ok := c.values[key]
+	if !ok {
+		sample = &Sample{Labels: append([]string(nil), labelValues...)}
+		c.values[key] = sample
+	}
+	sample.Value += value
+}
+
+// Inc 计数加一
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.mutex.Lock()
+	samples := make([]Sample, 0, len(c.values))
+	for _, sample := range c.values {
+		samples = append(samples, *sample)
+	}
+	c.mutex.Unlock()
+
+	writeHeader(w, c.name, c.help, TypeCounter)
+	writeSamples(w, c.name, c.labels, samples)
+}
+
+// HistogramVec 带标签的直方图
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	values  map[string]*histogramValue
+	mutex   sync.Mutex
+}
+
+// histogramValue 单组标签的直方图数据
+type histogramValue struct {
+	labels []string
+	counts []uint64 // 与buckets一一对应，非累计
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec 创建并注册直方图，buckets为空时使用DefaultBuckets
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	h := &HistogramVec{name: name, help: help, labels: labels, buckets: buckets, values: make(map[string]*histogramValue)}
+	Default.register(h)
+	return h
+}
+
+// Observe 记录一次观测值
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	hv, ok := h.values[key]
+	if !ok {
+		hv = &histogramValue{labels: append([]string(nil), labelValues...), counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hv
+	}
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		hv.counts[i]++
+	}
+	hv.count++
+	hv.sum += value
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	keys := make([]string, 0, len(h.values))
+	for key := range h.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	writeHeader(w, h.name, h.help, TypeHistogram)
+	bucketLabels := append(append([]string(nil), h.labels...), "le")
+	for _, key := range keys {
+		hv := h.values[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += hv.counts[i]
+			writeLine(w, h.name+"_bucket", bucketLabels, append(append([]string(nil), hv.labels...), formatValue(bound)), float64(cumulative))
+		}
+		writeLine(w, h.name+"_bucket", bucketLabels, append(append([]string(nil), hv.labels...), "+Inf"), float64(hv.count))
+		writeLine(w, h.name+"_sum", h.labels, hv.labels, hv.sum)
+		writeLine(w, h.name+"_count", h.labels, hv.labels, float64(hv.count))
+	}
+}
+
+// collectorFunc 抓取时通过函数采集的指标
+type collectorFunc struct {
+	name    string
+	help    string
+	typ     string
+	labels  []string
+	collect func() []Sample
+}
+
+// NewCollector 注册抓取时实时采集的指标，适合已由业务代码维护的计数和状态
+func NewCollector(name, help, typ string, labels []string, collect func() []Sample) {
+	Default.register(&collectorFunc{name: name, help: help, typ: typ, labels: labels, collect: collect})
+}
+
+func (c *collectorFunc) write(w *bufio.Writer) {
+	writeHeader(w, c.name, c.help, c.typ)
+	writeSamples(w, c.name, c.labels, c.collect())
+}
+
+// writeHeader 输出HELP和TYPE行
+func writeHeader(w *bufio.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, strings.NewReplacer("\\", `\\`, "\n", `\n`).Replace(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+}
+
+// writeSamples 按标签排序输出样本
+func writeSamples(w *bufio.Writer, name string, labels []string, samples []Sample) {
+	sort.Slice(samples, func(i, j int) bool {
+		return strings.Join(samples[i].Labels, "\xff") < strings.Join(samples[j].Labels, "\xff")
+	})
+	for _, sample := range samples {
+		writeLine(w, name, labels, sample.Labels, sample.Value)
+	}
+}
+
+// labelEscaper 转义标签值
+var labelEscaper = strings.NewReplacer("\\", `\\`, "\n", `\n`, `"`, `\"`)
+
+// writeLine 输出单行样本
+func writeLine(w *bufio.Writer, name string, labels, values []string, value float64) {
+	w.WriteString(name)
+	if len(labels) > 0 {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			var v string
+			if i < len(values) {
+				v = values[i]
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", label, labelEscaper.Replace(v))
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatValue(value))
+	w.WriteByte('\n')
+}
+
+// formatValue 格式化样本值
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
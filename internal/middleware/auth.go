@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"net/http"
 	"strings"
 
@@ -13,6 +14,10 @@ import (
 func JWTAuth(authService *services.AuthService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
+		// 浏览器WebSocket无法设置请求头，允许通过token查询参数传递令牌
+		if authHeader == "" && c.Query("token") != "" && strings.EqualFold(c.GetHeader("Upgrade"), "websocket") {
+			authHeader = "Bearer " + c.Query("token")
+		}
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"success": false,
@@ -50,7 +55,29 @@ func JWTAuth(authService *services.AuthService) gin.HandlerFunc {
 		// 将用户信息存储到上下文
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
+		c.Set("tenant_id", claims.TenantID)
+
+		c.Next()
+	}
+} 
+// StaticToken 固定令牌认证中间件，token为空时不校验(用于监控抓取等非用户访问)
+func StaticToken(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			c.Next()
+			return
+		}
+
+		provided := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"message": "无效的认证令牌",
+			})
+			c.Abort()
+			return
+		}
 
 		c.Next()
 	}
-} 
\ No newline at end of file
+}
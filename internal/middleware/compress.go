@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+// 支持的压缩编码
+const (
+	encodingBrotli = "br"
+	encodingGzip   = "gzip"
+)
+
+// brotliLevel 动态响应使用的brotli压缩级别，兼顾压缩率和CPU开销
+const brotliLevel = 5
+
+var (
+	gzipPool   = sync.Pool{New: func() interface{} { return gzip.NewWriter(io.Discard) }}
+	brotliPool = sync.Pool{New: func() interface{} { return brotli.NewWriterLevel(io.Discard, brotliLevel) }}
+)
+
+// compressibleTypes 值得压缩的Content-Type前缀
+var compressibleTypes = []string{
+	"text/",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/x-ndjson",
+	"application/yaml",
+	"image/svg+xml",
+}
+
+// compressible 响应类型是否值得压缩，图片、压缩包等已压缩的内容不再压缩
+func compressible(contentType string) bool {
+	for _, prefix := range compressibleTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptedEncoding 按Accept-Encoding的权重选择压缩编码，权重相同时优先br，都不接受时返回空字符串
+func acceptedEncoding(header string) string {
+	best, bestQuality := "", 0.0
+	for _, item := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(item, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != encodingBrotli && name != encodingGzip {
+			continue
+		}
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if q, err := strconv.ParseFloat(value, 64); err == nil {
+				quality = q
+			}
+		}
+		if quality > bestQuality || (quality == bestQuality && quality > 0 && name == encodingBrotli) {
+			best, bestQuality = name, quality
+		}
+	}
+	return best
+}
+
+// compressWriter 先缓存响应体，达到最小长度后开始压缩，响应结束时仍不足最小长度则原样输出
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	minSize  int
+	buffer   []byte
+	encoder  io.WriteCloser
+	decided  bool // 是否已确定压缩或不压缩
+}
+
+// eligible 当前响应是否可以压缩
+func (w *compressWriter) eligible() bool {
+	status := w.Status()
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusPartialContent || status == http.StatusNotModified {
+		return false
+	}
+	header := w.Header()
+	return header.Get("Content-Encoding") == "" && compressible(header.Get("Content-Type"))
+}
+
+// start 开始压缩，写入响应头并压缩已缓存的内容
+func (w *compressWriter) start() error {
+	w.decided = true
+	header := w.Header()
+	header.Set("Content-Encoding", w.encoding)
+	header.Add("Vary", "Accept-Encoding")
+	header.Del("Content-Length")
+
+	if w.encoding == encodingBrotli {
+		encoder := brotliPool.Get().(*brotli.Writer)
+		encoder.Reset(w.ResponseWriter)
+		w.encoder = encoder
+	} else {
+		encoder := gzipPool.Get().(*gzip.Writer)
+		encoder.Reset(w.ResponseWriter)
+		w.encoder = encoder
+	}
+	buffered := w.buffer
+	w.buffer = nil
+	_, err := w.encoder.Write(buffered)
+	return err
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		if !w.eligible() {
+			w.decided = true
+			w.Header().Add("Vary", "Accept-Encoding")
+			return w.ResponseWriter.Write(data)
+		}
+		w.buffer = append(w.buffer, data...)
+		if len(w.buffer) < w.minSize {
+			return len(data), nil
+		}
+		if err := w.start(); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush 流式响应刷新时立即开始压缩并输出已压缩的内容
+func (w *compressWriter) Flush() {
+	if !w.decided && len(w.buffer) > 0 {
+		if err := w.start(); err != nil {
+			return
+		}
+	}
+	if flusher, ok := w.encoder.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// finish 结束响应：关闭压缩器，或原样输出不足最小长度的内容
+func (w *compressWriter) finish() {
+	if w.encoder == nil {
+		if len(w.buffer) > 0 {
+			w.ResponseWriter.Write(w.buffer)
+		}
+		return
+	}
+	w.encoder.Close()
+	switch encoder := w.encoder.(type) {
+	case *brotli.Writer:
+		encoder.Reset(io.Discard)
+		brotliPool.Put(encoder)
+	case *gzip.Writer:
+		encoder.Reset(io.Discard)
+		gzipPool.Put(encoder)
+	}
+}
+
+// Compress 按Accept-Encoding以br或gzip压缩文本类响应(JSON、HTML、JS、CSS等)，
+// 小于minSize字节的响应不压缩；WebSocket握手和HEAD请求不处理
+func Compress(minSize int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		encoding := acceptedEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" || c.Request.Method == http.MethodHead || c.GetHeader("Upgrade") != "" {
+			c.Next()
+			return
+		}
+
+		writer := &compressWriter{ResponseWriter: c.Writer, encoding: encoding, minSize: minSize}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+		writer.finish()
+	}
+}
@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 错误码，取值稳定，客户端据此处理错误，message只用于展示
+const (
+	ErrCodeInvalidRequest   = "invalid_request"    // 请求无效或请求体无法解析
+	ErrCodeValidation       = "validation_failed"  // 字段校验失败，详见errors
+	ErrCodeUnauthorized     = "unauthorized"       // 未登录或令牌无效
+	ErrCodeForbidden        = "forbidden"          // 无权限
+	ErrCodeNotFound         = "not_found"          // 资源不存在
+	ErrCodeMethodNotAllowed = "method_not_allowed" // 请求方法不支持
+	ErrCodeNotAcceptable    = "not_acceptable"     // 不支持请求的API版本或媒体类型
+	ErrCodeConflict         = "conflict"           // 与当前状态冲突，如资源已存在或操作进行中
+	ErrCodeTooLarge         = "payload_too_large"  // 请求体过大
+	ErrCodeUnprocessable    = "unprocessable"      // 请求格式正确但无法处理，如幂等键被不同请求复用
+	ErrCodeRateLimited      = "rate_limited"       // 请求过于频繁
+	ErrCodeInternal         = "internal_error"     // 服务器内部错误
+	ErrCodeBadGateway       = "bad_gateway"        // 落地机、中转节点等上游操作失败
+	ErrCodeUnavailable      = "unavailable"        // 服务暂不可用，如备用节点或维护中
+)
+
+// statusErrorCodes HTTP状态码对应的默认错误码
+var statusErrorCodes = map[int]string{
+	http.StatusBadRequest:            ErrCodeInvalidRequest,
+	http.StatusUnauthorized:          ErrCodeUnauthorized,
+	http.StatusForbidden:             ErrCodeForbidden,
+	http.StatusNotFound:              ErrCodeNotFound,
+	http.StatusMethodNotAllowed:      ErrCodeMethodNotAllowed,
+	http.StatusNotAcceptable:         ErrCodeNotAcceptable,
+	http.StatusConflict:              ErrCodeConflict,
+	http.StatusRequestEntityTooLarge: ErrCodeTooLarge,
+	http.StatusUnprocessableEntity:   ErrCodeUnprocessable,
+	http.StatusTooManyRequests:       ErrCodeRateLimited,
+	http.StatusInternalServerError:   ErrCodeInternal,
+	http.StatusBadGateway:            ErrCodeBadGateway,
+	http.StatusServiceUnavailable:    ErrCodeUnavailable,
+}
+
+// StatusErrorCode HTTP状态码对应的默认错误码
+func StatusErrorCode(status int) string {
+	if code, ok := statusErrorCodes[status]; ok {
+		return code
+	}
+	if status >= 500 {
+		return ErrCodeInternal
+	}
+	return ErrCodeInvalidRequest
+}
+
+// errorCodeWriter 缓存错误状态的JSON响应体，以便补充错误码
+type errorCodeWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+// buffering 是否缓存当前响应
+func (w *errorCodeWriter) buffering() bool {
+	return w.Status() >= 400 && strings.HasPrefix(w.Header().Get("Content-Type"), "application/json")
+}
+
+func (w *errorCodeWriter) Write(data []byte) (int, error) {
+	if w.buffering() {
+		return w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *errorCodeWriter) WriteString(s string) (int, error) {
+	if w.buffering() {
+		return w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// ErrorCodes 为未指定错误码的JSON错误响应({"success":false,...})按HTTP状态码补充code字段，
+// 使所有接口的错误都带有稳定的机器可读错误码
+func ErrorCodes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		writer := &errorCodeWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		if writer.body.Len() == 0 {
+			return
+		}
+		body := writer.body.Bytes()
+		writer.ResponseWriter.Write(withErrorCode(body, writer.Status()))
+	}
+}
+
+// withErrorCode 在错误响应体末尾补充code字段，已有code或不是错误信封时原样返回
+func withErrorCode(body []byte, status int) []byte {
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return body
+	}
+	if _, ok := envelope["code"]; ok || string(envelope["success"]) != "false" {
+		return body
+	}
+	trimmed := bytes.TrimRight(body, " \r\n")
+	if !bytes.HasSuffix(trimmed, []byte("}")) {
+		return body
+	}
+	code, _ := json.Marshal(StatusErrorCode(status))
+	result := append([]byte{}, trimmed[:len(trimmed)-1]...)
+	result = append(result, `,"code":`...)
+	result = append(result, code...)
+	return append(result, '}')
+}
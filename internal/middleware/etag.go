@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// etagWriter 缓存GET请求的成功响应以计算ETag，超过上限后不再缓存，直接输出
+type etagWriter struct {
+	gin.ResponseWriter
+	maxSize  int
+	body     bytes.Buffer
+	bypassed bool
+}
+
+// buffering 是否缓存当前响应：只处理200响应，处理器已自行设置ETag时(如静态文件)不处理
+func (w *etagWriter) buffering() bool {
+	if w.bypassed {
+		return false
+	}
+	if w.Status() != http.StatusOK || w.Header().Get("ETag") != "" {
+		w.bypass()
+		return false
+	}
+	return true
+}
+
+// bypass 放弃计算ETag，输出已缓存的内容
+func (w *etagWriter) bypass() {
+	w.bypassed = true
+	if w.body.Len() > 0 {
+		w.ResponseWriter.Write(w.body.Bytes())
+		w.body.Reset()
+	}
+}
+
+func (w *etagWriter) Write(data []byte) (int, error) {
+	if !w.buffering() {
+		return w.ResponseWriter.Write(data)
+	}
+	if w.body.Len()+len(data) > w.maxSize {
+		w.bypass()
+		return w.ResponseWriter.Write(data)
+	}
+	return w.body.Write(data)
+}
+
+func (w *etagWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush 流式响应不计算ETag
+func (w *etagWriter) Flush() {
+	if !w.bypassed {
+		w.bypass()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// etagMatch If-None-Match请求头是否包含指定ETag(弱比较)
+func etagMatch(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ETag 为GET请求的成功响应(不超过maxSize字节)按内容生成弱ETag，
+// If-None-Match匹配时返回304，客户端可复用缓存的服务器列表、流量历史等较大的响应
+func ETag(maxSize int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet || c.GetHeader("Upgrade") != "" {
+			c.Next()
+			return
+		}
+
+		writer := &etagWriter{ResponseWriter: c.Writer, maxSize: maxSize}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		if writer.bypassed || writer.body.Len() == 0 {
+			return
+		}
+		sum := sha256.Sum256(writer.body.Bytes())
+		etag := `W/"` + hex.EncodeToString(sum[:12]) + `"`
+		header := writer.Header()
+		header.Set("ETag", etag)
+		if header.Get("Cache-Control") == "" {
+			// 每次使用前向服务器验证，内容未变时只返回304
+			header.Set("Cache-Control", "private, no-cache")
+		}
+		if etagMatch(c.GetHeader("If-None-Match"), etag) {
+			header.Del("Content-Type")
+			header.Del("Content-Length")
+			writer.WriteHeader(http.StatusNotModified)
+			writer.WriteHeaderNow()
+			return
+		}
+		writer.ResponseWriter.Write(writer.body.Bytes())
+	}
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"bytes"
+	"strings"
+
+	"l2tp-manager/internal/i18n"
+
+	"github.com/gin-gonic/gin"
+)
+
+// localizeWriter 缓存需要翻译的JSON响应体
+type localizeWriter struct {
+	gin.ResponseWriter
+	resolve  func() string
+	language string
+	body     bytes.Buffer
+}
+
+// buffering 是否缓存当前响应：只翻译JSON响应，语言在首次写入时确定(此时已完成认证，可读取用户偏好)
+func (w *localizeWriter) buffering() bool {
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		return false
+	}
+	if w.language == "" {
+		w.language = w.resolve()
+		w.Header().Set("Content-Language", w.language)
+		w.Header().Add("Vary", "Accept-Language")
+	}
+	return w.language != i18n.Default
+}
+
+func (w *localizeWriter) Write(data []byte) (int, error) {
+	if w.buffering() {
+		return w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *localizeWriter) WriteString(s string) (int, error) {
+	if w.buffering() {
+		return w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// RequestLanguage 请求使用的语言：已登录用户设置了界面语言时使用该语言，否则按Accept-Language协商
+func RequestLanguage(c *gin.Context, preference func(userID uint) string) string {
+	if userID := c.GetUint("user_id"); userID != 0 && preference != nil {
+		if lang := preference(userID); lang != "" {
+			return lang
+		}
+	}
+	return i18n.Negotiate(c.GetHeader("Accept-Language"))
+}
+
+// Localize 按请求语言翻译JSON响应的message字段(含字段校验错误)，消息原文为中文，
+// 没有译文的消息保持原文。preference返回用户设置的界面语言，为空表示未设置
+func Localize(preference func(userID uint) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		writer := &localizeWriter{ResponseWriter: c.Writer}
+		writer.resolve = func() string { return RequestLanguage(c, preference) }
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		if writer.body.Len() == 0 {
+			return
+		}
+		writer.ResponseWriter.Write(i18n.TranslateJSON(writer.language, writer.body.Bytes()))
+	}
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"l2tp-manager/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// idempotencyWriter 记录处理器输出的响应内容，同时正常输出
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Idempotency 操作接口的幂等键：请求携带Idempotency-Key时，24小时内同一幂等键的重试
+// 不再执行操作，直接返回首次的响应并带Idempotent-Replayed头，避免客户端网络重试重复触发重启等操作。
+// 幂等键按租户和用户隔离，按方法、路径和请求体区分，用于不同的请求时返回422，首次请求仍在处理时返回409
+func Idempotency(l2tp *services.L2TPService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		// 读取的请求体交给处理器按gin.BodyBytesKey复用
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "读取请求内容失败",
+			})
+			return
+		}
+		c.Set(gin.BodyBytesKey, body)
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		owner := services.IdempotencyOwner{TenantID: c.GetUint("tenant_id"), UserID: c.GetUint("user_id")}
+		request := c.Request.Method + " " + c.Request.URL.Path + "\n" + string(body)
+		replay, err := l2tp.BeginIdempotentAction(owner, key, services.HashRequest([]byte(request)))
+		switch {
+		case errors.Is(err, services.ErrIdempotencyMismatch):
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"success": false, "message": err.Error()})
+			return
+		case errors.Is(err, services.ErrIdempotencyPending):
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"success": false, "message": err.Error()})
+			return
+		case err != nil:
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+			return
+		case replay != nil:
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(replay.Status, "application/json; charset=utf-8", replay.Body)
+			c.Abort()
+			return
+		}
+
+		writer := &idempotencyWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		if err := l2tp.FinishIdempotentAction(owner, key, writer.Status(), writer.body.Bytes()); err != nil {
+			slog.Error("记录幂等响应失败", "key", key, "error", err)
+		}
+	}
+}
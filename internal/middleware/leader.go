@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PanelRoleHeader 高可用模式下标识响应实例角色的响应头
+const PanelRoleHeader = "X-Panel-Role"
+
+// LeaderOnly 高可用模式下只有主节点处理请求，备用节点对除探针路径外的请求返回503，
+// 负载均衡器据此(或/readyz)将流量切到主节点，中转节点也会重连到主节点
+func LeaderOnly(isLeader func() bool, probePaths ...string) gin.HandlerFunc {
+	probes := make(map[string]bool, len(probePaths))
+	for _, path := range probePaths {
+		probes[path] = true
+	}
+	return func(c *gin.Context) {
+		if isLeader() {
+			c.Header(PanelRoleHeader, "leader")
+			c.Next()
+			return
+		}
+		c.Header(PanelRoleHeader, "standby")
+		if probes[c.Request.URL.Path] {
+			c.Next()
+			return
+		}
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"success": false,
+			"message": "当前实例为备用节点，请访问主节点",
+		})
+		c.Abort()
+	}
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/url"
+	"time"
+
+	"l2tp-manager/internal/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestLogger 访问日志：使用结构化日志记录每个请求的方法、路径、状态码、耗时、用户和请求/响应大小，
+// 替代gin默认的文本日志。耗时超过慢请求阈值时以警告级别输出，附带查询参数、处理错误
+// 以及请求期间SSH连接/命令和数据库语句的次数、总耗时和最耗时的调用
+func RequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		trace := logger.NewTrace()
+		c.Request = c.Request.WithContext(logger.WithTrace(c.Request.Context(), trace))
+		c.Next()
+
+		latency := time.Since(start)
+		status := c.Writer.Status()
+		attrs := []any{
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", status,
+			"latency", latency,
+			"client_ip", c.ClientIP(),
+			"user", c.GetString("username"),
+			"bytes_in", max(c.Request.ContentLength, 0),
+			"bytes_out", max(c.Writer.Size(), 0),
+		}
+
+		level, message := slog.LevelInfo, "HTTP请求"
+		// WebSocket等长连接的耗时是连接时长，不按慢请求处理
+		if logger.IsSlow(latency) && c.GetHeader("Upgrade") == "" {
+			level, message = slog.LevelWarn, "慢请求"
+			attrs = append(attrs, "route", c.FullPath(), "query", redactQuery(c.Request.URL.Query()), "trace", trace)
+			if len(c.Errors) > 0 {
+				attrs = append(attrs, "errors", c.Errors.String())
+			}
+		}
+		if status >= 500 {
+			level = slog.LevelError
+		}
+		slog.Log(c.Request.Context(), level, message, attrs...)
+	}
+}
+
+// sensitiveParams 日志中隐去取值的查询参数
+var sensitiveParams = []string{"token", "secret", "password"}
+
+// redactQuery 编码查询参数，隐去令牌等敏感取值
+func redactQuery(query url.Values) string {
+	for _, name := range sensitiveParams {
+		if query.Has(name) {
+			query.Set(name, "***")
+		}
+	}
+	return query.Encode()
+}
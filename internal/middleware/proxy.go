@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// unixPeerIP 监听Unix套接字时请求没有对端IP，视为来自本机
+const unixPeerIP = "127.0.0.1"
+
+// RealIP 解析真实客户端IP：只有直接对端属于可信代理时，才从X-Forwarded-For中自右向左跳过可信代理取得客户端IP，
+// 没有该头时使用X-Real-IP；否则使用对端IP，伪造的转发头一律忽略。解析结果写回Request.RemoteAddr，
+// 之后的c.ClientIP()、审计和登录记录均使用该IP，因此gin自身不应再信任任何代理
+func RealIP(trustedProxies []string) gin.HandlerFunc {
+	var trusted []*net.IPNet
+	for _, proxy := range trustedProxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			slog.Warn("忽略无效的可信代理", "proxy", proxy, "error", err)
+			continue
+		}
+		trusted = append(trusted, network)
+	}
+
+	isTrusted := func(ip net.IP) bool {
+		for _, network := range trusted {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(c *gin.Context) {
+		c.Request.RemoteAddr = net.JoinHostPort(resolveClientIP(c.Request, isTrusted), "0")
+		c.Next()
+	}
+}
+
+// resolveClientIP 按可信代理规则解析客户端IP
+func resolveClientIP(r *http.Request, isTrusted func(net.IP) bool) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = unixPeerIP
+	}
+	peer := net.ParseIP(host)
+	if peer == nil || !isTrusted(peer) {
+		return host
+	}
+
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				break // 格式错误的转发链，不再向前采信
+			}
+			if i == 0 || !isTrusted(ip) {
+				return ip.String()
+			}
+		}
+		return peer.String()
+	}
+
+	if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+	return peer.String()
+}
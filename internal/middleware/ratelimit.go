@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// 空闲超过bucketIdle的令牌桶在清理时移除，清理间隔为bucketPruneInterval
+const (
+	bucketIdle          = 10 * time.Minute
+	bucketPruneInterval = time.Minute
+)
+
+// bucket 一个用户或IP的令牌桶
+type bucket struct {
+	limiter   *rate.Limiter
+	perMinute int
+	lastSeen  time.Time
+}
+
+// rateLimiter 一组接口共用的令牌桶，按用户和客户端IP分别计数
+type rateLimiter struct {
+	perMinute func() int
+	buckets   map[string]*bucket
+	lastPrune time.Time
+	mutex     sync.Mutex
+}
+
+// burst 令牌桶容量：每分钟次数的四分之一，至少为1
+func burst(perMinute int) int {
+	return max(perMinute/4, 1)
+}
+
+// reserve 从key对应的令牌桶取一个令牌，需持有锁
+func (l *rateLimiter) reserve(key string, perMinute int, now time.Time) *rate.Reservation {
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(rate.Limit(float64(perMinute)/60), burst(perMinute)), perMinute: perMinute}
+		l.buckets[key] = b
+	} else if b.perMinute != perMinute {
+		// 设置修改后已有的令牌桶按新速率继续计数
+		b.limiter.SetLimitAt(now, rate.Limit(float64(perMinute)/60))
+		b.limiter.SetBurstAt(now, burst(perMinute))
+		b.perMinute = perMinute
+	}
+	b.lastSeen = now
+	return b.limiter.ReserveN(now, 1)
+}
+
+// prune 移除长时间未使用的令牌桶，需持有锁
+func (l *rateLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < bucketPruneInterval {
+		return
+	}
+	l.lastPrune = now
+	for key, b := range l.buckets {
+		if now.Sub(b.lastSeen) > bucketIdle {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// allow 同时检查用户和IP的令牌桶，都有令牌时放行；否则退还已取的令牌并返回需要等待的时间
+func (l *rateLimiter) allow(keys []string, perMinute int) (bool, time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	l.prune(now)
+	reservations := make([]*rate.Reservation, 0, len(keys))
+	var wait time.Duration
+	for _, key := range keys {
+		r := l.reserve(key, perMinute, now)
+		reservations = append(reservations, r)
+		wait = max(wait, r.DelayFrom(now))
+	}
+	if wait == 0 {
+		return true, 0
+	}
+	for _, r := range reservations {
+		r.CancelAt(now)
+	}
+	return false, wait
+}
+
+// RateLimit 按令牌桶限制接口的调用频率：每个登录用户和每个客户端IP每分钟最多perMinute次，
+// 允许四分之一的突发。perMinute在每次请求时读取，返回0表示不限制。
+// 超出时返回429并在Retry-After中给出需要等待的秒数，同一组接口应共用一个RateLimit实例
+func RateLimit(perMinute func() int) gin.HandlerFunc {
+	limiter := &rateLimiter{perMinute: perMinute, buckets: make(map[string]*bucket)}
+	return func(c *gin.Context) {
+		limit := limiter.perMinute()
+		if limit <= 0 {
+			c.Next()
+			return
+		}
+
+		keys := []string{"ip:" + c.ClientIP()}
+		if userID := c.GetUint("user_id"); userID != 0 {
+			keys = append(keys, "user:"+strconv.FormatUint(uint64(userID), 10))
+		}
+		if ok, wait := limiter.allow(keys, limit); !ok {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("请求过于频繁，请 %d 秒后重试", retryAfter),
+			})
+			return
+		}
+		c.Next()
+	}
+}
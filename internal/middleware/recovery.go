@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+
+	"l2tp-manager/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Recovery 捕获处理器中的panic，经reporter输出调用栈日志并上报，向客户端返回统一格式的500响应，
+// 不输出gin默认的调用栈。客户端已断开连接导致的写入panic只中止请求，不上报。
+// 应放在全局中间件的最后，使访问日志、错误码等中间件仍能处理该响应
+func Recovery(reporter *services.ErrorReporter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if brokenPipe(recovered) {
+				c.Error(recovered.(error))
+				c.Abort()
+				return
+			}
+
+			report := services.NewPanicReport(c.Request.Context(), "http", recovered)
+			report.Tags = map[string]string{
+				"method": c.Request.Method,
+				"route":  c.FullPath(),
+				"user":   c.GetString("username"),
+			}
+			reporter.Report(report)
+
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "服务器内部错误",
+			})
+		}()
+		c.Next()
+	}
+}
+
+// brokenPipe 是否为客户端断开连接后写入响应导致的panic
+func brokenPipe(recovered interface{}) bool {
+	err, ok := recovered.(error)
+	if !ok {
+		return false
+	}
+	var opErr *net.OpError
+	var syscallErr *os.SyscallError
+	if errors.As(err, &opErr) && errors.As(opErr.Err, &syscallErr) {
+		return errors.Is(syscallErr.Err, syscall.EPIPE) || errors.Is(syscallErr.Err, syscall.ECONNRESET)
+	}
+	return errors.Is(err, http.ErrAbortHandler)
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"l2tp-manager/internal/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader 请求ID请求头/响应头
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID 为每个请求分配请求ID(沿用客户端传入的值)，写入响应头和请求上下文
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if id == "" || len(id) > 64 {
+			id = logger.NewRequestID()
+		}
+
+		c.Set("request_id", id)
+		c.Header(RequestIDHeader, id)
+		c.Request = c.Request.WithContext(logger.WithRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"l2tp-manager/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TenantAccess 租户被删除或停用后拒绝其用户访问，需在JWTAuth之后使用
+func TenantAccess(tenants *services.TenantService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := tenants.Active(c.GetUint("tenant_id")); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// SuperAdmin 只允许平台超级管理员(不属于任何租户的用户)访问，用于系统设置、全局资源和租户管理
+func SuperAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetUint("tenant_id") != 0 {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"message": "需要平台管理员权限",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// TenantServer 租户用户只能访问自己的服务器：路径参数id指定的服务器不属于该租户时按不存在处理(404)
+func TenantServer(tenants *services.TenantService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenantID := c.GetUint("tenant_id")
+		param := c.Param("id")
+		if tenantID == 0 || param == "" {
+			c.Next()
+			return
+		}
+
+		id, err := strconv.ParseUint(param, 10, 32)
+		if err != nil || !tenants.OwnsServer(tenantID, uint(id)) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "服务器不存在",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// API版本
+const (
+	CurrentAPIVersion = 1
+	APIVersionHeader  = "X-API-Version"
+)
+
+// SupportedAPIVersions 当前支持的API版本
+var SupportedAPIVersions = []int{1}
+
+// vendorMediaType 匹配Accept中的版本化媒体类型，如 application/vnd.l2tp.v1+json
+var vendorMediaType = regexp.MustCompile(`application/vnd\.l2tp\.v(\d+)\+json`)
+
+// APIVersion 版本协商中间件。请求可通过X-API-Version请求头或Accept媒体类型指定版本，
+// pathVersion为路径中的版本号(/api/v1)，为0表示旧版无版本路径，按协商结果或当前版本处理
+func APIVersion(pathVersion int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requested, err := requestedAPIVersion(c)
+		if err != nil {
+			abortVersion(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		version := pathVersion
+		switch {
+		case requested == 0 && version == 0:
+			version = CurrentAPIVersion
+		case requested != 0 && version == 0:
+			version = requested
+		case requested != 0 && requested != version:
+			abortVersion(c, http.StatusBadRequest, fmt.Sprintf("请求的API版本 v%d 与路径版本 v%d 不一致", requested, version))
+			return
+		}
+
+		if !supportedAPIVersion(version) {
+			abortVersion(c, http.StatusNotAcceptable, fmt.Sprintf("不支持的API版本: v%d", version))
+			return
+		}
+
+		c.Set("api_version", version)
+		c.Header(APIVersionHeader, strconv.Itoa(version))
+		c.Next()
+	}
+}
+
+// Deprecated 为旧版无版本路径添加弃用响应头，指向对应的版本化路径
+func Deprecated(legacyPrefix, successorPrefix, sunset string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		successor := c.GetString("base_path") + successorPrefix + strings.TrimPrefix(c.Request.URL.Path, legacyPrefix)
+		c.Header("Deprecation", "true")
+		c.Header("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successor))
+		if sunset != "" {
+			c.Header("Sunset", sunset)
+		}
+		c.Next()
+	}
+}
+
+// GetAPIVersion 获取本次请求协商后的API版本
+func GetAPIVersion(c *gin.Context) int {
+	if version, ok := c.Get("api_version"); ok {
+		return version.(int)
+	}
+	return CurrentAPIVersion
+}
+
+// requestedAPIVersion 解析客户端请求的版本，未指定时返回0
+func requestedAPIVersion(c *gin.Context) (int, error) {
+	if header := strings.TrimPrefix(strings.TrimSpace(c.GetHeader(APIVersionHeader)), "v"); header != "" {
+		version, err := strconv.Atoi(header)
+		if err != nil || version <= 0 {
+			return 0, fmt.Errorf("无效的API版本: %s", header)
+		}
+		return version, nil
+	}
+	if match := vendorMediaType.FindStringSubmatch(c.GetHeader("Accept")); match != nil {
+		version, _ := strconv.Atoi(match[1])
+		return version, nil
+	}
+	return 0, nil
+}
+
+// supportedAPIVersion 检查版本是否受支持
+func supportedAPIVersion(version int) bool {
+	for _, v := range SupportedAPIVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// abortVersion 返回版本协商错误
+func abortVersion(c *gin.Context, status int, message string) {
+	c.JSON(status, gin.H{
+		"success": false,
+		"message": message,
+	})
+	c.Abort()
+}
@@ -0,0 +1,412 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Param 查询、路径或请求头参数
+type Param struct {
+	Name        string `json:"name"`
+	In          string `json:"in"` // query/path/header
+	Type        string `json:"-"`  // string/integer/boolean
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// Query 创建查询参数
+func Query(name, typ, description string) Param {
+	return Param{Name: name, In: "query", Type: typ, Description: description}
+}
+
+// Header 创建请求头参数
+func Header(name, typ, description string) Param {
+	return Param{Name: name, In: "header", Type: typ, Description: description}
+}
+
+// Path 创建路径参数
+func Path(name, typ, description string) Param {
+	return Param{Name: name, In: "path", Type: typ, Description: description, Required: true}
+}
+
+// Operation 单个接口的文档描述
+type Operation struct {
+	Method      string
+	Path        string // gin格式路径，如 /api/servers/:id
+	Tag         string
+	Summary     string
+	Description string
+	Public      bool        // 无需JWT认证
+	Params      []Param     // 路径参数未声明时按字符串自动生成
+	Body        interface{} // JSON请求体示例类型
+	Upload      string      // multipart上传的文件字段名
+	Response    interface{} // ApiResponse.data的类型，nil表示无数据
+	Paged       bool        // 响应为PagedResponse分页结构
+	Raw         bool        // 响应不使用ApiResponse包装，直接返回Response类型
+	Produces    string      // 非JSON响应的Content-Type(文件下载等)
+}
+
+// Spec 接口文档注册表，路由注册时同步登记
+type Spec struct {
+	title      string
+	version    string
+	basePath   string // 子路径部署时接口路径的前缀
+	operations []Operation
+	mutex      sync.Mutex
+}
+
+// NewSpec 创建接口文档注册表
+func NewSpec(title, version string) *Spec {
+	return &Spec{title: title, version: version}
+}
+
+// SetBasePath 设置子路径部署时接口路径的前缀，文档中以servers声明
+func (s *Spec) SetBasePath(prefix string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.basePath = prefix
+}
+
+// Add 登记接口
+func (s *Spec) Add(op Operation) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.operations = append(s.operations, op)
+}
+
+// Operations 返回已登记的接口
+func (s *Spec) Operations() []Operation {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]Operation(nil), s.operations...)
+}
+
+// ginParamPattern 匹配gin路径参数
+var ginParamPattern = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+
+// Document 生成OpenAPI 3文档
+func (s *Spec) Document() map[string]interface{} {
+	gen := &schemaGenerator{schemas: make(map[string]interface{}), names: make(map[reflect.Type]string)}
+	paths := make(map[string]map[string]interface{})
+	tags := []string{}
+	seenTags := make(map[string]bool)
+
+	for _, op := range s.Operations() {
+		path := ginParamPattern.ReplaceAllString(op.Path, "{$1}")
+		if paths[path] == nil {
+			paths[path] = make(map[string]interface{})
+		}
+		if op.Tag != "" && !seenTags[op.Tag] {
+			seenTags[op.Tag] = true
+			tags = append(tags, op.Tag)
+		}
+		paths[path][strings.ToLower(op.Method)] = gen.operation(op)
+	}
+
+	tagList := make([]map[string]string, 0, len(tags))
+	for _, tag := range tags {
+		tagList = append(tagList, map[string]string{"name": tag})
+	}
+
+	document := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]string{
+			"title":   s.title,
+			"version": s.version,
+		},
+		"tags":  tagList,
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": gen.schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]string{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+	}
+	s.mutex.Lock()
+	if s.basePath != "" {
+		document["servers"] = []map[string]string{{"url": s.basePath}}
+	}
+	s.mutex.Unlock()
+	return document
+}
+
+// schemaGenerator 通过反射生成JSON Schema，具名结构体放入components
+type schemaGenerator struct {
+	schemas map[string]interface{}
+	names   map[reflect.Type]string
+}
+
+// operation 生成单个接口的文档
+func (g *schemaGenerator) operation(op Operation) map[string]interface{} {
+	doc := map[string]interface{}{
+		"summary":     op.Summary,
+		"operationId": operationID(op),
+	}
+	if op.Description != "" {
+		doc["description"] = op.Description
+	}
+	if op.Tag != "" {
+		doc["tags"] = []string{op.Tag}
+	}
+	if !op.Public {
+		doc["security"] = []map[string][]string{{"bearerAuth": {}}}
+	}
+
+	declared := make(map[string]bool)
+	params := []map[string]interface{}{}
+	for _, p := range op.Params {
+		declared[p.Name] = true
+		params = append(params, paramDoc(p))
+	}
+	for _, match := range ginParamPattern.FindAllStringSubmatch(op.Path, -1) {
+		if !declared[match[1]] {
+			params = append(params, paramDoc(Path(match[1], "string", "")))
+		}
+	}
+	if len(params) > 0 {
+		doc["parameters"] = params
+	}
+
+	switch {
+	case op.Upload != "":
+		doc["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"multipart/form-data": map[string]interface{}{
+					"schema": map[string]interface{}{
+						"type":       "object",
+						"required":   []string{op.Upload},
+						"properties": map[string]interface{}{op.Upload: map[string]string{"type": "string", "format": "binary"}},
+					},
+				},
+			},
+		}
+	case op.Body != nil:
+		doc["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": g.schemaOf(reflect.TypeOf(op.Body))},
+			},
+		}
+	}
+
+	var content map[string]interface{}
+	switch {
+	case op.Produces != "":
+		content = map[string]interface{}{
+			op.Produces: map[string]interface{}{"schema": map[string]string{"type": "string", "format": "binary"}},
+		}
+	case op.Raw:
+		content = map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": g.schemaOf(reflect.TypeOf(op.Response))},
+		}
+	default:
+		envelope := map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"success": map[string]string{"type": "boolean"},
+				"message": map[string]string{"type": "string"},
+			},
+		}
+		properties := envelope["properties"].(map[string]interface{})
+		if op.Response != nil {
+			properties["data"] = g.schemaOf(reflect.TypeOf(op.Response))
+		}
+		if op.Paged {
+			properties["total"] = map[string]string{"type": "integer"}
+			properties["page"] = map[string]string{"type": "integer"}
+			properties["page_size"] = map[string]string{"type": "integer"}
+		}
+		content = map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": envelope},
+		}
+	}
+	errorContent := map[string]interface{}{
+		"application/json": map[string]interface{}{"schema": g.errorSchema()},
+	}
+	doc["responses"] = map[string]interface{}{
+		"200":     map[string]interface{}{"description": "成功", "content": content},
+		"400":     map[string]interface{}{"description": "请求参数错误，code为invalid_request或validation_failed", "content": errorContent},
+		"default": map[string]interface{}{"description": "错误，code为稳定的机器可读错误码", "content": errorContent},
+	}
+	return doc
+}
+
+// errorSchema 错误响应Schema，放入components只生成一次
+func (g *schemaGenerator) errorSchema() interface{} {
+	if _, ok := g.schemas["ErrorResponse"]; !ok {
+		g.schemas["ErrorResponse"] = map[string]interface{}{
+			"type":     "object",
+			"required": []string{"success", "message", "code"},
+			"properties": map[string]interface{}{
+				"success": map[string]interface{}{"type": "boolean", "enum": []bool{false}},
+				"message": map[string]string{"type": "string"},
+				"code":    map[string]string{"type": "string", "description": "错误码，如 invalid_request、validation_failed、unauthorized、not_found、conflict"},
+				"errors": map[string]interface{}{
+					"type": "array",
+					"items": map[string]interface{}{
+						"type":     "object",
+						"required": []string{"field", "rule", "message"},
+						"properties": map[string]interface{}{
+							"field":   map[string]string{"type": "string"},
+							"rule":    map[string]string{"type": "string"},
+							"message": map[string]string{"type": "string"},
+						},
+					},
+				},
+			},
+		}
+	}
+	return map[string]string{"$ref": "#/components/schemas/ErrorResponse"}
+}
+
+// paramDoc 生成参数文档
+func paramDoc(p Param) map[string]interface{} {
+	doc := map[string]interface{}{
+		"name":   p.Name,
+		"in":     p.In,
+		"schema": map[string]string{"type": p.Type},
+	}
+	if p.Description != "" {
+		doc["description"] = p.Description
+	}
+	if p.Required {
+		doc["required"] = true
+	}
+	return doc
+}
+
+// operationID 由方法和路径生成唯一的操作ID
+func operationID(op Operation) string {
+	id := strings.ToLower(op.Method)
+	for _, part := range strings.Split(op.Path, "/") {
+		part = strings.TrimLeft(part, ":*")
+		if part == "" || part == "api" || part == "v1" {
+			continue
+		}
+		for _, word := range strings.FieldsFunc(part, func(r rune) bool { return r == '-' || r == '_' }) {
+			id += strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return id
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// schemaOf 生成类型的JSON Schema
+func (g *schemaGenerator) schemaOf(t reflect.Type) interface{} {
+	if t == nil {
+		return map[string]interface{}{}
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		return map[string]string{"type": "string", "format": "date-time"}
+	}
+	// 自定义JSON序列化的类型(如gorm.DeletedAt)无法可靠推断
+	if t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType) {
+		return map[string]interface{}{"nullable": true}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]string{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]string{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]string{"type": "number"}
+	case reflect.String:
+		return map[string]string{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]string{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		return map[string]string{"$ref": "#/components/schemas/" + g.register(t)}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// register 将具名结构体放入components，重名时加包名前缀
+func (g *schemaGenerator) register(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+
+	name := t.Name()
+	if _, taken := g.schemas[name]; taken {
+		pkg := t.PkgPath()
+		name = pkg[strings.LastIndex(pkg, "/")+1:] + "." + name
+	}
+	g.names[t] = name
+	g.schemas[name] = map[string]interface{}{} // 占位，支持递归类型
+	g.schemas[name] = g.structSchema(t)
+	return name
+}
+
+// structSchema 生成结构体的对象Schema，匿名嵌入字段展开
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+	g.collectFields(t, properties, &required)
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema
+}
+
+// collectFields 收集结构体的JSON字段
+func (g *schemaGenerator) collectFields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				g.collectFields(embedded, properties, required)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = g.schemaOf(field.Type)
+		if strings.Contains(field.Tag.Get("binding"), "required") {
+			*required = append(*required, name)
+		}
+	}
+}
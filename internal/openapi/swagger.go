@@ -0,0 +1,41 @@
+package openapi
+
+import "strings"
+
+// swaggerPage Swagger UI页面模板，静态资源来自CDN
+const swaggerPage = `<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>{{title}} - API文档</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+<script>
+window.onload = function () {
+  window.ui = SwaggerUIBundle({
+    url: "{{spec}}",
+    dom_id: "#swagger-ui",
+    persistAuthorization: true,
+    requestInterceptor: function (req) {
+      // 复用管理面板登录后保存的令牌
+      var token = localStorage.getItem("l2tp_token");
+      if (token && !req.headers.Authorization) {
+        req.headers.Authorization = "Bearer " + token;
+      }
+      return req;
+    }
+  });
+};
+</script>
+</body>
+</html>
+`
+
+// SwaggerUI 生成加载指定文档地址的Swagger UI页面
+func (s *Spec) SwaggerUI(specURL string) []byte {
+	page := strings.NewReplacer("{{title}}", s.title, "{{spec}}", specURL).Replace(swaggerPage)
+	return []byte(page)
+}
@@ -0,0 +1,48 @@
+package router
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// withBasePath 子路径部署：去掉请求路径中的子路径前缀后交给gin路由，访问子路径本身时重定向到带/的地址，
+// 子路径之外的请求返回404。prefix为空时原样返回
+func withBasePath(engine *gin.Engine, prefix string) http.Handler {
+	if prefix == "" {
+		return engine
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == prefix {
+			target := prefix + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+		rest, ok := strings.CutPrefix(r.URL.Path, prefix+"/")
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		stripped := r.Clone(r.Context())
+		stripped.URL.Path = "/" + rest
+		if r.URL.RawPath != "" {
+			stripped.URL.RawPath = "/" + strings.TrimPrefix(r.URL.RawPath, prefix+"/")
+		}
+		// gin重定向(如补全末尾的/)时按此请求头拼接前缀
+		stripped.Header.Set("X-Forwarded-Prefix", prefix)
+		engine.ServeHTTP(w, stripped)
+	})
+}
+
+// basePath 记录子路径前缀，供生成面板地址、文档地址等使用
+func basePath(prefix string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("base_path", prefix)
+		c.Next()
+	}
+}
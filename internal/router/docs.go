@@ -0,0 +1,84 @@
+package router
+
+import (
+	"net/http"
+	"strings"
+
+	"l2tp-manager/internal/openapi"
+
+	"github.com/gin-gonic/gin"
+)
+
+// docGroup 同时注册gin路由和接口文档的路由组
+type docGroup struct {
+	group      *gin.RouterGroup
+	spec       *openapi.Spec
+	tag        string
+	public     bool
+	middleware []gin.HandlerFunc // 只作用于经由With注册的路由
+}
+
+// newDocGroup 创建带文档登记的路由组
+func newDocGroup(group *gin.RouterGroup, spec *openapi.Spec, tag string, public bool) *docGroup {
+	return &docGroup{group: group, spec: spec, tag: tag, public: public}
+}
+
+// With 返回在处理函数之前执行middleware的同一路由组，用于只对部分路由限速等
+func (d *docGroup) With(middleware ...gin.HandlerFunc) *docGroup {
+	scoped := *d
+	scoped.middleware = append(append([]gin.HandlerFunc(nil), d.middleware...), middleware...)
+	return &scoped
+}
+
+// handle 注册路由并登记文档
+func (d *docGroup) handle(method, path string, handler gin.HandlerFunc, op openapi.Operation) {
+	d.group.Handle(method, path, append(append([]gin.HandlerFunc(nil), d.middleware...), handler)...)
+	if d.spec == nil {
+		return
+	}
+
+	op.Method = method
+	op.Path = strings.TrimSuffix(d.group.BasePath()+path, "/")
+	if op.Tag == "" {
+		op.Tag = d.tag
+	}
+	op.Public = d.public
+	d.spec.Add(op)
+}
+
+// GET 注册GET路由
+func (d *docGroup) GET(path string, handler gin.HandlerFunc, op openapi.Operation) {
+	d.handle(http.MethodGet, path, handler, op)
+}
+
+// POST 注册POST路由
+func (d *docGroup) POST(path string, handler gin.HandlerFunc, op openapi.Operation) {
+	d.handle(http.MethodPost, path, handler, op)
+}
+
+// PUT 注册PUT路由
+func (d *docGroup) PUT(path string, handler gin.HandlerFunc, op openapi.Operation) {
+	d.handle(http.MethodPut, path, handler, op)
+}
+
+// PATCH 注册PATCH路由
+func (d *docGroup) PATCH(path string, handler gin.HandlerFunc, op openapi.Operation) {
+	d.handle(http.MethodPatch, path, handler, op)
+}
+
+// DELETE 注册DELETE路由
+func (d *docGroup) DELETE(path string, handler gin.HandlerFunc, op openapi.Operation) {
+	d.handle(http.MethodDelete, path, handler, op)
+}
+
+// serveDocs 注册OpenAPI文档和Swagger UI页面(无需JWT验证)
+func serveDocs(r *gin.Engine, spec *openapi.Spec) {
+	document := func(c *gin.Context) {
+		c.JSON(http.StatusOK, spec.Document())
+	}
+	r.GET("/api/v1/openapi.json", document)
+	r.GET("/api/openapi.json", document)
+	r.GET("/api/docs", func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", spec.SwaggerUI(c.GetString("base_path")+"/api/v1/openapi.json"))
+	})
+}
@@ -0,0 +1,28 @@
+package router
+
+import (
+	"net/http/pprof"
+
+	"github.com/gin-gonic/gin"
+)
+
+// servePprof 在group下注册 /debug/pprof/ 性能分析接口。接口不登记文档，
+// 访问权限与所在路由组相同
+func servePprof(group *gin.RouterGroup) {
+	group.GET("/debug/pprof/", gin.WrapF(pprof.Index))
+	group.GET("/debug/pprof/:name", func(c *gin.Context) {
+		switch name := c.Param("name"); name {
+		case "cmdline":
+			pprof.Cmdline(c.Writer, c.Request)
+		case "profile":
+			pprof.Profile(c.Writer, c.Request)
+		case "symbol":
+			pprof.Symbol(c.Writer, c.Request)
+		case "trace":
+			pprof.Trace(c.Writer, c.Request)
+		default:
+			pprof.Handler(name).ServeHTTP(c.Writer, c.Request)
+		}
+	})
+	group.POST("/debug/pprof/symbol", gin.WrapF(pprof.Symbol))
+}
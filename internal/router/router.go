@@ -2,112 +2,935 @@ package router
 
 import (
 	"embed"
+	"log/slog"
 	"net/http"
 
 	"l2tp-manager/internal/api"
+	"l2tp-manager/internal/config"
+	"l2tp-manager/internal/database"
+	"l2tp-manager/internal/logger"
 	"l2tp-manager/internal/middleware"
+	"l2tp-manager/internal/openapi"
+	"l2tp-manager/internal/services"
 
 	"github.com/gin-gonic/gin"
 )
 
 // Setup 设置路由
-func Setup(handler *api.Handler, staticFiles embed.FS) *gin.Engine {
-	r := gin.Default()
+func Setup(handler *api.Handler, staticFiles embed.FS, cfg *config.Config) http.Handler {
+	r := gin.New()
+
+	// 客户端IP由RealIP中间件按可信代理列表解析，gin自身不再采信转发头；
+	// 监听Unix套接字时对端只能是本机的反向代理
+	proxies := cfg.TrustedProxyList()
+	if cfg.UnixSocket != "" {
+		proxies = append(proxies, "127.0.0.1")
+	}
+	if err := r.SetTrustedProxies(nil); err != nil {
+		slog.Warn("设置可信代理失败", "error", err)
+	}
+
+	// 压缩不小于1KB的文本响应；不超过4MB的GET响应带ETag，内容未变时返回304。
+	// 访问日志在压缩和ETag之外，记录实际发送的响应大小。处理器中的panic由最内层的Recovery捕获，
+	// 仍经过访问日志、错误码等中间件返回500响应
+	r.Use(middleware.RealIP(proxies), middleware.RequestID(), middleware.RequestLogger(), middleware.Compress(1024), middleware.ETag(4<<20), middleware.Localize(handler.Preferences.Language), middleware.ErrorCodes(), middleware.Metrics(), middleware.Recovery(handler.Errors))
+
+	// 子路径部署时路由仍按根路径注册，前缀在进入gin之前去掉
+	prefix := cfg.PathPrefix()
+	r.Use(basePath(prefix))
+
+	// 高可用模式下备用节点只响应探针和指标
+	if handler.Leader.Enabled() {
+		r.Use(middleware.LeaderOnly(handler.Leader.IsLeader, "/healthz", "/readyz", "/metrics"))
+	}
 
 	// 禁用CORS中间件 - 不允许跨域访问
 	// r.Use(middleware.CORS())
 
-	// 静态文件服务(嵌入的前端文件)
-	r.GET("/", func(c *gin.Context) {
-		data, err := staticFiles.ReadFile("public/index.html")
-		if err != nil {
-			c.String(http.StatusNotFound, "页面未找到")
-			return
-		}
-		c.Data(http.StatusOK, "text/html; charset=utf-8", data)
-	})
+	// 静态文件服务(嵌入的前端文件)，未匹配的浏览器页面请求回退到前端页面
+	site := newStaticSite(staticFiles, prefix)
+	r.GET("/", site.page("index.html"))
+	// 客户门户页面，令牌位于URL的#之后，由页面脚本携带令牌请求 /api/v1/portal
+	r.GET("/portal", site.page("portal.html"))
+	r.GET("/static/*filepath", site.asset)
+	r.NoRoute(site.fallback)
 
-	// 静态资源路由
-	r.GET("/static/*filepath", func(c *gin.Context) {
-		filepath := c.Param("filepath")
-		fullPath := "public/static" + filepath
-		data, err := staticFiles.ReadFile(fullPath)
-		if err != nil {
-			c.String(http.StatusNotFound, "文件未找到: "+fullPath)
-			return
-		}
+	// 通过SSH访问落地机或耗时较长的接口按用户和IP限速，旧版路径与v1共用计数
+	limits := newRateLimits(handler.Settings)
+
+	// WebSocket路由(握手时通过token查询参数或首条消息认证)
+	r.GET("/ws/status", handler.HandleWebSocket)
+	// 容器日志流，通过token查询参数认证
+	r.GET("/ws/servers/:id/logs", middleware.JWTAuth(handler.AuthService), middleware.TenantAccess(handler.Tenants), middleware.TenantServer(handler.Tenants), limits.logs, handler.StreamServerLogs)
 
-		// 设置正确的Content-Type
-		contentType := getContentType(filepath)
-		c.Data(http.StatusOK, contentType, data)
+	// API路由，版本化路径登记到OpenAPI文档
+	spec := openapi.NewSpec("L2TP管理面板 API", "1.0.0")
+	spec.SetBasePath(prefix)
+	serveDocs(r, spec)
+
+	// 健康检查(不需要JWT验证，供容器编排和监控使用)
+	probes := newDocGroup(&r.RouterGroup, spec, "健康检查", true)
+	probes.GET("/healthz", handler.Healthz, openapi.Operation{
+		Summary: "存活检查", Response: gin.H{}, Raw: true,
+	})
+	probes.GET("/readyz", handler.Readyz, openapi.Operation{
+		Summary: "就绪检查", Description: "依赖组件不可用时返回503", Response: gin.H{}, Raw: true,
 	})
 
-	// WebSocket路由(不需要JWT验证)
-	r.GET("/ws/status", handler.HandleWebSocket)
+	// Prometheus指标，配置METRICS_TOKEN后需携带Bearer令牌
+	r.GET("/metrics", middleware.StaticToken(cfg.MetricsToken), handler.Metrics)
 
-	// API路由组
-	api := r.Group("/api")
+	// 中转节点连接(WebSocket，通过节点注册令牌或AGENT_TOKEN认证)
+	r.GET("/api/v1/agents/connect", handler.AgentConnect)
+
+	// 落地机上报当前IP(通过服务器的上报令牌认证)，兼容只能发GET请求的DDNS客户端
+	r.GET("/api/v1/ddns/update", handler.ReportServerIP)
+	r.POST("/api/v1/ddns/update", handler.ReportServerIP)
+
+	// 客户门户数据(通过门户令牌认证)
+	r.GET("/api/v1/portal", handler.GetPortal)
+
+	// 落地机注册脚本和登记(通过注册令牌认证)
+	r.GET("/api/v1/bootstrap/script", handler.GetBootstrapScript)
+	r.POST("/api/v1/bootstrap/register", handler.RegisterExitNode)
+
+	v1 := r.Group("/api/v1", middleware.APIVersion(1))
+	registerAPI(v1, handler, spec, limits, cfg)
+
+	// 旧版无版本路径作为v1的别名保留，响应中附带弃用头
+	legacy := r.Group("/api", middleware.Deprecated("/api", "/api/v1", ""), middleware.APIVersion(0))
+	registerAPI(legacy, handler, nil, limits, cfg)
+
+	return withBasePath(r, prefix)
+}
+
+// registerAPI 在指定路由组下注册全部API，spec为nil时不登记文档(用于旧版别名)
+func registerAPI(group *gin.RouterGroup, handler *api.Handler, spec *openapi.Spec, limits *rateLimits, cfg *config.Config) {
+	// 认证相关路由(不需要JWT验证)
+	auth := newDocGroup(group.Group("/auth"), spec, "认证", true)
 	{
-		// 认证相关路由(不需要JWT验证)
-		auth := api.Group("/auth")
-		{
-			auth.POST("/login", handler.Login)
-			auth.POST("/refresh", handler.RefreshToken)
-		}
-
-		// 需要JWT验证的路由
-		protected := api.Group("/")
-		protected.Use(middleware.JWTAuth(handler.AuthService))
-		{
-			// L2TP服务器管理
-			servers := protected.Group("/servers")
-			{
-				servers.GET("", handler.GetServers)
-				servers.POST("", handler.CreateServer)
-				servers.PUT("/:id", handler.UpdateServer)
-				servers.DELETE("/:id", handler.DeleteServer)
-				servers.POST("/:id/start", handler.StartServer)
-				servers.POST("/:id/stop", handler.StopServer)
-				servers.POST("/:id/restart", handler.RestartServer)
-				servers.GET("/:id/status", handler.GetServerStatus)
-				servers.GET("/:id/logs", handler.GetServerLogs)
-			}
+		auth.POST("/login", handler.Login, openapi.Operation{
+			Summary: "用户登录", Body: api.LoginRequest{}, Response: api.LoginResponse{}, Raw: true,
+		})
+		auth.POST("/refresh", handler.RefreshToken, openapi.Operation{
+			Summary: "刷新令牌", Description: "通过Authorization请求头携带当前令牌", Response: gin.H{},
+		})
+	}
 
-			// 流量统计
-			traffic := protected.Group("/traffic")
-			{
-				traffic.GET("/stats", handler.GetTrafficStats)
-			}
+	// 需要JWT验证的路由
+	protected := group.Group("/")
+	protected.Use(middleware.JWTAuth(handler.AuthService), middleware.TenantAccess(handler.Tenants))
+	// 租户用户只能访问自己的服务器及相关数据，以下分组仅限平台管理员
+	superAdmin := middleware.SuperAdmin()
+	{
+		// L2TP服务器管理
+		servers := newDocGroup(protected.Group("/servers", middleware.TenantServer(handler.Tenants)), spec, "服务器", false)
+		// 服务器操作接口支持Idempotency-Key，客户端重试时返回首次的响应
+		idempotent := middleware.Idempotency(handler.L2TPService)
+		{
+			servers.GET("", handler.GetServers, openapi.Operation{
+				Summary: "分页查询服务器列表", Response: []database.L2TPServer{}, Paged: true,
+				Params: []openapi.Param{
+					openapi.Query("page", "integer", "页码，默认1"),
+					openapi.Query("page_size", "integer", "每页数量，0表示不分页"),
+					openapi.Query("sort", "string", "排序字段"),
+					openapi.Query("status", "string", "按运行状态筛选"),
+					openapi.Query("expired", "boolean", "按是否过期筛选"),
+					openapi.Query("q", "string", "按名称或地址搜索"),
+					openapi.Query("tenant_id", "integer", "按租户筛选(仅平台管理员)"),
+				},
+			})
+			servers.GET("/trash", handler.GetTrashedServers, openapi.Operation{
+				Summary: "回收站中的服务器", Response: []database.L2TPServer{},
+			})
+			servers.GET("/export", handler.ExportServers, openapi.Operation{
+				Summary: "导出服务器清单", Produces: "text/csv",
+				Params: exportParams(),
+			})
+			servers.GET("/lookup", handler.LookupServer, openapi.Operation{
+				Summary: "精确查找服务器", Description: "按external_id、name或l2tp_port精确匹配唯一的服务器，未匹配返回404，匹配到多个返回409",
+				Response: database.L2TPServer{},
+				Params: []openapi.Param{
+					openapi.Query("external_id", "string", "外部ID"),
+					openapi.Query("name", "string", "名称"),
+					openapi.Query("l2tp_port", "integer", "中转端口"),
+				},
+			})
+			servers.GET("/drift", handler.GetDriftedServers, openapi.Operation{
+				Summary: "存在配置漂移的服务器", Description: "定期比对运行中服务器的落地机容器(镜像、环境变量、PSK、用户、端口)和配置文件与面板配置",
+				Response: []services.DriftReport{},
+			})
+			servers.POST("", handler.CreateServer, openapi.Operation{
+				Summary: "创建服务器", Description: "external_id可选，未指定时自动生成；相同Idempotency-Key的重试返回首次创建的服务器，请求内容不同时返回422",
+				Body: database.L2TPServer{}, Response: database.L2TPServer{},
+				Params: []openapi.Param{openapi.Header("Idempotency-Key", "string", "幂等键，24小时内有效")},
+			})
+			servers.GET("/:id", handler.GetServer, openapi.Operation{
+				Summary: "获取服务器", Params: idParam(), Response: database.L2TPServer{},
+			})
+			servers.PUT("/:id", handler.UpdateServer, openapi.Operation{
+				Summary: "更新服务器", Params: idParam(), Body: database.L2TPServer{}, Response: database.L2TPServer{},
+			})
+			servers.PATCH("/:id", handler.PatchServer, openapi.Operation{
+				Summary: "部分更新服务器", Params: idParam(), Body: services.ServerPatch{}, Response: database.L2TPServer{},
+			})
+			servers.DELETE("/:id", handler.DeleteServer, openapi.Operation{
+				Summary: "删除服务器(移入回收站)", Params: idParam(),
+			})
+			servers.With(limits.serverOps, idempotent).POST("/:id/start", handler.StartServer, openapi.Operation{
+				Summary: "启动服务器", Description: "立即返回202和后台执行的任务，进度以job_progress、结果以job_finished消息推送",
+				Params: idempotentParams(), Response: services.JobView{},
+			})
+			servers.With(limits.serverOps, idempotent).POST("/:id/stop", handler.StopServer, openapi.Operation{
+				Summary: "停止服务器", Description: "立即返回202和后台执行的任务，进度以job_progress、结果以job_finished消息推送",
+				Params: idempotentParams(), Response: services.JobView{},
+			})
+			servers.With(limits.serverOps, idempotent).POST("/:id/restart", handler.RestartServer, openapi.Operation{
+				Summary: "重启服务器", Description: "立即返回202和后台执行的任务，进度以job_progress、结果以job_finished消息推送",
+				Params: idempotentParams(), Response: services.JobView{},
+			})
+			servers.GET("/:id/status", handler.GetServerStatus, openapi.Operation{
+				Summary: "查询服务器状态", Params: idParam(), Response: map[string]interface{}{},
+			})
+			servers.With(limits.logs).GET("/:id/logs", handler.GetServerLogs, openapi.Operation{
+				Summary: "查询服务器日志", Response: gin.H{},
+				Params:  append(idParam(), openapi.Query("lines", "integer", "返回行数，默认100")),
+			})
+			servers.GET("/:id/wireguard/peers", handler.GetWireGuardPeers, openapi.Operation{
+				Summary: "WireGuard客户端列表", Params: idParam(), Response: []services.WireGuardPeer{},
+			})
+			servers.GET("/:id/wireguard/peers/:peer/config", handler.GetWireGuardConfig, openapi.Operation{
+				Summary: "下载WireGuard客户端配置", Produces: "text/plain",
+				Description: "Endpoint默认为负责转发的中转节点地址，由面板转发时为访问面板的地址",
+				Params: append(idParam(),
+					openapi.Path("peer", "string", "用户名"),
+					openapi.Query("endpoint", "string", "客户端连接的中转机地址"),
+				),
+			})
+			servers.GET("/:id/openvpn/profile", handler.GetOpenVPNProfile, openapi.Operation{
+				Summary: "下载OpenVPN客户端配置", Produces: "text/plain",
+				Description: "所有用户共用同一配置文件，连接时输入各自的用户名密码。remote默认为负责转发的中转节点地址，由面板转发时为访问面板的地址",
+				Params: append(idParam(), openapi.Query("endpoint", "string", "客户端连接的中转机地址")),
+			})
+			servers.GET("/:id/ikev2/ca", handler.GetIKEv2CA, openapi.Operation{
+				Summary: "下载IKEv2 CA证书", Params: idParam(), Produces: "application/x-pem-file",
+				Description: "Windows和手动配置的客户端需将CA导入受信任的根证书颁发机构，描述文件已包含CA",
+			})
+			servers.GET("/:id/ikev2/users/:user/profile", handler.GetIKEv2Profile, openapi.Operation{
+				Summary: "下载IKEv2客户端配置", Produces: "application/octet-stream",
+				Description: "mobileconfig用于iOS/macOS，sswan用于strongSwan Android客户端，p12为证书认证的客户端证书(密码为用户密码)。服务端地址默认为负责转发的中转节点地址",
+				Params: append(idParam(),
+					openapi.Path("user", "string", "用户名"),
+					openapi.Query("format", "string", "mobileconfig/sswan/p12，默认mobileconfig"),
+					openapi.Query("endpoint", "string", "客户端连接的中转机地址"),
+				),
+			})
+			servers.GET("/:id/xray/users/:user/link", handler.GetXrayShareLink, openapi.Operation{
+				Summary: "Shadowsocks/VLESS分享链接", Response: gin.H{},
+				Description: "返回ss://或vless://链接，format=qrcode时返回二维码PNG图片。地址默认为负责转发的中转节点地址",
+				Params: append(idParam(),
+					openapi.Path("user", "string", "用户名"),
+					openapi.Query("format", "string", "uri/qrcode，默认uri"),
+					openapi.Query("endpoint", "string", "客户端连接的中转机地址"),
+				),
+			})
+			servers.GET("/:id/chain", handler.GetServerChain, openapi.Operation{
+				Summary: "转发链状态", Params: idParam(), Response: services.ChainView{},
+				Description: "入口(面板或中转节点)、chain_nodes中依次经过的中转节点和落地机，各跳的在线和转发状态、到下一跳的TCP探测延迟及总延迟",
+			})
+			servers.GET("/:id/ddns", handler.GetServerDDNS, openapi.Operation{
+				Summary: "落地机动态地址状态", Params: idParam(), Response: services.DDNSStatus{},
+				Description: "host为域名时每分钟重新解析，地址变化后重建转发器；落地机上报的IP优先于解析结果",
+			})
+			servers.POST("/:id/ddns/token", handler.RotateServerDDNSToken, openapi.Operation{
+				Summary: "生成IP上报令牌", Params: idParam(), Response: api.DDNSTokenCreated{},
+				Description: "落地机定时请求 /api/v1/ddns/update?token=<令牌>[&ip=<IP>] 上报当前IP，未指定ip时使用请求来源地址。旧令牌立即失效",
+			})
+			servers.DELETE("/:id/ddns", handler.DisableServerDDNS, openapi.Operation{
+				Summary: "停用IP上报", Params: idParam(),
+				Description: "撤销上报令牌并清除上报的IP，转发目标恢复为host",
+			})
+			servers.GET("/:id/portal-tokens", handler.GetPortalTokens, openapi.Operation{
+				Summary: "客户门户链接列表", Params: idParam(), Response: []database.PortalToken{},
+			})
+			servers.POST("/:id/portal-tokens", handler.CreatePortalToken, openapi.Operation{
+				Summary: "创建客户门户链接", Params: idParam(), Body: services.PortalTokenRequest{}, Response: api.PortalTokenCreated{},
+				Description: "客户打开返回的url即可只读查看该服务器的状态、到期时间、流量和连接方式，不暴露管理面板和SSH凭据；show_credentials为true时同时显示PSK、账号密码和客户端配置。令牌只显示一次",
+			})
+			servers.DELETE("/:id/portal-tokens/:tokenId", handler.DeletePortalToken, openapi.Operation{
+				Summary: "撤销客户门户链接",
+				Params:  append(idParam(), openapi.Path("tokenId", "integer", "门户令牌ID")),
+			})
+			servers.GET("/:id/drift", handler.GetServerDrift, openapi.Operation{
+				Summary: "服务器的配置漂移检测结果", Response: services.DriftReport{},
+				Params: append(idParam(), openapi.Query("refresh", "boolean", "为true时立即检测")),
+			})
+			servers.With(idempotent).POST("/:id/drift/reapply", handler.ReapplyServer, openapi.Operation{
+				Summary: "按面板配置重新部署", Description: "重启服务器，落地机容器和配置文件按面板配置重建",
+				Params: idempotentParams(),
+			})
+			servers.GET("/:id/uptime", handler.GetServerUptime, openapi.Operation{
+				Summary: "服务器可用率", Description: "根据健康检查和状态变更记录计算24小时/7天/30天的可用率，停止期间不计入",
+				Params: idParam(), Response: services.UptimeReport{},
+			})
+			servers.GET("/:id/timeline", handler.GetServerTimeline, openapi.Operation{
+				Summary: "服务器事件时间线", Description: "可用性变化(status)、操作(operation)、健康检查自动重启(health)、配置修订(config)、告警(alert)和拨测失败(synthetic)按时间倒序合并",
+				Params: append(idParam(),
+					openapi.Query("since", "string", "开始时间(RFC3339或Unix秒)"),
+					openapi.Query("until", "string", "结束时间(RFC3339或Unix秒)，默认当前时间"),
+					openapi.Query("types", "string", "逗号分隔的事件类型，为空表示全部"),
+					openapi.Query("limit", "integer", "返回条数，默认200，最多1000")),
+				Response: []services.TimelineEvent{},
+			})
+			servers.POST("/:id/synthetic-check", handler.RunSyntheticCheck, openapi.Operation{
+				Summary: "立即端到端拨测", Description: "在落地机上运行一次性的L2TP客户端容器，经中转入口与本服务器建立真实会话，返回是否成功和会话建立耗时",
+				Params: idParam(), Response: database.SyntheticCheck{},
+			})
+			servers.GET("/:id/synthetic-checks", handler.GetSyntheticChecks, openapi.Operation{
+				Summary: "端到端拨测记录", Params: append(idParam(), openapi.Query("limit", "integer", "返回条数，默认100")),
+				Response: []database.SyntheticCheck{},
+			})
+			servers.POST("/:id/nat-check", handler.RunNATCheck, openapi.Operation{
+				Summary: "NAT-T检测", Description: "在落地机上统计一段时间内收到的UDP 4500、NAT-T保活包和ESP数据包，并比较中转转发器的UDP会话超时与保活间隔，发现中转或出口路径丢弃保活包时返回警告。最近一次结果随服务器状态返回",
+				Params: append(idParam(), openapi.Query("duration", "integer", "采样秒数(10-120)，默认两个保活间隔且至少30秒")),
+				Response: services.NATCheck{},
+			})
+			servers.GET("/:id/accounts/usage", handler.GetAccountUsage, openapi.Operation{
+				Summary: "账号流量", Description: "返回L2TP服务器各账号在指定月份开始的计费周期内的流量(按SoftEther的Outgoing/Incoming方向分列)、每个计费周期的流量配额和已用百分比。流量按设置account_usage_interval的间隔从落地机读取",
+				Params: append(idParam(), openapi.Query("period", "string", "月份YYYY-MM，默认本月")), Response: []services.AccountUsageView{},
+			})
+			servers.POST("/:id/accounts/usage/collect", handler.CollectAccountUsage, openapi.Operation{
+				Summary: "立即读取账号流量", Description: "立即从运行中的L2TP服务器读取各账号的流量计数，返回本月流量",
+				Params: idParam(), Response: []services.AccountUsageView{},
+			})
+			servers.POST("/:id/accounts/:username/resume", handler.ResumeAccount, openapi.Operation{
+				Summary: "恢复停用的账号", Description: "恢复因超出流量配额被停用的L2TP账号，本月不再因超额停用，下月重新按配额检查",
+				Params: append(idParam(), openapi.Path("username", "string", "账号")), Response: gin.H{},
+			})
+			servers.GET("/:id/knock", handler.GetKnock, openapi.Operation{
+				Summary: "端口敲门信息", Description: "返回服务器的端口敲门设置、敲门密钥、发送敲门包的示例命令和当前放行的来源地址。敲门包发送到设置knock_port指定的UDP端口",
+				Params: append(idParam(), openapi.Query("endpoint", "string", "示例命令中面板的地址，默认为访问面板的地址")), Response: services.KnockInfo{},
+			})
+			servers.DELETE("/:id/knock/sources", handler.RevokeKnockSources, openapi.Operation{
+				Summary: "清空放行地址", Description: "清空敲门通过的来源地址，已建立的连接不受影响", Params: idParam(), Response: gin.H{},
+			})
+			servers.GET("/:id/obfuscation/client", handler.GetObfuscationClientConfig, openapi.Operation{
+				Summary: "下载混淆客户端配置", Description: "下载在客户端一侧运行的Xray配置(xray run -c)，按服务器的每个中转端口在本地监听并经混淆入口连接中转机，VPN客户端改为连接辅助程序的地址",
+				Params: append(idParam(),
+					openapi.Query("endpoint", "string", "中转机地址，默认为访问面板的地址"),
+					openapi.Query("listen", "string", "辅助程序的监听地址，默认127.0.0.1，供局域网其他设备使用时填写0.0.0.0")),
+				Response: gin.H{},
+			})
+			servers.PUT("/:id/desired-state", handler.SetDesiredState, openapi.Operation{
+				Summary: "设置期望状态", Params: idParam(), Body: api.DesiredStateRequest{}, Response: gin.H{},
+			})
+			servers.POST("/:id/plan", handler.PlanServerOperation, openapi.Operation{
+				Summary: "预览操作计划", Response: services.OperationPlan{},
+				Params:  append(idParam(), openapi.Query("action", "string", "start/stop/restart，默认start")),
+			})
+			servers.GET("/:id/operations", handler.GetServerOperations, openapi.Operation{
+				Summary: "操作历史", Description: "进行中和最近的启动/停止/重启操作，每台服务器保留最近50次，不含执行过程",
+				Params: idParam(), Response: []services.ServerOperationDetail{},
+			})
+			servers.GET("/:id/operations/:jobId", handler.GetServerOperation, openapi.Operation{
+				Summary:     "操作执行过程",
+				Description: "执行的SSH命令、输出、退出码和耗时以及各步骤结果，密码等敏感内容已隐藏；操作进行中时返回已记录的部分",
+				Params:      append(idParam(), openapi.Path("jobId", "string", "任务ID")),
+				Response:    services.ServerOperationDetail{},
+			})
+			servers.GET("/:id/revisions", handler.GetServerRevisions, openapi.Operation{
+				Summary: "配置修订历史", Params: idParam(), Response: []database.ServerRevision{},
+			})
+			servers.With(idempotent).POST("/:id/revisions/:version/rollback", handler.RollbackServer, openapi.Operation{
+				Summary: "回滚到指定修订", Response: database.L2TPServer{},
+				Params:  append(idempotentParams(), openapi.Path("version", "integer", "修订版本号")),
+			})
+			servers.With(idempotent).POST("/:id/restore", handler.RestoreServer, openapi.Operation{
+				Summary: "从回收站恢复", Params: idempotentParams(), Response: database.L2TPServer{},
+			})
+			servers.DELETE("/:id/purge", handler.PurgeServer, openapi.Operation{
+				Summary: "永久删除", Params: idParam(),
+			})
+		}
+
+		// 仪表盘
+		dashboard := newDocGroup(protected.Group("/dashboard"), spec, "仪表盘", false)
+		{
+			dashboard.GET("", handler.GetDashboard, openapi.Operation{
+				Summary: "仪表盘汇总", Response: services.DashboardSummary{},
+			})
+		}
+
+		// 版本信息
+		versionInfo := newDocGroup(protected.Group("/version"), spec, "系统", false)
+		{
+			versionInfo.GET("", handler.GetVersion, openapi.Operation{
+				Summary: "版本信息", Response: services.RuntimeInfo{},
+				Description: "面板版本、Git提交、构建时间、Go和Xray-core版本，以及进程启动时间和运行时长",
+			})
+		}
+
+		// 当前用户的偏好设置
+		preferences := newDocGroup(protected.Group("/preferences"), spec, "偏好设置", false)
+		{
+			preferences.GET("", handler.GetPreferences, openapi.Operation{
+				Summary: "当前用户的偏好设置", Response: services.Preferences{},
+			})
+			preferences.PUT("", handler.UpdatePreferences, openapi.Operation{
+				Summary: "更新偏好设置", Description: "language为界面语言(zh/en)，为空表示按请求的Accept-Language",
+				Body: services.PreferenceRequest{}, Response: services.Preferences{},
+			})
+		}
+
+		// 服务器操作任务
+		jobs := newDocGroup(protected.Group("/jobs"), spec, "任务", false)
+		{
+			jobs.GET("", handler.GetJobs, openapi.Operation{
+				Summary: "任务列表", Description: "进行中和最近结束的启动/停止/重启等服务器操作任务，最新的在前",
+				Response: []services.JobView{},
+				Params: []openapi.Param{
+					openapi.Query("status", "string", "pending/running/succeeded/failed"),
+					openapi.Query("kind", "string", "start/stop/restart/auto_restart/upgrade"),
+					openapi.Query("server_id", "integer", "服务器ID"),
+				},
+			})
+			jobs.GET("/:id", handler.GetJob, openapi.Operation{
+				Summary: "查询任务", Params: []openapi.Param{openapi.Path("id", "string", "任务ID")},
+				Response: services.JobView{},
+			})
+		}
+
+		// 密钥生成
+		credentials := newDocGroup(protected.Group("/credentials"), spec, "密钥生成", false)
+		{
+			credentials.POST("/:kind", handler.GenerateCredentials, openapi.Operation{
+				Summary:     "生成PSK或用户密码",
+				Description: "按设置credential_psk_length、credential_password_length和credential_charset生成。创建或修改服务器时PSK或用户密码填写auto同样由面板生成",
+				Params: []openapi.Param{
+					openapi.Path("kind", "string", "psk/password"),
+					openapi.Query("count", "integer", "生成数量，默认1，最大100"),
+				},
+				Response: services.GeneratedCredentials{},
+			})
+		}
+
+		// 全局搜索
+		search := newDocGroup(protected.Group("/search"), spec, "搜索", false)
+		{
+			search.GET("", handler.SearchAll, openapi.Operation{
+				Summary: "搜索服务器、L2TP账号和审计日志", Response: services.SearchResults{},
+				Params: []openapi.Param{
+					openapi.Query("q", "string", "关键词"),
+					openapi.Query("limit", "integer", "每类最多返回条数，默认10，最大50"),
+				},
+			})
+		}
+
+		// 流量统计
+		traffic := newDocGroup(protected.Group("/traffic"), spec, "流量", false)
+		{
+			traffic.GET("/stats", handler.GetTrafficStats, openapi.Operation{
+				Summary: "实时流量统计", Response: gin.H{},
+			})
+			traffic.GET("/logs", handler.GetTrafficLogs, openapi.Operation{
+				Summary: "查询流量日志", Response: []database.TrafficLog{},
+				Params: []openapi.Param{
+					openapi.Query("server_id", "integer", "服务器ID"),
+					openapi.Query("client_ip", "string", "客户端IP"),
+					openapi.Query("since", "string", "开始时间(RFC3339)"),
+					openapi.Query("until", "string", "结束时间(RFC3339)"),
+					openapi.Query("limit", "integer", "返回条数，默认500"),
+				},
+			})
+			traffic.GET("/history", handler.GetTrafficHistory, openapi.Operation{
+				Summary: "流量历史趋势", Response: services.TrafficHistory{},
+				Params: []openapi.Param{
+					openapi.Query("server_id", "integer", "服务器ID，为空表示全部"),
+					openapi.Query("range", "string", "时间范围，默认24h"),
+				},
+			})
+			traffic.GET("/countries", handler.GetTrafficCountries, openapi.Operation{
+				Summary: "按国家/地区汇总流量", Response: []services.CountryTraffic{},
+				Params: []openapi.Param{
+					openapi.Query("server_id", "integer", "服务器ID，为空表示全部"),
+					openapi.Query("since", "string", "开始时间(RFC3339)"),
+					openapi.Query("until", "string", "结束时间(RFC3339)"),
+				},
+			})
+			traffic.GET("/export", handler.ExportTraffic, openapi.Operation{
+				Summary: "导出流量数据", Produces: "text/csv",
+				Params: append(exportParams(),
+					openapi.Query("server_id", "integer", "服务器ID"),
+					openapi.Query("granularity", "string", "raw/hour/day，默认hour"),
+				),
+			})
+		}
+
+		// 用量报告
+		reports := newDocGroup(protected.Group("/reports", superAdmin), spec, "用量报告", false)
+		{
+			reports.GET("/usage", handler.GetUsageReport, openapi.Operation{
+				Summary: "月度用量报告", Response: []database.UsageReport{},
+				Description: "每台服务器一行合计(中转流量、在线时长和在线率，按服务器各自的计费周期统计)，其后为该服务器各L2TP账号的流量。上月开始的计费周期全部结束后自动生成报告",
+				Params: usageParams(),
+			})
+			reports.POST("/usage", handler.GenerateUsageReport, openapi.Operation{
+				Summary: "生成用量报告", Response: []database.UsageReport{},
+				Description: "重新生成指定月份的报告并覆盖已有的行；当月报告为截至目前的用量",
+				Params: []openapi.Param{openapi.Query("period", "string", "月份(YYYY-MM)，默认上个月")},
+			})
+			reports.GET("/usage/periods", handler.GetUsagePeriods, openapi.Operation{
+				Summary: "已生成报告的月份", Response: []services.UsagePeriod{},
+			})
+			reports.GET("/usage/export", handler.ExportUsageReport, openapi.Operation{
+				Summary: "导出用量报告", Produces: "text/csv",
+				Params: append(usageParams(), openapi.Query("format", "string", "csv/xlsx/pdf，默认csv")),
+			})
+		}
 
-			// 系统管理
-			system := protected.Group("/system")
-			{
-				system.GET("/status", handler.GetSystemStatus)
-				system.POST("/backup", handler.BackupDatabase)
-				system.POST("/restore", handler.RestoreDatabase)
+		// 系统管理
+		system := newDocGroup(protected.Group("/system", superAdmin), spec, "系统", false)
+		{
+			system.GET("/status", handler.GetSystemStatus, openapi.Operation{
+				Summary: "系统状态", Response: map[string]interface{}{},
+				Description: "服务器和转发器数量、转发模式、面板主机资源(resources)，以及版本和运行时长(build)",
+			})
+			system.GET("/update", handler.CheckUpdate, openapi.Operation{
+				Summary: "检查新版本", Response: services.UpdateInfo{},
+			})
+			system.POST("/update", handler.ApplyUpdate, openapi.Operation{
+				Summary:     "安装新版本并重启",
+				Description: "从GitHub Releases下载当前平台的二进制文件，校验sha256(配置公钥时还校验签名)后原子替换并平滑重启",
+				Response:    services.UpdateInfo{},
+			})
+			system.POST("/restart", handler.RestartPanel, openapi.Operation{
+				Summary:     "平滑重启面板",
+				Description: "以exec方式重新执行当前可执行文件，HTTP监听和转发端口的套接字交接给新进程，重启期间的连接排队等待",
+			})
+			system.GET("/health", handler.GetHealth, openapi.Operation{
+				Summary: "组件健康详情", Response: api.HealthReport{},
+			})
+			system.GET("/diagnostics", handler.GetDiagnostics, openapi.Operation{
+				Summary:     "运行诊断信息",
+				Description: "协程数及按函数分组的统计、内存和GC、当前SSH连接、转发器、WebSocket连接数和数据库连接池，用于排查泄漏",
+				Response:    api.Diagnostics{},
+			})
+			if cfg.PprofEnabled {
+				servePprof(system.group)
 			}
+			system.GET("/logs", handler.GetAppLogs, openapi.Operation{
+				Summary: "查询面板运行日志", Response: []logger.Entry{}, Params: logParams(),
+			})
+			system.GET("/logs/follow", handler.FollowAppLogs, openapi.Operation{
+				Summary:     "实时跟随面板运行日志",
+				Description: "WebSocket接口，先推送满足条件的历史日志，再持续推送新日志。浏览器可通过token查询参数传递令牌",
+				Params:      append(logParams(), openapi.Query("token", "string", "JWT令牌(WebSocket无法设置请求头时使用)")),
+			})
+			system.With(limits.backup).POST("/backup", handler.BackupDatabase, openapi.Operation{
+				Summary: "立即备份数据库", Response: gin.H{},
+			})
+			system.With(limits.backup).POST("/restore", handler.RestoreDatabase, openapi.Operation{
+				Summary: "从备份文件恢复数据库", Upload: "backup_file", Response: database.RestoreResult{},
+			})
+			system.GET("/backups", handler.ListBackups, openapi.Operation{
+				Summary: "备份文件列表", Response: []services.BackupFile{},
+			})
+			system.GET("/backups/:name", handler.DownloadBackup, openapi.Operation{
+				Summary: "下载备份文件", Produces: "application/octet-stream",
+			})
+			system.DELETE("/backups/:name", handler.DeleteBackup, openapi.Operation{
+				Summary: "删除备份文件",
+			})
+			system.GET("/backup-policy", handler.GetBackupPolicy, openapi.Operation{
+				Summary: "获取自动备份策略", Response: database.BackupPolicy{},
+			})
+			system.PUT("/backup-policy", handler.UpdateBackupPolicy, openapi.Operation{
+				Summary: "更新自动备份策略", Body: database.BackupPolicy{}, Response: database.BackupPolicy{},
+			})
+			system.With(limits.backup).POST("/backup-policy/run", handler.RunBackupPolicy, openapi.Operation{
+				Summary: "立即执行备份策略", Response: gin.H{},
+			})
+			system.GET("/audit", handler.GetAuditLogs, openapi.Operation{
+				Summary: "审计日志", Response: []database.AuditLog{},
+				Params: []openapi.Param{
+					openapi.Query("server_id", "integer", "服务器ID"),
+					openapi.Query("action", "string", "操作类型"),
+					openapi.Query("limit", "integer", "返回条数，默认100"),
+				},
+			})
+			system.GET("/settings", handler.GetSettings, openapi.Operation{
+				Summary: "运行时设置", Response: []services.SettingView{},
+			})
+			system.PUT("/settings", handler.UpdateSettings, openapi.Operation{
+				Summary: "更新运行时设置", Description: "值为null表示恢复默认值",
+				Body: map[string]interface{}{}, Response: []services.SettingView{},
+			})
+			system.POST("/db/vacuum", handler.VacuumDatabase, openapi.Operation{
+				Summary: "压缩数据库", Response: gin.H{},
+			})
+			system.GET("/db/check", handler.CheckDatabase, openapi.Operation{
+				Summary: "检查数据库一致性", Response: services.DBCheckReport{},
+			})
+			system.POST("/db/repair", handler.RepairDatabase, openapi.Operation{
+				Summary: "修复数据库问题", Body: api.RepairRequest{}, Response: map[string]int64{},
+			})
+			system.POST("/export", handler.ExportConfig, openapi.Operation{
+				Summary: "导出配置包", Body: api.ExportRequest{}, Response: services.ConfigBundle{}, Raw: true,
+			})
+			system.POST("/import", handler.ImportConfig, openapi.Operation{
+				Summary: "导入配置包", Body: api.ImportRequest{}, Response: services.ImportResult{},
+			})
+		}
+
+		// 通知渠道
+		notifications := newDocGroup(protected.Group("/notifications", superAdmin), spec, "通知", false)
+		{
+			notifications.GET("/channels", handler.GetNotificationChannels, openapi.Operation{
+				Summary: "通知渠道和事件路由", Description: "事件路由通过运行时设置 notify_events_<渠道名> 修改",
+				Response: gin.H{},
+			})
+			notifications.POST("/channels/:channel/test", handler.TestNotificationChannel, openapi.Operation{
+				Summary: "向渠道发送测试消息", Params: []openapi.Param{openapi.Path("channel", "string", "渠道名称，如email/telegram/webhook")},
+			})
+		}
+
+		// 告警规则
+		alerts := newDocGroup(protected.Group("/alerts", superAdmin), spec, "告警", false)
+		{
+			alerts.GET("/metrics", handler.GetAlertMetrics, openapi.Operation{
+				Summary: "支持的告警指标", Response: map[string]string{},
+			})
+			alerts.GET("/rules", handler.GetAlertRules, openapi.Operation{
+				Summary: "告警规则列表", Response: []database.AlertRule{},
+			})
+			alerts.POST("/rules", handler.CreateAlertRule, openapi.Operation{
+				Summary: "创建告警规则", Description: "channels为逗号分隔的通知渠道，为空时按事件路由分发",
+				Body: database.AlertRule{}, Response: database.AlertRule{},
+			})
+			alerts.PUT("/rules/:id", handler.UpdateAlertRule, openapi.Operation{
+				Summary: "更新告警规则", Params: alertRuleIDParam(), Body: database.AlertRule{}, Response: database.AlertRule{},
+			})
+			alerts.DELETE("/rules/:id", handler.DeleteAlertRule, openapi.Operation{
+				Summary: "删除告警规则", Params: alertRuleIDParam(),
+			})
+			alerts.POST("/rules/:id/silence", handler.SilenceAlertRule, openapi.Operation{
+				Summary: "静默告警规则", Description: "minutes为0表示取消静默",
+				Params: alertRuleIDParam(), Body: api.SilenceRequest{}, Response: database.AlertRule{},
+			})
+			alerts.GET("/history", handler.GetAlertHistory, openapi.Operation{
+				Summary: "告警历史", Response: []database.AlertRecord{},
+				Params: []openapi.Param{
+					openapi.Query("rule_id", "integer", "规则ID"),
+					openapi.Query("server_id", "integer", "服务器ID"),
+					openapi.Query("state", "string", "firing/resolved"),
+					openapi.Query("limit", "integer", "返回条数，默认100"),
+				},
+			})
+		}
+
+		// 中转节点
+		relayNodes := newDocGroup(protected.Group("/relay-nodes", superAdmin), spec, "中转节点", false)
+		{
+			relayNodes.GET("", handler.GetRelayNodes, openapi.Operation{
+				Summary: "中转节点列表", Description: "节点通过 /api/v1/agents/connect 以WebSocket连接面板",
+				Response: []services.RelayNodeView{},
+			})
+			relayNodes.GET("/placement", handler.GetRelayPlacement, openapi.Operation{
+				Summary: "推荐放置新服务器的节点", Description: "在线且未达承载上限的节点中，已指定服务器最少者优先",
+				Response: services.RelayNodeView{},
+			})
+			relayNodes.POST("", handler.CreateRelayNode, openapi.Operation{
+				Summary: "登记中转节点", Description: "返回的注册令牌只显示一次",
+				Body: database.RelayNode{}, Response: api.RelayNodeCreated{},
+			})
+			relayNodes.PUT("/:id", handler.UpdateRelayNode, openapi.Operation{
+				Summary: "更新中转节点", Params: relayNodeIDParam(), Body: database.RelayNode{}, Response: database.RelayNode{},
+			})
+			relayNodes.DELETE("/:id", handler.DeleteRelayNode, openapi.Operation{
+				Summary: "删除中转节点", Description: "仍有服务器指定该节点时拒绝", Params: relayNodeIDParam(),
+			})
+			relayNodes.POST("/:id/token", handler.RotateRelayNodeToken, openapi.Operation{
+				Summary: "重置注册令牌", Params: relayNodeIDParam(), Response: api.RelayNodeCreated{},
+			})
+		}
+
+		// 落地机注册
+		bootstrap := newDocGroup(protected.Group("/bootstrap", superAdmin), spec, "落地机注册", false)
+		{
+			bootstrap.GET("/tokens", handler.GetBootstrapTokens, openapi.Operation{
+				Summary: "注册令牌列表", Response: []database.BootstrapToken{},
+			})
+			bootstrap.POST("/tokens", handler.CreateBootstrapToken, openapi.Operation{
+				Summary: "创建注册令牌", Body: services.BootstrapTokenRequest{}, Response: api.BootstrapTokenCreated{},
+				Description: "返回的令牌只显示一次。command为在落地机上以root执行的一键注册命令：脚本安装面板SSH公钥并上报地址，登记为待审核服务器",
+			})
+			bootstrap.DELETE("/tokens/:id", handler.DeleteBootstrapToken, openapi.Operation{
+				Summary: "撤销注册令牌", Params: []openapi.Param{openapi.Path("id", "integer", "注册令牌ID")},
+			})
+			bootstrap.GET("/pending", handler.GetPendingServers, openapi.Operation{
+				Summary: "登记的落地机", Response: []database.PendingServer{},
+				Params: []openapi.Param{openapi.Query("status", "string", "pending/approved/rejected，默认pending")},
+			})
+			bootstrap.POST("/pending/:id/approve", handler.ApprovePendingServer, openapi.Operation{
+				Summary: "审核通过", Params: pendingIDParam(), Body: database.L2TPServer{}, Response: database.L2TPServer{},
+				Description: "以登记的地址和SSH信息创建服务器，请求体为中转端口、PSK、用户等其余配置",
+			})
+			bootstrap.POST("/pending/:id/reject", handler.RejectPendingServer, openapi.Operation{
+				Summary: "拒绝登记", Params: pendingIDParam(), Response: database.PendingServer{},
+			})
+			bootstrap.GET("/ssh-key", handler.GetPanelSSHKey, openapi.Operation{
+				Summary: "面板SSH公钥", Response: gin.H{},
+				Description: "未设置SSH密码的服务器使用面板密钥登录",
+			})
+		}
+
+		// 代理入站
+		proxies := newDocGroup(protected.Group("/proxies", superAdmin), spec, "代理入站", false)
+		{
+			proxies.GET("", handler.GetProxies, openapi.Operation{
+				Summary: "代理入站列表", Description: "包含运行状态和各账号的累计流量",
+				Response: []services.ProxyView{},
+			})
+			proxies.GET("/:id", handler.GetProxy, openapi.Operation{
+				Summary: "代理入站详情", Params: proxyIDParam(), Response: services.ProxyView{},
+			})
+			proxies.POST("", handler.CreateProxy, openapi.Operation{
+				Summary: "创建代理入站", Description: "protocol为socks或http；exit_server_id须为WireGuard服务器，中转机以exit_peer指定的WireGuard用户身份连接该服务器作为出口",
+				Body: api.ProxyRequest{}, Response: database.ProxyInbound{},
+			})
+			proxies.PUT("/:id", handler.UpdateProxy, openapi.Operation{
+				Summary: "更新代理入站", Params: proxyIDParam(), Body: api.ProxyRequest{}, Response: database.ProxyInbound{},
+			})
+			proxies.DELETE("/:id", handler.DeleteProxy, openapi.Operation{
+				Summary: "删除代理入站", Description: "同时删除各账号的流量统计", Params: proxyIDParam(),
+			})
+			proxies.POST("/:id/traffic/reset", handler.ResetProxyTraffic, openapi.Operation{
+				Summary: "清零账号流量", Params: proxyIDParam(),
+			})
+		}
+
+		// Webhook通知
+		webhooks := newDocGroup(protected.Group("/webhooks", superAdmin), spec, "Webhook", false)
+		{
+			webhooks.GET("", handler.GetWebhooks, openapi.Operation{
+				Summary: "Webhook列表", Response: []database.Webhook{},
+			})
+			webhooks.GET("/events", handler.GetWebhookEvents, openapi.Operation{
+				Summary: "可订阅的事件类型", Response: []string{},
+			})
+			webhooks.POST("", handler.CreateWebhook, openapi.Operation{
+				Summary: "创建Webhook", Description: "events为逗号分隔的事件类型，为空表示订阅全部",
+				Body: database.Webhook{}, Response: database.Webhook{},
+			})
+			webhooks.PUT("/:id", handler.UpdateWebhook, openapi.Operation{
+				Summary: "更新Webhook", Description: "secret为******时保留原密钥",
+				Params: webhookIDParam(), Body: database.Webhook{}, Response: database.Webhook{},
+			})
+			webhooks.DELETE("/:id", handler.DeleteWebhook, openapi.Operation{
+				Summary: "删除Webhook", Params: webhookIDParam(),
+			})
+			webhooks.POST("/:id/test", handler.TestWebhook, openapi.Operation{
+				Summary: "发送测试事件", Params: webhookIDParam(), Response: database.WebhookDelivery{},
+			})
+			webhooks.GET("/:id/deliveries", handler.GetWebhookDeliveries, openapi.Operation{
+				Summary: "投递历史", Response: []database.WebhookDelivery{},
+				Params:  append(webhookIDParam(), openapi.Query("limit", "integer", "返回条数，默认100")),
+			})
+		}
+
+		// 当前用户所属租户
+		tenant := newDocGroup(protected.Group("/tenant"), spec, "租户", false)
+		{
+			tenant.GET("", handler.GetCurrentTenant, openapi.Operation{
+				Summary: "当前租户的配额和用量", Description: "平台管理员不属于任何租户，返回404",
+				Response: services.TenantUsage{},
+			})
+			tenant.GET("/port-pools", handler.GetAvailablePortPools, openapi.Operation{
+				Summary:     "可自动分配中转端口的端口池",
+				Description: "租户有自己的端口池时返回自己的，否则返回平台共享的；创建服务器时l2tp_port为0即从中分配",
+				Response:    []services.PortPoolView{},
+			})
+		}
+
+		// 落地机镜像更新
+		images := newDocGroup(protected.Group("/images", superAdmin), spec, "镜像更新", false)
+		{
+			images.GET("", handler.GetServerImages, openapi.Operation{
+				Summary: "服务器容器镜像的更新检查结果", Description: "每6小时比对运行中容器的镜像摘要与镜像仓库中同一标签的最新摘要",
+				Params:   []openapi.Param{openapi.Query("updates", "boolean", "为true时只返回有可用更新的服务器")},
+				Response: []services.ServerImageStatus{},
+			})
+			images.POST("/check", handler.CheckServerImages, openapi.Operation{
+				Summary: "立即检查镜像更新", Response: []services.ServerImageStatus{},
+			})
+			images.POST("/rollout", handler.StartImageRollout, openapi.Operation{
+				Summary:     "滚动升级",
+				Description: "按批次重建容器并拉取最新镜像，每批完成后等待settle_seconds确认容器仍在运行，任一台失败则停止后续批次；server_ids为空时升级全部有可用更新的服务器",
+				Body:        services.RolloutRequest{}, Response: services.Rollout{},
+			})
+			images.GET("/rollout", handler.GetImageRollout, openapi.Operation{
+				Summary: "最近一次滚动升级的进度", Response: services.Rollout{},
+			})
+		}
+
+		// 端口池管理
+		portPools := newDocGroup(protected.Group("/port-pools", superAdmin), spec, "端口池", false)
+		{
+			portPools.GET("", handler.GetPortPools, openapi.Operation{
+				Summary: "端口池列表及使用情况", Response: []services.PortPoolView{},
+			})
+			portPools.POST("", handler.CreatePortPool, openapi.Operation{
+				Summary: "创建端口池", Description: "端口范围不能与其他端口池重叠；分配给租户时池内端口不能已被其他租户或平台的服务器使用",
+				Body: services.PortPoolRequest{}, Response: database.PortPool{},
+			})
+			portPools.PUT("/:id", handler.UpdatePortPool, openapi.Operation{
+				Summary: "修改端口池", Params: portPoolIDParam(), Body: services.PortPoolRequest{}, Response: database.PortPool{},
+			})
+			portPools.DELETE("/:id", handler.DeletePortPool, openapi.Operation{
+				Summary: "删除端口池", Description: "已使用池内端口的服务器不受影响",
+				Params: portPoolIDParam(),
+			})
+		}
+
+		// 端口登记表
+		ports := newDocGroup(protected.Group("/ports", superAdmin), spec, "端口池", false)
+		{
+			ports.GET("", handler.GetPorts, openapi.Operation{
+				Summary:     "端口占用情况",
+				Description: "面板自身监听的端口、服务器(含回收站)的中转端口和代理入站的监听端口。创建或修改服务器、代理时端口被占用返回409，data为占用端口的资源",
+				Params:      []openapi.Param{openapi.Query("port", "integer", "只返回占用该端口的资源")},
+				Response:    []services.PortOwner{},
+			})
+		}
+
+		// 租户管理
+		tenants := newDocGroup(protected.Group("/tenants", superAdmin), spec, "租户", false)
+		{
+			tenants.GET("", handler.GetTenants, openapi.Operation{
+				Summary: "租户列表及用量", Response: []services.TenantUsage{},
+			})
+			tenants.POST("", handler.CreateTenant, openapi.Operation{
+				Summary: "创建租户", Body: services.TenantRequest{}, Response: database.Tenant{},
+			})
+			tenants.GET("/:id", handler.GetTenant, openapi.Operation{
+				Summary: "租户详情及用量", Params: tenantIDParam(), Response: services.TenantUsage{},
+			})
+			tenants.PUT("/:id", handler.UpdateTenant, openapi.Operation{
+				Summary: "修改租户", Description: "停用后租户用户立即无法访问",
+				Params: tenantIDParam(), Body: services.TenantRequest{}, Response: database.Tenant{},
+			})
+			tenants.DELETE("/:id", handler.DeleteTenant, openapi.Operation{
+				Summary: "删除租户及其用户", Description: "租户下还有服务器(含回收站)时返回400",
+				Params: tenantIDParam(),
+			})
+			tenants.GET("/:id/users", handler.GetTenantUsers, openapi.Operation{
+				Summary: "租户用户列表", Params: tenantIDParam(), Response: []database.User{},
+			})
+			tenants.POST("/:id/users", handler.CreateTenantUser, openapi.Operation{
+				Summary: "创建租户用户", Params: tenantIDParam(), Body: services.TenantUserRequest{}, Response: database.User{},
+			})
+			tenants.DELETE("/:id/users/:userId", handler.DeleteTenantUser, openapi.Operation{
+				Summary: "删除租户用户",
+				Params:  append(tenantIDParam(), openapi.Path("userId", "integer", "用户ID")),
+			})
+			tenants.PUT("/:id/servers/:serverId", handler.AssignTenantServer, openapi.Operation{
+				Summary: "将服务器分配给租户", Description: "租户ID为0表示收回到平台；分配时检查租户的服务器数量上限",
+				Params:   append(tenantIDParam(), openapi.Path("serverId", "integer", "服务器ID")),
+				Response: database.L2TPServer{},
+			})
 		}
 	}
+}
+
+// rateLimits 需要限速的接口组，每组共用一个令牌桶集合
+type rateLimits struct {
+	serverOps gin.HandlerFunc // 启动/停止/重启服务器
+	logs      gin.HandlerFunc // 查看落地机日志
+	backup    gin.HandlerFunc // 备份和恢复数据库
+}
 
-	return r
-}
-
-// getContentType 根据文件扩展名返回Content-Type
-func getContentType(filepath string) string {
-	switch {
-	case filepath[len(filepath)-4:] == ".css":
-		return "text/css"
-	case filepath[len(filepath)-3:] == ".js":
-		return "application/javascript"
-	case filepath[len(filepath)-4:] == ".png":
-		return "image/png"
-	case filepath[len(filepath)-4:] == ".jpg" || filepath[len(filepath)-5:] == ".jpeg":
-		return "image/jpeg"
-	case filepath[len(filepath)-4:] == ".svg":
-		return "image/svg+xml"
-	case filepath[len(filepath)-4:] == ".ico":
-		return "image/x-icon"
-	default:
-		return "application/octet-stream"
+// newRateLimits 按设置创建各组限速，修改设置后立即生效
+func newRateLimits(settings *services.SettingsService) *rateLimits {
+	limit := func(key string) gin.HandlerFunc {
+		return middleware.RateLimit(func() int { return settings.Int(key) })
 	}
-} 
\ No newline at end of file
+	return &rateLimits{
+		serverOps: limit(services.SettingRateLimitServerOps),
+		logs:      limit(services.SettingRateLimitLogs),
+		backup:    limit(services.SettingRateLimitBackup),
+	}
+}
+
+// tenantIDParam 租户ID路径参数
+func tenantIDParam() []openapi.Param {
+	return []openapi.Param{openapi.Path("id", "integer", "租户ID")}
+}
+
+// portPoolIDParam 端口池ID路径参数
+func portPoolIDParam() []openapi.Param {
+	return []openapi.Param{openapi.Path("id", "integer", "端口池ID")}
+}
+
+// relayNodeIDParam 中转节点ID路径参数
+func relayNodeIDParam() []openapi.Param {
+	return []openapi.Param{openapi.Path("id", "integer", "中转节点ID")}
+}
+
+// pendingIDParam 落地机登记记录ID路径参数
+func pendingIDParam() []openapi.Param {
+	return []openapi.Param{openapi.Path("id", "integer", "登记记录ID")}
+}
+
+// proxyIDParam 代理入站ID路径参数
+func proxyIDParam() []openapi.Param {
+	return []openapi.Param{openapi.Path("id", "integer", "代理ID")}
+}
+
+// idParam 服务器ID路径参数
+func idParam() []openapi.Param {
+	return []openapi.Param{openapi.Path("id", "integer", "服务器ID")}
+}
+
+// idempotentParams 支持幂等键的服务器操作接口参数
+func idempotentParams() []openapi.Param {
+	return append(idParam(), openapi.Header("Idempotency-Key", "string", "幂等键，24小时内的重试返回首次的响应"))
+}
+
+// alertRuleIDParam 告警规则ID路径参数
+func alertRuleIDParam() []openapi.Param {
+	return []openapi.Param{openapi.Path("id", "integer", "告警规则ID")}
+}
+
+// webhookIDParam Webhook ID路径参数
+func webhookIDParam() []openapi.Param {
+	return []openapi.Param{openapi.Path("id", "integer", "Webhook ID")}
+}
+
+// logParams 日志查询参数
+func logParams() []openapi.Param {
+	return []openapi.Param{
+		openapi.Query("level", "string", "最低级别 debug/info/warn/error，默认debug"),
+		openapi.Query("since", "string", "开始时间(RFC3339)"),
+		openapi.Query("until", "string", "结束时间(RFC3339)"),
+		openapi.Query("q", "string", "按消息或属性值搜索"),
+		openapi.Query("after_seq", "integer", "只返回序号大于该值的日志"),
+		openapi.Query("limit", "integer", "返回最新的N条，默认200"),
+	}
+}
+
+// usageParams 用量报告的查询参数
+func usageParams() []openapi.Param {
+	return []openapi.Param{
+		openapi.Query("period", "string", "月份(YYYY-MM)，默认上个月"),
+		openapi.Query("server_id", "integer", "服务器ID，为空表示全部"),
+	}
+}
+
+// exportParams 导出接口的公共查询参数
+func exportParams() []openapi.Param {
+	return []openapi.Param{
+		openapi.Query("since", "string", "开始时间(RFC3339)"),
+		openapi.Query("until", "string", "结束时间(RFC3339)"),
+		openapi.Query("format", "string", "csv/xlsx/pdf，默认csv"),
+	}
+}
@@ -0,0 +1,153 @@
+package router
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"html"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"l2tp-manager/internal/api"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 前端缓存策略：页面每次使用前验证；带版本参数(?v=)的静态资源内容不会变化，长期缓存
+const (
+	cacheRevalidate = "no-cache"
+	cacheImmutable  = "public, max-age=31536000, immutable"
+)
+
+// apiPrefixes 不做前端路由回退的路径前缀，这些路径不存在时返回JSON或纯文本404
+var apiPrefixes = []string{"/api/", "/ws/", "/static/", "/metrics", "/healthz", "/readyz"}
+
+// staticSite 嵌入的前端文件，以public目录为根
+type staticSite struct {
+	files   http.FileSystem
+	base    string    // 页面中<base href>的取值，子路径部署时为 /子路径/
+	modTime time.Time // 前端文件随程序发布，以进程启动时间作为Last-Modified
+	cache   sync.Map  // 文件路径 -> *staticFile
+}
+
+// staticFile 读取后的文件内容和按内容生成的ETag
+type staticFile struct {
+	data []byte
+	etag string
+}
+
+// newStaticSite 以嵌入文件的public子目录创建前端文件服务，prefix为子路径前缀
+func newStaticSite(staticFiles embed.FS, prefix string) *staticSite {
+	sub, err := fs.Sub(staticFiles, "public")
+	if err != nil {
+		slog.Error("加载前端文件失败", "error", err)
+		sub = staticFiles
+	}
+	return &staticSite{files: http.FS(sub), base: prefix + "/", modTime: time.Now()}
+}
+
+// load 读取文件，HTML页面中的 <base href="/"> 替换为子路径，页面内的相对地址随之指向子路径。
+// 文件不存在或是目录时返回nil
+func (s *staticSite) load(name string) *staticFile {
+	if cached, ok := s.cache.Load(name); ok {
+		return cached.(*staticFile)
+	}
+	file, err := s.files.Open(name)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		return nil
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil
+	}
+	if path.Ext(name) == ".html" && s.base != "/" {
+		data = bytes.Replace(data, []byte(`<base href="/">`), []byte(`<base href="`+html.EscapeString(s.base)+`">`), 1)
+	}
+
+	sum := sha256.Sum256(data)
+	loaded := &staticFile{data: data, etag: `"` + hex.EncodeToString(sum[:12]) + `"`}
+	s.cache.Store(name, loaded)
+	return loaded
+}
+
+// serve 输出前端文件，Content-Type按扩展名确定，带ETag和Last-Modified，
+// 未变化时返回304。文件不存在或是目录时返回false
+func (s *staticSite) serve(c *gin.Context, name, cacheControl string) bool {
+	name = path.Clean("/" + name)
+	file := s.load(name)
+	if file == nil {
+		return false
+	}
+	c.Header("ETag", file.etag)
+	c.Header("Cache-Control", cacheControl)
+	http.ServeContent(c.Writer, c.Request, name, s.modTime, bytes.NewReader(file.data))
+	return true
+}
+
+// page 输出HTML页面
+func (s *staticSite) page(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !s.serve(c, name, cacheRevalidate) {
+			c.String(http.StatusNotFound, "页面未找到")
+		}
+	}
+}
+
+// asset 输出 /static 下的资源，请求带版本参数v时允许长期缓存
+func (s *staticSite) asset(c *gin.Context) {
+	cacheControl := cacheRevalidate
+	if c.Query("v") != "" {
+		cacheControl = cacheImmutable
+	}
+	if !s.serve(c, "static"+c.Param("filepath"), cacheControl) {
+		c.String(http.StatusNotFound, "文件未找到")
+	}
+}
+
+// fallback 未匹配路由的处理：浏览器访问前端路由(如刷新 /servers/1)时返回对应页面，
+// 由前端脚本按路径渲染；API等其他请求返回404
+func (s *staticSite) fallback(c *gin.Context) {
+	if wantsPage(c) {
+		name := "index.html"
+		if c.Request.URL.Path == "/portal" || strings.HasPrefix(c.Request.URL.Path, "/portal/") {
+			name = "portal.html"
+		}
+		if s.serve(c, name, cacheRevalidate) {
+			return
+		}
+	}
+	c.JSON(http.StatusNotFound, api.ApiResponse{
+		Success: false,
+		Message: "接口不存在",
+	})
+}
+
+// wantsPage 是否为浏览器对前端路由的页面请求
+func wantsPage(c *gin.Context) bool {
+	if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		return false
+	}
+	requestPath := c.Request.URL.Path
+	for _, prefix := range apiPrefixes {
+		if strings.HasPrefix(requestPath, prefix) {
+			return false
+		}
+	}
+	// 带扩展名的路径是对文件的请求，不回退到页面
+	if path.Ext(requestPath) != "" {
+		return false
+	}
+	return strings.Contains(c.GetHeader("Accept"), "text/html")
+}
@@ -0,0 +1,244 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"l2tp-manager/internal/database"
+	"l2tp-manager/internal/metrics"
+
+	"gorm.io/gorm"
+)
+
+// accountQuotaBytes 账号的月流量配额(字节)，0表示不限
+func accountQuotaBytes(user L2TPUser) int64 {
+	return user.QuotaGB * 1024 * 1024 * 1024
+}
+
+// accountPolicyCommands 启用或停用SoftEther账号的vpncmd命令：停用时将账号的Access策略设为禁止，
+// 新的登录被拒绝；启用时恢复允许。策略保存在容器内的SoftEther配置中，容器重建后由下一次配额检查重新停用
+func accountPolicyCommands(hub string, usernames []string, enabled bool) []string {
+	value := "no"
+	if enabled {
+		value = "yes"
+	}
+	commands := make([]string, 0, len(usernames))
+	for _, username := range usernames {
+		commands = append(commands, vpncmdCommand(hub, "UserPolicySet", shellQuote(username), "/NAME:Access", "/VALUE:"+value))
+	}
+	return commands
+}
+
+// parseUserSessions 解析vpncmd SessionList的CSV输出，返回属于指定账号(不区分大小写)的会话名称
+func parseUserSessions(output string, usernames []string) []string {
+	start := strings.Index(output, "Session Name")
+	if start < 0 {
+		return nil
+	}
+	records, err := csv.NewReader(strings.NewReader(output[start:])).ReadAll()
+	if err != nil || len(records) == 0 {
+		return nil
+	}
+	column := -1
+	for i, name := range records[0] {
+		if strings.TrimSpace(name) == "User Name" {
+			column = i
+		}
+	}
+	if column < 0 {
+		return nil
+	}
+	var sessions []string
+	for _, record := range records[1:] {
+		if len(record) <= column {
+			continue
+		}
+		for _, username := range usernames {
+			if strings.EqualFold(strings.TrimSpace(record[column]), username) {
+				sessions = append(sessions, record[0])
+				break
+			}
+		}
+	}
+	return sessions
+}
+
+// SetAccountsEnabled 在落地机SoftEther中启用或停用账号，停用时同时断开这些账号的在线会话
+func (s *SSHService) SetAccountsEnabled(server *database.L2TPServer, usernames []string, enabled bool) (err error) {
+	defer func(start time.Time) { metrics.ObserveSSH("account_policy", start, err) }(time.Now())
+
+	if server.Type != ServerTypeL2TP {
+		return fmt.Errorf("只有L2TP服务器支持停用账号")
+	}
+	if len(usernames) == 0 {
+		return nil
+	}
+	client, err := s.createSSHClient(server)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	hub := softEtherHub(server)
+	if _, err := s.executeCommand(client, strings.Join(accountPolicyCommands(hub, usernames, enabled), " && ")); err != nil {
+		return err
+	}
+	if enabled {
+		return nil
+	}
+	output, err := s.executeCommand(client, vpncmdCommand(hub, "SessionList"))
+	if err != nil {
+		return fmt.Errorf("获取会话列表失败: %v", err)
+	}
+	for _, session := range parseUserSessions(output, usernames) {
+		// 会话可能已自行断开，断开失败不影响停用
+		if _, err := s.executeCommand(client, vpncmdCommand(hub, "SessionDisconnect", shellQuote(session))); err != nil {
+			slog.Warn("断开停用账号的会话失败", "server_id", server.ID, "session", session, "error", err)
+		}
+	}
+	return nil
+}
+
+// enforceAccountQuotas 检查服务器各账号本计费周期的流量配额：超额的账号在落地机上停用并通知，
+// 已停用的账号每次重新停用(容器重建后策略丢失)，配额提高、取消或管理员手动恢复后重新启用，上期停用的账号在新的计费周期开始时恢复
+func (u *UsageService) enforceAccountQuotas(ctx context.Context, server *database.L2TPServer, now time.Time) error {
+	u.quotaMutex.Lock()
+	defer u.quotaMutex.Unlock()
+
+	var users []L2TPUser
+	if server.Users != "" {
+		if err := json.Unmarshal([]byte(server.Users), &users); err != nil {
+			return fmt.Errorf("用户配置格式错误: %v", err)
+		}
+	}
+	quotas := make(map[string]L2TPUser, len(users))
+	for _, user := range users {
+		quotas[user.Username] = user
+	}
+
+	period := billingPeriodLabel(server, now)
+	var usages []database.AccountUsage
+	if err := u.db.Where("server_id = ? AND (period = ? OR suspended = ?)", server.ID, period, true).Find(&usages).Error; err != nil {
+		return err
+	}
+
+	var suspend, resume []string
+	var suspended, resumed []database.AccountUsage
+	for _, usage := range usages {
+		user, configured := quotas[usage.Username]
+		over := usage.Period == period && configured && user.QuotaGB > 0 && !usage.QuotaOverride && usage.Bytes >= accountQuotaBytes(user)
+		switch {
+		case over:
+			suspend = append(suspend, usage.Username)
+			if !usage.Suspended {
+				suspended = append(suspended, usage)
+			}
+		case usage.Suspended:
+			// 已从用户配置中删除的账号在落地机上随容器重建删除，只清除停用标记
+			if configured {
+				resume = append(resume, usage.Username)
+			}
+			resumed = append(resumed, usage)
+		}
+	}
+	if len(suspend) == 0 && len(resumed) == 0 {
+		return nil
+	}
+
+	client := u.sshService.WithContext(ctx)
+	if err := client.SetAccountsEnabled(server, resume, true); err != nil {
+		return fmt.Errorf("恢复账号失败: %v", err)
+	}
+	for _, usage := range resumed {
+		if err := u.db.Model(&database.AccountUsage{}).Where("id = ?", usage.ID).
+			Updates(map[string]interface{}{"suspended": false, "suspended_at": nil}).Error; err != nil {
+			return err
+		}
+		slog.Info("已恢复停用的账号", "server_id", server.ID, "username", usage.Username, "period", usage.Period)
+	}
+
+	if err := client.SetAccountsEnabled(server, suspend, false); err != nil {
+		return fmt.Errorf("停用超额账号失败: %v", err)
+	}
+	for _, usage := range suspended {
+		if err := u.db.Model(&database.AccountUsage{}).Where("id = ?", usage.ID).
+			Updates(map[string]interface{}{"suspended": true, "suspended_at": now}).Error; err != nil {
+			return err
+		}
+		quota := quotas[usage.Username].QuotaGB
+		slog.Warn("账号流量超出配额，已停用", "server_id", server.ID, "username", usage.Username, "bytes", usage.Bytes, "quota_gb", quota)
+		if u.notifier != nil {
+			u.notifier.Publish(Event{
+				Type:       EventAccountSuspended,
+				ServerID:   server.ID,
+				ServerName: server.Name,
+				Message:    fmt.Sprintf("账号 %s 本期流量 %s 已超出配额 %dGB，已在落地机上停用", usage.Username, FormatBytes(usage.Bytes), quota),
+				Data:       map[string]interface{}{"username": usage.Username, "bytes": usage.Bytes, "quota_gb": quota, "period": usage.Period},
+			})
+		}
+	}
+	return nil
+}
+
+// ResumeAccount 管理员手动恢复账号：本计费周期不再因超额停用，已停用时立即在落地机上启用。下一周期重新按配额检查
+func (u *UsageService) ResumeAccount(ctx context.Context, server *database.L2TPServer, username string) error {
+	u.quotaMutex.Lock()
+	defer u.quotaMutex.Unlock()
+
+	var users []L2TPUser
+	if server.Users != "" {
+		if err := json.Unmarshal([]byte(server.Users), &users); err != nil {
+			return fmt.Errorf("用户配置格式错误: %v", err)
+		}
+	}
+	configured := false
+	for _, user := range users {
+		configured = configured || user.Username == username
+	}
+	if !configured {
+		return fmt.Errorf("账号不存在")
+	}
+
+	period := billingPeriodLabel(server, time.Now())
+	var usages []database.AccountUsage
+	if err := u.db.Where("server_id = ? AND username = ? AND (period = ? OR suspended = ?)", server.ID, username, period, true).Find(&usages).Error; err != nil {
+		return err
+	}
+	needsEnable := false
+	for _, usage := range usages {
+		needsEnable = needsEnable || usage.Suspended
+	}
+	// 未运行的服务器启动时重新创建容器和账号，只清除停用标记
+	if needsEnable && server.Status == "running" {
+		if err := u.sshService.WithContext(ctx).SetAccountsEnabled(server, []string{username}, true); err != nil {
+			return fmt.Errorf("恢复账号失败: %v", err)
+		}
+	}
+
+	return u.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&database.AccountUsage{}).Where("server_id = ? AND username = ? AND suspended = ?", server.ID, username, true).
+			Updates(map[string]interface{}{"suspended": false, "suspended_at": nil}).Error; err != nil {
+			return err
+		}
+		// 本期尚无流量记录时以最近一期的计数为基准创建一条，保存手动恢复标记
+		var current database.AccountUsage
+		if err := tx.Where("server_id = ? AND username = ?", server.ID, username).Order("period DESC").Limit(1).Find(&current).Error; err != nil {
+			return err
+		}
+		if current.ID == 0 {
+			return fmt.Errorf("账号尚未采集到流量，无需恢复")
+		}
+		if current.Period != period {
+			return tx.Create(&database.AccountUsage{
+				ServerID: server.ID, Username: username, Period: period, QuotaOverride: true,
+				LastCounter: current.LastCounter, LastOutgoing: current.LastOutgoing, LastIncoming: current.LastIncoming,
+			}).Error
+		}
+		return tx.Model(&current).Update("quota_override", true).Error
+	})
+}
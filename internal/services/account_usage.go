@@ -0,0 +1,273 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"l2tp-manager/internal/database"
+
+	"gorm.io/gorm"
+)
+
+// SettingAccountUsageInterval 读取落地机L2TP账号流量计数的间隔
+const SettingAccountUsageInterval = "account_usage_interval"
+
+// 账号流量采集参数
+const (
+	accountUsageDefaultInterval = 3600 // 默认采集间隔(秒)
+	minAccountUsageInterval     = 60   // 采集间隔下限(秒)，每次采集需要对每个账号执行一次vpncmd
+	// userGetMarker 批量执行UserGet时每个用户输出前的分隔行
+	userGetMarker = "### l2tp-manager-user "
+)
+
+// userGetSizeItems vpncmd UserGet输出中的传输字节数项，单播和广播分别统计
+var userGetSizeItems = map[string]bool{
+	"Outgoing Unicast Total Size":   true,
+	"Outgoing Broadcast Total Size": true,
+	"Incoming Unicast Total Size":   false,
+	"Incoming Broadcast Total Size": false,
+}
+
+// AccountCounter SoftEther用户自创建以来的累计传输字节数，方向沿用SoftEther的Outgoing/Incoming
+type AccountCounter struct {
+	Outgoing int64 `json:"outgoing"`
+	Incoming int64 `json:"incoming"`
+}
+
+// Total 双向合计
+func (c AccountCounter) Total() int64 {
+	return c.Outgoing + c.Incoming
+}
+
+// AccountUsageView 账号在一个计费周期内的流量及配额使用情况
+type AccountUsageView struct {
+	Username      string     `json:"username"`
+	Period        string     `json:"period"`
+	PeriodStart   time.Time  `json:"period_start"`
+	PeriodEnd     time.Time  `json:"period_end"`
+	Bytes         int64      `json:"bytes"`
+	OutgoingBytes int64      `json:"outgoing_bytes"`
+	IncomingBytes int64      `json:"incoming_bytes"`
+	QuotaGB       int64      `json:"quota_gb"`                // 每个计费周期的流量配额(GB)，0表示不限
+	QuotaPercent  float64    `json:"quota_percent,omitempty"` // 已用配额百分比
+	Configured    bool       `json:"configured"`              // 是否仍在服务器的用户配置中
+	Suspended     bool       `json:"suspended"`               // 因超出配额在落地机上被停用
+	SuspendedAt   *time.Time `json:"suspended_at,omitempty"`
+	QuotaOverride bool       `json:"quota_override"`       // 管理员已手动恢复，本期不再因超额停用
+	UpdatedAt     *time.Time `json:"updated_at,omitempty"` // 最近一次采集时间，尚未采集时为空
+}
+
+// quotaPercent 流量占配额(GB)的百分比，保留两位小数
+func quotaPercent(bytes, quotaGB int64) float64 {
+	return math.Round(float64(bytes)*10000/float64(quotaGB*1024*1024*1024)) / 100
+}
+
+// validateAccountQuotas 校验账号流量配额，只有L2TP服务器能从落地机读取账号流量
+func validateAccountQuotas(server *database.L2TPServer) error {
+	if server.Users == "" {
+		return nil
+	}
+	var users []L2TPUser
+	if err := json.Unmarshal([]byte(server.Users), &users); err != nil {
+		return fmt.Errorf("用户配置格式错误: %v", err)
+	}
+	for _, user := range users {
+		if user.QuotaGB < 0 {
+			return fmt.Errorf("用户 %s 的流量配额不能为负数", user.Username)
+		}
+		if user.QuotaGB > 0 && server.Type != ServerTypeL2TP {
+			return fmt.Errorf("只有L2TP服务器支持账号流量配额")
+		}
+	}
+	return nil
+}
+
+// parseUserNames 解析vpncmd UserList的CSV输出中的用户名
+func parseUserNames(output string) ([]string, error) {
+	start := strings.Index(output, "User Name")
+	if start < 0 {
+		return nil, fmt.Errorf("无法识别的用户列表输出")
+	}
+	records, err := csv.NewReader(strings.NewReader(output[start:])).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("解析用户列表失败: %v", err)
+	}
+	var usernames []string
+	for _, record := range records[1:] {
+		if len(record) > 0 && record[0] != "" {
+			usernames = append(usernames, record[0])
+		}
+	}
+	return usernames, nil
+}
+
+// userGetScript 逐个读取用户的详细信息，每个用户的输出前有分隔行。个别用户读取失败(如采集期间被删除)时继续读取其他用户
+func userGetScript(hub string, usernames []string) string {
+	commands := make([]string, 0, len(usernames))
+	for _, username := range usernames {
+		commands = append(commands, fmt.Sprintf("echo %s; %s || true",
+			shellQuote(userGetMarker+username), vpncmdCommand(hub, "UserGet", shellQuote(username))))
+	}
+	return strings.Join(commands, "; ")
+}
+
+// parseUserGet 解析批量UserGet的输出，传输字节数形如 "1,234 bytes"。没有读取到传输字节数的用户不返回
+func parseUserGet(output string) map[string]AccountCounter {
+	counters := make(map[string]AccountCounter)
+	username, found := "", false
+	var counter AccountCounter
+	flush := func() {
+		if username != "" && found {
+			counters[username] = counter
+		}
+	}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if name, ok := strings.CutPrefix(line, userGetMarker); ok {
+			flush()
+			username, found, counter = name, false, AccountCounter{}
+			continue
+		}
+		record, err := csv.NewReader(strings.NewReader(line)).Read()
+		if err != nil || len(record) < 2 {
+			continue
+		}
+		outgoing, ok := userGetSizeItems[strings.TrimSpace(record[0])]
+		if !ok {
+			continue
+		}
+		digits := strings.Map(func(r rune) rune {
+			if r >= '0' && r <= '9' {
+				return r
+			}
+			return -1
+		}, record[1])
+		value, err := strconv.ParseInt(digits, 10, 64)
+		if err != nil {
+			continue
+		}
+		if outgoing {
+			counter.Outgoing += value
+		} else {
+			counter.Incoming += value
+		}
+		found = true
+	}
+	flush()
+	return counters
+}
+
+// accountUsageInterval 生效的账号流量采集间隔，0表示关闭
+func (u *UsageService) accountUsageInterval() time.Duration {
+	interval := u.settings.Seconds(SettingAccountUsageInterval)
+	if interval <= 0 {
+		return 0
+	}
+	return max(interval, minAccountUsageInterval*time.Second)
+}
+
+// collectLoop 按设置的间隔采集账号流量，间隔修改后立即生效
+func (u *UsageService) collectLoop(ctx context.Context) {
+	changed := u.settings.Watch(SettingAccountUsageInterval)
+	for {
+		timer := newIntervalTimer(u.accountUsageInterval())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-changed:
+			timer.Stop()
+		case <-timer.C:
+			u.collectAccounts(ctx, time.Now())
+		}
+	}
+}
+
+// CollectServer 立即读取一台运行中L2TP服务器的账号流量计数并计入本计费周期的流量，随后检查账号流量配额
+func (u *UsageService) CollectServer(ctx context.Context, server *database.L2TPServer) error {
+	if server.Type != ServerTypeL2TP {
+		return fmt.Errorf("只有L2TP服务器支持账号流量统计")
+	}
+	if server.Status != "running" {
+		return fmt.Errorf("服务器未运行")
+	}
+	counters, err := u.sshService.WithContext(ctx).GetAccountCounters(server)
+	if err != nil {
+		return fmt.Errorf("读取账号流量计数失败: %v", err)
+	}
+	now := time.Now()
+	if err := u.RecordCounters(server, counters, now); err != nil {
+		return err
+	}
+	return u.enforceAccountQuotas(ctx, server, now)
+}
+
+// Accounts 服务器各账号在指定月份开始的计费周期内的流量和配额使用情况，period为空时为当前周期。
+// 包括尚无流量的账号和已从用户配置中删除但有流量的账号
+func (u *UsageService) Accounts(server *database.L2TPServer, period string) ([]AccountUsageView, error) {
+	billing := CurrentBillingPeriod(server, time.Now())
+	if period != "" {
+		var err error
+		if billing, err = BillingPeriodOf(server, period); err != nil {
+			return nil, err
+		}
+	}
+	period = billing.Period
+	var users []L2TPUser
+	if server.Users != "" {
+		if err := json.Unmarshal([]byte(server.Users), &users); err != nil {
+			return nil, fmt.Errorf("用户配置格式错误: %v", err)
+		}
+	}
+	var usages []database.AccountUsage
+	if err := u.db.Where("server_id = ? AND period = ?", server.ID, period).Find(&usages).Error; err != nil {
+		return nil, err
+	}
+
+	views := make(map[string]*AccountUsageView)
+	for _, user := range users {
+		views[user.Username] = &AccountUsageView{Username: user.Username, Period: period, PeriodStart: billing.Start, PeriodEnd: billing.End, QuotaGB: user.QuotaGB, Configured: true}
+	}
+	for _, usage := range usages {
+		view := views[usage.Username]
+		if view == nil {
+			view = &AccountUsageView{Username: usage.Username, Period: period, PeriodStart: billing.Start, PeriodEnd: billing.End}
+			views[usage.Username] = view
+		}
+		updatedAt := usage.UpdatedAt
+		view.Bytes, view.OutgoingBytes, view.IncomingBytes, view.UpdatedAt = usage.Bytes, usage.OutgoingBytes, usage.IncomingBytes, &updatedAt
+		view.Suspended, view.SuspendedAt, view.QuotaOverride = usage.Suspended, usage.SuspendedAt, usage.QuotaOverride
+	}
+
+	result := make([]AccountUsageView, 0, len(views))
+	for _, view := range views {
+		if view.QuotaGB > 0 {
+			view.QuotaPercent = quotaPercent(view.Bytes, view.QuotaGB)
+		}
+		result = append(result, *view)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Username < result[j].Username })
+	return result, nil
+}
+
+// accountPeriodBytes 服务器各账号本计费周期的流量，读取失败时返回空
+func accountPeriodBytes(db *gorm.DB, server *database.L2TPServer, now time.Time) map[string]int64 {
+	var usages []database.AccountUsage
+	if err := db.Select("username", "bytes").Where("server_id = ? AND period = ?", server.ID, billingPeriodLabel(server, now)).Find(&usages).Error; err != nil {
+		slog.Warn("读取账号流量失败", "server_id", server.ID, "error", err)
+		return nil
+	}
+	result := make(map[string]int64, len(usages))
+	for _, usage := range usages {
+		result[usage.Username] = usage.Bytes
+	}
+	return result
+}
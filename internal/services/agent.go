@@ -0,0 +1,261 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"l2tp-manager/internal/database"
+
+	"github.com/gorilla/websocket"
+)
+
+// 中转节点上报参数
+const (
+	agentStatusInterval = 10 * time.Second // 上报转发器状态的间隔
+	agentFlowInterval   = 5 * time.Second  // 上报流量记录的间隔
+	agentFlowBatch      = 500              // 单条消息最多携带的流量记录数
+	agentMaxBackoff     = 30 * time.Second // 重连最长等待时间
+)
+
+// RelayAgent 中转节点：只运行转发引擎，主动连接面板接收转发配置并上报吞吐量和流量记录。
+// 与面板断开期间保持现有转发继续运行，重连后按面板下发的配置收敛
+type RelayAgent struct {
+	panelURL string
+	token    string
+	name     string
+	version  string
+	routing  *RoutingService
+	pipeline *TrafficPipeline
+	servers  map[uint]*database.L2TPServer // 服务器ID -> 当前运行的配置
+	mutex    sync.Mutex
+}
+
+// NewRelayAgent 创建中转节点，panelURL为面板地址(如 https://panel.example.com)
+func NewRelayAgent(panelURL, token, name, version string) *RelayAgent {
+	pipeline := NewTrafficPipeline(nil)
+	routing := NewRoutingService(nil)
+	routing.SetTrafficPipeline(pipeline)
+	return &RelayAgent{
+		panelURL: strings.TrimRight(panelURL, "/"),
+		token:    token,
+		name:     name,
+		version:  version,
+		routing:  routing,
+		pipeline: pipeline,
+		servers:  make(map[uint]*database.L2TPServer),
+	}
+}
+
+// SetForwardMode 设置转发方式(userspace或kernel)，需在Run之前调用
+func (a *RelayAgent) SetForwardMode(mode string) {
+	a.routing.SetForwardMode(mode)
+}
+
+// SetGeoIP 设置GeoIP数据库，用于执行服务器的国家访问策略，需在Run之前调用
+func (a *RelayAgent) SetGeoIP(geoip *GeoIPDatabase) {
+	a.routing.SetGeoIP(geoip)
+}
+
+// connectURL 节点连接地址，http(s)替换为ws(s)
+func (a *RelayAgent) connectURL() (string, error) {
+	u, err := url.Parse(a.panelURL)
+	if err != nil {
+		return "", fmt.Errorf("面板地址无效: %v", err)
+	}
+	switch u.Scheme {
+	case "http", "ws":
+		u.Scheme = "ws"
+	case "https", "wss":
+		u.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("面板地址无效: 不支持的协议 %q", u.Scheme)
+	}
+	u.Path = strings.TrimRight(u.Path, "/") + "/api/v1/agents/connect"
+	u.RawQuery = url.Values{"name": {a.name}}.Encode()
+	return u.String(), nil
+}
+
+// Run 启动转发引擎并保持与面板的连接，直到ctx结束
+func (a *RelayAgent) Run(ctx context.Context) error {
+	target, err := a.connectURL()
+	if err != nil {
+		return err
+	}
+
+	if err := a.routing.Start(ctx); err != nil {
+		return err
+	}
+	defer a.routing.Stop()
+
+	backoff := time.Second
+	for {
+		started := time.Now()
+		err := a.session(ctx, target)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if time.Since(started) > agentMaxBackoff {
+			backoff = time.Second // 连接曾稳定运行，重新从短间隔开始
+		}
+		slog.Warn("与面板的连接已断开，稍后重连", "error", err, "retry_in", backoff)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > agentMaxBackoff {
+			backoff = agentMaxBackoff
+		}
+	}
+}
+
+// session 单次连接：接收配置并定期上报，连接断开时返回
+func (a *RelayAgent) session(ctx context.Context, target string) error {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+a.token)
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, target, header)
+	if err != nil {
+		if resp != nil {
+			return fmt.Errorf("连接面板失败: %v (HTTP %d)", err, resp.StatusCode)
+		}
+		return fmt.Errorf("连接面板失败: %v", err)
+	}
+	defer conn.Close()
+	slog.Info("已连接面板", "panel", a.panelURL, "agent", a.name)
+
+	hostname, _ := os.Hostname()
+	outgoing := make(chan AgentMessage, agentSendQueue)
+	outgoing <- AgentMessage{Type: AgentMsgHello, Hello: &AgentHello{Version: a.version, Hostname: hostname, CPUs: runtime.NumCPU()}}
+
+	// 读取面板下发的消息，面板定期ping，超时未收到任何消息视为断线
+	readErr := make(chan error, 1)
+	go func() {
+		conn.SetReadDeadline(time.Now().Add(agentReadTimeout))
+		conn.SetPingHandler(func(data string) error {
+			conn.SetReadDeadline(time.Now().Add(agentReadTimeout))
+			return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(wsWriteTimeout))
+		})
+		for {
+			var message AgentMessage
+			if err := conn.ReadJSON(&message); err != nil {
+				readErr <- err
+				return
+			}
+			conn.SetReadDeadline(time.Now().Add(agentReadTimeout))
+			if message.Type == AgentMsgConfig {
+				a.apply(message.Servers)
+				select {
+				case outgoing <- a.status():
+				default:
+				}
+			}
+		}
+	}()
+
+	throughput := time.NewTicker(throughputInterval)
+	defer throughput.Stop()
+	status := time.NewTicker(agentStatusInterval)
+	defer status.Stop()
+	flows := time.NewTicker(agentFlowInterval)
+	defer flows.Stop()
+
+	send := func(message AgentMessage) error {
+		conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		return conn.WriteJSON(message)
+	}
+
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(time.Second))
+			return nil
+		case err = <-readErr:
+			return err
+		case message := <-outgoing:
+			err = send(message)
+		case <-throughput.C:
+			if samples := a.routing.Throughput(); len(samples) > 0 {
+				err = send(AgentMessage{Type: AgentMsgThroughput, Throughput: samples})
+			}
+		case <-status.C:
+			err = send(a.status())
+		case <-flows.C:
+			for records := a.pipeline.Drain(agentFlowBatch); len(records) > 0 && err == nil; records = a.pipeline.Drain(agentFlowBatch) {
+				err = send(AgentMessage{Type: AgentMsgFlows, Flows: records})
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// apply 按面板下发的配置增删或更新本地转发器
+func (a *RelayAgent) apply(servers []AgentServer) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	desired := make(map[uint]*database.L2TPServer, len(servers))
+	for _, server := range servers {
+		desired[server.ID] = server.toServer()
+	}
+
+	// 先移除不再负责的服务器，释放端口
+	for id, current := range a.servers {
+		if _, ok := desired[id]; !ok {
+			a.routing.RemoveL2TPServer(current.L2TPPort)
+			delete(a.servers, id)
+			slog.Info("移除转发配置", "server", current.Name)
+		}
+	}
+	for id, server := range desired {
+		current, exists := a.servers[id]
+		switch {
+		case !exists:
+			a.routing.AddL2TPServer(server)
+			slog.Info("添加转发配置", "server", server.Name, "host", server.Host, "port", server.L2TPPort)
+		case !sameForwardRules(current, server) || current.Name != server.Name:
+			a.routing.ReloadL2TPServer(current.L2TPPort, server)
+			slog.Info("更新转发配置", "server", server.Name, "host", server.Host, "port", server.L2TPPort)
+		}
+		a.servers[id] = server
+	}
+}
+
+// status 当前负责的全部转发规则及其运行状态
+func (a *RelayAgent) status() AgentMessage {
+	running := make(map[int]bool)
+	for _, rule := range a.routing.ActiveForwardRules() {
+		running[rule.ListenPort] = true
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	forwarders := []AgentForwarder{}
+	for _, server := range a.servers {
+		for i, rule := range ForwardRules(server) {
+			forwarder := AgentForwarder{
+				ServerID: server.ID,
+				Protocol: rule.Protocol,
+				Port:     rule.ListenPort,
+				Running:  running[rule.ListenPort],
+			}
+			if probe, ok := a.routing.HopProbe(server.ID); ok && i == 0 {
+				forwarder.Probe = &probe
+			}
+			forwarders = append(forwarders, forwarder)
+		}
+	}
+	return AgentMessage{Type: AgentMsgStatus, Forwarders: forwarders}
+}
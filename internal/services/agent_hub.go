@@ -0,0 +1,449 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"l2tp-manager/internal/database"
+
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+)
+
+// 中转节点协议消息类型，消息为JSON文本帧
+const (
+	AgentMsgHello      = "hello"      // 节点 -> 面板：节点信息，连接后首条消息
+	AgentMsgConfig     = "config"     // 面板 -> 节点：节点应运行的全部转发配置
+	AgentMsgStatus     = "status"     // 节点 -> 面板：转发器运行状态
+	AgentMsgThroughput = "throughput" // 节点 -> 面板：实时吞吐量
+	AgentMsgFlows      = "flows"      // 节点 -> 面板：流量记录
+)
+
+// 中转节点连接参数
+const (
+	agentPingInterval = 20 * time.Second // 面板发送ping的间隔
+	agentReadTimeout  = 60 * time.Second // 超过该时间未收到任何消息视为断线
+	agentResyncPeriod = 30 * time.Second // 定期核对下发的配置，防止遗漏变更通知
+	agentSendQueue    = 16               // 每个节点的待发送消息数
+	agentHeartbeat    = 30 * time.Second // 节点最近活跃时间写入数据库的最短间隔
+)
+
+// agentNamePattern 中转节点名称格式
+var agentNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// ValidAgentName 中转节点名称是否有效
+func ValidAgentName(name string) bool {
+	return agentNamePattern.MatchString(name)
+}
+
+// AgentMessage 面板与中转节点之间的消息
+type AgentMessage struct {
+	Type       string             `json:"type"`
+	Hello      *AgentHello        `json:"hello,omitempty"`
+	Servers    []AgentServer      `json:"servers,omitempty"`
+	Forwarders []AgentForwarder   `json:"forwarders,omitempty"`
+	Throughput []ThroughputSample `json:"throughput,omitempty"`
+	Flows      []FlowRecord       `json:"flows,omitempty"`
+}
+
+// AgentHello 中转节点上报的基本信息
+type AgentHello struct {
+	Version  string `json:"version"`
+	Hostname string `json:"hostname"`
+	CPUs     int    `json:"cpus"`
+}
+
+// AgentServer 下发给中转节点的转发配置，只包含转发所需字段，不含SSH凭据和PSK
+type AgentServer struct {
+	ID               uint   `json:"id"`
+	Name             string `json:"name"`
+	Type             string `json:"type,omitempty"`
+	Host             string `json:"host"`
+	L2TPPort         int    `json:"l2tp_port"`
+	EnableOpenVPN    bool   `json:"enable_openvpn,omitempty"`
+	OpenVPNRelayPort int    `json:"openvpn_relay_port,omitempty"`
+	EnableSSTP       bool   `json:"enable_sstp,omitempty"`
+	SSTPRelayPort    int    `json:"sstp_relay_port,omitempty"`
+	OpenVPNProto     string `json:"openvpn_proto,omitempty"`
+	IKEv2NATPort     int    `json:"ikev2_nat_port,omitempty"`
+	NextHop          string `json:"next_hop,omitempty"` // 链式转发的下一跳节点地址，为空表示转发到落地机
+	Hop              int    `json:"hop,omitempty"`      // 在转发链中的位置，0为入口，流量只由入口统计
+	GeoIPMode        string `json:"geoip_mode,omitempty"`
+	GeoIPCountries   string `json:"geoip_countries,omitempty"`
+	ReportedIP       string `json:"reported_ip,omitempty"` // 落地机上报的IP，最后一跳优先转发到该IP
+}
+
+// agentServerOf 提取服务器的转发配置
+func agentServerOf(server *database.L2TPServer) AgentServer {
+	return AgentServer{
+		ID:               server.ID,
+		Name:             server.Name,
+		Type:             server.Type,
+		Host:             server.Host,
+		L2TPPort:         server.L2TPPort,
+		EnableOpenVPN:    server.EnableOpenVPN,
+		OpenVPNRelayPort: server.OpenVPNRelayPort,
+		EnableSSTP:       server.EnableSSTP,
+		SSTPRelayPort:    server.SSTPRelayPort,
+		OpenVPNProto:     server.OpenVPNProto,
+		IKEv2NATPort:     server.IKEv2NATPort,
+		GeoIPMode:        server.GeoIPMode,
+		GeoIPCountries:   server.GeoIPCountries,
+		ReportedIP:       server.ReportedIP,
+	}
+}
+
+// toServer 转换为中转节点本地路由服务使用的服务器记录
+func (s AgentServer) toServer() *database.L2TPServer {
+	server := &database.L2TPServer{
+		Name:             s.Name,
+		Type:             s.Type,
+		Host:             s.Host,
+		L2TPPort:         s.L2TPPort,
+		EnableOpenVPN:    s.EnableOpenVPN,
+		OpenVPNRelayPort: s.OpenVPNRelayPort,
+		EnableSSTP:       s.EnableSSTP,
+		SSTPRelayPort:    s.SSTPRelayPort,
+		OpenVPNProto:     s.OpenVPNProto,
+		IKEv2NATPort:     s.IKEv2NATPort,
+		NextHop:          s.NextHop,
+		GeoIPMode:        s.GeoIPMode,
+		GeoIPCountries:   s.GeoIPCountries,
+		ReportedIP:       s.ReportedIP,
+		Status:           "running",
+	}
+	server.ID = s.ID
+	return server
+}
+
+// AgentForwarder 中转节点上单个转发规则的运行状态
+type AgentForwarder struct {
+	ServerID uint      `json:"server_id"`
+	Protocol string    `json:"protocol"`
+	Port     int       `json:"port"`
+	Running  bool      `json:"running"`
+	Probe    *HopProbe `json:"probe,omitempty"` // 到下一跳的探测结果，只附在服务器的第一条规则上
+}
+
+// AgentInfo 已连接的中转节点
+type AgentInfo struct {
+	NodeID      uint             `json:"node_id"`
+	Name        string           `json:"name"`
+	Version     string           `json:"version"`
+	Hostname    string           `json:"hostname"`
+	RemoteAddr  string           `json:"remote_addr"`
+	ConnectedAt time.Time        `json:"connected_at"`
+	LastSeen    time.Time        `json:"last_seen"`
+	Servers     int              `json:"servers"` // 已下发的服务器数
+	Forwarders  []AgentForwarder `json:"forwarders"`
+}
+
+// agentConn 单个中转节点连接
+type agentConn struct {
+	conn       *websocket.Conn
+	send       chan AgentMessage
+	done       chan struct{}
+	closeOnce  sync.Once
+	mutex      sync.Mutex
+	info       AgentInfo
+	lastConfig []byte    // 最近下发的配置，未变化时不重复下发
+	persisted  time.Time // 最近一次写入心跳的时间
+}
+
+// close 关闭连接，可重复调用
+func (a *agentConn) close() {
+	a.closeOnce.Do(func() {
+		close(a.done)
+		a.conn.Close()
+	})
+}
+
+// AgentHub 管理中转节点连接：向节点下发指定给它的转发配置，汇总节点上报的吞吐量和流量记录
+type AgentHub struct {
+	db       *gorm.DB
+	routing  *RoutingService
+	pipeline *TrafficPipeline
+	agents   map[uint]*agentConn // 节点ID -> 连接
+	mutex    sync.RWMutex
+	changed  chan struct{}
+}
+
+// NewAgentHub 创建中转节点连接管理
+func NewAgentHub(db *gorm.DB, routing *RoutingService, pipeline *TrafficPipeline) *AgentHub {
+	return &AgentHub{
+		db:       db,
+		routing:  routing,
+		pipeline: pipeline,
+		agents:   make(map[uint]*agentConn),
+		changed:  make(chan struct{}, 1),
+	}
+}
+
+// Notify 通知服务器配置已变化，由同步循环异步下发
+func (h *AgentHub) Notify() {
+	select {
+	case h.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Start 在配置变化或定期核对时向各节点下发配置，直到ctx结束
+func (h *AgentHub) Start(ctx context.Context) {
+	ticker := time.NewTicker(agentResyncPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			h.mutex.Lock()
+			for _, agent := range h.agents {
+				agent.close()
+			}
+			h.mutex.Unlock()
+			return
+		case <-h.changed:
+		case <-ticker.C:
+		}
+
+		h.mutex.RLock()
+		for _, agent := range h.agents {
+			h.syncConfig(agent)
+		}
+		h.mutex.RUnlock()
+	}
+}
+
+// syncConfig 配置有变化时向节点下发
+func (h *AgentHub) syncConfig(agent *agentConn) {
+	servers := h.routing.AgentServers(agent.info.NodeID)
+	data, _ := json.Marshal(servers)
+
+	agent.mutex.Lock()
+	defer agent.mutex.Unlock()
+	if string(data) == string(agent.lastConfig) {
+		return
+	}
+
+	select {
+	case agent.send <- AgentMessage{Type: AgentMsgConfig, Servers: servers}:
+		agent.lastConfig = data
+		agent.info.Servers = len(servers)
+		slog.Info("向中转节点下发配置", "agent", agent.info.Name, "servers", len(servers))
+	default:
+		// 发送队列已满，等待下次同步重试
+		slog.Warn("中转节点发送队列已满，稍后重新下发配置", "agent", agent.info.Name)
+	}
+}
+
+// Serve 处理已认证节点的连接，阻塞直到连接断开。同一节点重复连接时断开旧连接
+func (h *AgentHub) Serve(conn *websocket.Conn, node *database.RelayNode, remoteAddr string) {
+	now := time.Now()
+	name := node.Name
+	agent := &agentConn{
+		conn: conn,
+		send: make(chan AgentMessage, agentSendQueue),
+		done: make(chan struct{}),
+		info: AgentInfo{NodeID: node.ID, Name: name, RemoteAddr: remoteAddr, ConnectedAt: now, LastSeen: now, Forwarders: []AgentForwarder{}},
+	}
+
+	h.mutex.Lock()
+	if previous, exists := h.agents[node.ID]; exists {
+		slog.Warn("中转节点重复连接，断开旧连接", "agent", name, "previous", previous.info.RemoteAddr)
+		previous.close()
+	}
+	h.agents[node.ID] = agent
+	h.mutex.Unlock()
+	slog.Info("中转节点已连接", "agent", name, "remote", remoteAddr)
+	h.heartbeat(agent, map[string]interface{}{"remote_addr": remoteAddr})
+
+	defer func() {
+		agent.close()
+		h.mutex.Lock()
+		if h.agents[node.ID] == agent {
+			delete(h.agents, node.ID)
+		}
+		h.mutex.Unlock()
+		h.heartbeat(agent, nil)
+		slog.Info("中转节点已断开", "agent", name)
+	}()
+
+	go h.writeMessages(agent)
+	h.syncConfig(agent)
+	h.readMessages(agent)
+}
+
+// writeMessages 发送队列中的消息并定期ping
+func (h *AgentHub) writeMessages(agent *agentConn) {
+	ticker := time.NewTicker(agentPingInterval)
+	defer ticker.Stop()
+	defer agent.close()
+
+	for {
+		select {
+		case <-agent.done:
+			return
+		case message := <-agent.send:
+			agent.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := agent.conn.WriteJSON(message); err != nil {
+				slog.Warn("向中转节点发送消息失败", "agent", agent.info.Name, "error", err)
+				return
+			}
+		case <-ticker.C:
+			if err := agent.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readMessages 处理节点上报的消息
+func (h *AgentHub) readMessages(agent *agentConn) {
+	conn := agent.conn
+	conn.SetReadDeadline(time.Now().Add(agentReadTimeout))
+	conn.SetPongHandler(func(string) error {
+		h.touch(agent)
+		return conn.SetReadDeadline(time.Now().Add(agentReadTimeout))
+	})
+
+	for {
+		var message AgentMessage
+		if err := conn.ReadJSON(&message); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				slog.Warn("读取中转节点消息失败", "agent", agent.info.Name, "error", err)
+			}
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(agentReadTimeout))
+		h.touch(agent)
+
+		switch message.Type {
+		case AgentMsgHello:
+			if message.Hello != nil {
+				agent.mutex.Lock()
+				agent.info.Version = message.Hello.Version
+				agent.info.Hostname = message.Hello.Hostname
+				agent.mutex.Unlock()
+				h.heartbeat(agent, map[string]interface{}{
+					"version":  message.Hello.Version,
+					"hostname": message.Hello.Hostname,
+					"cpus":     message.Hello.CPUs,
+				})
+			}
+		case AgentMsgStatus:
+			agent.mutex.Lock()
+			agent.info.Forwarders = append([]AgentForwarder{}, message.Forwarders...)
+			agent.mutex.Unlock()
+		case AgentMsgThroughput:
+			h.routing.MergeThroughput(h.ownSamples(agent, message.Throughput))
+		case AgentMsgFlows:
+			if h.pipeline != nil {
+				entries := h.entryServers(agent)
+				for _, record := range message.Flows {
+					if entries[record.ServerID] {
+						h.pipeline.Publish(record)
+					}
+				}
+			}
+		default:
+			slog.Debug("忽略未知的中转节点消息", "agent", agent.info.Name, "type", message.Type)
+		}
+	}
+}
+
+// touch 更新节点最后活跃时间，按agentHeartbeat间隔写入数据库
+func (h *AgentHub) touch(agent *agentConn) {
+	now := time.Now()
+	agent.mutex.Lock()
+	agent.info.LastSeen = now
+	persist := now.Sub(agent.persisted) >= agentHeartbeat
+	agent.mutex.Unlock()
+	if persist {
+		h.heartbeat(agent, nil)
+	}
+}
+
+// heartbeat 将节点最后活跃时间及上报的信息写入数据库
+func (h *AgentHub) heartbeat(agent *agentConn, fields map[string]interface{}) {
+	agent.mutex.Lock()
+	agent.persisted = time.Now()
+	lastSeen := agent.info.LastSeen
+	agent.mutex.Unlock()
+
+	if fields == nil {
+		fields = make(map[string]interface{})
+	}
+	fields["last_seen_at"] = lastSeen
+	if err := h.db.Model(&database.RelayNode{}).Where("id = ?", agent.info.NodeID).UpdateColumns(fields).Error; err != nil {
+		slog.Warn("记录中转节点心跳失败", "agent", agent.info.Name, "error", err)
+	}
+}
+
+// entryServers 以该节点为入口的服务器，节点只能上报这些服务器的数据，途经的链式转发不重复统计
+func (h *AgentHub) entryServers(agent *agentConn) map[uint]bool {
+	entries := make(map[uint]bool)
+	for _, server := range h.routing.AgentServers(agent.info.NodeID) {
+		if server.Hop == 0 {
+			entries[server.ID] = true
+		}
+	}
+	return entries
+}
+
+// ownSamples 过滤出以该节点为入口的服务器的吞吐量采样
+func (h *AgentHub) ownSamples(agent *agentConn, samples []ThroughputSample) []ThroughputSample {
+	ports := make(map[int]uint)
+	for _, server := range h.routing.AgentServers(agent.info.NodeID) {
+		if server.Hop > 0 {
+			continue
+		}
+		for _, rule := range ForwardRules(server.toServer()) {
+			ports[rule.ListenPort] = server.ID
+		}
+	}
+	owned := samples[:0]
+	for _, sample := range samples {
+		if id, ok := ports[sample.Port]; ok && id == sample.ServerID {
+			owned = append(owned, sample)
+		}
+	}
+	return owned
+}
+
+// List 列出已连接的中转节点(按名称排序)
+func (h *AgentHub) List() []AgentInfo {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	agents := make([]AgentInfo, 0, len(h.agents))
+	for _, agent := range h.agents {
+		agent.mutex.Lock()
+		info := agent.info
+		info.Forwarders = append([]AgentForwarder{}, agent.info.Forwarders...)
+		agent.mutex.Unlock()
+		agents = append(agents, info)
+	}
+	sort.Slice(agents, func(i, j int) bool { return agents[i].Name < agents[j].Name })
+	return agents
+}
+
+// Connected 指定节点是否在线
+func (h *AgentHub) Connected(nodeID uint) bool {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	_, ok := h.agents[nodeID]
+	return ok
+}
+
+// Disconnect 断开指定节点(节点被删除或令牌重置时)
+func (h *AgentHub) Disconnect(nodeID uint) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	if agent, ok := h.agents[nodeID]; ok {
+		agent.close()
+	}
+}
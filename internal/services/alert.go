@@ -0,0 +1,480 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"l2tp-manager/internal/database"
+
+	"gorm.io/gorm"
+)
+
+// 告警指标
+const (
+	AlertMetricStatusError  = "status_error"    // 服务器处于error状态
+	AlertMetricTrafficDaily = "traffic_daily"   // 当日流量(GB)超过阈值
+	AlertMetricLatency      = "latency"         // 落地机SSH端口TCP连接延迟(ms)超过阈值
+	AlertMetricExpiry       = "expiry"          // 剩余天数不超过阈值
+	AlertMetricAnomaly      = "traffic_anomaly" // 上一小时流量偏离滚动基线的标准差倍数超过阈值
+)
+
+// 告警状态
+const (
+	AlertStateFiring   = "firing"
+	AlertStateResolved = "resolved"
+)
+
+// SettingAlertInterval 告警规则评估间隔
+const SettingAlertInterval = "alert_eval_interval"
+
+// alertProbeTimeout 延迟探测超时，超时按该值计入延迟
+const alertProbeTimeout = 5 * time.Second
+
+// AlertMetrics 支持的告警指标及说明
+var AlertMetrics = map[string]string{
+	AlertMetricStatusError:  "服务器处于错误状态(阈值忽略)",
+	AlertMetricTrafficDaily: "当日流量超过阈值(GB)",
+	AlertMetricLatency:      "落地机TCP连接延迟超过阈值(ms)",
+	AlertMetricExpiry:       "距到期不超过阈值(天)",
+	AlertMetricAnomaly:      "上一小时流量骤降或突增，偏离近24小时基线超过阈值个标准差(0为默认3，越小越灵敏)",
+}
+
+// alertKey 规则与服务器的组合
+type alertKey struct {
+	ruleID   uint
+	serverID uint
+}
+
+// AlertService 告警规则引擎：定期评估规则，持续满足条件后触发并通知，条件消失后恢复
+type AlertService struct {
+	db       *gorm.DB
+	settings *SettingsService
+	notifier *NotificationService
+	pending  map[alertKey]time.Time // 条件首次满足的时间
+	firing   map[alertKey]uint      // 正在触发的告警记录ID
+	mutex    sync.Mutex
+}
+
+// NewAlertService 创建告警服务并注册其设置项
+func NewAlertService(db *gorm.DB, settings *SettingsService, notifier *NotificationService) *AlertService {
+	settings.Register(SettingDef{Key: SettingAlertInterval, Type: SettingTypeInt, Default: "60", Description: "告警规则评估间隔(秒)，0表示关闭"})
+	return &AlertService{
+		db:       db,
+		settings: settings,
+		notifier: notifier,
+		pending:  make(map[alertKey]time.Time),
+		firing:   make(map[alertKey]uint),
+	}
+}
+
+// Start 启动评估循环，启动时恢复未结束的告警，避免重启后重复通知
+func (a *AlertService) Start(ctx context.Context) {
+	var records []database.AlertRecord
+	if err := a.db.Where("state = ?", AlertStateFiring).Find(&records).Error; err != nil {
+		slog.Error("加载未恢复的告警失败", "error", err)
+	}
+	a.mutex.Lock()
+	for _, record := range records {
+		a.firing[alertKey{record.RuleID, record.ServerID}] = record.ID
+	}
+	a.mutex.Unlock()
+
+	changed := a.settings.Watch(SettingAlertInterval)
+	for {
+		timer := newIntervalTimer(a.settings.Seconds(SettingAlertInterval))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-changed:
+			timer.Stop()
+		case <-timer.C:
+			a.Evaluate(ctx)
+		}
+	}
+}
+
+// Evaluate 评估全部启用的规则
+func (a *AlertService) Evaluate(ctx context.Context) {
+	var rules []database.AlertRule
+	if err := a.db.Where("enabled = ?", true).Find(&rules).Error; err != nil {
+		slog.Error("加载告警规则失败", "error", err)
+		return
+	}
+	var servers []database.L2TPServer
+	if err := a.db.Find(&servers).Error; err != nil {
+		slog.Error("加载服务器失败", "error", err)
+		return
+	}
+
+	now := time.Now()
+	traffic := a.todayTraffic(now)
+	latency := make(map[uint]float64)
+	var anomalies map[uint]*TrafficAnomaly
+	seen := make(map[alertKey]bool)
+
+	for _, rule := range rules {
+		for i := range servers {
+			server := &servers[i]
+			if rule.ServerID != 0 && rule.ServerID != server.ID {
+				continue
+			}
+			if ctx.Err() != nil {
+				return
+			}
+
+			var value float64
+			var breached bool
+			switch rule.Metric {
+			case AlertMetricStatusError:
+				if server.Status == "error" {
+					value, breached = 1, true
+				}
+			case AlertMetricTrafficDaily:
+				value = float64(traffic[server.ID]) / (1 << 30)
+				breached = value > rule.Threshold
+			case AlertMetricLatency:
+				// 已停止的服务器不探测
+				if server.Status != "running" {
+					continue
+				}
+				if _, ok := latency[server.ID]; !ok {
+					latency[server.ID] = probeLatency(ctx, server.Host, server.Port)
+				}
+				value = latency[server.ID]
+				breached = value > rule.Threshold
+			case AlertMetricExpiry:
+				if server.ExpireDate.IsZero() || now.After(server.ExpireDate) {
+					continue
+				}
+				value = server.ExpireDate.Sub(now).Hours() / 24
+				breached = value <= rule.Threshold
+			case AlertMetricAnomaly:
+				// 已停止的服务器流量下降是预期的，不检测
+				if server.Status != "running" {
+					continue
+				}
+				if anomalies == nil {
+					anomalies = trafficAnomalies(a.db, servers, now)
+				}
+				anomaly, ok := anomalies[server.ID]
+				if !ok {
+					continue
+				}
+				value = anomaly.Score
+				breached = math.Abs(value) >= anomalyThreshold(&rule)
+			default:
+				continue
+			}
+
+			key := alertKey{rule.ID, server.ID}
+			seen[key] = true
+			a.transition(&rule, server, key, value, breached, now)
+		}
+	}
+
+	// 规则被删除/停用或服务器被删除时恢复对应告警
+	a.mutex.Lock()
+	var stale []alertKey
+	for key := range a.firing {
+		if !seen[key] {
+			stale = append(stale, key)
+		}
+	}
+	for key := range a.pending {
+		if !seen[key] {
+			delete(a.pending, key)
+		}
+	}
+	a.mutex.Unlock()
+	for _, key := range stale {
+		a.resolve(key, nil, now)
+	}
+}
+
+// transition 根据本次评估结果推进告警状态
+func (a *AlertService) transition(rule *database.AlertRule, server *database.L2TPServer, key alertKey, value float64, breached bool, now time.Time) {
+	a.mutex.Lock()
+	_, firing := a.firing[key]
+	if !breached {
+		delete(a.pending, key)
+		a.mutex.Unlock()
+		if firing {
+			a.resolve(key, rule, now)
+		}
+		return
+	}
+
+	since, ok := a.pending[key]
+	if !ok {
+		since = now
+		a.pending[key] = now
+	}
+	a.mutex.Unlock()
+
+	if firing || now.Sub(since) < time.Duration(rule.Duration)*time.Second {
+		return
+	}
+	a.fire(rule, server, key, value, since, now)
+}
+
+// fire 创建告警记录并发送通知(静默期内只记录)
+func (a *AlertService) fire(rule *database.AlertRule, server *database.L2TPServer, key alertKey, value float64, since, now time.Time) {
+	silenced := rule.SilencedUntil != nil && now.Before(*rule.SilencedUntil)
+	record := database.AlertRecord{
+		RuleID:     rule.ID,
+		RuleName:   rule.Name,
+		ServerID:   server.ID,
+		ServerName: server.Name,
+		State:      AlertStateFiring,
+		Value:      value,
+		Message:    alertMessage(rule, server.Name, value),
+		Silenced:   silenced,
+		FiredAt:    since,
+	}
+	if err := a.db.Create(&record).Error; err != nil {
+		slog.Error("保存告警记录失败", "rule_id", rule.ID, "error", err)
+		return
+	}
+
+	a.mutex.Lock()
+	a.firing[key] = record.ID
+	a.mutex.Unlock()
+
+	slog.Warn("告警触发", "rule_id", rule.ID, "server_id", server.ID, "value", value, "silenced", silenced)
+	if !silenced {
+		a.notify(rule, Event{
+			Type:       EventAlertFiring,
+			ServerID:   server.ID,
+			ServerName: server.Name,
+			Message:    record.Message,
+			Data:       map[string]interface{}{"rule_id": rule.ID, "rule": rule.Name, "metric": rule.Metric, "value": value, "threshold": rule.Threshold},
+		})
+	}
+}
+
+// resolve 结束告警，rule为nil表示规则或服务器已不存在，不发送通知
+func (a *AlertService) resolve(key alertKey, rule *database.AlertRule, now time.Time) {
+	a.mutex.Lock()
+	id, ok := a.firing[key]
+	delete(a.firing, key)
+	a.mutex.Unlock()
+	if !ok {
+		return
+	}
+
+	var record database.AlertRecord
+	if err := a.db.First(&record, id).Error; err != nil {
+		return
+	}
+	record.State = AlertStateResolved
+	record.ResolvedAt = &now
+	if err := a.db.Save(&record).Error; err != nil {
+		slog.Error("更新告警记录失败", "alert_id", id, "error", err)
+		return
+	}
+
+	slog.Info("告警恢复", "rule_id", key.ruleID, "server_id", key.serverID)
+	if rule == nil || record.Silenced || (rule.SilencedUntil != nil && now.Before(*rule.SilencedUntil)) {
+		return
+	}
+	a.notify(rule, Event{
+		Type:       EventAlertResolved,
+		ServerID:   record.ServerID,
+		ServerName: record.ServerName,
+		Message:    fmt.Sprintf("%s 已恢复，持续 %s", record.Message, now.Sub(record.FiredAt).Truncate(time.Second)),
+		Data:       map[string]interface{}{"rule_id": rule.ID, "rule": rule.Name, "metric": rule.Metric},
+	})
+}
+
+// notify 按规则指定的渠道发送，未指定时按事件路由分发
+func (a *AlertService) notify(rule *database.AlertRule, event Event) {
+	if a.notifier == nil {
+		return
+	}
+	if channels := splitList(rule.Channels); len(channels) > 0 {
+		a.notifier.PublishTo(event, channels)
+		return
+	}
+	a.notifier.Publish(event)
+}
+
+// todayTraffic 各服务器当日流量(字节)
+func (a *AlertService) todayTraffic(now time.Time) map[uint]int64 {
+	var rows []struct {
+		ServerID uint
+		Bytes    int64
+	}
+	if err := a.db.Model(&database.TrafficSample{}).
+		Select("server_id, bytes").
+		Where("granularity = ? AND bucket = ?", GranularityDay, bucketStart(now, GranularityDay)).
+		Scan(&rows).Error; err != nil {
+		slog.Warn("查询当日流量失败", "error", err)
+	}
+
+	totals := make(map[uint]int64, len(rows))
+	for _, row := range rows {
+		totals[row.ServerID] = row.Bytes
+	}
+	return totals
+}
+
+// probeLatency 测量到落地机SSH端口的TCP连接耗时(ms)，失败时返回超时值
+func probeLatency(ctx context.Context, host string, port int) float64 {
+	if port == 0 {
+		port = 22
+	}
+	dialer := net.Dialer{Timeout: alertProbeTimeout}
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return float64(alertProbeTimeout.Milliseconds())
+	}
+	conn.Close()
+	return float64(time.Since(start).Microseconds()) / 1000
+}
+
+// alertMessage 生成告警描述
+func alertMessage(rule *database.AlertRule, serverName string, value float64) string {
+	switch rule.Metric {
+	case AlertMetricStatusError:
+		return fmt.Sprintf("[%s] 服务器 \"%s\" 处于错误状态", rule.Name, serverName)
+	case AlertMetricTrafficDaily:
+		return fmt.Sprintf("[%s] 服务器 \"%s\" 今日流量 %.2f GB，超过 %.2f GB", rule.Name, serverName, value, rule.Threshold)
+	case AlertMetricLatency:
+		return fmt.Sprintf("[%s] 服务器 \"%s\" 连接延迟 %.0f ms，超过 %.0f ms", rule.Name, serverName, value, rule.Threshold)
+	case AlertMetricExpiry:
+		return fmt.Sprintf("[%s] 服务器 \"%s\" 将在 %.1f 天后到期", rule.Name, serverName, value)
+	case AlertMetricAnomaly:
+		change := "突增"
+		if value < 0 {
+			change = "骤降"
+		}
+		return fmt.Sprintf("[%s] 服务器 \"%s\" 上一小时流量%s，偏离基线 %.1f 个标准差(阈值 %.1f)", rule.Name, serverName, change, math.Abs(value), anomalyThreshold(rule))
+	}
+	return fmt.Sprintf("[%s] 服务器 \"%s\" 指标值 %.2f", rule.Name, serverName, value)
+}
+
+// validateAlertRule 校验告警规则
+func validateAlertRule(rule *database.AlertRule) error {
+	rule.Name = strings.TrimSpace(rule.Name)
+	if rule.Name == "" {
+		return fmt.Errorf("规则名称不能为空")
+	}
+	if _, ok := AlertMetrics[rule.Metric]; !ok {
+		return fmt.Errorf("不支持的告警指标: %s", rule.Metric)
+	}
+	if rule.Threshold < 0 {
+		return fmt.Errorf("阈值不能为负数")
+	}
+	if rule.Duration < 0 {
+		return fmt.Errorf("持续时间不能为负数")
+	}
+	rule.Channels = strings.Join(splitList(rule.Channels), ",")
+	return nil
+}
+
+// ListRules 获取全部告警规则
+func (a *AlertService) ListRules() ([]database.AlertRule, error) {
+	var rules []database.AlertRule
+	err := a.db.Order("id").Find(&rules).Error
+	return rules, err
+}
+
+// CreateRule 创建告警规则
+func (a *AlertService) CreateRule(rule *database.AlertRule) error {
+	rule.ID = 0
+	rule.SilencedUntil = nil
+	if err := validateAlertRule(rule); err != nil {
+		return err
+	}
+	return a.db.Create(rule).Error
+}
+
+// UpdateRule 更新告警规则(不修改静默状态)
+func (a *AlertService) UpdateRule(id uint, update *database.AlertRule) (*database.AlertRule, error) {
+	var rule database.AlertRule
+	if err := a.db.First(&rule, id).Error; err != nil {
+		return nil, fmt.Errorf("告警规则不存在")
+	}
+	if err := validateAlertRule(update); err != nil {
+		return nil, err
+	}
+
+	rule.Name = update.Name
+	rule.Metric = update.Metric
+	rule.Threshold = update.Threshold
+	rule.Duration = update.Duration
+	rule.ServerID = update.ServerID
+	rule.Channels = update.Channels
+	rule.Enabled = update.Enabled
+	if err := a.db.Save(&rule).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// DeleteRule 删除告警规则，历史记录保留
+func (a *AlertService) DeleteRule(id uint) error {
+	result := a.db.Delete(&database.AlertRule{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("告警规则不存在")
+	}
+	return nil
+}
+
+// Silence 静默规则到指定时间，零值表示取消静默
+func (a *AlertService) Silence(id uint, until time.Time) (*database.AlertRule, error) {
+	var rule database.AlertRule
+	if err := a.db.First(&rule, id).Error; err != nil {
+		return nil, fmt.Errorf("告警规则不存在")
+	}
+	if until.IsZero() {
+		rule.SilencedUntil = nil
+	} else {
+		rule.SilencedUntil = &until
+	}
+	if err := a.db.Model(&rule).Update("silenced_until", rule.SilencedUntil).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// AlertHistoryQuery 告警历史查询条件
+type AlertHistoryQuery struct {
+	RuleID   uint
+	ServerID uint
+	State    string
+	Limit    int
+}
+
+// History 查询告警历史，最新的在前
+func (a *AlertService) History(q AlertHistoryQuery) ([]database.AlertRecord, error) {
+	if q.Limit <= 0 || q.Limit > 1000 {
+		q.Limit = 100
+	}
+	query := a.db.Model(&database.AlertRecord{})
+	if q.RuleID != 0 {
+		query = query.Where("rule_id = ?", q.RuleID)
+	}
+	if q.ServerID != 0 {
+		query = query.Where("server_id = ?", q.ServerID)
+	}
+	if q.State != "" {
+		query = query.Where("state = ?", q.State)
+	}
+
+	var records []database.AlertRecord
+	err := query.Order("id DESC").Limit(q.Limit).Find(&records).Error
+	return records, err
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"log/slog"
+	"math"
+	"time"
+
+	"l2tp-manager/internal/database"
+
+	"gorm.io/gorm"
+)
+
+// 流量异常检测参数
+const (
+	anomalyBaselineHours     = 24      // 基线取被检测小时之前的小时数
+	anomalyMinBaselineHours  = 6       // 服务器创建后至少经过的完整小时数，不足时不检测
+	anomalyDefaultThreshold  = 3.0     // 规则阈值为0时使用的标准差倍数
+	anomalyMinDeviationBytes = 1 << 20 // 标准差下限，避免近乎空闲的服务器因几KB波动触发
+)
+
+// TrafficAnomaly 服务器上一个完整小时的流量相对基线的偏离
+type TrafficAnomaly struct {
+	Bucket   time.Time // 被检测的小时
+	Bytes    int64     // 该小时流量
+	Mean     float64   // 基线平均每小时流量
+	StdDev   float64   // 基线标准差(已应用下限)
+	Score    float64   // 偏离的标准差倍数，负数表示骤降
+	Baseline int       // 参与基线计算的小时数
+}
+
+// Direction 偏离方向
+func (a *TrafficAnomaly) Direction() string {
+	if a.Score < 0 {
+		return "drop"
+	}
+	return "spike"
+}
+
+// anomalyThreshold 规则的标准差倍数，阈值为0时使用默认值
+func anomalyThreshold(rule *database.AlertRule) float64 {
+	if rule.Threshold <= 0 {
+		return anomalyDefaultThreshold
+	}
+	return rule.Threshold
+}
+
+// trafficAnomalies 以小时流量样本为数据源，计算各服务器上一个完整小时相对之前24小时滚动基线的偏离。
+// 没有样本的小时按0计入，创建时间不足的服务器不返回
+func trafficAnomalies(db *gorm.DB, servers []database.L2TPServer, now time.Time) map[uint]*TrafficAnomaly {
+	current := bucketStart(now, GranularityHour).Add(-time.Hour)
+	since := current.Add(-anomalyBaselineHours * time.Hour)
+
+	var samples []database.TrafficSample
+	if err := db.Where("granularity = ? AND bucket >= ? AND bucket <= ?", GranularityHour, since, current).
+		Find(&samples).Error; err != nil {
+		slog.Warn("查询小时流量样本失败", "error", err)
+		return nil
+	}
+	hourly := make(map[uint]map[int64]int64)
+	for _, sample := range samples {
+		if hourly[sample.ServerID] == nil {
+			hourly[sample.ServerID] = make(map[int64]int64)
+		}
+		hourly[sample.ServerID][sample.Bucket.Unix()] += sample.Bytes
+	}
+
+	anomalies := make(map[uint]*TrafficAnomaly)
+	for i := range servers {
+		server := &servers[i]
+		// 基线只统计服务器创建之后的完整小时
+		first := since
+		if created := bucketStart(server.CreatedAt, GranularityHour).Add(time.Hour); created.After(first) {
+			first = created
+		}
+		var baseline []float64
+		for bucket := first; bucket.Before(current); bucket = bucket.Add(time.Hour) {
+			baseline = append(baseline, float64(hourly[server.ID][bucket.Unix()]))
+		}
+		if len(baseline) < anomalyMinBaselineHours {
+			continue
+		}
+
+		var sum float64
+		for _, v := range baseline {
+			sum += v
+		}
+		mean := sum / float64(len(baseline))
+		var variance float64
+		for _, v := range baseline {
+			variance += (v - mean) * (v - mean)
+		}
+		stddev := math.Max(math.Sqrt(variance/float64(len(baseline))), math.Max(mean*0.1, anomalyMinDeviationBytes))
+
+		bytes := hourly[server.ID][current.Unix()]
+		anomalies[server.ID] = &TrafficAnomaly{
+			Bucket:   current,
+			Bytes:    bytes,
+			Mean:     mean,
+			StdDev:   stddev,
+			Score:    (float64(bytes) - mean) / stddev,
+			Baseline: len(baseline),
+		}
+	}
+	return anomalies
+}
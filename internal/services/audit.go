@@ -0,0 +1,59 @@
+package services
+
+import (
+	"log/slog"
+	"time"
+
+	"l2tp-manager/internal/database"
+
+	"gorm.io/gorm"
+)
+
+// AuditService 审计日志服务
+type AuditService struct {
+	db *gorm.DB
+}
+
+// NewAuditService 创建审计日志服务
+func NewAuditService(db *gorm.DB) *AuditService {
+	return &AuditService{db: db}
+}
+
+// Record 记录审计日志，写入失败只记录到标准日志
+func (a *AuditService) Record(serverID uint, action, username, result, detail string) {
+	a.RecordFrom("", serverID, action, username, result, detail)
+}
+
+// RecordFrom 记录来自HTTP请求的审计日志，clientIP为经可信代理解析后的客户端IP
+func (a *AuditService) RecordFrom(clientIP string, serverID uint, action, username, result, detail string) {
+	entry := database.AuditLog{
+		ServerID:  serverID,
+		Action:    action,
+		Username:  username,
+		ClientIP:  clientIP,
+		Result:    result,
+		Detail:    detail,
+		CreatedAt: time.Now(),
+	}
+	if err := a.db.Create(&entry).Error; err != nil {
+		slog.Error("写入审计日志失败", "error", err)
+	}
+}
+
+// List 查询审计日志
+func (a *AuditService) List(serverID uint, action string, limit int) ([]database.AuditLog, error) {
+	var logs []database.AuditLog
+	query := a.db.Order("created_at DESC")
+	if serverID > 0 {
+		query = query.Where("server_id = ?", serverID)
+	}
+	if action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	result := query.Find(&logs)
+	return logs, result.Error
+}
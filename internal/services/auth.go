@@ -11,6 +11,7 @@ import (
 type Claims struct {
 	UserID   uint   `json:"user_id"`
 	Username string `json:"username"`
+	TenantID uint   `json:"tenant_id,omitempty"` // 所属租户，0表示平台超级管理员
 	jwt.RegisteredClaims
 }
 
@@ -27,13 +28,14 @@ func NewAuthService(jwtSecret string) *AuthService {
 }
 
 // GenerateToken 生成JWT令牌
-func (a *AuthService) GenerateToken(userID uint, username string) (string, error) {
+func (a *AuthService) GenerateToken(userID uint, username string, tenantID uint) (string, error) {
 	now := time.Now()
 	expirationTime := now.Add(24 * time.Hour) // 24小时过期
 
 	claims := &Claims{
 		UserID:   userID,
 		Username: username,
+		TenantID: tenantID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(now),
@@ -80,5 +82,5 @@ func (a *AuthService) RefreshToken(tokenString string) (string, error) {
 	}
 
 	// 生成新令牌
-	return a.GenerateToken(claims.UserID, claims.Username)
+	return a.GenerateToken(claims.UserID, claims.Username, claims.TenantID)
 } 
\ No newline at end of file
@@ -0,0 +1,320 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"l2tp-manager/internal/database"
+
+	"gorm.io/gorm"
+)
+
+// 备份文件名前缀
+const (
+	manualBackupPrefix = "backup_"
+	autoBackupPrefix   = "auto_backup_"
+)
+
+// backupNamePattern 合法备份文件名(禁止路径分隔符，防止目录穿越)
+var backupNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*\.db$`)
+
+// BackupFile 备份文件信息
+type BackupFile struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+	Auto      bool      `json:"auto"` // 是否为自动备份
+}
+
+// secretMask 接口返回时替代敏感字段的占位符
+const secretMask = "******"
+
+// BackupService 数据库备份服务
+type BackupService struct {
+	db      *gorm.DB
+	dir     string
+	lastRun time.Time  // 上次自动备份触发的分钟
+	mutex   sync.Mutex // 串行化备份执行
+}
+
+// NewBackupService 创建备份服务
+func NewBackupService(db *gorm.DB, dir string) *BackupService {
+	return &BackupService{db: db, dir: dir}
+}
+
+// Dir 返回备份目录
+func (b *BackupService) Dir() string {
+	return b.dir
+}
+
+// CreateBackup 创建一次手动备份，返回备份文件名
+func (b *BackupService) CreateBackup() (string, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.createBackup(manualBackupPrefix)
+}
+
+// createBackup 在备份目录中生成带时间戳的备份文件
+func (b *BackupService) createBackup(prefix string) (string, error) {
+	if err := os.MkdirAll(b.dir, 0700); err != nil {
+		return "", fmt.Errorf("创建备份目录失败: %v", err)
+	}
+
+	name := fmt.Sprintf("%s%s.db", prefix, time.Now().Format("20060102_150405"))
+	if err := database.BackupDatabase(b.db, filepath.Join(b.dir, name)); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// ListBackups 列出备份目录中的备份文件，按时间倒序
+func (b *BackupService) ListBackups() ([]BackupFile, error) {
+	entries, err := os.ReadDir(b.dir)
+	if os.IsNotExist(err) {
+		return []BackupFile{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []BackupFile{}
+	for _, entry := range entries {
+		if entry.IsDir() || !backupNamePattern.MatchString(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, BackupFile{
+			Name:      entry.Name(),
+			Size:      info.Size(),
+			CreatedAt: info.ModTime(),
+			Auto:      strings.HasPrefix(entry.Name(), autoBackupPrefix),
+		})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+	return backups, nil
+}
+
+// BackupPath 校验备份文件名并返回其完整路径
+func (b *BackupService) BackupPath(name string) (string, error) {
+	if !backupNamePattern.MatchString(name) {
+		return "", fmt.Errorf("无效的备份文件名")
+	}
+	fullPath := filepath.Join(b.dir, name)
+	info, err := os.Stat(fullPath)
+	if err != nil || info.IsDir() {
+		return "", fmt.Errorf("备份文件不存在")
+	}
+	return fullPath, nil
+}
+
+// DeleteBackup 删除指定备份文件
+func (b *BackupService) DeleteBackup(name string) error {
+	fullPath, err := b.BackupPath(name)
+	if err != nil {
+		return err
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return os.Remove(fullPath)
+}
+
+// GetPolicy 获取自动备份策略，不存在时创建默认策略
+func (b *BackupService) GetPolicy() (*database.BackupPolicy, error) {
+	var policy database.BackupPolicy
+	err := b.db.First(&policy).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		policy = database.BackupPolicy{Schedule: "0 3 * * *", Retention: 7}
+		err = b.db.Create(&policy).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// UpdatePolicy 更新自动备份策略，密码为占位符时保留原值
+func (b *BackupService) UpdatePolicy(update *database.BackupPolicy) (*database.BackupPolicy, error) {
+	if _, err := ParseCron(update.Schedule); err != nil {
+		return nil, fmt.Errorf("备份计划无效: %v", err)
+	}
+	if update.Retention < 1 {
+		return nil, fmt.Errorf("保留数量必须大于0")
+	}
+	if _, err := newBackupUploader(update); err != nil {
+		return nil, err
+	}
+
+	policy, err := b.GetPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	policy.Enabled = update.Enabled
+	policy.Schedule = update.Schedule
+	policy.Retention = update.Retention
+	policy.UploadType = update.UploadType
+	policy.UploadEndpoint = update.UploadEndpoint
+	policy.UploadBucket = update.UploadBucket
+	policy.UploadRegion = update.UploadRegion
+	policy.UploadPath = update.UploadPath
+	policy.UploadUsername = update.UploadUsername
+	policy.UploadHostKey = update.UploadHostKey
+	if update.UploadPassword != secretMask {
+		policy.UploadPassword = update.UploadPassword
+	}
+
+	if err := b.db.Save(policy).Error; err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// MaskPolicy 返回隐藏密码后的策略副本
+func MaskPolicy(policy *database.BackupPolicy) *database.BackupPolicy {
+	masked := *policy
+	if masked.UploadPassword != "" {
+		masked.UploadPassword = secretMask
+	}
+	return &masked
+}
+
+// Start 启动自动备份调度，每分钟检查一次备份计划
+func (b *BackupService) Start(ctx context.Context) {
+	if !database.IsSQLite(b.db) {
+		slog.Info("Postgres后端不执行自动备份，请使用pg_dump")
+		return
+	}
+	slog.Info("自动备份调度已启动")
+
+	for {
+		now := time.Now()
+		next := now.Truncate(time.Minute).Add(time.Minute)
+		select {
+		case <-ctx.Done():
+			slog.Info("自动备份调度正在退出")
+			return
+		case <-time.After(next.Sub(now)):
+			b.runIfDue(next)
+		}
+	}
+}
+
+// runIfDue 当前分钟匹配备份计划时执行自动备份
+func (b *BackupService) runIfDue(now time.Time) {
+	policy, err := b.GetPolicy()
+	if err != nil {
+		slog.Error("加载备份策略失败", "error", err)
+		return
+	}
+	if !policy.Enabled {
+		return
+	}
+
+	schedule, err := ParseCron(policy.Schedule)
+	if err != nil {
+		slog.Warn("备份计划无效", "error", err)
+		return
+	}
+	minute := now.Truncate(time.Minute)
+	if !schedule.Matches(minute) || b.lastRun.Equal(minute) {
+		return
+	}
+	b.lastRun = minute
+
+	if _, err := b.RunPolicy(); err != nil {
+		slog.Error("自动备份失败", "error", err)
+	}
+}
+
+// RunPolicy 按当前策略立即执行一次自动备份：备份、上传、清理旧备份
+func (b *BackupService) RunPolicy() (string, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	policy, err := b.GetPolicy()
+	if err != nil {
+		return "", err
+	}
+
+	name, err := b.createBackup(autoBackupPrefix)
+	if err == nil {
+		err = b.upload(policy, name)
+	}
+
+	result := fmt.Sprintf("备份成功: %s", name)
+	if err != nil {
+		result = err.Error()
+	} else if removed := b.prune(policy.Retention); len(removed) > 0 {
+		result += fmt.Sprintf("，已清理 %d 个旧备份", len(removed))
+	}
+
+	now := time.Now()
+	b.db.Model(policy).Updates(map[string]interface{}{
+		"last_run_at": &now,
+		"last_result": result,
+	})
+
+	if err != nil {
+		return name, err
+	}
+	slog.Info("自动备份完成", "name", name)
+	return name, nil
+}
+
+// upload 将备份上传到策略配置的远程目标
+func (b *BackupService) upload(policy *database.BackupPolicy, name string) error {
+	uploader, err := newBackupUploader(policy)
+	if err != nil || uploader == nil {
+		return err
+	}
+	if err := uploader.Upload(filepath.Join(b.dir, name), name); err != nil {
+		return fmt.Errorf("上传备份到 %s 失败: %v", policy.UploadType, err)
+	}
+	return nil
+}
+
+// prune 只保留最新的retention个自动备份，返回被删除的文件名
+func (b *BackupService) prune(retention int) []string {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasPrefix(entry.Name(), autoBackupPrefix) && strings.HasSuffix(entry.Name(), ".db") {
+			names = append(names, entry.Name())
+		}
+	}
+	if len(names) <= retention {
+		return nil
+	}
+
+	// 文件名包含时间戳，按名称排序即按时间排序
+	sort.Strings(names)
+	var removed []string
+	for _, name := range names[:len(names)-retention] {
+		if err := os.Remove(filepath.Join(b.dir, name)); err != nil {
+			slog.Warn("删除旧备份失败", "name", name, "error", err)
+			continue
+		}
+		removed = append(removed, name)
+	}
+	return removed
+}
@@ -0,0 +1,314 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"l2tp-manager/internal/database"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// BackupUploader 备份远程上传目标
+type BackupUploader interface {
+	Upload(localPath, name string) error
+}
+
+// newBackupUploader 根据策略创建上传器，未配置上传时返回nil
+func newBackupUploader(policy *database.BackupPolicy) (BackupUploader, error) {
+	switch policy.UploadType {
+	case "":
+		return nil, nil
+	case "s3":
+		if policy.UploadEndpoint == "" || policy.UploadBucket == "" {
+			return nil, fmt.Errorf("S3上传需要配置地址和存储桶")
+		}
+		return &s3Uploader{policy: policy}, nil
+	case "sftp":
+		if policy.UploadEndpoint == "" || policy.UploadUsername == "" {
+			return nil, fmt.Errorf("SFTP上传需要配置主机和用户名")
+		}
+		hostKey, err := sftpHostKeyCallback(policy.UploadHostKey)
+		if err != nil {
+			return nil, err
+		}
+		return &sftpUploader{policy: policy, hostKey: hostKey}, nil
+	case "webdav":
+		if policy.UploadEndpoint == "" {
+			return nil, fmt.Errorf("WebDAV上传需要配置地址")
+		}
+		return &webdavUploader{policy: policy}, nil
+	default:
+		return nil, fmt.Errorf("不支持的上传类型: %s", policy.UploadType)
+	}
+}
+
+// uploadHTTPClient 上传使用的HTTP客户端
+var uploadHTTPClient = &http.Client{Timeout: 10 * time.Minute}
+
+// webdavUploader 通过HTTP PUT上传到WebDAV
+type webdavUploader struct {
+	policy *database.BackupPolicy
+}
+
+// Upload 上传备份文件
+func (w *webdavUploader) Upload(localPath, name string) error {
+	file, size, err := openBackup(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	target := strings.TrimRight(w.policy.UploadEndpoint, "/") + "/" + joinRemotePath(w.policy.UploadPath, name)
+	req, err := http.NewRequest(http.MethodPut, target, file)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if w.policy.UploadUsername != "" {
+		req.SetBasicAuth(w.policy.UploadUsername, w.policy.UploadPassword)
+	}
+	return doUpload(req)
+}
+
+// s3Uploader 使用AWS Signature V4上传到S3兼容存储(路径风格)
+type s3Uploader struct {
+	policy *database.BackupPolicy
+}
+
+// Upload 上传备份文件
+func (s *s3Uploader) Upload(localPath, name string) error {
+	payloadHash, err := fileSHA256(localPath)
+	if err != nil {
+		return err
+	}
+	file, size, err := openBackup(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	endpoint, err := url.Parse(strings.TrimRight(s.policy.UploadEndpoint, "/"))
+	if err != nil {
+		return fmt.Errorf("S3地址无效: %v", err)
+	}
+	endpoint.Path = "/" + s.policy.UploadBucket + "/" + joinRemotePath(s.policy.UploadPath, name)
+
+	req, err := http.NewRequest(http.MethodPut, endpoint.String(), file)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+
+	region := s.policy.UploadRegion
+	if region == "" {
+		region = "us-east-1"
+	}
+	signS3Request(req, payloadHash, region, s.policy.UploadUsername, s.policy.UploadPassword, time.Now().UTC())
+	return doUpload(req)
+}
+
+// signS3Request 为请求添加AWS Signature V4签名头
+func signS3Request(req *http.Request, payloadHash, region, accessKey, secretKey string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := fmt.Sprintf("host:%s\nx-amz-content-sha256:%s\nx-amz-date:%s\n", req.URL.Host, payloadHash, amzDate)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", day, region)
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(requestHash[:])}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+// hmacSHA256 计算HMAC-SHA256
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// sftpUploader 通过SFTP子系统上传到远程主机，支持只允许SFTP或chroot的账号
+type sftpUploader struct {
+	policy  *database.BackupPolicy
+	hostKey ssh.HostKeyCallback
+}
+
+// sftpHostKeyCallback 按配置的主机公钥校验SFTP服务器，备份中含有凭据，不接受未校验的主机。
+// 支持SHA256指纹，以及authorized_keys或known_hosts格式的公钥(如ssh-keyscan的输出)，多个公钥按行分隔，匹配任一即可
+func sftpHostKeyCallback(value string) (ssh.HostKeyCallback, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, fmt.Errorf("SFTP上传需要配置主机公钥或SHA256指纹，可通过 ssh-keyscan 获取")
+	}
+
+	var fingerprints []string
+	for _, line := range strings.Split(value, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "SHA256:") {
+			fingerprints = append(fingerprints, line)
+			continue
+		}
+		// known_hosts格式的行以主机名开头，否则按authorized_keys格式解析
+		_, _, key, _, _, err := ssh.ParseKnownHosts([]byte(line))
+		if err != nil {
+			if key, _, _, _, err = ssh.ParseAuthorizedKey([]byte(line)); err != nil {
+				return nil, fmt.Errorf("SFTP主机公钥无效: %v", err)
+			}
+		}
+		fingerprints = append(fingerprints, ssh.FingerprintSHA256(key))
+	}
+	if len(fingerprints) == 0 {
+		return nil, fmt.Errorf("SFTP上传需要配置主机公钥或SHA256指纹，可通过 ssh-keyscan 获取")
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		fingerprint := ssh.FingerprintSHA256(key)
+		for _, expected := range fingerprints {
+			if fingerprint == expected {
+				return nil
+			}
+		}
+		return fmt.Errorf("SFTP主机公钥 %s 与配置的不一致", fingerprint)
+	}, nil
+}
+
+// Upload 上传备份文件
+func (s *sftpUploader) Upload(localPath, name string) error {
+	file, _, err := openBackup(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	address := s.policy.UploadEndpoint
+	if !strings.Contains(address, ":") {
+		address += ":22"
+	}
+	client, err := ssh.Dial("tcp", address, &ssh.ClientConfig{
+		User:            s.policy.UploadUsername,
+		Auth:            []ssh.AuthMethod{ssh.Password(s.policy.UploadPassword)},
+		HostKeyCallback: s.hostKey,
+		Timeout:         30 * time.Second,
+	})
+	if err != nil {
+		return fmt.Errorf("SSH连接失败: %v", err)
+	}
+	defer client.Close()
+
+	sftpClient, err := sftp.NewClient(client)
+	if err != nil {
+		return fmt.Errorf("建立SFTP会话失败: %v", err)
+	}
+	defer sftpClient.Close()
+
+	remoteDir := s.policy.UploadPath
+	if remoteDir == "" {
+		remoteDir = "."
+	}
+	if err := sftpClient.MkdirAll(remoteDir); err != nil {
+		return fmt.Errorf("创建远程目录失败: %v", err)
+	}
+	remote, err := sftpClient.Create(path.Join(remoteDir, name))
+	if err != nil {
+		return fmt.Errorf("创建远程文件失败: %v", err)
+	}
+	if _, err := remote.ReadFrom(file); err != nil {
+		remote.Close()
+		return fmt.Errorf("写入远程文件失败: %v", err)
+	}
+	return remote.Close()
+}
+
+// shellQuote 用单引号转义shell参数
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// openBackup 打开本地备份文件并返回大小
+func openBackup(localPath string) (*os.File, int64, error) {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return file, info.Size(), nil
+}
+
+// fileSHA256 计算文件的SHA256十六进制摘要
+func fileSHA256(localPath string) (string, error) {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// joinRemotePath 拼接远程目录/前缀和文件名
+func joinRemotePath(prefix, name string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return name
+	}
+	return prefix + "/" + name
+}
+
+// doUpload 发送上传请求并检查响应状态
+func doUpload(req *http.Request) error {
+	resp, err := uploadHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
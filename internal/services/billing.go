@@ -0,0 +1,138 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"time"
+	_ "time/tzdata" // 运行镜像(alpine)不含时区数据库
+
+	"l2tp-manager/internal/database"
+
+	"gorm.io/gorm"
+)
+
+// validateBilling 校验计费周期起始日和时区
+func validateBilling(server *database.L2TPServer) error {
+	if server.BillingAnchorDay < 0 || server.BillingAnchorDay > 31 {
+		return fmt.Errorf("计费周期起始日必须在1到31之间，0表示自然月")
+	}
+	if server.BillingTimezone != "" {
+		if _, err := time.LoadLocation(server.BillingTimezone); err != nil {
+			return fmt.Errorf("无效的计费时区 %q，应为IANA时区名称，如 Asia/Shanghai", server.BillingTimezone)
+		}
+	}
+	return nil
+}
+
+// billingLocation 服务器计费周期使用的时区，未设置或无法加载时为面板所在时区
+func billingLocation(server *database.L2TPServer) *time.Location {
+	if server.BillingTimezone != "" {
+		if location, err := time.LoadLocation(server.BillingTimezone); err == nil {
+			return location
+		}
+	}
+	return time.Local
+}
+
+// billingAnchor 计费周期在指定月份的起点：起始日超过该月天数时为该月最后一天
+func billingAnchor(server *database.L2TPServer, year int, month time.Month) time.Time {
+	location := billingLocation(server)
+	day := max(server.BillingAnchorDay, 1)
+	if last := time.Date(year, month+1, 0, 0, 0, 0, 0, location).Day(); day > last {
+		day = last
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, location)
+}
+
+// BillingPeriod 服务器的一个计费周期，Period为周期起点所在的月份(YYYY-MM)，用于按月存储用量和生成报告
+type BillingPeriod struct {
+	Period string    `json:"period"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+}
+
+// CurrentBillingPeriod 时间t所在的服务器计费周期，未设置起始日时为自然月
+func CurrentBillingPeriod(server *database.L2TPServer, t time.Time) BillingPeriod {
+	local := t.In(billingLocation(server))
+	start := billingAnchor(server, local.Year(), local.Month())
+	if start.After(local) {
+		previous := local.AddDate(0, 0, -local.Day()+1).AddDate(0, -1, 0)
+		start = billingAnchor(server, previous.Year(), previous.Month())
+	}
+	return billingPeriodFrom(server, start)
+}
+
+// BillingPeriodOf 服务器在指定月份(YYYY-MM)开始的计费周期
+func BillingPeriodOf(server *database.L2TPServer, period string) (BillingPeriod, error) {
+	month, err := time.Parse(usagePeriodLayout, period)
+	if err != nil {
+		return BillingPeriod{}, fmt.Errorf("无效的月份 %q，格式为YYYY-MM", period)
+	}
+	return billingPeriodFrom(server, billingAnchor(server, month.Year(), month.Month())), nil
+}
+
+// billingPeriodFrom 从起点开始的计费周期，终点为下个月的起始日
+func billingPeriodFrom(server *database.L2TPServer, start time.Time) BillingPeriod {
+	next := start.AddDate(0, 0, -start.Day()+1).AddDate(0, 1, 0)
+	return BillingPeriod{
+		Period: start.Format(usagePeriodLayout),
+		Start:  start,
+		End:    billingAnchor(server, next.Year(), next.Month()),
+	}
+}
+
+// billingPeriodLabel 时间t所在的服务器计费周期的月份
+func billingPeriodLabel(server *database.L2TPServer, t time.Time) string {
+	return CurrentBillingPeriod(server, t).Period
+}
+
+// billingServers 用于计算计费周期的服务器字段(含已删除的服务器)
+func billingServers(db *gorm.DB) *gorm.DB {
+	return db.Unscoped().Model(&database.L2TPServer{}).Select("id", "name", "billing_anchor_day", "billing_timezone", "tenant_id")
+}
+
+// sumPeriodTraffic 按服务器统计各自计费周期内的流量(按小时样本，周期起点不一定是整天)。
+// period为空时统计now所在的周期至今，否则统计该月份开始的周期。只返回有流量的服务器，按流量倒序
+func sumPeriodTraffic(db *gorm.DB, servers []database.L2TPServer, period string, now time.Time) ([]TrafficReportRow, error) {
+	// 起止时间相同的服务器合并查询
+	type span struct{ start, end time.Time }
+	groups := make(map[span][]uint)
+	names := make(map[uint]string, len(servers))
+	for i := range servers {
+		server := &servers[i]
+		names[server.ID] = server.Name
+		billing := CurrentBillingPeriod(server, now)
+		if period != "" {
+			var err error
+			if billing, err = BillingPeriodOf(server, period); err != nil {
+				return nil, err
+			}
+		}
+		// 流量样本的时间桶按面板所在时区保存，查询条件使用相同的时区
+		key := span{billing.Start.In(time.Local), billing.End.In(time.Local)}
+		groups[key] = append(groups[key], server.ID)
+	}
+
+	rows := []TrafficReportRow{}
+	for key, ids := range groups {
+		var group []TrafficReportRow
+		err := db.Model(&database.TrafficSample{}).
+			Select("server_id, SUM(bytes) AS bytes").
+			Where("granularity = ? AND bucket >= ? AND bucket < ? AND server_id IN ?", GranularityHour, key.start, key.end, ids).
+			Group("server_id").Scan(&group).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range group {
+			row.ServerName = names[row.ServerID]
+			rows = append(rows, row)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Bytes != rows[j].Bytes {
+			return rows[i].Bytes > rows[j].Bytes
+		}
+		return rows[i].ServerID < rows[j].ServerID
+	})
+	return rows, nil
+}
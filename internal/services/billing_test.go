@@ -0,0 +1,114 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"l2tp-manager/internal/database"
+)
+
+func TestCurrentBillingPeriod(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utc := func(year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name      string
+		anchorDay int
+		timezone  string
+		time      time.Time
+		want      BillingPeriod
+	}{
+		{"自然月", 0, "UTC", utc(2024, 3, 15, 12, 0),
+			BillingPeriod{"2024-03", utc(2024, 3, 1, 0, 0), utc(2024, 4, 1, 0, 0)}},
+		{"起始日当天零点属于新周期", 15, "UTC", utc(2024, 3, 15, 0, 0),
+			BillingPeriod{"2024-03", utc(2024, 3, 15, 0, 0), utc(2024, 4, 15, 0, 0)}},
+		{"起始日之前属于上个周期", 15, "UTC", utc(2024, 3, 14, 23, 59),
+			BillingPeriod{"2024-02", utc(2024, 2, 15, 0, 0), utc(2024, 3, 15, 0, 0)}},
+		{"跨年", 10, "UTC", utc(2024, 1, 5, 0, 0),
+			BillingPeriod{"2023-12", utc(2023, 12, 10, 0, 0), utc(2024, 1, 10, 0, 0)}},
+		{"起始日超过月份天数时为闰年二月最后一天", 31, "UTC", utc(2024, 2, 29, 12, 0),
+			BillingPeriod{"2024-02", utc(2024, 2, 29, 0, 0), utc(2024, 3, 31, 0, 0)}},
+		{"二月最后一天之前属于一月的周期", 31, "UTC", utc(2024, 2, 28, 12, 0),
+			BillingPeriod{"2024-01", utc(2024, 1, 31, 0, 0), utc(2024, 2, 29, 0, 0)}},
+		{"平年二月", 31, "UTC", utc(2023, 2, 28, 0, 0),
+			BillingPeriod{"2023-02", utc(2023, 2, 28, 0, 0), utc(2023, 3, 31, 0, 0)}},
+		{"上个周期的起点按上月天数截断", 30, "UTC", utc(2024, 3, 1, 0, 0),
+			BillingPeriod{"2024-02", utc(2024, 2, 29, 0, 0), utc(2024, 3, 30, 0, 0)}},
+		{"按计费时区划分周期", 1, "Asia/Shanghai", utc(2024, 3, 31, 17, 0),
+			BillingPeriod{"2024-04", time.Date(2024, 4, 1, 0, 0, 0, 0, shanghai), time.Date(2024, 5, 1, 0, 0, 0, 0, shanghai)}},
+		{"计费时区的上个周期", 1, "Asia/Shanghai", utc(2024, 3, 31, 15, 59),
+			BillingPeriod{"2024-03", time.Date(2024, 3, 1, 0, 0, 0, 0, shanghai), time.Date(2024, 4, 1, 0, 0, 0, 0, shanghai)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &database.L2TPServer{BillingAnchorDay: tt.anchorDay, BillingTimezone: tt.timezone}
+			got := CurrentBillingPeriod(server, tt.time)
+			if got.Period != tt.want.Period || !got.Start.Equal(tt.want.Start) || !got.End.Equal(tt.want.End) {
+				t.Fatalf("计费周期 = %s [%s, %s), 期望 %s [%s, %s)",
+					got.Period, got.Start.Format(time.RFC3339), got.End.Format(time.RFC3339),
+					tt.want.Period, tt.want.Start.Format(time.RFC3339), tt.want.End.Format(time.RFC3339))
+			}
+			if tt.time.Before(got.Start) || !tt.time.Before(got.End) {
+				t.Fatalf("%s 不在计费周期 [%s, %s) 内", tt.time.Format(time.RFC3339), got.Start.Format(time.RFC3339), got.End.Format(time.RFC3339))
+			}
+		})
+	}
+}
+
+func TestBillingPeriodOf(t *testing.T) {
+	server := &database.L2TPServer{BillingAnchorDay: 31, BillingTimezone: "UTC"}
+
+	tests := []struct {
+		period    string
+		wantStart time.Time
+		wantEnd   time.Time
+		wantErr   bool
+	}{
+		{"2024-01", time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC), time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), false},
+		{"2024-02", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC), false},
+		{"2024-12", time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC), false},
+		{"2024-13", time.Time{}, time.Time{}, true},
+		{"202402", time.Time{}, time.Time{}, true},
+		{"", time.Time{}, time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := BillingPeriodOf(server, tt.period)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("BillingPeriodOf(%q) 错误 = %v, 期望出错 %v", tt.period, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if got.Period != tt.period || !got.Start.Equal(tt.wantStart) || !got.End.Equal(tt.wantEnd) {
+			t.Errorf("BillingPeriodOf(%q) = %s [%s, %s), 期望 [%s, %s)", tt.period, got.Period,
+				got.Start.Format(time.RFC3339), got.End.Format(time.RFC3339),
+				tt.wantStart.Format(time.RFC3339), tt.wantEnd.Format(time.RFC3339))
+		}
+	}
+}
+
+func TestValidateBilling(t *testing.T) {
+	tests := []struct {
+		anchorDay int
+		timezone  string
+		wantErr   bool
+	}{
+		{0, "", false},
+		{31, "Asia/Shanghai", false},
+		{-1, "", true},
+		{32, "", true},
+		{1, "Mars/Olympus", true},
+	}
+	for _, tt := range tests {
+		err := validateBilling(&database.L2TPServer{BillingAnchorDay: tt.anchorDay, BillingTimezone: tt.timezone})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validateBilling(%d, %q) 错误 = %v, 期望出错 %v", tt.anchorDay, tt.timezone, err, tt.wantErr)
+		}
+	}
+}
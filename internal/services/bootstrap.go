@@ -0,0 +1,409 @@
+package services
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"text/template"
+	"time"
+
+	"l2tp-manager/internal/database"
+
+	"golang.org/x/crypto/ssh"
+	"gorm.io/gorm"
+)
+
+// 注册令牌参数
+const (
+	bootstrapTokenPrefix = "bt_"
+	bootstrapDefaultTTL  = 24 * time.Hour
+	bootstrapMaxTTL      = 30 * 24 * time.Hour
+)
+
+// 待审核落地机状态
+const (
+	PendingStatusPending  = "pending"
+	PendingStatusApproved = "approved"
+	PendingStatusRejected = "rejected"
+)
+
+// ErrBootstrapToken 注册令牌缺失、无效、过期或已用完
+var ErrBootstrapToken = errors.New("注册令牌无效或已过期")
+
+// BootstrapService 落地机自助注册：注册令牌、注册脚本和待审核落地机
+type BootstrapService struct {
+	db       *gorm.DB
+	l2tp     *L2TPService
+	notifier *NotificationService
+	key      *database.PanelKey
+}
+
+// BootstrapTokenRequest 创建注册令牌的参数
+type BootstrapTokenRequest struct {
+	Name     string `json:"name"`
+	MaxUses  *int   `json:"max_uses" binding:"omitempty,gte=0"` // 默认1，0表示不限
+	TTLHours int    `json:"ttl_hours" binding:"gte=0,lte=720"`  // 默认24小时，最长30天
+}
+
+// RegisterRequest 注册脚本上报的落地机信息
+type RegisterRequest struct {
+	Hostname     string `form:"hostname" json:"hostname"`
+	Host         string `form:"host" json:"host"` // 为空时使用请求来源地址
+	SSHPort      int    `form:"ssh_port" json:"ssh_port"`
+	Username     string `form:"username" json:"username"`
+	Password     string `form:"password" json:"password"`
+	KeyInstalled bool   `form:"key_installed" json:"key_installed"`
+	OS           string `form:"os" json:"os"`
+	Arch         string `form:"arch" json:"arch"`
+	Docker       bool   `form:"docker" json:"docker"`
+}
+
+// NewBootstrapService 创建注册服务，加载或生成面板SSH密钥
+func NewBootstrapService(db *gorm.DB, l2tp *L2TPService, notifier *NotificationService) (*BootstrapService, error) {
+	s := &BootstrapService{db: db, l2tp: l2tp, notifier: notifier}
+	key, err := loadPanelKey(db)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey([]byte(key.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("解析面板SSH密钥失败: %v", err)
+	}
+	SetPanelSSHKey(signer)
+	s.key = key
+	return s, nil
+}
+
+// loadPanelKey 读取面板SSH密钥，不存在时生成ed25519密钥
+func loadPanelKey(db *gorm.DB) (*database.PanelKey, error) {
+	var key database.PanelKey
+	result := db.Order("id").Limit(1).Find(&key)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return &key, nil
+	}
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("生成面板SSH密钥失败: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKey(private, "l2tp-manager")
+	if err != nil {
+		return nil, fmt.Errorf("生成面板SSH密钥失败: %v", err)
+	}
+	sshPublic, err := ssh.NewPublicKey(public)
+	if err != nil {
+		return nil, err
+	}
+	key = database.PanelKey{
+		PrivateKey: string(pem.EncodeToMemory(block)),
+		PublicKey:  strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPublic))) + " l2tp-manager",
+	}
+	if err := db.Create(&key).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// PublicKey 面板SSH公钥(authorized_keys格式)
+func (s *BootstrapService) PublicKey() string {
+	return s.key.PublicKey
+}
+
+// hashBootstrapToken 计算注册令牌的存储值
+func hashBootstrapToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateToken 创建注册令牌，令牌只在此时返回一次
+func (s *BootstrapService) CreateToken(req BootstrapTokenRequest, createdBy string) (*database.BootstrapToken, string, error) {
+	maxUses := 1
+	if req.MaxUses != nil {
+		maxUses = *req.MaxUses
+	}
+	if maxUses < 0 {
+		return nil, "", fmt.Errorf("注册次数不能为负数")
+	}
+	ttl := time.Duration(req.TTLHours) * time.Hour
+	if ttl <= 0 {
+		ttl = bootstrapDefaultTTL
+	}
+	if ttl > bootstrapMaxTTL {
+		return nil, "", fmt.Errorf("有效期最长30天")
+	}
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", fmt.Errorf("生成注册令牌失败: %v", err)
+	}
+	token := bootstrapTokenPrefix + hex.EncodeToString(buf)
+	record := &database.BootstrapToken{
+		Name:      strings.TrimSpace(req.Name),
+		TokenHash: hashBootstrapToken(token),
+		MaxUses:   maxUses,
+		ExpiresAt: time.Now().Add(ttl),
+		CreatedBy: createdBy,
+	}
+	if record.Name == "" {
+		record.Name = "落地机注册"
+	}
+	if err := s.db.Create(record).Error; err != nil {
+		return nil, "", err
+	}
+	return record, token, nil
+}
+
+// ListTokens 列出注册令牌
+func (s *BootstrapService) ListTokens() ([]database.BootstrapToken, error) {
+	tokens := []database.BootstrapToken{}
+	err := s.db.Order("id DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+// RevokeToken 删除注册令牌，已登记的落地机不受影响
+func (s *BootstrapService) RevokeToken(id uint) error {
+	result := s.db.Delete(&database.BootstrapToken{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("注册令牌不存在")
+	}
+	return nil
+}
+
+// findToken 查找有效的注册令牌
+func findToken(tx *gorm.DB, token string) (*database.BootstrapToken, error) {
+	if !strings.HasPrefix(token, bootstrapTokenPrefix) {
+		return nil, ErrBootstrapToken
+	}
+	var record database.BootstrapToken
+	result := tx.Where("token_hash = ?", hashBootstrapToken(token)).Limit(1).Find(&record)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || time.Now().After(record.ExpiresAt) ||
+		(record.MaxUses > 0 && record.Uses >= record.MaxUses) {
+		return nil, ErrBootstrapToken
+	}
+	return &record, nil
+}
+
+// bootstrapScript 落地机注册脚本：检测SSH端口和系统信息，安装面板公钥(或使用SSH_PASSWORD)，向面板登记
+var bootstrapScript = template.Must(template.New("bootstrap").Parse(`#!/bin/sh
+# L2TP管理面板 落地机注册脚本
+# 可选环境变量: EXIT_HOST(对外地址，默认为面板看到的来源地址) SSH_PORT SSH_USER(默认root)
+#               SSH_PASSWORD(提供后不安装面板公钥，面板使用密码连接)
+set -e
+
+PANEL='{{.PanelURL}}'
+TOKEN='{{.Token}}'
+PUBKEY='{{.PublicKey}}'
+
+if [ "$(id -u)" != "0" ]; then
+	echo "请以root身份运行" >&2
+	exit 1
+fi
+command -v curl >/dev/null 2>&1 || { echo "需要curl" >&2; exit 1; }
+
+SSH_USER="${SSH_USER:-root}"
+if [ -z "$SSH_PORT" ]; then
+	SSH_PORT=$(sshd -T 2>/dev/null | awk '$1=="port"{print $2; exit}')
+fi
+SSH_PORT="${SSH_PORT:-22}"
+
+KEY_INSTALLED=false
+if [ -z "$SSH_PASSWORD" ]; then
+	HOME_DIR=$(getent passwd "$SSH_USER" | cut -d: -f6)
+	[ -n "$HOME_DIR" ] || { echo "用户 $SSH_USER 不存在" >&2; exit 1; }
+	mkdir -p "$HOME_DIR/.ssh"
+	chmod 700 "$HOME_DIR/.ssh"
+	touch "$HOME_DIR/.ssh/authorized_keys"
+	grep -qF "$PUBKEY" "$HOME_DIR/.ssh/authorized_keys" || echo "$PUBKEY" >> "$HOME_DIR/.ssh/authorized_keys"
+	chmod 600 "$HOME_DIR/.ssh/authorized_keys"
+	chown -R "$SSH_USER" "$HOME_DIR/.ssh"
+	KEY_INSTALLED=true
+	echo "已为 $SSH_USER 安装面板SSH公钥"
+fi
+
+OS_NAME=$(. /etc/os-release 2>/dev/null && echo "$PRETTY_NAME" || uname -s)
+DOCKER=false
+command -v docker >/dev/null 2>&1 && DOCKER=true
+
+curl -fsS -X POST "$PANEL/api/v1/bootstrap/register" \
+	-H "Authorization: Bearer $TOKEN" \
+	--data-urlencode "hostname=$(hostname)" \
+	--data-urlencode "host=${EXIT_HOST:-}" \
+	--data-urlencode "ssh_port=$SSH_PORT" \
+	--data-urlencode "username=$SSH_USER" \
+	--data-urlencode "password=${SSH_PASSWORD:-}" \
+	--data-urlencode "key_installed=$KEY_INSTALLED" \
+	--data-urlencode "os=$OS_NAME" \
+	--data-urlencode "arch=$(uname -m)" \
+	--data-urlencode "docker=$DOCKER"
+echo
+echo "已向面板登记，等待管理员审核"
+`))
+
+// Script 生成注册脚本，令牌无效时返回错误
+func (s *BootstrapService) Script(token, panelURL string) (string, error) {
+	if _, err := findToken(s.db, token); err != nil {
+		return "", err
+	}
+	if strings.ContainsAny(panelURL, "'\\\n") {
+		return "", fmt.Errorf("无效的面板地址")
+	}
+	var buf bytes.Buffer
+	err := bootstrapScript.Execute(&buf, map[string]string{
+		"PanelURL":  panelURL,
+		"Token":     token,
+		"PublicKey": s.key.PublicKey,
+	})
+	return buf.String(), err
+}
+
+// Register 落地机登记为待审核服务器，同一地址已有待审核记录时更新该记录
+func (s *BootstrapService) Register(token string, req RegisterRequest, remoteIP string) (*database.PendingServer, error) {
+	req.Host = strings.TrimSpace(req.Host)
+	if req.Host == "" {
+		req.Host = remoteIP
+	}
+	if net.ParseIP(req.Host) == nil && !validRelayAddress(req.Host) {
+		return nil, fmt.Errorf("无效的落地机地址 %q", req.Host)
+	}
+	if req.SSHPort <= 0 || req.SSHPort > 65535 {
+		req.SSHPort = 22
+	}
+	if req.Username == "" {
+		req.Username = "root"
+	}
+	if req.Password == "" && !req.KeyInstalled {
+		return nil, fmt.Errorf("需要安装面板SSH公钥或提供SSH密码")
+	}
+
+	var pending database.PendingServer
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		record, err := findToken(tx, token)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(record).UpdateColumn("uses", gorm.Expr("uses + 1")).Error; err != nil {
+			return err
+		}
+
+		result := tx.Where("host = ? AND status = ?", req.Host, PendingStatusPending).Limit(1).Find(&pending)
+		if result.Error != nil {
+			return result.Error
+		}
+		pending.TokenID = record.ID
+		pending.Hostname = truncateField(req.Hostname, 255)
+		pending.Host = req.Host
+		pending.SSHPort = req.SSHPort
+		pending.Username = req.Username
+		pending.Password = req.Password
+		pending.KeyInstalled = req.KeyInstalled
+		pending.OS = truncateField(req.OS, 255)
+		pending.Arch = truncateField(req.Arch, 32)
+		pending.Docker = req.Docker
+		pending.RemoteAddr = remoteIP
+		pending.Status = PendingStatusPending
+		return tx.Save(&pending).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if s.notifier != nil {
+		s.notifier.Publish(Event{
+			Type:    EventServerRegistered,
+			Message: fmt.Sprintf("落地机 %s (%s) 已通过注册脚本登记，等待审核", pending.Hostname, pending.Host),
+			Data: map[string]interface{}{
+				"pending_id": pending.ID,
+				"host":       pending.Host,
+				"hostname":   pending.Hostname,
+			},
+		})
+	}
+	return &pending, nil
+}
+
+// truncateField 截断过长的上报字段
+func truncateField(value string, max int) string {
+	if len(value) > max {
+		return value[:max]
+	}
+	return value
+}
+
+// ListPending 列出登记的落地机，status为空时列出全部
+func (s *BootstrapService) ListPending(status string) ([]database.PendingServer, error) {
+	servers := []database.PendingServer{}
+	query := s.db.Order("id DESC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Find(&servers).Error
+	return servers, err
+}
+
+// getPending 获取待审核的落地机
+func (s *BootstrapService) getPending(id uint) (*database.PendingServer, error) {
+	var pending database.PendingServer
+	if err := s.db.First(&pending, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("登记记录不存在")
+		}
+		return nil, err
+	}
+	if pending.Status != PendingStatusPending {
+		return nil, fmt.Errorf("该落地机已审核")
+	}
+	return &pending, nil
+}
+
+// Approve 审核通过：以登记的地址和SSH信息创建服务器，其余配置(名称、端口、用户等)由管理员提供
+func (s *BootstrapService) Approve(id uint, server *database.L2TPServer) (*database.PendingServer, error) {
+	pending, err := s.getPending(id)
+	if err != nil {
+		return nil, err
+	}
+	if server.Name == "" {
+		server.Name = pending.Hostname
+	}
+	server.Host = pending.Host
+	server.Port = pending.SSHPort
+	server.Username = pending.Username
+	server.Password = pending.Password
+	if err := s.l2tp.CreateServer(server); err != nil {
+		return nil, err
+	}
+
+	pending.Status = PendingStatusApproved
+	pending.ServerID = server.ID
+	pending.Password = ""
+	if err := s.db.Save(pending).Error; err != nil {
+		return nil, err
+	}
+	return pending, nil
+}
+
+// Reject 拒绝登记
+func (s *BootstrapService) Reject(id uint) (*database.PendingServer, error) {
+	pending, err := s.getPending(id)
+	if err != nil {
+		return nil, err
+	}
+	pending.Status = PendingStatusRejected
+	pending.Password = ""
+	return pending, s.db.Save(pending).Error
+}
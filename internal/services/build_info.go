@@ -0,0 +1,62 @@
+package services
+
+import (
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/xtls/xray-core/core"
+)
+
+// processStartedAt 进程启动时间，用于计算运行时长
+var processStartedAt = time.Now()
+
+// BuildInfo 面板的构建信息，版本号、提交和Xray-core版本在构建时通过-ldflags注入
+type BuildInfo struct {
+	Version     string `json:"version"`
+	Commit      string `json:"commit"`     // 未注入时取go build记录的vcs.revision，均没有时为空
+	BuildTime   string `json:"build_time"` // 未注入时为空
+	GoVersion   string `json:"go_version"`
+	XrayVersion string `json:"xray_version"` // 未注入时为编译进来的Xray-core版本
+}
+
+// NewBuildInfo 合并-ldflags注入的构建信息和Go工具链记录的构建信息
+func NewBuildInfo(version, commit, buildTime, xrayVersion string) BuildInfo {
+	info := BuildInfo{
+		Version:     version,
+		Commit:      commit,
+		BuildTime:   buildTime,
+		GoVersion:   runtime.Version(),
+		XrayVersion: xrayVersion,
+	}
+	if info.XrayVersion == "" {
+		info.XrayVersion = core.Version()
+	}
+	if build, ok := debug.ReadBuildInfo(); ok && info.Commit == "" {
+		for _, setting := range build.Settings {
+			if setting.Key == "vcs.revision" {
+				info.Commit = setting.Value
+			}
+		}
+	}
+	return info
+}
+
+// RuntimeInfo 构建信息及进程的运行时长
+type RuntimeInfo struct {
+	BuildInfo
+	StartedAt     time.Time `json:"started_at"`
+	UptimeSeconds int64     `json:"uptime_seconds"`
+	Uptime        string    `json:"uptime"` // 如 72h3m5s
+}
+
+// Runtime 截至now的运行信息
+func (b BuildInfo) Runtime(now time.Time) RuntimeInfo {
+	uptime := now.Sub(processStartedAt).Truncate(time.Second)
+	return RuntimeInfo{
+		BuildInfo:     b,
+		StartedAt:     processStartedAt,
+		UptimeSeconds: int64(uptime / time.Second),
+		Uptime:        uptime.String(),
+	}
+}
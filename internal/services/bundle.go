@@ -0,0 +1,522 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"l2tp-manager/internal/database"
+
+	"golang.org/x/crypto/scrypt"
+	"gorm.io/gorm"
+)
+
+// bundleVersion 配置包格式版本
+const bundleVersion = 1
+
+// 导入冲突处理方式
+const (
+	ImportModeSkip      = "skip"      // 跳过已存在的项目
+	ImportModeOverwrite = "overwrite" // 覆盖已存在的项目
+	ImportModeRename    = "rename"    // 同名服务器改名后作为新服务器导入
+)
+
+// 加密配置包使用的参数
+const (
+	bundleCipher      = "scrypt-aes-256-gcm"
+	bundleSecretLabel = "enc:"
+	bundleCheckValue  = "l2tp-manager"
+)
+
+// ConfigBundle 可迁移的完整配置包
+type ConfigBundle struct {
+	Version    int               `json:"version"`
+	ExportedAt time.Time         `json:"exported_at"`
+	Encryption *BundleEncryption `json:"encryption,omitempty"` // 为空表示敏感字段未加密
+	Servers    []BundleServer    `json:"servers"`
+	Users      []BundleUser      `json:"users"`
+	Settings   BundleSettings    `json:"settings"`
+}
+
+// BundleEncryption 敏感字段加密参数
+type BundleEncryption struct {
+	Algorithm string `json:"algorithm"`
+	Salt      string `json:"salt"`
+	Check     string `json:"check"` // 加密后的校验值，用于验证口令
+}
+
+// BundleServer 配置包中的服务器(含转发规则)
+type BundleServer struct {
+	ServerConfig
+	RestartSchedule      string `json:"restart_schedule"`
+	RestartJitter        int    `json:"restart_jitter"`
+	RestartSkipIfClients bool   `json:"restart_skip_if_clients"`
+	RelayNode            string `json:"relay_node,omitempty"`       // 中转节点名称，导入时按名称匹配
+	ChainNodeNames       string `json:"chain_node_names,omitempty"` // 链式转发经过的中转节点名称(逗号分隔)，导入时按名称匹配
+	ExternalID           string `json:"external_id,omitempty"`      // 导入新建时沿用，已被占用时重新生成
+
+	WireGuardPrivateKey string `json:"wireguard_private_key,omitempty"` // 导入新建时沿用，客户端配置保持有效
+	WireGuardPeers      string `json:"wireguard_peers,omitempty"`
+	PKI                 string `json:"pki,omitempty"` // 导入新建时沿用，已分发的客户端配置文件保持有效
+	XrayCredentials     string `json:"xray_credentials,omitempty"`
+}
+
+// BundleUser 配置包中的管理员用户
+type BundleUser struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// BundleSettings 配置包中的系统设置
+type BundleSettings struct {
+	BackupPolicy *database.BackupPolicy `json:"backup_policy,omitempty"`
+	Values       map[string]string      `json:"values,omitempty"` // 已覆盖默认值的运行时设置
+}
+
+// ImportItem 单个项目的导入结果
+type ImportItem struct {
+	Name    string `json:"name"`
+	Action  string `json:"action"` // created/updated/renamed/skipped/failed
+	Message string `json:"message,omitempty"`
+}
+
+// ImportResult 配置包导入结果
+type ImportResult struct {
+	Servers  []ImportItem `json:"servers"`
+	Users    []ImportItem `json:"users"`
+	Settings []ImportItem `json:"settings"`
+}
+
+// BundleService 配置导出/导入服务
+type BundleService struct {
+	db             *gorm.DB
+	l2tpService    *L2TPService
+	routingService Forwarding
+	backupService  *BackupService
+	settings       *SettingsService
+}
+
+// NewBundleService 创建配置导出/导入服务
+func NewBundleService(db *gorm.DB, l2tpService *L2TPService, routingService Forwarding, backupService *BackupService, settings *SettingsService) *BundleService {
+	return &BundleService{
+		db:             db,
+		l2tpService:    l2tpService,
+		routingService: routingService,
+		backupService:  backupService,
+		settings:       settings,
+	}
+}
+
+// Export 导出配置包，passphrase非空时加密敏感字段
+func (b *BundleService) Export(passphrase string) (*ConfigBundle, error) {
+	bundle := &ConfigBundle{
+		Version:    bundleVersion,
+		ExportedAt: time.Now(),
+		Servers:    []BundleServer{},
+		Users:      []BundleUser{},
+	}
+
+	var box *secretBox
+	if passphrase != "" {
+		var err error
+		box, bundle.Encryption, err = newSecretBox(passphrase)
+		if err != nil {
+			return nil, err
+		}
+	}
+	seal := func(value string) string {
+		if box == nil || value == "" {
+			return value
+		}
+		return box.seal(value)
+	}
+
+	var servers []database.L2TPServer
+	if err := b.db.Order("id").Find(&servers).Error; err != nil {
+		return nil, err
+	}
+	nodeNames, err := b.relayNodeNames()
+	if err != nil {
+		return nil, err
+	}
+	for i := range servers {
+		item := BundleServer{
+			ServerConfig:         configOf(&servers[i]),
+			RestartSchedule:      servers[i].RestartSchedule,
+			RestartJitter:        servers[i].RestartJitter,
+			RestartSkipIfClients: servers[i].RestartSkipIfClients,
+			ExternalID:           servers[i].ExternalID,
+			WireGuardPrivateKey:  servers[i].WireGuardPrivateKey,
+			WireGuardPeers:       servers[i].WireGuardPeers,
+			PKI:                  servers[i].PKI,
+			XrayCredentials:      servers[i].XrayCredentials,
+		}
+		// 节点ID只在本面板有效，按名称导出
+		item.RelayNode = nodeNames[item.RelayNodeID]
+		item.RelayNodeID = 0
+		hops, _ := parseChainNodes(item.ChainNodes)
+		names := make([]string, 0, len(hops))
+		for _, id := range hops {
+			names = append(names, nodeNames[id])
+		}
+		item.ChainNodeNames = strings.Join(names, ",")
+		item.ChainNodes = ""
+		item.Password = seal(item.Password)
+		item.PSK = seal(item.PSK)
+		item.KnockSecret = seal(item.KnockSecret)
+		item.ObfuscationKey = seal(item.ObfuscationKey)
+		item.Users = seal(item.Users)
+		item.WireGuardPrivateKey = seal(item.WireGuardPrivateKey)
+		item.WireGuardPeers = seal(item.WireGuardPeers)
+		item.PKI = seal(item.PKI)
+		item.XrayCredentials = seal(item.XrayCredentials)
+		bundle.Servers = append(bundle.Servers, item)
+	}
+
+	// 只导出平台管理员，租户用户随租户管理，导入后会成为平台管理员
+	var users []database.User
+	if err := b.db.Where("tenant_id = ?", 0).Order("id").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		bundle.Users = append(bundle.Users, BundleUser{Username: user.Username, Password: seal(user.Password)})
+	}
+
+	policy, err := b.backupService.GetPolicy()
+	if err != nil {
+		return nil, err
+	}
+	exported := *policy
+	exported.ID = 0
+	exported.LastRunAt = nil
+	exported.LastResult = ""
+	exported.UploadPassword = seal(exported.UploadPassword)
+	bundle.Settings.BackupPolicy = &exported
+
+	bundle.Settings.Values = make(map[string]string)
+	for _, setting := range b.settings.List() {
+		if setting.Overridden {
+			bundle.Settings.Values[setting.Key] = seal(b.settings.Get(setting.Key))
+		}
+	}
+
+	return bundle, nil
+}
+
+// Import 导入配置包。导入的新服务器处于停止状态，不会自动部署
+func (b *BundleService) Import(bundle *ConfigBundle, passphrase, mode, username string) (*ImportResult, error) {
+	switch mode {
+	case ImportModeSkip, ImportModeOverwrite, ImportModeRename:
+	default:
+		return nil, fmt.Errorf("无效的冲突处理方式: %s", mode)
+	}
+	if bundle.Version != bundleVersion {
+		return nil, fmt.Errorf("不支持的配置包版本: %d", bundle.Version)
+	}
+
+	open := func(value string) (string, error) { return value, nil }
+	if bundle.Encryption != nil {
+		if passphrase == "" {
+			return nil, fmt.Errorf("配置包已加密，请提供口令")
+		}
+		box, err := openSecretBox(passphrase, bundle.Encryption)
+		if err != nil {
+			return nil, err
+		}
+		open = box.open
+	}
+
+	// 先解密全部敏感字段，避免导入到一半才发现数据损坏
+	for i := range bundle.Servers {
+		server := &bundle.Servers[i]
+		for _, field := range []*string{&server.Password, &server.PSK, &server.KnockSecret, &server.ObfuscationKey, &server.Users, &server.WireGuardPrivateKey, &server.WireGuardPeers, &server.PKI, &server.XrayCredentials} {
+			value, err := open(*field)
+			if err != nil {
+				return nil, fmt.Errorf("服务器 %q 解密失败: %v", server.Name, err)
+			}
+			*field = value
+		}
+	}
+	for i := range bundle.Users {
+		value, err := open(bundle.Users[i].Password)
+		if err != nil {
+			return nil, fmt.Errorf("用户 %q 解密失败: %v", bundle.Users[i].Username, err)
+		}
+		bundle.Users[i].Password = value
+	}
+	if policy := bundle.Settings.BackupPolicy; policy != nil {
+		value, err := open(policy.UploadPassword)
+		if err != nil {
+			return nil, fmt.Errorf("备份策略解密失败: %v", err)
+		}
+		policy.UploadPassword = value
+	}
+	for key, sealed := range bundle.Settings.Values {
+		value, err := open(sealed)
+		if err != nil {
+			return nil, fmt.Errorf("设置 %q 解密失败: %v", key, err)
+		}
+		bundle.Settings.Values[key] = value
+	}
+
+	result := &ImportResult{Servers: []ImportItem{}, Users: []ImportItem{}, Settings: []ImportItem{}}
+	for i := range bundle.Servers {
+		result.Servers = append(result.Servers, b.importServer(&bundle.Servers[i], mode, username))
+	}
+	for _, user := range bundle.Users {
+		result.Users = append(result.Users, b.importUser(user, mode))
+	}
+	if policy := bundle.Settings.BackupPolicy; policy != nil {
+		item := ImportItem{Name: "backup_policy", Action: "skipped", Message: "保留当前设置"}
+		if mode == ImportModeOverwrite {
+			if _, err := b.backupService.UpdatePolicy(policy); err != nil {
+				item = ImportItem{Name: "backup_policy", Action: "failed", Message: err.Error()}
+			} else {
+				item = ImportItem{Name: "backup_policy", Action: "updated"}
+			}
+		}
+		result.Settings = append(result.Settings, item)
+	}
+	if len(bundle.Settings.Values) > 0 {
+		item := ImportItem{Name: "settings", Action: "skipped", Message: "保留当前设置"}
+		if mode == ImportModeOverwrite {
+			updates := make(map[string]*string, len(bundle.Settings.Values))
+			for key := range bundle.Settings.Values {
+				value := bundle.Settings.Values[key]
+				updates[key] = &value
+			}
+			if err := b.settings.Update(updates); err != nil {
+				item = ImportItem{Name: "settings", Action: "failed", Message: err.Error()}
+			} else {
+				item = ImportItem{Name: "settings", Action: "updated"}
+			}
+		}
+		result.Settings = append(result.Settings, item)
+	}
+
+	return result, nil
+}
+
+// relayNodeNames 中转节点ID到名称的映射
+func (b *BundleService) relayNodeNames() (map[uint]string, error) {
+	var nodes []database.RelayNode
+	if err := b.db.Find(&nodes).Error; err != nil {
+		return nil, err
+	}
+	names := make(map[uint]string, len(nodes))
+	for _, node := range nodes {
+		names[node.ID] = node.Name
+	}
+	return names, nil
+}
+
+// importServer 导入单个服务器
+func (b *BundleService) importServer(item *BundleServer, mode, username string) ImportItem {
+	var notice string
+	item.RelayNodeID = 0
+	if item.RelayNode != "" {
+		var node database.RelayNode
+		if b.db.Where("name = ?", item.RelayNode).Limit(1).Find(&node).RowsAffected > 0 {
+			item.RelayNodeID = node.ID
+		} else {
+			notice = fmt.Sprintf("中转节点 %s 不存在，改为本机转发", item.RelayNode)
+		}
+	}
+	item.ChainNodes = ""
+	if item.ChainNodeNames != "" {
+		var ids []string
+		for _, name := range strings.Split(item.ChainNodeNames, ",") {
+			var node database.RelayNode
+			if b.db.Where("name = ?", name).Limit(1).Find(&node).RowsAffected == 0 {
+				notice = fmt.Sprintf("链式中转节点 %s 不存在，改为直接转发到落地机", name)
+				ids = nil
+				break
+			}
+			ids = append(ids, strconv.FormatUint(uint64(node.ID), 10))
+		}
+		item.ChainNodes = strings.Join(ids, ",")
+	}
+	result := b.importServerConfig(item, mode, username)
+	if notice != "" && result.Action != "failed" && result.Action != "skipped" {
+		result.Message = notice
+	}
+	return result
+}
+
+// importServerConfig 按导入模式创建或覆盖服务器
+func (b *BundleService) importServerConfig(item *BundleServer, mode, username string) ImportItem {
+	var existing database.L2TPServer
+	err := b.db.Where("name = ?", item.Name).First(&existing).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return ImportItem{Name: item.Name, Action: "failed", Message: err.Error()}
+	}
+	found := err == nil
+
+	if found && mode == ImportModeSkip {
+		return ImportItem{Name: item.Name, Action: "skipped", Message: "同名服务器已存在"}
+	}
+
+	if found && mode == ImportModeOverwrite {
+		target := existing
+		applyBundleServer(&target, item)
+		if err := b.l2tpService.UpdateServer(existing.ID, &target); err != nil {
+			return ImportItem{Name: item.Name, Action: "failed", Message: err.Error()}
+		}
+		b.l2tpService.RecordRevision(&target, &existing, "import", username)
+		b.routingService.ReloadL2TPServer(existing.L2TPPort, &target)
+		return ImportItem{Name: item.Name, Action: "updated"}
+	}
+
+	action := "created"
+	if found {
+		item.Name = b.uniqueServerName(item.Name)
+		action = "renamed"
+	}
+
+	server := database.L2TPServer{Status: "stopped", DesiredState: "stopped"}
+	applyBundleServer(&server, item)
+	if item.ExternalID != "" && checkExternalID(b.db, item.ExternalID) == nil {
+		server.ExternalID = item.ExternalID
+	}
+	server.WireGuardPrivateKey = item.WireGuardPrivateKey
+	server.WireGuardPeers = item.WireGuardPeers
+	server.PKI = item.PKI
+	server.XrayCredentials = item.XrayCredentials
+	if err := b.l2tpService.CreateServer(&server); err != nil {
+		return ImportItem{Name: item.Name, Action: "failed", Message: err.Error()}
+	}
+	b.l2tpService.RecordRevision(&server, nil, "import", username)
+	return ImportItem{Name: item.Name, Action: action}
+}
+
+// applyBundleServer 将配置包中的服务器字段写入记录
+func applyBundleServer(server *database.L2TPServer, item *BundleServer) {
+	applyConfig(server, item.ServerConfig)
+	server.RestartSchedule = item.RestartSchedule
+	server.RestartJitter = item.RestartJitter
+	server.RestartSkipIfClients = item.RestartSkipIfClients
+}
+
+// uniqueServerName 生成不与现有服务器重名的名称
+func (b *BundleService) uniqueServerName(name string) string {
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)", name, i)
+		var count int64
+		b.db.Model(&database.L2TPServer{}).Where("name = ?", candidate).Count(&count)
+		if count == 0 {
+			return candidate
+		}
+	}
+}
+
+// importUser 导入单个管理员用户，改名模式对用户按跳过处理
+func (b *BundleService) importUser(item BundleUser, mode string) ImportItem {
+	var existing database.User
+	err := b.db.Where("username = ?", item.Username).First(&existing).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		user := database.User{Username: item.Username, Password: item.Password}
+		if err := b.db.Create(&user).Error; err != nil {
+			return ImportItem{Name: item.Username, Action: "failed", Message: err.Error()}
+		}
+		return ImportItem{Name: item.Username, Action: "created"}
+	case err != nil:
+		return ImportItem{Name: item.Username, Action: "failed", Message: err.Error()}
+	case mode == ImportModeOverwrite:
+		if err := b.db.Model(&existing).Update("password", item.Password).Error; err != nil {
+			return ImportItem{Name: item.Username, Action: "failed", Message: err.Error()}
+		}
+		return ImportItem{Name: item.Username, Action: "updated"}
+	default:
+		return ImportItem{Name: item.Username, Action: "skipped", Message: "用户已存在"}
+	}
+}
+
+// secretBox 使用口令派生密钥加解密敏感字段
+type secretBox struct {
+	aead cipher.AEAD
+}
+
+// newSecretBox 生成随机盐并创建加密器
+func newSecretBox(passphrase string) (*secretBox, *BundleEncryption, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, nil, err
+	}
+	box, err := deriveSecretBox(passphrase, salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	return box, &BundleEncryption{
+		Algorithm: bundleCipher,
+		Salt:      base64.StdEncoding.EncodeToString(salt),
+		Check:     box.seal(bundleCheckValue),
+	}, nil
+}
+
+// openSecretBox 根据配置包的加密参数创建解密器并校验口令
+func openSecretBox(passphrase string, enc *BundleEncryption) (*secretBox, error) {
+	if enc.Algorithm != bundleCipher {
+		return nil, fmt.Errorf("不支持的加密算法: %s", enc.Algorithm)
+	}
+	salt, err := base64.StdEncoding.DecodeString(enc.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("加密参数无效")
+	}
+	box, err := deriveSecretBox(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	if check, err := box.open(enc.Check); err != nil || check != bundleCheckValue {
+		return nil, fmt.Errorf("口令错误")
+	}
+	return box, nil
+}
+
+// deriveSecretBox 用scrypt从口令派生AES-256-GCM密钥
+func deriveSecretBox(passphrase string, salt []byte) (*secretBox, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &secretBox{aead: aead}, nil
+}
+
+// seal 加密明文，输出 "enc:" + base64(nonce|密文)
+func (s *secretBox) seal(plaintext string) string {
+	nonce := make([]byte, s.aead.NonceSize())
+	rand.Read(nonce)
+	sealed := s.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return bundleSecretLabel + base64.StdEncoding.EncodeToString(sealed)
+}
+
+// open 解密由seal生成的字段，未加密的值原样返回
+func (s *secretBox) open(value string) (string, error) {
+	if !strings.HasPrefix(value, bundleSecretLabel) {
+		return value, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, bundleSecretLabel))
+	if err != nil || len(data) < s.aead.NonceSize() {
+		return "", fmt.Errorf("密文格式无效")
+	}
+	nonce, ciphertext := data[:s.aead.NonceSize()], data[s.aead.NonceSize():]
+	plaintext, err := s.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("口令错误或数据已损坏")
+	}
+	return string(plaintext), nil
+}
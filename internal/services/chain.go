@@ -0,0 +1,366 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"l2tp-manager/internal/database"
+
+	"gorm.io/gorm"
+)
+
+// chainProbeTimeout 探测下一跳的超时时间
+const chainProbeTimeout = 3 * time.Second
+
+// relayAddressPattern 中转节点对外地址(域名)格式，IP地址另行校验
+var relayAddressPattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9.-]{0,251}[A-Za-z0-9])?$`)
+
+// HopProbe 转发器到下一跳(中转节点或落地机)的连通性探测结果
+type HopProbe struct {
+	Target    string    `json:"target"`
+	LatencyMs float64   `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// ChainHop 转发链中的一跳
+type ChainHop struct {
+	NodeID  uint      `json:"node_id"` // 0表示面板本机
+	Name    string    `json:"name"`
+	Address string    `json:"address"`
+	Online  bool      `json:"online"`
+	Running bool      `json:"running"` // 该跳的转发器是否在运行
+	Probe   *HopProbe `json:"probe,omitempty"`
+}
+
+// ChainView 服务器的完整转发链：入口、途经的中转节点和落地机，以及端到端状态
+type ChainView struct {
+	ServerID       uint       `json:"server_id"`
+	Hops           []ChainHop `json:"hops"`
+	Exit           string     `json:"exit"`             // 落地机地址和端口
+	TotalLatencyMs float64    `json:"total_latency_ms"` // 各跳延迟之和
+	Healthy        bool       `json:"healthy"`
+	Problem        string     `json:"problem,omitempty"` // 第一个异常的描述
+}
+
+// parseChainNodes 解析逗号分隔的中转节点ID
+func parseChainNodes(value string) ([]uint, error) {
+	var ids []uint
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || id == 0 {
+			return nil, fmt.Errorf("无效的链式中转节点ID %q", part)
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+// RelayNodeAddress 中转节点的对外地址：优先使用设置的地址，其次为节点连接面板的地址
+func RelayNodeAddress(node *database.RelayNode) string {
+	if node.Address != "" {
+		return node.Address
+	}
+	if host, _, err := net.SplitHostPort(node.RemoteAddr); err == nil {
+		return host
+	}
+	return node.RemoteAddr
+}
+
+// validRelayAddress 对外地址为空、IP地址或域名
+func validRelayAddress(address string) bool {
+	return address == "" || net.ParseIP(address) != nil || relayAddressPattern.MatchString(address)
+}
+
+// checkChainNodes 校验链式转发经过的中转节点：节点存在且已知地址，不重复，且不能是入口节点。校验通过后规范化为逗号分隔的ID
+func checkChainNodes(tx *gorm.DB, server *database.L2TPServer) error {
+	ids, err := parseChainNodes(server.ChainNodes)
+	if err != nil {
+		return err
+	}
+	seen := make(map[uint]bool)
+	parts := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id == server.RelayNodeID {
+			return fmt.Errorf("链式中转节点不能包含入口节点 %d", id)
+		}
+		if seen[id] {
+			return fmt.Errorf("链式中转节点 %d 重复", id)
+		}
+		seen[id] = true
+
+		var node database.RelayNode
+		result := tx.Limit(1).Find(&node, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("中转节点 %d 不存在", id)
+		}
+		if RelayNodeAddress(&node) == "" {
+			return fmt.Errorf("中转节点 %s 尚未连接面板，请先设置其对外地址", node.Name)
+		}
+		parts = append(parts, strconv.FormatUint(uint64(id), 10))
+	}
+	server.ChainNodes = strings.Join(parts, ",")
+	return nil
+}
+
+// chainedServers 链式转发经过指定节点的服务器名称(包括回收站)
+func chainedServers(tx *gorm.DB, nodeID uint) ([]string, error) {
+	var servers []database.L2TPServer
+	if err := tx.Unscoped().Where("chain_nodes != ''").Find(&servers).Error; err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, server := range servers {
+		ids, _ := parseChainNodes(server.ChainNodes)
+		for _, id := range ids {
+			if id == nodeID {
+				names = append(names, server.Name)
+				break
+			}
+		}
+	}
+	return names, nil
+}
+
+// relayAddresses 全部中转节点的对外地址
+func (r *RoutingService) relayAddresses() map[uint]string {
+	addresses := make(map[uint]string)
+	if r.db == nil {
+		return addresses
+	}
+	var nodes []database.RelayNode
+	if err := r.db.Find(&nodes).Error; err != nil {
+		slog.Warn("读取中转节点地址失败", "error", err)
+		return addresses
+	}
+	for i := range nodes {
+		addresses[nodes[i].ID] = RelayNodeAddress(&nodes[i])
+	}
+	return addresses
+}
+
+// resolveNextHop 面板本机作为入口的链式服务器，下一跳为链中第一个节点。
+// 中转节点上没有数据库，下一跳由面板随转发配置下发，保持不变
+func (r *RoutingService) resolveNextHop(server *database.L2TPServer, addresses map[uint]string) {
+	if r.db == nil {
+		return
+	}
+	server.NextHop = ""
+	if server.RelayNodeID != 0 || server.ChainNodes == "" {
+		return
+	}
+	ids, _ := parseChainNodes(server.ChainNodes)
+	if len(ids) > 0 {
+		if addresses == nil {
+			addresses = r.relayAddresses()
+		}
+		server.NextHop = addresses[ids[0]]
+	}
+}
+
+// forwardTarget 转发规则的目标：下一跳中转节点的同一监听端口，或落地机的服务端口(优先使用上报或解析得到的IP)
+func forwardTarget(server *database.L2TPServer, rule ForwardRule) (string, int) {
+	if server.NextHop != "" {
+		return server.NextHop, rule.ListenPort
+	}
+	if server.ResolvedIP != "" {
+		return server.ResolvedIP, rule.TargetPort
+	}
+	return server.Host, rule.TargetPort
+}
+
+// refreshChainHops 中转节点地址变化后重建面板本机作为入口的链式转发器
+func (r *RoutingService) refreshChainHops() {
+	r.serverMutex.Lock()
+	defer r.serverMutex.Unlock()
+
+	var addresses map[uint]string
+	for _, server := range r.servers {
+		if server.RelayNodeID != 0 || server.ChainNodes == "" {
+			continue
+		}
+		if addresses == nil {
+			addresses = r.relayAddresses()
+		}
+		previous := server.NextHop
+		r.resolveNextHop(server, addresses)
+		if server.NextHop == previous || server.Status != "running" {
+			continue
+		}
+		slog.Info("链式转发下一跳已变化，重建转发器", "server", server.Name, "previous", previous, "next_hop", server.NextHop)
+		r.stopServerForwarders(server, false)
+		if err := r.startServerForwarders(server); err != nil {
+			slog.Error("重建链式转发器失败", "server_id", server.ID, "error", err)
+		}
+	}
+}
+
+// probeHop 以TCP连接探测下一跳。连接被拒绝(只转发UDP的端口)同样说明对端可达，耗时即往返延迟
+func probeHop(ctx context.Context, host string, port int) HopProbe {
+	target := net.JoinHostPort(host, strconv.Itoa(port))
+	probe := HopProbe{Target: target, CheckedAt: time.Now()}
+	dialer := net.Dialer{Timeout: chainProbeTimeout}
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", target)
+	probe.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+	if err == nil {
+		conn.Close()
+	} else if !errors.Is(err, syscall.ECONNREFUSED) {
+		probe.Error = err.Error()
+	}
+	return probe
+}
+
+// probeHops 并发探测本机各转发服务器的下一跳，结果随中转节点状态上报或在转发链中展示
+func (r *RoutingService) probeHops() {
+	type target struct {
+		host string
+		port int
+	}
+	r.serverMutex.RLock()
+	targets := make(map[uint]target)
+	for _, server := range r.servers {
+		if server.Status != "running" || server.RelayNodeID != 0 {
+			continue
+		}
+		host, port := forwardTarget(server, ForwardRules(server)[0])
+		if host == "" {
+			continue
+		}
+		targets[server.ID] = target{host, port}
+	}
+	r.serverMutex.RUnlock()
+
+	probes := make(map[uint]HopProbe, len(targets))
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for id, t := range targets {
+		wg.Add(1)
+		go func(id uint, t target) {
+			defer wg.Done()
+			probe := probeHop(r.ctx, t.host, t.port)
+			mutex.Lock()
+			probes[id] = probe
+			mutex.Unlock()
+		}(id, t)
+	}
+	wg.Wait()
+
+	r.statsMutex.Lock()
+	r.hopProbes = probes
+	r.statsMutex.Unlock()
+}
+
+// HopProbe 本机转发服务器到下一跳的最近一次探测结果
+func (r *RoutingService) HopProbe(serverID uint) (HopProbe, bool) {
+	r.statsMutex.RLock()
+	defer r.statsMutex.RUnlock()
+	probe, ok := r.hopProbes[serverID]
+	return probe, ok
+}
+
+// forwarding 监听端口的转发器是否在运行
+func (r *RoutingService) forwarding(port int) bool {
+	for _, rule := range r.ActiveForwardRules() {
+		if rule.ListenPort == port {
+			return true
+		}
+	}
+	return false
+}
+
+// Chain 服务器的转发链及端到端状态。面板本机的探测结果直接读取，中转节点的探测结果来自其状态上报
+func (s *RelayNodeService) Chain(server *database.L2TPServer) (*ChainView, error) {
+	hopIDs, err := parseChainNodes(server.ChainNodes)
+	if err != nil {
+		return nil, err
+	}
+	nodeIDs := append([]uint{server.RelayNodeID}, hopIDs...)
+
+	var nodes []database.RelayNode
+	if err := s.db.Find(&nodes).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]*database.RelayNode, len(nodes))
+	for i := range nodes {
+		byID[nodes[i].ID] = &nodes[i]
+	}
+	agents := make(map[uint]AgentInfo)
+	for _, info := range s.hub.List() {
+		agents[info.NodeID] = info
+	}
+
+	rules := ForwardRules(server)
+	view := &ChainView{
+		ServerID: server.ID,
+		Hops:     make([]ChainHop, 0, len(nodeIDs)),
+		Exit:     net.JoinHostPort(server.Host, strconv.Itoa(rules[0].TargetPort)),
+		Healthy:  server.Status == "running",
+	}
+	if !view.Healthy {
+		view.Problem = "服务器未运行"
+	}
+	fail := func(problem string) {
+		if view.Healthy {
+			view.Healthy = false
+			view.Problem = problem
+		}
+	}
+
+	for _, id := range nodeIDs {
+		hop := ChainHop{NodeID: id, Name: "面板"}
+		if id == 0 {
+			hop.Online = true
+			hop.Running = s.hub.routing.forwarding(server.L2TPPort)
+			if probe, ok := s.hub.routing.HopProbe(server.ID); ok {
+				hop.Probe = &probe
+			}
+		} else if node, ok := byID[id]; ok {
+			hop.Name = node.Name
+			hop.Address = RelayNodeAddress(node)
+			if info, online := agents[id]; online {
+				hop.Online = true
+				for _, forwarder := range info.Forwarders {
+					if forwarder.ServerID == server.ID && forwarder.Port == server.L2TPPort {
+						hop.Running = forwarder.Running
+						hop.Probe = forwarder.Probe
+					}
+				}
+			}
+		} else {
+			hop.Name = fmt.Sprintf("节点%d(已删除)", id)
+		}
+
+		switch {
+		case !hop.Online:
+			fail(fmt.Sprintf("%s 不在线", hop.Name))
+		case !hop.Running:
+			fail(fmt.Sprintf("%s 的转发器未运行", hop.Name))
+		case hop.Probe == nil:
+			fail(fmt.Sprintf("%s 尚未探测下一跳", hop.Name))
+		case hop.Probe.Error != "":
+			fail(fmt.Sprintf("%s 到 %s 不可达: %s", hop.Name, hop.Probe.Target, hop.Probe.Error))
+		}
+		if hop.Probe != nil {
+			view.TotalLatencyMs += hop.Probe.LatencyMs
+		}
+		view.Hops = append(view.Hops, hop)
+	}
+	return view, nil
+}
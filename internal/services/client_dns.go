@@ -0,0 +1,94 @@
+package services
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"l2tp-manager/internal/database"
+)
+
+const (
+	// maxClientDNS 推送给客户端的DNS服务器数上限，L2TP服务器受SecureNAT限制为maxSecureNATDNS
+	maxClientDNS = 3
+	// maxDNSDomains 分流DNS域名数上限
+	maxDNSDomains = 20
+)
+
+// dnsDomainPattern 分流DNS的域名
+var dnsDomainPattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)*[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// parseClientDNS 解析逗号分隔的DNS服务器地址
+func parseClientDNS(value string) ([]string, error) {
+	var servers []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if net.ParseIP(item) == nil {
+			return nil, fmt.Errorf("无效的DNS服务器地址 %q", item)
+		}
+		servers = append(servers, item)
+	}
+	return servers, nil
+}
+
+// parseDNSDomains 解析逗号分隔的分流DNS域名，转为小写并去掉开头的点
+func parseDNSDomains(value string) []string {
+	var domains []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(item)), ".")
+		if item != "" {
+			domains = append(domains, item)
+		}
+	}
+	return domains
+}
+
+// validateClientDNS 校验推送给客户端的DNS服务器和分流DNS域名，并规范化为逗号分隔的列表。
+// Shadowsocks和VLESS服务器不下发DNS，相关字段由applyTypeDefaults清空
+func validateClientDNS(server *database.L2TPServer) error {
+	servers, err := parseClientDNS(server.ClientDNS)
+	if err != nil {
+		return err
+	}
+	limit := maxClientDNS
+	if server.Type == ServerTypeL2TP {
+		limit = maxSecureNATDNS
+		for _, item := range servers {
+			if net.ParseIP(item).To4() == nil {
+				return fmt.Errorf("L2TP服务器推送的DNS服务器只支持IPv4地址")
+			}
+		}
+	}
+	if len(servers) > limit {
+		return fmt.Errorf("%s服务器最多推送%d个DNS服务器", serverTypeName(server.Type), limit)
+	}
+
+	domains := parseDNSDomains(server.DNSDomains)
+	if len(domains) > maxDNSDomains {
+		return fmt.Errorf("分流DNS域名最多%d个", maxDNSDomains)
+	}
+	for _, domain := range domains {
+		if len(domain) > 253 || !dnsDomainPattern.MatchString(domain) {
+			return fmt.Errorf("无效的分流DNS域名 %q", domain)
+		}
+	}
+	if len(domains) > 0 && len(servers) == 0 {
+		return fmt.Errorf("设置分流DNS域名时需要同时设置DNS服务器")
+	}
+
+	server.ClientDNS = strings.Join(servers, ",")
+	server.DNSDomains = strings.Join(domains, ",")
+	return nil
+}
+
+// clientDNS 推送给客户端的DNS服务器，未设置时为fallback
+func clientDNS(server *database.L2TPServer, fallback ...string) []string {
+	if servers, _ := parseClientDNS(server.ClientDNS); len(servers) > 0 {
+		return servers
+	}
+	return fallback
+}
@@ -0,0 +1,207 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"l2tp-manager/internal/database"
+)
+
+// 密钥生成设置项
+const (
+	SettingCredentialPSKLength      = "credential_psk_length"
+	SettingCredentialPasswordLength = "credential_password_length"
+	SettingCredentialCharset        = "credential_charset"
+	SettingCredentialMinLength      = "credential_min_length"
+)
+
+// 生成密钥使用的字符集
+const (
+	CredentialCharsetAlnum        = "alnum"         // 大小写字母和数字
+	CredentialCharsetAlnumSymbols = "alnum_symbols" // 大小写字母、数字和符号
+	CredentialCharsetReadable     = "readable"      // 大小写字母和数字，去除0/O、1/l/I等易混淆字符
+)
+
+// 生成的密钥类型
+const (
+	CredentialKindPSK      = "psk"
+	CredentialKindPassword = "password"
+)
+
+// CredentialAuto 创建或修改服务器时PSK或用户密码填写该值表示由面板生成
+const CredentialAuto = "auto"
+
+// credentialClasses 各字符集包含的字符类别，生成的密钥每类至少包含一个字符。
+// 符号只选用在配置文件和命令行中无需转义的字符
+var credentialClasses = map[string][]string{
+	CredentialCharsetAlnum:        {"abcdefghijklmnopqrstuvwxyz", "ABCDEFGHIJKLMNOPQRSTUVWXYZ", "0123456789"},
+	CredentialCharsetAlnumSymbols: {"abcdefghijklmnopqrstuvwxyz", "ABCDEFGHIJKLMNOPQRSTUVWXYZ", "0123456789", "-_.+=@%"},
+	CredentialCharsetReadable:     {"abcdefghijkmnpqrstuvwxyz", "ABCDEFGHJKLMNPQRSTUVWXYZ", "23456789"},
+}
+
+// ErrUnknownCredentialKind 不支持的密钥类型
+var ErrUnknownCredentialKind = errors.New("密钥类型只能是psk或password")
+
+// GeneratedCredentials 生成的一组密钥及所用策略
+type GeneratedCredentials struct {
+	Kind    string   `json:"kind"`
+	Charset string   `json:"charset"`
+	Length  int      `json:"length"`
+	Values  []string `json:"values"`
+}
+
+// CredentialService 按设置中的长度和字符集生成PSK和L2TP用户密码，并检查手动填写的密钥长度
+type CredentialService struct {
+	settings *SettingsService
+}
+
+// NewCredentialService 创建密钥生成服务并注册其设置项
+func NewCredentialService(settings *SettingsService) *CredentialService {
+	settings.Register(SettingDef{Key: SettingCredentialPSKLength, Type: SettingTypeInt, Default: "24", Min: 8, Max: 128, Description: "生成的PSK长度"})
+	settings.Register(SettingDef{Key: SettingCredentialPasswordLength, Type: SettingTypeInt, Default: "16", Min: 8, Max: 128, Description: "生成的用户密码长度"})
+	settings.Register(SettingDef{Key: SettingCredentialCharset, Type: SettingTypeString, Default: CredentialCharsetAlnum, Description: "生成密钥使用的字符集: alnum(字母和数字)/alnum_symbols(字母、数字和符号)/readable(去除易混淆字符)"})
+	settings.Register(SettingDef{Key: SettingCredentialMinLength, Type: SettingTypeInt, Default: "0", Max: 128, Description: "手动填写的PSK和用户密码的最小长度，0表示不限制"})
+	return &CredentialService{settings: settings}
+}
+
+// charset 当前使用的字符集，设置值无效时使用alnum
+func (s *CredentialService) charset() string {
+	charset := s.settings.Get(SettingCredentialCharset)
+	if _, ok := credentialClasses[charset]; !ok {
+		return CredentialCharsetAlnum
+	}
+	return charset
+}
+
+// Generate 生成count个指定类型的密钥
+func (s *CredentialService) Generate(kind string, count int) (*GeneratedCredentials, error) {
+	var length int
+	switch kind {
+	case CredentialKindPSK:
+		length = s.settings.Int(SettingCredentialPSKLength)
+	case CredentialKindPassword:
+		length = s.settings.Int(SettingCredentialPasswordLength)
+	default:
+		return nil, ErrUnknownCredentialKind
+	}
+	result := &GeneratedCredentials{Kind: kind, Charset: s.charset(), Length: length, Values: make([]string, 0, count)}
+	for i := 0; i < count; i++ {
+		value, err := generateSecret(result.Charset, length)
+		if err != nil {
+			return nil, err
+		}
+		result.Values = append(result.Values, value)
+	}
+	return result, nil
+}
+
+// GeneratePSK 按设置生成一个PSK
+func (s *CredentialService) GeneratePSK() (string, error) {
+	return generateSecret(s.charset(), s.settings.Int(SettingCredentialPSKLength))
+}
+
+// GeneratePassword 按设置生成一个用户密码
+func (s *CredentialService) GeneratePassword() (string, error) {
+	return generateSecret(s.charset(), s.settings.Int(SettingCredentialPasswordLength))
+}
+
+// fill 生成填写为auto的PSK和用户密码，并检查新填写的密钥不短于最小长度。
+// existing为修改前的服务器，未变化的PSK和用户密码不检查，以免设置最小长度后无法修改服务器的其他字段
+func (s *CredentialService) fill(server, existing *database.L2TPServer) error {
+	if s == nil {
+		return nil
+	}
+	minLength := s.settings.Int(SettingCredentialMinLength)
+
+	if server.PSK == CredentialAuto {
+		psk, err := s.GeneratePSK()
+		if err != nil {
+			return err
+		}
+		server.PSK = psk
+	} else if server.PSK != "" && len(server.PSK) < minLength && (existing == nil || server.PSK != existing.PSK) {
+		return fmt.Errorf("PSK长度不能少于%d个字符", minLength)
+	}
+
+	if strings.TrimSpace(server.Users) == "" {
+		return nil
+	}
+	// 按通用结构解析，保留用户配置中的其他字段
+	var users []map[string]interface{}
+	if err := json.Unmarshal([]byte(server.Users), &users); err != nil {
+		return fmt.Errorf("用户配置格式错误: %v", err)
+	}
+	previous := make(map[string]string)
+	if existing != nil && existing.Users != "" {
+		var old []L2TPUser
+		if json.Unmarshal([]byte(existing.Users), &old) == nil {
+			for _, user := range old {
+				previous[user.Username] = user.Password
+			}
+		}
+	}
+
+	generated := false
+	for _, user := range users {
+		password, _ := user["password"].(string)
+		username, _ := user["username"].(string)
+		if password == CredentialAuto {
+			value, err := s.GeneratePassword()
+			if err != nil {
+				return err
+			}
+			user["password"] = value
+			generated = true
+			continue
+		}
+		if password != "" && len(password) < minLength && previous[username] != password {
+			return fmt.Errorf("用户 %s 的密码长度不能少于%d个字符", username, minLength)
+		}
+	}
+	if generated {
+		data, err := json.Marshal(users)
+		if err != nil {
+			return err
+		}
+		server.Users = string(data)
+	}
+	return nil
+}
+
+// generateSecret 使用crypto/rand生成随机密钥，长度不小于字符类别数时每类字符至少出现一次
+func generateSecret(charset string, length int) (string, error) {
+	classes, ok := credentialClasses[charset]
+	if !ok {
+		classes = credentialClasses[CredentialCharsetAlnum]
+	}
+	alphabet := strings.Join(classes, "")
+	max := big.NewInt(int64(len(alphabet)))
+	buf := make([]byte, length)
+	for {
+		for i := range buf {
+			n, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return "", err
+			}
+			buf[i] = alphabet[n.Int64()]
+		}
+		// 缺少某类字符时重新生成，不逐位替换以保持均匀分布
+		if length < len(classes) || coversClasses(string(buf), classes) {
+			return string(buf), nil
+		}
+	}
+}
+
+// coversClasses 密钥是否包含每类字符
+func coversClasses(secret string, classes []string) bool {
+	for _, class := range classes {
+		if !strings.ContainsAny(secret, class) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSchedule 解析后的五段式cron表达式(分 时 日 月 周)
+type CronSchedule struct {
+	minutes  map[int]bool
+	hours    map[int]bool
+	days     map[int]bool
+	months   map[int]bool
+	weekdays map[int]bool
+	// 日和周字段同时受限时按标准cron语义取并集
+	dayRestricted     bool
+	weekdayRestricted bool
+}
+
+// ParseCron 解析cron表达式，支持 * 、数字、范围(a-b)、列表(a,b)和步长(*/n, a-b/n)
+func ParseCron(expr string) (*CronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron表达式必须包含5个字段(分 时 日 月 周): %q", expr)
+	}
+
+	var err error
+	schedule := &CronSchedule{}
+	if schedule.minutes, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("分钟字段错误: %v", err)
+	}
+	if schedule.hours, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("小时字段错误: %v", err)
+	}
+	if schedule.days, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("日期字段错误: %v", err)
+	}
+	if schedule.months, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("月份字段错误: %v", err)
+	}
+	if schedule.weekdays, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("星期字段错误: %v", err)
+	}
+	// 0和7都表示周日
+	if schedule.weekdays[7] {
+		schedule.weekdays[0] = true
+	}
+	// 与标准cron一致，以*开头的字段(包括*/2这类步长)视为不受限
+	schedule.dayRestricted = !strings.HasPrefix(fields[2], "*")
+	schedule.weekdayRestricted = !strings.HasPrefix(fields[4], "*")
+
+	return schedule, nil
+}
+
+// parseCronField 解析单个cron字段
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	values := make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			n, err := strconv.Atoi(part[idx+1:])
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("无效的步长 %q", part)
+			}
+			step = n
+			part = part[:idx]
+		}
+
+		start, end := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if start, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("无效的值 %q", part)
+			}
+			end = start
+			if len(bounds) == 2 {
+				if end, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("无效的范围 %q", part)
+				}
+			} else if step > 1 {
+				end = max
+			}
+		}
+
+		if start < min || end > max || start > end {
+			return nil, fmt.Errorf("取值超出范围 %d-%d: %q", min, max, part)
+		}
+		for v := start; v <= end; v += step {
+			values[v] = true
+		}
+	}
+	return values, nil
+}
+
+// Matches 判断给定时间(精确到分钟)是否匹配计划
+func (c *CronSchedule) Matches(t time.Time) bool {
+	if !c.minutes[t.Minute()] || !c.hours[t.Hour()] || !c.months[int(t.Month())] {
+		return false
+	}
+
+	dayMatch := c.days[t.Day()]
+	weekdayMatch := c.weekdays[int(t.Weekday())]
+	if c.dayRestricted && c.weekdayRestricted {
+		return dayMatch || weekdayMatch
+	}
+	return dayMatch && weekdayMatch
+}
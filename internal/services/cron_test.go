@@ -0,0 +1,79 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"a * * * *",
+		"1-b * * * *",
+		"1,,2 * * * *",
+	} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) 应返回错误", expr)
+		}
+	}
+}
+
+func TestCronScheduleMatches(t *testing.T) {
+	// 2024-06-03 是周一
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2024, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		time time.Time
+		want bool
+	}{
+		{"每分钟", "* * * * *", at(6, 3, 13, 37), true},
+		{"固定时刻", "30 4 * * *", at(6, 3, 4, 30), true},
+		{"固定时刻之外", "30 4 * * *", at(6, 3, 4, 31), false},
+		{"列表", "0 1,13 * * *", at(6, 3, 13, 0), true},
+		{"范围", "0 9-17 * * *", at(6, 3, 18, 0), false},
+		{"步长", "*/15 * * * *", at(6, 3, 8, 45), true},
+		{"步长之外", "*/15 * * * *", at(6, 3, 8, 50), false},
+		{"范围加步长", "10-40/10 * * * *", at(6, 3, 8, 30), true},
+		{"范围加步长之外", "10-40/10 * * * *", at(6, 3, 8, 50), false},
+		{"起点加步长直到最大值", "5/20 * * * *", at(6, 3, 8, 45), true},
+		{"月份", "0 0 1 1 *", at(6, 1, 0, 0), false},
+		{"星期", "0 3 * * 1", at(6, 3, 3, 0), true},
+		{"星期之外", "0 3 * * 2", at(6, 3, 3, 0), false},
+		{"7表示周日", "0 3 * * 7", at(6, 2, 3, 0), true},
+		{"0表示周日", "0 3 * * 0", at(6, 2, 3, 0), true},
+		{"日和周同时受限时取并集(日匹配)", "0 3 15 * 5", at(6, 15, 3, 0), true},
+		{"日和周同时受限时取并集(周匹配)", "0 3 15 * 1", at(6, 3, 3, 0), true},
+		{"日字段为步长时与周取交集", "0 0 */2 * 1", at(6, 3, 0, 0), true},
+		{"日字段为步长时与周取交集(周不匹配)", "0 0 */2 * 1", at(6, 5, 0, 0), false},
+		{"日字段为步长时与周取交集(日不匹配)", "0 0 */2 * 1", at(6, 10, 0, 0), false},
+		{"周字段为步长时与日取交集", "0 0 15 * */2", at(6, 16, 0, 0), false},
+		{"日和周同时受限时都不匹配", "0 3 15 * 5", at(6, 3, 3, 0), false},
+		{"只限制日期时周字段不参与", "0 3 15 * *", at(6, 3, 3, 0), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseCron(%q) 失败: %v", tt.expr, err)
+			}
+			if got := schedule.Matches(tt.time); got != tt.want {
+				t.Fatalf("%q 匹配 %s = %v, 期望 %v", tt.expr, tt.time.Format(time.RFC3339), got, tt.want)
+			}
+		})
+	}
+}
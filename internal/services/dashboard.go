@@ -0,0 +1,172 @@
+package services
+
+import (
+	"time"
+
+	"l2tp-manager/internal/database"
+
+	"gorm.io/gorm"
+)
+
+// 仪表盘参数
+const (
+	dashboardExpiringDays  = 7               // 即将到期列表的天数范围
+	dashboardTopServers    = 5               // 流量排行的服务器数
+	dashboardRecentEvents  = 10              // 最近事件条数
+	dashboardClientsWindow = 5 * time.Minute // 在此时间内出现过的客户端视为活跃
+)
+
+// DashboardServerCounts 各状态的服务器数量
+type DashboardServerCounts struct {
+	Total   int `json:"total"`
+	Running int `json:"running"`
+	Stopped int `json:"stopped"`
+	Error   int `json:"error"`
+	Other   int `json:"other"` // starting/stopping等过渡状态
+}
+
+// DashboardExpiring 即将到期的服务器
+type DashboardExpiring struct {
+	ID         uint      `json:"id"`
+	Name       string    `json:"name"`
+	Status     string    `json:"status"`
+	ExpireDate time.Time `json:"expire_date"`
+	DaysLeft   int       `json:"days_left"`
+}
+
+// DashboardTraffic 流量汇总
+type DashboardTraffic struct {
+	Today       int64 `json:"today"`
+	MonthToDate int64 `json:"month_to_date"` // 各服务器本计费周期至今的流量合计，未设置起始日的服务器为自然月
+}
+
+// DashboardSummary 仪表盘首页所需的全部数据
+type DashboardSummary struct {
+	Servers       DashboardServerCounts `json:"servers"`
+	ExpiringSoon  []DashboardExpiring   `json:"expiring_soon"`
+	Traffic       DashboardTraffic      `json:"traffic"`
+	TopServers    []TrafficReportRow    `json:"top_servers"` // 本计费周期流量前5的服务器
+	Uptime        []UptimeWindow        `json:"uptime"`      // 全部服务器合计的24小时/7天/30天可用率
+	ActiveClients int                   `json:"active_clients"`
+	RecentEvents  []database.AuditLog   `json:"recent_events"`
+	GeneratedAt   time.Time             `json:"generated_at"`
+}
+
+// DashboardService 汇总仪表盘数据
+type DashboardService struct {
+	db             *gorm.DB
+	routingService *RoutingService
+	auditService   *AuditService
+}
+
+// NewDashboardService 创建仪表盘服务
+func NewDashboardService(db *gorm.DB, routingService *RoutingService, auditService *AuditService) *DashboardService {
+	return &DashboardService{db: db, routingService: routingService, auditService: auditService}
+}
+
+// Summary 一次查询仪表盘所需的全部数据，tenantID大于0时只统计该租户的服务器
+func (d *DashboardService) Summary(tenantID uint) (*DashboardSummary, error) {
+	now := time.Now()
+	summary := &DashboardSummary{GeneratedAt: now}
+
+	var counts []struct {
+		Status string
+		Count  int
+	}
+	if err := d.db.Model(&database.L2TPServer{}).Scopes(TenantServers(tenantID)).Select("status, COUNT(*) AS count").Group("status").Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	for _, c := range counts {
+		summary.Servers.Total += c.Count
+		switch c.Status {
+		case "running":
+			summary.Servers.Running += c.Count
+		case "stopped":
+			summary.Servers.Stopped += c.Count
+		case "error":
+			summary.Servers.Error += c.Count
+		default:
+			summary.Servers.Other += c.Count
+		}
+	}
+
+	var expiring []database.L2TPServer
+	err := d.db.Scopes(TenantServers(tenantID)).Where("expire_date > ? AND expire_date <= ?", now, now.AddDate(0, 0, dashboardExpiringDays)).
+		Order("expire_date").Find(&expiring).Error
+	if err != nil {
+		return nil, err
+	}
+	summary.ExpiringSoon = make([]DashboardExpiring, 0, len(expiring))
+	for _, server := range expiring {
+		summary.ExpiringSoon = append(summary.ExpiringSoon, DashboardExpiring{
+			ID:         server.ID,
+			Name:       server.Name,
+			Status:     server.Status,
+			ExpireDate: server.ExpireDate,
+			DaysLeft:   int(server.ExpireDate.Sub(now).Hours()/24) + 1,
+		})
+	}
+
+	today := bucketStart(now, GranularityDay)
+	tomorrow := today.AddDate(0, 0, 1)
+	if summary.Traffic.Today, err = d.trafficTotal(tenantID, today, tomorrow); err != nil {
+		return nil, err
+	}
+	// 本期至今的流量按各服务器自己的计费周期统计，含已删除的服务器
+	var billing []database.L2TPServer
+	if err := billingServers(d.db).Scopes(TenantServers(tenantID)).Find(&billing).Error; err != nil {
+		return nil, err
+	}
+	rows, err := sumPeriodTraffic(d.db, billing, "", now)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		summary.Traffic.MonthToDate += row.Bytes
+	}
+	summary.TopServers = rows[:min(len(rows), dashboardTopServers)]
+
+	if summary.Uptime, err = fleetUptime(d.db, tenantID, now); err != nil {
+		return nil, err
+	}
+
+	if tenantID == 0 {
+		summary.ActiveClients = d.routingService.ActiveClientCount(now.Add(-dashboardClientsWindow))
+		if summary.RecentEvents, err = d.auditService.List(0, "", dashboardRecentEvents); err != nil {
+			return nil, err
+		}
+		return summary, nil
+	}
+
+	// 租户只统计自己服务器监听端口上的客户端和服务器相关的审计日志
+	var servers []database.L2TPServer
+	if err := d.db.Scopes(TenantServers(tenantID)).Find(&servers).Error; err != nil {
+		return nil, err
+	}
+	var ports []int
+	for i := range servers {
+		for _, rule := range ForwardRules(&servers[i]) {
+			ports = append(ports, rule.ListenPort)
+		}
+	}
+	if len(ports) > 0 {
+		summary.ActiveClients = d.routingService.ActiveClientCount(now.Add(-dashboardClientsWindow), ports...)
+	}
+	summary.RecentEvents = []database.AuditLog{}
+	err = d.db.Scopes(tenantServerIDs("server_id", tenantID)).
+		Order("created_at DESC").Limit(dashboardRecentEvents).Find(&summary.RecentEvents).Error
+	if err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// trafficTotal 统计[since, until)内全部(或租户的)服务器的流量(按天样本)
+func (d *DashboardService) trafficTotal(tenantID uint, since, until time.Time) (int64, error) {
+	var total int64
+	err := d.db.Model(&database.TrafficSample{}).Scopes(tenantServerIDs("server_id", tenantID)).
+		Select("COALESCE(SUM(bytes), 0)").
+		Where("granularity = ? AND bucket >= ? AND bucket < ?", GranularityDay, since, until).
+		Scan(&total).Error
+	return total, err
+}
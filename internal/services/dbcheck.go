@@ -0,0 +1,241 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+
+	"l2tp-manager/internal/database"
+
+	"gorm.io/gorm"
+)
+
+// 数据库检查发现的问题类型，关联服务器的表中的孤立记录为 orphan_<表名>，如orphan_traffic_logs
+const (
+	IssueDuplicatePorts      = "duplicate_ports"       // 多个服务器使用同一中转端口
+	IssueInvalidDesiredState = "invalid_desired_state" // 期望状态不是running/stopped
+)
+
+// orphanTables 可能产生孤立行的表(即关联服务器的表)，按问题类型索引
+var orphanTables = func() map[string]serverTable {
+	tables := make(map[string]serverTable, len(serverTables))
+	for _, table := range serverTables {
+		tables["orphan_"+table.table] = table
+	}
+	return tables
+}()
+
+// DBIssue 数据库检查发现的问题
+type DBIssue struct {
+	Code        string   `json:"code"`
+	Description string   `json:"description"`
+	Count       int64    `json:"count"`
+	Details     []string `json:"details,omitempty"`
+	Repair      string   `json:"repair"` // 修复操作说明
+}
+
+// DBCheckReport 数据库检查报告
+type DBCheckReport struct {
+	Integrity []string  `json:"integrity"` // PRAGMA integrity_check结果，正常时为["ok"]
+	Healthy   bool      `json:"healthy"`
+	Issues    []DBIssue `json:"issues"`
+}
+
+// portConflict 中转端口冲突
+type portConflict struct {
+	serverID uint   // 需要调整的服务器
+	protocol string // 需要调整服务器上占用该端口的协议
+	detail   string
+}
+
+// checkIntegrity 执行SQLite完整性检查，Postgres由数据库自身保证，不做检查
+func (s *L2TPService) checkIntegrity(report *DBCheckReport) error {
+	if !database.IsSQLite(s.db) {
+		report.Integrity = []string{"ok"}
+		return nil
+	}
+
+	rows, err := s.db.Raw("PRAGMA integrity_check").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var message string
+		if err := rows.Scan(&message); err != nil {
+			return err
+		}
+		report.Integrity = append(report.Integrity, message)
+	}
+	return nil
+}
+
+// CheckDatabase 检查数据库完整性和数据一致性
+func (s *L2TPService) CheckDatabase() (*DBCheckReport, error) {
+	report := &DBCheckReport{Issues: []DBIssue{}}
+
+	if err := s.checkIntegrity(report); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, len(orphanTables))
+	for code := range orphanTables {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		var count int64
+		if err := s.db.Table(orphanTables[code].table).Where(orphanTables[code].orphanCondition()).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			report.Issues = append(report.Issues, DBIssue{
+				Code:        code,
+				Description: fmt.Sprintf("%s 中有关联服务器已不存在的记录", orphanTables[code].table),
+				Count:       count,
+				Repair:      "删除孤立记录",
+			})
+		}
+	}
+
+	conflicts, err := findPortConflicts(s.db)
+	if err != nil {
+		return nil, err
+	}
+	if len(conflicts) > 0 {
+		issue := DBIssue{
+			Code:        IssueDuplicatePorts,
+			Description: "多个服务器使用了相同的中转端口",
+			Count:       int64(len(conflicts)),
+			Repair:      "关闭占用冲突端口的附加协议(L2TP端口优先保留)",
+		}
+		for _, conflict := range conflicts {
+			issue.Details = append(issue.Details, conflict.detail)
+		}
+		report.Issues = append(report.Issues, issue)
+	}
+
+	var invalid int64
+	if err := s.invalidDesiredStateQuery(s.db).Count(&invalid).Error; err != nil {
+		return nil, err
+	}
+	if invalid > 0 {
+		report.Issues = append(report.Issues, DBIssue{
+			Code:        IssueInvalidDesiredState,
+			Description: "服务器的期望状态无效",
+			Count:       invalid,
+			Repair:      "按当前运行状态重置期望状态",
+		})
+	}
+
+	report.Healthy = len(report.Integrity) == 1 && report.Integrity[0] == "ok" && len(report.Issues) == 0
+	return report, nil
+}
+
+// RepairDatabase 在事务内修复指定类型的问题，codes为空时修复全部，返回各类问题修复的行数
+func (s *L2TPService) RepairDatabase(codes []string) (map[string]int64, error) {
+	selected := make(map[string]bool)
+	for _, code := range codes {
+		if _, ok := orphanTables[code]; !ok && code != IssueDuplicatePorts && code != IssueInvalidDesiredState {
+			return nil, fmt.Errorf("未知的问题类型: %s", code)
+		}
+		selected[code] = true
+	}
+	want := func(code string) bool { return len(selected) == 0 || selected[code] }
+
+	fixed := make(map[string]int64)
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for code, table := range orphanTables {
+			if !want(code) {
+				continue
+			}
+			result := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s", table.table, table.orphanCondition()))
+			if result.Error != nil {
+				return result.Error
+			}
+			fixed[code] = result.RowsAffected
+		}
+
+		if want(IssueDuplicatePorts) {
+			conflicts, err := findPortConflicts(tx)
+			if err != nil {
+				return err
+			}
+			for _, conflict := range conflicts {
+				column := map[string]string{ProtocolOpenVPN: "enable_openvpn", ProtocolSSTP: "enable_sstp"}[conflict.protocol]
+				if column == "" {
+					continue
+				}
+				result := tx.Unscoped().Model(&database.L2TPServer{}).Where("id = ?", conflict.serverID).Update(column, false)
+				if result.Error != nil {
+					return result.Error
+				}
+				fixed[IssueDuplicatePorts] += result.RowsAffected
+			}
+		}
+
+		if want(IssueInvalidDesiredState) {
+			result := s.invalidDesiredStateQuery(tx).
+				Update("desired_state", gorm.Expr("CASE WHEN status IN ('running', 'starting') THEN 'running' ELSE 'stopped' END"))
+			if result.Error != nil {
+				return result.Error
+			}
+			fixed[IssueInvalidDesiredState] = result.RowsAffected
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fixed, nil
+}
+
+// orphanCondition 关联服务器已不存在(包括回收站)的记录的查询条件
+func (t serverTable) orphanCondition() string {
+	condition := t.column + " NOT IN (SELECT id FROM l2_tp_servers)"
+	if t.optional {
+		condition += " AND " + t.column + " != 0"
+	}
+	return condition
+}
+
+// invalidDesiredStateQuery 查询期望状态无效的服务器
+func (s *L2TPService) invalidDesiredStateQuery(tx *gorm.DB) *gorm.DB {
+	return tx.Unscoped().Model(&database.L2TPServer{}).
+		Where("desired_state IS NULL OR desired_state NOT IN ('running', 'stopped')")
+}
+
+// findPortConflicts 查找服务器之间的中转端口冲突(包括回收站中的服务器)
+func findPortConflicts(tx *gorm.DB) ([]portConflict, error) {
+	var servers []database.L2TPServer
+	if err := tx.Unscoped().Order("id").Find(&servers).Error; err != nil {
+		return nil, err
+	}
+
+	type owner struct {
+		id       uint
+		name     string
+		protocol string
+	}
+	owners := make(map[int]owner)
+	var conflicts []portConflict
+	for i := range servers {
+		server := &servers[i]
+		for _, rule := range ForwardRules(server) {
+			first, exists := owners[rule.ListenPort]
+			if !exists {
+				owners[rule.ListenPort] = owner{id: server.ID, name: server.Name, protocol: rule.Protocol}
+				continue
+			}
+
+			// l2tp_port有唯一约束且无法关闭，冲突时调整占用该端口的附加协议
+			conflict := portConflict{serverID: server.ID, protocol: rule.Protocol}
+			if rule.ListenPort == server.L2TPPort {
+				conflict.serverID, conflict.protocol = first.id, first.protocol
+			}
+			conflict.detail = fmt.Sprintf("端口 %d: 服务器 \"%s\"(%s) 与 \"%s\"(%s)",
+				rule.ListenPort, first.name, first.protocol, server.Name, rule.Protocol)
+			conflicts = append(conflicts, conflict)
+		}
+	}
+	return conflicts, nil
+}
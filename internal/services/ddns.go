@@ -0,0 +1,266 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"l2tp-manager/internal/database"
+
+	"gorm.io/gorm"
+)
+
+// DDNS参数
+const (
+	ddnsTokenPrefix     = "ddns_"
+	ddnsRefreshInterval = time.Minute     // 落地机域名的重新解析间隔
+	ddnsLookupTimeout   = 5 * time.Second // 单次解析超时
+)
+
+// ErrDDNSToken 上报令牌缺失或无效
+var ErrDDNSToken = errors.New("上报令牌无效")
+
+// hostResolution 落地机域名的解析结果
+type hostResolution struct {
+	IP        string
+	CheckedAt time.Time
+	Error     string
+}
+
+// hostResolver 落地机域名解析缓存，解析失败时保留上一次的地址
+type hostResolver struct {
+	hosts map[string]hostResolution
+	mutex sync.Mutex
+}
+
+// DDNSStatus 服务器转发目标的动态地址状态
+type DDNSStatus struct {
+	Host       string     `json:"host"`
+	Dynamic    bool       `json:"dynamic"`               // host为域名，定期重新解析
+	ResolvedIP string     `json:"resolved_ip,omitempty"` // 域名的最近解析结果
+	CheckedAt  *time.Time `json:"checked_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	ReportedIP string     `json:"reported_ip,omitempty"` // 落地机上报的IP，优先于解析结果
+	ReportedAt *time.Time `json:"reported_at,omitempty"`
+	TokenSet   bool       `json:"token_set"` // 已生成上报令牌
+	Target     string     `json:"target"`    // 转发到落地机使用的地址
+}
+
+// dynamicHost 落地机地址为域名
+func dynamicHost(host string) bool {
+	return host != "" && net.ParseIP(host) == nil
+}
+
+// resolvesExit 服务器的转发目标是落地机(而不是链式转发的下一跳)，且由本机转发
+func resolvesExit(server *database.L2TPServer) bool {
+	return server.RelayNodeID == 0 && server.ChainNodes == "" && server.NextHop == ""
+}
+
+// lookup 解析域名，缓存未过期时直接返回。多个地址中包含上一次的地址时保持不变，避免轮询DNS导致反复重建转发器
+func (h *hostResolver) lookup(ctx context.Context, host string) hostResolution {
+	h.mutex.Lock()
+	cached, ok := h.hosts[host]
+	h.mutex.Unlock()
+	if ok && time.Since(cached.CheckedAt) < ddnsRefreshInterval {
+		return cached
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ddnsLookupTimeout)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
+	if err != nil || len(ips) == 0 {
+		ips, err = net.DefaultResolver.LookupIP(ctx, "ip", host)
+	}
+
+	result := hostResolution{IP: cached.IP, CheckedAt: time.Now()}
+	if err != nil || len(ips) == 0 {
+		if err == nil {
+			err = fmt.Errorf("没有解析到地址")
+		}
+		result.Error = err.Error()
+		slog.Warn("解析落地机域名失败，沿用上一次的地址", "host", host, "ip", cached.IP, "error", err)
+	} else {
+		result.IP = ips[0].String()
+		for _, ip := range ips {
+			if ip.String() == cached.IP {
+				result.IP = cached.IP
+				break
+			}
+		}
+	}
+
+	h.mutex.Lock()
+	h.hosts[host] = result
+	h.mutex.Unlock()
+	return result
+}
+
+// cached 读取缓存的解析结果，不发起解析
+func (h *hostResolver) cached(host string) (hostResolution, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	result, ok := h.hosts[host]
+	return result, ok
+}
+
+// prefetchHost 在加锁之前解析服务器的落地机域名，避免持有服务器锁时等待DNS
+func (r *RoutingService) prefetchHost(server *database.L2TPServer) {
+	if server.ReportedIP == "" && dynamicHost(server.Host) {
+		r.resolver.lookup(r.ctx, server.Host)
+	}
+}
+
+// resolveExit 设置服务器转发目标的实际IP：上报的IP优先，其次为域名的解析结果
+func (r *RoutingService) resolveExit(server *database.L2TPServer) {
+	server.ResolvedIP = ""
+	if !resolvesExit(server) {
+		return
+	}
+	if server.ReportedIP != "" {
+		server.ResolvedIP = server.ReportedIP
+		return
+	}
+	if dynamicHost(server.Host) {
+		if result, ok := r.resolver.cached(server.Host); ok {
+			server.ResolvedIP = result.IP
+		}
+	}
+}
+
+// refreshExitAddresses 重新解析落地机域名，地址变化后重建转发器
+func (r *RoutingService) refreshExitAddresses() {
+	r.serverMutex.RLock()
+	hosts := make(map[string]bool)
+	for _, server := range r.servers {
+		if server.Status == "running" && resolvesExit(server) && server.ReportedIP == "" && dynamicHost(server.Host) {
+			hosts[server.Host] = true
+		}
+	}
+	r.serverMutex.RUnlock()
+	if len(hosts) == 0 {
+		return
+	}
+	for host := range hosts {
+		r.resolver.lookup(r.ctx, host)
+	}
+
+	r.serverMutex.Lock()
+	defer r.serverMutex.Unlock()
+	for _, server := range r.servers {
+		if !hosts[server.Host] {
+			continue
+		}
+		previous := server.ResolvedIP
+		r.resolveExit(server)
+		if server.ResolvedIP == previous || server.Status != "running" {
+			continue
+		}
+		slog.Info("落地机地址已变化，重建转发器", "server", server.Name, "host", server.Host, "previous", previous, "ip", server.ResolvedIP)
+		r.stopServerForwarders(server, false)
+		if err := r.startServerForwarders(server); err != nil {
+			slog.Error("重建转发器失败", "server_id", server.ID, "error", err)
+		}
+	}
+}
+
+// DDNSStatus 服务器转发目标的动态地址状态，域名未解析过时立即解析
+func (r *RoutingService) DDNSStatus(server *database.L2TPServer) DDNSStatus {
+	status := DDNSStatus{
+		Host:       server.Host,
+		Dynamic:    dynamicHost(server.Host),
+		ReportedIP: server.ReportedIP,
+		ReportedAt: server.ReportedAt,
+		TokenSet:   server.DDNSTokenHash != "",
+		Target:     server.Host,
+	}
+	if status.Dynamic {
+		result := r.resolver.lookup(r.ctx, server.Host)
+		status.ResolvedIP = result.IP
+		status.CheckedAt = &result.CheckedAt
+		status.Error = result.Error
+		if result.IP != "" {
+			status.Target = result.IP
+		}
+	}
+	if server.ReportedIP != "" {
+		status.Target = server.ReportedIP
+	}
+	return status
+}
+
+// hashDDNSToken 计算上报令牌的存储值
+func hashDDNSToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RotateDDNSToken 生成落地机上报IP的令牌，旧令牌立即失效。令牌只在此时返回一次
+func (s *L2TPService) RotateDDNSToken(id uint) (*database.L2TPServer, string, error) {
+	server, err := s.GetServer(id)
+	if err != nil {
+		return nil, "", err
+	}
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", fmt.Errorf("生成上报令牌失败: %v", err)
+	}
+	token := ddnsTokenPrefix + hex.EncodeToString(buf)
+	server.DDNSTokenHash = hashDDNSToken(token)
+	if err := s.db.Model(server).UpdateColumn("ddns_token_hash", server.DDNSTokenHash).Error; err != nil {
+		return nil, "", err
+	}
+	return server, token, nil
+}
+
+// DisableDDNS 撤销上报令牌并清除上报的IP，转发目标恢复为host
+func (s *L2TPService) DisableDDNS(id uint) (*database.L2TPServer, error) {
+	server, err := s.GetServer(id)
+	if err != nil {
+		return nil, err
+	}
+	server.DDNSTokenHash = ""
+	server.ReportedIP = ""
+	server.ReportedAt = nil
+	err = s.db.Model(server).UpdateColumns(map[string]interface{}{
+		"ddns_token_hash": "",
+		"reported_ip":     "",
+		"reported_at":     nil,
+	}).Error
+	return server, err
+}
+
+// ReportIP 落地机通过上报令牌报告当前IP，返回服务器和IP是否变化
+func (s *L2TPService) ReportIP(token, address string) (*database.L2TPServer, bool, error) {
+	if token == "" {
+		return nil, false, ErrDDNSToken
+	}
+	ip := net.ParseIP(address)
+	if ip == nil || ip.IsUnspecified() || ip.IsLoopback() || ip.IsMulticast() || ip.IsLinkLocalUnicast() {
+		return nil, false, fmt.Errorf("无效的IP地址 %q", address)
+	}
+
+	var server database.L2TPServer
+	if err := s.db.Where("ddns_token_hash = ?", hashDDNSToken(token)).First(&server).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, false, ErrDDNSToken
+		}
+		return nil, false, err
+	}
+
+	now := time.Now()
+	changed := server.ReportedIP != ip.String()
+	server.ReportedIP = ip.String()
+	server.ReportedAt = &now
+	err := s.db.Model(&server).UpdateColumns(map[string]interface{}{
+		"reported_ip": server.ReportedIP,
+		"reported_at": now,
+	}).Error
+	return &server, changed, err
+}
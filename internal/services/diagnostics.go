@@ -0,0 +1,127 @@
+package services
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"l2tp-manager/internal/database"
+)
+
+// SSHSession 一个已建立的SSH连接
+type SSHSession struct {
+	ServerID uint      `json:"server_id"`
+	Address  string    `json:"address"`
+	Since    time.Time `json:"since"`
+}
+
+// sshSessionRegistry 面板当前打开的SSH连接，用于排查连接泄漏
+type sshSessionRegistry struct {
+	sessions map[uint64]SSHSession
+	next     uint64
+	mutex    sync.Mutex
+}
+
+// sshSessions 全部SSHService共用的连接登记
+var sshSessions = &sshSessionRegistry{sessions: make(map[uint64]SSHSession)}
+
+// add 登记连接，返回用于移除的编号
+func (r *sshSessionRegistry) add(server *database.L2TPServer, address string) uint64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.next++
+	r.sessions[r.next] = SSHSession{ServerID: server.ID, Address: address, Since: time.Now()}
+	return r.next
+}
+
+// remove 连接关闭后移除
+func (r *sshSessionRegistry) remove(id uint64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.sessions, id)
+}
+
+// ActiveSSHSessions 当前打开的SSH连接，最早建立的在前
+func ActiveSSHSessions() []SSHSession {
+	sshSessions.mutex.Lock()
+	sessions := make([]SSHSession, 0, len(sshSessions.sessions))
+	for _, session := range sshSessions.sessions {
+		sessions = append(sessions, session)
+	}
+	sshSessions.mutex.Unlock()
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Since.Before(sessions[j].Since) })
+	return sessions
+}
+
+// ForwarderInfo 路由服务中一个转发规则的运行情况
+type ForwarderInfo struct {
+	ServerID   uint   `json:"server_id"`
+	ServerName string `json:"server_name"`
+	Status     string `json:"status"`
+	Protocol   string `json:"protocol"`
+	Network    string `json:"network"`
+	ListenPort int    `json:"listen_port"`
+	Target     string `json:"target"`        // 转发目标地址(落地机或下一跳中转节点)
+	Mode       string `json:"mode"`          // userspace/kernel，未运行时为空
+	RelayNode  uint   `json:"relay_node_id"` // 由中转节点转发时的节点ID，面板本机不运行转发器
+}
+
+// ProxyForwarderInfo 代理入站的运行情况
+type ProxyForwarderInfo struct {
+	ProxyID uint   `json:"proxy_id"`
+	Running bool   `json:"running"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Forwarders 已加载的服务器的转发规则及其转发器的运行情况，按监听端口排序
+func (r *RoutingService) Forwarders() []ForwarderInfo {
+	r.serverMutex.RLock()
+	defer r.serverMutex.RUnlock()
+
+	forwarders := []ForwarderInfo{}
+	for _, server := range r.servers {
+		for _, rule := range ForwardRules(server) {
+			host, port := forwardTarget(server, rule)
+			info := ForwarderInfo{
+				ServerID:   server.ID,
+				ServerName: server.Name,
+				Status:     server.Status,
+				Protocol:   rule.Protocol,
+				Network:    rule.Network,
+				ListenPort: rule.ListenPort,
+				Target:     net.JoinHostPort(host, strconv.Itoa(port)),
+				RelayNode:  server.RelayNodeID,
+			}
+			if _, ok := r.xrayInstances[rule.ListenPort]; ok {
+				info.Mode = ForwardModeUserspace
+			} else if _, ok := r.kernelPorts[rule.ListenPort]; ok {
+				info.Mode = ForwardModeKernel
+			}
+			forwarders = append(forwarders, info)
+		}
+	}
+	sort.Slice(forwarders, func(i, j int) bool { return forwarders[i].ListenPort < forwarders[j].ListenPort })
+	return forwarders
+}
+
+// ProxyForwarders 代理入站的运行情况，按代理ID排序
+func (r *RoutingService) ProxyForwarders() []ProxyForwarderInfo {
+	r.serverMutex.RLock()
+	defer r.serverMutex.RUnlock()
+
+	proxies := make([]ProxyForwarderInfo, 0, len(r.proxyRuntimes))
+	for id, state := range r.proxyRuntimes {
+		proxies = append(proxies, ProxyForwarderInfo{ProxyID: id, Running: state.instance != nil, Error: state.err})
+	}
+	sort.Slice(proxies, func(i, j int) bool { return proxies[i].ProxyID < proxies[j].ProxyID })
+	return proxies
+}
+
+// RunningOperations 正在后台执行的启动/停止/重启操作数
+func (s *L2TPService) RunningOperations() int {
+	s.operations.mutex.Lock()
+	defer s.operations.mutex.Unlock()
+	return s.operations.count
+}
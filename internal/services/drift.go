@@ -0,0 +1,466 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"l2tp-manager/internal/database"
+	"l2tp-manager/internal/metrics"
+
+	"gorm.io/gorm"
+)
+
+// driftCheckInterval 配置漂移检测间隔
+const driftCheckInterval = 15 * time.Minute
+
+// driftSensitiveEnv 比对结果中只显示摘要的环境变量
+var driftSensitiveEnv = map[string]bool{"PSK": true, "USERS": true}
+
+// DriftItem 落地机实际部署与面板配置不一致的项目
+type DriftItem struct {
+	Field    string `json:"field"`    // container/image/env.<名称>/port/file:<路径>/service
+	Expected string `json:"expected"` // 面板配置对应的值，密钥和文件显示SHA-256摘要
+	Actual   string `json:"actual"`   // 落地机上的实际值
+}
+
+// DriftReport 服务器的配置漂移检测结果
+type DriftReport struct {
+	ServerID   uint        `json:"server_id"`
+	ServerName string      `json:"server_name"`
+	Drifted    bool        `json:"drifted"`
+	Items      []DriftItem `json:"items"`
+	Error      string      `json:"error,omitempty"`
+	CheckedAt  time.Time   `json:"checked_at"`
+}
+
+// deploymentSpec 落地机上应有的部署：容器镜像、环境变量、端口映射和配置文件
+type deploymentSpec struct {
+	Container string // 容器名称，WireGuard为空
+	Image     string
+	Env       map[string]string
+	Ports     []string          // 宿主机端口:容器端口/协议
+	Files     map[string]string // 文件绝对路径 -> 内容的SHA-256
+}
+
+// deployedState 落地机上的实际部署
+type deployedState struct {
+	Exists  bool
+	Running bool
+	Image   string
+	Env     map[string]string
+	Ports   []string
+	Files   map[string]string // 不存在的文件不在其中
+}
+
+// containerInspect docker inspect输出中用到的字段
+type containerInspect struct {
+	Config struct {
+		Image string   `json:"Image"`
+		Env   []string `json:"Env"`
+	} `json:"Config"`
+	State struct {
+		Running bool `json:"Running"`
+	} `json:"State"`
+	HostConfig struct {
+		PortBindings map[string][]struct {
+			HostPort string `json:"HostPort"`
+		} `json:"PortBindings"`
+	} `json:"HostConfig"`
+}
+
+// sha256Hex 内容的SHA-256(十六进制)
+func sha256Hex(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// runCommandFlagsWithValue docker run中带参数的选项
+var runCommandFlagsWithValue = map[string]bool{
+	"--name": true, "--restart": true, "-p": true, "-e": true, "-v": true,
+	"--cap-add": true, "--device": true, "--sysctl": true,
+}
+
+// parseRunCommand 从面板生成的docker run命令中解析镜像、环境变量和端口映射，
+// 与启动容器使用同一条命令，避免比对规则与部署逻辑不一致
+func parseRunCommand(command string) (image string, env map[string]string, ports []string) {
+	env = make(map[string]string)
+	fields := strings.Fields(strings.ReplaceAll(command, "\\\n", " "))
+	for i := 2; i < len(fields); i++ {
+		field := fields[i]
+		if !strings.HasPrefix(field, "-") {
+			image = field
+			break
+		}
+		if !runCommandFlagsWithValue[field] || i+1 >= len(fields) {
+			continue
+		}
+		i++
+		switch field {
+		case "-e":
+			if key, value, ok := strings.Cut(fields[i], "="); ok {
+				env[key] = strings.Trim(value, `"`)
+			}
+		case "-p":
+			ports = append(ports, fields[i])
+		}
+	}
+	sort.Strings(ports)
+	return image, env, ports
+}
+
+// expectedDeployment 按面板配置生成落地机上应有的部署
+func expectedDeployment(server *database.L2TPServer) (*deploymentSpec, error) {
+	var users []L2TPUser
+	if server.Users != "" {
+		if err := json.Unmarshal([]byte(server.Users), &users); err != nil {
+			return nil, fmt.Errorf("解析用户配置失败: %v", err)
+		}
+	}
+
+	spec := &deploymentSpec{Files: make(map[string]string)}
+	if server.Type == ServerTypeWireGuard {
+		config, err := wireGuardServerConfig(server)
+		if err != nil {
+			return nil, err
+		}
+		spec.Files[wireGuardConfigPath] = sha256Hex(config)
+		return spec, nil
+	}
+
+	spec.Container = serverContainerName(server)
+	spec.Image, spec.Env, spec.Ports = parseRunCommand(NewSSHService().dockerRunCommand(server, spec.Container, users))
+	dir, files, err := serverConfigFiles(server, users)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		// CRL每次部署时重新签发，内容不固定，不参与比对
+		if strings.HasSuffix(file.name, ".crl") {
+			continue
+		}
+		spec.Files[path.Join(dir, file.name)] = sha256Hex(file.content)
+	}
+	return spec, nil
+}
+
+// InspectDeployment 读取落地机上容器(WireGuard为服务)的实际配置和配置文件摘要
+func (s *SSHService) InspectDeployment(server *database.L2TPServer, spec *deploymentSpec) (_ *deployedState, err error) {
+	defer func(start time.Time) { metrics.ObserveSSH("inspect", start, err) }(time.Now())
+
+	client, err := s.createSSHClient(server)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	state := &deployedState{Env: make(map[string]string), Files: make(map[string]string)}
+	if spec.Container == "" {
+		output, _ := s.executeCommand(client, fmt.Sprintf("systemctl is-active %s || true", wireGuardService))
+		state.Exists = true
+		state.Running = strings.TrimSpace(output) == "active"
+	} else {
+		output, err := s.executeCommand(client, fmt.Sprintf("docker inspect %s --format '{{json .}}' 2>/dev/null || true", spec.Container))
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(output) != "" {
+			var inspect containerInspect
+			if err := json.Unmarshal([]byte(output), &inspect); err != nil {
+				return nil, fmt.Errorf("解析容器信息失败: %v", err)
+			}
+			state.Exists = true
+			state.Running = inspect.State.Running
+			state.Image = inspect.Config.Image
+			for _, entry := range inspect.Config.Env {
+				if key, value, ok := strings.Cut(entry, "="); ok {
+					state.Env[key] = value
+				}
+			}
+			for containerPort, bindings := range inspect.HostConfig.PortBindings {
+				port, proto, _ := strings.Cut(containerPort, "/")
+				for _, binding := range bindings {
+					state.Ports = append(state.Ports, fmt.Sprintf("%s:%s/%s", binding.HostPort, port, proto))
+				}
+			}
+			sort.Strings(state.Ports)
+		}
+	}
+
+	if len(spec.Files) > 0 {
+		paths := make([]string, 0, len(spec.Files))
+		for name := range spec.Files {
+			paths = append(paths, name)
+		}
+		output, err := s.executeCommand(client, fmt.Sprintf("sha256sum %s 2>/dev/null || true", strings.Join(paths, " ")))
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(output, "\n") {
+			if sum, name, ok := strings.Cut(strings.TrimSpace(line), "  "); ok {
+				state.Files[name] = sum
+			}
+		}
+	}
+	return state, nil
+}
+
+// digest 比对结果中显示的摘要
+func digest(sum string) string {
+	if len(sum) > 12 {
+		return "sha256:" + sum[:12]
+	}
+	return sum
+}
+
+// compareDeployment 比对应有的部署和实际部署，返回不一致的项目
+func compareDeployment(spec *deploymentSpec, state *deployedState) []DriftItem {
+	items := []DriftItem{}
+	if !state.Exists {
+		return append(items, DriftItem{Field: "container", Expected: spec.Container, Actual: "不存在"})
+	}
+	if !state.Running {
+		field := "container"
+		if spec.Container == "" {
+			field = "service"
+		}
+		items = append(items, DriftItem{Field: field, Expected: "running", Actual: "stopped"})
+	}
+
+	if spec.Container != "" {
+		if state.Image != spec.Image {
+			items = append(items, DriftItem{Field: "image", Expected: spec.Image, Actual: state.Image})
+		}
+		keys := make([]string, 0, len(spec.Env))
+		for key := range spec.Env {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			expected := spec.Env[key]
+			actual, ok := state.Env[key]
+			if ok && actual == expected {
+				continue
+			}
+			if driftSensitiveEnv[key] {
+				expected = digest(sha256Hex(expected))
+				if ok {
+					actual = digest(sha256Hex(actual))
+				}
+			}
+			if !ok {
+				actual = "未设置"
+			}
+			items = append(items, DriftItem{Field: "env." + key, Expected: expected, Actual: actual})
+		}
+		if strings.Join(spec.Ports, ",") != strings.Join(state.Ports, ",") {
+			items = append(items, DriftItem{Field: "port", Expected: strings.Join(spec.Ports, ","), Actual: strings.Join(state.Ports, ",")})
+		}
+	}
+
+	names := make([]string, 0, len(spec.Files))
+	for name := range spec.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		actual, ok := state.Files[name]
+		if ok && actual == spec.Files[name] {
+			continue
+		}
+		if ok {
+			actual = digest(actual)
+		} else {
+			actual = "不存在"
+		}
+		items = append(items, DriftItem{Field: "file:" + name, Expected: digest(spec.Files[name]), Actual: actual})
+	}
+	return items
+}
+
+// DriftService 定期比对运行中服务器的落地机实际部署(镜像、环境变量、PSK、用户、端口和配置文件)与面板配置
+type DriftService struct {
+	db          *gorm.DB
+	l2tpService *L2TPService
+	mutex       sync.Mutex // 串行化同一时间的检测结果写入
+}
+
+// NewDriftService 创建配置漂移检测服务
+func NewDriftService(db *gorm.DB, l2tpService *L2TPService) *DriftService {
+	return &DriftService{db: db, l2tpService: l2tpService}
+}
+
+// Start 启动定期检测
+func (d *DriftService) Start(ctx context.Context) {
+	ticker := time.NewTicker(driftCheckInterval)
+	defer ticker.Stop()
+	slog.Info("配置漂移检测已启动", "interval", driftCheckInterval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.checkAll(ctx)
+		}
+	}
+}
+
+// checkAll 检测所有运行中的服务器
+func (d *DriftService) checkAll(ctx context.Context) {
+	var servers []database.L2TPServer
+	if err := d.db.WithContext(ctx).Where("status = ?", "running").Find(&servers).Error; err != nil {
+		slog.Error("加载运行中服务器失败", "error", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i := range servers {
+		wg.Add(1)
+		go func(server *database.L2TPServer) {
+			defer wg.Done()
+			d.check(ctx, server)
+		}(&servers[i])
+	}
+	wg.Wait()
+}
+
+// check 检测一台服务器并保存结果，新出现漂移时发送通知。ctx取消时中止检测，结果不保存
+func (d *DriftService) check(ctx context.Context, server *database.L2TPServer) *DriftReport {
+	report := &DriftReport{ServerID: server.ID, ServerName: server.Name, Items: []DriftItem{}, CheckedAt: time.Now()}
+	spec, err := expectedDeployment(server)
+	if err == nil {
+		var state *deployedState
+		if state, err = d.l2tpService.SSH().WithContext(ctx).InspectDeployment(server, spec); err == nil {
+			report.Items = compareDeployment(spec, state)
+			report.Drifted = len(report.Items) > 0
+		}
+	}
+	if ctx.Err() != nil {
+		report.Error = ctx.Err().Error()
+		return report
+	}
+	if err != nil {
+		report.Error = err.Error()
+		slog.Warn("配置漂移检测失败", "server_id", server.ID, "error", err)
+	}
+
+	items, _ := json.Marshal(report.Items)
+	record := database.ServerDrift{
+		ServerID:  server.ID,
+		Drifted:   report.Drifted,
+		Items:     string(items),
+		Error:     report.Error,
+		CheckedAt: report.CheckedAt,
+	}
+
+	d.mutex.Lock()
+	var previous database.ServerDrift
+	d.db.Limit(1).Find(&previous, server.ID)
+	if err := d.db.Save(&record).Error; err != nil {
+		slog.Error("保存配置漂移检测结果失败", "server_id", server.ID, "error", err)
+	}
+	d.mutex.Unlock()
+
+	if report.Drifted && !previous.Drifted {
+		fields := make([]string, 0, len(report.Items))
+		for _, item := range report.Items {
+			fields = append(fields, item.Field)
+		}
+		d.l2tpService.publishData(EventServerDrifted, server.ID, server.Name,
+			fmt.Sprintf("服务器 \"%s\" 的落地机部署与面板配置不一致: %s", server.Name, strings.Join(fields, ", ")),
+			map[string]interface{}{"items": report.Items})
+	}
+	return report
+}
+
+// report 将保存的检测记录转换为检测结果
+func (d *DriftService) report(record *database.ServerDrift, name string) DriftReport {
+	report := DriftReport{
+		ServerID:   record.ServerID,
+		ServerName: name,
+		Drifted:    record.Drifted,
+		Items:      []DriftItem{},
+		Error:      record.Error,
+		CheckedAt:  record.CheckedAt,
+	}
+	if record.Items != "" {
+		json.Unmarshal([]byte(record.Items), &report.Items)
+	}
+	return report
+}
+
+// Get 服务器最近一次的检测结果，refresh为true时立即检测，请求断开时中止检测
+func (d *DriftService) Get(ctx context.Context, id uint, refresh bool) (*DriftReport, error) {
+	server, err := d.l2tpService.WithContext(ctx).GetServer(id)
+	if err != nil {
+		return nil, err
+	}
+	if refresh {
+		if server.Status != "running" {
+			return nil, fmt.Errorf("服务器未运行，无法检测配置漂移")
+		}
+		return d.check(ctx, server), nil
+	}
+
+	var record database.ServerDrift
+	if err := d.db.Limit(1).Find(&record, id).Error; err != nil {
+		return nil, err
+	}
+	if record.ServerID == 0 {
+		return nil, fmt.Errorf("尚未检测，请指定refresh=true立即检测")
+	}
+	report := d.report(&record, server.Name)
+	return &report, nil
+}
+
+// List 列出存在配置漂移的服务器，tenantID不为0时只列出该租户的
+func (d *DriftService) List(tenantID uint) ([]DriftReport, error) {
+	var servers []database.L2TPServer
+	if err := d.db.Scopes(TenantServers(tenantID)).Select("id", "name").Find(&servers).Error; err != nil {
+		return nil, err
+	}
+	names := make(map[uint]string, len(servers))
+	ids := make([]uint, 0, len(servers))
+	for _, server := range servers {
+		names[server.ID] = server.Name
+		ids = append(ids, server.ID)
+	}
+
+	var records []database.ServerDrift
+	if err := d.db.Where("drifted = ? AND server_id IN ?", true, ids).Order("server_id").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	reports := make([]DriftReport, 0, len(records))
+	for i := range records {
+		reports = append(reports, d.report(&records[i], names[records[i].ServerID]))
+	}
+	return reports, nil
+}
+
+// Reapply 按面板配置重新部署落地机(重启服务器)，清除检测结果，下次检测时重新比对
+func (d *DriftService) Reapply(ctx context.Context, id uint) (*database.L2TPServer, error) {
+	server, err := d.l2tpService.GetServer(id)
+	if err != nil {
+		return nil, err
+	}
+	if server.Status != "running" {
+		return nil, errors.New("服务器未运行，启动时会按面板配置部署")
+	}
+	if err := d.l2tpService.RestartServer(ctx, id); err != nil {
+		return nil, err
+	}
+	d.mutex.Lock()
+	d.db.Delete(&database.ServerDrift{}, id)
+	d.mutex.Unlock()
+	return server, nil
+}
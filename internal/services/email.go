@@ -0,0 +1,263 @@
+package services
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTP设置项
+const (
+	SettingSMTPHost     = "smtp_host"
+	SettingSMTPPort     = "smtp_port"
+	SettingSMTPSecurity = "smtp_security"
+	SettingSMTPUsername = "smtp_username"
+	SettingSMTPPassword = "smtp_password"
+	SettingSMTPFrom     = "smtp_from"
+	SettingSMTPTo       = "smtp_to"
+)
+
+// SMTP连接加密方式
+const (
+	SMTPSecurityStartTLS = "starttls"
+	SMTPSecurityTLS      = "tls"
+	SMTPSecurityNone     = "none"
+)
+
+// smtpTimeout 建立SMTP连接的超时时间
+const smtpTimeout = 15 * time.Second
+
+// EmailDefaultEvents 默认通过邮件发送的事件
+var EmailDefaultEvents = []string{
+	EventServerError,
+	EventServerExpiring,
+	EventServerExpired,
+	EventQuotaExceeded,
+	EventAccountSuspended,
+	EventTrafficReport,
+	EventResourceHigh,
+}
+
+// emailTemplate 邮件主题和正文模板
+type emailTemplate struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+// emailFuncs 邮件模板可用的函数
+var emailFuncs = template.FuncMap{
+	"title": EventTitle,
+	"bytes": FormatBytes,
+	"time": func(t interface{}) string {
+		if v, ok := t.(time.Time); ok {
+			return v.Format("2006-01-02 15:04")
+		}
+		return fmt.Sprint(t)
+	},
+}
+
+// emailLayout 邮件正文公共布局，content为各事件的正文片段
+const emailLayout = `<div style="font-family:sans-serif;font-size:14px;color:#333">
+<h3 style="margin:0 0 12px">{{title .Type}}</h3>
+{{template "content" .}}
+<p style="color:#999;font-size:12px;margin-top:24px">L2TP管理面板 · {{time .Time}}</p>
+</div>`
+
+// emailContents 各事件的正文片段，未列出的事件使用default
+var emailContents = map[string]string{
+	"default": `<p>{{.Message}}</p>
+{{if .ServerName}}<p>服务器: {{.ServerName}} (ID {{.ServerID}})</p>{{end}}`,
+
+	EventServerExpiring: `<p>服务器 <b>{{.ServerName}}</b> 将在 <b>{{index .Data "days_left"}}</b> 天后到期。</p>
+<p>到期时间: {{time (index .Data "expire_date")}}</p>
+<p>如需继续使用，请及时续期，到期后服务器将自动停止。</p>`,
+
+	EventServerExpired: `<p>服务器 <b>{{.ServerName}}</b> 已到期并停止服务。</p>
+<p>{{.Message}}</p>`,
+
+	EventServerError: `<p>服务器 <b>{{.ServerName}}</b> 运行异常，请登录面板查看日志。</p>
+<p>{{.Message}}</p>`,
+
+	EventTrafficReport: `<p>{{.Message}}</p>
+<table cellpadding="6" style="border-collapse:collapse;border:1px solid #ddd">
+<tr style="background:#f5f5f5"><th align="left">服务器</th><th align="right">流量</th></tr>
+{{range index .Data "servers"}}<tr><td style="border-top:1px solid #ddd">{{if .ServerName}}{{.ServerName}}{{else}}#{{.ServerID}}{{end}}</td><td align="right" style="border-top:1px solid #ddd">{{bytes .Bytes}}</td></tr>
+{{end}}<tr><td style="border-top:1px solid #ddd"><b>合计</b></td><td align="right" style="border-top:1px solid #ddd"><b>{{bytes (index .Data "total")}}</b></td></tr>
+</table>`,
+}
+
+// EmailService SMTP邮件通知渠道
+type EmailService struct {
+	settings  *SettingsService
+	templates map[string]*emailTemplate
+}
+
+// NewEmailService 创建邮件通知渠道并注册SMTP设置项
+func NewEmailService(settings *SettingsService) *EmailService {
+	settings.Register(SettingDef{Key: SettingSMTPHost, Type: SettingTypeString, Description: "SMTP服务器地址，为空表示关闭邮件通知"})
+	settings.Register(SettingDef{Key: SettingSMTPPort, Type: SettingTypeInt, Default: "587", Min: 1, Max: 65535, Description: "SMTP端口"})
+	settings.Register(SettingDef{Key: SettingSMTPSecurity, Type: SettingTypeString, Default: SMTPSecurityStartTLS, Description: "加密方式: starttls/tls/none"})
+	settings.Register(SettingDef{Key: SettingSMTPUsername, Type: SettingTypeString, Description: "SMTP用户名"})
+	settings.Register(SettingDef{Key: SettingSMTPPassword, Type: SettingTypeString, Secret: true, Description: "SMTP密码"})
+	settings.Register(SettingDef{Key: SettingSMTPFrom, Type: SettingTypeString, Description: "发件人地址"})
+	settings.Register(SettingDef{Key: SettingSMTPTo, Type: SettingTypeString, Description: "收件人地址，逗号分隔"})
+
+	e := &EmailService{settings: settings, templates: make(map[string]*emailTemplate)}
+	for eventType, content := range emailContents {
+		body := template.Must(template.New("layout").Funcs(emailFuncs).Parse(emailLayout))
+		template.Must(body.New("content").Parse(content))
+		e.templates[eventType] = &emailTemplate{
+			subject: template.Must(template.New("subject").Funcs(emailFuncs).Parse(`[L2TP] {{title .Type}}{{if .ServerName}}: {{.ServerName}}{{end}}`)),
+			body:    body,
+		}
+	}
+	return e
+}
+
+// Name 渠道名称
+func (e *EmailService) Name() string {
+	return "email"
+}
+
+// Send 渲染模板并发送给全部收件人
+func (e *EmailService) Send(event Event) error {
+	host := e.settings.Get(SettingSMTPHost)
+	recipients := splitList(e.settings.Get(SettingSMTPTo))
+	if host == "" || len(recipients) == 0 {
+		return ErrChannelNotConfigured
+	}
+
+	subject, body, err := e.Render(event)
+	if err != nil {
+		return err
+	}
+	return e.deliver(host, recipients, subject, body)
+}
+
+// Render 渲染事件的邮件主题和HTML正文
+func (e *EmailService) Render(event Event) (string, string, error) {
+	tmpl, ok := e.templates[event.Type]
+	if !ok {
+		tmpl = e.templates["default"]
+	}
+
+	var subject, body bytes.Buffer
+	if err := tmpl.subject.Execute(&subject, event); err != nil {
+		return "", "", fmt.Errorf("渲染邮件主题失败: %v", err)
+	}
+	if err := tmpl.body.Execute(&body, event); err != nil {
+		return "", "", fmt.Errorf("渲染邮件正文失败: %v", err)
+	}
+	return subject.String(), body.String(), nil
+}
+
+// deliver 连接SMTP服务器发送邮件
+func (e *EmailService) deliver(host string, recipients []string, subject, body string) error {
+	from, err := mail.ParseAddress(e.settings.Get(SettingSMTPFrom))
+	if err != nil {
+		return fmt.Errorf("发件人地址无效: %v", err)
+	}
+	for _, to := range recipients {
+		if _, err := mail.ParseAddress(to); err != nil {
+			return fmt.Errorf("收件人地址无效: %s", to)
+		}
+	}
+
+	client, err := e.dial(host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if username := e.settings.Get(SettingSMTPUsername); username != "" {
+		if ok, _ := client.Extension("AUTH"); ok {
+			if err := client.Auth(smtp.PlainAuth("", username, e.settings.Get(SettingSMTPPassword), host)); err != nil {
+				return fmt.Errorf("SMTP认证失败: %v", err)
+			}
+		}
+	}
+
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, to := range recipients {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("收件人 %s 被拒绝: %v", to, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(buildMessage(from, recipients, subject, body)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// dial 按加密方式建立SMTP连接
+func (e *EmailService) dial(host string) (*smtp.Client, error) {
+	addr := net.JoinHostPort(host, strconv.Itoa(e.settings.Int(SettingSMTPPort)))
+	tlsConfig := &tls.Config{ServerName: host}
+	security := e.settings.Get(SettingSMTPSecurity)
+
+	var conn net.Conn
+	var err error
+	if security == SMTPSecurityTLS {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: smtpTimeout}, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, smtpTimeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("连接SMTP服务器失败: %v", err)
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("连接SMTP服务器失败: %v", err)
+	}
+	if security == SMTPSecurityStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, fmt.Errorf("SMTP服务器不支持STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("STARTTLS失败: %v", err)
+		}
+	}
+	return client, nil
+}
+
+// buildMessage 构造HTML邮件，正文使用base64编码
+func buildMessage(from *mail.Address, recipients []string, subject, body string) []byte {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from.String())
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(recipients, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+
+	encoded := base64.StdEncoding.EncodeToString([]byte(body))
+	for len(encoded) > 76 {
+		msg.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	msg.WriteString(encoded + "\r\n")
+	return msg.Bytes()
+}
@@ -0,0 +1,262 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"l2tp-manager/internal/database"
+	"l2tp-manager/internal/metrics"
+
+	"gorm.io/gorm"
+)
+
+// SettingExitMetricsInterval 落地机指标采集间隔
+const SettingExitMetricsInterval = "exit_metrics_interval"
+
+// ExitNodeStats 一次从落地机采集到的指标
+type ExitNodeStats struct {
+	Sessions       int     // 在线客户端数
+	Container      bool    // 是否采集到容器资源，WireGuard不使用容器
+	CPUPercent     float64 // 容器CPU使用率(%)
+	MemoryBytes    float64 // 容器内存使用量
+	MemoryLimit    float64 // 容器内存上限
+	NetworkRxBytes float64 // 容器启动以来接收的字节数
+	NetworkTxBytes float64 // 容器启动以来发送的字节数
+	PIDs           float64 // 容器进程数
+}
+
+// exitNodeSample 落地机最近一次采集结果
+type exitNodeSample struct {
+	server   database.L2TPServer
+	stats    *ExitNodeStats // 采集失败时为nil
+	duration time.Duration
+	at       time.Time
+}
+
+// ExitNodeMetrics 定期通过SSH采集运行中落地机的在线会话数和容器资源，供/metrics按服务器输出
+type ExitNodeMetrics struct {
+	db       *gorm.DB
+	settings *SettingsService
+	ssh      ExitNodeClient
+	samples  map[uint]exitNodeSample
+	mutex    sync.RWMutex
+}
+
+// NewExitNodeMetrics 创建落地机指标采集器并注册Prometheus指标
+func NewExitNodeMetrics(db *gorm.DB, settings *SettingsService, ssh ExitNodeClient) *ExitNodeMetrics {
+	settings.Register(SettingDef{Key: SettingExitMetricsInterval, Type: SettingTypeInt, Default: "300", Description: "落地机会话数和容器资源指标采集间隔(秒)，0表示关闭"})
+	e := &ExitNodeMetrics{db: db, settings: settings, ssh: ssh, samples: make(map[uint]exitNodeSample)}
+	e.register()
+	return e
+}
+
+// Start 按设置的间隔采集，间隔修改后立即生效
+func (e *ExitNodeMetrics) Start(ctx context.Context) {
+	changed := e.settings.Watch(SettingExitMetricsInterval)
+	for {
+		interval := e.settings.Seconds(SettingExitMetricsInterval)
+		if interval <= 0 {
+			// 关闭采集后不再输出过期的指标
+			e.mutex.Lock()
+			e.samples = make(map[uint]exitNodeSample)
+			e.mutex.Unlock()
+		}
+		timer := newIntervalTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-changed:
+			timer.Stop()
+		case <-timer.C:
+			e.Collect(ctx)
+		}
+	}
+}
+
+// Collect 并发采集所有运行中的服务器，已停止或删除的服务器不再输出指标；ctx取消时中止采集，保留上一次的结果
+func (e *ExitNodeMetrics) Collect(ctx context.Context) {
+	var servers []database.L2TPServer
+	if err := e.db.WithContext(ctx).Where("status = ?", "running").Find(&servers).Error; err != nil {
+		slog.Error("加载运行中服务器失败", "error", err)
+		return
+	}
+
+	samples := make(map[uint]exitNodeSample, len(servers))
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for i := range servers {
+		wg.Add(1)
+		go func(server database.L2TPServer) {
+			defer wg.Done()
+			start := time.Now()
+			stats, err := e.ssh.WithContext(ctx).ExitNodeStats(&server)
+			if err != nil {
+				slog.Warn("采集落地机指标失败", "server_id", server.ID, "error", err)
+			}
+			mutex.Lock()
+			samples[server.ID] = exitNodeSample{server: server, stats: stats, duration: time.Since(start), at: start}
+			mutex.Unlock()
+		}(servers[i])
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+
+	e.mutex.Lock()
+	e.samples = samples
+	e.mutex.Unlock()
+}
+
+// collect 将最近一次采集结果转换为指标样本，value返回false的服务器不输出
+func (e *ExitNodeMetrics) collect(value func(sample *exitNodeSample) (float64, bool)) func() []metrics.Sample {
+	return func() []metrics.Sample {
+		e.mutex.RLock()
+		defer e.mutex.RUnlock()
+		samples := make([]metrics.Sample, 0, len(e.samples))
+		for _, sample := range e.samples {
+			v, ok := value(&sample)
+			if !ok {
+				continue
+			}
+			labels := []string{strconv.FormatUint(uint64(sample.server.ID), 10), sample.server.Name, sample.server.Host, sample.server.Type}
+			samples = append(samples, metrics.Sample{Labels: labels, Value: v})
+		}
+		return samples
+	}
+}
+
+// register 注册按服务器区分的落地机指标
+func (e *ExitNodeMetrics) register() {
+	labels := []string{"server_id", "server", "host", "type"}
+	// container 只输出采集到容器资源的服务器
+	container := func(field func(stats *ExitNodeStats) float64) func(sample *exitNodeSample) (float64, bool) {
+		return func(sample *exitNodeSample) (float64, bool) {
+			if sample.stats == nil || !sample.stats.Container {
+				return 0, false
+			}
+			return field(sample.stats), true
+		}
+	}
+
+	metrics.NewCollector("l2tp_exit_node_up", "最近一次采集落地机指标是否成功",
+		metrics.TypeGauge, labels, e.collect(func(sample *exitNodeSample) (float64, bool) {
+			if sample.stats == nil {
+				return 0, true
+			}
+			return 1, true
+		}))
+	metrics.NewCollector("l2tp_exit_node_scrape_duration_seconds", "最近一次采集落地机指标的耗时",
+		metrics.TypeGauge, labels, e.collect(func(sample *exitNodeSample) (float64, bool) {
+			return sample.duration.Seconds(), true
+		}))
+	metrics.NewCollector("l2tp_exit_node_last_scrape_timestamp_seconds", "最近一次采集落地机指标的时间",
+		metrics.TypeGauge, labels, e.collect(func(sample *exitNodeSample) (float64, bool) {
+			return float64(sample.at.Unix()), true
+		}))
+	metrics.NewCollector("l2tp_exit_node_sessions", "落地机在线客户端数",
+		metrics.TypeGauge, labels, e.collect(func(sample *exitNodeSample) (float64, bool) {
+			if sample.stats == nil {
+				return 0, false
+			}
+			return float64(sample.stats.Sessions), true
+		}))
+	metrics.NewCollector("l2tp_exit_node_container_cpu_percent", "落地机容器CPU使用率(%)",
+		metrics.TypeGauge, labels, e.collect(container(func(stats *ExitNodeStats) float64 { return stats.CPUPercent })))
+	metrics.NewCollector("l2tp_exit_node_container_memory_bytes", "落地机容器内存使用量",
+		metrics.TypeGauge, labels, e.collect(container(func(stats *ExitNodeStats) float64 { return stats.MemoryBytes })))
+	metrics.NewCollector("l2tp_exit_node_container_memory_limit_bytes", "落地机容器内存上限",
+		metrics.TypeGauge, labels, e.collect(container(func(stats *ExitNodeStats) float64 { return stats.MemoryLimit })))
+	metrics.NewCollector("l2tp_exit_node_container_network_receive_bytes_total", "落地机容器启动以来接收的字节数",
+		metrics.TypeCounter, labels, e.collect(container(func(stats *ExitNodeStats) float64 { return stats.NetworkRxBytes })))
+	metrics.NewCollector("l2tp_exit_node_container_network_transmit_bytes_total", "落地机容器启动以来发送的字节数",
+		metrics.TypeCounter, labels, e.collect(container(func(stats *ExitNodeStats) float64 { return stats.NetworkTxBytes })))
+	metrics.NewCollector("l2tp_exit_node_container_pids", "落地机容器进程数",
+		metrics.TypeGauge, labels, e.collect(container(func(stats *ExitNodeStats) float64 { return stats.PIDs })))
+}
+
+// dockerStats docker stats --format '{{json .}}' 的输出
+type dockerStats struct {
+	CPUPerc  string `json:"CPUPerc"`
+	MemUsage string `json:"MemUsage"`
+	NetIO    string `json:"NetIO"`
+	PIDs     string `json:"PIDs"`
+}
+
+// parseDockerSize 解析docker stats输出的容量，如 1.5MiB、12.3kB
+func parseDockerSize(value string) float64 {
+	value = strings.TrimSpace(value)
+	end := strings.IndexFunc(value, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if end < 0 {
+		end = len(value)
+	}
+	number, err := strconv.ParseFloat(value[:end], 64)
+	if err != nil {
+		return 0
+	}
+	units := map[string]float64{
+		"": 1, "B": 1,
+		"kB": 1e3, "KB": 1e3, "MB": 1e6, "GB": 1e9, "TB": 1e12,
+		"KiB": 1 << 10, "MiB": 1 << 20, "GiB": 1 << 30, "TiB": 1 << 40,
+	}
+	return number * units[strings.TrimSpace(value[end:])]
+}
+
+// splitPair 拆分docker stats中 "a / b" 形式的字段
+func splitPair(value string) (string, string) {
+	first, second, _ := strings.Cut(value, "/")
+	return first, second
+}
+
+// parseDockerStats 解析容器资源使用情况
+func parseDockerStats(output string, stats *ExitNodeStats) error {
+	var raw dockerStats
+	if err := json.Unmarshal([]byte(strings.TrimSpace(output)), &raw); err != nil {
+		return fmt.Errorf("解析容器资源失败: %v", err)
+	}
+	stats.Container = true
+	stats.CPUPercent, _ = strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(raw.CPUPerc), "%"), 64)
+	usage, limit := splitPair(raw.MemUsage)
+	stats.MemoryBytes, stats.MemoryLimit = parseDockerSize(usage), parseDockerSize(limit)
+	rx, tx := splitPair(raw.NetIO)
+	stats.NetworkRxBytes, stats.NetworkTxBytes = parseDockerSize(rx), parseDockerSize(tx)
+	stats.PIDs, _ = strconv.ParseFloat(strings.TrimSpace(raw.PIDs), 64)
+	return nil
+}
+
+// ExitNodeStats 通过一次SSH连接采集落地机的在线客户端数和容器资源使用情况
+func (s *SSHService) ExitNodeStats(server *database.L2TPServer) (_ *ExitNodeStats, err error) {
+	defer func(start time.Time) { metrics.ObserveSSH("exit_stats", start, err) }(time.Now())
+
+	client, err := s.createSSHClient(server)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	stats := &ExitNodeStats{}
+	if stats.Sessions, err = s.connectedClients(client, server); err != nil {
+		return nil, err
+	}
+	if server.Type == ServerTypeWireGuard {
+		return stats, nil
+	}
+
+	output, err := s.executeCommand(client, fmt.Sprintf("docker stats --no-stream --format '{{json .}}' %s", serverContainerName(server)))
+	if err != nil {
+		return nil, fmt.Errorf("获取容器资源失败: %v", err)
+	}
+	if err := parseDockerStats(output, stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
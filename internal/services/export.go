@@ -0,0 +1,167 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"l2tp-manager/internal/database"
+)
+
+// TrafficExportQuery 流量导出条件
+type TrafficExportQuery struct {
+	ServerID    uint
+	Granularity string // raw(原始日志)/hour/day
+	Since       time.Time
+	Until       time.Time
+}
+
+// serverNames 加载全部服务器(含回收站)的名称映射
+func (s *L2TPService) serverNames() (map[uint]string, error) {
+	var servers []database.L2TPServer
+	if err := s.db.Unscoped().Select("id", "name").Find(&servers).Error; err != nil {
+		return nil, err
+	}
+	names := make(map[uint]string, len(servers))
+	for _, server := range servers {
+		names[server.ID] = server.Name
+	}
+	return names, nil
+}
+
+// ExportTraffic 按条件流式导出流量数据
+func (s *L2TPService) ExportTraffic(w TableWriter, q TrafficExportQuery) error {
+	names, err := s.serverNames()
+	if err != nil {
+		return err
+	}
+
+	if q.Granularity == "raw" {
+		return s.exportTrafficLogs(w, q, names)
+	}
+	if q.Granularity != GranularityHour && q.Granularity != GranularityDay {
+		return fmt.Errorf("无效的导出粒度: %s", q.Granularity)
+	}
+
+	query := s.db.Model(&database.TrafficSample{}).Where("granularity = ?", q.Granularity).Order("bucket, server_id")
+	if q.ServerID > 0 {
+		query = query.Where("server_id = ?", q.ServerID)
+	}
+	if !q.Since.IsZero() {
+		query = query.Where("bucket >= ?", q.Since)
+	}
+	if !q.Until.IsZero() {
+		query = query.Where("bucket < ?", q.Until)
+	}
+
+	rows, err := query.Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if err := w.Write([]interface{}{"时间", "服务器ID", "服务器名称", "流量(字节)"}); err != nil {
+		return err
+	}
+	for rows.Next() {
+		var sample database.TrafficSample
+		if err := s.db.ScanRows(rows, &sample); err != nil {
+			return err
+		}
+		if err := w.Write([]interface{}{sample.Bucket, sample.ServerID, names[sample.ServerID], sample.Bytes}); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// exportTrafficLogs 导出原始流量日志
+func (s *L2TPService) exportTrafficLogs(w TableWriter, q TrafficExportQuery, names map[uint]string) error {
+	query := s.db.Model(&database.TrafficLog{}).Order("created_at")
+	if q.ServerID > 0 {
+		query = query.Where("server_id = ?", q.ServerID)
+	}
+	if !q.Since.IsZero() {
+		query = query.Where("created_at >= ?", q.Since)
+	}
+	if !q.Until.IsZero() {
+		query = query.Where("created_at < ?", q.Until)
+	}
+
+	rows, err := query.Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if err := w.Write([]interface{}{"时间", "服务器ID", "服务器名称", "客户端IP", "国家/地区", "流量(字节)"}); err != nil {
+		return err
+	}
+	for rows.Next() {
+		var entry database.TrafficLog
+		if err := s.db.ScanRows(rows, &entry); err != nil {
+			return err
+		}
+		if err := w.Write([]interface{}{entry.CreatedAt, entry.ServerID, names[entry.ServerID], entry.ClientIP, entry.Country, entry.Bytes}); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ExportInventory 导出服务器清单及时间范围内的流量合计，tenantID大于0时只导出该租户的服务器
+func (s *L2TPService) ExportInventory(w TableWriter, since, until time.Time, tenantID uint) error {
+	totals := make(map[uint]int64)
+	query := s.db.Model(&database.TrafficSample{}).Scopes(tenantServerIDs("server_id", tenantID)).Select("server_id, SUM(bytes) AS bytes").
+		Where("granularity = ?", GranularityDay).Group("server_id")
+	if !since.IsZero() {
+		query = query.Where("bucket >= ?", bucketStart(since, GranularityDay))
+	}
+	if !until.IsZero() {
+		query = query.Where("bucket < ?", until)
+	}
+	var sums []struct {
+		ServerID uint
+		Bytes    int64
+	}
+	if err := query.Scan(&sums).Error; err != nil {
+		return err
+	}
+	for _, sum := range sums {
+		totals[sum.ServerID] = sum.Bytes
+	}
+
+	rows, err := s.db.Model(&database.L2TPServer{}).Scopes(TenantServers(tenantID)).Order("id").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	header := []interface{}{"ID", "名称", "类型", "落地机地址", "SSH端口", "L2TP中转端口", "OpenVPN中转端口", "SSTP中转端口",
+		"状态", "期望状态", "到期时间", "已过期", "创建时间", "流量(字节)"}
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	for rows.Next() {
+		var server database.L2TPServer
+		if err := s.db.ScanRows(rows, &server); err != nil {
+			return err
+		}
+		relayPort := func(enabled bool, port int) interface{} {
+			if !enabled {
+				return ""
+			}
+			return port
+		}
+		row := []interface{}{
+			server.ID, server.Name, server.Type, server.Host, server.Port, server.L2TPPort,
+			relayPort(server.EnableOpenVPN, server.OpenVPNRelayPort),
+			relayPort(server.EnableSSTP, server.SSTPRelayPort),
+			server.Status, server.DesiredState, server.ExpireDate,
+			time.Now().After(server.ExpireDate), server.CreatedAt, totals[server.ID],
+		}
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
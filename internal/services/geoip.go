@@ -0,0 +1,217 @@
+package services
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"l2tp-manager/internal/database"
+
+	"github.com/xtls/xray-core/app/router"
+	"google.golang.org/protobuf/proto"
+)
+
+// 国家访问策略
+const (
+	GeoIPModeAllow = "allow" // 只允许列出的国家/地区的客户端
+	GeoIPModeDeny  = "deny"  // 拒绝列出的国家/地区的客户端
+)
+
+// geoIPBlockTag 转发器中丢弃被拒绝客户端流量的出站标签
+const geoIPBlockTag = "geoip-block"
+
+// geoIPCodePattern geoip.dat中的国家/地区代码，除ISO代码外还有PRIVATE、CLOUDFLARE等自定义分类
+var geoIPCodePattern = regexp.MustCompile(`^[A-Z0-9_-]{2,32}$`)
+
+// GeoIPDatabase Xray格式(geoip.dat)的GeoIP数据库，用于标记客户端IP的国家和生成转发器的访问控制规则
+type GeoIPDatabase struct {
+	Path     string
+	LoadedAt time.Time
+	codes    []string // 按代码排序，PRIVATE排在最后，公网地址优先匹配具体国家
+	cidrs    map[string][]*router.CIDR
+	matchers map[string]*router.GeoIPMatcher
+}
+
+// CountryTraffic 单个国家/地区的流量汇总
+type CountryTraffic struct {
+	Country string  `json:"country"` // 为空表示未知(未加载GeoIP数据库时记录的流量)
+	Bytes   int64   `json:"bytes"`
+	Clients int64   `json:"clients"` // 不同客户端IP数
+	Percent float64 `json:"percent"`
+}
+
+// LoadGeoIP 加载geoip.dat
+func LoadGeoIP(path string) (*GeoIPDatabase, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取GeoIP数据库失败: %v", err)
+	}
+	var list router.GeoIPList
+	if err := proto.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("解析GeoIP数据库失败: %v", err)
+	}
+
+	db := &GeoIPDatabase{
+		Path:     path,
+		LoadedAt: time.Now(),
+		cidrs:    make(map[string][]*router.CIDR),
+		matchers: make(map[string]*router.GeoIPMatcher),
+	}
+	for _, entry := range list.Entry {
+		code := strings.ToUpper(entry.CountryCode)
+		db.cidrs[code] = append(db.cidrs[code], entry.Cidr...)
+	}
+	for code, cidrs := range db.cidrs {
+		matcher := &router.GeoIPMatcher{}
+		if err := matcher.Init(cidrs); err != nil {
+			return nil, fmt.Errorf("GeoIP数据库中 %s 的地址段无效: %v", code, err)
+		}
+		db.matchers[code] = matcher
+		db.codes = append(db.codes, code)
+	}
+	if len(db.codes) == 0 {
+		return nil, fmt.Errorf("GeoIP数据库为空")
+	}
+	sort.Slice(db.codes, func(i, j int) bool {
+		if (db.codes[i] == "PRIVATE") != (db.codes[j] == "PRIVATE") {
+			return db.codes[j] == "PRIVATE"
+		}
+		return db.codes[i] < db.codes[j]
+	})
+	return db, nil
+}
+
+// Countries 数据库中的全部代码
+func (g *GeoIPDatabase) Countries() []string {
+	return append([]string{}, g.codes...)
+}
+
+// Lookup 查询IP所属的国家/地区代码，未收录时返回空
+func (g *GeoIPDatabase) Lookup(address string) string {
+	if g == nil {
+		return ""
+	}
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return ""
+	}
+	// 匹配器按地址长度区分IPv4和IPv6
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	for _, code := range g.codes {
+		if g.matchers[code].Match(ip) {
+			return code
+		}
+	}
+	return ""
+}
+
+// parseGeoIPCountries 解析逗号分隔的国家/地区代码(大写、去重)
+func parseGeoIPCountries(value string) []string {
+	var codes []string
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(value, ",") {
+		code := strings.ToUpper(strings.TrimSpace(part))
+		if code != "" && !seen[code] {
+			seen[code] = true
+			codes = append(codes, code)
+		}
+	}
+	return codes
+}
+
+// validateGeoIPPolicy 校验并规范化服务器的国家访问策略
+func validateGeoIPPolicy(server *database.L2TPServer) error {
+	codes := parseGeoIPCountries(server.GeoIPCountries)
+	switch server.GeoIPMode {
+	case "":
+		if len(codes) > 0 {
+			return fmt.Errorf("设置国家/地区列表时需要指定geoip_mode为allow或deny")
+		}
+	case GeoIPModeAllow, GeoIPModeDeny:
+		if len(codes) == 0 {
+			return fmt.Errorf("国家访问策略至少需要一个国家/地区代码")
+		}
+	default:
+		return fmt.Errorf("geoip_mode只能是allow或deny")
+	}
+	for _, code := range codes {
+		if !geoIPCodePattern.MatchString(code) {
+			return fmt.Errorf("无效的国家/地区代码 %q", code)
+		}
+	}
+	server.GeoIPCountries = strings.Join(codes, ",")
+	return nil
+}
+
+// blockRule 生成转发器的路由规则：拒绝名单中的来源地址，或允许名单以外的来源地址，转到丢弃出站
+func (g *GeoIPDatabase) blockRule(mode, countries string) (*router.RoutingRule, error) {
+	if g == nil {
+		return nil, fmt.Errorf("未加载GeoIP数据库，无法执行国家访问策略")
+	}
+	geoip := &router.GeoIP{ReverseMatch: mode == GeoIPModeAllow}
+	for _, code := range parseGeoIPCountries(countries) {
+		cidrs, ok := g.cidrs[code]
+		if !ok {
+			return nil, fmt.Errorf("GeoIP数据库中没有 %s", code)
+		}
+		geoip.Cidr = append(geoip.Cidr, cidrs...)
+	}
+	return &router.RoutingRule{
+		SourceGeoip: []*router.GeoIP{geoip},
+		TargetTag:   &router.RoutingRule_Tag{Tag: geoIPBlockTag},
+	}, nil
+}
+
+// SetGeoIP 设置GeoIP数据库，此后启动的转发器按服务器的国家访问策略过滤客户端
+func (r *RoutingService) SetGeoIP(geoip *GeoIPDatabase) {
+	r.geoip = geoip
+}
+
+// TrafficByCountry 按客户端所属国家/地区汇总流量日志，serverID为0时汇总全部服务器
+func (s *L2TPService) TrafficByCountry(serverID uint, since, until time.Time) ([]CountryTraffic, error) {
+	query := s.db.Model(&database.TrafficLog{}).
+		Select("country, SUM(bytes) AS bytes, COUNT(DISTINCT client_ip) AS clients").
+		Group("country").Order("bytes DESC")
+	if serverID > 0 {
+		query = query.Where("server_id = ?", serverID)
+	}
+	if !since.IsZero() {
+		query = query.Where("created_at >= ?", since)
+	}
+	if !until.IsZero() {
+		query = query.Where("created_at < ?", until)
+	}
+
+	rows := []CountryTraffic{}
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	var total int64
+	for _, row := range rows {
+		total += row.Bytes
+	}
+	for i := range rows {
+		if total > 0 {
+			rows[i].Percent = float64(rows[i].Bytes) * 100 / float64(total)
+		}
+	}
+	return rows, nil
+}
+
+// tagCountries 为流量日志标记客户端所属国家/地区
+func tagCountries(geoip *GeoIPDatabase, logs []database.TrafficLog) {
+	if geoip == nil {
+		return
+	}
+	for i := range logs {
+		if logs[i].Country == "" {
+			logs[i].Country = geoip.Lookup(logs[i].ClientIP)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+//go:build linux
+
+package services
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// handoffSupported 当前平台是否支持重启时保留监听套接字
+const handoffSupported = true
+
+// setReusePort 作为net.ListenConfig.Control设置SO_REUSEPORT，与Xray监听套接字的设置一致，
+// 使交接用的套接字和转发器可同时绑定同一端口
+func setReusePort(network, address string, c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
+
+// clearCloseOnExec 清除FD_CLOEXEC，使文件描述符在exec后保留
+func clearCloseOnExec(fd uintptr) error {
+	_, err := unix.FcntlInt(fd, unix.F_SETFD, 0)
+	return err
+}
+
+// monotonicMicros CLOCK_MONOTONIC当前值(微秒)，用于sd_notify的MONOTONIC_USEC
+func monotonicMicros() int64 {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts); err != nil {
+		return 0
+	}
+	return ts.Nano() / 1000
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+
+package services
+
+import (
+	"errors"
+	"syscall"
+)
+
+// handoffSupported 当前平台是否支持重启时保留监听套接字
+const handoffSupported = false
+
+// setReusePort 非Linux平台不设置SO_REUSEPORT
+func setReusePort(network, address string, c syscall.RawConn) error {
+	return nil
+}
+
+// clearCloseOnExec 非Linux平台不支持交接套接字
+func clearCloseOnExec(fd uintptr) error {
+	return errors.New("当前平台不支持交接套接字")
+}
+
+// monotonicMicros 非Linux平台没有systemd，返回0
+func monotonicMicros() int64 {
+	return 0
+}
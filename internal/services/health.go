@@ -0,0 +1,208 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"l2tp-manager/internal/database"
+	"l2tp-manager/internal/logger"
+
+	"gorm.io/gorm"
+)
+
+// HealthMonitor 落地机容器健康监控，连续失败时自动重启
+type HealthMonitor struct {
+	db           *gorm.DB
+	l2tpService  *L2TPService
+	wsManager    *WSManager
+	notifier     *NotificationService
+	auditService *AuditService
+	settings     *SettingsService
+	failures     map[uint]int // 服务器ID -> 连续失败次数
+	restarts     map[uint]int // 服务器ID -> 已尝试的自动重启次数
+	mutex        sync.Mutex
+}
+
+// NewHealthMonitor 创建健康监控
+func NewHealthMonitor(db *gorm.DB, l2tpService *L2TPService, wsManager *WSManager, notifier *NotificationService, auditService *AuditService, settings *SettingsService) *HealthMonitor {
+	return &HealthMonitor{
+		db:           db,
+		l2tpService:  l2tpService,
+		wsManager:    wsManager,
+		notifier:     notifier,
+		auditService: auditService,
+		settings:     settings,
+		failures:     make(map[uint]int),
+		restarts:     make(map[uint]int),
+	}
+}
+
+// Start 启动健康检查循环，检查间隔修改后立即生效，间隔为0时暂停检查
+func (h *HealthMonitor) Start(ctx context.Context) {
+	changed := h.settings.Watch(SettingHealthCheckInterval)
+	slog.Info("落地机健康监控已启动", "interval", h.settings.Seconds(SettingHealthCheckInterval), "threshold", h.settings.Int(SettingHealthFailThreshold))
+
+	for {
+		timer := newIntervalTimer(h.settings.Seconds(SettingHealthCheckInterval))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			slog.Info("落地机健康监控正在退出")
+			return
+		case <-changed:
+			timer.Stop()
+			slog.Info("健康检查间隔已更新", "interval", h.settings.Seconds(SettingHealthCheckInterval))
+		case <-timer.C:
+			h.checkAll(ctx)
+		}
+	}
+}
+
+// checkAll 检查所有运行中的服务器，ctx取消时中止进行中的SSH检查
+func (h *HealthMonitor) checkAll(ctx context.Context) {
+	var servers []database.L2TPServer
+	if err := h.db.WithContext(ctx).Where("status = ?", "running").Find(&servers).Error; err != nil {
+		slog.Error("加载运行中服务器失败", "error", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i := range servers {
+		wg.Add(1)
+		go func(server *database.L2TPServer) {
+			defer wg.Done()
+			h.checkServer(ctx, server)
+		}(&servers[i])
+	}
+	wg.Wait()
+}
+
+// checkServer 检查单个服务器，达到失败阈值时尝试自动重启
+func (h *HealthMonitor) checkServer(ctx context.Context, server *database.L2TPServer) {
+	healthy, reason := h.probe(ctx, server)
+	if ctx.Err() != nil {
+		// 退出时被中止的检查不计入失败次数
+		return
+	}
+	if healthy {
+		h.l2tpService.recordAvailability(server.ID, AvailabilityUp, "健康检查通过")
+	} else {
+		h.l2tpService.recordAvailability(server.ID, AvailabilityDown, reason)
+	}
+
+	h.mutex.Lock()
+	if healthy {
+		recovered := h.restarts[server.ID] > 0
+		delete(h.failures, server.ID)
+		delete(h.restarts, server.ID)
+		h.mutex.Unlock()
+		if recovered {
+			h.notify(EventServerRecovered, "running", server, "自动重启后服务器已恢复正常")
+		}
+		return
+	}
+
+	h.failures[server.ID]++
+	failures := h.failures[server.ID]
+	attempts := h.restarts[server.ID]
+	h.mutex.Unlock()
+
+	failThreshold := h.settings.Int(SettingHealthFailThreshold)
+	maxRestarts := h.settings.Int(SettingHealthMaxRestarts)
+	slog.Warn("服务器健康检查失败", "server_id", server.ID, "failures", failures, "threshold", failThreshold, "reason", reason)
+	if failures < failThreshold {
+		return
+	}
+
+	if attempts >= maxRestarts {
+		h.giveUp(server, attempts, reason)
+		return
+	}
+
+	h.mutex.Lock()
+	h.restarts[server.ID]++
+	h.failures[server.ID] = 0
+	attempt := h.restarts[server.ID]
+	h.mutex.Unlock()
+
+	h.restart(ctx, server, attempt, reason)
+}
+
+// giveUp 重启次数用尽，标记为错误状态等待人工处理
+func (h *HealthMonitor) giveUp(server *database.L2TPServer, attempts int, reason string) {
+	message := fmt.Sprintf("自动重启 %d 次后仍不健康，已停止自动重启: %s", attempts, reason)
+	// 状态更新携带原因推送error并发布服务器错误事件，这里只补充审计记录
+	h.l2tpService.updateServerStatusMessage(server.ID, "error", message)
+	h.auditService.Record(server.ID, "auto_restart", "system", "failed", message)
+
+	h.mutex.Lock()
+	delete(h.failures, server.ID)
+	delete(h.restarts, server.ID)
+	h.mutex.Unlock()
+}
+
+// probe 通过SSH检查容器是否运行
+func (h *HealthMonitor) probe(ctx context.Context, server *database.L2TPServer) (bool, string) {
+	status, err := h.l2tpService.SSH().WithContext(ctx).GetContainerStatus(server)
+	if err != nil {
+		return false, err.Error()
+	}
+	if running, ok := status["running"].(bool); !ok || !running {
+		if message, ok := status["error"].(string); ok {
+			return false, message
+		}
+		return false, "容器未运行"
+	}
+	return true, ""
+}
+
+// restart 通过SSH重新部署容器，保持服务器为运行状态
+func (h *HealthMonitor) restart(ctx context.Context, server *database.L2TPServer, attempt int, reason string) {
+	message := fmt.Sprintf("健康检查连续失败，正在进行第 %d/%d 次自动重启: %s", attempt, h.settings.Int(SettingHealthMaxRestarts), reason)
+	slog.Info("健康监控处理", "server_id", server.ID, "message", message)
+	h.notify(EventAutoRestart, "starting", server, message)
+
+	job := h.l2tpService.newServerJob(JobKindAutoRestart, server.ID, server.Type)
+	jobCallback := job.Callback()
+	callback := func(step string, success bool, detail string) {
+		jobCallback(step, success, detail)
+		if h.wsManager != nil {
+			status := "running"
+			if !success {
+				status = "error"
+			}
+			h.wsManager.BroadcastServerStatus(server.ID, status, fmt.Sprintf("[自动重启:%s] %s", step, detail))
+		}
+	}
+
+	// 重启一旦开始就执行完，不随监控退出中断，避免容器停在部署中途
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), serverOperationTimeout)
+	defer cancel()
+	err := h.l2tpService.SSH().WithContext(logger.WithTrace(ctx, job.Trace())).StartL2TPContainerWithCallback(server, callback)
+	job.Finish(err)
+	if err != nil {
+		h.auditService.Record(server.ID, "auto_restart", "system", "failed",
+			fmt.Sprintf("第 %d 次自动重启失败: %v", attempt, err))
+		return
+	}
+
+	h.auditService.Record(server.ID, "auto_restart", "system", "success",
+		fmt.Sprintf("第 %d 次自动重启完成", attempt))
+}
+
+// notify 通过WebSocket推送服务器的当前状态，并经通知服务发布事件
+func (h *HealthMonitor) notify(eventType, status string, server *database.L2TPServer, message string) {
+	if h.wsManager != nil {
+		h.wsManager.BroadcastServerStatus(server.ID, status, message)
+	}
+	if h.notifier != nil {
+		h.notifier.Publish(Event{
+			Type:       eventType,
+			ServerID:   server.ID,
+			ServerName: server.Name,
+			Message:    message,
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"l2tp-manager/internal/database"
+)
+
+func TestHealthMonitorGiveUpBroadcastsError(t *testing.T) {
+	db := newTestDB(t)
+	server := &database.L2TPServer{
+		Name:     "server",
+		Host:     "192.0.2.1",
+		Username: "root",
+		Password: "secret-password",
+		L2TPPort: 20001,
+		Status:   "running",
+	}
+	if err := db.Create(server).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	wsManager := NewWSManager()
+	messages, cancel := wsManager.Listen()
+	defer cancel()
+	monitor := NewHealthMonitor(db, NewL2TPService(db, wsManager, nil), wsManager, nil, NewAuditService(db), nil)
+
+	monitor.failures[server.ID] = 3
+	monitor.restarts[server.ID] = 2
+	monitor.giveUp(server, 2, "容器未运行")
+
+	var last StatusMessage
+	for len(messages) > 0 {
+		msg := <-messages
+		if msg.Type == "server_status" && msg.ServerID == server.ID {
+			last = msg
+		}
+	}
+	if last.Status != "error" {
+		t.Fatalf("最后广播的状态为 %q，期望 error", last.Status)
+	}
+	if !strings.Contains(last.Message, "容器未运行") {
+		t.Fatalf("广播的消息 %q 未包含放弃重启的原因", last.Message)
+	}
+
+	var stored database.L2TPServer
+	if err := db.First(&stored, server.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != "error" {
+		t.Fatalf("数据库中的状态为 %q，期望 error", stored.Status)
+	}
+	if _, ok := monitor.failures[server.ID]; ok {
+		t.Fatal("放弃重启后应清除失败计数")
+	}
+	if _, ok := monitor.restarts[server.ID]; ok {
+		t.Fatal("放弃重启后应清除重启计数")
+	}
+}
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+)
+
+// 面板主机资源监控的设置项
+const (
+	SettingResourceCheckInterval = "resource_check_interval"
+	SettingResourceAlertPercent  = "resource_alert_percent"
+	SettingResourceGuardPercent  = "resource_guard_percent"
+)
+
+// resourceRecoverMargin 使用率低于告警阈值多少个百分点后恢复，避免在阈值附近反复通知
+const resourceRecoverMargin = 5
+
+// 面板主机资源
+const (
+	ResourceCPU    = "cpu"
+	ResourceMemory = "memory"
+	ResourceDisk   = "disk"
+	ResourceFiles  = "file_descriptors"
+)
+
+// resourceNames 资源的中文名称
+var resourceNames = map[string]string{
+	ResourceCPU:    "CPU",
+	ResourceMemory: "内存",
+	ResourceDisk:   "磁盘",
+	ResourceFiles:  "文件描述符",
+}
+
+// HostResources 面板所在主机的资源使用情况，读取失败的项为0
+type HostResources struct {
+	CPUPercent       float64   `json:"cpu_percent"` // 两次采样之间全部CPU的平均使用率，首次采样为0
+	MemoryTotal      uint64    `json:"memory_total_bytes"`
+	MemoryAvailable  uint64    `json:"memory_available_bytes"`
+	MemoryPercent    float64   `json:"memory_percent"`
+	DiskPath         string    `json:"disk_path"` // 数据目录，统计其所在的文件系统
+	DiskTotal        uint64    `json:"disk_total_bytes"`
+	DiskFree         uint64    `json:"disk_free_bytes"`
+	DiskPercent      float64   `json:"disk_percent"`
+	OpenFiles        uint64    `json:"open_files"`
+	OpenFilesLimit   uint64    `json:"open_files_limit"` // RLIMIT_NOFILE软限制
+	OpenFilesPercent float64   `json:"open_files_percent"`
+	Alerts           []string  `json:"alerts"` // 超过告警阈值的资源
+	Errors           []string  `json:"errors,omitempty"`
+	SampledAt        time.Time `json:"sampled_at"`
+}
+
+// percent 资源的使用率(%)
+func (h HostResources) percent(resource string) float64 {
+	switch resource {
+	case ResourceCPU:
+		return h.CPUPercent
+	case ResourceMemory:
+		return h.MemoryPercent
+	case ResourceDisk:
+		return h.DiskPercent
+	case ResourceFiles:
+		return h.OpenFilesPercent
+	}
+	return 0
+}
+
+// usagePercent used占total的百分比，保留两位小数
+func usagePercent(used, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(used)*10000/float64(total)) / 100
+}
+
+// ResourceMonitor 定期采集面板主机的CPU、内存、磁盘和文件描述符：超过告警阈值时通知，
+// 内存或文件描述符即将耗尽时拒绝启动新的转发器
+type ResourceMonitor struct {
+	settings *SettingsService
+	notifier *NotificationService
+	diskPath string
+	cpuBusy  uint64 // 上一次采样的CPU累计时间
+	cpuTotal uint64
+	latest   *HostResources
+	firing   map[string]bool // 正在告警的资源
+	mutex    sync.Mutex
+}
+
+// NewResourceMonitor 创建主机资源监控并注册其设置项，diskPath为数据目录
+func NewResourceMonitor(settings *SettingsService, notifier *NotificationService, diskPath string) *ResourceMonitor {
+	settings.Register(SettingDef{Key: SettingResourceCheckInterval, Type: SettingTypeInt, Default: "60", Description: "面板主机资源检查间隔(秒)，0表示关闭告警"})
+	settings.Register(SettingDef{Key: SettingResourceAlertPercent, Type: SettingTypeInt, Default: "90", Max: 100, Description: "面板主机CPU、内存、磁盘或文件描述符使用率达到该百分比时告警，0表示不告警"})
+	settings.Register(SettingDef{Key: SettingResourceGuardPercent, Type: SettingTypeInt, Default: "95", Max: 100, Description: "内存或文件描述符使用率达到该百分比时拒绝启动新的转发器，0表示不限制"})
+	return &ResourceMonitor{
+		settings: settings,
+		notifier: notifier,
+		diskPath: diskPath,
+		firing:   make(map[string]bool),
+	}
+}
+
+// Start 按设置的间隔检查，间隔修改后立即生效
+func (m *ResourceMonitor) Start(ctx context.Context) {
+	changed := m.settings.Watch(SettingResourceCheckInterval)
+	for {
+		timer := newIntervalTimer(m.settings.Seconds(SettingResourceCheckInterval))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-changed:
+			timer.Stop()
+		case <-timer.C:
+			m.check(m.sample(time.Now()))
+		}
+	}
+}
+
+// sample 采集一次主机资源并保存为最近的结果
+func (m *ResourceMonitor) sample(now time.Time) HostResources {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	result := HostResources{DiskPath: m.diskPath, Alerts: []string{}, SampledAt: now}
+	if busy, total, err := readCPUTimes(); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("CPU: %v", err))
+	} else {
+		if m.cpuTotal > 0 && total > m.cpuTotal && busy >= m.cpuBusy {
+			result.CPUPercent = usagePercent(busy-m.cpuBusy, total-m.cpuTotal)
+		}
+		m.cpuBusy, m.cpuTotal = busy, total
+	}
+	if total, available, err := readMemory(); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("内存: %v", err))
+	} else {
+		result.MemoryTotal, result.MemoryAvailable = total, available
+		result.MemoryPercent = usagePercent(total-min(available, total), total)
+	}
+	if total, free, err := readDisk(m.diskPath); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("磁盘: %v", err))
+	} else {
+		result.DiskTotal, result.DiskFree = total, free
+		result.DiskPercent = usagePercent(total-min(free, total), total)
+	}
+	if open, limit, err := readOpenFiles(); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("文件描述符: %v", err))
+	} else {
+		result.OpenFiles, result.OpenFilesLimit = open, limit
+		result.OpenFilesPercent = usagePercent(open, limit)
+	}
+
+	threshold := m.settings.Int(SettingResourceAlertPercent)
+	for _, resource := range []string{ResourceCPU, ResourceMemory, ResourceDisk, ResourceFiles} {
+		if threshold > 0 && result.percent(resource) >= float64(threshold) {
+			result.Alerts = append(result.Alerts, resource)
+		}
+	}
+	m.latest = &result
+	return result
+}
+
+// check 资源使用率首次达到告警阈值时通知，降到阈值以下一定幅度后通知恢复
+func (m *ResourceMonitor) check(resources HostResources) {
+	threshold := m.settings.Int(SettingResourceAlertPercent)
+
+	m.mutex.Lock()
+	var events []Event
+	for _, resource := range []string{ResourceCPU, ResourceMemory, ResourceDisk, ResourceFiles} {
+		value := resources.percent(resource)
+		data := map[string]interface{}{"resource": resource, "percent": value, "threshold": threshold}
+		switch {
+		case threshold > 0 && value >= float64(threshold) && !m.firing[resource]:
+			m.firing[resource] = true
+			slog.Warn("面板主机资源使用率超过告警阈值", "resource", resource, "percent", value, "threshold", threshold)
+			events = append(events, Event{
+				Type:    EventResourceHigh,
+				Message: fmt.Sprintf("面板主机%s使用率 %.1f%% 已达到告警阈值 %d%%", resourceNames[resource], value, threshold),
+				Data:    data,
+			})
+		case m.firing[resource] && (threshold <= 0 || value < float64(threshold-resourceRecoverMargin)):
+			delete(m.firing, resource)
+			slog.Info("面板主机资源使用率已恢复", "resource", resource, "percent", value)
+			events = append(events, Event{
+				Type:    EventResourceNormal,
+				Message: fmt.Sprintf("面板主机%s使用率 %.1f%%，告警已恢复", resourceNames[resource], value),
+				Data:    data,
+			})
+		}
+	}
+	m.mutex.Unlock()
+
+	if m.notifier != nil {
+		for _, event := range events {
+			m.notifier.Publish(event)
+		}
+	}
+}
+
+// Snapshot 最近一次采集的主机资源，关闭定期检查或超过检查间隔未采集时立即采集
+func (m *ResourceMonitor) Snapshot() HostResources {
+	m.mutex.Lock()
+	latest := m.latest
+	m.mutex.Unlock()
+
+	interval := m.settings.Seconds(SettingResourceCheckInterval)
+	if latest == nil || interval <= 0 || time.Since(latest.SampledAt) > 2*interval {
+		return m.sample(time.Now())
+	}
+	return *latest
+}
+
+// CheckCapacity 启动新的转发器前检查内存和文件描述符，使用率达到设置的阈值时返回错误。
+// 每个转发器至少占用一个监听套接字，用户态转发的每个连接还需要额外的描述符和缓冲区
+func (m *ResourceMonitor) CheckCapacity() error {
+	threshold := m.settings.Int(SettingResourceGuardPercent)
+	if threshold <= 0 {
+		return nil
+	}
+	if open, limit, err := readOpenFiles(); err == nil {
+		if percent := usagePercent(open, limit); percent >= float64(threshold) {
+			return fmt.Errorf("文件描述符即将耗尽(已用 %d/%d)，拒绝启动新的转发器", open, limit)
+		}
+	}
+	if total, available, err := readMemory(); err == nil {
+		if percent := usagePercent(total-min(available, total), total); percent >= float64(threshold) {
+			return fmt.Errorf("内存即将耗尽(可用 %s/%s)，拒绝启动新的转发器", FormatBytes(int64(available)), FormatBytes(int64(total)))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+//go:build linux
+
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// readCPUTimes 读取/proc/stat中全部CPU的累计时间(时钟周期)，空闲时间包括iowait
+func readCPUTimes() (busy, total uint64, err error) {
+	file, err := os.Open("/proc/stat")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		return 0, 0, fmt.Errorf("无法读取/proc/stat")
+	}
+	fields := strings.Fields(scanner.Text())
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return 0, 0, fmt.Errorf("无法识别的/proc/stat格式")
+	}
+	var idle uint64
+	for i, field := range fields[1:] {
+		value, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("无法识别的/proc/stat格式")
+		}
+		// guest和guest_nice已计入user和nice
+		if i >= 8 {
+			break
+		}
+		total += value
+		if i == 3 || i == 4 {
+			idle += value
+		}
+	}
+	return total - idle, total, nil
+}
+
+// readMemory 读取/proc/meminfo中的内存总量和可用量(字节)
+func readMemory() (total, available uint64, err error) {
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	found := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() && found < 2 {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		var target *uint64
+		switch fields[0] {
+		case "MemTotal:":
+			target = &total
+		case "MemAvailable:":
+			target = &available
+		default:
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("无法识别的/proc/meminfo格式")
+		}
+		*target = value * 1024
+		found++
+	}
+	if found < 2 {
+		return 0, 0, fmt.Errorf("/proc/meminfo中缺少MemTotal或MemAvailable")
+	}
+	return total, available, nil
+}
+
+// readDisk 路径所在文件系统的容量和非特权进程可用的空间(字节)
+func readDisk(path string) (total, free uint64, err error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return 0, 0, err
+	}
+	return stat.Blocks * uint64(stat.Bsize), stat.Bavail * uint64(stat.Bsize), nil
+}
+
+// readOpenFiles 本进程打开的文件描述符数和软限制
+func readOpenFiles() (open, limit uint64, err error) {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return 0, 0, err
+	}
+	var rlimit unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &rlimit); err != nil {
+		return 0, 0, err
+	}
+	// 读取目录本身占用一个描述符
+	return uint64(max(len(entries)-1, 0)), rlimit.Cur, nil
+}
@@ -0,0 +1,28 @@
+//go:build !linux
+
+package services
+
+import "errors"
+
+// errHostResourcesUnsupported 非Linux平台不采集主机资源，也不限制启动转发器
+var errHostResourcesUnsupported = errors.New("当前平台不支持采集主机资源")
+
+// readCPUTimes 非Linux平台不支持
+func readCPUTimes() (busy, total uint64, err error) {
+	return 0, 0, errHostResourcesUnsupported
+}
+
+// readMemory 非Linux平台不支持
+func readMemory() (total, available uint64, err error) {
+	return 0, 0, errHostResourcesUnsupported
+}
+
+// readDisk 非Linux平台不支持
+func readDisk(path string) (total, free uint64, err error) {
+	return 0, 0, errHostResourcesUnsupported
+}
+
+// readOpenFiles 非Linux平台不支持
+func readOpenFiles() (open, limit uint64, err error) {
+	return 0, 0, errHostResourcesUnsupported
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"l2tp-manager/internal/database"
+
+	"gorm.io/gorm"
+)
+
+// 幂等键参数
+const (
+	IdempotencyScopeServerCreate = "server_create"
+	IdempotencyScopeAction       = "action"
+	idempotencyKeyTTL            = 24 * time.Hour  // 幂等键的有效期，过期后同一幂等键视为新请求
+	idempotencyPendingTimeout    = 5 * time.Minute // 操作请求处理超过该时间仍未记录响应(如面板中途退出)时允许重新执行
+	idempotencyKeyMaxLength      = 255
+)
+
+// 幂等创建和精确查找的错误
+var (
+	ErrIdempotencyMismatch = errors.New("幂等键已用于内容不同的请求")
+	ErrIdempotencyPending  = errors.New("相同幂等键的请求正在处理，请稍后重试")
+	ErrServerAmbiguous     = errors.New("匹配到多个服务器，请改用external_id或l2tp_port查找")
+)
+
+// IdempotencyOwner 使用幂等键的租户和用户。幂等键只在同一用户的请求之间生效，
+// 其他用户(包括其他租户)使用相同的幂等键视为新请求
+type IdempotencyOwner struct {
+	TenantID uint
+	UserID   uint
+}
+
+// String 保存在幂等键记录中的所有者标识
+func (o IdempotencyOwner) String() string {
+	return fmt.Sprintf("%d:%d", o.TenantID, o.UserID)
+}
+
+// HashRequest 计算请求内容的摘要，用于判断重试的请求与首次请求是否一致
+func HashRequest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateServerIdempotent 带幂等键创建服务器：有效期内同一幂等键的重试返回首次创建的服务器(replayed为true)，
+// 幂等键已用于内容不同的请求时返回ErrIdempotencyMismatch。key为空时等同于CreateServer
+func (s *L2TPService) CreateServerIdempotent(server *database.L2TPServer, owner IdempotencyOwner, key, requestHash string) (replayed bool, err error) {
+	if key == "" {
+		return false, s.CreateServer(server)
+	}
+	if len(key) > idempotencyKeyMaxLength {
+		return false, fmt.Errorf("幂等键不能超过%d个字符", idempotencyKeyMaxLength)
+	}
+
+	if replayed, err := s.replayServerCreate(server, owner, key, requestHash); replayed || err != nil {
+		return replayed, err
+	}
+	if err := s.credentials.fill(server, nil); err != nil {
+		return false, err
+	}
+
+	portMutex.Lock()
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// 清除同一幂等键的过期记录，之后按新请求处理
+		if err := tx.Where("scope = ? AND owner = ? AND idempotency_key = ? AND created_at < ?",
+			IdempotencyScopeServerCreate, owner.String(), key, time.Now().Add(-idempotencyKeyTTL)).
+			Delete(&database.IdempotencyKey{}).Error; err != nil {
+			return err
+		}
+		if err := createServer(tx, server); err != nil {
+			return err
+		}
+		return tx.Create(&database.IdempotencyKey{
+			Scope:       IdempotencyScopeServerCreate,
+			Owner:       owner.String(),
+			Key:         key,
+			RequestHash: requestHash,
+			ResourceID:  server.ID,
+		}).Error
+	})
+	portMutex.Unlock()
+	if err != nil {
+		// 并发的相同请求已先完成创建(幂等键唯一索引冲突)，返回其结果
+		if replayed, replayErr := s.replayServerCreate(server, owner, key, requestHash); replayed || replayErr != nil {
+			return replayed, replayErr
+		}
+		return false, err
+	}
+	s.serverCreated(server)
+	return false, nil
+}
+
+// replayServerCreate 查找该用户有效期内的幂等键记录，存在时将首次创建的服务器写入server。
+// 首次创建的服务器已删除或不再属于该租户时删除记录，按新请求处理
+func (s *L2TPService) replayServerCreate(server *database.L2TPServer, owner IdempotencyOwner, key, requestHash string) (bool, error) {
+	var record database.IdempotencyKey
+	result := s.db.Where("scope = ? AND owner = ? AND idempotency_key = ? AND created_at >= ?",
+		IdempotencyScopeServerCreate, owner.String(), key, time.Now().Add(-idempotencyKeyTTL)).Limit(1).Find(&record)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	if record.RequestHash != requestHash {
+		return false, ErrIdempotencyMismatch
+	}
+
+	var existing database.L2TPServer
+	result = s.db.Scopes(TenantServers(owner.TenantID)).Limit(1).Find(&existing, record.ResourceID)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, s.db.Delete(&database.IdempotencyKey{}, record.ID).Error
+	}
+	existing.IsExpired = time.Now().After(existing.ExpireDate)
+	*server = existing
+	return true, nil
+}
+
+// IdempotentResponse 幂等操作请求首次的响应
+type IdempotentResponse struct {
+	Status int
+	Body   []byte
+}
+
+// BeginIdempotentAction 开始处理带幂等键的操作请求：有效期内同一幂等键已有响应时返回该响应，由调用方原样返回；
+// 否则登记幂等键并返回nil，调用方执行操作后以FinishIdempotentAction记录响应。
+// 同一幂等键的请求仍在处理时返回ErrIdempotencyPending，已用于内容不同的请求时返回ErrIdempotencyMismatch
+func (s *L2TPService) BeginIdempotentAction(owner IdempotencyOwner, key, requestHash string) (*IdempotentResponse, error) {
+	if len(key) > idempotencyKeyMaxLength {
+		return nil, fmt.Errorf("幂等键不能超过%d个字符", idempotencyKeyMaxLength)
+	}
+
+	var record database.IdempotencyKey
+	result := s.db.Where("scope = ? AND owner = ? AND idempotency_key = ?", IdempotencyScopeAction, owner.String(), key).Limit(1).Find(&record)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected > 0 {
+		expired := time.Since(record.CreatedAt) >= idempotencyKeyTTL ||
+			(record.ResponseStatus == 0 && time.Since(record.CreatedAt) >= idempotencyPendingTimeout)
+		if !expired {
+			if record.RequestHash != requestHash {
+				return nil, ErrIdempotencyMismatch
+			}
+			if record.ResponseStatus == 0 {
+				return nil, ErrIdempotencyPending
+			}
+			return &IdempotentResponse{Status: record.ResponseStatus, Body: record.ResponseBody}, nil
+		}
+		// 过期或处理中断的记录按新请求处理
+		if err := s.db.Delete(&database.IdempotencyKey{}, record.ID).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.db.Create(&database.IdempotencyKey{
+		Scope:       IdempotencyScopeAction,
+		Owner:       owner.String(),
+		Key:         key,
+		RequestHash: requestHash,
+	}).Error; err != nil {
+		// 并发的相同请求已先登记(幂等键唯一索引冲突)
+		var existing database.IdempotencyKey
+		if s.db.Where("scope = ? AND owner = ? AND idempotency_key = ?", IdempotencyScopeAction, owner.String(), key).Limit(1).Find(&existing).RowsAffected > 0 {
+			if existing.RequestHash != requestHash {
+				return nil, ErrIdempotencyMismatch
+			}
+			return nil, ErrIdempotencyPending
+		}
+		return nil, err
+	}
+	return nil, nil
+}
+
+// FinishIdempotentAction 记录操作请求的响应，之后同一幂等键的重试返回该响应。
+// 服务端错误(5xx)和限流(429)不记录，删除幂等键以便重试时重新执行
+func (s *L2TPService) FinishIdempotentAction(owner IdempotencyOwner, key string, status int, body []byte) error {
+	query := s.db.Where("scope = ? AND owner = ? AND idempotency_key = ? AND response_status = 0", IdempotencyScopeAction, owner.String(), key)
+	if status >= 500 || status == 429 {
+		return query.Delete(&database.IdempotencyKey{}).Error
+	}
+	return query.Model(&database.IdempotencyKey{}).Updates(map[string]interface{}{
+		"response_status": status,
+		"response_body":   body,
+	}).Error
+}
+
+// PurgeIdempotencyKeys 删除过期的幂等键记录
+func (s *L2TPService) PurgeIdempotencyKeys() (int64, error) {
+	result := s.db.Where("created_at < ?", time.Now().Add(-idempotencyKeyTTL)).Delete(&database.IdempotencyKey{})
+	return result.RowsAffected, result.Error
+}
+
+// ServerLookup 精确查找服务器的条件，多个条件同时满足
+type ServerLookup struct {
+	ExternalID string
+	Name       string
+	L2TPPort   int
+	TenantID   uint // 只在该租户的服务器中查找，0表示不限
+}
+
+// LookupServer 按外部ID、名称或中转端口精确查找唯一的服务器，供IaC工具按声明的属性读取资源。
+// 未匹配时返回gorm.ErrRecordNotFound，匹配到多个时返回ErrServerAmbiguous
+func (s *L2TPService) LookupServer(lookup ServerLookup) (*database.L2TPServer, error) {
+	query := s.db.Model(&database.L2TPServer{}).Scopes(TenantServers(lookup.TenantID))
+	if lookup.ExternalID != "" {
+		query = query.Where("external_id = ?", lookup.ExternalID)
+	}
+	if lookup.Name != "" {
+		query = query.Where("name = ?", lookup.Name)
+	}
+	if lookup.L2TPPort != 0 {
+		query = query.Where("l2tp_port = ?", lookup.L2TPPort)
+	}
+	if lookup.ExternalID == "" && lookup.Name == "" && lookup.L2TPPort == 0 {
+		return nil, fmt.Errorf("请至少指定external_id、name或l2tp_port之一")
+	}
+
+	var servers []database.L2TPServer
+	if err := query.Order("id").Limit(2).Find(&servers).Error; err != nil {
+		return nil, err
+	}
+	switch len(servers) {
+	case 0:
+		return nil, gorm.ErrRecordNotFound
+	case 1:
+		servers[0].IsExpired = time.Now().After(servers[0].ExpireDate)
+		return &servers[0], nil
+	default:
+		return nil, ErrServerAmbiguous
+	}
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+
+	"l2tp-manager/internal/database"
+
+	"gorm.io/gorm"
+)
+
+// newTestDB 创建临时的SQLite数据库
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := database.Initialize("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func TestCreateServerIdempotentScopedToOwner(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.Create(&database.Tenant{ID: 5, Name: "tenant"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	service := NewL2TPService(db, nil, nil)
+
+	admin := IdempotencyOwner{UserID: 1}
+	tenantUser := IdempotencyOwner{TenantID: 5, UserID: 7}
+	otherTenantUser := IdempotencyOwner{TenantID: 5, UserID: 8}
+	const key, hash = "same-key", "same-hash"
+
+	create := func(owner IdempotencyOwner, port int) (*database.L2TPServer, bool) {
+		t.Helper()
+		server := &database.L2TPServer{
+			Name:     "server",
+			Host:     "192.0.2.1",
+			Username: "root",
+			Password: "secret-password",
+			L2TPPort: port,
+			TenantID: owner.TenantID,
+		}
+		replayed, err := service.CreateServerIdempotent(server, owner, key, hash)
+		if err != nil {
+			t.Fatalf("创建服务器失败: %v", err)
+		}
+		return server, replayed
+	}
+
+	adminServer, replayed := create(admin, 20001)
+	if replayed {
+		t.Fatal("首次创建不应为重放")
+	}
+
+	tests := []struct {
+		name         string
+		owner        IdempotencyOwner
+		port         int
+		wantReplayed bool
+		wantServerID uint // 为0时要求创建了新的服务器
+	}{
+		{"同一用户重试返回首次创建的服务器", admin, 20001, true, adminServer.ID},
+		{"租户用户使用相同幂等键视为新请求", tenantUser, 20002, false, 0},
+		{"同一租户的其他用户使用相同幂等键视为新请求", otherTenantUser, 20003, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, replayed := create(tt.owner, tt.port)
+			if replayed != tt.wantReplayed {
+				t.Fatalf("replayed = %v, 期望 %v", replayed, tt.wantReplayed)
+			}
+			if tt.wantServerID != 0 && server.ID != tt.wantServerID {
+				t.Fatalf("服务器ID = %d, 期望 %d", server.ID, tt.wantServerID)
+			}
+			if tt.wantServerID == 0 && (server.ID == adminServer.ID || server.TenantID != tt.owner.TenantID) {
+				t.Fatalf("返回了其他用户的服务器 %d (租户 %d)", server.ID, server.TenantID)
+			}
+		})
+	}
+}
+
+func TestCreateServerIdempotentMissingServerIsNewRequest(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.Create(&database.Tenant{ID: 5, Name: "tenant"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	service := NewL2TPService(db, nil, nil)
+	owner := IdempotencyOwner{TenantID: 5, UserID: 7}
+
+	first := &database.L2TPServer{Name: "first", Host: "192.0.2.1", Username: "root", Password: "secret-password", L2TPPort: 20001, TenantID: 5}
+	if _, err := service.CreateServerIdempotent(first, owner, "key", "hash"); err != nil {
+		t.Fatal(err)
+	}
+	// 服务器被收回到平台后，租户用户的重试不能再拿到该服务器
+	if err := db.Model(&database.L2TPServer{}).Where("id = ?", first.ID).Update("tenant_id", 0).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	retry := &database.L2TPServer{Name: "retry", Host: "192.0.2.1", Username: "root", Password: "secret-password", L2TPPort: 20002, TenantID: 5}
+	replayed, err := service.CreateServerIdempotent(retry, owner, "key", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed || retry.ID == first.ID {
+		t.Fatalf("未找到首次创建的服务器时应按新请求处理，replayed = %v, id = %d", replayed, retry.ID)
+	}
+}
@@ -0,0 +1,432 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+
+	"l2tp-manager/internal/database"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// IKEv2落地机配置，容器内使用strongSwan(swanctl)
+const (
+	ikev2ContainerName = "ikev2-server"
+	ikev2Image         = "alpine:3.20" // 容器启动时通过apk安装strongSwan
+
+	ikev2ConfigDir   = "/etc/l2tp-manager/ikev2" // 落地机上的配置目录，挂载到容器的/etc/swanctl
+	ikev2Pool        = "10.10.10.0/24"
+	ikev2ClientDNS   = "1.1.1.1"
+	ikev2Connection  = "ikev2"
+	ikev2Proposals   = "aes256gcm16-prfsha256-ecp256,aes256-sha256-ecp256,aes256-sha256-modp2048,aes256-sha1-modp1024,default"
+	ikev2ESPProposal = "aes256gcm16,aes256-sha256,aes256-sha1,default"
+)
+
+// IKEv2客户端配置文件格式
+const (
+	IKEv2ProfileMobileConfig = "mobileconfig" // iOS/macOS描述文件
+	IKEv2ProfileSSwan        = "sswan"        // strongSwan Android客户端
+	IKEv2ProfileP12          = "p12"          // 客户端证书(Windows等手动导入)，仅证书认证
+)
+
+// ikev2IdentityPattern 服务端标识：中转机的域名或IP地址
+var ikev2IdentityPattern = regexp.MustCompile(`^[A-Za-z0-9.:-]{1,253}$`)
+
+// syncIKEv2Certs 服务端标识变更时使用原CA重新签发服务端证书；证书认证时为每个用户签发客户端证书，
+// 已删除用户的证书加入吊销列表。EAP认证时不保留客户端证书
+func syncIKEv2Certs(pki *ServerPKI, server *database.L2TPServer) error {
+	ca, caKey, err := pki.loadCA()
+	if err != nil {
+		return err
+	}
+
+	serverCert, err := decodeCert(pki.ServerCert)
+	if err != nil {
+		return err
+	}
+	if serverCert.VerifyHostname(server.IKEv2Identity) != nil {
+		cert, key, err := issueServerCert(ca, caKey, server.IKEv2Identity, server.IKEv2Identity)
+		if err != nil {
+			return fmt.Errorf("生成服务端证书失败: %v", err)
+		}
+		pki.ServerCert, pki.ServerKey = encodeCert(cert), encodeKey(key)
+	}
+
+	var users []L2TPUser
+	if server.Users != "" {
+		if err := json.Unmarshal([]byte(server.Users), &users); err != nil {
+			return fmt.Errorf("解析用户配置失败: %v", err)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, user := range users {
+		if !clientNamePattern.MatchString(user.Username) {
+			return fmt.Errorf("IKEv2用户名 %q 只能包含字母、数字和 . _ @ -，且不超过64个字符", user.Username)
+		}
+		if seen[user.Username] {
+			return fmt.Errorf("用户名 %s 重复", user.Username)
+		}
+		seen[user.Username] = true
+	}
+	if server.IKEv2Auth != IKEv2AuthCert {
+		seen = nil
+	}
+
+	clients := make([]PKIClient, 0, len(users))
+	for _, client := range pki.Clients {
+		if seen[client.Name] {
+			clients = append(clients, client)
+			delete(seen, client.Name)
+			continue
+		}
+		if cert, err := decodeCert(client.Cert); err == nil {
+			pki.Revoked = append(pki.Revoked, cert.SerialNumber.Text(16))
+		}
+	}
+	for _, user := range users {
+		if !seen[user.Username] {
+			continue
+		}
+		cert, key, err := issueClientCert(ca, caKey, user.Username)
+		if err != nil {
+			return fmt.Errorf("生成客户端证书失败: %v", err)
+		}
+		clients = append(clients, PKIClient{Name: user.Username, Cert: encodeCert(cert), Key: encodeKey(key)})
+	}
+	pki.Clients = clients
+	return nil
+}
+
+// ikev2SwanctlConfig 生成swanctl配置，EAP认证时包含用户密码(base64编码，避免转义问题)
+func ikev2SwanctlConfig(server *database.L2TPServer, users []L2TPUser) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "connections {\n\t%s {\n", ikev2Connection)
+	b.WriteString("\t\tversion = 2\n")
+	fmt.Fprintf(&b, "\t\tproposals = %s\n", ikev2Proposals)
+	b.WriteString("\t\tpools = clients\n\t\tsend_cert = always\n\t\tfragmentation = yes\n\t\tunique = never\n\t\tdpd_delay = 300s\n")
+	fmt.Fprintf(&b, "\t\tlocal {\n\t\t\tauth = pubkey\n\t\t\tcerts = server.crt\n\t\t\tid = %s\n\t\t}\n", server.IKEv2Identity)
+	if server.IKEv2Auth == IKEv2AuthCert {
+		b.WriteString("\t\tremote {\n\t\t\tauth = pubkey\n\t\t\tcacerts = ca.crt\n\t\t}\n")
+	} else {
+		b.WriteString("\t\tremote {\n\t\t\tauth = eap-mschapv2\n\t\t\teap_id = %any\n\t\t}\n")
+	}
+	fmt.Fprintf(&b, "\t\tchildren {\n\t\t\t%s {\n\t\t\t\tlocal_ts = 0.0.0.0/0\n\t\t\t\tesp_proposals = %s\n\t\t\t\tdpd_action = clear\n\t\t\t}\n\t\t}\n", ikev2Connection, ikev2ESPProposal)
+	b.WriteString("\t}\n}\n\n")
+
+	fmt.Fprintf(&b, "pools {\n\tclients {\n\t\taddrs = %s\n\t\tdns = %s\n\t}\n}\n", ikev2Pool, strings.Join(clientDNS(server, ikev2ClientDNS), ", "))
+
+	if server.IKEv2Auth != IKEv2AuthCert {
+		if len(users) == 0 {
+			users = []L2TPUser{{Username: "test", Password: "test123"}}
+		}
+		b.WriteString("\nsecrets {\n")
+		for i, user := range users {
+			fmt.Fprintf(&b, "\teap-%d {\n\t\tid = %s\n\t\tsecret = 0s%s\n\t}\n", i, user.Username, base64.StdEncoding.EncodeToString([]byte(user.Password)))
+		}
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
+
+// ikev2CharonConfig charon的全局设置，目前只有NAT穿越保活间隔
+func ikev2CharonConfig(server *database.L2TPServer) string {
+	return fmt.Sprintf("charon {\n\tkeep_alive = %ds\n}\n", natKeepalive(server))
+}
+
+// ikev2RunScript 容器启动脚本：安装strongSwan，日志输出到标准错误供docker logs读取，
+// 复制charon的全局设置，启动charon后加载配置
+var ikev2RunScript = fmt.Sprintf(`#!/bin/sh
+apk add --no-cache strongswan iptables >/dev/null || exit 1
+cat > /etc/strongswan.d/charon-logging.conf <<'EOF'
+charon {
+	filelog {
+		stderr {
+			default = 1
+			ike_name = yes
+		}
+	}
+}
+EOF
+cp /etc/swanctl/charon.conf /etc/strongswan.d/charon-panel.conf
+iptables -t nat -C POSTROUTING -s %[1]s -j MASQUERADE 2>/dev/null || iptables -t nat -A POSTROUTING -s %[1]s -j MASQUERADE
+iptables -t mangle -C FORWARD -s %[1]s -p tcp --tcp-flags SYN,RST SYN -j TCPMSS --set-mss 1360 2>/dev/null || iptables -t mangle -A FORWARD -s %[1]s -p tcp --tcp-flags SYN,RST SYN -j TCPMSS --set-mss 1360
+/usr/lib/strongswan/charon &
+charon=$!
+for i in $(seq 1 20); do [ -S /var/run/charon.vici ] && break; sleep 0.5; done
+swanctl --load-all --noprompt || exit 1
+wait $charon
+`, ikev2Pool)
+
+// ikev2ConfigFiles swanctl配置、证书、CRL和启动脚本，按swanctl的目录结构写入落地机的配置目录
+func ikev2ConfigFiles(server *database.L2TPServer, users []L2TPUser) ([]remoteFile, error) {
+	pki, err := parsePKI(server.PKI)
+	if err != nil {
+		return nil, err
+	}
+	crl, err := pki.revokedCRL()
+	if err != nil {
+		return nil, fmt.Errorf("生成证书吊销列表失败: %v", err)
+	}
+	return []remoteFile{
+		{"swanctl.conf", ikev2SwanctlConfig(server, users), "600"},
+		{"charon.conf", ikev2CharonConfig(server), "644"},
+		{"x509ca/ca.crt", pki.CACert, "644"},
+		{"x509/server.crt", pki.ServerCert, "644"},
+		{"pkcs8/server.key", pki.ServerKey, "600"},
+		{"x509crl/ca.crl", crl, "644"},
+		{"run.sh", ikev2RunScript, "755"},
+	}, nil
+}
+
+// ikev2RunCommand 构建启动IKEv2容器的docker run命令
+func ikev2RunCommand() string {
+	return fmt.Sprintf(`docker run -d \
+		--name %s \
+		--restart always \
+		-p %d:%d/udp \
+		-p %d:%d/udp \
+		--cap-add NET_ADMIN \
+		-v /lib/modules:/lib/modules:ro \
+		--sysctl net.ipv4.ip_forward=1 \
+		-v %s:/etc/swanctl \
+		%s sh /etc/swanctl/run.sh`,
+		ikev2ContainerName,
+		IKEv2ContainerPort, IKEv2ContainerPort,
+		IKEv2NATContainerPort, IKEv2NATContainerPort,
+		ikev2ConfigDir,
+		ikev2Image)
+}
+
+// ikev2Clients 统计已建立的IKE SA数量
+func (s *SSHService) ikev2Clients(client *ssh.Client) (int, error) {
+	output, err := s.executeCommand(client, fmt.Sprintf("docker exec %s swanctl --list-sas --ike %s", ikev2ContainerName, ikev2Connection))
+	if err != nil {
+		return 0, fmt.Errorf("获取会话列表失败: %v", err)
+	}
+	return strings.Count(output, ", ESTABLISHED,"), nil
+}
+
+// IKEv2CA 返回IKEv2服务器的CA证书(PEM格式)，客户端需要信任该证书以验证服务端
+func (s *L2TPService) IKEv2CA(id uint) (string, error) {
+	server, err := s.GetServer(id)
+	if err != nil {
+		return "", err
+	}
+	if server.Type != ServerTypeIKEv2 {
+		return "", fmt.Errorf("服务器不是IKEv2类型")
+	}
+	pki, err := parsePKI(server.PKI)
+	if err != nil {
+		return "", err
+	}
+	return pki.CACert, nil
+}
+
+// IKEv2Profile 生成用户的客户端配置文件，返回文件内容和扩展名。endpointHost为客户端连接的中转机地址
+func (s *L2TPService) IKEv2Profile(id uint, username, format, endpointHost string) ([]byte, string, error) {
+	server, err := s.GetServer(id)
+	if err != nil {
+		return nil, "", err
+	}
+	if server.Type != ServerTypeIKEv2 {
+		return nil, "", fmt.Errorf("服务器不是IKEv2类型")
+	}
+	users, err := s.ParseUsers(server.Users)
+	if err != nil {
+		return nil, "", err
+	}
+	var user *L2TPUser
+	for i := range users {
+		if users[i].Username == username {
+			user = &users[i]
+		}
+	}
+	if user == nil {
+		return nil, "", fmt.Errorf("用户 %s 不存在", username)
+	}
+	pki, err := parsePKI(server.PKI)
+	if err != nil {
+		return nil, "", err
+	}
+	ca, err := decodeCert(pki.CACert)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// 证书认证时生成包含客户端证书的PKCS#12，口令为用户密码
+	var p12 []byte
+	if server.IKEv2Auth == IKEv2AuthCert {
+		for _, client := range pki.Clients {
+			if client.Name != username {
+				continue
+			}
+			cert, err := decodeCert(client.Cert)
+			if err != nil {
+				return nil, "", err
+			}
+			key, err := decodeKey(client.Key)
+			if err != nil {
+				return nil, "", err
+			}
+			if p12, err = encodePKCS12(cert, key, ca, user.Password, username); err != nil {
+				return nil, "", fmt.Errorf("生成PKCS#12失败: %v", err)
+			}
+		}
+		if p12 == nil {
+			return nil, "", fmt.Errorf("用户 %s 的客户端证书尚未生成", username)
+		}
+	}
+
+	switch format {
+	case IKEv2ProfileMobileConfig, "":
+		return ikev2MobileConfig(server, user, ca.Raw, ca.Subject.CommonName, p12, endpointHost), "mobileconfig", nil
+	case IKEv2ProfileSSwan:
+		data, err := ikev2SSwanProfile(server, user, ca.Raw, p12, endpointHost)
+		return data, "sswan", err
+	case IKEv2ProfileP12:
+		if p12 == nil {
+			return nil, "", fmt.Errorf("EAP认证的服务器没有客户端证书")
+		}
+		return p12, "p12", nil
+	default:
+		return nil, "", fmt.Errorf("不支持的配置文件格式: %s", format)
+	}
+}
+
+// ikev2MobileConfig 生成iOS/macOS描述文件。iOS和macOS的IKEv2客户端只能连接UDP 500/4500端口
+func ikev2MobileConfig(server *database.L2TPServer, user *L2TPUser, caDER []byte, caName string, p12 []byte, endpointHost string) []byte {
+	identifier := fmt.Sprintf("l2tp-manager.%s.%s", server.ExternalID, user.Username)
+	profileUUID := stableUUID(identifier)
+	vpnUUID := stableUUID(identifier + ".vpn")
+	caUUID := stableUUID(identifier + ".ca")
+	certUUID := stableUUID(identifier + ".cert")
+	displayName := fmt.Sprintf("%s (%s)", server.Name, user.Username)
+	str := html.EscapeString
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>PayloadContent</key>
+	<array>
+		<dict>
+			<key>IKEv2</key>
+			<dict>
+`)
+	fmt.Fprintf(&b, "\t\t\t\t<key>RemoteAddress</key>\n\t\t\t\t<string>%s</string>\n", str(endpointHost))
+	fmt.Fprintf(&b, "\t\t\t\t<key>RemoteIdentifier</key>\n\t\t\t\t<string>%s</string>\n", str(server.IKEv2Identity))
+	fmt.Fprintf(&b, "\t\t\t\t<key>LocalIdentifier</key>\n\t\t\t\t<string>%s</string>\n", str(user.Username))
+	fmt.Fprintf(&b, "\t\t\t\t<key>ServerCertificateIssuerCommonName</key>\n\t\t\t\t<string>%s</string>\n", str(caName))
+	fmt.Fprintf(&b, "\t\t\t\t<key>ServerCertificateCommonName</key>\n\t\t\t\t<string>%s</string>\n", str(server.IKEv2Identity))
+	b.WriteString("\t\t\t\t<key>CertificateType</key>\n\t\t\t\t<string>ECDSA256</string>\n")
+	if p12 != nil {
+		b.WriteString("\t\t\t\t<key>AuthenticationMethod</key>\n\t\t\t\t<string>Certificate</string>\n")
+		fmt.Fprintf(&b, "\t\t\t\t<key>PayloadCertificateUUID</key>\n\t\t\t\t<string>%s</string>\n", certUUID)
+	} else {
+		b.WriteString("\t\t\t\t<key>AuthenticationMethod</key>\n\t\t\t\t<string>None</string>\n")
+		b.WriteString("\t\t\t\t<key>ExtendedAuthEnabled</key>\n\t\t\t\t<integer>1</integer>\n")
+		fmt.Fprintf(&b, "\t\t\t\t<key>AuthName</key>\n\t\t\t\t<string>%s</string>\n", str(user.Username))
+		fmt.Fprintf(&b, "\t\t\t\t<key>AuthPassword</key>\n\t\t\t\t<string>%s</string>\n", str(user.Password))
+	}
+	for _, key := range []string{"IKESecurityAssociationParameters", "ChildSecurityAssociationParameters"} {
+		fmt.Fprintf(&b, "\t\t\t\t<key>%s</key>\n\t\t\t\t<dict>\n", key)
+		b.WriteString("\t\t\t\t\t<key>EncryptionAlgorithm</key>\n\t\t\t\t\t<string>AES-256-GCM</string>\n")
+		b.WriteString("\t\t\t\t\t<key>IntegrityAlgorithm</key>\n\t\t\t\t\t<string>SHA2-256</string>\n")
+		b.WriteString("\t\t\t\t\t<key>DiffieHellmanGroup</key>\n\t\t\t\t\t<integer>19</integer>\n")
+		b.WriteString("\t\t\t\t</dict>\n")
+	}
+	b.WriteString("\t\t\t</dict>\n")
+	// 设置了DNS服务器时写入描述文件，有分流域名时只有匹配的查询使用这些DNS服务器
+	if servers := clientDNS(server); len(servers) > 0 {
+		b.WriteString("\t\t\t<key>DNS</key>\n\t\t\t<dict>\n\t\t\t\t<key>ServerAddresses</key>\n\t\t\t\t<array>\n")
+		for _, dns := range servers {
+			fmt.Fprintf(&b, "\t\t\t\t\t<string>%s</string>\n", dns)
+		}
+		b.WriteString("\t\t\t\t</array>\n")
+		if domains := parseDNSDomains(server.DNSDomains); len(domains) > 0 {
+			b.WriteString("\t\t\t\t<key>SupplementalMatchDomains</key>\n\t\t\t\t<array>\n")
+			for _, domain := range domains {
+				fmt.Fprintf(&b, "\t\t\t\t\t<string>%s</string>\n", domain)
+			}
+			b.WriteString("\t\t\t\t</array>\n")
+		}
+		b.WriteString("\t\t\t</dict>\n")
+	}
+	b.WriteString(plistPayload("com.apple.vpn.managed", identifier+".vpn", vpnUUID, displayName))
+	fmt.Fprintf(&b, "\t\t\t<key>UserDefinedName</key>\n\t\t\t<string>%s</string>\n", str(displayName))
+	b.WriteString("\t\t\t<key>VPNType</key>\n\t\t\t<string>IKEv2</string>\n")
+	b.WriteString("\t\t</dict>\n")
+
+	b.WriteString("\t\t<dict>\n")
+	fmt.Fprintf(&b, "\t\t\t<key>PayloadContent</key>\n\t\t\t<data>%s</data>\n", base64.StdEncoding.EncodeToString(caDER))
+	b.WriteString(plistPayload("com.apple.security.root", identifier+".ca", caUUID, caName))
+	b.WriteString("\t\t</dict>\n")
+
+	if p12 != nil {
+		b.WriteString("\t\t<dict>\n")
+		fmt.Fprintf(&b, "\t\t\t<key>PayloadContent</key>\n\t\t\t<data>%s</data>\n", base64.StdEncoding.EncodeToString(p12))
+		fmt.Fprintf(&b, "\t\t\t<key>Password</key>\n\t\t\t<string>%s</string>\n", str(user.Password))
+		b.WriteString(plistPayload("com.apple.security.pkcs12", identifier+".cert", certUUID, user.Username))
+		b.WriteString("\t\t</dict>\n")
+	}
+
+	b.WriteString("\t</array>\n")
+	fmt.Fprintf(&b, "\t<key>PayloadDisplayName</key>\n\t<string>%s</string>\n", str(displayName))
+	fmt.Fprintf(&b, "\t<key>PayloadIdentifier</key>\n\t<string>%s</string>\n", str(identifier))
+	b.WriteString("\t<key>PayloadType</key>\n\t<string>Configuration</string>\n")
+	fmt.Fprintf(&b, "\t<key>PayloadUUID</key>\n\t<string>%s</string>\n", profileUUID)
+	b.WriteString("\t<key>PayloadVersion</key>\n\t<integer>1</integer>\n")
+	b.WriteString("</dict>\n</plist>\n")
+	return []byte(b.String())
+}
+
+// plistPayload 描述文件中各负载的公共字段
+func plistPayload(payloadType, identifier, uuid, displayName string) string {
+	return fmt.Sprintf("\t\t\t<key>PayloadDisplayName</key>\n\t\t\t<string>%s</string>\n"+
+		"\t\t\t<key>PayloadIdentifier</key>\n\t\t\t<string>%s</string>\n"+
+		"\t\t\t<key>PayloadType</key>\n\t\t\t<string>%s</string>\n"+
+		"\t\t\t<key>PayloadUUID</key>\n\t\t\t<string>%s</string>\n"+
+		"\t\t\t<key>PayloadVersion</key>\n\t\t\t<integer>1</integer>\n",
+		html.EscapeString(displayName), html.EscapeString(identifier), payloadType, uuid)
+}
+
+// stableUUID 由标识符派生固定的UUID，重新下载的描述文件会替换已安装的同一描述文件
+func stableUUID(identifier string) string {
+	sum := sha256.Sum256([]byte(identifier))
+	sum[6] = (sum[6] & 0x0f) | 0x50
+	sum[8] = (sum[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%X-%X-%X-%X-%X", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// ikev2SSwanProfile 生成strongSwan Android客户端的配置文件，可使用非标准端口
+func ikev2SSwanProfile(server *database.L2TPServer, user *L2TPUser, caDER, p12 []byte, endpointHost string) ([]byte, error) {
+	remote := map[string]interface{}{
+		"addr": endpointHost,
+		"id":   server.IKEv2Identity,
+		"cert": base64.StdEncoding.EncodeToString(caDER),
+	}
+	if server.L2TPPort != IKEv2ContainerPort {
+		remote["port"] = server.L2TPPort
+	}
+	profile := map[string]interface{}{
+		"uuid":   strings.ToLower(stableUUID(fmt.Sprintf("l2tp-manager.%s.%s", server.ExternalID, user.Username))),
+		"name":   fmt.Sprintf("%s (%s)", server.Name, user.Username),
+		"type":   "ikev2-eap",
+		"remote": remote,
+		"local":  map[string]interface{}{"eap_id": user.Username},
+	}
+	if p12 != nil {
+		profile["type"] = "ikev2-cert"
+		profile["local"] = map[string]interface{}{
+			"id":  user.Username,
+			"p12": base64.StdEncoding.EncodeToString(p12),
+		}
+	}
+	return json.MarshalIndent(profile, "", "  ")
+}
@@ -0,0 +1,487 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"l2tp-manager/internal/database"
+	"l2tp-manager/internal/metrics"
+
+	"gorm.io/gorm"
+)
+
+// 镜像更新检查与滚动升级
+const (
+	imageCheckInterval   = 6 * time.Hour
+	rolloutDefaultSettle = 10 * time.Second // 每批重建后等待容器稳定再检查的时长
+	rolloutMaxSettle     = 10 * time.Minute
+)
+
+// 滚动升级中单台服务器的状态
+const (
+	RolloutServerPending   = "pending"
+	RolloutServerUpgrading = "upgrading"
+	RolloutServerSucceeded = "succeeded"
+	RolloutServerFailed    = "failed"
+	RolloutServerSkipped   = "skipped" // 之前的批次失败，未执行
+)
+
+// manifestAccept 查询镜像摘要时接受的清单类型，多架构镜像返回清单列表的摘要，与docker pull记录的RepoDigests一致
+var manifestAccept = strings.Join([]string{
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+}, ", ")
+
+// ServerImageStatus 服务器的镜像更新检查结果
+type ServerImageStatus struct {
+	database.ServerImage
+	ServerName string `json:"server_name"`
+}
+
+// RolloutRequest 滚动升级参数
+type RolloutRequest struct {
+	ServerIDs     []uint `json:"server_ids"`                     // 为空时升级全部有可用更新的服务器
+	BatchSize     int    `json:"batch_size" binding:"gte=0"`     // 每批同时重建的服务器数量，默认1
+	SettleSeconds int    `json:"settle_seconds" binding:"gte=0"` // 每批重建后等待多久再检查健康状态，默认10秒
+}
+
+// RolloutServer 滚动升级中的一台服务器
+type RolloutServer struct {
+	ServerID uint   `json:"server_id"`
+	Name     string `json:"name"`
+	Batch    int    `json:"batch"` // 所在批次，从1开始
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Rollout 一次滚动升级
+type Rollout struct {
+	ID         string          `json:"id"`
+	Status     string          `json:"status"` // running/succeeded/failed
+	BatchSize  int             `json:"batch_size"`
+	Batch      int             `json:"batch"` // 正在执行的批次
+	Batches    int             `json:"batches"`
+	Servers    []RolloutServer `json:"servers"`
+	Username   string          `json:"username"`
+	StartedAt  time.Time       `json:"started_at"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+}
+
+// ImageService 定期检查落地机容器镜像在镜像仓库中是否有新的摘要(同一标签重新发布)，
+// 并按批次滚动重建容器完成升级，每批重建后确认容器健康再继续下一批
+type ImageService struct {
+	db          *gorm.DB
+	l2tpService *L2TPService
+	registryURL string
+	client      *http.Client
+
+	checking sync.Mutex
+	mutex    sync.Mutex
+	rollout  *Rollout // 最近一次滚动升级
+}
+
+// NewImageService 创建镜像更新服务，registryURL为镜像名未包含仓库地址时使用的镜像仓库
+func NewImageService(db *gorm.DB, l2tpService *L2TPService, registryURL string) *ImageService {
+	return &ImageService{
+		db:          db,
+		l2tpService: l2tpService,
+		registryURL: strings.TrimRight(registryURL, "/"),
+		client:      &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Start 启动定期检查
+func (i *ImageService) Start(ctx context.Context) {
+	ticker := time.NewTicker(imageCheckInterval)
+	defer ticker.Stop()
+	slog.Info("镜像更新检查已启动", "interval", imageCheckInterval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := i.Check(ctx); err != nil {
+				slog.Error("检查镜像更新失败", "error", err)
+			}
+		}
+	}
+}
+
+// parseImageRef 解析镜像名为仓库地址、仓库路径和标签，未包含仓库地址时使用defaultRegistry，
+// Docker Hub的官方镜像补全library/前缀
+func parseImageRef(image, defaultRegistry string) (registry, repository, tag string) {
+	repository, tag = image, "latest"
+	if colon := strings.LastIndex(image, ":"); colon > strings.LastIndex(image, "/") {
+		repository, tag = image[:colon], image[colon+1:]
+	}
+	registry = defaultRegistry
+	if first, rest, ok := strings.Cut(repository, "/"); ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		return "https://" + first, rest, tag
+	}
+	if !strings.Contains(repository, "/") {
+		repository = "library/" + repository
+	}
+	return registry, repository, tag
+}
+
+// registryToken 按WWW-Authenticate质询获取匿名拉取令牌
+func (i *ImageService) registryToken(ctx context.Context, challenge string) (string, error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", fmt.Errorf("不支持的认证方式: %s", scheme)
+	}
+	values := url.Values{}
+	var realm string
+	for _, param := range strings.Split(params, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(value, `"`)
+		if key == "realm" {
+			realm = value
+		} else {
+			values.Set(key, value)
+		}
+	}
+	if realm == "" {
+		return "", fmt.Errorf("认证质询缺少realm")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm+"?"+values.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("获取仓库令牌失败: HTTP %d", resp.StatusCode)
+	}
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	return body.AccessToken, nil
+}
+
+// LatestDigest 查询镜像标签在镜像仓库中当前的摘要
+func (i *ImageService) LatestDigest(ctx context.Context, image string) (string, error) {
+	registry, repository, tag := parseImageRef(image, i.registryURL)
+	manifestURL := fmt.Sprintf("%s/v2/%s/manifests/%s", registry, repository, tag)
+
+	var token string
+	for attempt := 0; attempt < 2; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, manifestURL, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Accept", manifestAccept)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := i.client.Do(req)
+		if err != nil {
+			return "", fmt.Errorf("查询镜像仓库失败: %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusUnauthorized && token == "" {
+			if token, err = i.registryToken(ctx, resp.Header.Get("WWW-Authenticate")); err != nil {
+				return "", err
+			}
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("查询镜像 %s 失败: HTTP %d", image, resp.StatusCode)
+		}
+		digest := resp.Header.Get("Docker-Content-Digest")
+		if digest == "" {
+			return "", fmt.Errorf("镜像仓库未返回 %s 的摘要", image)
+		}
+		return digest, nil
+	}
+	return "", fmt.Errorf("镜像仓库认证失败")
+}
+
+// RunningImageDigests 落地机上运行中容器所用镜像的RepoDigests(仓库@sha256:...)
+func (s *SSHService) RunningImageDigests(server *database.L2TPServer) (_ []string, err error) {
+	defer func(start time.Time) { metrics.ObserveSSH("image_digest", start, err) }(time.Now())
+
+	client, err := s.createSSHClient(server)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	containerName := serverContainerName(server)
+	output, err := s.executeCommand(client, fmt.Sprintf("docker image inspect $(docker inspect --format '{{.Image}}' %s) --format '{{json .RepoDigests}}'", containerName))
+	if err != nil {
+		return nil, fmt.Errorf("读取容器镜像失败: %v", err)
+	}
+	var digests []string
+	if err := json.Unmarshal([]byte(strings.TrimSpace(output)), &digests); err != nil {
+		return nil, fmt.Errorf("解析镜像摘要失败: %v", err)
+	}
+	return digests, nil
+}
+
+// Check 检查全部运行中容器类服务器的镜像是否有更新，同一镜像只查询一次镜像仓库
+func (i *ImageService) Check(ctx context.Context) error {
+	if !i.checking.TryLock() {
+		return fmt.Errorf("镜像更新检查正在进行中")
+	}
+	defer i.checking.Unlock()
+
+	var servers []database.L2TPServer
+	if err := i.db.Where("status = ? AND type != ?", "running", ServerTypeWireGuard).Find(&servers).Error; err != nil {
+		return err
+	}
+
+	type latest struct {
+		digest string
+		err    error
+	}
+	latestDigests := make(map[string]latest)
+	for _, server := range servers {
+		image := serverImage(&server)
+		if _, ok := latestDigests[image]; !ok {
+			digest, err := i.LatestDigest(ctx, image)
+			latestDigests[image] = latest{digest, err}
+		}
+	}
+
+	var wg sync.WaitGroup
+	for idx := range servers {
+		wg.Add(1)
+		go func(server *database.L2TPServer) {
+			defer wg.Done()
+			image := serverImage(server)
+			record := database.ServerImage{ServerID: server.ID, Image: image, CheckedAt: time.Now()}
+			latest := latestDigests[image]
+			if latest.err != nil {
+				record.Error = latest.err.Error()
+			} else {
+				record.LatestDigest = latest.digest
+				digests, err := i.l2tpService.SSH().WithContext(ctx).RunningImageDigests(server)
+				if err != nil {
+					record.Error = err.Error()
+				} else {
+					for _, repoDigest := range digests {
+						_, digest, _ := strings.Cut(repoDigest, "@")
+						record.CurrentDigest = digest
+						if digest == latest.digest {
+							break
+						}
+					}
+					record.UpdateAvailable = record.CurrentDigest != latest.digest
+				}
+			}
+			if err := i.db.Save(&record).Error; err != nil {
+				slog.Error("保存镜像检查结果失败", "server_id", server.ID, "error", err)
+			}
+		}(&servers[idx])
+	}
+	wg.Wait()
+	return nil
+}
+
+// List 服务器的镜像检查结果，onlyUpdates为true时只返回有可用更新的
+func (i *ImageService) List(onlyUpdates bool) ([]ServerImageStatus, error) {
+	query := i.db.Order("server_id")
+	if onlyUpdates {
+		query = query.Where("update_available = ?", true)
+	}
+	var records []database.ServerImage
+	if err := query.Find(&records).Error; err != nil {
+		return nil, err
+	}
+	var servers []database.L2TPServer
+	if err := i.db.Select("id", "name").Find(&servers).Error; err != nil {
+		return nil, err
+	}
+	names := make(map[uint]string, len(servers))
+	for _, server := range servers {
+		names[server.ID] = server.Name
+	}
+
+	statuses := make([]ServerImageStatus, 0, len(records))
+	for _, record := range records {
+		name, ok := names[record.ServerID]
+		if !ok {
+			continue // 已删除的服务器
+		}
+		statuses = append(statuses, ServerImageStatus{ServerImage: record, ServerName: name})
+	}
+	return statuses, nil
+}
+
+// Rollout 最近一次滚动升级，没有时返回nil
+func (i *ImageService) Rollout() *Rollout {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if i.rollout == nil {
+		return nil
+	}
+	rollout := *i.rollout
+	rollout.Servers = slices.Clone(i.rollout.Servers)
+	return &rollout
+}
+
+// StartRollout 开始滚动升级，同一时间只能进行一次
+func (i *ImageService) StartRollout(ctx context.Context, req RolloutRequest, username string) (*Rollout, error) {
+	if req.BatchSize <= 0 {
+		req.BatchSize = 1
+	}
+	settle := rolloutDefaultSettle
+	if req.SettleSeconds > 0 {
+		settle = min(time.Duration(req.SettleSeconds)*time.Second, rolloutMaxSettle)
+	}
+
+	ids := req.ServerIDs
+	if len(ids) == 0 {
+		if err := i.db.Model(&database.ServerImage{}).Where("update_available = ?", true).Order("server_id").Pluck("server_id", &ids).Error; err != nil {
+			return nil, err
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("没有可升级的服务器")
+	}
+	var servers []database.L2TPServer
+	if err := i.db.Where("id IN ?", ids).Order("id").Find(&servers).Error; err != nil {
+		return nil, err
+	}
+	if len(servers) != len(ids) {
+		return nil, fmt.Errorf("部分服务器不存在")
+	}
+	for _, server := range servers {
+		if server.Status != "running" {
+			return nil, fmt.Errorf("服务器 \"%s\" 未运行，启动时会使用最新镜像", server.Name)
+		}
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if i.rollout != nil && i.rollout.Status == "running" {
+		return nil, fmt.Errorf("已有滚动升级正在进行")
+	}
+	rollout := &Rollout{
+		ID:        "rollout_" + time.Now().Format("20060102150405"),
+		Status:    "running",
+		BatchSize: req.BatchSize,
+		Batches:   (len(servers) + req.BatchSize - 1) / req.BatchSize,
+		Username:  username,
+		StartedAt: time.Now(),
+	}
+	for idx, server := range servers {
+		rollout.Servers = append(rollout.Servers, RolloutServer{
+			ServerID: server.ID,
+			Name:     server.Name,
+			Batch:    idx/req.BatchSize + 1,
+			Status:   RolloutServerPending,
+		})
+	}
+	i.rollout = rollout
+
+	go i.runRollout(context.WithoutCancel(ctx), rollout, settle)
+	copied := *rollout
+	copied.Servers = slices.Clone(rollout.Servers)
+	return &copied, nil
+}
+
+// setRolloutServer 更新滚动升级中服务器的状态
+func (i *ImageService) setRolloutServer(rollout *Rollout, idx int, status string, err error) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	rollout.Servers[idx].Status = status
+	if err != nil {
+		rollout.Servers[idx].Error = err.Error()
+	}
+}
+
+// runRollout 按批次重建容器：一批内并行重建，等待稳定后确认容器仍在运行，任一台失败则终止后续批次
+func (i *ImageService) runRollout(ctx context.Context, rollout *Rollout, settle time.Duration) {
+	slog.InfoContext(ctx, "开始滚动升级", "rollout", rollout.ID, "servers", len(rollout.Servers), "batch_size", rollout.BatchSize)
+	failed := false
+	for batch := 1; batch <= rollout.Batches && !failed; batch++ {
+		i.mutex.Lock()
+		rollout.Batch = batch
+		i.mutex.Unlock()
+
+		var members []int
+		for idx, server := range rollout.Servers {
+			if server.Batch == batch {
+				members = append(members, idx)
+			}
+		}
+
+		var wg sync.WaitGroup
+		for _, idx := range members {
+			wg.Add(1)
+			go func(idx int) {
+				defer wg.Done()
+				i.setRolloutServer(rollout, idx, RolloutServerUpgrading, nil)
+				if err := i.l2tpService.RedeployServer(ctx, rollout.Servers[idx].ServerID); err != nil {
+					i.setRolloutServer(rollout, idx, RolloutServerFailed, err)
+				}
+			}(idx)
+		}
+		wg.Wait()
+
+		time.Sleep(settle)
+		for _, idx := range members {
+			if rollout.Servers[idx].Status == RolloutServerFailed {
+				failed = true
+				continue
+			}
+			server, err := i.l2tpService.GetServer(rollout.Servers[idx].ServerID)
+			if err == nil {
+				var status map[string]interface{}
+				if status, err = i.l2tpService.SSH().WithContext(ctx).GetContainerStatus(server); err == nil && status["running"] != true {
+					err = fmt.Errorf("重建后容器未运行")
+				}
+			}
+			if err != nil {
+				failed = true
+				i.setRolloutServer(rollout, idx, RolloutServerFailed, err)
+				continue
+			}
+			i.setRolloutServer(rollout, idx, RolloutServerSucceeded, nil)
+			i.db.Model(&database.ServerImage{}).Where("server_id = ?", server.ID).Update("update_available", false)
+		}
+	}
+
+	i.mutex.Lock()
+	now := time.Now()
+	rollout.FinishedAt = &now
+	rollout.Status = "succeeded"
+	if failed {
+		rollout.Status = "failed"
+		for idx := range rollout.Servers {
+			if rollout.Servers[idx].Status == RolloutServerPending {
+				rollout.Servers[idx].Status = RolloutServerSkipped
+			}
+		}
+	}
+	i.mutex.Unlock()
+	slog.InfoContext(ctx, "滚动升级结束", "rollout", rollout.ID, "status", rollout.Status)
+}
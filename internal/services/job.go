@@ -0,0 +1,401 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"l2tp-manager/internal/logger"
+
+	"gorm.io/gorm"
+)
+
+// 任务类型
+const (
+	JobKindStart       = "start"
+	JobKindStop        = "stop"
+	JobKindRestart     = "restart"
+	JobKindAutoRestart = "auto_restart"
+	JobKindUpgrade     = "upgrade"
+)
+
+// 任务进度状态
+const (
+	JobStatusPending   = "pending"   // 已创建，尚未开始执行第一步
+	JobStatusRunning   = "running"   // 步骤完成，任务继续
+	JobStatusSucceeded = "succeeded" // 任务全部完成
+	JobStatusFailed    = "failed"    // 任务在某一步失败并终止
+)
+
+// StartSteps SSHService.StartL2TPContainerWithCallback 依次回调的步骤
+var StartSteps = []string{"ssh_connect", "docker_check", "cleanup", "config", "image_pull", "container_start", "container_ready"}
+
+// StopSteps SSHService.StopL2TPContainerWithCallback 依次回调的步骤
+var StopSteps = []string{"ssh_connect", "container_check", "container_stop"}
+
+// WireGuardStartSteps 启动WireGuard服务器时依次回调的步骤
+var WireGuardStartSteps = []string{"ssh_connect", "wireguard_install", "config", "service_start", "service_ready"}
+
+// WireGuardStopSteps 停止WireGuard服务器时依次回调的步骤
+var WireGuardStopSteps = []string{"ssh_connect", "service_check", "service_stop"}
+
+// JobProgress 任务进度事件，通过WebSocket以job_progress类型推送
+type JobProgress struct {
+	JobID     string `json:"job_id"`
+	Kind      string `json:"kind"`
+	ServerID  uint   `json:"server_id"`
+	Phase     string `json:"phase"`      // 当前阶段(start/stop)，重启任务依次经过stop和start
+	Step      string `json:"step"`       // 步骤键，取值见StartSteps/StopSteps(WireGuard服务器见WireGuardStartSteps/WireGuardStopSteps)
+	StepIndex int    `json:"step_index"` // 当前步骤在整个任务中的序号，从1开始
+	StepCount int    `json:"step_count"` // 任务总步骤数
+	Percent   int    `json:"percent"`
+	Status    string `json:"status"`
+	Detail    string `json:"detail"`
+}
+
+// JobView 任务的当前状态，用于任务列表和job_finished消息
+type JobView struct {
+	ID         string     `json:"id"`
+	Kind       string     `json:"kind"`
+	ServerID   uint       `json:"server_id"`
+	Status     string     `json:"status"` // pending/running/succeeded/failed
+	Phase      string     `json:"phase"`
+	Step       string     `json:"step"` // 最近完成或失败的步骤
+	Percent    int        `json:"percent"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Duration   float64    `json:"duration"` // 已执行的秒数
+}
+
+// jobPhase 任务的一个阶段
+type jobPhase struct {
+	name  string
+	steps []string
+}
+
+// Job 一次启动/停止/重启操作，将SSH步骤回调转换为结构化的进度事件
+type Job struct {
+	ID       string
+	Kind     string
+	ServerID uint
+
+	ws         *WSManager
+	started    time.Time
+	finishedAt time.Time
+	trace      *logger.Trace // SSH连接和命令耗时，任务超过慢请求阈值时输出
+	transcript *Transcript   // SSH连接、命令输出和步骤结果，任务结束后保存为服务器操作记录
+	service    *JobService   // 登记任务的任务登记表，为nil时不保存操作记录
+	phases     []jobPhase
+	phase      int // 当前阶段序号
+	offset     int // 当前阶段之前的步骤总数
+	total      int
+	done       int    // 已完成的步骤数
+	status     string // 取值同JobView.Status
+	step       string
+	err        string
+	finished   bool
+	mutex      sync.Mutex
+}
+
+// newJob 创建任务，phases依次为各阶段名称及其步骤
+func newJob(ws *WSManager, kind string, serverID uint, phases ...jobPhase) *Job {
+	job := &Job{
+		ID:         "job_" + strconv.FormatInt(time.Now().UnixNano(), 36),
+		Kind:       kind,
+		ServerID:   serverID,
+		ws:         ws,
+		started:    time.Now(),
+		trace:      logger.NewTrace(),
+		phases:     phases,
+		transcript: newTranscript(phases[0].name),
+		status:     JobStatusPending,
+	}
+	for _, phase := range phases {
+		job.total += len(phase.steps)
+	}
+	return job
+}
+
+// newServerJob 按任务类型和服务器类型创建服务器操作任务
+func newServerJob(ws *WSManager, kind string, serverID uint, serverType string) *Job {
+	start := jobPhase{name: JobKindStart, steps: StartSteps}
+	stop := jobPhase{name: JobKindStop, steps: StopSteps}
+	if serverType == ServerTypeWireGuard {
+		start.steps = WireGuardStartSteps
+		stop.steps = WireGuardStopSteps
+	}
+	switch kind {
+	case JobKindStop:
+		return newJob(ws, kind, serverID, stop)
+	case JobKindRestart:
+		return newJob(ws, kind, serverID, stop, start)
+	default:
+		return newJob(ws, kind, serverID, start)
+	}
+}
+
+// Callback 返回SSH步骤回调，步骤在当前阶段内定位，重启任务进入启动阶段前需调用NextPhase
+func (j *Job) Callback() func(step string, success bool, message string) {
+	return func(step string, success bool, message string) {
+		j.mutex.Lock()
+		if j.finished {
+			j.mutex.Unlock()
+			return
+		}
+		phase := j.phases[j.phase]
+		index := j.offset
+		for i, s := range phase.steps {
+			if s == step {
+				index = j.offset + i + 1
+				break
+			}
+		}
+		status := JobStatusRunning
+		if success {
+			if index > j.done {
+				j.done = index
+			}
+		} else {
+			status = JobStatusFailed
+			j.finished = true
+			j.finishedAt = time.Now()
+			j.err = message
+		}
+		j.status, j.step = status, step
+		progress := j.progress(phase.name, step, status, message)
+		progress.StepIndex = index
+		j.mutex.Unlock()
+
+		j.transcript.step(step, success, message)
+		j.emit(progress)
+		if !success {
+			j.completed()
+		}
+	}
+}
+
+// Trace 任务的耗时记录
+func (j *Job) Trace() *logger.Trace {
+	return j.trace
+}
+
+// Transcript 任务的执行记录
+func (j *Job) Transcript() *Transcript {
+	return j.transcript
+}
+
+// NextPhase 进入下一阶段
+func (j *Job) NextPhase() {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if j.phase < len(j.phases)-1 {
+		j.offset += len(j.phases[j.phase].steps)
+		j.done = j.offset
+		j.phase++
+		j.transcript.setPhase(j.phases[j.phase].name)
+	}
+}
+
+// Finish 结束任务，err为空时推送成功事件，否则在尚未推送失败事件时补发
+func (j *Job) Finish(err error) {
+	j.mutex.Lock()
+	if j.finished {
+		j.mutex.Unlock()
+		return
+	}
+	j.finished = true
+	j.finishedAt = time.Now()
+	var progress JobProgress
+	if err != nil {
+		j.status, j.err = JobStatusFailed, err.Error()
+		progress = j.progress(j.phases[j.phase].name, "", JobStatusFailed, err.Error())
+	} else {
+		j.status, j.done = JobStatusSucceeded, j.total
+		progress = j.progress(j.phases[j.phase].name, "", JobStatusSucceeded, "")
+	}
+	progress.StepIndex = j.done
+	j.mutex.Unlock()
+
+	j.emit(progress)
+	j.completed()
+}
+
+// completed 任务结束后推送job_finished消息并保存操作记录，耗时超过慢请求阈值时输出SSH调用明细
+func (j *Job) completed() {
+	view := j.View()
+	if j.ws != nil {
+		j.ws.BroadcastJobFinished(view)
+	}
+	if j.service != nil {
+		j.service.saveOperation(view, j.transcript)
+	}
+	if elapsed := time.Since(j.started); logger.IsSlow(elapsed) {
+		slog.Warn("慢任务", "job_id", j.ID, "kind", j.Kind, "server_id", j.ServerID, "duration", elapsed, "error", view.Error, "trace", j.trace)
+	}
+}
+
+// Finished 任务是否已结束
+func (j *Job) Finished() bool {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return j.finished
+}
+
+// View 任务的当前状态
+func (j *Job) View() JobView {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	view := JobView{
+		ID:        j.ID,
+		Kind:      j.Kind,
+		ServerID:  j.ServerID,
+		Status:    j.status,
+		Phase:     j.phases[j.phase].name,
+		Step:      j.step,
+		Percent:   100,
+		Error:     j.err,
+		CreatedAt: j.started,
+	}
+	if j.total > 0 {
+		view.Percent = j.done * 100 / j.total
+	}
+	end := time.Now()
+	if j.finished {
+		finishedAt := j.finishedAt
+		view.FinishedAt = &finishedAt
+		end = finishedAt
+	}
+	view.Duration = end.Sub(j.started).Seconds()
+	return view
+}
+
+// progress 生成当前进度事件，需持有锁
+func (j *Job) progress(phase, step, status, detail string) JobProgress {
+	percent := 100
+	if j.total > 0 {
+		percent = j.done * 100 / j.total
+	}
+	return JobProgress{
+		JobID:     j.ID,
+		Kind:      j.Kind,
+		ServerID:  j.ServerID,
+		Phase:     phase,
+		Step:      step,
+		StepCount: j.total,
+		Percent:   percent,
+		Status:    status,
+		Detail:    detail,
+	}
+}
+
+// emit 推送进度事件
+func (j *Job) emit(progress JobProgress) {
+	if j.ws != nil {
+		j.ws.BroadcastJobProgress(progress)
+	}
+}
+
+// jobContextKey 上下文中保存任务的键
+type jobContextKey struct{}
+
+// withJob 将任务放入上下文，供重启的启动阶段沿用同一任务
+func withJob(ctx context.Context, job *Job) context.Context {
+	return context.WithValue(ctx, jobContextKey{}, job)
+}
+
+// jobFromContext 取出上下文中的任务
+func jobFromContext(ctx context.Context) *Job {
+	job, _ := ctx.Value(jobContextKey{}).(*Job)
+	return job
+}
+
+// maxFinishedJobs 任务列表保留的已结束任务数，更早的任务被移除
+const maxFinishedJobs = 200
+
+// JobFilter 任务列表的筛选条件，零值表示不筛选
+type JobFilter struct {
+	Status   string
+	Kind     string
+	ServerID uint
+}
+
+// JobService 服务器操作任务登记表，保存进行中和最近结束的任务，供任务列表查询。
+// 任务结束后连同执行记录保存到数据库，作为服务器的操作历史
+type JobService struct {
+	ws    *WSManager
+	db    *gorm.DB
+	jobs  []*Job // 按创建时间排序
+	mutex sync.Mutex
+}
+
+// NewJobService 创建任务登记表
+func NewJobService(ws *WSManager, db *gorm.DB) *JobService {
+	return &JobService{ws: ws, db: db}
+}
+
+// NewServerJob 创建并登记服务器操作任务
+func (s *JobService) NewServerJob(kind string, serverID uint, serverType string) *Job {
+	job := newServerJob(s.ws, kind, serverID, serverType)
+	job.service = s
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.jobs = append(s.jobs, job)
+	s.prune()
+	return job
+}
+
+// prune 已结束的任务超过maxFinishedJobs时移除最早的，需持有锁
+func (s *JobService) prune() {
+	finished := 0
+	for _, job := range s.jobs {
+		if job.Finished() {
+			finished++
+		}
+	}
+	if finished <= maxFinishedJobs {
+		return
+	}
+	kept := s.jobs[:0]
+	for _, job := range s.jobs {
+		if finished > maxFinishedJobs && job.Finished() {
+			finished--
+			continue
+		}
+		kept = append(kept, job)
+	}
+	s.jobs = kept
+}
+
+// List 按筛选条件返回任务，最新的在前
+func (s *JobService) List(filter JobFilter) []JobView {
+	s.mutex.Lock()
+	jobs := append([]*Job(nil), s.jobs...)
+	s.mutex.Unlock()
+
+	views := make([]JobView, 0, len(jobs))
+	for i := len(jobs) - 1; i >= 0; i-- {
+		view := jobs[i].View()
+		if (filter.Status != "" && view.Status != filter.Status) ||
+			(filter.Kind != "" && view.Kind != filter.Kind) ||
+			(filter.ServerID != 0 && view.ServerID != filter.ServerID) {
+			continue
+		}
+		views = append(views, view)
+	}
+	return views
+}
+
+// Get 按ID查找任务
+func (s *JobService) Get(id string) (JobView, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, job := range s.jobs {
+		if job.ID == id {
+			return job.View(), true
+		}
+	}
+	return JobView{}, false
+}
@@ -0,0 +1,286 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"l2tp-manager/internal/database"
+)
+
+// SettingKnockPort 面板接收敲门包的UDP端口，0表示不接收
+const SettingKnockPort = "knock_port"
+
+// 端口敲门参数
+const (
+	knockDefaultTTL = 3600  // 敲门通过的来源地址的默认有效期(秒)
+	minKnockTTL     = 60    // 有效期下限(秒)
+	maxKnockTTL     = 86400 // 有效期上限(秒)
+	// knockSecretLength 生成的敲门密钥长度，手动填写时不能短于minKnockSecret
+	knockSecretLength = 32
+	minKnockSecret    = 16
+	// knockClockSkew 敲门包时间戳与面板时间允许的最大偏差，用过的随机数在两倍时间内不能重复使用
+	knockClockSkew = 60 * time.Second
+	// maxKnockPacket 敲门包的最大长度
+	maxKnockPacket = 256
+)
+
+// knockNoncePattern 敲门包中的随机数
+var knockNoncePattern = regexp.MustCompile(`^[A-Za-z0-9]{8,64}$`)
+
+// 敲门包校验失败的原因，只记录在日志中，不回复敲门方
+var (
+	errKnockMalformed = errors.New("敲门包格式错误")
+	errKnockServer    = errors.New("服务器不存在或未启用端口敲门")
+	errKnockSignature = errors.New("签名错误")
+	errKnockExpired   = errors.New("时间戳超出允许范围")
+	errKnockReplay    = errors.New("随机数已使用过")
+)
+
+// knockTTL 敲门通过的来源地址的有效期(秒)
+func knockTTL(server *database.L2TPServer) int {
+	if server.KnockTTL > 0 {
+		return server.KnockTTL
+	}
+	return knockDefaultTTL
+}
+
+// validateKnock 校验端口敲门设置。敲门规则由面板本机添加，由中转节点转发的服务器不支持
+func validateKnock(server *database.L2TPServer) error {
+	if server.KnockTTL != 0 && (server.KnockTTL < minKnockTTL || server.KnockTTL > maxKnockTTL) {
+		return fmt.Errorf("敲门有效期必须在%d到%d秒之间", minKnockTTL, maxKnockTTL)
+	}
+	if !server.KnockEnabled {
+		return nil
+	}
+	if server.RelayNodeID != 0 {
+		return fmt.Errorf("端口敲门只支持由面板本机转发的服务器")
+	}
+	return nil
+}
+
+// prepareKnock 未提供敲门密钥时沿用原值，填写auto或启用敲门时仍没有密钥则生成
+func prepareKnock(server, existing *database.L2TPServer) error {
+	if server.KnockSecret == "" && existing != nil {
+		server.KnockSecret = existing.KnockSecret
+	}
+	if server.KnockSecret == CredentialAuto || (server.KnockEnabled && server.KnockSecret == "") {
+		secret, err := generateSecret(CredentialCharsetAlnum, knockSecretLength)
+		if err != nil {
+			return fmt.Errorf("生成敲门密钥失败: %v", err)
+		}
+		server.KnockSecret = secret
+		return nil
+	}
+	if server.KnockSecret != "" && len(server.KnockSecret) < minKnockSecret {
+		return fmt.Errorf("敲门密钥不能少于%d个字符", minKnockSecret)
+	}
+	return nil
+}
+
+// knockSignature 敲门包的签名：以敲门密钥对 "服务器ID:时间戳:随机数" 计算的HMAC-SHA256(十六进制)
+func knockSignature(secret, message string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// knockPacket 解析后的敲门包，格式为 服务器ID:Unix时间戳:随机数:签名
+type knockPacket struct {
+	serverID  uint
+	timestamp time.Time
+	nonce     string
+	message   string // 签名的内容
+	signature string
+}
+
+// parseKnockPacket 解析敲门包
+func parseKnockPacket(data []byte) (*knockPacket, error) {
+	parts := strings.Split(strings.TrimSpace(string(data)), ":")
+	if len(parts) != 4 || !knockNoncePattern.MatchString(parts[2]) {
+		return nil, errKnockMalformed
+	}
+	id, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return nil, errKnockMalformed
+	}
+	ts, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, errKnockMalformed
+	}
+	return &knockPacket{
+		serverID:  uint(id),
+		timestamp: time.Unix(ts, 0),
+		nonce:     parts[2],
+		message:   strings.Join(parts[:3], ":"),
+		signature: strings.ToLower(parts[3]),
+	}, nil
+}
+
+// KnockSource 敲门通过的来源地址
+type KnockSource struct {
+	IP        string    `json:"ip"`
+	KnockedAt time.Time `json:"knocked_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// KnockInfo 服务器的端口敲门设置、客户端敲门方法和当前放行的来源地址
+type KnockInfo struct {
+	Enabled bool          `json:"enabled"`
+	Port    int           `json:"port"` // 面板接收敲门包的UDP端口，0表示未开启
+	TTL     int           `json:"ttl"`
+	Secret  string        `json:"secret,omitempty"`
+	Command string        `json:"command,omitempty"` // 发送敲门包的示例命令(需要openssl和nc)
+	Sources []KnockSource `json:"sources"`
+}
+
+// KnockService 单包授权(SPA)式端口敲门：在设置的UDP端口接收带HMAC签名的敲门包，
+// 校验通过后将发送方地址加入服务器的放行列表，启用敲门的服务器的中转端口只接受列表中的地址建立新连接，
+// 已建立的连接在地址过期后继续有效
+type KnockService struct {
+	settings *SettingsService
+	routing  *RoutingService
+	nonces   map[string]time.Time // 服务器ID:随机数 -> 使用时间
+	mutex    sync.Mutex
+}
+
+// NewKnockService 创建端口敲门服务并注册其设置项
+func NewKnockService(settings *SettingsService, routing *RoutingService) *KnockService {
+	settings.Register(SettingDef{Key: SettingKnockPort, Type: SettingTypeInt, Default: "0", Max: 65535, Description: "接收端口敲门包的UDP端口，0表示不接收(启用敲门的服务器将无法被访问)"})
+	return &KnockService{
+		settings: settings,
+		routing:  routing,
+		nonces:   make(map[string]time.Time),
+	}
+}
+
+// Start 在设置的端口接收敲门包，端口修改后重新监听
+func (s *KnockService) Start(ctx context.Context) {
+	changed := s.settings.Watch(SettingKnockPort)
+	for {
+		listenCtx, stop := context.WithCancel(ctx)
+		if port := s.settings.Int(SettingKnockPort); port > 0 {
+			go s.listen(listenCtx, port)
+		}
+		select {
+		case <-ctx.Done():
+			stop()
+			return
+		case <-changed:
+			stop()
+		}
+	}
+}
+
+// listen 接收并处理敲门包直到ctx取消，不回复敲门方
+func (s *KnockService) listen(ctx context.Context, port int) {
+	conn, err := net.ListenPacket("udp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		slog.Error("监听端口敲门端口失败", "port", port, "error", err)
+		return
+	}
+	slog.Info("端口敲门已开启", "port", port)
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	buf := make([]byte, maxKnockPacket)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Error("接收敲门包失败", "port", port, "error", err)
+			}
+			return
+		}
+		udpAddr, ok := addr.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		if err := s.knock(buf[:n], udpAddr.IP, time.Now()); err != nil {
+			slog.Debug("拒绝敲门包", "source", udpAddr.IP.String(), "error", err)
+		}
+	}
+}
+
+// knock 校验敲门包，通过后放行发送方地址
+func (s *KnockService) knock(data []byte, ip net.IP, now time.Time) error {
+	packet, err := parseKnockPacket(data)
+	if err != nil {
+		return err
+	}
+	if ip = ip.To4(); ip == nil {
+		return fmt.Errorf("只支持IPv4来源地址")
+	}
+	server := s.routing.knockServer(packet.serverID)
+	if server == nil || !server.KnockEnabled || server.KnockSecret == "" {
+		return errKnockServer
+	}
+	expected := knockSignature(server.KnockSecret, packet.message)
+	if !hmac.Equal([]byte(expected), []byte(packet.signature)) {
+		return errKnockSignature
+	}
+	if skew := now.Sub(packet.timestamp); skew > knockClockSkew || skew < -knockClockSkew {
+		return errKnockExpired
+	}
+
+	s.mutex.Lock()
+	for key, used := range s.nonces {
+		if now.Sub(used) > 2*knockClockSkew {
+			delete(s.nonces, key)
+		}
+	}
+	key := fmt.Sprintf("%d:%s", server.ID, packet.nonce)
+	if _, used := s.nonces[key]; used {
+		s.mutex.Unlock()
+		return errKnockReplay
+	}
+	s.nonces[key] = now
+	s.mutex.Unlock()
+
+	if err := s.routing.authorizeKnock(server.ID, ip.String(), now); err != nil {
+		slog.Error("放行敲门来源地址失败", "server_id", server.ID, "source", ip.String(), "error", err)
+		return err
+	}
+	slog.Info("敲门通过", "server_id", server.ID, "source", ip.String())
+	return nil
+}
+
+// Info 服务器的端口敲门设置和当前放行的来源地址，host为示例命令中面板的地址
+func (s *KnockService) Info(server *database.L2TPServer, host string) KnockInfo {
+	info := KnockInfo{
+		Enabled: server.KnockEnabled,
+		Port:    s.settings.Int(SettingKnockPort),
+		TTL:     knockTTL(server),
+		Secret:  server.KnockSecret,
+		Sources: []KnockSource{},
+	}
+	if server.KnockEnabled && server.KnockSecret != "" && info.Port > 0 {
+		info.Command = fmt.Sprintf(`m="%d:$(date +%%s):$(openssl rand -hex 8)"; printf '%%s:%%s' "$m" "$(printf '%%s' "$m" | openssl dgst -sha256 -hmac %s -r | cut -d' ' -f1)" | nc -u -w1 %s %d`,
+			server.ID, shellQuote(server.KnockSecret), host, info.Port)
+	}
+
+	ttl := time.Duration(info.TTL) * time.Second
+	for ip, knockedAt := range s.routing.knockSources(server.ID, ttl) {
+		info.Sources = append(info.Sources, KnockSource{IP: ip, KnockedAt: knockedAt, ExpiresAt: knockedAt.Add(ttl)})
+	}
+	sort.Slice(info.Sources, func(i, j int) bool { return info.Sources[i].KnockedAt.After(info.Sources[j].KnockedAt) })
+	return info
+}
+
+// Revoke 清空服务器放行的来源地址，已建立的连接不受影响
+func (s *KnockService) Revoke(serverID uint) error {
+	return s.routing.revokeKnock(serverID)
+}
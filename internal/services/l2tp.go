@@ -1,12 +1,18 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 	"errors"
 
 	"l2tp-manager/internal/database"
+	"l2tp-manager/internal/logger"
 
 	"gorm.io/gorm"
 )
@@ -14,59 +20,300 @@ import (
 // L2TPService L2TP服务管理
 type L2TPService struct {
 	db        *gorm.DB
+	ctx       context.Context // WithContext绑定的上下文，为nil时未绑定
 	wsManager *WSManager
+	ssh       ExitNodeClient
+	notifier  *NotificationService
+	uptime    *UptimeService
+	jobs      *JobService
+	operations *serverOperations // 后台执行的启动/停止/重启操作，WithContext的副本共用
+	reporter  *ErrorReporter
+	credentials *CredentialService
+	natChecks *NATCheckService
 }
 
-// NewL2TPService 创建新的L2TP服务
-func NewL2TPService(db *gorm.DB, wsManager *WSManager) *L2TPService {
+// NewL2TPService 创建新的L2TP服务，ssh用于在落地机上部署和管理容器
+func NewL2TPService(db *gorm.DB, wsManager *WSManager, ssh ExitNodeClient) *L2TPService {
 	return &L2TPService{
 		db:        db,
 		wsManager: wsManager,
+		ssh:       ssh,
+		operations: newServerOperations(),
 	}
 }
 
+// SSH 操作落地机使用的客户端
+func (s *L2TPService) SSH() ExitNodeClient {
+	return s.ssh
+}
+
+// WithContext 返回绑定ctx的服务副本：数据库语句和SSH连接随ctx取消(如客户端断开连接)，
+// 启动/停止等后台任务不受影响，使用各自的上下文
+func (s *L2TPService) WithContext(ctx context.Context) *L2TPService {
+	bound := *s
+	bound.ctx = ctx
+	bound.db = s.db.WithContext(ctx)
+	bound.ssh = s.ssh.WithContext(ctx)
+	return &bound
+}
+
+// serverOperationTimeout 单次启动/停止/重启操作的超时时间，超时后关闭SSH连接，任务以失败结束
+const serverOperationTimeout = 15 * time.Minute
+
+// runServerJob 在后台执行服务器操作：操作不随发起请求的结束而取消，超过serverOperationTimeout
+// 或关闭面板时未在超时内完成则取消。操作期间的数据库语句和SSH连接使用该上下文，耗时和执行过程记入任务
+func (s *L2TPService) runServerJob(ctx context.Context, job *Job, operation func(s *L2TPService, ctx context.Context)) {
+	jobCtx, done := s.operations.begin(withTranscript(logger.WithTrace(context.WithoutCancel(ctx), job.Trace()), job.Transcript()))
+	go func() {
+		defer done()
+		// 操作中的panic不导致进程退出，任务以失败结束，服务器不会停留在启动中/停止中
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				report := NewPanicReport(jobCtx, "server_job", recovered)
+				report.Tags = map[string]string{"job_kind": job.Kind, "server_id": strconv.FormatUint(uint64(job.ServerID), 10)}
+				s.reporter.Report(report)
+				job.Finish(fmt.Errorf("内部错误: %s", report.Message()))
+				s.WithContext(jobCtx).updateServerStatus(job.ServerID, "error")
+			}
+		}()
+		operation(s.WithContext(jobCtx), jobCtx)
+	}()
+}
+
 // L2TPUser L2TP用户结构
 type L2TPUser struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	QuotaGB  int64  `json:"quota_gb,omitempty"` // 每月流量配额(GB)，0表示不限，只有L2TP服务器统计账号流量
 }
 
 // CreateServer 创建L2TP服务器
 func (s *L2TPService) CreateServer(server *database.L2TPServer) error {
+	if err := s.credentials.fill(server, nil); err != nil {
+		return err
+	}
+
+	portMutex.Lock()
+	defer portMutex.Unlock()
+
 	// 使用事务确保数据一致性
 	err := s.db.Transaction(func(tx *gorm.DB) error {
-		// 检查端口是否已被使用
-		var count int64
-		result := tx.Model(&database.L2TPServer{}).Where("l2tp_port = ?", server.L2TPPort).Count(&count)
-		if result.Error != nil {
-			return result.Error
-		}
-		if count > 0 {
-			return fmt.Errorf("中转端口 %d 已被使用", server.L2TPPort)
+		return createServer(tx, server)
+	})
+	if err == nil {
+		s.serverCreated(server)
+	}
+	return err
+}
+
+// createServer 在事务中校验并插入服务器，调用方需持有portMutex
+func createServer(tx *gorm.DB, server *database.L2TPServer) error {
+	// 未指定中转端口时从端口池分配
+	if server.L2TPPort == 0 {
+		port, err := allocatePoolPort(tx, server.TenantID)
+		if err != nil {
+			return err
 		}
+		server.L2TPPort = port
+	}
 
-		// 设置默认状态
-		server.Status = "stopped"
-		server.CreatedAt = time.Now()
-		server.UpdatedAt = time.Now()
+	// 检查外部ID，未指定时由模型钩子生成
+	if err := checkExternalID(tx, server.ExternalID); err != nil {
+		return err
+	}
 
-		return tx.Create(server).Error
-	})
-	
-	// 如果创建成功，通过WebSocket推送服务器创建通知
-	if err == nil && s.wsManager != nil {
+	// 检查所属租户的服务器数量上限
+	if err := checkTenantQuota(tx, server.TenantID); err != nil {
+		return err
+	}
+
+	// 检查服务器类型和附加协议的中转端口
+	if server.Type == "" {
+		server.Type = ServerTypeL2TP
+	}
+	applyTypeDefaults(server, nil)
+	if err := checkRelayPorts(tx, server, 0); err != nil {
+		return err
+	}
+	if err := checkPortPools(tx, RelayPorts(server), server.TenantID); err != nil {
+		return err
+	}
+	if err := checkPortsFree(server, nil); err != nil {
+		return err
+	}
+	if err := prepareCredentials(server, nil); err != nil {
+		return err
+	}
+
+	// 设置默认状态
+	server.ID = 0
+	server.Status = "stopped"
+	if server.DesiredState != "running" {
+		server.DesiredState = "stopped"
+	}
+	server.CreatedAt = time.Now()
+	server.UpdatedAt = time.Now()
+
+	return tx.Create(server).Error
+}
+
+// serverCreated 通过WebSocket和事件通知推送服务器创建
+func (s *L2TPService) serverCreated(server *database.L2TPServer) {
+	if s.wsManager != nil {
 		s.wsManager.BroadcastServerCreated(server, fmt.Sprintf("服务器 \"%s\" 已创建", server.Name))
 	}
-	
-	return err
+	s.publish(EventServerCreated, server.ID, server.Name, fmt.Sprintf("服务器 \"%s\" 已创建", server.Name))
 }
 
+// externalIDPattern 外部ID允许的字符，便于在URL和IaC配置中使用
+var externalIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// checkExternalID 校验客户端指定的外部ID格式，且未被其他服务器(包括回收站)使用
+func checkExternalID(tx *gorm.DB, externalID string) error {
+	if externalID == "" {
+		return nil
+	}
+	if !externalIDPattern.MatchString(externalID) {
+		return fmt.Errorf("外部ID只能包含字母、数字和 . _ : -，且不超过128个字符")
+	}
+	var existing database.L2TPServer
+	result := tx.Unscoped().Where("external_id = ?", externalID).Limit(1).Find(&existing)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return &ExternalIDConflictError{
+			ExternalID: externalID,
+			Owner: PortOwner{
+				Kind:     PortOwnerServer,
+				ID:       existing.ID,
+				Name:     existing.Name,
+				Trashed:  existing.DeletedAt.Valid,
+				TenantID: existing.TenantID,
+			},
+		}
+	}
+	return nil
+}
+
+// ExternalIDConflictError 外部ID已被其他服务器(包括回收站)使用
+type ExternalIDConflictError struct {
+	ExternalID string
+	Owner      PortOwner
+}
+
+// Error 错误信息，包含使用该外部ID的服务器
+func (e *ExternalIDConflictError) Error() string {
+	if e.Owner.Trashed {
+		return fmt.Sprintf("外部ID %s 被回收站中的服务器 \"%s\" 占用", e.ExternalID, e.Owner.Name)
+	}
+	return fmt.Sprintf("外部ID %s 已被服务器 \"%s\" 使用", e.ExternalID, e.Owner.Name)
+}
+
+// Redacted 不含服务器信息的错误信息，用于该服务器对当前用户不可见时
+func (e *ExternalIDConflictError) Redacted() string {
+	return fmt.Sprintf("外部ID %s 已被使用", e.ExternalID)
+}
+
+// checkRelayPorts 校验服务器的全部中转端口未与其他服务器冲突(包括回收站)
+func checkRelayPorts(tx *gorm.DB, server *database.L2TPServer, excludeID uint) error {
+	if err := ValidateProtocols(server); err != nil {
+		return err
+	}
+	if err := checkRelayNode(tx, server, excludeID); err != nil {
+		return err
+	}
+	if err := checkChainNodes(tx, server); err != nil {
+		return err
+	}
+
+	// 中转端口不能与其他服务器(包括回收站)、代理入站以及面板本机转发时面板自身的端口冲突
+	self := func(owner PortOwner) bool { return owner.Kind == PortOwnerServer && owner.ID == excludeID }
+	return checkPortOwners(tx, RelayPorts(server), server.RelayNodeID == 0, self)
+}
+
+// ServerListQuery 服务器列表查询条件
+type ServerListQuery struct {
+	Page     int    // 页码，从1开始
+	PageSize int    // 每页数量，0表示不分页
+	Sort     string // 排序字段，前缀"-"表示降序
+	Status   string
+	Expired  *bool
+	Keyword  string // 按名称或地址模糊匹配
+	TenantID uint   // 只返回该租户的服务器，0表示不限
+}
+
+// sortableServerFields 允许排序的字段
+var sortableServerFields = map[string]bool{
+	"id":          true,
+	"name":        true,
+	"host":        true,
+	"l2tp_port":   true,
+	"status":      true,
+	"expire_date": true,
+	"created_at":  true,
+	"updated_at":  true,
+}
+
+// ErrUnsupportedSort 排序字段不在允许排序的字段中
+var ErrUnsupportedSort = errors.New("不支持的排序字段")
+
 // GetServers 获取所有L2TP服务器
 func (s *L2TPService) GetServers() ([]database.L2TPServer, error) {
+	servers, _, err := s.ListServers(ServerListQuery{})
+	return servers, err
+}
+
+// ListServers 按条件分页查询服务器，返回当前页和总数
+func (s *L2TPService) ListServers(q ServerListQuery) ([]database.L2TPServer, int64, error) {
+	query := s.db.Model(&database.L2TPServer{}).Scopes(TenantServers(q.TenantID))
+	if q.Status != "" {
+		query = query.Where("status = ?", q.Status)
+	}
+	if q.Expired != nil {
+		if *q.Expired {
+			query = query.Where("expire_date < ?", time.Now())
+		} else {
+			query = query.Where("expire_date >= ?", time.Now())
+		}
+	}
+	if q.Keyword != "" {
+		like := "%" + q.Keyword + "%"
+		query = query.Where("name LIKE ? OR host LIKE ?", like, like)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	order := "id"
+	if q.Sort != "" {
+		field, desc := q.Sort, false
+		if field[0] == '-' {
+			field, desc = field[1:], true
+		}
+		if !sortableServerFields[field] {
+			return nil, 0, fmt.Errorf("%w: %s", ErrUnsupportedSort, field)
+		}
+		order = field
+		if desc {
+			order += " DESC"
+		}
+	}
+	query = query.Order(order)
+
+	if q.PageSize > 0 {
+		page := q.Page
+		if page < 1 {
+			page = 1
+		}
+		query = query.Offset((page - 1) * q.PageSize).Limit(q.PageSize)
+	}
+
 	var servers []database.L2TPServer
-	result := s.db.Find(&servers)
-	if result.Error != nil {
-		return nil, result.Error
+	if err := query.Find(&servers).Error; err != nil {
+		return nil, 0, err
 	}
 	
 	// 更新过期状态
@@ -74,7 +321,7 @@ func (s *L2TPService) GetServers() ([]database.L2TPServer, error) {
 		servers[i].IsExpired = time.Now().After(servers[i].ExpireDate)
 	}
 
-	return servers, nil
+	return servers, total, nil
 }
 
 // GetServer 根据ID获取服务器
@@ -94,6 +341,9 @@ func (s *L2TPService) GetServer(id uint) (*database.L2TPServer, error) {
 
 // UpdateServer 更新L2TP服务器
 func (s *L2TPService) UpdateServer(id uint, server *database.L2TPServer) error {
+	portMutex.Lock()
+	defer portMutex.Unlock()
+
 	err := s.db.Transaction(func(tx *gorm.DB) error {
 		// 检查服务器是否存在
 		var existingServer database.L2TPServer
@@ -105,16 +355,49 @@ func (s *L2TPService) UpdateServer(id uint, server *database.L2TPServer) error {
 			return result.Error
 		}
 
-		// 如果更改了端口，检查新端口是否可用
-		if server.L2TPPort != existingServer.L2TPPort {
-			var count int64
-			result := tx.Model(&database.L2TPServer{}).Where("l2tp_port = ? AND id != ?", server.L2TPPort, id).Count(&count)
-			if result.Error != nil {
-				return result.Error
-			}
-			if count > 0 {
-				return fmt.Errorf("中转端口 %d 已被使用", server.L2TPPort)
-			}
+		// 服务器类型创建后不变，未提供时沿用
+		if server.Type == "" {
+			server.Type = existingServer.Type
+		}
+		if server.Type != existingServer.Type {
+			return fmt.Errorf("服务器类型创建后不能修改")
+		}
+		applyTypeDefaults(server, &existingServer)
+
+		// 生成填写为auto的PSK和用户密码
+		if err := s.credentials.fill(server, &existingServer); err != nil {
+			return err
+		}
+
+		// 检查附加协议的中转端口
+		if err := checkRelayPorts(tx, server, id); err != nil {
+			return err
+		}
+		if err := checkPortPools(tx, RelayPorts(server), existingServer.TenantID); err != nil {
+			return err
+		}
+		if err := checkPortsFree(server, &existingServer); err != nil {
+			return err
+		}
+		if err := prepareCredentials(server, &existingServer); err != nil {
+			return err
+		}
+
+		// 期望状态通过独立接口修改，未提供时保持不变
+		if server.DesiredState == "" {
+			server.DesiredState = existingServer.DesiredState
+		}
+		// 外部ID创建后不变，所属租户通过租户接口分配
+		server.ExternalID = existingServer.ExternalID
+		server.TenantID = existingServer.TenantID
+		// 上报令牌和上报的IP通过独立接口维护，修改落地机地址后上报的IP失效
+		server.DDNSTokenHash = existingServer.DDNSTokenHash
+		if server.Host == existingServer.Host {
+			server.ReportedIP = existingServer.ReportedIP
+			server.ReportedAt = existingServer.ReportedAt
+		} else {
+			server.ReportedIP = ""
+			server.ReportedAt = nil
 		}
 
 		server.ID = id
@@ -129,7 +412,7 @@ func (s *L2TPService) UpdateServer(id uint, server *database.L2TPServer) error {
 	return err
 }
 
-// DeleteServer 删除L2TP服务器
+// DeleteServer 删除L2TP服务器(软删除，移入回收站，保留流量日志)
 func (s *L2TPService) DeleteServer(id uint) error {
 	server, err := s.GetServer(id)
 	serverName := "未知服务器"
@@ -139,18 +422,16 @@ func (s *L2TPService) DeleteServer(id uint) error {
 
 	err = s.db.Transaction(func(tx *gorm.DB) error {
 		// 先停止服务
-		if err := s.StopServer(id); err != nil {
+		if err := s.StopServer(context.Background(), id); err != nil {
 			// 即使停止失败也继续删除数据库记录
 		}
 
-		// 删除流量日志
-		result := tx.Where("server_id = ?", id).Delete(&database.TrafficLog{})
-		if result.Error != nil {
-			return result.Error
+		// 软删除服务器记录，同时标记为已停止以便恢复后状态一致
+		if err := tx.Model(&database.L2TPServer{}).Where("id = ?", id).Update("status", "stopped").Error; err != nil {
+			return err
 		}
 
-		// 删除服务器记录
-		result = tx.Delete(&database.L2TPServer{}, id)
+		result := tx.Delete(&database.L2TPServer{}, id)
 		if result.Error != nil {
 			return result.Error
 		}
@@ -163,49 +444,229 @@ func (s *L2TPService) DeleteServer(id uint) error {
 	})
 
 	if err == nil && s.wsManager != nil {
-		s.wsManager.BroadcastServerStatus(id, "deleted", fmt.Sprintf("服务器 \"%s\" 已删除", serverName))
+		s.wsManager.BroadcastServerStatus(id, "deleted", fmt.Sprintf("服务器 \"%s\" 已移入回收站", serverName))
 	}
 
 	return err
 }
 
-// StartServer 启动L2TP服务器
-func (s *L2TPService) StartServer(id uint) error {
+// GetTrashedServers 获取回收站中的服务器，tenantID大于0时只返回该租户的
+func (s *L2TPService) GetTrashedServers(tenantID uint) ([]database.L2TPServer, error) {
+	var servers []database.L2TPServer
+	result := s.db.Unscoped().Scopes(TenantServers(tenantID)).Where("deleted_at IS NOT NULL").Order("deleted_at DESC").Find(&servers)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	for i := range servers {
+		servers[i].IsExpired = time.Now().After(servers[i].ExpireDate)
+	}
+
+	return servers, nil
+}
+
+// RestoreServer 从回收站恢复服务器
+func (s *L2TPService) RestoreServer(id uint) (*database.L2TPServer, error) {
+	var server database.L2TPServer
+	result := s.db.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).First(&server)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("回收站中不存在该服务器")
+		}
+		return nil, result.Error
+	}
+	if err := checkTenantQuota(s.db, server.TenantID); err != nil {
+		return nil, err
+	}
+
+	err := s.db.Unscoped().Model(&database.L2TPServer{}).Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"deleted_at": nil,
+			"status":     "stopped",
+			"updated_at": time.Now(),
+		}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	restored, err := s.GetServer(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.wsManager != nil {
+		s.wsManager.BroadcastServerCreated(restored, fmt.Sprintf("服务器 \"%s\" 已从回收站恢复", restored.Name))
+	}
+
+	return restored, nil
+}
+
+// serverTable 按服务器ID关联服务器的表
+type serverTable struct {
+	table    string
+	column   string // 关联服务器ID的列
+	optional bool   // 列值为0表示不关联具体服务器(如作用于全部服务器的告警规则)
+}
+
+// serverTables 关联服务器的表，永久删除服务器时一并删除其中的记录，数据库检查也据此查找孤立记录。
+// 新增关联服务器的表时需加入此列表；审计日志和落地机注册记录作为历史保留，不在其中
+var serverTables = []serverTable{
+	{table: "traffic_logs", column: "server_id"},
+	{table: "traffic_samples", column: "server_id"},
+	{table: "server_revisions", column: "server_id"},
+	{table: "alert_rules", column: "server_id", optional: true},
+	{table: "alert_records", column: "server_id"},
+	{table: "proxy_inbounds", column: "exit_server_id"},
+	{table: "server_usages", column: "server_id"},
+	{table: "account_usages", column: "server_id"},
+	{table: "usage_reports", column: "server_id"},
+	{table: "portal_tokens", column: "server_id"},
+	{table: "server_drifts", column: "server_id"},
+	{table: "server_images", column: "server_id"},
+	{table: "server_status_changes", column: "server_id"},
+	{table: "synthetic_checks", column: "server_id"},
+	{table: "server_operations", column: "server_id"},
+}
+
+// PurgeServer 永久删除回收站中的服务器及其全部关联记录
+func (s *L2TPService) PurgeServer(id uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).Delete(&database.L2TPServer{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("回收站中不存在该服务器")
+		}
+
+		// 代理账号流量按代理关联，随以该服务器为出口的代理一起删除
+		if err := tx.Exec("DELETE FROM proxy_traffics WHERE proxy_id IN (SELECT id FROM proxy_inbounds WHERE exit_server_id = ?)", id).Error; err != nil {
+			return err
+		}
+		for _, table := range serverTables {
+			if err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s = ?", table.table, table.column), id).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// PurgeExpiredTrash 永久删除超过保留期的回收站服务器
+func (s *L2TPService) PurgeExpiredTrash(retention time.Duration) (int, error) {
+	var ids []uint
+	cutoff := time.Now().Add(-retention)
+	err := s.db.Unscoped().Model(&database.L2TPServer{}).
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, id := range ids {
+		if err := s.PurgeServer(id); err != nil {
+			slog.Error("永久删除服务器失败", "server_id", id, "error", err)
+			continue
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+// StartTrashPurger 启动回收站定期清理协程，保留天数读取自设置，<=0时跳过清理；同时清理过期的幂等键
+func (s *L2TPService) StartTrashPurger(ctx context.Context, settings *SettingsService) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		if retentionDays := settings.Int(SettingTrashRetentionDays); retentionDays > 0 {
+			if purged, err := s.PurgeExpiredTrash(time.Duration(retentionDays) * 24 * time.Hour); err != nil {
+				slog.Error("清理回收站失败", "error", err)
+			} else if purged > 0 {
+				slog.Info("已永久删除超过保留期的服务器", "count", purged)
+			}
+		}
+		if _, err := s.PurgeIdempotencyKeys(); err != nil {
+			slog.Error("清理过期幂等键失败", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// StartServer 启动L2TP服务器，ctx用于关联异步任务日志与发起请求
+func (s *L2TPService) StartServer(ctx context.Context, id uint) error {
+	_, err := s.StartServerJob(ctx, id)
+	return err
+}
+
+// StartServerJob 启动L2TP服务器并返回后台执行的任务。ctx中带有任务时(重启的启动阶段)沿用该任务
+func (s *L2TPService) StartServerJob(ctx context.Context, id uint) (*Job, error) {
 	server, err := s.GetServer(id)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if server.Status == "running" {
-		return fmt.Errorf("服务器已在运行中")
+		return nil, fmt.Errorf("服务器已在运行中")
 	}
 
 	if server.Status == "starting" {
-		return fmt.Errorf("服务器正在启动中，请稍候")
+		return nil, fmt.Errorf("服务器正在启动中，请稍候")
+	}
+
+	// 关闭面板期间不再接受新操作，重启的启动阶段属于进行中的操作
+	if jobFromContext(ctx) == nil {
+		if err := s.operations.accepting(); err != nil {
+			return nil, err
+		}
 	}
 
 	// 检查服务器是否过期
 	if time.Now().After(server.ExpireDate) {
-		return fmt.Errorf("服务器已过期，无法启动")
+		return nil, fmt.Errorf("服务器已过期，无法启动")
+	}
+
+	// 检查所属租户的月流量配额
+	if err := checkTenantTraffic(s.db, server.TenantID); err != nil {
+		return nil, err
 	}
 
 	// 先更新状态为"启动中"
 	if err := s.updateServerStatus(id, "starting"); err != nil {
-		return fmt.Errorf("更新服务器状态失败: %v", err)
+		return nil, fmt.Errorf("更新服务器状态失败: %v", err)
 	}
 
-	// 异步启动服务器，避免阻塞前端请求
-	go s.asyncStartServer(id, server)
+	// 重启时沿用停止阶段创建的任务
+	job := jobFromContext(ctx)
+	if job != nil {
+		job.NextPhase()
+	} else {
+		job = s.newServerJob(JobKindStart, id, server.Type)
+	}
 
-	return nil
+	// 异步启动服务器，避免阻塞前端请求。异步任务不随请求结束而取消
+	s.runServerJob(ctx, job, func(s *L2TPService, ctx context.Context) {
+		s.asyncStartServer(ctx, id, server, job)
+	})
+
+	return job, nil
 }
 
 // asyncStartServer 异步启动服务器
-func (s *L2TPService) asyncStartServer(id uint, server *database.L2TPServer) {
-	sshService := NewSSHService()
+func (s *L2TPService) asyncStartServer(ctx context.Context, id uint, server *database.L2TPServer, job *Job) {
+	sshService := s.ssh
+	jobCallback := job.Callback()
 	
 	// 创建详细状态回调函数
 	detailCallback := func(step string, success bool, message string) {
+		jobCallback(step, success, message)
 		if s.wsManager != nil {
 			// 发送详细的进度更新
 			var status string
@@ -222,46 +683,89 @@ func (s *L2TPService) asyncStartServer(id uint, server *database.L2TPServer) {
 	
 	// 启动容器
 	if err := sshService.StartL2TPContainerWithCallback(server, detailCallback); err != nil {
-		s.updateServerStatus(id, "error")
+		slog.ErrorContext(ctx, "启动服务器失败", "server_id", id, "error", err)
+		job.Finish(err)
+		s.failServer(ctx, id, job)
 		return
 	}
 	
 	// 容器启动验证完成，立即更新状态为运行中
+	slog.InfoContext(ctx, "服务器已启动", "server_id", id)
+	job.Finish(nil)
 	s.updateServerStatus(id, "running")
 }
 
-// StopServer 停止L2TP服务器
-func (s *L2TPService) StopServer(id uint) error {
+// RedeployServer 同步重建运行中服务器的落地机容器：重新拉取镜像并按当前配置启动，用于滚动升级
+func (s *L2TPService) RedeployServer(ctx context.Context, id uint) error {
 	server, err := s.GetServer(id)
 	if err != nil {
 		return err
 	}
+	if server.Status != "running" {
+		return fmt.Errorf("服务器未运行")
+	}
+	if err := s.updateServerStatus(id, "starting"); err != nil {
+		return fmt.Errorf("更新服务器状态失败: %v", err)
+	}
+
+	job := s.newServerJob(JobKindUpgrade, id, server.Type)
+	if err := s.ssh.WithContext(logger.WithTrace(ctx, job.Trace())).StartL2TPContainerWithCallback(server, job.Callback()); err != nil {
+		slog.ErrorContext(ctx, "重建服务器容器失败", "server_id", id, "error", err)
+		job.Finish(err)
+		s.updateServerStatus(id, "error")
+		return err
+	}
+	job.Finish(nil)
+	return s.updateServerStatus(id, "running")
+}
+
+// StopServer 停止L2TP服务器，ctx用于关联异步任务日志与发起请求
+func (s *L2TPService) StopServer(ctx context.Context, id uint) error {
+	_, err := s.StopServerJob(ctx, id)
+	return err
+}
+
+// StopServerJob 停止L2TP服务器并返回后台执行的任务
+func (s *L2TPService) StopServerJob(ctx context.Context, id uint) (*Job, error) {
+	server, err := s.GetServer(id)
+	if err != nil {
+		return nil, err
+	}
 
 	if server.Status == "stopped" {
-		return fmt.Errorf("服务器已停止")
+		return nil, fmt.Errorf("服务器已停止")
 	}
 
 	if server.Status == "stopping" {
-		return fmt.Errorf("服务器正在停止中，请稍候")
+		return nil, fmt.Errorf("服务器正在停止中，请稍候")
+	}
+
+	if err := s.operations.accepting(); err != nil {
+		return nil, err
 	}
 
 	// 先更新状态为"停止中"
 	if err := s.updateServerStatus(id, "stopping"); err != nil {
-		return fmt.Errorf("更新服务器状态失败: %v", err)
+		return nil, fmt.Errorf("更新服务器状态失败: %v", err)
 	}
 
 	// 异步停止服务器
-	go s.asyncStopServer(id, server)
+	job := s.newServerJob(JobKindStop, id, server.Type)
+	s.runServerJob(ctx, job, func(s *L2TPService, ctx context.Context) {
+		s.asyncStopServer(ctx, id, server, job)
+	})
 
-	return nil
+	return job, nil
 }
 
 // asyncStopServer 异步停止服务器
-func (s *L2TPService) asyncStopServer(id uint, server *database.L2TPServer) {
-	sshService := NewSSHService()
+func (s *L2TPService) asyncStopServer(ctx context.Context, id uint, server *database.L2TPServer, job *Job) {
+	sshService := s.ssh
+	jobCallback := job.Callback()
 	
 	// 创建详细状态回调函数
 	detailCallback := func(step string, success bool, message string) {
+		jobCallback(step, success, message)
 		if s.wsManager != nil {
 			// 发送详细的进度更新
 			var status string
@@ -278,47 +782,61 @@ func (s *L2TPService) asyncStopServer(id uint, server *database.L2TPServer) {
 	
 	// 停止容器
 	if err := sshService.StopL2TPContainerWithCallback(server, detailCallback); err != nil {
-		s.updateServerStatus(id, "error")
+		slog.ErrorContext(ctx, "停止服务器失败", "server_id", id, "error", err)
+		job.Finish(err)
+		s.failServer(ctx, id, job)
 		return
 	}
 	
 	// 容器停止操作完成，立即更新状态为已停止
+	slog.InfoContext(ctx, "服务器已停止", "server_id", id)
+	job.Finish(nil)
 	s.updateServerStatus(id, "stopped")
 }
 
 // RestartServer 重启L2TP服务器
-func (s *L2TPService) RestartServer(id uint) error {
+func (s *L2TPService) RestartServer(ctx context.Context, id uint) error {
+	_, err := s.RestartServerJob(ctx, id)
+	return err
+}
+
+// RestartServerJob 重启L2TP服务器并返回后台执行的任务：运行中的服务器先停止再启动，
+// 两个阶段共用一个任务；未运行的服务器直接启动
+func (s *L2TPService) RestartServerJob(ctx context.Context, id uint) (*Job, error) {
 	server, err := s.GetServer(id)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// 如果服务器正在运行，先停止它
-	if server.Status == "running" {
-		if err := s.StopServer(id); err != nil {
-			return err
-		}
-		
-		// 异步等待停止完成后启动
-		go s.asyncRestartServer(id)
-		return nil
+	// 如果服务器已经停止，直接启动
+	if server.Status != "running" {
+		return s.StartServerJob(ctx, id)
 	}
 
-	// 如果服务器已经停止，直接启动
-	return s.StartServer(id)
-}
+	if err := s.operations.accepting(); err != nil {
+		return nil, err
+	}
 
-// asyncRestartServer 异步重启服务器
-func (s *L2TPService) asyncRestartServer(id uint) {
-	server, err := s.GetServer(id)
-	if err != nil {
-		return
+	if err := s.updateServerStatus(id, "stopping"); err != nil {
+		return nil, fmt.Errorf("更新服务器状态失败: %v", err)
 	}
 
-	sshService := NewSSHService()
+	// 异步停止后启动
+	job := s.newServerJob(JobKindRestart, id, server.Type)
+	s.runServerJob(ctx, job, func(s *L2TPService, ctx context.Context) {
+		s.asyncRestartServer(ctx, id, server, job)
+	})
+	return job, nil
+}
+
+// asyncRestartServer 异步重启服务器
+func (s *L2TPService) asyncRestartServer(ctx context.Context, id uint, server *database.L2TPServer, job *Job) {
+	sshService := s.ssh
+	jobCallback := job.Callback()
 	
 	// 创建详细状态回调函数用于停止过程
 	stopDetailCallback := func(step string, success bool, message string) {
+		jobCallback(step, success, message)
 		if s.wsManager != nil {
 			var status string
 			if success {
@@ -334,15 +852,71 @@ func (s *L2TPService) asyncRestartServer(id uint) {
 	
 	// 先停止容器
 	if err := sshService.StopL2TPContainerWithCallback(server, stopDetailCallback); err != nil {
-		s.updateServerStatus(id, "error")
+		slog.ErrorContext(ctx, "重启服务器时停止失败", "server_id", id, "error", err)
+		job.Finish(err)
+		s.failServer(ctx, id, job)
 		return
 	}
 	
-	// 容器停止完成，短暂等待确保清理完成后重新启动
-	go func() {
-		time.Sleep(1 * time.Second)
-		s.StartServer(id)
-	}()
+	// 容器停止完成，短暂等待确保清理完成后重新启动，启动阶段沿用同一任务
+	time.Sleep(1 * time.Second)
+	if _, err := s.StartServerJob(withJob(ctx, job), id); err != nil {
+		slog.ErrorContext(ctx, "重启服务器时启动失败", "server_id", id, "error", err)
+		job.Finish(err)
+	}
+}
+
+// newServerJob 创建服务器操作任务，设置了任务登记表时登记到任务列表
+func (s *L2TPService) newServerJob(kind string, serverID uint, serverType string) *Job {
+	if s.jobs != nil {
+		return s.jobs.NewServerJob(kind, serverID, serverType)
+	}
+	return newServerJob(s.wsManager, kind, serverID, serverType)
+}
+
+// SetErrorReporter 设置异常上报，后台执行的服务器操作发生panic时经由它记录和上报
+func (s *L2TPService) SetErrorReporter(reporter *ErrorReporter) {
+	s.reporter = reporter
+}
+
+// SetCredentials 设置密钥生成服务，此后创建和修改服务器时PSK或用户密码为auto的由面板生成
+func (s *L2TPService) SetCredentials(credentials *CredentialService) {
+	s.credentials = credentials
+}
+
+// SetNATChecks 设置NAT-T检测服务，此后服务器状态中包含最近一次的检测结果和警告
+func (s *L2TPService) SetNATChecks(natChecks *NATCheckService) {
+	s.natChecks = natChecks
+}
+
+// SetJobs 设置任务登记表，此后创建的服务器操作任务可通过任务列表查询
+func (s *L2TPService) SetJobs(jobs *JobService) {
+	s.jobs = jobs
+}
+
+// SetDesiredState 设置服务器期望状态，由协调器负责收敛
+func (s *L2TPService) SetDesiredState(id uint, desired string) error {
+	if desired != "running" && desired != "stopped" {
+		return fmt.Errorf("无效的期望状态: %s", desired)
+	}
+	if desired == "running" {
+		server, err := s.GetServer(id)
+		if err != nil {
+			return err
+		}
+		if err := checkTenantTraffic(s.db, server.TenantID); err != nil {
+			return err
+		}
+	}
+
+	result := s.db.Model(&database.L2TPServer{}).Where("id = ?", id).Update("desired_state", desired)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("服务器不存在")
+	}
+	return nil
 }
 
 // GetServerStatus 获取服务器实时状态
@@ -356,6 +930,7 @@ func (s *L2TPService) GetServerStatus(id uint) (map[string]interface{}, error) {
 		"id":         server.ID,
 		"name":       server.Name,
 		"host":       server.Host,
+		"type":       server.Type,
 		"l2tp_port":  server.L2TPPort,
 		"status":     server.Status,
 		"is_expired": server.IsExpired,
@@ -369,8 +944,7 @@ func (s *L2TPService) GetServerStatus(id uint) (map[string]interface{}, error) {
 	switch server.Status {
 	case "running":
 		// 获取容器详细状态
-		sshService := NewSSHService()
-		containerStatus, err := sshService.GetContainerStatus(server)
+		containerStatus, err := s.ssh.GetContainerStatus(server)
 		if err != nil {
 			// 无法获取容器状态，可能容器已停止但数据库状态未更新
 			status["container_status"] = "error"
@@ -407,6 +981,10 @@ func (s *L2TPService) GetServerStatus(id uint) (map[string]interface{}, error) {
 	case "error":
 		status["container_status"] = "error"
 		status["message"] = "服务启动失败，请检查服务器配置或重试"
+
+	case ServerStatusInterrupted:
+		status["container_status"] = ServerStatusInterrupted
+		status["message"] = "操作因面板关闭而中断，面板启动后将恢复"
 		
 	case "stopped":
 		status["container_status"] = "stopped"
@@ -417,6 +995,17 @@ func (s *L2TPService) GetServerStatus(id uint) (map[string]interface{}, error) {
 		status["message"] = "未知状态"
 	}
 
+	// 最近一次NAT-T检测的结果，发现中转或出口路径丢弃保活包时返回警告
+	if !isXrayServer(server.Type) {
+		status["nat_keepalive"] = natKeepalive(server)
+	}
+	if check := s.natChecks.Latest(server.ID); check != nil {
+		status["nat_t"] = check
+		if len(check.Warnings) > 0 {
+			status["nat_t_warning"] = strings.Join(check.Warnings, "；")
+		}
+	}
+
 	return status, nil
 }
 
@@ -443,7 +1032,17 @@ func (s *L2TPService) FormatUsers(users []L2TPUser) (string, error) {
 
 // updateServerStatus 更新服务器状态
 func (s *L2TPService) updateServerStatus(id uint, status string) error {
-	result := s.db.Model(&database.L2TPServer{}).
+	return s.updateServerStatusMessage(id, status, getStatusMessage(status))
+}
+
+// updateServerStatusMessage 更新服务器状态，message随WebSocket推送和状态事件一起发出
+func (s *L2TPService) updateServerStatusMessage(id uint, status, message string) error {
+	// 状态变化在操作被取消或超时后也要保存，否则服务器会停留在启动中/停止中
+	db := s.db
+	if s.ctx != nil {
+		db = db.WithContext(context.WithoutCancel(s.ctx))
+	}
+	result := db.Model(&database.L2TPServer{}).
 		Where("id = ?", id).
 		Updates(map[string]interface{}{
 			"status":     status,
@@ -460,9 +1059,15 @@ func (s *L2TPService) updateServerStatus(id uint, status string) error {
 	
 	// 通过WebSocket推送状态变化
 	if s.wsManager != nil {
-		message := getStatusMessage(status)
 		s.wsManager.BroadcastServerStatus(id, status, message)
 	}
+
+	s.recordAvailability(id, statusAvailability[status], getStatusMessage(status))
+
+	// 运行状态的终态变化通知外部渠道
+	if eventType, ok := statusEvents[status]; ok {
+		s.publish(eventType, id, "", message)
+	}
 	
 	return nil
 }
@@ -480,18 +1085,41 @@ func getStatusMessage(status string) string {
 		return "服务器正在停止..."
 	case "error":
 		return "服务器启动失败"
+	case ServerStatusInterrupted:
+		return "操作因面板关闭而中断，面板启动后将恢复"
 	default:
 		return "状态未知"
 	}
 }
 
-// GetTrafficLogs 获取流量日志
-func (s *L2TPService) GetTrafficLogs(serverID uint, limit int) ([]database.TrafficLog, error) {
+// TrafficLogQuery 流量日志查询条件
+type TrafficLogQuery struct {
+	ServerID uint
+	ClientIP string
+	Since    time.Time
+	Until    time.Time
+	Limit    int
+}
+
+// GetTrafficLogs 获取流量日志，支持按时间范围和客户端IP过滤
+func (s *L2TPService) GetTrafficLogs(q TrafficLogQuery) ([]database.TrafficLog, error) {
 	var logs []database.TrafficLog
-	query := s.db.Where("server_id = ?", serverID).Order("created_at DESC")
+	query := s.db.Order("created_at DESC")
 	
-	if limit > 0 {
-		query = query.Limit(limit)
+	if q.ServerID > 0 {
+		query = query.Where("server_id = ?", q.ServerID)
+	}
+	if q.ClientIP != "" {
+		query = query.Where("client_ip = ?", q.ClientIP)
+	}
+	if !q.Since.IsZero() {
+		query = query.Where("created_at >= ?", q.Since)
+	}
+	if !q.Until.IsZero() {
+		query = query.Where("created_at < ?", q.Until)
+	}
+	if q.Limit > 0 {
+		query = query.Limit(q.Limit)
 	}
 	
 	result := query.Find(&logs)
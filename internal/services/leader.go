@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// haLockKey 主节点选举使用的Postgres advisory lock键
+const haLockKey int64 = 0x4c3254504d475200 // "L2TPMGR"
+
+// 选举参数：备用节点每haRetryInterval尝试一次获取锁；主节点每haCheckInterval检查持锁连接，
+// 连续haCheckTimeout无法确认时视为失去主节点身份
+const (
+	haRetryInterval = 2 * time.Second
+	haCheckInterval = 2 * time.Second
+	haCheckTimeout  = 3 * time.Second
+)
+
+// LeaderElector 高可用主备选举：多个面板实例共享Postgres，持有会话级advisory lock的实例为主节点，
+// 负责转发器和后台任务。主节点进程退出或与数据库断开时锁自动释放，备用节点在数秒内接管
+type LeaderElector struct {
+	db     *gorm.DB
+	name   string
+	leader atomic.Bool
+	lost   chan struct{}
+}
+
+// NewLeaderElector 创建主节点选举，db为nil时(非高可用模式)本实例始终为主节点
+func NewLeaderElector(db *gorm.DB, name string) *LeaderElector {
+	e := &LeaderElector{db: db, name: name, lost: make(chan struct{})}
+	if db == nil {
+		e.leader.Store(true)
+	}
+	return e
+}
+
+// Enabled 是否启用了高可用选举
+func (e *LeaderElector) Enabled() bool {
+	return e.db != nil
+}
+
+// IsLeader 本实例当前是否为主节点
+func (e *LeaderElector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Name 本实例名称
+func (e *LeaderElector) Name() string {
+	return e.name
+}
+
+// Role 本实例角色，leader或standby
+func (e *LeaderElector) Role() string {
+	if e.IsLeader() {
+		return "leader"
+	}
+	return "standby"
+}
+
+// Lost 成为主节点后失去锁时关闭，调用方应停止转发器并退出进程，避免与新的主节点同时运行
+func (e *LeaderElector) Lost() <-chan struct{} {
+	return e.lost
+}
+
+// Run 竞选主节点，当选后调用onElected并持续确认锁，直到ctx结束或失去锁。非高可用模式下立即调用onElected
+func (e *LeaderElector) Run(ctx context.Context, onElected func()) {
+	if !e.Enabled() {
+		onElected()
+		return
+	}
+
+	sqlDB, err := e.db.DB()
+	if err != nil {
+		slog.Error("高可用选举无法获取数据库连接", "error", err)
+		return
+	}
+
+	slog.Info("以备用节点启动，等待成为主节点", "node", e.name)
+	for {
+		conn, err := e.tryAcquire(ctx, sqlDB)
+		if err != nil {
+			slog.Warn("竞选主节点失败", "node", e.name, "error", err)
+		}
+		if conn != nil {
+			e.leader.Store(true)
+			slog.Info("已成为主节点", "node", e.name)
+			onElected()
+			e.hold(ctx, conn)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(haRetryInterval):
+		}
+	}
+}
+
+// tryAcquire 在专用连接上尝试获取advisory lock，成功时返回持锁连接
+func (e *LeaderElector) tryAcquire(ctx context.Context, sqlDB *sql.DB) (*sql.Conn, error) {
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", haLockKey).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !acquired {
+		conn.Close()
+		return nil, nil
+	}
+	return conn, nil
+}
+
+// hold 持有锁期间定期在持锁连接上确认，连接失效说明锁已释放(数据库会话结束)
+func (e *LeaderElector) hold(ctx context.Context, conn *sql.Conn) {
+	ticker := time.NewTicker(haCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// 正常退出时释放锁，备用节点无需等待会话超时即可接管
+			unlockCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+			conn.ExecContext(unlockCtx, "SELECT pg_advisory_unlock($1)", haLockKey)
+			cancel()
+			conn.Close()
+			return
+		case <-ticker.C:
+			checkCtx, cancel := context.WithTimeout(ctx, haCheckTimeout)
+			err := conn.PingContext(checkCtx)
+			cancel()
+			if err != nil && ctx.Err() == nil {
+				slog.Error("主节点持锁连接已断开，失去主节点身份", "node", e.name, "error", err)
+				e.leader.Store(false)
+				conn.Close()
+				close(e.lost)
+				return
+			}
+		}
+	}
+}
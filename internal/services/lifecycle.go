@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// 组件状态
+const (
+	ComponentPending  = "pending"  // 尚未启动
+	ComponentStarting = "starting" // 正在启动
+	ComponentRunning  = "running"  // 已启动
+	ComponentFailed   = "failed"   // 启动失败
+	ComponentStopped  = "stopped"  // 已停止
+)
+
+// Component 由生命周期管理器按顺序启动、逆序停止的组件
+type Component struct {
+	Name  string
+	Start func(ctx context.Context) error // 启动完成后返回，返回错误时中止后续组件的启动；为nil表示无需启动
+	Stop  func(ctx context.Context) error // 为nil表示无需停止
+	Sub   *Lifecycle                      // 由本组件启动的下一级组件，状态一并列出
+}
+
+// ComponentStatus 组件的运行状态
+type ComponentStatus struct {
+	Name      string     `json:"name"`
+	State     string     `json:"state"`
+	Error     string     `json:"error,omitempty"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	StartupMs int64      `json:"startup_ms"` // 启动耗时
+}
+
+// lifecycleComponent 组件及其状态
+type lifecycleComponent struct {
+	Component
+	status ComponentStatus
+}
+
+// Lifecycle 组件生命周期管理：按登记顺序启动，任一组件启动失败时逆序停止已启动的组件并返回错误；
+// 停止时逆序进行。各组件状态用于就绪检查
+type Lifecycle struct {
+	components []*lifecycleComponent
+	mutex      sync.RWMutex
+}
+
+// NewLifecycle 创建生命周期管理器
+func NewLifecycle() *Lifecycle {
+	return &Lifecycle{}
+}
+
+// Add 登记组件，启动顺序与登记顺序相同
+func (l *Lifecycle) Add(components ...Component) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for _, component := range components {
+		l.components = append(l.components, &lifecycleComponent{
+			Component: component,
+			status:    ComponentStatus{Name: component.Name, State: ComponentPending},
+		})
+	}
+}
+
+// setState 更新组件状态
+func (l *Lifecycle) setState(component *lifecycleComponent, state string, err error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	component.status.State = state
+	component.status.Error = ""
+	if err != nil {
+		component.status.Error = err.Error()
+	}
+}
+
+// Start 按顺序启动全部组件
+func (l *Lifecycle) Start(ctx context.Context) error {
+	l.mutex.RLock()
+	components := append([]*lifecycleComponent(nil), l.components...)
+	l.mutex.RUnlock()
+
+	for i, component := range components {
+		if err := ctx.Err(); err != nil {
+			l.stop(context.Background(), components[:i])
+			return err
+		}
+		l.setState(component, ComponentStarting, nil)
+		start := time.Now()
+		var err error
+		if component.Start != nil {
+			err = component.Start(ctx)
+		}
+		if err != nil {
+			l.setState(component, ComponentFailed, err)
+			l.stop(context.Background(), components[:i])
+			return fmt.Errorf("启动%s失败: %w", component.Name, err)
+		}
+
+		l.mutex.Lock()
+		component.status.State = ComponentRunning
+		component.status.StartedAt = &start
+		component.status.StartupMs = time.Since(start).Milliseconds()
+		l.mutex.Unlock()
+		slog.Debug("组件已启动", "component", component.Name, "duration", time.Since(start))
+	}
+	return nil
+}
+
+// Stop 逆序停止已启动的组件，ctx传给各组件的Stop用于限制等待时间
+func (l *Lifecycle) Stop(ctx context.Context) {
+	l.mutex.RLock()
+	components := append([]*lifecycleComponent(nil), l.components...)
+	l.mutex.RUnlock()
+	l.stop(ctx, components)
+}
+
+// stop 逆序停止components中已启动的组件
+func (l *Lifecycle) stop(ctx context.Context, components []*lifecycleComponent) {
+	for i := len(components) - 1; i >= 0; i-- {
+		component := components[i]
+		l.mutex.RLock()
+		state := component.status.State
+		l.mutex.RUnlock()
+		if state != ComponentRunning {
+			continue
+		}
+
+		var err error
+		if component.Stop != nil {
+			err = component.Stop(ctx)
+		}
+		if err != nil {
+			slog.Error("组件停止失败", "component", component.Name, "error", err)
+		}
+		l.setState(component, ComponentStopped, err)
+	}
+}
+
+// Status 各组件的状态，下一级组件列在其上级之后
+func (l *Lifecycle) Status() []ComponentStatus {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	statuses := make([]ComponentStatus, 0, len(l.components))
+	for _, component := range l.components {
+		statuses = append(statuses, component.status)
+		if component.Sub != nil {
+			statuses = append(statuses, component.Sub.Status()...)
+		}
+	}
+	return statuses
+}
+
+// Ready 全部组件(含下一级组件)是否已启动
+func (l *Lifecycle) Ready() bool {
+	for _, status := range l.Status() {
+		if status.State != ComponentRunning {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/xtls/xray-core/core"
+	featstats "github.com/xtls/xray-core/features/stats"
+)
+
+// throughputInterval 读取Xray计数器的间隔，流量统计和流量日志按设置traffic_collect_interval汇总
+const throughputInterval = time.Second
+
+// ThroughputSample 单个监听端口最近一秒的吞吐量
+type ThroughputSample struct {
+	ServerID uint      `json:"server_id"`
+	Port     int       `json:"port"`
+	Uplink   int64     `json:"uplink"`   // 客户端发往落地机，字节/秒
+	Downlink int64     `json:"downlink"` // 落地机返回客户端，字节/秒
+	Time     time.Time `json:"time"`
+}
+
+// readTrafficCounters 读取并清零端口的入站上下行计数器
+func readTrafficCounters(port int, instance *core.Instance) (int64, int64) {
+	manager, ok := instance.GetFeature(featstats.ManagerType()).(featstats.Manager)
+	if !ok {
+		return 0, 0
+	}
+
+	tag := fmt.Sprintf("dokodemo-in-%d", port)
+	var uplink, downlink int64
+	if counter := manager.GetCounter("inbound>>>" + tag + ">>>traffic>>>uplink"); counter != nil {
+		uplink = counter.Set(0)
+	}
+	if counter := manager.GetCounter("inbound>>>" + tag + ">>>traffic>>>downlink"); counter != nil {
+		downlink = counter.Set(0)
+	}
+	return uplink, downlink
+}
+
+// recordThroughput 保存端口最新的吞吐量，elapsed为距上次采样的实际间隔
+func (r *RoutingService) recordThroughput(serverID uint, port int, uplink, downlink int64, elapsed time.Duration) {
+	if elapsed <= 0 {
+		elapsed = throughputInterval
+	}
+	sample := ThroughputSample{
+		ServerID: serverID,
+		Port:     port,
+		Uplink:   uplink * int64(time.Second) / int64(elapsed),
+		Downlink: downlink * int64(time.Second) / int64(elapsed),
+		Time:     time.Now(),
+	}
+
+	r.statsMutex.Lock()
+	r.throughput[port] = sample
+	r.statsMutex.Unlock()
+}
+
+// MergeThroughput 合并中转节点上报的吞吐量，与本机转发器的采样一起推送
+func (r *RoutingService) MergeThroughput(samples []ThroughputSample) {
+	now := time.Now()
+	r.statsMutex.Lock()
+	for _, sample := range samples {
+		sample.Time = now
+		r.throughput[sample.Port] = sample
+	}
+	r.statsMutex.Unlock()
+}
+
+// Throughput 获取各监听端口的实时吞吐量(按端口排序)，转发器停止后的旧数据会被丢弃
+func (r *RoutingService) Throughput() []ThroughputSample {
+	stale := time.Now().Add(-3 * throughputInterval)
+
+	r.statsMutex.Lock()
+	samples := make([]ThroughputSample, 0, len(r.throughput))
+	for port, sample := range r.throughput {
+		if sample.Time.Before(stale) {
+			delete(r.throughput, port)
+			continue
+		}
+		samples = append(samples, sample)
+	}
+	r.statsMutex.Unlock()
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i].Port < samples[j].Port })
+	return samples
+}
+
+// streamThroughput 每秒向订阅了traffic主题的WebSocket客户端推送吞吐量，无订阅者时跳过
+func (r *RoutingService) streamThroughput() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(throughputInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+			if r.wsManager == nil || r.wsManager.TopicSubscribers(WSTopicTraffic) == 0 {
+				continue
+			}
+			r.wsManager.BroadcastTraffic(r.Throughput())
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"l2tp-manager/internal/database"
+
+	"golang.org/x/time/rate"
+)
+
+// 日志流状态
+const (
+	LogStreamFollowing = "following" // 正在跟随
+	LogStreamStopped   = "stopped"   // 客户端已暂停
+	LogStreamEnded     = "ended"     // 远端日志结束(如容器已停止)
+	LogStreamError     = "error"     // SSH连接或命令失败
+)
+
+// LogStreamEvent 日志流推送给客户端的消息
+type LogStreamEvent struct {
+	Type    string `json:"type"` // line/status/dropped
+	Line    string `json:"line,omitempty"`
+	Status  string `json:"status,omitempty"`
+	Message string `json:"message,omitempty"`
+	Count   int64  `json:"count,omitempty"` // dropped: 因超过行速率被丢弃的行数
+}
+
+// ContainerLogStream 通过持久SSH会话跟随容器日志，支持暂停/继续，并按行速率限制推送
+type ContainerLogStream struct {
+	ssh     ExitNodeClient
+	server  *database.L2TPServer
+	tail    int
+	limiter *rate.Limiter
+	events  chan LogStreamEvent
+	dropped atomic.Int64
+
+	current *followSession // 当前跟随会话，nil表示未在跟随
+	since   string         // 已推送日志中最新的docker时间戳，继续跟随时从此处开始
+	mutex   sync.Mutex
+}
+
+// followSession 一次跟随会话
+type followSession struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewContainerLogStream 创建日志流，通过ssh跟随server的容器日志，tail为首次跟随时先输出的行数，linesPerSecond为推送速率上限
+func NewContainerLogStream(ssh ExitNodeClient, server *database.L2TPServer, tail, linesPerSecond int) *ContainerLogStream {
+	return &ContainerLogStream{
+		ssh:     ssh,
+		server:  server,
+		tail:    tail,
+		limiter: rate.NewLimiter(rate.Limit(linesPerSecond), linesPerSecond),
+		events:  make(chan LogStreamEvent, 256),
+	}
+}
+
+// Events 日志行和状态变化
+func (s *ContainerLogStream) Events() <-chan LogStreamEvent {
+	return s.events
+}
+
+// TakeDropped 返回并清零自上次调用以来丢弃的行数
+func (s *ContainerLogStream) TakeDropped() int64 {
+	return s.dropped.Swap(0)
+}
+
+// Follow 开始跟随，已在跟随时忽略。ctx取消时结束跟随
+func (s *ContainerLogStream) Follow(ctx context.Context) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.current != nil {
+		return
+	}
+	session := &followSession{}
+	session.ctx, session.cancel = context.WithCancel(ctx)
+	s.current = session
+	go s.run(session, s.since)
+}
+
+// Stop 暂停跟随，关闭SSH会话
+func (s *ContainerLogStream) Stop() {
+	s.mutex.Lock()
+	session := s.current
+	s.current = nil
+	s.mutex.Unlock()
+	if session != nil {
+		session.cancel()
+		s.emit(context.Background(), LogStreamEvent{Type: "status", Status: LogStreamStopped})
+	}
+}
+
+// run 执行一次跟随会话
+func (s *ContainerLogStream) run(session *followSession, since string) {
+	ctx := session.ctx
+	s.emit(ctx, LogStreamEvent{Type: "status", Status: LogStreamFollowing})
+
+	err := s.ssh.FollowServerLogs(ctx, s.server, s.tail, since, func(line string) {
+		if timestamp, ok := logTimestamp(line); ok {
+			// 继续跟随时 --since 包含该时刻本身的日志，跳过已推送过的行
+			if since != "" && timestamp <= since {
+				return
+			}
+			s.mutex.Lock()
+			if timestamp > s.since {
+				s.since = timestamp
+			}
+			s.mutex.Unlock()
+		}
+		if !s.limiter.Allow() {
+			s.dropped.Add(1)
+			return
+		}
+		// 日志行不丢弃，客户端消费慢时阻塞读取，由SSH连接反压
+		select {
+		case s.events <- LogStreamEvent{Type: "line", Line: line}:
+		case <-ctx.Done():
+		}
+	})
+	if ctx.Err() != nil {
+		// 由Stop或连接断开结束
+		return
+	}
+
+	s.mutex.Lock()
+	if s.current == session {
+		s.current = nil
+	}
+	s.mutex.Unlock()
+	session.cancel()
+	if err != nil {
+		s.emit(context.Background(), LogStreamEvent{Type: "status", Status: LogStreamError, Message: err.Error()})
+	} else {
+		s.emit(context.Background(), LogStreamEvent{Type: "status", Status: LogStreamEnded})
+	}
+}
+
+// emit 推送状态事件，ctx取消或客户端超过1秒未消费时放弃
+func (s *ContainerLogStream) emit(ctx context.Context, event LogStreamEvent) {
+	select {
+	case s.events <- event:
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+	}
+}
+
+// logTimestamp 解析日志行开头的docker时间戳
+func logTimestamp(line string) (string, bool) {
+	timestamp, _, _ := strings.Cut(line, " ")
+	if _, err := time.Parse(time.RFC3339Nano, timestamp); err != nil {
+		return "", false
+	}
+	return timestamp, true
+}
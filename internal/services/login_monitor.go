@@ -0,0 +1,60 @@
+package services
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"l2tp-manager/internal/database"
+
+	"gorm.io/gorm"
+)
+
+// LoginMonitor 记录用户登录来源IP，从未出现过的IP登录时发布通知
+type LoginMonitor struct {
+	db       *gorm.DB
+	notifier *NotificationService
+}
+
+// NewLoginMonitor 创建登录来源监控
+func NewLoginMonitor(db *gorm.DB, notifier *NotificationService) *LoginMonitor {
+	return &LoginMonitor{db: db, notifier: notifier}
+}
+
+// Observe 记录一次成功登录，返回是否为新IP。用户首次登录不视为新IP
+func (m *LoginMonitor) Observe(userID uint, username, ip string) bool {
+	now := time.Now()
+
+	var known int64
+	if err := m.db.Model(&database.LoginIP{}).Where("user_id = ?", userID).Count(&known).Error; err != nil {
+		slog.Warn("查询登录IP失败", "user_id", userID, "error", err)
+		return false
+	}
+
+	result := m.db.Model(&database.LoginIP{}).Where("user_id = ? AND ip = ?", userID, ip).Update("last_seen", now)
+	if result.Error != nil {
+		slog.Warn("更新登录IP失败", "user_id", userID, "error", result.Error)
+		return false
+	}
+	if result.RowsAffected > 0 {
+		return false
+	}
+
+	if err := m.db.Create(&database.LoginIP{UserID: userID, IP: ip, FirstSeen: now, LastSeen: now}).Error; err != nil {
+		slog.Warn("保存登录IP失败", "user_id", userID, "error", err)
+		return false
+	}
+	if known == 0 {
+		return false
+	}
+
+	slog.Warn("检测到新IP登录", "username", username, "client_ip", ip)
+	if m.notifier != nil {
+		m.notifier.Publish(Event{
+			Type:    EventLoginNewIP,
+			Message: fmt.Sprintf("用户 %s 从新IP %s 登录", username, ip),
+			Data:    map[string]interface{}{"username": username, "ip": ip},
+		})
+	}
+	return true
+}
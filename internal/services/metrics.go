@@ -0,0 +1,44 @@
+package services
+
+import (
+	"strings"
+
+	"l2tp-manager/internal/metrics"
+)
+
+// RegisterMetrics 注册转发流量、转发器和WebSocket连接的抓取时指标
+func RegisterMetrics(routing *RoutingService, ws *WSManager) {
+	forwardLabels := []string{"listen_port", "host", "direction"}
+	forwarded := func(bytes bool) func() []metrics.Sample {
+		return func() []metrics.Sample {
+			var samples []metrics.Sample
+			for key, stat := range routing.GetTrafficStats() {
+				// 统计键格式为 落地机地址:监听端口
+				sep := strings.LastIndex(key, ":")
+				host, port := key[:sep], key[sep+1:]
+				sent, received := stat.PacketsSent, stat.PacketsReceived
+				if bytes {
+					sent, received = stat.BytesSent, stat.BytesReceived
+				}
+				samples = append(samples,
+					metrics.Sample{Labels: []string{port, host, "sent"}, Value: float64(sent)},
+					metrics.Sample{Labels: []string{port, host, "received"}, Value: float64(received)},
+				)
+			}
+			return samples
+		}
+	}
+
+	metrics.NewCollector("l2tp_forwarded_bytes_total", "各中转端口转发的字节数",
+		metrics.TypeCounter, forwardLabels, forwarded(true))
+	metrics.NewCollector("l2tp_forwarded_packets_total", "各中转端口转发的数据包数",
+		metrics.TypeCounter, forwardLabels, forwarded(false))
+	metrics.NewCollector("l2tp_active_forwarders", "当前运行的转发器数量",
+		metrics.TypeGauge, nil, func() []metrics.Sample {
+			return []metrics.Sample{{Value: float64(routing.ForwarderCount())}}
+		})
+	metrics.NewCollector("l2tp_websocket_clients", "当前WebSocket连接数",
+		metrics.TypeGauge, nil, func() []metrics.Sample {
+			return []metrics.Sample{{Value: float64(ws.ClientCount())}}
+		})
+}
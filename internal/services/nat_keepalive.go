@@ -0,0 +1,259 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"l2tp-manager/internal/database"
+	"l2tp-manager/internal/metrics"
+
+	"gorm.io/gorm"
+)
+
+// NAT保活间隔的取值范围(秒)
+const (
+	minNATKeepalive = 5
+	maxNATKeepalive = 300
+)
+
+// 各协议默认的NAT保活间隔(秒)，WireGuard为wireGuardKeepalive
+const (
+	ikev2NATKeepalive   = 20 // strongSwan charon.keep_alive的默认值
+	openVPNNATKeepalive = 10
+	l2tpNATKeepalive    = 20 // RFC 3948建议的NAT-T保活间隔，L2TP/IPsec客户端普遍采用
+)
+
+// NAT-T检测参数
+const (
+	minNATCheckDuration = 10  // 最短采样时长(秒)
+	maxNATCheckDuration = 120 // 最长采样时长(秒)
+	// natKeepalivePacketLength NAT-T保活包的IPv4包长：IP头20字节、UDP头8字节和1字节的0xFF
+	natKeepalivePacketLength = 29
+	// xrayUDPIdleTimeout 用户态转发器(Xray默认策略)的连接空闲超时(秒)
+	xrayUDPIdleTimeout = 300
+	// conntrackUDPTimeoutPath 内核转发时已确认的UDP会话的conntrack超时
+	conntrackUDPTimeoutPath = "/proc/sys/net/netfilter/nf_conntrack_udp_timeout_stream"
+	// natProbeComment 采样时在落地机raw表中临时添加的计数规则的注释前缀
+	natProbeComment = "l2tp-manager-nat"
+)
+
+// 中转方式
+const (
+	NATRelayDirect    = "direct"     // 客户端直连落地机的UDP 4500端口(L2TP服务器不中转IPsec)
+	NATRelayUserspace = "userspace"  // 面板本机的用户态转发器
+	NATRelayKernel    = "kernel"     // 面板本机的内核转发
+	NATRelayNode      = "relay_node" // 由中转节点转发，超时未知
+)
+
+// natProbeRules 采样使用的计数规则：全部UDP 4500数据包、其中的保活包和未经NAT穿越封装的ESP数据包
+var natProbeRules = []struct{ name, match string }{
+	{"all", "-p udp --dport 4500"},
+	{"keepalive", fmt.Sprintf("-p udp --dport 4500 -m length --length %d", natKeepalivePacketLength)},
+	{"esp", "-p esp"},
+}
+
+// natProbeCounterPattern 匹配iptables -nvxL输出中的计数规则，第一列为数据包数
+var natProbeCounterPattern = regexp.MustCompile(`^\s*(\d+)\s+\d+\s.*/\* ` + natProbeComment + `:(\w+) \*/`)
+
+// natKeepalive 服务器生效的NAT保活间隔(秒)，未设置时为协议默认值
+func natKeepalive(server *database.L2TPServer) int {
+	if server.NATKeepalive > 0 {
+		return server.NATKeepalive
+	}
+	switch server.Type {
+	case ServerTypeIKEv2:
+		return ikev2NATKeepalive
+	case ServerTypeWireGuard:
+		return wireGuardKeepalive
+	case ServerTypeOpenVPN:
+		return openVPNNATKeepalive
+	}
+	return l2tpNATKeepalive
+}
+
+// validateNATKeepalive 校验NAT保活间隔，L2TP服务器的保活由客户端和SoftEther决定，不能设置
+func validateNATKeepalive(server *database.L2TPServer) error {
+	if server.NATKeepalive == 0 {
+		return nil
+	}
+	if server.Type == ServerTypeL2TP {
+		return fmt.Errorf("L2TP服务器的NAT-T保活由客户端和SoftEther决定，不支持设置保活间隔")
+	}
+	if server.NATKeepalive < minNATKeepalive || server.NATKeepalive > maxNATKeepalive {
+		return fmt.Errorf("NAT保活间隔必须在%d到%d秒之间", minNATKeepalive, maxNATKeepalive)
+	}
+	return nil
+}
+
+// NATTrafficSample 采样期间落地机收到的IPsec数据包
+type NATTrafficSample struct {
+	Sessions   int   `json:"sessions"`    // 采样开始时的在线会话数
+	Packets    int64 `json:"packets"`     // UDP 4500数据包
+	Keepalives int64 `json:"keepalives"`  // 其中的NAT-T保活包
+	ESPPackets int64 `json:"esp_packets"` // 未经NAT穿越封装的ESP数据包
+}
+
+// NATCheck NAT穿越(UDP 4500)检测结果
+type NATCheck struct {
+	NATTrafficSample
+	ServerID          uint      `json:"server_id"`
+	CheckedAt         time.Time `json:"checked_at"`
+	Duration          int       `json:"duration"`                    // 采样时长(秒)
+	KeepaliveInterval int       `json:"keepalive_interval"`          // 生效的NAT保活间隔(秒)
+	RelayMode         string    `json:"relay_mode"`                  // direct/userspace/kernel/relay_node
+	RelayUDPTimeout   int       `json:"relay_udp_timeout,omitempty"` // 中转转发器的UDP会话超时(秒)，未知时为0
+	Warnings          []string  `json:"warnings"`
+}
+
+// NATCheckService 检测中转和出口路径是否丢弃NAT-T保活包：在落地机上对UDP 4500和ESP数据包临时计数，
+// 并比较中转转发器的UDP会话超时与保活间隔。每台服务器保留最近一次结果，由服务器状态接口返回
+type NATCheckService struct {
+	db          *gorm.DB
+	l2tpService *L2TPService
+	routing     *RoutingService
+	latest      map[uint]*NATCheck
+	mutex       sync.Mutex
+}
+
+// NewNATCheckService 创建NAT-T检测服务
+func NewNATCheckService(db *gorm.DB, l2tpService *L2TPService, routing *RoutingService) *NATCheckService {
+	return &NATCheckService{db: db, l2tpService: l2tpService, routing: routing, latest: make(map[uint]*NATCheck)}
+}
+
+// Run 对运行中的IKEv2或L2TP服务器采样duration秒，duration为0时采样两个保活间隔(至少30秒)。请求断开时中止采样
+func (s *NATCheckService) Run(ctx context.Context, id uint, duration int) (*NATCheck, error) {
+	var server database.L2TPServer
+	if err := s.db.WithContext(ctx).First(&server, id).Error; err != nil {
+		return nil, fmt.Errorf("服务器不存在")
+	}
+	if server.Type != ServerTypeIKEv2 && server.Type != ServerTypeL2TP {
+		return nil, fmt.Errorf("只支持检测使用NAT-T的IKEv2和L2TP服务器")
+	}
+	if server.Status != "running" {
+		return nil, fmt.Errorf("服务器未运行")
+	}
+
+	interval := natKeepalive(&server)
+	if duration == 0 {
+		duration = max(2*interval, 30)
+	}
+	duration = min(max(duration, minNATCheckDuration), maxNATCheckDuration)
+
+	check := &NATCheck{ServerID: server.ID, Duration: duration, KeepaliveInterval: interval, Warnings: []string{}}
+	check.RelayMode, check.RelayUDPTimeout = s.relayTimeout(&server)
+	if check.RelayUDPTimeout > 0 && check.RelayUDPTimeout <= interval {
+		check.Warnings = append(check.Warnings, fmt.Sprintf("中转转发器的UDP会话超时(%d秒)不大于NAT保活间隔(%d秒)，空闲会话的映射可能在保活前过期",
+			check.RelayUDPTimeout, interval))
+	}
+
+	sample, err := s.l2tpService.SSH().WithContext(ctx).SampleNATTraffic(&server, duration)
+	if err != nil {
+		return nil, fmt.Errorf("采样落地机NAT-T流量失败: %v", err)
+	}
+	check.NATTrafficSample = *sample
+	check.CheckedAt = time.Now()
+	if sample.Sessions > 0 && sample.Packets == 0 && sample.ESPPackets == 0 {
+		check.Warnings = append(check.Warnings, fmt.Sprintf("采样的%d秒内有%d个在线会话，但落地机没有收到UDP 4500或ESP数据包，中转或出口路径可能丢弃了NAT-T保活包",
+			duration, sample.Sessions))
+	}
+
+	s.mutex.Lock()
+	s.latest[server.ID] = check
+	s.mutex.Unlock()
+	return check, nil
+}
+
+// Latest 服务器最近一次的检测结果，没有时为nil
+func (s *NATCheckService) Latest(id uint) *NATCheck {
+	if s == nil {
+		return nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.latest[id]
+}
+
+// relayTimeout 客户端到落地机UDP 4500端口的中转方式及其UDP会话超时(秒)，未知时为0
+func (s *NATCheckService) relayTimeout(server *database.L2TPServer) (string, int) {
+	if server.Type != ServerTypeIKEv2 {
+		return NATRelayDirect, 0
+	}
+	if server.RelayNodeID != 0 {
+		return NATRelayNode, 0
+	}
+	for _, forwarder := range s.routing.Forwarders() {
+		if forwarder.ServerID != server.ID || forwarder.Protocol != ProtocolIKEv2NAT {
+			continue
+		}
+		if forwarder.Mode == ForwardModeKernel {
+			data, err := os.ReadFile(conntrackUDPTimeoutPath)
+			if err != nil {
+				return NATRelayKernel, 0
+			}
+			timeout, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+			return NATRelayKernel, timeout
+		}
+	}
+	return NATRelayUserspace, xrayUDPIdleTimeout
+}
+
+// natProbeScript 在落地机raw表中添加计数规则，采样seconds秒后输出计数并删除规则。
+// 开始前先删除上次采样中断时遗留的规则
+func natProbeScript(seconds int) string {
+	var add, del []string
+	for _, rule := range natProbeRules {
+		args := fmt.Sprintf("PREROUTING %s -m comment --comment %s:%s", rule.match, natProbeComment, rule.name)
+		add = append(add, "iptables -t raw -I "+args)
+		del = append(del, fmt.Sprintf("while iptables -t raw -D %s 2>/dev/null; do :; done", args))
+	}
+	cleanup := strings.Join(del, "; ")
+	return fmt.Sprintf("%s; %s && sleep %d && iptables -t raw -nvxL PREROUTING; status=$?; %s; exit $status",
+		cleanup, strings.Join(add, " && "), seconds, cleanup)
+}
+
+// SampleNATTraffic 统计落地机在seconds秒内收到的UDP 4500数据包、其中的NAT-T保活包和ESP数据包
+func (s *SSHService) SampleNATTraffic(server *database.L2TPServer, seconds int) (_ *NATTrafficSample, err error) {
+	defer func(start time.Time) { metrics.ObserveSSH("nat_check", start, err) }(time.Now())
+
+	client, err := s.createSSHClient(server)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	sample := &NATTrafficSample{}
+	if sample.Sessions, err = s.connectedClients(client, server); err != nil {
+		return nil, err
+	}
+	output, err := s.executeCommand(client, natProbeScript(seconds))
+	if err != nil {
+		return nil, err
+	}
+	found := 0
+	for _, line := range strings.Split(output, "\n") {
+		match := natProbeCounterPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		packets, _ := strconv.ParseInt(match[1], 10, 64)
+		switch match[2] {
+		case "all":
+			sample.Packets = packets
+		case "keepalive":
+			sample.Keepalives = packets
+		case "esp":
+			sample.ESPPackets = packets
+		}
+		found++
+	}
+	if found < len(natProbeRules) {
+		return nil, fmt.Errorf("无法读取计数规则")
+	}
+	return sample, nil
+}
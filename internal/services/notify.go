@@ -0,0 +1,232 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 通知事件类型
+const (
+	EventServerCreated    = "server.created"
+	EventServerStarted    = "server.started"
+	EventServerStopped    = "server.stopped"
+	EventServerError      = "server.error"
+	EventServerExpired    = "server.expired"
+	EventServerExpiring   = "server.expiring"
+	EventServerRecovered  = "server.recovered"
+	EventAutoRestart      = "server.auto_restart"
+	EventQuotaExceeded    = "server.quota_exceeded"
+	EventAccountSuspended = "server.account_suspended"
+	EventLoginNewIP       = "auth.login_new_ip"
+	EventTrafficReport    = "report.weekly_traffic"
+	EventTest             = "notification.test"
+	EventAlertFiring      = "alert.firing"
+	EventAlertResolved    = "alert.resolved"
+	EventServerRegistered = "server.registered"
+	EventServerDrifted    = "server.drifted"
+	EventSyntheticFailed  = "server.synthetic_failed"
+	EventPanic            = "system.panic"
+	EventResourceHigh     = "system.resource_high"
+	EventResourceNormal   = "system.resource_normal"
+)
+
+// NotificationEvents 可订阅的事件类型
+var NotificationEvents = []string{
+	EventServerCreated,
+	EventServerStarted,
+	EventServerStopped,
+	EventServerError,
+	EventServerExpired,
+	EventServerExpiring,
+	EventServerRecovered,
+	EventAutoRestart,
+	EventQuotaExceeded,
+	EventAccountSuspended,
+	EventLoginNewIP,
+	EventTrafficReport,
+	EventAlertFiring,
+	EventAlertResolved,
+	EventServerRegistered,
+	EventServerDrifted,
+	EventSyntheticFailed,
+	EventPanic,
+	EventResourceHigh,
+	EventResourceNormal,
+}
+
+// eventTitles 事件类型的中文标题
+var eventTitles = map[string]string{
+	EventServerCreated:    "服务器已创建",
+	EventServerStarted:    "服务器已启动",
+	EventServerStopped:    "服务器已停止",
+	EventServerError:      "服务器异常",
+	EventServerExpired:    "服务器已到期",
+	EventServerExpiring:   "服务器即将到期",
+	EventServerRecovered:  "服务器已恢复",
+	EventAutoRestart:      "服务器自动重启",
+	EventQuotaExceeded:    "流量超额",
+	EventAccountSuspended: "账号已停用",
+	EventLoginNewIP:       "新IP登录",
+	EventTrafficReport:    "每周流量汇总",
+	EventTest:             "测试消息",
+	EventAlertFiring:      "告警触发",
+	EventAlertResolved:    "告警恢复",
+	EventServerRegistered: "落地机待审核",
+	EventServerDrifted:    "配置漂移",
+	EventSyntheticFailed:  "拨测失败",
+	EventPanic:            "程序异常",
+	EventResourceHigh:     "主机资源不足",
+	EventResourceNormal:   "主机资源已恢复",
+}
+
+// EventTitle 返回事件类型的中文标题，未知类型原样返回
+func EventTitle(eventType string) string {
+	if title, ok := eventTitles[eventType]; ok {
+		return title
+	}
+	return eventType
+}
+
+// Event 通知事件
+type Event struct {
+	Type       string                 `json:"type"`
+	ServerID   uint                   `json:"server_id,omitempty"`
+	ServerName string                 `json:"server_name,omitempty"`
+	Message    string                 `json:"message"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+	Time       time.Time              `json:"time"`
+}
+
+// ErrChannelNotConfigured 渠道未配置，发送时跳过
+var ErrChannelNotConfigured = errors.New("通知渠道未配置")
+
+// NotificationChannel 通知渠道
+type NotificationChannel interface {
+	Name() string
+	Send(event Event) error
+}
+
+// NotificationService 通知分发服务，按事件路由设置决定各渠道接收哪些事件
+type NotificationService struct {
+	settings *SettingsService
+	channels []NotificationChannel
+	mutex    sync.RWMutex
+}
+
+// NewNotificationService 创建通知分发服务
+func NewNotificationService(settings *SettingsService) *NotificationService {
+	return &NotificationService{settings: settings}
+}
+
+// RouteSettingKey 渠道事件路由的设置项
+func RouteSettingKey(channel string) string {
+	return "notify_events_" + channel
+}
+
+// Register 注册通知渠道，defaultEvents为该渠道默认接收的事件(为空表示全部)，
+// 可通过设置项 notify_events_<渠道名> 调整
+func (n *NotificationService) Register(channel NotificationChannel, defaultEvents ...string) {
+	n.settings.Register(SettingDef{
+		Key:         RouteSettingKey(channel.Name()),
+		Type:        SettingTypeString,
+		Default:     strings.Join(defaultEvents, ","),
+		Description: fmt.Sprintf("推送到%s的事件类型，逗号分隔，为空表示全部", channel.Name()),
+	})
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.channels = append(n.channels, channel)
+}
+
+// Channels 返回已注册的渠道名称
+func (n *NotificationService) Channels() []string {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	names := make([]string, 0, len(n.channels))
+	for _, channel := range n.channels {
+		names = append(names, channel.Name())
+	}
+	return names
+}
+
+// Test 向指定渠道同步发送测试事件(不经过事件路由)
+func (n *NotificationService) Test(name string) error {
+	n.mutex.RLock()
+	var target NotificationChannel
+	for _, channel := range n.channels {
+		if channel.Name() == name {
+			target = channel
+		}
+	}
+	n.mutex.RUnlock()
+
+	if target == nil {
+		return fmt.Errorf("通知渠道不存在: %s", name)
+	}
+	return target.Send(Event{
+		Type:    EventTest,
+		Message: "这是一条测试消息",
+		Time:    time.Now(),
+	})
+}
+
+// eventSubscribed 判断事件是否在逗号分隔的订阅列表中，列表为空表示订阅全部
+func eventSubscribed(events, eventType string) bool {
+	if strings.TrimSpace(events) == "" {
+		return true
+	}
+	for _, e := range strings.Split(events, ",") {
+		if strings.TrimSpace(e) == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Publish 异步向所有渠道分发事件，各渠道按事件路由过滤
+func (n *NotificationService) Publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	for _, channel := range n.snapshot() {
+		if eventSubscribed(n.settings.Get(RouteSettingKey(channel.Name())), event.Type) {
+			n.dispatch(channel, event)
+		}
+	}
+}
+
+// PublishTo 异步向指定渠道分发事件，不经过事件路由
+func (n *NotificationService) PublishTo(event Event, names []string) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	for _, channel := range n.snapshot() {
+		if containsString(names, channel.Name()) {
+			n.dispatch(channel, event)
+		}
+	}
+}
+
+// snapshot 复制当前渠道列表
+func (n *NotificationService) snapshot() []NotificationChannel {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	channels := make([]NotificationChannel, len(n.channels))
+	copy(channels, n.channels)
+	return channels
+}
+
+// dispatch 异步发送到单个渠道
+func (n *NotificationService) dispatch(channel NotificationChannel, event Event) {
+	go func() {
+		if err := channel.Send(event); err != nil && !errors.Is(err, ErrChannelNotConfigured) {
+			slog.Warn("通知发送失败", "channel", channel.Name(), "event", event.Type, "error", err)
+		}
+	}()
+}
@@ -0,0 +1,304 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+
+	"l2tp-manager/internal/database"
+
+	"github.com/xtls/xray-core/app/dispatcher"
+	"github.com/xtls/xray-core/app/policy"
+	"github.com/xtls/xray-core/app/proxyman"
+	"github.com/xtls/xray-core/app/router"
+	xstats "github.com/xtls/xray-core/app/stats"
+	xnet "github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/common/protocol"
+	"github.com/xtls/xray-core/common/serial"
+	"github.com/xtls/xray-core/common/uuid"
+	"github.com/xtls/xray-core/core"
+	"github.com/xtls/xray-core/infra/conf"
+	"github.com/xtls/xray-core/proxy/blackhole"
+	"github.com/xtls/xray-core/proxy/freedom"
+)
+
+// 流量混淆方式
+const (
+	ObfuscationMKCP = "mkcp" // VLESS over mKCP，UDP数据包伪装为DTLS并以混淆密钥加密
+	ObfuscationWS   = "ws"   // VLESS over WebSocket，适用于只放行TCP和HTTP的网络
+)
+
+const (
+	// ProtocolObfuscation 混淆入口在端口登记表中的协议名
+	ProtocolObfuscation = "obfuscation"
+	// obfuscationMKCPHeader mKCP数据包的伪装类型
+	obfuscationMKCPHeader = "dtls"
+	// obfuscationBlockTag 混淆入口中不属于本服务器的目标使用的丢弃出站
+	obfuscationBlockTag = "obfuscation-block"
+	// obfuscationDefaultListen 客户端辅助程序默认的监听地址
+	obfuscationDefaultListen = "127.0.0.1"
+)
+
+// obfuscationRule 混淆入口的监听端口，未启用混淆时为nil。混淆入口不是转发规则，
+// 但与转发规则一样占用中转机端口，参与端口冲突检查和端口敲门
+func obfuscationRule(server *database.L2TPServer) *ForwardRule {
+	if server.Obfuscation == "" {
+		return nil
+	}
+	rule := &ForwardRule{Protocol: ProtocolObfuscation, ListenPort: server.ObfuscationPort}
+	if server.Obfuscation == ObfuscationMKCP {
+		rule.Networks, rule.Network = []xnet.Network{xnet.Network_UDP}, "udp"
+	} else {
+		rule.Networks, rule.Network = []xnet.Network{xnet.Network_TCP}, "tcp"
+	}
+	return rule
+}
+
+// validateObfuscation 校验流量混淆设置。混淆入口由面板本机运行，由中转节点转发的服务器不支持；
+// Shadowsocks和VLESS本身即为代理协议，相关字段由applyTypeDefaults清空
+func validateObfuscation(server *database.L2TPServer) error {
+	switch server.Obfuscation {
+	case "":
+		if server.ObfuscationPort != 0 {
+			return fmt.Errorf("未启用流量混淆时不能设置混淆端口")
+		}
+		return nil
+	case ObfuscationMKCP, ObfuscationWS:
+	default:
+		return fmt.Errorf("流量混淆方式只能是mkcp或ws")
+	}
+	if server.RelayNodeID != 0 {
+		return fmt.Errorf("流量混淆只支持由面板本机转发的服务器")
+	}
+	if server.ObfuscationPort <= 0 || server.ObfuscationPort > 65535 {
+		return fmt.Errorf("启用流量混淆时必须设置有效的混淆端口")
+	}
+	return nil
+}
+
+// prepareObfuscation 未提供混淆密钥时沿用原值，填写auto或启用混淆时仍没有密钥则生成，手动填写时必须是UUID
+func prepareObfuscation(server, existing *database.L2TPServer) error {
+	if server.ObfuscationKey == "" && existing != nil {
+		server.ObfuscationKey = existing.ObfuscationKey
+	}
+	if server.ObfuscationKey == CredentialAuto || (server.Obfuscation != "" && server.ObfuscationKey == "") {
+		id := uuid.New()
+		server.ObfuscationKey = id.String()
+		return nil
+	}
+	if server.ObfuscationKey != "" {
+		// ParseString会将非UUID格式的字符串映射为UUID，这里只接受标准格式
+		id, err := uuid.ParseString(server.ObfuscationKey)
+		if err != nil || id.String() != strings.ToLower(server.ObfuscationKey) {
+			return fmt.Errorf("混淆密钥必须是UUID")
+		}
+	}
+	return nil
+}
+
+// obfuscationStreamSettings 混淆入口的传输层配置，面板和客户端辅助程序使用相同的配置。
+// WebSocket路径由混淆密钥派生，不知道密钥的探测请求得到404
+func obfuscationStreamSettings(server *database.L2TPServer) map[string]interface{} {
+	if server.Obfuscation == ObfuscationMKCP {
+		return map[string]interface{}{
+			"network": "kcp",
+			"kcpSettings": map[string]interface{}{
+				"header": map[string]interface{}{"type": obfuscationMKCPHeader},
+				"seed":   server.ObfuscationKey,
+			},
+		}
+	}
+	sum := sha256.Sum256([]byte(server.ObfuscationKey))
+	return map[string]interface{}{
+		"network":    "ws",
+		"wsSettings": map[string]interface{}{"path": "/" + hex.EncodeToString(sum[:8])},
+	}
+}
+
+// obfuscationServerConfig 生成混淆入口的Xray配置：VLESS入站解开混淆后，按客户端请求的端口(即服务器的中转端口)
+// 转发到该端口的转发目标，其他目标一律丢弃。入站标签与转发器一致，流量计入服务器
+func obfuscationServerConfig(server *database.L2TPServer, blockRule *router.RoutingRule) (*core.Config, error) {
+	data, err := json.Marshal(map[string]interface{}{
+		"tag":      fmt.Sprintf("dokodemo-in-%d", server.ObfuscationPort),
+		"port":     server.ObfuscationPort,
+		"protocol": "vless",
+		"settings": map[string]interface{}{
+			"clients":    []interface{}{map[string]interface{}{"id": server.ObfuscationKey}},
+			"decryption": "none",
+		},
+		"streamSettings": obfuscationStreamSettings(server),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var inboundConfig conf.InboundDetourConfig
+	if err := json.Unmarshal(data, &inboundConfig); err != nil {
+		return nil, fmt.Errorf("混淆入口配置无效: %v", err)
+	}
+	inbound, err := inboundConfig.Build()
+	if err != nil {
+		return nil, fmt.Errorf("混淆入口配置无效: %v", err)
+	}
+
+	// 第一个出站为默认出站，未匹配任何中转端口的请求丢弃
+	outbounds := []*core.OutboundHandlerConfig{{
+		Tag:           obfuscationBlockTag,
+		ProxySettings: serial.ToTypedMessage(&blackhole.Config{}),
+	}}
+	var rules []*router.RoutingRule
+	if blockRule != nil {
+		rules = append(rules, blockRule)
+		outbounds = append(outbounds, &core.OutboundHandlerConfig{
+			Tag:           geoIPBlockTag,
+			ProxySettings: serial.ToTypedMessage(&blackhole.Config{}),
+		})
+	}
+	for _, rule := range ForwardRules(server) {
+		host, port := forwardTarget(server, rule)
+		tag := fmt.Sprintf("obfuscation-%d", rule.ListenPort)
+		outbounds = append(outbounds, &core.OutboundHandlerConfig{
+			Tag: tag,
+			ProxySettings: serial.ToTypedMessage(&freedom.Config{
+				DomainStrategy: freedom.Config_USE_IP,
+				DestinationOverride: &freedom.DestinationOverride{Server: &protocol.ServerEndpoint{
+					Address: xnet.NewIPOrDomain(xnet.ParseAddress(host)),
+					Port:    uint32(port),
+				}},
+			}),
+		})
+		rules = append(rules, &router.RoutingRule{
+			TargetTag: &router.RoutingRule_Tag{Tag: tag},
+			PortList:  &xnet.PortList{Range: []*xnet.PortRange{{From: uint32(rule.ListenPort), To: uint32(rule.ListenPort)}}},
+			Networks:  rule.Networks,
+		})
+	}
+
+	return &core.Config{
+		App: []*serial.TypedMessage{
+			serial.ToTypedMessage(&dispatcher.Config{}),
+			serial.ToTypedMessage(&proxyman.InboundConfig{}),
+			serial.ToTypedMessage(&proxyman.OutboundConfig{}),
+			serial.ToTypedMessage(&xstats.Config{}),
+			serial.ToTypedMessage(&policy.Config{
+				System: &policy.SystemPolicy{
+					Stats: &policy.SystemPolicy_Stats{
+						InboundUplink:   true,
+						InboundDownlink: true,
+					},
+				},
+			}),
+			serial.ToTypedMessage(&router.Config{Rule: rules}),
+		},
+		Inbound:  []*core.InboundHandlerConfig{inbound},
+		Outbound: outbounds,
+	}, nil
+}
+
+// startObfuscation 启动服务器的混淆入口，与转发器一起由startServerForwarders启动
+func (r *RoutingService) startObfuscation(server *database.L2TPServer) error {
+	port := server.ObfuscationPort
+	if err := r.checkPortAvailable(port); err != nil {
+		return fmt.Errorf("端口 %d 不可用: %v", port, err)
+	}
+	if instance, exists := r.xrayInstances[port]; exists && instance != nil {
+		instance.Close()
+		delete(r.xrayInstances, port)
+	}
+
+	var blockRule *router.RoutingRule
+	if server.GeoIPMode != "" {
+		var err error
+		if blockRule, err = r.geoip.blockRule(server.GeoIPMode, server.GeoIPCountries); err != nil {
+			return err
+		}
+	}
+	config, err := obfuscationServerConfig(server, blockRule)
+	if err != nil {
+		return err
+	}
+	instance, err := core.New(config)
+	if err != nil {
+		return fmt.Errorf("创建混淆入口失败: %v", err)
+	}
+	if err := instance.Start(); err != nil {
+		instance.Close()
+		return fmt.Errorf("启动混淆入口失败: %v", err)
+	}
+	r.xrayInstances[port] = instance
+
+	statsKey := fmt.Sprintf("%s:%d", server.Host, port)
+	r.statsMutex.Lock()
+	if _, exists := r.trafficStats[statsKey]; !exists {
+		r.trafficStats[statsKey] = &TrafficStats{}
+	}
+	r.statsMutex.Unlock()
+	slog.Info("混淆入口启动成功", "server_id", server.ID, "mode", server.Obfuscation, "port", port)
+	go r.monitorTraffic(statsKey, port, server.ID, 0, instance)
+	return nil
+}
+
+// ObfuscationClientConfig 生成客户端辅助程序的Xray配置：在listen地址上按服务器的每个中转端口监听，
+// 经混淆后发往中转机endpoint的混淆端口。VPN客户端改为连接辅助程序的地址，端口和其他设置不变
+func (s *L2TPService) ObfuscationClientConfig(id uint, endpoint, listen string) (string, error) {
+	server, err := s.GetServer(id)
+	if err != nil {
+		return "", err
+	}
+	if server.Obfuscation == "" {
+		return "", fmt.Errorf("服务器未启用流量混淆")
+	}
+	if listen == "" {
+		listen = obfuscationDefaultListen
+	}
+	if net.ParseIP(listen) == nil {
+		return "", fmt.Errorf("监听地址必须是IP地址")
+	}
+
+	var inbounds []interface{}
+	for _, rule := range ForwardRules(server) {
+		inbounds = append(inbounds, map[string]interface{}{
+			"tag":      rule.Protocol + "-" + strconv.Itoa(rule.ListenPort),
+			"listen":   listen,
+			"port":     rule.ListenPort,
+			"protocol": "dokodemo-door",
+			"settings": map[string]interface{}{
+				"address": "127.0.0.1", // 只作为端口标识，中转机按端口转发到实际目标
+				"port":    rule.ListenPort,
+				"network": strings.ReplaceAll(rule.Network, "+", ","),
+			},
+		})
+	}
+	data, err := json.MarshalIndent(map[string]interface{}{
+		"log":      map[string]interface{}{"loglevel": "warning"},
+		"inbounds": inbounds,
+		"outbounds": []interface{}{map[string]interface{}{
+			"tag":      "obfuscation",
+			"protocol": "vless",
+			"settings": map[string]interface{}{
+				"vnext": []interface{}{map[string]interface{}{
+					"address": endpoint,
+					"port":    server.ObfuscationPort,
+					"users":   []interface{}{map[string]interface{}{"id": server.ObfuscationKey, "encryption": "none"}},
+				}},
+			},
+			"streamSettings": obfuscationStreamSettings(server),
+		}},
+	}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	var config conf.Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return "", fmt.Errorf("Xray配置无效: %v", err)
+	}
+	if _, err := config.Build(); err != nil {
+		return "", fmt.Errorf("Xray配置无效: %v", err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"l2tp-manager/internal/database"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// OpenVPN落地机配置
+const (
+	openVPNContainerName = "openvpn-server"
+	openVPNImage         = "kylemanna/openvpn:2.4"
+
+	openVPNConfigDir  = "/etc/l2tp-manager/openvpn" // 落地机上的配置目录，挂载到容器的/etc/openvpn
+	openVPNSubnet     = "10.8.0.0"
+	openVPNNetmask    = "255.255.255.0"
+	openVPNClientDNS  = "1.1.1.1"
+	openVPNStatusFile = "/tmp/openvpn-status.log"
+	openVPNCipher     = "AES-256-GCM"
+	openVPNAuth       = "SHA256"
+)
+
+// openVPNServerConfig 生成落地机的OpenVPN服务端配置，客户端使用用户名密码认证，不需要客户端证书
+func openVPNServerConfig(server *database.L2TPServer) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "port %d\n", OpenVPNContainerPort)
+	fmt.Fprintf(&b, "proto %s\n", server.OpenVPNProto)
+	b.WriteString("dev tun\ntopology subnet\n")
+	fmt.Fprintf(&b, "server %s %s\n", openVPNSubnet, openVPNNetmask)
+	b.WriteString("ca ca.crt\ncert server.crt\nkey server.key\ndh none\necdh-curve prime256v1\ntls-crypt tc.key\n")
+	fmt.Fprintf(&b, "cipher %s\nauth %s\n", openVPNCipher, openVPNAuth)
+	// 每隔保活间隔发送ping，6个间隔内没有收到对端数据视为断开
+	interval := natKeepalive(server)
+	fmt.Fprintf(&b, "keepalive %d %d\n", interval, interval*6)
+	b.WriteString("persist-key\npersist-tun\n")
+	b.WriteString("verify-client-cert none\nusername-as-common-name\nduplicate-cn\n")
+	b.WriteString("script-security 2\nauth-user-pass-verify /etc/openvpn/auth.sh via-file\n")
+	b.WriteString("push \"redirect-gateway def1 bypass-dhcp\"\n")
+	for _, dns := range clientDNS(server, openVPNClientDNS) {
+		fmt.Fprintf(&b, "push \"dhcp-option DNS %s\"\n", dns)
+	}
+	// 分流DNS：支持DOMAIN-ROUTE的客户端(OpenVPN 2.5+/OpenVPN Connect)只将这些域名的查询发送到上面的DNS服务器
+	for _, domain := range parseDNSDomains(server.DNSDomains) {
+		fmt.Fprintf(&b, "push \"dhcp-option DOMAIN-ROUTE %s\"\n", domain)
+	}
+	fmt.Fprintf(&b, "status %s 10\nstatus-version 2\n", openVPNStatusFile)
+	b.WriteString("verb 3\n")
+	return b.String()
+}
+
+// openVPNAuthScript 用户名密码校验脚本，OpenVPN以via-file方式传入包含用户名和密码两行的临时文件
+const openVPNAuthScript = `#!/bin/sh
+user=$(sed -n 1p "$1")
+pass=$(sed -n 2p "$1")
+grep -qxF "$user:$pass" /etc/openvpn/users
+`
+
+// openVPNRunScript 容器启动脚本，添加出口NAT后以前台方式运行OpenVPN
+var openVPNRunScript = fmt.Sprintf(`#!/bin/sh
+iptables -t nat -C POSTROUTING -s %[1]s/24 -j MASQUERADE 2>/dev/null || iptables -t nat -A POSTROUTING -s %[1]s/24 -j MASQUERADE
+cd /etc/openvpn
+exec openvpn --config /etc/openvpn/server.conf
+`, openVPNSubnet)
+
+// openVPNUsers 生成认证用户文件，每行为 用户名:密码，未配置用户时使用与L2TP相同的默认用户
+func openVPNUsers(users []L2TPUser) string {
+	if len(users) == 0 {
+		return "test:test123\n"
+	}
+	var b strings.Builder
+	for _, user := range users {
+		fmt.Fprintf(&b, "%s:%s\n", user.Username, user.Password)
+	}
+	return b.String()
+}
+
+// openVPNConfigFiles 服务端配置、证书和用户文件，写入落地机的配置目录
+func openVPNConfigFiles(server *database.L2TPServer, users []L2TPUser) ([]remoteFile, error) {
+	pki, err := parsePKI(server.PKI)
+	if err != nil {
+		return nil, err
+	}
+	return []remoteFile{
+		{"server.conf", openVPNServerConfig(server), "644"},
+		{"ca.crt", pki.CACert, "644"},
+		{"server.crt", pki.ServerCert, "644"},
+		{"server.key", pki.ServerKey, "600"},
+		{"tc.key", pki.TLSCrypt, "600"},
+		{"users", openVPNUsers(users), "600"},
+		{"auth.sh", openVPNAuthScript, "755"},
+		{"run.sh", openVPNRunScript, "755"},
+	}, nil
+}
+
+// openVPNRunCommand 构建启动OpenVPN容器的docker run命令
+func openVPNRunCommand(server *database.L2TPServer) string {
+	return fmt.Sprintf(`docker run -d \
+		--name %s \
+		--restart always \
+		-p %d:%d/%s \
+		--cap-add NET_ADMIN \
+		--device /dev/net/tun \
+		--sysctl net.ipv4.ip_forward=1 \
+		-v %s:/etc/openvpn \
+		%s sh /etc/openvpn/run.sh`,
+		openVPNContainerName,
+		OpenVPNContainerPort, OpenVPNContainerPort, server.OpenVPNProto,
+		openVPNConfigDir,
+		openVPNImage)
+}
+
+// openVPNClients 统计OpenVPN状态文件中的在线客户端
+func (s *SSHService) openVPNClients(client *ssh.Client) (int, error) {
+	output, err := s.executeCommand(client, fmt.Sprintf("docker exec %s cat %s", openVPNContainerName, openVPNStatusFile))
+	if err != nil {
+		return 0, fmt.Errorf("获取会话列表失败: %v", err)
+	}
+	return countOpenVPNClients(output), nil
+}
+
+// countOpenVPNClients 统计status-version 2格式中的CLIENT_LIST行(不含表头HEADER行)
+func countOpenVPNClients(output string) int {
+	count := 0
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "CLIENT_LIST,") {
+			count++
+		}
+	}
+	return count
+}
+
+// OpenVPNProfile 生成客户端.ovpn配置文件，内嵌CA证书和tls-crypt密钥，用户使用各自的用户名密码登录。
+// endpointHost为客户端连接的中转机地址，端口为服务器的中转端口
+func (s *L2TPService) OpenVPNProfile(id uint, endpointHost string) (string, error) {
+	server, err := s.GetServer(id)
+	if err != nil {
+		return "", err
+	}
+	if server.Type != ServerTypeOpenVPN {
+		return "", fmt.Errorf("服务器不是OpenVPN类型")
+	}
+	pki, err := parsePKI(server.PKI)
+	if err != nil {
+		return "", err
+	}
+
+	proto := server.OpenVPNProto
+	if proto == OpenVPNProtoTCP {
+		proto = "tcp-client"
+	}
+
+	var b strings.Builder
+	b.WriteString("client\ndev tun\n")
+	fmt.Fprintf(&b, "proto %s\n", proto)
+	fmt.Fprintf(&b, "remote %s %d\n", endpointHost, server.L2TPPort)
+	b.WriteString("resolv-retry infinite\nnobind\npersist-key\npersist-tun\n")
+	b.WriteString("remote-cert-tls server\n")
+	fmt.Fprintf(&b, "cipher %s\nauth %s\n", openVPNCipher, openVPNAuth)
+	b.WriteString("auth-user-pass\nauth-nocache\nverb 3\n")
+	fmt.Fprintf(&b, "<ca>\n%s</ca>\n", pki.CACert)
+	fmt.Fprintf(&b, "<tls-crypt>\n%s</tls-crypt>\n", pki.TLSCrypt)
+	return b.String(), nil
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"l2tp-manager/internal/database"
+
+	"gorm.io/gorm"
+)
+
+// maxServerOperations 每台服务器保留的操作记录数，更早的记录被删除
+const maxServerOperations = 50
+
+// ErrOperationNotFound 服务器没有该操作记录
+var ErrOperationNotFound = errors.New("操作记录不存在")
+
+// ServerOperationDetail 服务器操作记录及其执行过程
+type ServerOperationDetail struct {
+	database.ServerOperation
+	Running    bool              `json:"running"`              // 操作仍在进行，执行过程持续增加
+	Transcript []TranscriptEntry `json:"transcript,omitempty"` // 操作历史列表中不返回
+}
+
+// saveOperation 保存结束的任务及其执行记录，超过maxServerOperations时删除该服务器最早的记录
+func (s *JobService) saveOperation(view JobView, transcript *Transcript) {
+	if s.db == nil {
+		return
+	}
+	data, err := json.Marshal(transcript)
+	if err != nil {
+		slog.Error("序列化服务器操作记录失败", "job_id", view.ID, "error", err)
+		return
+	}
+	record := database.ServerOperation{
+		JobID:      view.ID,
+		ServerID:   view.ServerID,
+		Kind:       view.Kind,
+		Status:     view.Status,
+		Step:       view.Step,
+		Error:      view.Error,
+		Duration:   view.Duration,
+		Transcript: string(data),
+		CreatedAt:  view.CreatedAt,
+		FinishedAt: time.Now(),
+	}
+	if view.FinishedAt != nil {
+		record.FinishedAt = *view.FinishedAt
+	}
+	if err := s.db.Create(&record).Error; err != nil {
+		slog.Error("保存服务器操作记录失败", "job_id", view.ID, "server_id", view.ServerID, "error", err)
+		return
+	}
+
+	var expired []uint
+	err = s.db.Model(&database.ServerOperation{}).Where("server_id = ?", view.ServerID).
+		Order("id DESC").Offset(maxServerOperations).Limit(1).Pluck("id", &expired).Error
+	if err == nil && len(expired) > 0 {
+		err = s.db.Where("server_id = ? AND id <= ?", view.ServerID, expired[0]).Delete(&database.ServerOperation{}).Error
+	}
+	if err != nil {
+		slog.Warn("清理服务器操作记录失败", "server_id", view.ServerID, "error", err)
+	}
+}
+
+// running 服务器进行中的任务，最新的在前
+func (s *JobService) running(serverID uint) []*Job {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var jobs []*Job
+	for i := len(s.jobs) - 1; i >= 0; i-- {
+		if job := s.jobs[i]; job.ServerID == serverID && !job.Finished() {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+// liveDetail 由登记表中的任务生成操作记录
+func liveDetail(job *Job) ServerOperationDetail {
+	view := job.View()
+	return ServerOperationDetail{
+		ServerOperation: database.ServerOperation{
+			JobID:     view.ID,
+			ServerID:  view.ServerID,
+			Kind:      view.Kind,
+			Status:    view.Status,
+			Step:      view.Step,
+			Error:     view.Error,
+			Duration:  view.Duration,
+			CreatedAt: view.CreatedAt,
+		},
+		Running:    true,
+		Transcript: job.Transcript().Entries(),
+	}
+}
+
+// ServerOperations 服务器的操作历史(不含执行过程)，进行中的操作在前，其余按时间倒序
+func (s *JobService) ServerOperations(serverID uint) ([]ServerOperationDetail, error) {
+	operations := []ServerOperationDetail{}
+	for _, job := range s.running(serverID) {
+		detail := liveDetail(job)
+		detail.Transcript = nil
+		operations = append(operations, detail)
+	}
+
+	var records []database.ServerOperation
+	if err := s.db.Where("server_id = ?", serverID).Order("id DESC").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		operations = append(operations, ServerOperationDetail{ServerOperation: record})
+	}
+	return operations, nil
+}
+
+// ServerOperation 服务器的一次操作及其执行过程，操作进行中时返回当前已记录的部分
+func (s *JobService) ServerOperation(serverID uint, jobID string) (*ServerOperationDetail, error) {
+	job := s.find(serverID, jobID)
+	if job != nil && !job.Finished() {
+		detail := liveDetail(job)
+		return &detail, nil
+	}
+
+	var record database.ServerOperation
+	err := s.db.Where("server_id = ? AND job_id = ?", serverID, jobID).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// 刚结束尚未保存的任务
+		if job != nil {
+			detail := liveDetail(job)
+			detail.Running = false
+			return &detail, nil
+		}
+		return nil, ErrOperationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	detail := &ServerOperationDetail{ServerOperation: record, Transcript: []TranscriptEntry{}}
+	if record.Transcript != "" {
+		if err := json.Unmarshal([]byte(record.Transcript), &detail.Transcript); err != nil {
+			return nil, err
+		}
+	}
+	return detail, nil
+}
+
+// find 在任务登记表中查找服务器的任务
+func (s *JobService) find(serverID uint, jobID string) *Job {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, job := range s.jobs {
+		if job.ID == jobID && job.ServerID == serverID {
+			return job
+		}
+	}
+	return nil
+}
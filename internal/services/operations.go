@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"l2tp-manager/internal/database"
+	"l2tp-manager/internal/logger"
+)
+
+// ServerStatusInterrupted 启动/停止/重启操作因面板关闭而中止，面板启动后恢复执行
+const ServerStatusInterrupted = "interrupted"
+
+// interruptGrace 中止剩余操作后等待其保存中断状态的时间
+const interruptGrace = 5 * time.Second
+
+var (
+	// ErrShuttingDown 面板正在关闭，不再接受新的服务器操作
+	ErrShuttingDown = errors.New("面板正在关闭，请稍后重试")
+	// ErrOperationInterrupted 关闭面板时操作未在超时内完成而被中止
+	ErrOperationInterrupted = errors.New("面板关闭，操作已中断")
+)
+
+// serverOperations 后台执行的服务器操作。关闭面板时不再接受新操作并等待进行中的操作完成，
+// 超时后取消剩余操作的上下文，关闭其SSH连接
+type serverOperations struct {
+	ctx     context.Context // 以ErrOperationInterrupted取消时中止全部进行中的操作
+	cancel  context.CancelCauseFunc
+	count   int
+	closing bool
+	idle    chan struct{} // 开始关闭时创建，进行中的操作全部结束后关闭
+	mutex   sync.Mutex
+}
+
+// newServerOperations 创建服务器操作登记
+func newServerOperations() *serverOperations {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	return &serverOperations{ctx: ctx, cancel: cancel}
+}
+
+// accepting 面板正在关闭时返回ErrShuttingDown
+func (o *serverOperations) accepting() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if o.closing {
+		return ErrShuttingDown
+	}
+	return nil
+}
+
+// begin 登记一个操作，返回的上下文在超过serverOperationTimeout或关闭面板中止操作时取消，
+// 操作结束后调用done
+func (o *serverOperations) begin(parent context.Context) (ctx context.Context, done func()) {
+	o.mutex.Lock()
+	o.count++
+	o.mutex.Unlock()
+
+	ctx, cancelTimeout := context.WithTimeout(parent, serverOperationTimeout)
+	ctx, cancel := context.WithCancelCause(ctx)
+	stop := context.AfterFunc(o.ctx, func() { cancel(context.Cause(o.ctx)) })
+	return ctx, func() {
+		stop()
+		cancel(nil)
+		cancelTimeout()
+
+		o.mutex.Lock()
+		defer o.mutex.Unlock()
+		o.count--
+		if o.count == 0 && o.idle != nil {
+			close(o.idle)
+			o.idle = nil
+		}
+	}
+}
+
+// Shutdown 不再接受新的服务器操作，等待进行中的操作完成。ctx到期时中止剩余操作，
+// 被中止的服务器记为中断状态，由下次启动时的RecoverInterrupted恢复执行
+func (s *L2TPService) Shutdown(ctx context.Context) error {
+	o := s.operations
+	o.mutex.Lock()
+	o.closing = true
+	count := o.count
+	if count == 0 {
+		o.mutex.Unlock()
+		return nil
+	}
+	o.idle = make(chan struct{})
+	idle := o.idle
+	o.mutex.Unlock()
+
+	slog.Info("等待进行中的服务器操作完成", "count", count)
+	select {
+	case <-idle:
+		slog.Info("服务器操作已全部完成")
+		return nil
+	case <-ctx.Done():
+	}
+
+	o.mutex.Lock()
+	count = o.count
+	o.mutex.Unlock()
+	slog.Warn("服务器操作未在关闭超时内完成，中止剩余操作", "count", count)
+	o.cancel(ErrOperationInterrupted)
+	select {
+	case <-idle:
+		return nil
+	case <-time.After(interruptGrace):
+		return errors.New("部分服务器操作未能保存中断状态")
+	}
+}
+
+// failServer 操作失败时更新服务器状态：因关闭面板而中止的操作记为中断并保存操作类型，其余记为错误
+func (s *L2TPService) failServer(ctx context.Context, id uint, job *Job) {
+	if !errors.Is(context.Cause(ctx), ErrOperationInterrupted) {
+		s.updateServerStatus(id, "error")
+		return
+	}
+
+	db := s.db.WithContext(context.WithoutCancel(ctx))
+	if err := db.Model(&database.L2TPServer{}).Where("id = ?", id).Update("interrupted_operation", job.Kind).Error; err != nil {
+		slog.ErrorContext(ctx, "保存中断的服务器操作失败", "server_id", id, "error", err)
+	}
+	s.updateServerStatus(id, ServerStatusInterrupted)
+	slog.WarnContext(ctx, "服务器操作已中断，将在面板启动后恢复", "server_id", id, "operation", job.Kind)
+}
+
+// RecoverInterrupted 恢复上次关闭时中断的操作：中断状态的服务器以及停留在启动中/停止中的服务器
+// (面板异常退出)复位为错误状态后重新执行原操作，未记录操作类型时按所处状态推断
+func (s *L2TPService) RecoverInterrupted(ctx context.Context) {
+	var servers []database.L2TPServer
+	err := s.db.WithContext(ctx).
+		Where("status IN ?", []string{ServerStatusInterrupted, "starting", "stopping"}).
+		Find(&servers).Error
+	if err != nil {
+		slog.Error("加载中断的服务器失败", "error", err)
+		return
+	}
+
+	for _, server := range servers {
+		operation := server.InterruptedOperation
+		if operation == "" {
+			operation = JobKindStart
+			if server.Status == "stopping" {
+				operation = JobKindStop
+			}
+		}
+
+		// 错误状态可以重新启动或停止，复位时不推送状态事件
+		err := s.db.WithContext(ctx).Model(&database.L2TPServer{}).Where("id = ?", server.ID).
+			Updates(map[string]interface{}{"status": "error", "interrupted_operation": ""}).Error
+		if err != nil {
+			slog.Error("复位中断的服务器失败", "server_id", server.ID, "error", err)
+			continue
+		}
+
+		ctx := logger.WithRequestID(ctx, "recover-"+logger.NewRequestID())
+		slog.InfoContext(ctx, "恢复中断的服务器操作", "server_id", server.ID, "status", server.Status, "operation", operation)
+		switch operation {
+		case JobKindStop:
+			_, err = s.StopServerJob(ctx, server.ID)
+		case JobKindRestart:
+			_, err = s.RestartServerJob(ctx, server.ID)
+		default:
+			_, err = s.StartServerJob(ctx, server.ID)
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "恢复中断的服务器操作失败", "server_id", server.ID, "operation", operation, "error", err)
+		}
+	}
+}
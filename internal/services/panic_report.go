@@ -0,0 +1,256 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"l2tp-manager/internal/logger"
+)
+
+// SettingSentryDSN Sentry项目的DSN，设置后捕获的panic同时上报到Sentry
+const SettingSentryDSN = "sentry_dsn"
+
+const (
+	// panicNotifyInterval 同一位置的panic在该时间内只发送一次通知
+	panicNotifyInterval = 10 * time.Minute
+	// panicRestartDelay 后台任务panic后重新启动前的等待时间
+	panicRestartDelay = 5 * time.Second
+)
+
+// PanicReport 一次被捕获的panic
+type PanicReport struct {
+	Source    string            // 发生位置，如 http、task:health、server_job
+	Value     interface{}       // recover()的返回值
+	Stack     []byte            // 发生panic的协程调用栈
+	Frames    []runtime.Frame   // 调用栈帧，最内层在前
+	RequestID string            // 关联的请求ID
+	Tags      map[string]string // 附加信息，如请求方法和路由
+}
+
+// Message panic的描述
+func (p *PanicReport) Message() string {
+	if err, ok := p.Value.(error); ok {
+		return err.Error()
+	}
+	return fmt.Sprint(p.Value)
+}
+
+// ErrorReporter 捕获HTTP处理器和后台协程中的panic：输出带调用栈的结构化日志，发送通知事件，
+// 设置了Sentry DSN时上报到Sentry，避免单个请求或任务的异常导致进程退出。各方法对nil安全
+type ErrorReporter struct {
+	settings *SettingsService
+	notifier *NotificationService
+	release  string
+	client   *http.Client
+	notified map[string]time.Time // 各位置最近一次发送通知的时间
+	mutex    sync.Mutex
+}
+
+// NewErrorReporter 创建异常上报服务并注册Sentry设置项，release为上报的版本号
+func NewErrorReporter(settings *SettingsService, notifier *NotificationService, release string) *ErrorReporter {
+	settings.Register(SettingDef{Key: SettingSentryDSN, Type: SettingTypeString, Secret: true, Description: "Sentry DSN，设置后捕获的panic同时上报到Sentry，为空表示不上报"})
+	return &ErrorReporter{
+		settings: settings,
+		notifier: notifier,
+		release:  release,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		notified: make(map[string]time.Time),
+	}
+}
+
+// NewPanicReport 在recover所在的defer函数中调用，记录当前协程的调用栈
+func NewPanicReport(ctx context.Context, source string, recovered interface{}) *PanicReport {
+	report := &PanicReport{
+		Source:    source,
+		Value:     recovered,
+		Stack:     debug.Stack(),
+		RequestID: logger.RequestID(ctx),
+	}
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		// 跳过panic本身的运行时帧
+		if !strings.HasPrefix(frame.Function, "runtime.") {
+			report.Frames = append(report.Frames, frame)
+		}
+		if !more {
+			break
+		}
+	}
+	return report
+}
+
+// Recover 以defer调用，捕获panic并上报，所在协程随后正常返回
+func (r *ErrorReporter) Recover(ctx context.Context, source string) {
+	if recovered := recover(); recovered != nil {
+		r.Report(NewPanicReport(ctx, source, recovered))
+	}
+}
+
+// Go 在新协程中执行后台任务，任务panic时上报并在panicRestartDelay后重新启动，ctx结束后不再重启
+func (r *ErrorReporter) Go(ctx context.Context, name string, task func(ctx context.Context)) {
+	go func() {
+		for {
+			if !r.run(ctx, name, task) || ctx.Err() != nil {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(panicRestartDelay):
+				slog.Warn("重新启动发生异常的后台任务", "task", name)
+			}
+		}
+	}()
+}
+
+// run 执行一次后台任务，返回是否发生了panic
+func (r *ErrorReporter) run(ctx context.Context, name string, task func(ctx context.Context)) (panicked bool) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			panicked = true
+			r.Report(NewPanicReport(ctx, "task:"+name, recovered))
+		}
+	}()
+	task(ctx)
+	return false
+}
+
+// Report 输出日志，发送通知并上报到Sentry
+func (r *ErrorReporter) Report(report *PanicReport) {
+	slog.Error("捕获到panic", "source", report.Source, "panic", report.Message(), "request_id", report.RequestID, "stack", string(report.Stack))
+	if r == nil {
+		return
+	}
+
+	if r.notifier != nil && r.shouldNotify(report) {
+		r.notifier.Publish(Event{
+			Type:    EventPanic,
+			Message: fmt.Sprintf("%s 发生异常: %s", report.Source, report.Message()),
+			Data:    map[string]interface{}{"source": report.Source, "request_id": report.RequestID, "tags": report.Tags},
+		})
+	}
+
+	if dsn := strings.TrimSpace(r.settings.Get(SettingSentryDSN)); dsn != "" {
+		go func() {
+			if err := r.sendSentry(dsn, report); err != nil {
+				slog.Warn("上报Sentry失败", "error", err)
+			}
+		}()
+	}
+}
+
+// shouldNotify 同一位置同一消息的panic在panicNotifyInterval内只通知一次
+func (r *ErrorReporter) shouldNotify(report *PanicReport) bool {
+	key := report.Source + "\n" + report.Message()
+	now := time.Now()
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if last, ok := r.notified[key]; ok && now.Sub(last) < panicNotifyInterval {
+		return false
+	}
+	for k, last := range r.notified {
+		if now.Sub(last) >= panicNotifyInterval {
+			delete(r.notified, k)
+		}
+	}
+	r.notified[key] = now
+	return true
+}
+
+// sentryFrame Sentry事件中的调用栈帧
+type sentryFrame struct {
+	Function string `json:"function"`
+	Filename string `json:"filename"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+// sendSentry 通过Sentry的store接口上报事件。DSN格式为 https://<key>@<host>/<project>
+func (r *ErrorReporter) sendSentry(dsn string, report *PanicReport) error {
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil || u.Host == "" {
+		return fmt.Errorf("Sentry DSN格式不正确")
+	}
+	path := strings.TrimSuffix(u.Path, "/")
+	slash := strings.LastIndex(path, "/")
+	project := path[slash+1:]
+	if project == "" {
+		return fmt.Errorf("Sentry DSN缺少项目ID")
+	}
+	endpoint := fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, path[:slash], project)
+
+	// Sentry要求调用栈帧按调用顺序排列，最内层在最后
+	frames := make([]sentryFrame, len(report.Frames))
+	for i, frame := range report.Frames {
+		frames[len(frames)-1-i] = sentryFrame{
+			Function: frame.Function,
+			Filename: frame.File,
+			Lineno:   frame.Line,
+			InApp:    strings.HasPrefix(frame.Function, "l2tp-manager/") || strings.HasPrefix(frame.Function, "main."),
+		}
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	hostname, _ := os.Hostname()
+	tags := map[string]string{"source": report.Source}
+	for k, v := range report.Tags {
+		tags[k] = v
+	}
+	if report.RequestID != "" {
+		tags["request_id"] = report.RequestID
+	}
+	event := map[string]interface{}{
+		"event_id":    hex.EncodeToString(id),
+		"timestamp":   time.Now().UTC().Format(time.RFC3339),
+		"level":       "fatal",
+		"platform":    "go",
+		"logger":      "l2tp-manager",
+		"release":     r.release,
+		"server_name": hostname,
+		"tags":        tags,
+		"exception": map[string]interface{}{
+			"values": []map[string]interface{}{{
+				"type":       "panic",
+				"value":      report.Message(),
+				"mechanism":  map[string]interface{}{"type": "go.panic", "handled": true},
+				"stacktrace": map[string]interface{}{"frames": frames},
+			}},
+		},
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", fmt.Sprintf("Sentry sentry_version=7, sentry_client=l2tp-manager/%s, sentry_key=%s", r.release, u.User.Username()))
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Sentry返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"l2tp-manager/internal/database"
+)
+
+// ServerPatch 服务器部分更新，nil字段保持原值
+type ServerPatch struct {
+	Name                 *string    `json:"name"`
+	Host                 *string    `json:"host"`
+	Port                 *int       `json:"port"`
+	Username             *string    `json:"username"`
+	Password             *string    `json:"password"`
+	L2TPPort             *int       `json:"l2tp_port"`
+	PSK                  *string    `json:"psk"`
+	Users                *string    `json:"users"`
+	ExpireDate           *time.Time `json:"expire_date"`
+	EnableOpenVPN        *bool      `json:"enable_openvpn"`
+	OpenVPNRelayPort     *int       `json:"openvpn_relay_port"`
+	EnableSSTP           *bool      `json:"enable_sstp"`
+	SSTPRelayPort        *int       `json:"sstp_relay_port"`
+	RestartSchedule      *string    `json:"restart_schedule"`
+	RestartJitter        *int       `json:"restart_jitter"`
+	RestartSkipIfClients *bool      `json:"restart_skip_if_clients"`
+	RelayNodeID          *uint      `json:"relay_node_id"`
+	ChainNodes           *string    `json:"chain_nodes"`
+	GeoIPMode            *string    `json:"geoip_mode"`
+	GeoIPCountries       *string    `json:"geoip_countries"`
+	OpenVPNProto         *string    `json:"openvpn_proto"`
+	IKEv2Auth            *string    `json:"ikev2_auth"`
+	IKEv2Identity        *string    `json:"ikev2_identity"`
+	IKEv2NATPort         *int       `json:"ikev2_nat_port"`
+	RealityServerName    *string    `json:"reality_server_name"`
+	SoftEtherHub         *string    `json:"softether_hub"`
+	SecureNATDisabled    *bool      `json:"securenat_disabled"`
+	SecureNATAddress     *string    `json:"securenat_address"`
+	DHCPStart            *string    `json:"dhcp_start"`
+	DHCPEnd              *string    `json:"dhcp_end"`
+	ClientDNS            *string    `json:"client_dns"`
+	DNSDomains           *string    `json:"dns_domains"`
+	NATKeepalive         *int       `json:"nat_keepalive"`
+	KnockEnabled         *bool      `json:"knock_enabled"`
+	KnockSecret          *string    `json:"knock_secret"`
+	KnockTTL             *int       `json:"knock_ttl"`
+	Obfuscation          *string    `json:"obfuscation"`
+	ObfuscationPort      *int       `json:"obfuscation_port"`
+	ObfuscationKey       *string    `json:"obfuscation_key"`
+	BillingAnchorDay     *int       `json:"billing_anchor_day"`
+	BillingTimezone      *string    `json:"billing_timezone"`
+}
+
+// Validate 校验补丁中提供的字段
+func (p *ServerPatch) Validate() error {
+	required := []struct {
+		field string
+		value *string
+	}{
+		{"name", p.Name}, {"host", p.Host}, {"username", p.Username}, {"password", p.Password}, {"psk", p.PSK},
+	}
+	for _, item := range required {
+		if item.value != nil && strings.TrimSpace(*item.value) == "" {
+			return fmt.Errorf("字段 %s 不能为空", item.field)
+		}
+	}
+
+	ports := []struct {
+		field    string
+		value    *int
+		optional bool // 附加协议端口允许为0(未设置)
+	}{
+		{"port", p.Port, false},
+		{"l2tp_port", p.L2TPPort, false},
+		{"openvpn_relay_port", p.OpenVPNRelayPort, true},
+		{"sstp_relay_port", p.SSTPRelayPort, true},
+		{"ikev2_nat_port", p.IKEv2NATPort, true},
+	}
+	for _, item := range ports {
+		if item.value == nil {
+			continue
+		}
+		if *item.value < 0 || *item.value > 65535 || (*item.value == 0 && !item.optional) {
+			return fmt.Errorf("字段 %s 不是有效端口", item.field)
+		}
+	}
+
+	if p.RestartSchedule != nil && *p.RestartSchedule != "" {
+		if _, err := ParseCron(*p.RestartSchedule); err != nil {
+			return fmt.Errorf("定时重启计划无效: %v", err)
+		}
+	}
+	if p.RestartJitter != nil && *p.RestartJitter < 0 {
+		return fmt.Errorf("定时重启随机延迟不能为负数")
+	}
+	return nil
+}
+
+// Apply 将补丁应用到服务器记录
+func (p *ServerPatch) Apply(server *database.L2TPServer) {
+	setString := func(dst *string, src *string) {
+		if src != nil {
+			*dst = *src
+		}
+	}
+	setInt := func(dst *int, src *int) {
+		if src != nil {
+			*dst = *src
+		}
+	}
+	setBool := func(dst *bool, src *bool) {
+		if src != nil {
+			*dst = *src
+		}
+	}
+
+	setString(&server.Name, p.Name)
+	setString(&server.Host, p.Host)
+	setInt(&server.Port, p.Port)
+	setString(&server.Username, p.Username)
+	setString(&server.Password, p.Password)
+	setInt(&server.L2TPPort, p.L2TPPort)
+	setString(&server.PSK, p.PSK)
+	setString(&server.Users, p.Users)
+	if p.ExpireDate != nil {
+		server.ExpireDate = *p.ExpireDate
+	}
+	setBool(&server.EnableOpenVPN, p.EnableOpenVPN)
+	setInt(&server.OpenVPNRelayPort, p.OpenVPNRelayPort)
+	setBool(&server.EnableSSTP, p.EnableSSTP)
+	setInt(&server.SSTPRelayPort, p.SSTPRelayPort)
+	setString(&server.RestartSchedule, p.RestartSchedule)
+	setInt(&server.RestartJitter, p.RestartJitter)
+	setBool(&server.RestartSkipIfClients, p.RestartSkipIfClients)
+	setString(&server.OpenVPNProto, p.OpenVPNProto)
+	setString(&server.IKEv2Auth, p.IKEv2Auth)
+	setString(&server.IKEv2Identity, p.IKEv2Identity)
+	setInt(&server.IKEv2NATPort, p.IKEv2NATPort)
+	setString(&server.RealityServerName, p.RealityServerName)
+	if p.RelayNodeID != nil {
+		server.RelayNodeID = *p.RelayNodeID
+	}
+	setString(&server.ChainNodes, p.ChainNodes)
+	setString(&server.GeoIPMode, p.GeoIPMode)
+	setString(&server.GeoIPCountries, p.GeoIPCountries)
+	setString(&server.SoftEtherHub, p.SoftEtherHub)
+	setBool(&server.SecureNATDisabled, p.SecureNATDisabled)
+	setString(&server.SecureNATAddress, p.SecureNATAddress)
+	setString(&server.DHCPStart, p.DHCPStart)
+	setString(&server.DHCPEnd, p.DHCPEnd)
+	setString(&server.ClientDNS, p.ClientDNS)
+	setString(&server.DNSDomains, p.DNSDomains)
+	setInt(&server.NATKeepalive, p.NATKeepalive)
+	setBool(&server.KnockEnabled, p.KnockEnabled)
+	setString(&server.KnockSecret, p.KnockSecret)
+	setInt(&server.KnockTTL, p.KnockTTL)
+	setString(&server.Obfuscation, p.Obfuscation)
+	setInt(&server.ObfuscationPort, p.ObfuscationPort)
+	setString(&server.ObfuscationKey, p.ObfuscationKey)
+	setInt(&server.BillingAnchorDay, p.BillingAnchorDay)
+	setString(&server.BillingTimezone, p.BillingTimezone)
+}
+
+// PatchServer 部分更新服务器，返回更新前后的记录
+func (s *L2TPService) PatchServer(id uint, patch *ServerPatch) (*database.L2TPServer, *database.L2TPServer, error) {
+	if err := patch.Validate(); err != nil {
+		return nil, nil, err
+	}
+	if patch.Users != nil {
+		if _, err := s.ParseUsers(*patch.Users); err != nil {
+			return nil, nil, fmt.Errorf("用户配置格式错误: %v", err)
+		}
+	}
+
+	before, err := s.GetServer(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	after := *before
+	patch.Apply(&after)
+	if err := s.UpdateServer(id, &after); err != nil {
+		return nil, nil, err
+	}
+	return before, &after, nil
+}
@@ -0,0 +1,348 @@
+package services
+
+import (
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"unicode/utf16"
+)
+
+// PKCS#12编码使用的对象标识符(RFC 7292)
+var (
+	oidPKCS7Data             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidPKCS7EncryptedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+	oidShroudedKeyBag        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidCertBag               = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidCertTypeX509          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidPBEWithSHAAnd3KeyTDES = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}
+	oidSHA1                  = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidFriendlyName          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 20}
+	oidLocalKeyID            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 21}
+)
+
+// PKCS#12加密参数
+const (
+	pkcs12Iterations = 2048
+	pkcs12SaltSize   = 8
+	pkcs12HashBlock  = 64 // SHA-1的分组长度，即KDF中的v
+
+	pkcs12MaterialKey = 1 // KDF的用途标识：加密密钥、IV和MAC密钥
+	pkcs12MaterialIV  = 2
+	pkcs12MaterialMAC = 3
+)
+
+// pkcs12PFX 及以下结构对应RFC 7292中的ASN.1定义
+type pkcs12PFX struct {
+	Version  int
+	AuthSafe pkcs12ContentInfo
+	MacData  pkcs12MacData
+}
+
+type pkcs12ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+type pkcs12MacData struct {
+	Mac        pkcs12DigestInfo
+	MacSalt    []byte
+	Iterations int
+}
+
+type pkcs12DigestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type pkcs12SafeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue
+	Attributes []pkcs12Attribute `asn1:"set,optional"`
+}
+
+type pkcs12Attribute struct {
+	ID     asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+type pkcs12CertBag struct {
+	ID   asn1.ObjectIdentifier
+	Data asn1.RawValue
+}
+
+type pkcs12PBEParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+type pkcs12EncryptedPrivateKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Data      []byte
+}
+
+type pkcs12EncryptedData struct {
+	Version              int
+	EncryptedContentInfo pkcs12EncryptedContentInfo
+}
+
+type pkcs12EncryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           []byte `asn1:"tag:0,optional"`
+}
+
+// encodePKCS12 将客户端证书、私钥和CA证书编码为PKCS#12文件，供iOS、macOS和Windows导入。
+// 使用兼容性最好的pbeWithSHAAnd3-KeyTripleDES-CBC加密和HMAC-SHA1完整性校验
+func encodePKCS12(cert *x509.Certificate, key interface{}, ca *x509.Certificate, password, friendlyName string) ([]byte, error) {
+	encodedPassword := bmpStringZeroTerminated(password)
+	attributes, err := pkcs12BagAttributes(friendlyName)
+	if err != nil {
+		return nil, err
+	}
+
+	// 证书包：客户端证书带有与私钥相同的localKeyId，CA证书不带属性
+	certBag, err := pkcs12CertSafeBag(cert.Raw, attributes)
+	if err != nil {
+		return nil, err
+	}
+	caBag, err := pkcs12CertSafeBag(ca.Raw, nil)
+	if err != nil {
+		return nil, err
+	}
+	certContents, err := asn1.Marshal([]pkcs12SafeBag{certBag, caBag})
+	if err != nil {
+		return nil, err
+	}
+	encryptedCerts, err := pkcs12EncryptedContent(certContents, encodedPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	// 私钥包
+	keyBag, err := pkcs12ShroudedKeyBag(key, encodedPassword, attributes)
+	if err != nil {
+		return nil, err
+	}
+	keyContents, err := asn1.Marshal([]pkcs12SafeBag{keyBag})
+	if err != nil {
+		return nil, err
+	}
+	keyData, err := pkcs12DataContent(keyContents)
+	if err != nil {
+		return nil, err
+	}
+
+	authenticatedSafe, err := asn1.Marshal([]pkcs12ContentInfo{encryptedCerts, keyData})
+	if err != nil {
+		return nil, err
+	}
+	authSafe, err := pkcs12DataContent(authenticatedSafe)
+	if err != nil {
+		return nil, err
+	}
+
+	// 对AuthenticatedSafe计算MAC
+	macSalt := make([]byte, pkcs12SaltSize)
+	if _, err := rand.Read(macSalt); err != nil {
+		return nil, err
+	}
+	macKey := pkcs12KDF(macSalt, encodedPassword, pkcs12Iterations, pkcs12MaterialMAC, sha1.Size)
+	mac := hmac.New(sha1.New, macKey)
+	mac.Write(authenticatedSafe)
+
+	return asn1.Marshal(pkcs12PFX{
+		Version:  3,
+		AuthSafe: authSafe,
+		MacData: pkcs12MacData{
+			Mac: pkcs12DigestInfo{
+				Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA1, Parameters: asn1.NullRawValue},
+				Digest:    mac.Sum(nil),
+			},
+			MacSalt:    macSalt,
+			Iterations: pkcs12Iterations,
+		},
+	})
+}
+
+// pkcs12BagAttributes 证书和私钥共用的friendlyName和localKeyId属性
+func pkcs12BagAttributes(friendlyName string) ([]pkcs12Attribute, error) {
+	name, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagBMPString, Bytes: bmpString(friendlyName)})
+	if err != nil {
+		return nil, err
+	}
+	keyID, err := asn1.Marshal([]byte{1})
+	if err != nil {
+		return nil, err
+	}
+	return []pkcs12Attribute{
+		{ID: oidFriendlyName, Values: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: name}},
+		{ID: oidLocalKeyID, Values: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: keyID}},
+	}, nil
+}
+
+// pkcs12CertSafeBag 构造证书包
+func pkcs12CertSafeBag(der []byte, attributes []pkcs12Attribute) (pkcs12SafeBag, error) {
+	data, err := asn1.Marshal(der)
+	if err != nil {
+		return pkcs12SafeBag{}, err
+	}
+	bag, err := asn1.Marshal(pkcs12CertBag{ID: oidCertTypeX509, Data: explicitTag0(data)})
+	if err != nil {
+		return pkcs12SafeBag{}, err
+	}
+	return pkcs12SafeBag{ID: oidCertBag, Value: explicitTag0(bag), Attributes: attributes}, nil
+}
+
+// pkcs12ShroudedKeyBag 构造加密的私钥包
+func pkcs12ShroudedKeyBag(key interface{}, password []byte, attributes []pkcs12Attribute) (pkcs12SafeBag, error) {
+	plain, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return pkcs12SafeBag{}, err
+	}
+	algorithm, encrypted, err := pkcs12Encrypt(plain, password)
+	if err != nil {
+		return pkcs12SafeBag{}, err
+	}
+	info, err := asn1.Marshal(pkcs12EncryptedPrivateKeyInfo{Algorithm: algorithm, Data: encrypted})
+	if err != nil {
+		return pkcs12SafeBag{}, err
+	}
+	return pkcs12SafeBag{ID: oidShroudedKeyBag, Value: explicitTag0(info), Attributes: attributes}, nil
+}
+
+// pkcs12DataContent 构造data类型的ContentInfo
+func pkcs12DataContent(content []byte) (pkcs12ContentInfo, error) {
+	data, err := asn1.Marshal(content)
+	if err != nil {
+		return pkcs12ContentInfo{}, err
+	}
+	return pkcs12ContentInfo{ContentType: oidPKCS7Data, Content: explicitTag0(data)}, nil
+}
+
+// pkcs12EncryptedContent 构造encryptedData类型的ContentInfo
+func pkcs12EncryptedContent(content, password []byte) (pkcs12ContentInfo, error) {
+	algorithm, encrypted, err := pkcs12Encrypt(content, password)
+	if err != nil {
+		return pkcs12ContentInfo{}, err
+	}
+	data, err := asn1.Marshal(pkcs12EncryptedData{
+		Version: 0,
+		EncryptedContentInfo: pkcs12EncryptedContentInfo{
+			ContentType:                oidPKCS7Data,
+			ContentEncryptionAlgorithm: algorithm,
+			EncryptedContent:           encrypted,
+		},
+	})
+	if err != nil {
+		return pkcs12ContentInfo{}, err
+	}
+	return pkcs12ContentInfo{ContentType: oidPKCS7EncryptedData, Content: explicitTag0(data)}, nil
+}
+
+// pkcs12Encrypt 使用pbeWithSHAAnd3-KeyTripleDES-CBC加密
+func pkcs12Encrypt(plain, password []byte) (pkix.AlgorithmIdentifier, []byte, error) {
+	salt := make([]byte, pkcs12SaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+	params, err := asn1.Marshal(pkcs12PBEParams{Salt: salt, Iterations: pkcs12Iterations})
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+
+	key := pkcs12KDF(salt, password, pkcs12Iterations, pkcs12MaterialKey, 24)
+	iv := pkcs12KDF(salt, password, pkcs12Iterations, pkcs12MaterialIV, des.BlockSize)
+	block, err := des.NewTripleDESCipher(key)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+
+	padding := des.BlockSize - len(plain)%des.BlockSize
+	data := make([]byte, len(plain), len(plain)+padding)
+	copy(data, plain)
+	for i := 0; i < padding; i++ {
+		data = append(data, byte(padding))
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+
+	return pkix.AlgorithmIdentifier{Algorithm: oidPBEWithSHAAnd3KeyTDES, Parameters: asn1.RawValue{FullBytes: params}}, data, nil
+}
+
+// pkcs12KDF RFC 7292附录B的密钥派生函数(SHA-1)
+func pkcs12KDF(salt, password []byte, iterations int, id byte, size int) []byte {
+	v := pkcs12HashBlock
+	fill := func(data []byte) []byte {
+		if len(data) == 0 {
+			return nil
+		}
+		out := make([]byte, v*((len(data)+v-1)/v))
+		for i := range out {
+			out[i] = data[i%len(data)]
+		}
+		return out
+	}
+
+	diversifier := make([]byte, v)
+	for i := range diversifier {
+		diversifier[i] = id
+	}
+	input := append(fill(salt), fill(password)...)
+
+	var result []byte
+	one := big.NewInt(1)
+	for len(result) < size {
+		hash := sha1.Sum(append(append([]byte{}, diversifier...), input...))
+		a := hash[:]
+		for i := 1; i < iterations; i++ {
+			next := sha1.Sum(a)
+			a = next[:]
+		}
+		result = append(result, a...)
+
+		// I_j = (I_j + B + 1) mod 2^(v*8)
+		b := new(big.Int).SetBytes(fill(a)[:v])
+		b.Add(b, one)
+		for j := 0; j < len(input); j += v {
+			block := new(big.Int).SetBytes(input[j : j+v])
+			block.Add(block, b)
+			bytes := block.Bytes()
+			if len(bytes) > v {
+				bytes = bytes[len(bytes)-v:]
+			}
+			chunk := input[j : j+v]
+			for k := range chunk {
+				chunk[k] = 0
+			}
+			copy(chunk[v-len(bytes):], bytes)
+		}
+	}
+	return result[:size]
+}
+
+// explicitTag0 将DER数据包装为[0] EXPLICIT
+func explicitTag0(der []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: der}
+}
+
+// bmpString UTF-16BE编码
+func bmpString(value string) []byte {
+	var out []byte
+	for _, r := range utf16.Encode([]rune(value)) {
+		out = append(out, byte(r>>8), byte(r))
+	}
+	return out
+}
+
+// bmpStringZeroTerminated PKCS#12口令编码：UTF-16BE并以两个零字节结尾，空口令编码为空
+func bmpStringZeroTerminated(value string) []byte {
+	if value == "" {
+		return nil
+	}
+	return append(bmpString(value), 0, 0)
+}
@@ -0,0 +1,319 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+
+	"l2tp-manager/internal/database"
+)
+
+// 证书有效期，落地机证书随服务器记录保存，删除服务器前不会轮换
+const (
+	pkiCAValidity   = 20 * 365 * 24 * time.Hour
+	pkiCertValidity = 10 * 365 * 24 * time.Hour
+)
+
+// ServerPKI 证书类服务器(OpenVPN、IKEv2)的CA和证书，PEM格式
+type ServerPKI struct {
+	CACert     string      `json:"ca_cert"`
+	CAKey      string      `json:"ca_key"`
+	ServerCert string      `json:"server_cert"`
+	ServerKey  string      `json:"server_key"`
+	TLSCrypt   string      `json:"tls_crypt,omitempty"` // OpenVPN tls-crypt静态密钥
+	Clients    []PKIClient `json:"clients,omitempty"`   // 客户端证书(IKEv2证书认证)
+	Revoked    []string    `json:"revoked,omitempty"`   // 已吊销的客户端证书序列号(十六进制)，写入CRL
+}
+
+// PKIClient 用户的客户端证书
+type PKIClient struct {
+	Name string `json:"name"`
+	Cert string `json:"cert"`
+	Key  string `json:"key"`
+}
+
+// parsePKI 解析服务器记录中的证书
+func parsePKI(value string) (*ServerPKI, error) {
+	if value == "" {
+		return nil, fmt.Errorf("服务器证书尚未生成")
+	}
+	var pki ServerPKI
+	if err := json.Unmarshal([]byte(value), &pki); err != nil {
+		return nil, fmt.Errorf("解析服务器证书失败: %v", err)
+	}
+	return &pki, nil
+}
+
+// serverUsesPKI 判断服务器类型是否需要证书
+func serverUsesPKI(serverType string) bool {
+	return serverType == ServerTypeOpenVPN || serverType == ServerTypeIKEv2
+}
+
+// preparePKI 为证书类服务器生成CA、服务端证书和tls-crypt密钥，已有证书时沿用；
+// IKEv2服务器还会按服务端标识和用户配置同步证书。existing为更新前的记录，创建时为nil
+func preparePKI(server, existing *database.L2TPServer) error {
+	if !serverUsesPKI(server.Type) {
+		server.PKI = ""
+		return nil
+	}
+	if existing != nil {
+		server.PKI = existing.PKI
+	}
+
+	var pki *ServerPKI
+	var err error
+	if server.PKI != "" {
+		pki, err = parsePKI(server.PKI)
+	} else {
+		pki, err = newServerPKI(server)
+	}
+	if err != nil {
+		return err
+	}
+	if server.Type == ServerTypeIKEv2 {
+		if err := syncIKEv2Certs(pki, server); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(pki)
+	if err != nil {
+		return err
+	}
+	server.PKI = string(data)
+	return nil
+}
+
+// newServerPKI 生成CA和服务端证书，OpenVPN服务器同时生成tls-crypt密钥
+func newServerPKI(server *database.L2TPServer) (*ServerPKI, error) {
+	caCert, caKey, err := newCA(server.Name)
+	if err != nil {
+		return nil, fmt.Errorf("生成CA证书失败: %v", err)
+	}
+	commonName := "server"
+	if server.Type == ServerTypeIKEv2 {
+		commonName = server.IKEv2Identity
+	}
+	serverCert, serverKey, err := issueServerCert(caCert, caKey, commonName, certNames(server.IKEv2Identity)...)
+	if err != nil {
+		return nil, fmt.Errorf("生成服务端证书失败: %v", err)
+	}
+	pki := &ServerPKI{
+		CACert:     encodeCert(caCert),
+		CAKey:      encodeKey(caKey),
+		ServerCert: encodeCert(serverCert),
+		ServerKey:  encodeKey(serverKey),
+	}
+	if server.Type == ServerTypeOpenVPN {
+		if pki.TLSCrypt, err = generateOpenVPNStaticKey(); err != nil {
+			return nil, fmt.Errorf("生成tls-crypt密钥失败: %v", err)
+		}
+	}
+	return pki, nil
+}
+
+// loadCA 解析CA证书和私钥
+func (p *ServerPKI) loadCA() (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	cert, err := decodeCert(p.CACert)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := decodeKey(p.CAKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+// revokedCRL 生成包含已吊销客户端证书的CRL(PEM格式)
+func (p *ServerPKI) revokedCRL() (string, error) {
+	ca, caKey, err := p.loadCA()
+	if err != nil {
+		return "", err
+	}
+	var entries []x509.RevocationListEntry
+	for _, serial := range p.Revoked {
+		number, ok := new(big.Int).SetString(serial, 16)
+		if !ok {
+			continue
+		}
+		entries = append(entries, x509.RevocationListEntry{SerialNumber: number, RevocationTime: time.Now()})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(time.Now().Unix()),
+		ThisUpdate:                time.Now().Add(-time.Hour),
+		NextUpdate:                time.Now().Add(pkiCertValidity),
+		RevokedCertificateEntries: entries,
+	}, ca, caKey)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der})), nil
+}
+
+// prepareCredentials 生成或沿用服务器类型所需的密钥和证书
+func prepareCredentials(server, existing *database.L2TPServer) error {
+	if err := prepareWireGuard(server, existing); err != nil {
+		return err
+	}
+	if err := prepareXray(server, existing); err != nil {
+		return err
+	}
+	if err := prepareKnock(server, existing); err != nil {
+		return err
+	}
+	if err := prepareObfuscation(server, existing); err != nil {
+		return err
+	}
+	return preparePKI(server, existing)
+}
+
+// newCA 生成自签名CA证书
+func newCA(name string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: fmt.Sprintf("%s CA", name), Organization: []string{"L2TP Manager"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(pkiCAValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	return cert, key, err
+}
+
+// issueServerCert 使用CA签发服务端证书，names(域名或IP)写入证书的SAN
+func issueServerCert(ca *x509.Certificate, caKey *ecdsa.PrivateKey, commonName string, names ...string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	return issueCert(ca, caKey, commonName, names, x509.ExtKeyUsageServerAuth)
+}
+
+// issueClientCert 使用CA签发客户端证书，用户名同时作为证书的SAN，供IKEv2按身份匹配证书
+func issueClientCert(ca *x509.Certificate, caKey *ecdsa.PrivateKey, name string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	return issueCert(ca, caKey, name, certNames(name), x509.ExtKeyUsageClientAuth)
+}
+
+// issueCert 签发终端证书
+func issueCert(ca *x509.Certificate, caKey *ecdsa.PrivateKey, commonName string, names []string, usage x509.ExtKeyUsage) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(pkiCertValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyAgreement,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if strings.Contains(name, "@") {
+			template.EmailAddresses = append(template.EmailAddresses, name)
+		} else {
+			template.DNSNames = append(template.DNSNames, name)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	return cert, key, err
+}
+
+// certNames 将非空名称转换为SAN列表
+func certNames(name string) []string {
+	if name == "" {
+		return nil
+	}
+	return []string{name}
+}
+
+// decodeCert 解析PEM格式的证书
+func decodeCert(value string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(value))
+	if block == nil {
+		return nil, fmt.Errorf("无效的证书")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// decodeKey 解析PEM格式(PKCS#8)的私钥
+func decodeKey(value string) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(value))
+	if block == nil {
+		return nil, fmt.Errorf("无效的私钥")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("不支持的私钥类型")
+	}
+	return ecKey, nil
+}
+
+// randomSerial 生成证书序列号
+func randomSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+}
+
+// encodeCert 将证书编码为PEM
+func encodeCert(cert *x509.Certificate) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+}
+
+// encodeKey 将私钥编码为PEM(PKCS#8)
+func encodeKey(key *ecdsa.PrivateKey) string {
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+// generateOpenVPNStaticKey 生成OpenVPN静态密钥(2048位，用于tls-crypt)
+func generateOpenVPNStaticKey() (string, error) {
+	key := make([]byte, 256)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	encoded := hex.EncodeToString(key)
+
+	var b strings.Builder
+	b.WriteString("-----BEGIN OpenVPN Static key V1-----\n")
+	for i := 0; i < len(encoded); i += 32 {
+		b.WriteString(encoded[i : i+32])
+		b.WriteString("\n")
+	}
+	b.WriteString("-----END OpenVPN Static key V1-----\n")
+	return b.String(), nil
+}
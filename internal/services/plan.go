@@ -0,0 +1,175 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"l2tp-manager/internal/database"
+)
+
+// PlanStep 计划中的单个步骤
+type PlanStep struct {
+	Step        string `json:"step"`
+	Target      string `json:"target"` // exit_node(落地机SSH) 或 relay(中转机)
+	Command     string `json:"command,omitempty"`
+	Description string `json:"description"`
+}
+
+// OperationPlan 服务器操作执行计划(不会实际执行)
+type OperationPlan struct {
+	ServerID       uint          `json:"server_id"`
+	ServerName     string        `json:"server_name"`
+	Action         string        `json:"action"`
+	SSHTarget      string        `json:"ssh_target"`
+	Steps          []PlanStep    `json:"steps"`
+	DockerRun      string        `json:"docker_run,omitempty"`
+	ForwarderStart []ForwardRule `json:"forwarder_start,omitempty"`
+	ForwarderStop  []ForwardRule `json:"forwarder_stop,omitempty"`
+	Warnings       []string      `json:"warnings,omitempty"`
+}
+
+// PlanOperation 生成服务器操作(start/stop/restart)的执行计划
+func (s *L2TPService) PlanOperation(id uint, action string) (*OperationPlan, error) {
+	server, err := s.GetServer(id)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &OperationPlan{
+		ServerID:   server.ID,
+		ServerName: server.Name,
+		Action:     action,
+		SSHTarget:  fmt.Sprintf("%s@%s:%d", server.Username, server.Host, server.Port),
+	}
+
+	switch action {
+	case "start":
+		if server.Status == "running" {
+			plan.Warnings = append(plan.Warnings, "服务器已在运行中，启动请求会被拒绝")
+		}
+		if server.IsExpired {
+			plan.Warnings = append(plan.Warnings, "服务器已过期，启动请求会被拒绝")
+		}
+		if err := planStart(plan, server); err != nil {
+			return nil, err
+		}
+	case "stop":
+		if server.Status == "stopped" {
+			plan.Warnings = append(plan.Warnings, "服务器已停止，停止请求会被拒绝")
+		}
+		planStop(plan, server)
+		plan.ForwarderStop = ForwardRules(server)
+	case "restart":
+		if server.Status == "running" {
+			planStop(plan, server)
+			plan.ForwarderStop = ForwardRules(server)
+		}
+		if err := planStart(plan, server); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("不支持的操作: %s", action)
+	}
+
+	return plan, nil
+}
+
+// planStart 生成启动容器的步骤，与SSHService.StartL2TPContainerWithCallback保持一致
+func planStart(plan *OperationPlan, server *database.L2TPServer) error {
+	if server.Type == ServerTypeWireGuard {
+		planWireGuardStart(plan, server)
+		return nil
+	}
+
+	var users []L2TPUser
+	if server.Users != "" {
+		if err := json.Unmarshal([]byte(server.Users), &users); err != nil {
+			return fmt.Errorf("解析用户配置失败: %v", err)
+		}
+	}
+
+	sshService := NewSSHService()
+	containerName := serverContainerName(server)
+	// 与执行记录一样隐藏命令中的密码和PSK
+	var secrets secretRedactor
+	secrets.add(serverSecrets(server)...)
+	dockerRun := secrets.redact(sshService.dockerRunCommand(server, containerName, users))
+	if len(users) == 0 {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("未配置%s用户，将使用默认账号 test", serverTypeName(server.Type)))
+	}
+
+	plan.DockerRun = dockerRun
+	plan.Steps = append(plan.Steps,
+		PlanStep{Step: "ssh_connect", Target: "exit_node", Description: "通过SSH连接落地机"},
+		PlanStep{Step: "docker_check", Target: "exit_node", Command: "docker --version && docker info", Description: "检查Docker环境，未安装时自动安装"},
+		PlanStep{Step: "cleanup", Target: "exit_node", Command: fmt.Sprintf("docker stop %s; docker rm %s", containerName, containerName), Description: "清理现有容器"},
+	)
+	if dir, files, err := serverConfigFiles(server, users); err != nil {
+		return err
+	} else if len(files) > 0 {
+		plan.Steps = append(plan.Steps, PlanStep{Step: "config", Target: "exit_node", Description: fmt.Sprintf("写入%s配置、证书和用户文件到 %s", serverTypeName(server.Type), dir)})
+	}
+	plan.Steps = append(plan.Steps,
+		PlanStep{Step: "image_pull", Target: "exit_node", Command: "docker pull " + serverImage(server), Description: "拉取VPN镜像"},
+		PlanStep{Step: "container_start", Target: "exit_node", Command: dockerRun, Description: "启动VPN容器"},
+		PlanStep{Step: "container_ready", Target: "exit_node", Command: fmt.Sprintf("timeout 30 docker events --filter container=%s --filter event=start", containerName), Description: "等待容器启动事件"},
+	)
+	commands, err := softEtherCommands(server, users, "******")
+	if err != nil {
+		return err
+	}
+	if len(commands) > 0 {
+		command := secrets.redact(strings.Join(commands, " && "))
+		plan.Steps = append(plan.Steps, PlanStep{Step: "container_ready", Target: "exit_node", Command: command, Description: fmt.Sprintf("应用虚拟Hub %s 的SecureNAT、DHCP和DNS设置", softEtherHub(server))})
+	}
+	planForwarderStart(plan, server)
+	return nil
+}
+
+// planWireGuardStart 生成启动WireGuard服务的步骤，与SSHService.startWireGuard保持一致
+func planWireGuardStart(plan *OperationPlan, server *database.L2TPServer) {
+	if server.Users == "" || server.Users == "[]" {
+		plan.Warnings = append(plan.Warnings, "未配置用户，WireGuard服务器不会有可用的客户端")
+	}
+	plan.Steps = append(plan.Steps,
+		PlanStep{Step: "ssh_connect", Target: "exit_node", Description: "通过SSH连接落地机"},
+		PlanStep{Step: "wireguard_install", Target: "exit_node", Command: "command -v wg-quick && command -v iptables", Description: "检查WireGuard环境，未安装时通过系统包管理器安装wireguard-tools"},
+		PlanStep{Step: "config", Target: "exit_node", Description: fmt.Sprintf("写入 %s", wireGuardConfigPath)},
+		PlanStep{Step: "service_start", Target: "exit_node", Command: fmt.Sprintf("systemctl enable %s && systemctl restart %s", wireGuardService, wireGuardService), Description: "启动WireGuard服务"},
+		PlanStep{Step: "service_ready", Target: "exit_node", Command: fmt.Sprintf("wg show %s listen-port", wireGuardInterface), Description: "确认WireGuard已监听"},
+	)
+	planForwarderStart(plan, server)
+}
+
+// planForwarderStart 生成启动中转转发的步骤
+func planForwarderStart(plan *OperationPlan, server *database.L2TPServer) {
+	for _, rule := range ForwardRules(server) {
+		plan.Steps = append(plan.Steps, PlanStep{
+			Step:        "forwarder_start",
+			Target:      "relay",
+			Description: fmt.Sprintf("启动 %s 转发: 0.0.0.0:%d(%s) -> %s:%d", rule.Protocol, rule.ListenPort, rule.Network, server.Host, rule.TargetPort),
+		})
+	}
+	plan.ForwarderStart = ForwardRules(server)
+}
+
+// planStop 生成停止容器的步骤，与SSHService.StopL2TPContainerWithCallback保持一致
+func planStop(plan *OperationPlan, server *database.L2TPServer) {
+	if server.Type == ServerTypeWireGuard {
+		plan.Steps = append(plan.Steps,
+			PlanStep{Step: "ssh_connect", Target: "exit_node", Description: "通过SSH连接落地机"},
+			PlanStep{Step: "service_check", Target: "exit_node", Command: fmt.Sprintf("systemctl is-active %s", wireGuardService), Description: "检查WireGuard服务是否运行"},
+			PlanStep{Step: "service_stop", Target: "exit_node", Command: fmt.Sprintf("systemctl disable --now %s", wireGuardService), Description: "停止并禁用WireGuard服务"},
+			PlanStep{Step: "forwarder_stop", Target: "relay", Description: "停止该服务器的全部中转监听"},
+		)
+		return
+	}
+	containerName := serverContainerName(server)
+	plan.Steps = append(plan.Steps,
+		PlanStep{Step: "ssh_connect", Target: "exit_node", Description: "通过SSH连接落地机"},
+		PlanStep{Step: "container_check", Target: "exit_node", Command: fmt.Sprintf("docker ps -a -q -f name=^/%s$", containerName), Description: "检查容器是否存在"},
+		PlanStep{Step: "container_stop", Target: "exit_node", Command: fmt.Sprintf("docker stop %s; docker rm %s", containerName, containerName), Description: "停止并删除容器"},
+		PlanStep{Step: "forwarder_stop", Target: "relay", Description: "停止该服务器的全部中转监听"},
+	)
+}
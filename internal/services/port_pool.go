@@ -0,0 +1,335 @@
+package services
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"l2tp-manager/internal/database"
+
+	"gorm.io/gorm"
+)
+
+// portMutex 串行化中转端口和代理监听端口的分配：数据库冲突检查、端口池校验、本机端口探测和写入
+// 在同一临界区内完成，避免并发请求在检查之后、写入之前选中同一端口
+var portMutex sync.Mutex
+
+// PortPoolRequest 创建或修改端口池的参数
+type PortPoolRequest struct {
+	Name      string `json:"name" binding:"required"`
+	StartPort int    `json:"start_port" binding:"min=1,max=65535"`
+	EndPort   int    `json:"end_port" binding:"min=1,max=65535"`
+	TenantID  uint   `json:"tenant_id"` // 分配给的租户，0表示平台共享
+	Note      string `json:"note"`
+}
+
+// PortPoolView 端口池及其使用情况
+type PortPoolView struct {
+	database.PortPool
+	Size     int `json:"size"`
+	Used     int `json:"used"`      // 已被服务器(含回收站)或代理占用的端口数
+	NextPort int `json:"next_port"` // 下一个可分配的端口，0表示已用完
+}
+
+// PortPoolService 端口池管理
+type PortPoolService struct {
+	db *gorm.DB
+}
+
+// NewPortPoolService 创建端口池服务
+func NewPortPoolService(db *gorm.DB) *PortPoolService {
+	return &PortPoolService{db: db}
+}
+
+// poolContaining 返回包含端口的端口池，端口池之间不重叠
+func poolContaining(pools []database.PortPool, port int) *database.PortPool {
+	for i := range pools {
+		if port >= pools[i].StartPort && port <= pools[i].EndPort {
+			return &pools[i]
+		}
+	}
+	return nil
+}
+
+// usedPorts 端口登记表中已被占用的端口(面板自身、服务器中转端口和代理监听端口)，值为占用者描述
+func usedPorts(tx *gorm.DB) (map[int]string, error) {
+	owners, err := portOwners(tx)
+	if err != nil {
+		return nil, err
+	}
+	used := make(map[int]string, len(owners))
+	for _, owner := range owners {
+		used[owner.Port] = owner.String()
+	}
+	return used, nil
+}
+
+// checkPortPools 校验端口符合端口池的分配：已分配给租户的端口池只能由该租户使用，
+// 拥有端口池的租户只能使用自己池内的端口。未定义任何端口池时不限制
+func checkPortPools(tx *gorm.DB, ports []int, tenantID uint) error {
+	var pools []database.PortPool
+	if err := tx.Find(&pools).Error; err != nil {
+		return err
+	}
+	if len(pools) == 0 {
+		return nil
+	}
+	ownsPool := false
+	for _, pool := range pools {
+		if tenantID != 0 && pool.TenantID == tenantID {
+			ownsPool = true
+		}
+	}
+	for _, port := range ports {
+		pool := poolContaining(pools, port)
+		if pool != nil && pool.TenantID != 0 && pool.TenantID != tenantID {
+			return fmt.Errorf("端口 %d 属于端口池 \"%s\"，已分配给其他租户", port, pool.Name)
+		}
+		if ownsPool && (pool == nil || pool.TenantID != tenantID) {
+			return fmt.Errorf("端口 %d 不在租户的端口池内", port)
+		}
+	}
+	return nil
+}
+
+// portAvailable 探测本机端口是否空闲，network为tcp、udp或udp+tcp
+func portAvailable(port int, network string) bool {
+	address := ":" + strconv.Itoa(port)
+	if strings.Contains(network, "tcp") {
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			return false
+		}
+		listener.Close()
+	}
+	if strings.Contains(network, "udp") {
+		conn, err := net.ListenPacket("udp", address)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+	}
+	return true
+}
+
+// checkPortsFree 探测由面板本机转发的服务器新增的中转端口未被其他进程占用，previous为修改前的服务器
+func checkPortsFree(server, previous *database.L2TPServer) error {
+	if server.RelayNodeID != 0 {
+		return nil
+	}
+	bound := make(map[int]bool)
+	if previous != nil && previous.RelayNodeID == 0 {
+		for _, port := range RelayPorts(previous) {
+			bound[port] = true
+		}
+	}
+	rules := ForwardRules(server)
+	if rule := obfuscationRule(server); rule != nil {
+		rules = append(rules, *rule)
+	}
+	for _, rule := range rules {
+		if bound[rule.ListenPort] {
+			continue
+		}
+		if !portAvailable(rule.ListenPort, rule.Network) {
+			return fmt.Errorf("中转端口 %d 已被本机其他程序占用", rule.ListenPort)
+		}
+	}
+	return nil
+}
+
+// eligiblePools 租户可分配端口的端口池：租户有自己的端口池时只用自己的，否则使用平台共享的
+func eligiblePools(tx *gorm.DB, tenantID uint) ([]database.PortPool, error) {
+	var pools []database.PortPool
+	if tenantID != 0 {
+		if err := tx.Where("tenant_id = ?", tenantID).Order("start_port").Find(&pools).Error; err != nil {
+			return nil, err
+		}
+		if len(pools) > 0 {
+			return pools, nil
+		}
+	}
+	err := tx.Where("tenant_id = ?", 0).Order("start_port").Find(&pools).Error
+	return pools, err
+}
+
+// nextFreePort 端口池内第一个未被占用且本机空闲的端口，没有时返回0
+func nextFreePort(pool *database.PortPool, used map[int]string) int {
+	for port := pool.StartPort; port <= pool.EndPort; port++ {
+		if _, taken := used[port]; !taken && portAvailable(port, "udp+tcp") {
+			return port
+		}
+	}
+	return 0
+}
+
+// allocatePoolPort 为未指定中转端口的服务器从租户可用的端口池分配端口
+func allocatePoolPort(tx *gorm.DB, tenantID uint) (int, error) {
+	pools, err := eligiblePools(tx, tenantID)
+	if err != nil {
+		return 0, err
+	}
+	if len(pools) == 0 {
+		return 0, fmt.Errorf("请输入有效的中转端口")
+	}
+	used, err := usedPorts(tx)
+	if err != nil {
+		return 0, err
+	}
+	for i := range pools {
+		if port := nextFreePort(&pools[i], used); port > 0 {
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("端口池已无可用端口")
+}
+
+// validate 校验端口池参数，范围不能与其他端口池重叠，分配给租户时池内端口不能被其他租户的服务器占用
+func (req *PortPoolRequest) validate(tx *gorm.DB, excludeID uint) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return fmt.Errorf("端口池名称不能为空")
+	}
+	if req.StartPort <= 0 || req.EndPort > 65535 || req.StartPort > req.EndPort {
+		return fmt.Errorf("无效的端口范围 %d-%d", req.StartPort, req.EndPort)
+	}
+	if req.TenantID != 0 {
+		if _, err := findTenant(tx, req.TenantID); err != nil {
+			return err
+		}
+	}
+
+	var others []database.PortPool
+	if err := tx.Where("id != ?", excludeID).Find(&others).Error; err != nil {
+		return err
+	}
+	for _, other := range others {
+		if other.Name == req.Name {
+			return fmt.Errorf("端口池 \"%s\" 已存在", req.Name)
+		}
+		if req.StartPort <= other.EndPort && other.StartPort <= req.EndPort {
+			return fmt.Errorf("端口范围与端口池 \"%s\"(%d-%d) 重叠", other.Name, other.StartPort, other.EndPort)
+		}
+	}
+
+	if req.TenantID == 0 {
+		return nil
+	}
+	var servers []database.L2TPServer
+	if err := tx.Unscoped().Where("tenant_id != ?", req.TenantID).Find(&servers).Error; err != nil {
+		return err
+	}
+	for i := range servers {
+		for _, port := range RelayPorts(&servers[i]) {
+			if port >= req.StartPort && port <= req.EndPort {
+				return fmt.Errorf("端口 %d 正被其他租户或平台的服务器 \"%s\" 使用", port, servers[i].Name)
+			}
+		}
+	}
+	return nil
+}
+
+// view 统计端口池的使用情况
+func (p *PortPoolService) view(pool database.PortPool, used map[int]string) PortPoolView {
+	view := PortPoolView{PortPool: pool, Size: pool.EndPort - pool.StartPort + 1}
+	for port := range used {
+		if port >= pool.StartPort && port <= pool.EndPort {
+			view.Used++
+		}
+	}
+	view.NextPort = nextFreePort(&pool, used)
+	return view
+}
+
+// views 统计一组端口池的使用情况
+func (p *PortPoolService) views(pools []database.PortPool) ([]PortPoolView, error) {
+	used, err := usedPorts(p.db)
+	if err != nil {
+		return nil, err
+	}
+	views := make([]PortPoolView, 0, len(pools))
+	for _, pool := range pools {
+		views = append(views, p.view(pool, used))
+	}
+	return views, nil
+}
+
+// List 列出全部端口池及使用情况
+func (p *PortPoolService) List() ([]PortPoolView, error) {
+	var pools []database.PortPool
+	if err := p.db.Order("start_port").Find(&pools).Error; err != nil {
+		return nil, err
+	}
+	return p.views(pools)
+}
+
+// Available 列出租户创建服务器时可自动分配端口的端口池
+func (p *PortPoolService) Available(tenantID uint) ([]PortPoolView, error) {
+	pools, err := eligiblePools(p.db, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return p.views(pools)
+}
+
+// Create 创建端口池
+func (p *PortPoolService) Create(req PortPoolRequest) (*database.PortPool, error) {
+	portMutex.Lock()
+	defer portMutex.Unlock()
+
+	pool := &database.PortPool{}
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		if err := req.validate(tx, 0); err != nil {
+			return err
+		}
+		pool = &database.PortPool{Name: req.Name, StartPort: req.StartPort, EndPort: req.EndPort, TenantID: req.TenantID, Note: req.Note}
+		return tx.Create(pool).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
+
+// Update 修改端口池的范围、租户和备注
+func (p *PortPoolService) Update(id uint, req PortPoolRequest) (*database.PortPool, error) {
+	portMutex.Lock()
+	defer portMutex.Unlock()
+
+	var pool database.PortPool
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Limit(1).Find(&pool, id).Error; err != nil {
+			return err
+		}
+		if pool.ID == 0 {
+			return fmt.Errorf("端口池不存在")
+		}
+		if err := req.validate(tx, id); err != nil {
+			return err
+		}
+		pool.Name = req.Name
+		pool.StartPort = req.StartPort
+		pool.EndPort = req.EndPort
+		pool.TenantID = req.TenantID
+		pool.Note = req.Note
+		return tx.Save(&pool).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &pool, nil
+}
+
+// Delete 删除端口池，已使用池内端口的服务器不受影响
+func (p *PortPoolService) Delete(id uint) error {
+	result := p.db.Delete(&database.PortPool{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("端口池不存在")
+	}
+	return nil
+}
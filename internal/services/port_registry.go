@@ -0,0 +1,153 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+
+	"l2tp-manager/internal/database"
+
+	"gorm.io/gorm"
+)
+
+// 端口占用者类型
+const (
+	PortOwnerPanel  = "panel"  // 面板自身监听的端口
+	PortOwnerServer = "server" // 服务器的中转端口(含回收站中的服务器)
+	PortOwnerProxy  = "proxy"  // 代理入站的监听端口
+)
+
+// PortOwner 占用端口的资源
+type PortOwner struct {
+	Port        int    `json:"port"`
+	Kind        string `json:"kind"`                    // panel/server/proxy
+	ID          uint   `json:"id,omitempty"`            // 服务器或代理ID
+	Name        string `json:"name"`                    // 服务器或代理名称，面板端口为用途
+	Protocol    string `json:"protocol,omitempty"`      // 服务器中转端口转发的协议
+	RelayNodeID uint   `json:"relay_node_id,omitempty"` // 服务器由中转节点转发时的节点ID
+	Trashed     bool   `json:"trashed,omitempty"`       // 服务器在回收站中
+	TenantID    uint   `json:"-"`                       // 服务器所属租户，不对外输出
+}
+
+// VisibleTo 占用者的详细信息能否告知该租户的用户：平台管理员(tenantID为0)可以看到全部，
+// 租户用户只能看到本租户的服务器
+func (o PortOwner) VisibleTo(tenantID uint) bool {
+	return tenantID == 0 || (o.Kind == PortOwnerServer && o.TenantID == tenantID)
+}
+
+// String 占用者描述，用于错误信息
+func (o PortOwner) String() string {
+	switch o.Kind {
+	case PortOwnerPanel:
+		return "面板" + o.Name
+	case PortOwnerProxy:
+		return fmt.Sprintf("代理 \"%s\"", o.Name)
+	}
+	if o.Trashed {
+		return fmt.Sprintf("回收站中的服务器 \"%s\"(%s)", o.Name, o.Protocol)
+	}
+	return fmt.Sprintf("服务器 \"%s\"(%s)", o.Name, o.Protocol)
+}
+
+// PortConflictError 端口已被其他资源占用
+type PortConflictError struct {
+	Owner PortOwner
+}
+
+// Error 错误信息，包含占用端口的资源
+func (e *PortConflictError) Error() string {
+	return fmt.Sprintf("端口 %d 已被%s使用", e.Owner.Port, e.Owner)
+}
+
+// Redacted 不含占用者信息的错误信息，用于占用者对当前用户不可见时
+func (e *PortConflictError) Redacted() string {
+	return fmt.Sprintf("端口 %d 已被占用", e.Owner.Port)
+}
+
+// panelPorts 面板自身监听的TCP端口及其用途(map[int]string)
+var panelPorts atomic.Value
+
+// SetPanelPorts 登记面板自身监听的端口(HTTP服务、gRPC接口等)，值为用途。
+// 由面板本机转发的服务器和代理入站不能使用这些端口
+func SetPanelPorts(ports map[int]string) {
+	panelPorts.Store(ports)
+}
+
+// portOwners 端口登记表：面板自身的端口、全部服务器(含回收站)的中转端口和代理入站的监听端口，
+// 按端口排序。创建和修改服务器、代理以及从端口池分配端口时都以此检查冲突
+func portOwners(tx *gorm.DB) ([]PortOwner, error) {
+	var owners []PortOwner
+	ports, _ := panelPorts.Load().(map[int]string)
+	for port, usage := range ports {
+		owners = append(owners, PortOwner{Port: port, Kind: PortOwnerPanel, Name: usage})
+	}
+
+	var servers []database.L2TPServer
+	if err := tx.Unscoped().Find(&servers).Error; err != nil {
+		return nil, err
+	}
+	for i := range servers {
+		rules := ForwardRules(&servers[i])
+		if rule := obfuscationRule(&servers[i]); rule != nil {
+			rules = append(rules, *rule)
+		}
+		for _, rule := range rules {
+			owners = append(owners, PortOwner{
+				Port:        rule.ListenPort,
+				Kind:        PortOwnerServer,
+				ID:          servers[i].ID,
+				Name:        servers[i].Name,
+				Protocol:    rule.Protocol,
+				RelayNodeID: servers[i].RelayNodeID,
+				Trashed:     servers[i].DeletedAt.Valid,
+				TenantID:    servers[i].TenantID,
+			})
+		}
+	}
+
+	var proxies []database.ProxyInbound
+	if err := tx.Select("id", "name", "listen_port").Find(&proxies).Error; err != nil {
+		return nil, err
+	}
+	for _, proxy := range proxies {
+		owners = append(owners, PortOwner{Port: proxy.ListenPort, Kind: PortOwnerProxy, ID: proxy.ID, Name: proxy.Name})
+	}
+
+	sort.SliceStable(owners, func(i, j int) bool { return owners[i].Port < owners[j].Port })
+	return owners, nil
+}
+
+// checkPortOwners 检查端口未被其他资源占用，self判断登记表中的条目是否属于正在检查的资源本身。
+// 面板自身的端口只与面板本机监听的端口冲突，local为false(由中转节点转发)时不检查
+func checkPortOwners(tx *gorm.DB, ports []int, local bool, self func(owner PortOwner) bool) error {
+	owners, err := portOwners(tx)
+	if err != nil {
+		return err
+	}
+	wanted := make(map[int]bool, len(ports))
+	for _, port := range ports {
+		wanted[port] = true
+	}
+	for _, owner := range owners {
+		if !wanted[owner.Port] || self(owner) || (owner.Kind == PortOwnerPanel && !local) {
+			continue
+		}
+		return &PortConflictError{Owner: owner}
+	}
+	return nil
+}
+
+// Ports 端口登记表，port大于0时只返回占用该端口的资源
+func (p *PortPoolService) Ports(port int) ([]PortOwner, error) {
+	owners, err := portOwners(p.db)
+	if err != nil {
+		return nil, err
+	}
+	result := []PortOwner{}
+	for _, owner := range owners {
+		if port <= 0 || owner.Port == port {
+			result = append(result, owner)
+		}
+	}
+	return result, nil
+}
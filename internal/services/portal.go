@@ -0,0 +1,272 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"l2tp-manager/internal/database"
+
+	"gorm.io/gorm"
+)
+
+// portalTokenPrefix 客户门户令牌前缀
+const portalTokenPrefix = "pt_"
+
+// ErrPortalToken 门户令牌缺失、无效或已过期
+var ErrPortalToken = errors.New("访问链接无效或已过期")
+
+// PortalTokenRequest 创建门户令牌的参数
+type PortalTokenRequest struct {
+	Name            string `json:"name"`
+	ShowCredentials bool   `json:"show_credentials"`         // 门户显示PSK、账号密码和客户端配置
+	Endpoint        string `json:"endpoint"`                 // 门户显示的连接地址，为空时与客户端配置下载相同
+	TTLDays         int    `json:"ttl_days" binding:"gte=0"` // 有效天数，0表示不过期
+}
+
+// PortalView 客户门户显示的服务器信息，不包含落地机地址和SSH凭据
+type PortalView struct {
+	Name       string            `json:"name"`
+	Type       string            `json:"type"`
+	Status     string            `json:"status"`
+	ExpireDate time.Time         `json:"expire_date"`
+	IsExpired  bool              `json:"is_expired"`
+	DaysLeft   int               `json:"days_left"`
+	TodayBytes int64             `json:"today_bytes"`
+	MonthBytes int64             `json:"month_bytes"`    // 本计费周期至今的流量
+	Billing    BillingPeriod     `json:"billing_period"` // 当前计费周期，未设置起始日时为自然月
+	History    *TrafficHistory   `json:"history"`        // 最近30天每天的流量
+	Connection PortalConnection  `json:"connection"`
+	Accounts   []PortalAccount   `json:"accounts,omitempty"`
+	Extra      map[string]string `json:"extra,omitempty"` // 协议相关的附加信息，如IKEv2服务端标识
+}
+
+// PortalConnection 客户端连接方式
+type PortalConnection struct {
+	Endpoint     string        `json:"endpoint"`
+	Ports        []ForwardRule `json:"ports"`
+	PSK          string        `json:"psk,omitempty"`
+	Profile      string        `json:"profile,omitempty"` // OpenVPN客户端配置文件
+	Instructions []string      `json:"instructions"`
+}
+
+// PortalAccount 门户显示的账号，按服务器类型附带客户端配置或分享链接
+type PortalAccount struct {
+	Username  string `json:"username"`
+	Password  string `json:"password,omitempty"`
+	Config    string `json:"config,omitempty"`     // WireGuard客户端配置
+	ShareLink string `json:"share_link,omitempty"` // Shadowsocks/VLESS分享链接
+	// L2TP账号本计费周期已用流量和每个周期的流量配额(GB)，配额为0表示不限
+	MonthBytes int64 `json:"month_bytes,omitempty"`
+	QuotaGB    int64 `json:"quota_gb,omitempty"`
+}
+
+// hashPortalToken 计算门户令牌的存储值
+func hashPortalToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreatePortalToken 为服务器创建门户令牌，令牌只在此时返回一次
+func (s *L2TPService) CreatePortalToken(serverID uint, req PortalTokenRequest, createdBy string) (*database.PortalToken, string, error) {
+	server, err := s.GetServer(serverID)
+	if err != nil {
+		return nil, "", err
+	}
+	if req.TTLDays < 0 {
+		return nil, "", fmt.Errorf("有效天数不能为负数")
+	}
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", fmt.Errorf("生成访问令牌失败: %v", err)
+	}
+	token := portalTokenPrefix + hex.EncodeToString(buf)
+	record := &database.PortalToken{
+		ServerID:        server.ID,
+		Name:            strings.TrimSpace(req.Name),
+		TokenHash:       hashPortalToken(token),
+		ShowCredentials: req.ShowCredentials,
+		Endpoint:        strings.TrimSpace(req.Endpoint),
+		CreatedBy:       createdBy,
+	}
+	if req.TTLDays > 0 {
+		expires := time.Now().AddDate(0, 0, req.TTLDays)
+		record.ExpiresAt = &expires
+	}
+	if err := s.db.Create(record).Error; err != nil {
+		return nil, "", err
+	}
+	return record, token, nil
+}
+
+// ListPortalTokens 列出服务器的门户令牌
+func (s *L2TPService) ListPortalTokens(serverID uint) ([]database.PortalToken, error) {
+	tokens := []database.PortalToken{}
+	err := s.db.Where("server_id = ?", serverID).Order("id DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+// RevokePortalToken 撤销服务器的门户令牌
+func (s *L2TPService) RevokePortalToken(serverID, tokenID uint) error {
+	result := s.db.Where("server_id = ?", serverID).Delete(&database.PortalToken{}, tokenID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("访问令牌不存在")
+	}
+	return nil
+}
+
+// PortalServer 按门户令牌查找服务器并记录使用时间
+func (s *L2TPService) PortalServer(token string) (*database.L2TPServer, *database.PortalToken, error) {
+	if !strings.HasPrefix(token, portalTokenPrefix) {
+		return nil, nil, ErrPortalToken
+	}
+	var record database.PortalToken
+	if err := s.db.Where("token_hash = ?", hashPortalToken(token)).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrPortalToken
+		}
+		return nil, nil, err
+	}
+	now := time.Now()
+	if record.ExpiresAt != nil && now.After(*record.ExpiresAt) {
+		return nil, nil, ErrPortalToken
+	}
+	server, err := s.GetServer(record.ServerID)
+	if err != nil {
+		return nil, nil, ErrPortalToken
+	}
+	s.db.Model(&record).UpdateColumn("last_used_at", now)
+	return server, &record, nil
+}
+
+// PortalView 生成门户显示的服务器信息，endpoint为客户端连接的中转机地址
+func (s *L2TPService) PortalView(server *database.L2TPServer, token *database.PortalToken, endpoint string) (*PortalView, error) {
+	if token.Endpoint != "" {
+		endpoint = token.Endpoint
+	}
+	now := time.Now()
+	view := &PortalView{
+		Name:       server.Name,
+		Type:       server.Type,
+		Status:     server.Status,
+		ExpireDate: server.ExpireDate,
+		IsExpired:  server.IsExpired,
+		Connection: PortalConnection{Endpoint: endpoint, Ports: ForwardRules(server)},
+	}
+	if !server.IsExpired {
+		view.DaysLeft = int(server.ExpireDate.Sub(now).Hours() / 24)
+	}
+
+	today := bucketStart(now, GranularityDay)
+	err := s.db.Model(&database.TrafficSample{}).Select("COALESCE(SUM(bytes), 0)").
+		Where("server_id = ? AND granularity = ? AND bucket >= ?", server.ID, GranularityDay, today).
+		Scan(&view.TodayBytes).Error
+	if err != nil {
+		return nil, err
+	}
+	view.Billing = CurrentBillingPeriod(server, now)
+	rows, err := sumPeriodTraffic(s.db, []database.L2TPServer{*server}, "", now)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		view.MonthBytes += row.Bytes
+	}
+	if view.History, err = s.GetTrafficHistory(server.ID, "30d"); err != nil {
+		return nil, err
+	}
+
+	view.Connection.Instructions = portalInstructions(server, endpoint)
+	if !token.ShowCredentials {
+		return view, nil
+	}
+	if err := s.portalCredentials(server, endpoint, view); err != nil {
+		return nil, err
+	}
+	return view, nil
+}
+
+// portalCredentials 填充PSK、账号和客户端配置
+func (s *L2TPService) portalCredentials(server *database.L2TPServer, endpoint string, view *PortalView) error {
+	users, err := s.ParseUsers(server.Users)
+	if err != nil {
+		return err
+	}
+	switch server.Type {
+	case ServerTypeOpenVPN:
+		if view.Connection.Profile, err = s.OpenVPNProfile(server.ID, endpoint); err != nil {
+			return err
+		}
+	case ServerTypeIKEv2:
+		view.Extra = map[string]string{"ikev2_identity": server.IKEv2Identity, "ikev2_auth": server.IKEv2Auth}
+	case ServerTypeL2TP:
+		view.Connection.PSK = server.PSK
+	}
+
+	var usage map[string]int64
+	if server.Type == ServerTypeL2TP {
+		usage = accountPeriodBytes(s.db, server, time.Now())
+	}
+	for _, user := range users {
+		account := PortalAccount{Username: user.Username, MonthBytes: usage[user.Username], QuotaGB: user.QuotaGB}
+		switch {
+		case server.Type == ServerTypeWireGuard:
+			if account.Config, err = s.WireGuardClientConfig(server.ID, user.Username, endpoint); err != nil {
+				return err
+			}
+		case isXrayServer(server.Type):
+			if account.ShareLink, err = s.XrayShareLink(server.ID, user.Username, endpoint); err != nil {
+				return err
+			}
+		default:
+			account.Password = user.Password
+		}
+		view.Accounts = append(view.Accounts, account)
+	}
+	return nil
+}
+
+// portalInstructions 按服务器类型生成连接说明
+func portalInstructions(server *database.L2TPServer, endpoint string) []string {
+	address := fmt.Sprintf("%s:%d", endpoint, server.L2TPPort)
+	switch server.Type {
+	case ServerTypeWireGuard:
+		return []string{
+			"安装WireGuard客户端，导入对应账号的配置文件或粘贴配置内容",
+			"连接地址: " + address + " (UDP)",
+		}
+	case ServerTypeOpenVPN:
+		return []string{
+			"安装OpenVPN客户端并导入配置文件，连接时输入账号和密码",
+			fmt.Sprintf("连接地址: %s (%s)", address, strings.ToUpper(ForwardRules(server)[0].Network)),
+		}
+	case ServerTypeIKEv2:
+		return []string{
+			"在系统VPN设置中添加IKEv2连接，服务器地址填写 " + server.IKEv2Identity,
+			"iOS/macOS可向管理员索取描述文件，Windows需先导入CA证书",
+		}
+	case ServerTypeShadowsocks, ServerTypeVLESS:
+		return []string{
+			"在支持Xray/V2Ray的客户端中导入对应账号的分享链接",
+			"连接地址: " + address,
+		}
+	}
+	rules := ForwardRules(server)
+	instructions := []string{
+		"在系统VPN设置中添加 L2TP/IPsec(预共享密钥) 连接",
+		"服务器地址: " + endpoint,
+		fmt.Sprintf("中转端口: %d (%s)", server.L2TPPort, strings.ToUpper(rules[0].Network)),
+	}
+	for _, rule := range rules[1:] {
+		instructions = append(instructions, fmt.Sprintf("%s: %s:%d (%s)", strings.ToUpper(rule.Protocol), endpoint, rule.ListenPort, strings.ToUpper(rule.Network)))
+	}
+	return instructions
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+
+	"l2tp-manager/internal/database"
+	"l2tp-manager/internal/i18n"
+
+	"gorm.io/gorm"
+)
+
+// Preferences 用户偏好设置
+type Preferences struct {
+	Language  string   `json:"language"`  // 界面语言，为空表示按请求的Accept-Language
+	Languages []string `json:"languages"` // 支持的语言
+}
+
+// PreferenceRequest 更新用户偏好设置的请求
+type PreferenceRequest struct {
+	Language string `json:"language"` // 为空表示恢复按Accept-Language
+}
+
+// PreferenceService 用户偏好设置，界面语言在内存中缓存，每个请求都会读取
+type PreferenceService struct {
+	db        *gorm.DB
+	languages sync.Map // 用户ID -> 界面语言
+}
+
+// NewPreferenceService 创建用户偏好服务
+func NewPreferenceService(db *gorm.DB) *PreferenceService {
+	return &PreferenceService{db: db}
+}
+
+// Language 用户设置的界面语言，未设置或用户不存在时返回空字符串
+func (p *PreferenceService) Language(userID uint) string {
+	if lang, ok := p.languages.Load(userID); ok {
+		return lang.(string)
+	}
+	var user database.User
+	if err := p.db.Select("id", "language").Limit(1).Find(&user, userID).Error; err != nil {
+		return ""
+	}
+	lang := i18n.Normalize(user.Language)
+	p.languages.Store(userID, lang)
+	return lang
+}
+
+// Get 用户的偏好设置
+func (p *PreferenceService) Get(userID uint) Preferences {
+	return Preferences{Language: p.Language(userID), Languages: i18n.Languages()}
+}
+
+// Update 更新用户的偏好设置
+func (p *PreferenceService) Update(userID uint, req PreferenceRequest) (Preferences, error) {
+	lang := i18n.Normalize(req.Language)
+	if req.Language != "" && lang == "" {
+		return Preferences{}, fmt.Errorf("不支持的语言: %s", req.Language)
+	}
+	result := p.db.Model(&database.User{}).Where("id = ?", userID).Update("language", lang)
+	if result.Error != nil {
+		return Preferences{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return Preferences{}, fmt.Errorf("用户不存在")
+	}
+	p.languages.Store(userID, lang)
+	return p.Get(userID), nil
+}
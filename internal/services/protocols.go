@@ -0,0 +1,389 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"l2tp-manager/internal/database"
+
+	xnet "github.com/xtls/xray-core/common/net"
+)
+
+// 落地机容器内各协议的固定端口
+const (
+	L2TPContainerPort    = 1701
+	OpenVPNContainerPort = 1194
+	SSTPContainerPort    = 443
+
+	IKEv2ContainerPort    = 500
+	IKEv2NATContainerPort = 4500
+
+	ShadowsocksContainerPort = 8388
+	VLESSContainerPort       = 8443
+)
+
+// 服务器类型，决定落地机的部署方式和转发规则
+const (
+	ServerTypeL2TP        = "l2tp"
+	ServerTypeWireGuard   = "wireguard"
+	ServerTypeOpenVPN     = "openvpn"
+	ServerTypeIKEv2       = "ikev2"
+	ServerTypeShadowsocks = "shadowsocks"
+	ServerTypeVLESS       = "vless"
+)
+
+// OpenVPN服务器的传输协议
+const (
+	OpenVPNProtoUDP = "udp"
+	OpenVPNProtoTCP = "tcp"
+)
+
+// IKEv2服务器的客户端认证方式
+const (
+	IKEv2AuthEAP  = "eap"  // EAP-MSCHAPv2，使用用户名密码
+	IKEv2AuthCert = "cert" // 客户端证书，每个用户一张
+)
+
+// 支持的协议名称
+const (
+	ProtocolL2TP        = "l2tp"
+	ProtocolOpenVPN     = "openvpn"
+	ProtocolSSTP        = "sstp"
+	ProtocolWireGuard   = "wireguard"
+	ProtocolIKEv2       = "ikev2"
+	ProtocolIKEv2NAT    = "ikev2-nat"
+	ProtocolShadowsocks = "shadowsocks"
+	ProtocolVLESS       = "vless"
+)
+
+// clientNamePattern 按用户生成客户端密钥或证书的服务器类型允许的用户名，用户名会写入配置文件和下载文件名
+var clientNamePattern = regexp.MustCompile(`^[A-Za-z0-9._@-]{1,64}$`)
+
+// ForwardRule 中转机转发规则
+type ForwardRule struct {
+	Protocol   string         `json:"protocol"`
+	ListenPort int            `json:"listen_port"`
+	TargetPort int            `json:"target_port"`
+	Networks   []xnet.Network `json:"-"`
+	Network    string         `json:"network"`
+}
+
+// ForwardRules 根据服务器协议开关生成转发规则，L2TP规则始终存在且位于首位。
+// WireGuard和OpenVPN服务器只有一条规则，同样以l2tp_port作为中转端口；
+// IKEv2服务器以l2tp_port转发IKE(UDP 500)，以ikev2_nat_port转发NAT穿越(UDP 4500)；
+// Shadowsocks服务器同时转发TCP和UDP，VLESS(REALITY)服务器只转发TCP
+func ForwardRules(server *database.L2TPServer) []ForwardRule {
+	switch server.Type {
+	case ServerTypeWireGuard:
+		return []ForwardRule{{
+			Protocol:   ProtocolWireGuard,
+			ListenPort: server.L2TPPort,
+			TargetPort: WireGuardListenPort,
+			Networks:   []xnet.Network{xnet.Network_UDP},
+			Network:    "udp",
+		}}
+	case ServerTypeOpenVPN:
+		rule := ForwardRule{
+			Protocol:   ProtocolOpenVPN,
+			ListenPort: server.L2TPPort,
+			TargetPort: OpenVPNContainerPort,
+			Networks:   []xnet.Network{xnet.Network_UDP},
+			Network:    "udp",
+		}
+		if server.OpenVPNProto == OpenVPNProtoTCP {
+			rule.Networks = []xnet.Network{xnet.Network_TCP}
+			rule.Network = "tcp"
+		}
+		return []ForwardRule{rule}
+	case ServerTypeIKEv2:
+		return []ForwardRule{{
+			Protocol:   ProtocolIKEv2,
+			ListenPort: server.L2TPPort,
+			TargetPort: IKEv2ContainerPort,
+			Networks:   []xnet.Network{xnet.Network_UDP},
+			Network:    "udp",
+		}, {
+			Protocol:   ProtocolIKEv2NAT,
+			ListenPort: server.IKEv2NATPort,
+			TargetPort: IKEv2NATContainerPort,
+			Networks:   []xnet.Network{xnet.Network_UDP},
+			Network:    "udp",
+		}}
+	case ServerTypeShadowsocks:
+		return []ForwardRule{{
+			Protocol:   ProtocolShadowsocks,
+			ListenPort: server.L2TPPort,
+			TargetPort: ShadowsocksContainerPort,
+			Networks:   []xnet.Network{xnet.Network_UDP, xnet.Network_TCP},
+			Network:    "udp+tcp",
+		}}
+	case ServerTypeVLESS:
+		return []ForwardRule{{
+			Protocol:   ProtocolVLESS,
+			ListenPort: server.L2TPPort,
+			TargetPort: VLESSContainerPort,
+			Networks:   []xnet.Network{xnet.Network_TCP},
+			Network:    "tcp",
+		}}
+	}
+
+	rules := []ForwardRule{{
+		Protocol:   ProtocolL2TP,
+		ListenPort: server.L2TPPort,
+		TargetPort: L2TPContainerPort,
+		Networks:   []xnet.Network{xnet.Network_UDP, xnet.Network_TCP},
+		Network:    "udp+tcp",
+	}}
+
+	if server.EnableOpenVPN && server.OpenVPNRelayPort > 0 {
+		rules = append(rules, ForwardRule{
+			Protocol:   ProtocolOpenVPN,
+			ListenPort: server.OpenVPNRelayPort,
+			TargetPort: OpenVPNContainerPort,
+			Networks:   []xnet.Network{xnet.Network_UDP},
+			Network:    "udp",
+		})
+	}
+
+	if server.EnableSSTP && server.SSTPRelayPort > 0 {
+		rules = append(rules, ForwardRule{
+			Protocol:   ProtocolSSTP,
+			ListenPort: server.SSTPRelayPort,
+			TargetPort: SSTPContainerPort,
+			Networks:   []xnet.Network{xnet.Network_TCP},
+			Network:    "tcp",
+		})
+	}
+
+	return rules
+}
+
+// forwardRuleFor 查找监听端口对应的转发规则
+func forwardRuleFor(server *database.L2TPServer, listenPort int) ForwardRule {
+	for _, rule := range ForwardRules(server) {
+		if rule.ListenPort == listenPort {
+			return rule
+		}
+	}
+	return ForwardRules(server)[0]
+}
+
+// sameForwardRules 判断两个服务器的转发规则是否一致
+func sameForwardRules(a, b *database.L2TPServer) bool {
+	if a.Host != b.Host || a.RelayNodeID != b.RelayNodeID || a.ChainNodes != b.ChainNodes || a.NextHop != b.NextHop ||
+		a.GeoIPMode != b.GeoIPMode || a.GeoIPCountries != b.GeoIPCountries ||
+		a.ReportedIP != b.ReportedIP || a.ResolvedIP != b.ResolvedIP ||
+		a.KnockEnabled != b.KnockEnabled || a.KnockTTL != b.KnockTTL ||
+		a.Obfuscation != b.Obfuscation || a.ObfuscationPort != b.ObfuscationPort || a.ObfuscationKey != b.ObfuscationKey {
+		return false
+	}
+	ra, rb := ForwardRules(a), ForwardRules(b)
+	if len(ra) != len(rb) {
+		return false
+	}
+	for i := range ra {
+		if ra[i].ListenPort != rb[i].ListenPort || ra[i].TargetPort != rb[i].TargetPort {
+			return false
+		}
+	}
+	return true
+}
+
+// RelayPorts 返回服务器在中转机上占用的全部监听端口，包括混淆入口
+func RelayPorts(server *database.L2TPServer) []int {
+	var ports []int
+	for _, rule := range ForwardRules(server) {
+		ports = append(ports, rule.ListenPort)
+	}
+	if rule := obfuscationRule(server); rule != nil {
+		ports = append(ports, rule.ListenPort)
+	}
+	return ports
+}
+
+// ValidateProtocols 校验协议开关与中转端口配置
+func ValidateProtocols(server *database.L2TPServer) error {
+	if err := validateServerType(server); err != nil {
+		return err
+	}
+	if server.EnableOpenVPN && (server.OpenVPNRelayPort <= 0 || server.OpenVPNRelayPort > 65535) {
+		return fmt.Errorf("启用OpenVPN时必须设置有效的OpenVPN中转端口")
+	}
+	if server.EnableSSTP && (server.SSTPRelayPort <= 0 || server.SSTPRelayPort > 65535) {
+		return fmt.Errorf("启用SSTP时必须设置有效的SSTP中转端口")
+	}
+	if err := validateGeoIPPolicy(server); err != nil {
+		return err
+	}
+	if err := validateSoftEther(server); err != nil {
+		return err
+	}
+	if err := validateClientDNS(server); err != nil {
+		return err
+	}
+	if err := validateNATKeepalive(server); err != nil {
+		return err
+	}
+	if err := validateKnock(server); err != nil {
+		return err
+	}
+	if err := validateObfuscation(server); err != nil {
+		return err
+	}
+	if err := validateAccountQuotas(server); err != nil {
+		return err
+	}
+	if err := validateBilling(server); err != nil {
+		return err
+	}
+
+	seen := make(map[int]string)
+	rules := ForwardRules(server)
+	if rule := obfuscationRule(server); rule != nil {
+		rules = append(rules, *rule)
+	}
+	for _, rule := range rules {
+		if owner, exists := seen[rule.ListenPort]; exists {
+			return fmt.Errorf("%s 与 %s 的中转端口 %d 冲突", rule.Protocol, owner, rule.ListenPort)
+		}
+		seen[rule.ListenPort] = rule.Protocol
+	}
+	return nil
+}
+
+// validateServerType 校验服务器类型及该类型支持的协议，附加OpenVPN和SSTP协议只适用于L2TP服务器
+func validateServerType(server *database.L2TPServer) error {
+	switch server.Type {
+	case ServerTypeL2TP:
+		return nil
+	case ServerTypeWireGuard, ServerTypeOpenVPN, ServerTypeIKEv2, ServerTypeShadowsocks, ServerTypeVLESS:
+		if server.EnableOpenVPN || server.EnableSSTP {
+			return fmt.Errorf("%s服务器不支持附加OpenVPN或SSTP协议", serverTypeName(server.Type))
+		}
+		if server.Type == ServerTypeOpenVPN && server.OpenVPNProto != OpenVPNProtoUDP && server.OpenVPNProto != OpenVPNProtoTCP {
+			return fmt.Errorf("OpenVPN传输协议只能是udp或tcp")
+		}
+		if server.Type == ServerTypeIKEv2 {
+			if server.IKEv2Auth != IKEv2AuthEAP && server.IKEv2Auth != IKEv2AuthCert {
+				return fmt.Errorf("IKEv2认证方式只能是eap或cert")
+			}
+			if !ikev2IdentityPattern.MatchString(server.IKEv2Identity) {
+				return fmt.Errorf("IKEv2服务器必须设置有效的服务端标识(客户端连接的中转机域名或IP)")
+			}
+			if server.IKEv2NATPort <= 0 || server.IKEv2NATPort > 65535 {
+				return fmt.Errorf("IKEv2 NAT穿越中转端口无效")
+			}
+		}
+		if server.Type == ServerTypeVLESS && !realityServerNamePattern.MatchString(server.RealityServerName) {
+			return fmt.Errorf("REALITY伪装站点必须是有效的域名")
+		}
+		return nil
+	default:
+		return fmt.Errorf("不支持的服务器类型: %s", server.Type)
+	}
+}
+
+// applyTypeDefaults 补全服务器类型相关字段：未提供时沿用更新前的记录(创建时existing为nil)，仍为空时使用默认值；
+// 不适用于该类型的字段被清空
+func applyTypeDefaults(server, existing *database.L2TPServer) {
+	if existing != nil {
+		if server.OpenVPNProto == "" {
+			server.OpenVPNProto = existing.OpenVPNProto
+		}
+		if server.IKEv2Auth == "" {
+			server.IKEv2Auth = existing.IKEv2Auth
+		}
+		if server.IKEv2Identity == "" {
+			server.IKEv2Identity = existing.IKEv2Identity
+		}
+		if server.IKEv2NATPort == 0 {
+			server.IKEv2NATPort = existing.IKEv2NATPort
+		}
+		if server.RealityServerName == "" {
+			server.RealityServerName = existing.RealityServerName
+		}
+	}
+
+	if server.Type != ServerTypeVLESS {
+		server.RealityServerName = ""
+	} else if server.RealityServerName == "" {
+		server.RealityServerName = realityDefaultServerName
+	}
+
+	if server.Type != ServerTypeOpenVPN {
+		server.OpenVPNProto = ""
+	} else if server.OpenVPNProto == "" {
+		server.OpenVPNProto = OpenVPNProtoUDP
+	}
+
+	if server.Type != ServerTypeL2TP {
+		server.SoftEtherHub, server.SecureNATDisabled, server.SecureNATAddress = "", false, ""
+		server.DHCPStart, server.DHCPEnd = "", ""
+	}
+	// Shadowsocks和VLESS是代理协议，客户端不接收DNS设置，也没有NAT保活，流量本身已加密无需混淆
+	if isXrayServer(server.Type) {
+		server.ClientDNS, server.DNSDomains = "", ""
+		server.NATKeepalive = 0
+		server.Obfuscation, server.ObfuscationPort, server.ObfuscationKey = "", 0, ""
+	}
+
+	if server.Type != ServerTypeIKEv2 {
+		server.IKEv2Auth, server.IKEv2Identity, server.IKEv2NATPort = "", "", 0
+		return
+	}
+	if server.IKEv2Auth == "" {
+		server.IKEv2Auth = IKEv2AuthEAP
+	}
+	if server.IKEv2NATPort == 0 {
+		server.IKEv2NATPort = IKEv2NATContainerPort
+	}
+}
+
+// serverTypeName 服务器类型的显示名称
+func serverTypeName(serverType string) string {
+	switch serverType {
+	case ServerTypeWireGuard:
+		return "WireGuard"
+	case ServerTypeOpenVPN:
+		return "OpenVPN"
+	case ServerTypeIKEv2:
+		return "IKEv2"
+	case ServerTypeShadowsocks:
+		return "Shadowsocks"
+	case ServerTypeVLESS:
+		return "VLESS"
+	default:
+		return "L2TP"
+	}
+}
+
+// containerProtocolArgs 生成容器的协议相关端口映射和环境变量参数
+func containerProtocolArgs(server *database.L2TPServer) string {
+	args := []string{
+		"-p 500:500/udp",
+		"-p 4500:4500/udp",
+		fmt.Sprintf("-p %d:%d/udp", L2TPContainerPort, L2TPContainerPort),
+	}
+
+	if server.EnableOpenVPN {
+		args = append(args, fmt.Sprintf("-p %d:%d/udp", OpenVPNContainerPort, OpenVPNContainerPort))
+	}
+	if server.EnableSSTP {
+		args = append(args, fmt.Sprintf("-p %d:%d/tcp", SSTPContainerPort, SSTPContainerPort))
+	}
+
+	args = append(args,
+		fmt.Sprintf("-e OPENVPN_ENABLED=%s", boolFlag(server.EnableOpenVPN)),
+		fmt.Sprintf("-e SSTP_ENABLED=%s", boolFlag(server.EnableSSTP)),
+	)
+	return strings.Join(args, " \\\n\t\t")
+}
+
+// boolFlag 将布尔值转换为容器环境变量取值
+func boolFlag(enabled bool) string {
+	if enabled {
+		return "yes"
+	}
+	return "no"
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"l2tp-manager/internal/database"
+
+	"gorm.io/gorm"
+)
+
+// 代理入站协议
+const (
+	ProxyProtocolSOCKS = "socks" // SOCKS5，支持UDP ASSOCIATE
+	ProxyProtocolHTTP  = "http"  // HTTP代理，支持CONNECT
+)
+
+// ProxyService 代理入站管理：账号、出口隧道和流量统计，变更后由路由服务重建监听
+type ProxyService struct {
+	db      *gorm.DB
+	routing *RoutingService
+}
+
+// ProxyView 代理入站及其运行状态和各账号的累计流量
+type ProxyView struct {
+	database.ProxyInbound
+	ExitServerName string                  `json:"exit_server_name"`
+	Running        bool                    `json:"running"`
+	Error          string                  `json:"error,omitempty"` // 未运行的原因
+	Traffic        []database.ProxyTraffic `json:"traffic"`
+}
+
+// NewProxyService 创建代理入站服务
+func NewProxyService(db *gorm.DB, routing *RoutingService) *ProxyService {
+	return &ProxyService{db: db, routing: routing}
+}
+
+// parseProxyAccounts 解析代理账号
+func parseProxyAccounts(value string) ([]L2TPUser, error) {
+	var accounts []L2TPUser
+	if value == "" {
+		return accounts, nil
+	}
+	if err := json.Unmarshal([]byte(value), &accounts); err != nil {
+		return nil, fmt.Errorf("解析代理账号失败: %v", err)
+	}
+	return accounts, nil
+}
+
+// validateProxy 校验代理入站字段和账号，账号名同时作为流量统计的标识
+func validateProxy(tx *gorm.DB, proxy *database.ProxyInbound) error {
+	proxy.Name = strings.TrimSpace(proxy.Name)
+	if proxy.Name == "" {
+		return fmt.Errorf("代理名称不能为空")
+	}
+	if proxy.Protocol == "" {
+		proxy.Protocol = ProxyProtocolSOCKS
+	}
+	if proxy.Protocol != ProxyProtocolSOCKS && proxy.Protocol != ProxyProtocolHTTP {
+		return fmt.Errorf("代理协议只能是socks或http")
+	}
+	if proxy.ListenPort <= 0 || proxy.ListenPort > 65535 {
+		return fmt.Errorf("无效的监听端口")
+	}
+
+	accounts, err := parseProxyAccounts(proxy.Accounts)
+	if err != nil {
+		return err
+	}
+	if len(accounts) == 0 {
+		return fmt.Errorf("至少需要一个代理账号")
+	}
+	seen := make(map[string]bool)
+	for _, account := range accounts {
+		if !clientNamePattern.MatchString(account.Username) {
+			return fmt.Errorf("代理账号 %q 只能包含字母、数字和 . _ @ -，且不超过64个字符", account.Username)
+		}
+		if account.Password == "" || len(account.Password) > 255 {
+			return fmt.Errorf("代理账号 %s 的密码不能为空且不超过255个字符", account.Username)
+		}
+		if seen[account.Username] {
+			return fmt.Errorf("代理账号 %s 重复", account.Username)
+		}
+		seen[account.Username] = true
+	}
+
+	var exit database.L2TPServer
+	if err := tx.First(&exit, proxy.ExitServerID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("出口服务器 %d 不存在", proxy.ExitServerID)
+		}
+		return err
+	}
+	if exit.Type != ServerTypeWireGuard {
+		return fmt.Errorf("出口服务器必须是WireGuard类型")
+	}
+	if _, err := findWireGuardPeer(&exit, proxy.ExitPeer); err != nil {
+		return err
+	}
+	// 同一WireGuard用户的多个连接会互相顶替，每个用户只能作为一个代理的出口
+	var other database.ProxyInbound
+	result := tx.Where("exit_server_id = ? AND exit_peer = ? AND id != ?", proxy.ExitServerID, proxy.ExitPeer, proxy.ID).Limit(1).Find(&other)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return fmt.Errorf("WireGuard用户 %s 已被代理 \"%s\" 用作出口", proxy.ExitPeer, other.Name)
+	}
+
+	return checkProxyPort(tx, proxy)
+}
+
+// checkProxyPort 检查监听端口未被其他代理、服务器的中转端口(包括回收站中的服务器)或面板自身占用
+func checkProxyPort(tx *gorm.DB, proxy *database.ProxyInbound) error {
+	self := func(owner PortOwner) bool { return owner.Kind == PortOwnerProxy && owner.ID == proxy.ID }
+	if err := checkPortOwners(tx, []int{proxy.ListenPort}, true, self); err != nil {
+		return err
+	}
+	// 代理属于平台，不能占用已分配给租户的端口池
+	return checkPortPools(tx, []int{proxy.ListenPort}, 0)
+}
+
+// List 列出全部代理入站
+func (s *ProxyService) List() ([]ProxyView, error) {
+	var proxies []database.ProxyInbound
+	if err := s.db.Order("id").Find(&proxies).Error; err != nil {
+		return nil, err
+	}
+	views := make([]ProxyView, 0, len(proxies))
+	for i := range proxies {
+		view, err := s.view(&proxies[i])
+		if err != nil {
+			return nil, err
+		}
+		views = append(views, *view)
+	}
+	return views, nil
+}
+
+// Get 获取代理入站
+func (s *ProxyService) Get(id uint) (*ProxyView, error) {
+	var proxy database.ProxyInbound
+	if err := s.db.First(&proxy, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("代理不存在")
+		}
+		return nil, err
+	}
+	return s.view(&proxy)
+}
+
+// view 附加出口服务器名称、运行状态和账号流量，已删除账号的流量不返回
+func (s *ProxyService) view(proxy *database.ProxyInbound) (*ProxyView, error) {
+	view := &ProxyView{ProxyInbound: *proxy, Traffic: []database.ProxyTraffic{}}
+	view.Running, view.Error = s.routing.ProxyStatus(proxy.ID)
+
+	var exit database.L2TPServer
+	if result := s.db.Unscoped().Limit(1).Find(&exit, proxy.ExitServerID); result.RowsAffected > 0 {
+		view.ExitServerName = exit.Name
+	}
+
+	accounts, _ := parseProxyAccounts(proxy.Accounts)
+	var traffic []database.ProxyTraffic
+	if err := s.db.Where("proxy_id = ?", proxy.ID).Find(&traffic).Error; err != nil {
+		return nil, err
+	}
+	for _, account := range accounts {
+		entry := database.ProxyTraffic{ProxyID: proxy.ID, Username: account.Username}
+		for _, t := range traffic {
+			if t.Username == account.Username {
+				entry = t
+			}
+		}
+		view.Traffic = append(view.Traffic, entry)
+	}
+	return view, nil
+}
+
+// Create 创建代理入站并立即按出口服务器状态启动
+func (s *ProxyService) Create(proxy *database.ProxyInbound) error {
+	proxy.ID = 0
+	portMutex.Lock()
+	defer portMutex.Unlock()
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		tx.Model(&database.ProxyInbound{}).Where("name = ?", strings.TrimSpace(proxy.Name)).Count(&count)
+		if count > 0 {
+			return fmt.Errorf("代理名称 %s 已存在", strings.TrimSpace(proxy.Name))
+		}
+		if err := validateProxy(tx, proxy); err != nil {
+			return err
+		}
+		return tx.Create(proxy).Error
+	})
+	if err != nil {
+		return err
+	}
+	s.routing.ReloadProxy(proxy)
+	return nil
+}
+
+// Update 更新代理入站，监听随之重建
+func (s *ProxyService) Update(id uint, update *database.ProxyInbound) (*database.ProxyInbound, error) {
+	portMutex.Lock()
+	defer portMutex.Unlock()
+	var proxy database.ProxyInbound
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&proxy, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("代理不存在")
+			}
+			return err
+		}
+		var count int64
+		tx.Model(&database.ProxyInbound{}).Where("name = ? AND id != ?", strings.TrimSpace(update.Name), id).Count(&count)
+		if count > 0 {
+			return fmt.Errorf("代理名称 %s 已存在", strings.TrimSpace(update.Name))
+		}
+
+		update.ID = id
+		if err := validateProxy(tx, update); err != nil {
+			return err
+		}
+		proxy.Name = update.Name
+		proxy.Protocol = update.Protocol
+		proxy.ListenPort = update.ListenPort
+		proxy.ExitServerID = update.ExitServerID
+		proxy.ExitPeer = update.ExitPeer
+		proxy.Accounts = update.Accounts
+		proxy.Enabled = update.Enabled
+		return tx.Save(&proxy).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.routing.ReloadProxy(&proxy)
+	return &proxy, nil
+}
+
+// Delete 删除代理入站及其流量统计
+func (s *ProxyService) Delete(id uint) (*database.ProxyInbound, error) {
+	var proxy database.ProxyInbound
+	if err := s.db.First(&proxy, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("代理不存在")
+		}
+		return nil, err
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("proxy_id = ?", id).Delete(&database.ProxyTraffic{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&proxy).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.routing.RemoveProxy(id)
+	return &proxy, nil
+}
+
+// ResetTraffic 清零代理全部账号的累计流量
+func (s *ProxyService) ResetTraffic(id uint) error {
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	return s.db.Where("proxy_id = ?", id).Delete(&database.ProxyTraffic{}).Error
+}
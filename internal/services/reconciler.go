@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"l2tp-manager/internal/database"
+	"l2tp-manager/internal/logger"
+
+	"gorm.io/gorm"
+)
+
+// reconcileBackoff 协调失败后的重试退避
+type reconcileBackoff struct {
+	next  time.Time
+	delay time.Duration
+}
+
+// Reconciler 期望状态协调器，持续将容器和转发器状态收敛到期望状态
+type Reconciler struct {
+	db             *gorm.DB
+	l2tpService    *L2TPService
+	routingService Forwarding
+	settings       *SettingsService
+	backoff        map[uint]*reconcileBackoff
+	mutex          sync.Mutex
+}
+
+// 协调失败后的重试退避范围
+const (
+	minReconcileBackoff = 30 * time.Second
+	maxReconcileBackoff = 10 * time.Minute
+)
+
+// NewReconciler 创建期望状态协调器
+func NewReconciler(db *gorm.DB, l2tpService *L2TPService, routingService Forwarding, settings *SettingsService) *Reconciler {
+	return &Reconciler{
+		db:             db,
+		l2tpService:    l2tpService,
+		routingService: routingService,
+		settings:       settings,
+		backoff:        make(map[uint]*reconcileBackoff),
+	}
+}
+
+// Start 启动协调循环，间隔修改后立即生效，间隔为0时暂停协调
+func (r *Reconciler) Start(ctx context.Context) {
+	changed := r.settings.Watch(SettingReconcileInterval)
+	slog.Info("期望状态协调器已启动", "interval", r.settings.Seconds(SettingReconcileInterval))
+
+	for {
+		timer := newIntervalTimer(r.settings.Seconds(SettingReconcileInterval))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			slog.Info("期望状态协调器正在退出")
+			return
+		case <-changed:
+			timer.Stop()
+			slog.Info("期望状态协调间隔已更新", "interval", r.settings.Seconds(SettingReconcileInterval))
+		case <-timer.C:
+			r.ReconcileAll()
+		}
+	}
+}
+
+// ReconcileAll 对所有服务器执行一次协调
+func (r *Reconciler) ReconcileAll() {
+	var servers []database.L2TPServer
+	if err := r.db.Find(&servers).Error; err != nil {
+		slog.Error("协调器加载服务器失败", "error", err)
+		return
+	}
+
+	for i := range servers {
+		r.reconcile(&servers[i])
+	}
+}
+
+// reconcile 协调单个服务器
+func (r *Reconciler) reconcile(server *database.L2TPServer) {
+	// 过渡状态由异步任务负责，等待其完成
+	if server.Status == "starting" || server.Status == "stopping" {
+		return
+	}
+
+	// 转发器状态跟随数据库中的实际状态
+	if forwarderStatus, ok := r.routingService.ForwarderStatus(server.ID); ok && forwarderStatus != server.Status {
+		if server.Status == "running" || server.Status == "stopped" {
+			r.routingService.UpdateServerStatus(server.ID, server.Status)
+		}
+	}
+
+	desired := server.DesiredState
+	if desired == "" {
+		return
+	}
+
+	// 为本次操作生成关联ID，异步启动/停止的日志可据此追溯到协调器
+	ctx := logger.WithRequestID(context.Background(), "reconcile-"+logger.NewRequestID())
+
+	switch {
+	case desired == "running" && server.Status == "error":
+		// 错误状态(如健康检查自动重启次数用尽)等待人工处理，由运维手动启动复位，
+		// 协调器不自动重启，否则会绕过自动重启的次数上限
+		return
+
+	case desired == "running" && server.Status != "running":
+		if time.Now().After(server.ExpireDate) {
+			return
+		}
+		if !r.ready(server.ID) {
+			return
+		}
+		slog.InfoContext(ctx, "协调器: 服务器期望运行，开始启动", "server_id", server.ID, "status", server.Status)
+		if err := r.l2tpService.StartServer(ctx, server.ID); err != nil {
+			slog.ErrorContext(ctx, "协调器启动服务器失败", "server_id", server.ID, "error", err)
+			r.fail(server.ID)
+			return
+		}
+		// 转发器在异步启动成功、状态变为running后的下一轮协调中跟随启动
+		r.fail(server.ID) // 预设退避，等待异步启动结果
+
+	case desired == "stopped" && (server.Status == "running" || server.Status == "error"):
+		if !r.ready(server.ID) {
+			return
+		}
+		slog.InfoContext(ctx, "协调器: 服务器期望停止，开始停止", "server_id", server.ID, "status", server.Status)
+		if err := r.l2tpService.StopServer(ctx, server.ID); err != nil {
+			slog.ErrorContext(ctx, "协调器停止服务器失败", "server_id", server.ID, "error", err)
+			r.fail(server.ID)
+			return
+		}
+		r.routingService.UpdateServerStatus(server.ID, "stopped")
+		r.fail(server.ID)
+
+	default:
+		// 已收敛，清除退避
+		r.mutex.Lock()
+		delete(r.backoff, server.ID)
+		r.mutex.Unlock()
+	}
+}
+
+// ready 判断服务器是否已过退避期
+func (r *Reconciler) ready(serverID uint) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	b, exists := r.backoff[serverID]
+	return !exists || time.Now().After(b.next)
+}
+
+// fail 记录一次协调动作，按指数退避推迟下次尝试
+func (r *Reconciler) fail(serverID uint) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	b, exists := r.backoff[serverID]
+	if !exists {
+		b = &reconcileBackoff{delay: minReconcileBackoff}
+		r.backoff[serverID] = b
+	} else {
+		b.delay *= 2
+		if b.delay > maxReconcileBackoff {
+			b.delay = maxReconcileBackoff
+		}
+	}
+	b.next = time.Now().Add(b.delay)
+}
@@ -0,0 +1,315 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"l2tp-manager/internal/database"
+
+	"gorm.io/gorm"
+)
+
+// relayTokenPrefix 节点注册令牌前缀，便于识别
+const relayTokenPrefix = "rn_"
+
+// RelayNodeService 中转节点登记：注册令牌、承载上限和服务器放置
+type RelayNodeService struct {
+	db          *gorm.DB
+	hub         *AgentHub
+	sharedToken string // 全局AGENT_TOKEN，持有者可按名称自动登记节点
+}
+
+// RelayNodeView 中转节点及其在线状态和负载
+type RelayNodeView struct {
+	database.RelayNode
+	Online     bool             `json:"online"`
+	Servers    int              `json:"servers"` // 指定到该节点的服务器数
+	Free       int              `json:"free"`    // 剩余可承载的服务器数，-1表示不限
+	Forwarders []AgentForwarder `json:"forwarders"`
+}
+
+// NewRelayNodeService 创建中转节点服务
+func NewRelayNodeService(db *gorm.DB, hub *AgentHub, sharedToken string) *RelayNodeService {
+	return &RelayNodeService{db: db, hub: hub, sharedToken: sharedToken}
+}
+
+// hashRelayToken 计算令牌的存储值
+func hashRelayToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newRelayToken 生成注册令牌，返回明文和存储值
+func newRelayToken() (string, string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("生成注册令牌失败: %v", err)
+	}
+	token := relayTokenPrefix + hex.EncodeToString(buf)
+	return token, hashRelayToken(token), nil
+}
+
+// validateRelayNode 校验节点字段
+func validateRelayNode(node *database.RelayNode) error {
+	node.Name = strings.TrimSpace(node.Name)
+	if !ValidAgentName(node.Name) {
+		return fmt.Errorf("节点名称只能包含字母、数字、点、下划线和连字符，且不超过64个字符")
+	}
+	if node.MaxServers < 0 {
+		return fmt.Errorf("承载上限不能为负数")
+	}
+	if node.BandwidthMbps < 0 {
+		return fmt.Errorf("带宽不能为负数")
+	}
+	node.Address = strings.TrimSpace(node.Address)
+	if !validRelayAddress(node.Address) {
+		return fmt.Errorf("对外地址必须是IP地址或域名")
+	}
+	return nil
+}
+
+// List 列出全部节点，附带在线状态和已指定的服务器数
+func (s *RelayNodeService) List() ([]RelayNodeView, error) {
+	var nodes []database.RelayNode
+	if err := s.db.Order("name").Find(&nodes).Error; err != nil {
+		return nil, err
+	}
+
+	type count struct {
+		RelayNodeID uint
+		Count       int
+	}
+	var counts []count
+	if err := s.db.Model(&database.L2TPServer{}).Select("relay_node_id, COUNT(*) AS count").
+		Where("relay_node_id != 0").Group("relay_node_id").Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	assigned := make(map[uint]int)
+	for _, c := range counts {
+		assigned[c.RelayNodeID] = c.Count
+	}
+	online := make(map[uint]AgentInfo)
+	for _, info := range s.hub.List() {
+		online[info.NodeID] = info
+	}
+
+	views := make([]RelayNodeView, 0, len(nodes))
+	for _, node := range nodes {
+		view := RelayNodeView{RelayNode: node, Servers: assigned[node.ID], Free: -1, Forwarders: []AgentForwarder{}}
+		if node.MaxServers > 0 {
+			view.Free = max(node.MaxServers-view.Servers, 0)
+		}
+		if info, ok := online[node.ID]; ok {
+			view.Online = true
+			view.Forwarders = info.Forwarders
+			view.LastSeenAt = &info.LastSeen
+		}
+		views = append(views, view)
+	}
+	return views, nil
+}
+
+// Get 获取节点
+func (s *RelayNodeService) Get(id uint) (*database.RelayNode, error) {
+	var node database.RelayNode
+	if err := s.db.First(&node, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("中转节点不存在")
+		}
+		return nil, err
+	}
+	return &node, nil
+}
+
+// Create 登记节点并生成注册令牌，令牌只在此时返回一次
+func (s *RelayNodeService) Create(node *database.RelayNode) (string, error) {
+	if err := validateRelayNode(node); err != nil {
+		return "", err
+	}
+	var count int64
+	s.db.Model(&database.RelayNode{}).Where("name = ?", node.Name).Count(&count)
+	if count > 0 {
+		return "", fmt.Errorf("节点名称 %s 已存在", node.Name)
+	}
+
+	token, hash, err := newRelayToken()
+	if err != nil {
+		return "", err
+	}
+	node.ID = 0
+	node.TokenHash = hash
+	node.LastSeenAt = nil
+	if err := s.db.Create(node).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Update 更新节点的名称、说明、承载上限、带宽和对外地址，地址变化后重新下发途经该节点的链式转发配置
+func (s *RelayNodeService) Update(id uint, update *database.RelayNode) (*database.RelayNode, error) {
+	node, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateRelayNode(update); err != nil {
+		return nil, err
+	}
+	var count int64
+	s.db.Model(&database.RelayNode{}).Where("name = ? AND id != ?", update.Name, id).Count(&count)
+	if count > 0 {
+		return nil, fmt.Errorf("节点名称 %s 已存在", update.Name)
+	}
+
+	node.Name = update.Name
+	node.Description = update.Description
+	node.MaxServers = update.MaxServers
+	node.BandwidthMbps = update.BandwidthMbps
+	node.Address = update.Address
+	if err := s.db.Save(node).Error; err != nil {
+		return nil, err
+	}
+	s.hub.Notify()
+	return node, nil
+}
+
+// Delete 删除节点，仍有服务器指定该节点时拒绝。回收站中的服务器改为本机转发
+func (s *RelayNodeService) Delete(id uint) (*database.RelayNode, error) {
+	node, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	var count int64
+	s.db.Model(&database.L2TPServer{}).Where("relay_node_id = ?", id).Count(&count)
+	if count > 0 {
+		return nil, fmt.Errorf("仍有 %d 个服务器指定了该节点，请先改为其他节点", count)
+	}
+	chained, err := chainedServers(s.db, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(chained) > 0 {
+		return nil, fmt.Errorf("服务器 %s 的链式转发经过该节点，请先修改", strings.Join(chained, "、"))
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&database.L2TPServer{}).Where("relay_node_id = ?", id).
+			UpdateColumn("relay_node_id", 0).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&database.RelayNode{}, id).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.hub.Disconnect(id)
+	return node, nil
+}
+
+// RotateToken 重新生成注册令牌，旧令牌立即失效并断开当前连接
+func (s *RelayNodeService) RotateToken(id uint) (*database.RelayNode, string, error) {
+	node, err := s.Get(id)
+	if err != nil {
+		return nil, "", err
+	}
+	token, hash, err := newRelayToken()
+	if err != nil {
+		return nil, "", err
+	}
+	if err := s.db.Model(node).UpdateColumn("token_hash", hash).Error; err != nil {
+		return nil, "", err
+	}
+	s.hub.Disconnect(id)
+	return node, token, nil
+}
+
+// Authenticate 校验节点连接：节点自己的注册令牌，或全局AGENT_TOKEN加节点名称。
+// 使用全局令牌时按名称自动登记新节点，但不能冒用已设置了注册令牌的节点
+func (s *RelayNodeService) Authenticate(token, name string) (*database.RelayNode, error) {
+	if token == "" {
+		return nil, fmt.Errorf("缺少节点令牌")
+	}
+
+	if strings.HasPrefix(token, relayTokenPrefix) {
+		var node database.RelayNode
+		result := s.db.Where("token_hash = ?", hashRelayToken(token)).Limit(1).Find(&node)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected > 0 {
+			return &node, nil
+		}
+	}
+
+	if s.sharedToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.sharedToken)) != 1 {
+		return nil, fmt.Errorf("无效的节点令牌")
+	}
+	if !ValidAgentName(name) {
+		return nil, fmt.Errorf("节点名称只能包含字母、数字、点、下划线和连字符，且不超过64个字符")
+	}
+	node := database.RelayNode{Name: name}
+	if err := s.db.Where("name = ?", name).FirstOrCreate(&node).Error; err != nil {
+		return nil, err
+	}
+	if node.TokenHash != "" {
+		return nil, fmt.Errorf("节点 %s 已设置注册令牌，请使用该令牌连接", name)
+	}
+	return &node, nil
+}
+
+// Placement 推荐放置新服务器的节点：在线且未达承载上限的节点中，已指定服务器最少者优先，其次带宽较大者
+func (s *RelayNodeService) Placement() (*RelayNodeView, error) {
+	views, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	var candidates []RelayNodeView
+	for _, view := range views {
+		if view.Online && view.Free != 0 {
+			candidates = append(candidates, view)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("没有在线且有剩余容量的中转节点")
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Servers != candidates[j].Servers {
+			return candidates[i].Servers < candidates[j].Servers
+		}
+		return candidates[i].BandwidthMbps > candidates[j].BandwidthMbps
+	})
+	return &candidates[0], nil
+}
+
+// checkRelayNode 校验服务器指定的中转节点存在且未超过承载上限
+func checkRelayNode(tx *gorm.DB, server *database.L2TPServer, excludeID uint) error {
+	if server.RelayNodeID == 0 {
+		return nil
+	}
+	var node database.RelayNode
+	result := tx.Limit(1).Find(&node, server.RelayNodeID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("中转节点 %d 不存在", server.RelayNodeID)
+	}
+	if node.MaxServers <= 0 {
+		return nil
+	}
+
+	var count int64
+	if err := tx.Model(&database.L2TPServer{}).Where("relay_node_id = ? AND id != ?", node.ID, excludeID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if int(count) >= node.MaxServers {
+		return fmt.Errorf("中转节点 %s 已达到承载上限 %d", node.Name, node.MaxServers)
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	xnet "github.com/xtls/xray-core/common/net"
+)
+
+// handoffEnv 向重启后的进程传递继承的文件描述符，格式为 name=fd,name=fd，
+// name为 http 或 udp/<端口>、tcp/<端口>
+const handoffEnv = "L2TP_HANDOFF_FDS"
+
+// handoffHTTP HTTP监听套接字在交接表中的名称
+const handoffHTTP = "http"
+
+// RestartManager 平滑重启：在原进程内exec新的可执行文件，通过继承文件描述符保留HTTP监听套接字，
+// 使重启期间新的HTTP连接排队等待而不是被拒绝。转发器在重启期间停止转发，转发端口只由占位套接字保持绑定
+type RestartManager struct {
+	routing    *RoutingService
+	executable string
+	inherited  map[string]*os.File // 上一进程交接的套接字
+
+	requested chan struct{}
+	once      sync.Once
+}
+
+// Handoff 重启前准备好的待交接套接字
+type Handoff struct {
+	files   []*os.File
+	entries []string
+	rules   []ForwardRule // 重启前运行中的转发规则，停止转发器后为其绑定占位套接字
+}
+
+// NewRestartManager 创建重启管理器，并接管上一进程通过环境变量交接的套接字
+func NewRestartManager(routing *RoutingService) *RestartManager {
+	m := &RestartManager{
+		routing:    routing,
+		executable: executablePath(),
+		inherited:  make(map[string]*os.File),
+		requested:  make(chan struct{}),
+	}
+
+	value := os.Getenv(handoffEnv)
+	os.Unsetenv(handoffEnv)
+	for _, item := range strings.Split(value, ",") {
+		name, fdStr, ok := strings.Cut(item, "=")
+		if !ok {
+			continue
+		}
+		fd, err := strconv.Atoi(fdStr)
+		if err != nil || fd < 3 {
+			continue
+		}
+		m.inherited[name] = os.NewFile(uintptr(fd), name)
+	}
+	if len(m.inherited) > 0 {
+		slog.Info("已接管上一进程的监听套接字", "count", len(m.inherited))
+	}
+
+	// systemd socket activation：使用名为http的套接字，未命名时使用第一个
+	if files := systemdListenFiles(); len(files) > 0 {
+		chosen := files[0]
+		for _, file := range files {
+			if file.Name() == handoffHTTP {
+				chosen = file
+			}
+		}
+		for _, file := range files {
+			if _, exists := m.inherited[handoffHTTP]; file != chosen || exists {
+				slog.Warn("忽略systemd传入的套接字", "name", file.Name())
+				file.Close()
+				continue
+			}
+			m.inherited[handoffHTTP] = file
+			slog.Info("使用systemd传入的监听套接字", "name", file.Name())
+		}
+	}
+	return m
+}
+
+// executablePath 当前可执行文件的实际路径，无法确定时返回空
+func executablePath() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	return exe
+}
+
+// Listen 创建HTTP监听，有上一进程交接或systemd传入的套接字时直接沿用。network为unix时address为套接字路径，
+// mode为套接字文件权限
+func (m *RestartManager) Listen(network, address string, mode os.FileMode) (net.Listener, error) {
+	if file, ok := m.inherited[handoffHTTP]; ok {
+		delete(m.inherited, handoffHTTP)
+		defer file.Close()
+		listener, err := net.FileListener(file)
+		if err == nil {
+			return listener, nil
+		}
+		slog.Warn("沿用交接的HTTP监听套接字失败，重新监听", "error", err)
+	}
+	if network == "unix" {
+		return listenUnix(address, mode)
+	}
+	return net.Listen(network, address)
+}
+
+// listenUnix 监听Unix套接字并设置权限。关闭时保留套接字文件，平滑重启后新进程沿用同一路径
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("套接字 %s 已被其他进程监听", path)
+		}
+		os.Remove(path) // 上次运行残留的套接字文件
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("设置套接字权限失败: %v", err)
+	}
+	return listener, nil
+}
+
+// ReleaseForwarderSockets 关闭上一进程交接的转发端口占位套接字，应在启动转发器之前调用。
+// 占位套接字不转发流量，与新转发器同时绑定时会按SO_REUSEPORT分走部分流量
+func (m *RestartManager) ReleaseForwarderSockets() {
+	for name, file := range m.inherited {
+		file.Close()
+		delete(m.inherited, name)
+	}
+}
+
+// Request 延迟delay后请求重启，给当前请求留出返回响应的时间
+func (m *RestartManager) Request(delay time.Duration) {
+	time.AfterFunc(delay, func() {
+		m.once.Do(func() { close(m.requested) })
+	})
+}
+
+// Requested 请求重启时关闭
+func (m *RestartManager) Requested() <-chan struct{} {
+	return m.requested
+}
+
+// Prepare 复制HTTP监听套接字并记录运行中的转发规则，在停止转发器之前调用
+func (m *RestartManager) Prepare(listener net.Listener) (*Handoff, error) {
+	if !handoffSupported {
+		return nil, fmt.Errorf("当前平台不支持交接套接字")
+	}
+
+	handoff := &Handoff{rules: m.routing.ActiveForwardRules()}
+	// TCP和Unix套接字监听均可复制文件描述符
+	if fileListener, ok := listener.(interface{ File() (*os.File, error) }); ok {
+		file, err := fileListener.File()
+		if err != nil {
+			return nil, fmt.Errorf("复制HTTP监听套接字失败: %v", err)
+		}
+		if err := handoff.add(handoffHTTP, file); err != nil {
+			handoff.Close()
+			return nil, err
+		}
+	}
+	return handoff, nil
+}
+
+// ReserveForwardPorts 为重启前运行中的转发端口绑定占位套接字并交接给新进程，必须在转发器停止之后调用，
+// 否则占位套接字会按SO_REUSEPORT分走仍在运行的转发器的流量。
+// 占位套接字不转发流量：从停止转发器到新进程的转发器启动期间转发中断，到达的UDP数据包被丢弃，
+// 排队的TCP连接在释放占位套接字时被重置。占位只是避免端口在重启期间被其他程序占用，
+// 以及UDP客户端收到端口不可达而断开
+func (m *RestartManager) ReserveForwardPorts(handoff *Handoff) {
+	lc := net.ListenConfig{Control: setReusePort}
+	for _, rule := range handoff.rules {
+		address := fmt.Sprintf(":%d", rule.ListenPort)
+		for _, network := range rule.Networks {
+			var file *os.File
+			var err error
+			switch network {
+			case xnet.Network_UDP:
+				var conn net.PacketConn
+				if conn, err = lc.ListenPacket(context.Background(), "udp", address); err == nil {
+					file, err = conn.(*net.UDPConn).File()
+					conn.Close()
+				}
+			case xnet.Network_TCP:
+				var ln net.Listener
+				if ln, err = lc.Listen(context.Background(), "tcp", address); err == nil {
+					file, err = ln.(*net.TCPListener).File()
+					ln.Close()
+				}
+			default:
+				continue
+			}
+			name := fmt.Sprintf("%s/%d", strings.ToLower(network.SystemString()), rule.ListenPort)
+			if err != nil {
+				// 单个端口失败不影响重启，只是该端口在重启期间不处于绑定状态
+				slog.Warn("保留转发端口失败", "socket", name, "error", err)
+				continue
+			}
+			if err := handoff.add(name, file); err != nil {
+				slog.Warn("保留转发端口失败", "socket", name, "error", err)
+			}
+		}
+	}
+}
+
+// add 登记待交接的套接字，exec后由新进程继承
+func (h *Handoff) add(name string, file *os.File) error {
+	if err := clearCloseOnExec(file.Fd()); err != nil {
+		file.Close()
+		return err
+	}
+	h.files = append(h.files, file)
+	h.entries = append(h.entries, fmt.Sprintf("%s=%d", name, file.Fd()))
+	return nil
+}
+
+// Close 放弃交接，关闭已复制的套接字
+func (h *Handoff) Close() {
+	for _, file := range h.files {
+		file.Close()
+	}
+	h.files = nil
+	h.entries = nil
+}
+
+// Exec 用磁盘上的可执行文件替换当前进程，沿用原有参数和环境变量；handoff非空时交接其中的套接字。
+// 成功时不返回
+func (m *RestartManager) Exec(handoff *Handoff) error {
+	if m.executable == "" {
+		return fmt.Errorf("无法确定当前可执行文件路径")
+	}
+	env := os.Environ()
+	if handoff != nil {
+		env = append(env, handoffEnv+"="+strings.Join(handoff.entries, ","))
+	}
+	return syscall.Exec(m.executable, os.Args, env)
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 流量日志清理参数
+const (
+	pruneBatchSize  = 1000                  // 每批删除的行数
+	pruneBatchPause = 50 * time.Millisecond // 批次间隔，让出写锁给其他写入
+	hourSampleKeep  = 7 * 24 * time.Hour    // 小时粒度样本的保留时长(与历史查询范围一致)
+)
+
+// TrafficRetention 流量日志保留策略
+type TrafficRetention struct {
+	db       *gorm.DB
+	settings *SettingsService
+}
+
+// NewTrafficRetention 创建流量日志保留策略，保留天数读取自设置
+func NewTrafficRetention(db *gorm.DB, settings *SettingsService) *TrafficRetention {
+	return &TrafficRetention{db: db, settings: settings}
+}
+
+// Start 启动流量日志定期清理协程，保留天数<=0时跳过清理
+func (r *TrafficRetention) Start(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		if pruned, err := r.Prune(ctx); err != nil {
+			slog.Error("清理流量日志失败", "error", err)
+		} else if pruned > 0 {
+			slog.Info("已清理超过保留期的流量日志", "count", pruned)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Prune 删除超过保留期的流量日志和过期的小时样本，返回删除的日志条数
+func (r *TrafficRetention) Prune(ctx context.Context) (int64, error) {
+	retentionDays := r.settings.Int(SettingTrafficRetentionDays)
+	if retentionDays <= 0 {
+		return 0, nil
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -retentionDays)
+	pruned, err := r.deleteInBatches(ctx,
+		"DELETE FROM traffic_logs WHERE id IN (SELECT id FROM traffic_logs WHERE created_at < ? LIMIT ?)", cutoff)
+	if err != nil {
+		return pruned, err
+	}
+
+	_, err = r.deleteInBatches(ctx,
+		"DELETE FROM traffic_samples WHERE id IN (SELECT id FROM traffic_samples WHERE granularity = 'hour' AND bucket < ? LIMIT ?)",
+		time.Now().Add(-hourSampleKeep))
+	return pruned, err
+}
+
+// deleteInBatches 分批执行删除语句，避免长时间占用SQLite写锁
+func (r *TrafficRetention) deleteInBatches(ctx context.Context, statement string, cutoff time.Time) (int64, error) {
+	var total int64
+	for {
+		result := r.db.Exec(statement, cutoff, pruneBatchSize)
+		if result.Error != nil {
+			return total, result.Error
+		}
+		total += result.RowsAffected
+		if result.RowsAffected < pruneBatchSize {
+			return total, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return total, ctx.Err()
+		case <-time.After(pruneBatchPause):
+		}
+	}
+}
@@ -0,0 +1,381 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"l2tp-manager/internal/database"
+
+	"gorm.io/gorm"
+)
+
+// ServerConfig 服务器可版本化的配置字段
+type ServerConfig struct {
+	Name       string    `json:"name"`
+	Type       string    `json:"type,omitempty"`
+	Host       string    `json:"host"`
+	Port       int       `json:"port"`
+	Username   string    `json:"username"`
+	Password   string    `json:"password"`
+	L2TPPort   int       `json:"l2tp_port"`
+	PSK        string    `json:"psk"`
+	Users      string    `json:"users"`
+	ExpireDate time.Time `json:"expire_date"`
+
+	EnableOpenVPN    bool `json:"enable_openvpn"`
+	OpenVPNRelayPort int  `json:"openvpn_relay_port"`
+	EnableSSTP       bool `json:"enable_sstp"`
+	SSTPRelayPort    int  `json:"sstp_relay_port"`
+
+	OpenVPNProto  string `json:"openvpn_proto,omitempty"`
+	IKEv2Auth     string `json:"ikev2_auth,omitempty"`
+	IKEv2Identity string `json:"ikev2_identity,omitempty"`
+	IKEv2NATPort  int    `json:"ikev2_nat_port,omitempty"`
+
+	RealityServerName string `json:"reality_server_name,omitempty"`
+
+	RelayNodeID uint   `json:"relay_node_id,omitempty"`
+	ChainNodes  string `json:"chain_nodes,omitempty"`
+
+	GeoIPMode      string `json:"geoip_mode,omitempty"`
+	GeoIPCountries string `json:"geoip_countries,omitempty"`
+
+	SoftEtherHub      string `json:"softether_hub,omitempty"`
+	SecureNATDisabled bool   `json:"securenat_disabled,omitempty"`
+	SecureNATAddress  string `json:"securenat_address,omitempty"`
+	DHCPStart         string `json:"dhcp_start,omitempty"`
+	DHCPEnd           string `json:"dhcp_end,omitempty"`
+	ClientDNS         string `json:"client_dns,omitempty"`
+	DNSDomains        string `json:"dns_domains,omitempty"`
+	NATKeepalive      int    `json:"nat_keepalive,omitempty"`
+	KnockEnabled      bool   `json:"knock_enabled,omitempty"`
+	KnockSecret       string `json:"knock_secret,omitempty"`
+	KnockTTL          int    `json:"knock_ttl,omitempty"`
+	Obfuscation       string `json:"obfuscation,omitempty"`
+	ObfuscationPort   int    `json:"obfuscation_port,omitempty"`
+	ObfuscationKey    string `json:"obfuscation_key,omitempty"`
+	BillingAnchorDay  int    `json:"billing_anchor_day,omitempty"`
+	BillingTimezone   string `json:"billing_timezone,omitempty"`
+}
+
+// FieldChange 单个字段的变更
+type FieldChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// sensitiveFields 在差异中需要脱敏的字段
+var sensitiveFields = map[string]bool{
+	"password":        true,
+	"psk":             true,
+	"users":           true,
+	"knock_secret":    true,
+	"obfuscation_key": true,
+}
+
+// configOf 提取服务器的配置字段
+func configOf(server *database.L2TPServer) ServerConfig {
+	return ServerConfig{
+		Name:       server.Name,
+		Type:       server.Type,
+		Host:       server.Host,
+		Port:       server.Port,
+		Username:   server.Username,
+		Password:   server.Password,
+		L2TPPort:   server.L2TPPort,
+		PSK:        server.PSK,
+		Users:      server.Users,
+		ExpireDate: server.ExpireDate,
+
+		EnableOpenVPN:    server.EnableOpenVPN,
+		OpenVPNRelayPort: server.OpenVPNRelayPort,
+		EnableSSTP:       server.EnableSSTP,
+		SSTPRelayPort:    server.SSTPRelayPort,
+
+		OpenVPNProto:  server.OpenVPNProto,
+		IKEv2Auth:     server.IKEv2Auth,
+		IKEv2Identity: server.IKEv2Identity,
+		IKEv2NATPort:  server.IKEv2NATPort,
+
+		RealityServerName: server.RealityServerName,
+
+		RelayNodeID: server.RelayNodeID,
+		ChainNodes:  server.ChainNodes,
+
+		GeoIPMode:      server.GeoIPMode,
+		GeoIPCountries: server.GeoIPCountries,
+
+		SoftEtherHub:      server.SoftEtherHub,
+		SecureNATDisabled: server.SecureNATDisabled,
+		SecureNATAddress:  server.SecureNATAddress,
+		DHCPStart:         server.DHCPStart,
+		DHCPEnd:           server.DHCPEnd,
+		ClientDNS:         server.ClientDNS,
+		DNSDomains:        server.DNSDomains,
+		NATKeepalive:      server.NATKeepalive,
+		KnockEnabled:      server.KnockEnabled,
+		KnockSecret:       server.KnockSecret,
+		KnockTTL:          server.KnockTTL,
+		Obfuscation:       server.Obfuscation,
+		ObfuscationPort:   server.ObfuscationPort,
+		ObfuscationKey:    server.ObfuscationKey,
+		BillingAnchorDay:  server.BillingAnchorDay,
+		BillingTimezone:   server.BillingTimezone,
+	}
+}
+
+// applyConfig 将配置字段写回服务器记录，不修改运行状态等字段
+func applyConfig(server *database.L2TPServer, config ServerConfig) {
+	server.Name = config.Name
+	server.Type = config.Type
+	server.Host = config.Host
+	server.Port = config.Port
+	server.Username = config.Username
+	server.Password = config.Password
+	server.L2TPPort = config.L2TPPort
+	server.PSK = config.PSK
+	server.Users = config.Users
+	server.ExpireDate = config.ExpireDate
+	server.EnableOpenVPN = config.EnableOpenVPN
+	server.OpenVPNRelayPort = config.OpenVPNRelayPort
+	server.EnableSSTP = config.EnableSSTP
+	server.SSTPRelayPort = config.SSTPRelayPort
+	server.OpenVPNProto = config.OpenVPNProto
+	server.IKEv2Auth = config.IKEv2Auth
+	server.IKEv2Identity = config.IKEv2Identity
+	server.IKEv2NATPort = config.IKEv2NATPort
+	server.RealityServerName = config.RealityServerName
+	server.RelayNodeID = config.RelayNodeID
+	server.ChainNodes = config.ChainNodes
+	server.GeoIPMode = config.GeoIPMode
+	server.GeoIPCountries = config.GeoIPCountries
+	server.SoftEtherHub = config.SoftEtherHub
+	server.SecureNATDisabled = config.SecureNATDisabled
+	server.SecureNATAddress = config.SecureNATAddress
+	server.DHCPStart = config.DHCPStart
+	server.DHCPEnd = config.DHCPEnd
+	server.ClientDNS = config.ClientDNS
+	server.DNSDomains = config.DNSDomains
+	server.NATKeepalive = config.NATKeepalive
+	server.KnockEnabled = config.KnockEnabled
+	server.KnockSecret = config.KnockSecret
+	server.KnockTTL = config.KnockTTL
+	server.Obfuscation = config.Obfuscation
+	server.ObfuscationPort = config.ObfuscationPort
+	server.ObfuscationKey = config.ObfuscationKey
+	server.BillingAnchorDay = config.BillingAnchorDay
+	server.BillingTimezone = config.BillingTimezone
+}
+
+// diffConfigs 计算两个配置之间的差异，敏感字段只标记已变更
+func diffConfigs(before, after ServerConfig) map[string]FieldChange {
+	changes := make(map[string]FieldChange)
+	add := func(field string, oldValue, newValue interface{}) {
+		if sensitiveFields[field] {
+			oldValue, newValue = "******", "******"
+		}
+		changes[field] = FieldChange{Old: oldValue, New: newValue}
+	}
+
+	if before.Name != after.Name {
+		add("name", before.Name, after.Name)
+	}
+	if before.Host != after.Host {
+		add("host", before.Host, after.Host)
+	}
+	if before.Port != after.Port {
+		add("port", before.Port, after.Port)
+	}
+	if before.Username != after.Username {
+		add("username", before.Username, after.Username)
+	}
+	if before.Password != after.Password {
+		add("password", nil, nil)
+	}
+	if before.L2TPPort != after.L2TPPort {
+		add("l2tp_port", before.L2TPPort, after.L2TPPort)
+	}
+	if before.PSK != after.PSK {
+		add("psk", nil, nil)
+	}
+	if before.Users != after.Users {
+		add("users", nil, nil)
+	}
+	if !before.ExpireDate.Equal(after.ExpireDate) {
+		add("expire_date", before.ExpireDate, after.ExpireDate)
+	}
+	if before.EnableOpenVPN != after.EnableOpenVPN {
+		add("enable_openvpn", before.EnableOpenVPN, after.EnableOpenVPN)
+	}
+	if before.OpenVPNRelayPort != after.OpenVPNRelayPort {
+		add("openvpn_relay_port", before.OpenVPNRelayPort, after.OpenVPNRelayPort)
+	}
+	if before.EnableSSTP != after.EnableSSTP {
+		add("enable_sstp", before.EnableSSTP, after.EnableSSTP)
+	}
+	if before.SSTPRelayPort != after.SSTPRelayPort {
+		add("sstp_relay_port", before.SSTPRelayPort, after.SSTPRelayPort)
+	}
+	if before.OpenVPNProto != after.OpenVPNProto {
+		add("openvpn_proto", before.OpenVPNProto, after.OpenVPNProto)
+	}
+	if before.IKEv2Auth != after.IKEv2Auth {
+		add("ikev2_auth", before.IKEv2Auth, after.IKEv2Auth)
+	}
+	if before.IKEv2Identity != after.IKEv2Identity {
+		add("ikev2_identity", before.IKEv2Identity, after.IKEv2Identity)
+	}
+	if before.IKEv2NATPort != after.IKEv2NATPort {
+		add("ikev2_nat_port", before.IKEv2NATPort, after.IKEv2NATPort)
+	}
+	if before.RealityServerName != after.RealityServerName {
+		add("reality_server_name", before.RealityServerName, after.RealityServerName)
+	}
+	if before.RelayNodeID != after.RelayNodeID {
+		add("relay_node_id", before.RelayNodeID, after.RelayNodeID)
+	}
+	if before.ChainNodes != after.ChainNodes {
+		add("chain_nodes", before.ChainNodes, after.ChainNodes)
+	}
+	if before.GeoIPMode != after.GeoIPMode {
+		add("geoip_mode", before.GeoIPMode, after.GeoIPMode)
+	}
+	if before.GeoIPCountries != after.GeoIPCountries {
+		add("geoip_countries", before.GeoIPCountries, after.GeoIPCountries)
+	}
+	if before.SoftEtherHub != after.SoftEtherHub {
+		add("softether_hub", before.SoftEtherHub, after.SoftEtherHub)
+	}
+	if before.SecureNATDisabled != after.SecureNATDisabled {
+		add("securenat_disabled", before.SecureNATDisabled, after.SecureNATDisabled)
+	}
+	if before.SecureNATAddress != after.SecureNATAddress {
+		add("securenat_address", before.SecureNATAddress, after.SecureNATAddress)
+	}
+	if before.DHCPStart != after.DHCPStart {
+		add("dhcp_start", before.DHCPStart, after.DHCPStart)
+	}
+	if before.DHCPEnd != after.DHCPEnd {
+		add("dhcp_end", before.DHCPEnd, after.DHCPEnd)
+	}
+	if before.ClientDNS != after.ClientDNS {
+		add("client_dns", before.ClientDNS, after.ClientDNS)
+	}
+	if before.DNSDomains != after.DNSDomains {
+		add("dns_domains", before.DNSDomains, after.DNSDomains)
+	}
+	if before.NATKeepalive != after.NATKeepalive {
+		add("nat_keepalive", before.NATKeepalive, after.NATKeepalive)
+	}
+	if before.KnockEnabled != after.KnockEnabled {
+		add("knock_enabled", before.KnockEnabled, after.KnockEnabled)
+	}
+	if before.KnockSecret != after.KnockSecret {
+		add("knock_secret", nil, nil)
+	}
+	if before.KnockTTL != after.KnockTTL {
+		add("knock_ttl", before.KnockTTL, after.KnockTTL)
+	}
+	if before.Obfuscation != after.Obfuscation {
+		add("obfuscation", before.Obfuscation, after.Obfuscation)
+	}
+	if before.ObfuscationPort != after.ObfuscationPort {
+		add("obfuscation_port", before.ObfuscationPort, after.ObfuscationPort)
+	}
+	if before.ObfuscationKey != after.ObfuscationKey {
+		add("obfuscation_key", nil, nil)
+	}
+	if before.BillingAnchorDay != after.BillingAnchorDay {
+		add("billing_anchor_day", before.BillingAnchorDay, after.BillingAnchorDay)
+	}
+	if before.BillingTimezone != after.BillingTimezone {
+		add("billing_timezone", before.BillingTimezone, after.BillingTimezone)
+	}
+
+	return changes
+}
+
+// RecordRevision 记录服务器配置修订，before为nil表示新建
+func (s *L2TPService) RecordRevision(server *database.L2TPServer, before *database.L2TPServer, action, username string) error {
+	after := configOf(server)
+	var changes map[string]FieldChange
+	if before != nil {
+		changes = diffConfigs(configOf(before), after)
+		if len(changes) == 0 && action == "update" {
+			return nil // 配置未变化，无需记录
+		}
+	}
+
+	snapshot, err := json.Marshal(after)
+	if err != nil {
+		return err
+	}
+	diff, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var version int
+		err := tx.Model(&database.ServerRevision{}).Where("server_id = ?", server.ID).
+			Select("COALESCE(MAX(version), 0)").Row().Scan(&version)
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&database.ServerRevision{
+			ServerID:  server.ID,
+			Version:   version + 1,
+			Action:    action,
+			Username:  username,
+			Snapshot:  string(snapshot),
+			Diff:      string(diff),
+			CreatedAt: time.Now(),
+		}).Error
+	})
+}
+
+// GetRevisions 获取服务器的配置修订历史
+func (s *L2TPService) GetRevisions(serverID uint) ([]database.ServerRevision, error) {
+	var revisions []database.ServerRevision
+	result := s.db.Where("server_id = ?", serverID).Order("version DESC").Find(&revisions)
+	return revisions, result.Error
+}
+
+// RollbackServer 将服务器配置回滚到指定修订版本，返回回滚前后的服务器
+func (s *L2TPService) RollbackServer(serverID uint, version int, username string) (*database.L2TPServer, *database.L2TPServer, error) {
+	var revision database.ServerRevision
+	result := s.db.Where("server_id = ? AND version = ?", serverID, version).First(&revision)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil, fmt.Errorf("修订版本 %d 不存在", version)
+		}
+		return nil, nil, result.Error
+	}
+
+	var config ServerConfig
+	if err := json.Unmarshal([]byte(revision.Snapshot), &config); err != nil {
+		return nil, nil, fmt.Errorf("解析修订快照失败: %v", err)
+	}
+
+	before, err := s.GetServer(serverID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 基于当前记录应用快照，保留运行状态等非配置字段
+	target := *before
+	applyConfig(&target, config)
+
+	if err := s.UpdateServer(serverID, &target); err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.RecordRevision(&target, before, "rollback", username); err != nil {
+		return nil, nil, fmt.Errorf("记录回滚修订失败: %v", err)
+	}
+
+	return before, &target, nil
+}
@@ -5,20 +5,26 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"gorm.io/gorm"
 	"l2tp-manager/internal/database"
 
 	"github.com/xtls/xray-core/app/dispatcher"
+	"github.com/xtls/xray-core/app/policy"
 	"github.com/xtls/xray-core/app/proxyman"
+	"github.com/xtls/xray-core/app/router"
+	xstats "github.com/xtls/xray-core/app/stats"
 	xnet "github.com/xtls/xray-core/common/net"
 	"github.com/xtls/xray-core/common/serial"
 	"github.com/xtls/xray-core/core"
+	"github.com/xtls/xray-core/proxy/blackhole"
 	"github.com/xtls/xray-core/proxy/dokodemo"
 	"github.com/xtls/xray-core/proxy/freedom"
 	
@@ -26,6 +32,15 @@ import (
 	_ "github.com/xtls/xray-core/main/distro/all"
 )
 
+// Forwarding 服务器转发器管理接口，由RoutingService实现，单元测试可替换为模拟实现
+type Forwarding interface {
+	AddL2TPServer(server *database.L2TPServer)
+	RemoveL2TPServer(l2tpPort int)
+	ReloadL2TPServer(oldPort int, server *database.L2TPServer)
+	ForwarderStatus(serverID uint) (string, bool)
+	UpdateServerStatus(serverID uint, status string)
+}
+
 // RoutingService Xray-core驱动的路由服务
 type RoutingService struct {
 	db             *gorm.DB
@@ -34,9 +49,25 @@ type RoutingService struct {
 	trafficStats   map[string]*TrafficStats // 流量统计
 	statsMutex     sync.RWMutex
 	xrayInstances  map[int]*core.Instance    // 端口 -> Xray实例
+	pipeline       *TrafficPipeline          // 流量日志采集管道
+	throughput     map[int]ThroughputSample  // 监听端口 -> 最近一秒的吞吐量，受statsMutex保护
+	hopProbes      map[uint]HopProbe         // 服务器ID -> 到下一跳的探测结果，受statsMutex保护
+	wsManager      *WSManager                // 推送实时吞吐量
+	agents         *AgentHub                 // 向中转节点下发转发配置
+	proxies        map[uint]*database.ProxyInbound // 代理ID -> 代理入站，受serverMutex保护
+	proxyRuntimes  map[uint]*proxyRuntime          // 代理ID -> 运行状态，受serverMutex保护
+	forwardMode    string                          // 配置的转发模式
+	kernel         *kernelForwarder                // 内核转发，未启用或不可用时为nil
+	kernelPorts    map[int]kernelForward           // 监听端口 -> 内核转发，受serverMutex保护
+	knock          atomic.Pointer[knockGate]       // 端口敲门规则，首个启用敲门的服务器启动时初始化
+	geoip          *GeoIPDatabase                  // 执行国家访问策略，未加载时为nil
+	resolver       *hostResolver                   // 落地机域名解析缓存
+	resources      *ResourceMonitor                // 面板主机资源，资源即将耗尽时拒绝启动新的转发器，为nil时不检查
+	settings       *SettingsService                // 监控间隔和超时，为nil时使用默认值
 	ctx            context.Context
 	cancel         context.CancelFunc
 	wg             sync.WaitGroup
+	started        atomic.Bool
 }
 
 // XrayForwarder Xray转发器
@@ -58,13 +89,21 @@ type TrafficStats struct {
 	mutex           sync.RWMutex
 }
 
-// NewRoutingService 创建路由服务
-func NewRoutingService() *RoutingService {
+// NewRoutingService 创建路由服务，wsManager用于推送实时吞吐量，为nil时不推送(如中转节点)
+func NewRoutingService(wsManager *WSManager) *RoutingService {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &RoutingService{
 		servers:       make(map[int]*database.L2TPServer),
 		trafficStats:  make(map[string]*TrafficStats),
+		throughput:    make(map[int]ThroughputSample),
+		hopProbes:     make(map[uint]HopProbe),
 		xrayInstances: make(map[int]*core.Instance),
+		proxies:       make(map[uint]*database.ProxyInbound),
+		proxyRuntimes: make(map[uint]*proxyRuntime),
+		forwardMode:   ForwardModeUserspace,
+		kernelPorts:   make(map[int]kernelForward),
+		resolver:      &hostResolver{hosts: make(map[string]hostResolution)},
+		wsManager:     wsManager,
 		ctx:           ctx,
 		cancel:        cancel,
 	}
@@ -73,48 +112,158 @@ func NewRoutingService() *RoutingService {
 // SetDatabase 设置数据库连接
 func (r *RoutingService) SetDatabase(db *gorm.DB) {
 	r.db = db
-	r.loadServers()
+	if err := r.loadServers(r.ctx); err != nil {
+		slog.Error("加载服务器配置失败", "error", err)
+	}
+}
+
+// SetTrafficPipeline 设置流量日志采集管道
+func (r *RoutingService) SetTrafficPipeline(pipeline *TrafficPipeline) {
+	r.pipeline = pipeline
+}
+
+// SetResourceMonitor 设置面板主机资源监控，启动转发器前检查内存和文件描述符
+func (r *RoutingService) SetResourceMonitor(monitor *ResourceMonitor) {
+	r.resources = monitor
+}
+
+// checkCapacity 主机资源即将耗尽时返回错误
+func (r *RoutingService) checkCapacity() error {
+	if r.resources == nil {
+		return nil
+	}
+	return r.resources.CheckCapacity()
+}
+
+// SetAgentHub 设置中转节点管理，服务器变更后向相关节点下发配置
+func (r *RoutingService) SetAgentHub(hub *AgentHub) {
+	r.agents = hub
 }
 
-// Start 启动路由服务
-func (r *RoutingService) Start() {
-	log.Println("启动Xray-core UDP转发服务...")
+// notifyAgents 通知中转节点管理重新下发配置(异步，不阻塞调用方)
+func (r *RoutingService) notifyAgents() {
+	if r.agents != nil {
+		r.agents.Notify()
+	}
+}
+
+// Start 启动路由服务，加载服务器配置并启动运行中服务器的转发器后返回。无法加载服务器配置时返回错误，
+// ctx用于限制加载配置的等待时间
+func (r *RoutingService) Start(ctx context.Context) error {
+	slog.Info("启动Xray-core UDP转发服务")
 	
+	// 内核转发模式下先初始化iptables规则链
+	r.initKernelForwarder()
+
 	// 加载服务器配置
-	r.loadServers()
+	if err := r.loadServers(ctx); err != nil {
+		return fmt.Errorf("加载服务器配置失败: %w", err)
+	}
 	
 	// 启动所有活跃服务器的转发器
 	r.serverMutex.RLock()
-	for port, server := range r.servers {
+	for _, server := range r.servers {
 		if server.Status == "running" {
-			r.startXrayForwarder(port, server)
+			r.startServerForwarders(server)
 		}
 	}
 	r.serverMutex.RUnlock()
+
+	// 启动代理入站
+	r.loadProxies()
+	r.serverMutex.Lock()
+	for id := range r.proxies {
+		r.applyProxy(id)
+	}
+	r.serverMutex.Unlock()
 	
 	// 启动监控协程
-	r.wg.Add(1)
+	r.wg.Add(2)
 	go r.monitorRoutine()
+	go r.streamThroughput()
+	if r.kernel != nil {
+		r.wg.Add(1)
+		go r.monitorKernelTraffic()
+	}
 	
-	log.Println("Xray-core UDP转发服务启动完成")
+	r.started.Store(true)
+	slog.Info("Xray-core UDP转发服务启动完成")
+	return nil
+}
+
+// Started 路由服务是否已完成启动
+func (r *RoutingService) Started() bool {
+	return r.started.Load()
+}
+
+// ForwarderCount 当前运行的转发器数量
+func (r *RoutingService) ForwarderCount() int {
+	r.serverMutex.RLock()
+	defer r.serverMutex.RUnlock()
+	return len(r.xrayInstances) + len(r.kernelPorts)
+}
+
+// Reload 从数据库重新加载全部服务器并重建转发器(用于数据恢复后)
+func (r *RoutingService) Reload() {
+	slog.Info("重新加载路由服务")
+
+	r.serverMutex.Lock()
+	for _, server := range r.servers {
+		r.stopServerForwarders(server, true)
+	}
+	for id := range r.proxies {
+		r.stopProxy(id)
+	}
+	r.serverMutex.Unlock()
+
+	if err := r.loadServers(r.ctx); err != nil {
+		slog.Error("加载服务器配置失败", "error", err)
+	}
+	r.loadProxies()
+
+	r.serverMutex.Lock()
+	for _, server := range r.servers {
+		if server.Status == "running" {
+			r.startServerForwarders(server)
+		}
+	}
+	for id := range r.proxies {
+		r.applyProxy(id)
+	}
+	r.serverMutex.Unlock()
+
+	r.notifyAgents()
+	slog.Info("路由服务重新加载完成")
 }
 
 // Stop 停止路由服务
 func (r *RoutingService) Stop() {
-	log.Println("正在停止Xray-core UDP转发服务...")
+	slog.Info("正在停止Xray-core UDP转发服务")
 	
+	r.started.Store(false)
 	r.cancel()
 	
 	// 停止所有Xray实例
 	for port, instance := range r.xrayInstances {
 		if instance != nil {
 			instance.Close()
-			log.Printf("停止端口 %d 的Xray实例", port)
+			slog.Info("停止Xray实例", "port", port)
 		}
 	}
+	for id := range r.proxyRuntimes {
+		r.stopProxy(id)
+	}
+	// 删除内核转发规则，崩溃退出时遗留的规则在下次启动时清空
+	if r.kernel != nil {
+		r.kernel.cleanup()
+		r.kernelPorts = make(map[int]kernelForward)
+	}
+	if gate := r.knock.Load(); gate != nil {
+		gate.cleanup()
+	}
 	
 	r.wg.Wait()
-	log.Println("Xray-core UDP转发服务已停止")
+	slog.Info("Xray-core UDP转发服务已停止")
 }
 
 // startXrayForwarder 启动Xray转发器
@@ -126,16 +275,19 @@ func (r *RoutingService) startXrayForwarder(listenPort int, server *database.L2T
 	
 	// 检查是否已存在并清理
 	if instance, exists := r.xrayInstances[listenPort]; exists {
-		log.Printf("端口 %d 的Xray实例已存在，先停止旧实例", listenPort)
+		slog.Info("Xray实例已存在，先停止旧实例", "port", listenPort)
 		if instance != nil {
 			if err := instance.Close(); err != nil {
-				log.Printf("关闭旧Xray实例失败: %v", err)
+				slog.Error("关闭旧Xray实例失败", "error", err)
 			}
 		}
 		delete(r.xrayInstances, listenPort)
 	}
 	
-	// 创建流量统计（估算模式）
+	rule := forwardRuleFor(server, listenPort)
+	targetHost, targetPort := forwardTarget(server, rule)
+
+	// 创建流量统计
 	statsKey := fmt.Sprintf("%s:%d", server.Host, listenPort)
 	r.statsMutex.Lock()
 	if _, exists := r.trafficStats[statsKey]; !exists {
@@ -145,12 +297,31 @@ func (r *RoutingService) startXrayForwarder(listenPort int, server *database.L2T
 	}
 	r.statsMutex.Unlock()
 	
+	// 国家访问策略：按客户端来源地址路由到丢弃出站
+	var blockRule *router.RoutingRule
+	if server.GeoIPMode != "" {
+		var err error
+		if blockRule, err = r.geoip.blockRule(server.GeoIPMode, server.GeoIPCountries); err != nil {
+			return err
+		}
+	}
+
 	// 创建Xray配置
 	config := &core.Config{
 		App: []*serial.TypedMessage{
 			serial.ToTypedMessage(&dispatcher.Config{}),
 			serial.ToTypedMessage(&proxyman.InboundConfig{}),
 			serial.ToTypedMessage(&proxyman.OutboundConfig{}),
+			// 启用入站流量计数器，用于采集真实转发流量
+			serial.ToTypedMessage(&xstats.Config{}),
+			serial.ToTypedMessage(&policy.Config{
+				System: &policy.SystemPolicy{
+					Stats: &policy.SystemPolicy_Stats{
+						InboundUplink:   true,
+						InboundDownlink: true,
+					},
+				},
+			}),
 		},
 		Inbound: []*core.InboundHandlerConfig{
 			{
@@ -162,10 +333,10 @@ func (r *RoutingService) startXrayForwarder(listenPort int, server *database.L2T
 					Listen: xnet.NewIPOrDomain(xnet.AnyIP),
 				}),
 				ProxySettings: serial.ToTypedMessage(&dokodemo.Config{
-					Address: xnet.NewIPOrDomain(xnet.ParseAddress(server.Host)),
-					Port:    uint32(1701), // 固定转发到1701端口
+					Address: xnet.NewIPOrDomain(xnet.ParseAddress(targetHost)),
+					Port:    uint32(targetPort), // 按协议转发到容器端口，链式转发时为下一跳的同一端口
 					NetworkList: &xnet.NetworkList{
-						Network: []xnet.Network{xnet.Network_UDP, xnet.Network_TCP}, // 支持TCP和UDP
+						Network: rule.Networks,
 					},
 					FollowRedirect: false,
 				}),
@@ -180,6 +351,13 @@ func (r *RoutingService) startXrayForwarder(listenPort int, server *database.L2T
 			},
 		},
 	}
+	if blockRule != nil {
+		config.App = append(config.App, serial.ToTypedMessage(&router.Config{Rule: []*router.RoutingRule{blockRule}}))
+		config.Outbound = append(config.Outbound, &core.OutboundHandlerConfig{
+			Tag:           geoIPBlockTag,
+			ProxySettings: serial.ToTypedMessage(&blackhole.Config{}),
+		})
+	}
 	
 	// 创建Xray实例
 	instance, err := core.New(config)
@@ -191,23 +369,23 @@ func (r *RoutingService) startXrayForwarder(listenPort int, server *database.L2T
 	if err := instance.Start(); err != nil {
 		// 确保清理失败的实例
 		if closeErr := instance.Close(); closeErr != nil {
-			log.Printf("清理失败的Xray实例出错: %v", closeErr)
+			slog.Error("清理失败的Xray实例出错", "error", closeErr)
 		}
 		return fmt.Errorf("启动Xray实例失败: %v", err)
 	}
 	
 	// 验证实例是否正常运行
-	if err := r.verifyXrayInstance(listenPort, 3*time.Second); err != nil {
+	if err := r.verifyXrayInstance(listenPort, r.xrayVerifyTimeout()); err != nil {
 		instance.Close()
 		return fmt.Errorf("验证Xray实例失败: %v", err)
 	}
 	
 	r.xrayInstances[listenPort] = instance
 	
-	log.Printf("Xray转发器启动成功: 0.0.0.0:%d -> %s:1701", listenPort, server.Host)
+	slog.Info("Xray转发器启动成功", "protocol", rule.Protocol, "port", listenPort, "host", targetHost, "target_port", targetPort)
 	
 	// 启动流量监控协程
-	go r.monitorTraffic(statsKey, listenPort)
+	go r.monitorTraffic(statsKey, listenPort, server.ID, rule.TargetPort, instance)
 	
 	return nil
 }
@@ -216,19 +394,19 @@ func (r *RoutingService) startXrayForwarder(listenPort int, server *database.L2T
 func (r *RoutingService) stopXrayForwarder(listenPort int) error {
 	instance, exists := r.xrayInstances[listenPort]
 	if !exists {
-		log.Printf("警告: 端口 %d 的Xray实例不存在，可能已被清理", listenPort)
+		slog.Warn("Xray实例不存在，可能已被清理", "port", listenPort)
 		return nil // 不返回错误，因为目标已达成
 	}
 	
 	if instance != nil {
 		if err := instance.Close(); err != nil {
-			log.Printf("关闭端口 %d 的Xray实例时出错: %v", listenPort, err)
+			slog.Error("关闭Xray实例时出错", "port", listenPort, "error", err)
 			// 即使关闭失败，也要清理映射
 		}
 	}
 	
 	delete(r.xrayInstances, listenPort)
-	log.Printf("Xray转发器已停止: :%d", listenPort)
+	slog.Info("Xray转发器已停止", "port", listenPort)
 	
 	// 等待一段时间确保端口释放
 	time.Sleep(100 * time.Millisecond)
@@ -236,6 +414,70 @@ func (r *RoutingService) stopXrayForwarder(listenPort int) error {
 	return nil
 }
 
+// startServerForwarders 启动服务器全部协议的转发器，指定了中转节点的服务器由节点转发，面板主机资源即将耗尽时不启动
+func (r *RoutingService) startServerForwarders(server *database.L2TPServer) error {
+	if server.RelayNodeID != 0 {
+		return nil
+	}
+	// 链式转发的下一跳地址未知时不启动，避免绕过中转节点直连落地机
+	if server.ChainNodes != "" && server.NextHop == "" {
+		return fmt.Errorf("链式转发的下一跳中转节点地址未知")
+	}
+	if err := r.checkCapacity(); err != nil {
+		return err
+	}
+	// 启用端口敲门的服务器先添加敲门规则，失败时不启动，避免端口对所有地址开放
+	if server.KnockEnabled {
+		if err := r.addKnockGate(server); err != nil {
+			return fmt.Errorf("添加端口敲门规则失败: %v", err)
+		}
+	}
+	var firstErr error
+	for _, rule := range ForwardRules(server) {
+		if err := r.startForwarder(rule.ListenPort, server); err != nil {
+			slog.Error("启动转发器失败", "server_id", server.ID, "protocol", rule.Protocol, "error", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	if server.Obfuscation != "" {
+		if err := r.startObfuscation(server); err != nil {
+			slog.Error("启动混淆入口失败", "server_id", server.ID, "error", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// stopServerForwarders 停止服务器全部协议的转发器并清理流量统计。
+// 清理流量统计(删除服务器或修改配置)时同时删除敲门规则，仅停止或重启转发器时保留，已敲门的地址无需重新敲门
+func (r *RoutingService) stopServerForwarders(server *database.L2TPServer, clearStats bool) {
+	if clearStats {
+		r.removeKnockGate(server.ID)
+	}
+	for _, rule := range ForwardRules(server) {
+		if err := r.stopForwarder(rule.ListenPort); err != nil {
+			slog.Error("停止转发器失败", "port", rule.ListenPort, "error", err)
+		}
+		if clearStats {
+			r.statsMutex.Lock()
+			delete(r.trafficStats, fmt.Sprintf("%s:%d", server.Host, rule.ListenPort))
+			r.statsMutex.Unlock()
+		}
+	}
+	if server.Obfuscation != "" {
+		r.stopXrayForwarder(server.ObfuscationPort)
+		if clearStats {
+			r.statsMutex.Lock()
+			delete(r.trafficStats, fmt.Sprintf("%s:%d", server.Host, server.ObfuscationPort))
+			r.statsMutex.Unlock()
+		}
+	}
+}
+
 // updateStats 更新流量统计
 func (r *RoutingService) updateStats(statsKey string, bytesSent, bytesReceived, packetsSent, packetsReceived int64) {
 	r.statsMutex.Lock()
@@ -254,19 +496,23 @@ func (r *RoutingService) updateStats(statsKey string, bytesSent, bytesReceived,
 
 // AddL2TPServer 添加L2TP服务器
 func (r *RoutingService) AddL2TPServer(server *database.L2TPServer) {
+	r.prefetchHost(server)
 	r.serverMutex.Lock()
 	defer r.serverMutex.Unlock()
 	
+	r.resolveNextHop(server, nil)
+	r.resolveExit(server)
 	r.servers[server.L2TPPort] = server
-	log.Printf("添加服务器到路由服务: %s (%s:%d)", 
-		server.Name, server.Host, server.L2TPPort)
+	slog.Info("添加服务器到路由服务", "name", server.Name, "host", server.Host, "port", server.L2TPPort)
+	defer r.notifyAgents()
 	
 	// 如果服务器状态为运行中，立即启动转发器
 	if server.Status == "running" {
-		if err := r.startXrayForwarder(server.L2TPPort, server); err != nil {
-			log.Printf("启动新服务器转发器失败: %v", err)
+		if err := r.startServerForwarders(server); err != nil {
+			slog.Error("启动新服务器转发器失败", "error", err)
 		}
 	}
+	r.applyExitProxies(server.ID)
 }
 
 // RemoveL2TPServer 移除L2TP服务器
@@ -275,25 +521,64 @@ func (r *RoutingService) RemoveL2TPServer(l2tpPort int) {
 	defer r.serverMutex.Unlock()
 	
 	if server, exists := r.servers[l2tpPort]; exists {
-		// 停止转发器
-		if err := r.stopXrayForwarder(l2tpPort); err != nil {
-			log.Printf("停止服务器转发器失败: %v", err)
-		}
+		defer r.notifyAgents()
+
+		// 停止转发器并清理流量统计
+		r.stopServerForwarders(server, true)
 		
 		// 从映射中移除
 		delete(r.servers, l2tpPort)
+		r.applyExitProxies(server.ID)
 		
-		// 清理流量统计
-		statsKey := fmt.Sprintf("%s:%d", server.Host, l2tpPort)
-		r.statsMutex.Lock()
-		delete(r.trafficStats, statsKey)
-		r.statsMutex.Unlock()
-		
-		log.Printf("从路由服务移除服务器: %s (%s:%d)", 
-			server.Name, server.Host, l2tpPort)
+		slog.Info("从路由服务移除服务器", "name", server.Name, "host", server.Host, "port", l2tpPort)
 	}
 }
 
+// ReloadL2TPServer 服务器配置变更后热更新转发器
+func (r *RoutingService) ReloadL2TPServer(oldPort int, server *database.L2TPServer) {
+	r.prefetchHost(server)
+	r.serverMutex.Lock()
+	defer r.serverMutex.Unlock()
+	defer r.notifyAgents()
+
+	updated := *server
+	r.resolveNextHop(&updated, nil)
+	r.resolveExit(&updated)
+
+	needRestart := true
+	if old, exists := r.servers[oldPort]; exists {
+		needRestart = !sameForwardRules(old, &updated)
+		if needRestart {
+			r.stopServerForwarders(old, true)
+		}
+		delete(r.servers, oldPort)
+	}
+
+	r.servers[updated.L2TPPort] = &updated
+
+	if updated.Status == "running" && needRestart {
+		if err := r.startServerForwarders(&updated); err != nil {
+			slog.Error("热更新转发器失败", "server_id", updated.ID, "error", err)
+		} else {
+			slog.Info("转发器已热更新", "server_id", updated.ID, "port", updated.L2TPPort, "host", updated.Host)
+		}
+	}
+	r.applyExitProxies(updated.ID)
+}
+
+// ForwarderStatus 获取路由服务中记录的服务器状态
+func (r *RoutingService) ForwarderStatus(serverID uint) (string, bool) {
+	r.serverMutex.RLock()
+	defer r.serverMutex.RUnlock()
+
+	for _, server := range r.servers {
+		if server.ID == serverID {
+			return server.Status, true
+		}
+	}
+	return "", false
+}
+
 // UpdateServerStatus 更新服务器状态
 func (r *RoutingService) UpdateServerStatus(serverID uint, status string) {
 	r.serverMutex.Lock()
@@ -301,38 +586,35 @@ func (r *RoutingService) UpdateServerStatus(serverID uint, status string) {
 	
 	// 查找服务器
 	var targetServer *database.L2TPServer
-	var targetPort int
 	
-	for port, server := range r.servers {
+	for _, server := range r.servers {
 		if server.ID == serverID {
 			targetServer = server
-			targetPort = port
 			break
 		}
 	}
 	
 	if targetServer == nil {
-		log.Printf("警告: 找不到服务器 ID %d", serverID)
+		slog.Warn("找不到服务器", "server_id", serverID)
 		return
 	}
 	
 	// 更新状态
 	targetServer.Status = status
+	defer r.notifyAgents()
 	
 	// 根据状态启动或停止转发器
 	if status == "running" {
-		if err := r.startXrayForwarder(targetPort, targetServer); err != nil {
-			log.Printf("启动服务器 %d 转发器失败: %v", serverID, err)
+		if err := r.startServerForwarders(targetServer); err != nil {
+			slog.Error("启动服务器转发器失败", "server_id", serverID, "error", err)
 		} else {
-			log.Printf("服务器 %d Xray转发器已启动", serverID)
+			slog.Info("服务器Xray转发器已启动", "server_id", serverID)
 		}
 	} else if status == "stopped" {
-		if err := r.stopXrayForwarder(targetPort); err != nil {
-			log.Printf("停止服务器 %d 转发器失败: %v", serverID, err)
-		} else {
-			log.Printf("服务器 %d Xray转发器已停止", serverID)
-		}
+		r.stopServerForwarders(targetServer, false)
+		slog.Info("服务器Xray转发器已停止", "server_id", serverID)
 	}
+	r.applyExitProxies(serverID)
 	
 	// 更新数据库中的服务器信息
 	if r.db != nil {
@@ -341,15 +623,17 @@ func (r *RoutingService) UpdateServerStatus(serverID uint, status string) {
 }
 
 // loadServers 加载服务器配置
-func (r *RoutingService) loadServers() {
+func (r *RoutingService) loadServers(ctx context.Context) error {
 	if r.db == nil {
-		return
+		return nil
 	}
 	
 	var servers []database.L2TPServer
-	if err := r.db.Find(&servers).Error; err != nil {
-		log.Printf("加载服务器配置失败: %v", err)
-		return
+	if err := r.db.WithContext(ctx).Find(&servers).Error; err != nil {
+		return err
+	}
+	for i := range servers {
+		r.prefetchHost(&servers[i])
 	}
 	
 	r.serverMutex.Lock()
@@ -359,14 +643,17 @@ func (r *RoutingService) loadServers() {
 	r.servers = make(map[int]*database.L2TPServer)
 	
 	// 加载服务器
+	addresses := r.relayAddresses()
 	for i := range servers {
 		server := &servers[i]
+		r.resolveNextHop(server, addresses)
+		r.resolveExit(server)
 		r.servers[server.L2TPPort] = server
-		log.Printf("加载服务器: %s (0.0.0.0:%d -> %s:1701)", 
-			server.Name, server.L2TPPort, server.Host)
+		slog.Debug("加载服务器", "name", server.Name, "port", server.L2TPPort, "host", server.Host)
 	}
 	
-	log.Printf("已加载 %d 个服务器配置", len(servers))
+	slog.Info("已加载服务器配置", "count", len(servers))
+	return nil
 }
 
 // GetTrafficStats 获取流量统计
@@ -391,6 +678,82 @@ func (r *RoutingService) GetTrafficStats() map[string]*TrafficStats {
 	return stats
 }
 
+// ActiveForwardRules 正在运行的转发器对应的转发规则
+func (r *RoutingService) ActiveForwardRules() []ForwardRule {
+	r.serverMutex.RLock()
+	defer r.serverMutex.RUnlock()
+
+	var rules []ForwardRule
+	seen := make(map[int]bool)
+	for _, server := range r.servers {
+		for _, rule := range ForwardRules(server) {
+			_, running := r.xrayInstances[rule.ListenPort]
+			if _, kernel := r.kernelPorts[rule.ListenPort]; kernel {
+				running = true
+			}
+			if running && !seen[rule.ListenPort] {
+				seen[rule.ListenPort] = true
+				rules = append(rules, rule)
+			}
+		}
+	}
+	return rules
+}
+
+// AgentServers 指定中转节点应运行的转发配置(状态为运行中且以该节点为入口或途经该节点的服务器)，按服务器ID排序。
+// 链式转发中各节点转发到下一跳节点的同一监听端口，最后一个节点转发到落地机；下一跳地址未知时不下发
+func (r *RoutingService) AgentServers(nodeID uint) []AgentServer {
+	r.serverMutex.RLock()
+	defer r.serverMutex.RUnlock()
+
+	servers := []AgentServer{}
+	var addresses map[uint]string
+	for _, server := range r.servers {
+		if server.Status != "running" {
+			continue
+		}
+		hops, _ := parseChainNodes(server.ChainNodes)
+		position := -1
+		if server.RelayNodeID == nodeID {
+			position = 0
+		}
+		for i, id := range hops {
+			if id == nodeID {
+				position = i + 1
+			}
+		}
+		if position < 0 {
+			continue
+		}
+
+		agent := agentServerOf(server)
+		agent.Hop = position
+		if position > 0 {
+			// 后续节点只能看到上一跳的地址，国家访问策略由入口执行
+			agent.GeoIPMode, agent.GeoIPCountries = "", ""
+		}
+		if position < len(hops) {
+			if addresses == nil {
+				addresses = r.relayAddresses()
+			}
+			if agent.NextHop = addresses[hops[position]]; agent.NextHop == "" {
+				continue
+			}
+		}
+		servers = append(servers, agent)
+	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].ID < servers[j].ID })
+	return servers
+}
+
+// ActiveClientCount 指定时间之后出现过的不同客户端数，指定ports时只统计这些监听端口，未设置流量管道时为0
+func (r *RoutingService) ActiveClientCount(since time.Time, ports ...int) int {
+	if r.pipeline == nil {
+		return 0
+	}
+	return r.pipeline.ActiveClientCount(since, ports...)
+}
+
 // IPInfo IP信息结构
 type IPInfo struct {
 	IP       string `json:"ip"`
@@ -409,7 +772,7 @@ func (r *RoutingService) getIPInfo() map[string]interface{} {
 	
 	resp, err := client.Get("https://ipinfo.io")
 	if err != nil {
-		log.Printf("获取IP信息失败: %v", err)
+		slog.Warn("获取IP信息失败", "error", err)
 		return map[string]interface{}{
 			"ip":       "获取失败",
 			"location": "获取失败",
@@ -419,7 +782,7 @@ func (r *RoutingService) getIPInfo() map[string]interface{} {
 	
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		log.Printf("读取IP信息响应失败: %v", err)
+		slog.Warn("读取IP信息响应失败", "error", err)
 		return map[string]interface{}{
 			"ip":       "读取失败",
 			"location": "读取失败",
@@ -428,7 +791,7 @@ func (r *RoutingService) getIPInfo() map[string]interface{} {
 	
 	var ipInfo IPInfo
 	if err := json.Unmarshal(body, &ipInfo); err != nil {
-		log.Printf("解析IP信息失败: %v", err)
+		slog.Warn("解析IP信息失败", "error", err)
 		return map[string]interface{}{
 			"ip":       "解析失败",
 			"location": "解析失败",
@@ -454,42 +817,57 @@ func (r *RoutingService) GetSystemStatus() map[string]interface{} {
 			runningServers++
 		}
 	}
-	activeForwarders := len(r.xrayInstances)
+	activeForwarders := len(r.xrayInstances) + len(r.kernelPorts)
 	r.serverMutex.RUnlock()
+
+	forwarderType := "xray-dokodemo"
+	if r.kernel != nil {
+		forwarderType = "iptables-dnat"
+	}
 	
 	// 获取IP信息
 	ipInfo := r.getIPInfo()
 	
-	return map[string]interface{}{
+	status := map[string]interface{}{
 		"total_servers":      totalServers,
 		"running_servers":    runningServers,
 		"active_forwarders":  activeForwarders,
 		"active_connections": r.GetActiveConnections(),
-		"forwarder_type":     "xray-dokodemo",
+		"forwarder_type":     forwarderType,
+		"forward_mode":       r.ForwardMode(),
 		"protocol_support":   []string{"UDP", "TCP", "L2TP", "IPSec"},
 		"fullcone_nat":       true,
 		"ip":                 ipInfo["ip"],
 		"location":           ipInfo["location"],
 	}
+	if r.resources != nil {
+		status["resources"] = r.resources.Snapshot()
+	}
+	return status
 }
 
-// monitorRoutine 监控协程
+// monitorRoutine 监控协程，按设置的间隔检查，间隔修改后立即生效
 func (r *RoutingService) monitorRoutine() {
 	defer r.wg.Done()
 	
-	ticker := time.NewTicker(15 * time.Second) // 更频繁的健康检查
-	defer ticker.Stop()
-	
-	log.Println("Xray实例监控协程已启动")
+	changed := r.settingsChanged(SettingXrayCheckInterval)
+	slog.Info("Xray实例监控协程已启动")
 	
 	for {
+		timer := newIntervalTimer(r.xrayCheckInterval())
 		select {
 		case <-r.ctx.Done():
-			log.Println("Xray实例监控协程正在退出")
+			timer.Stop()
+			slog.Info("Xray实例监控协程正在退出")
 			return
-		case <-ticker.C:
-			// 定期检查服务器状态和Xray实例健康状况
+		case <-changed:
+			timer.Stop()
+		case <-timer.C:
+			// 定期检查服务器状态和Xray实例健康状况，并探测各转发链路的下一跳
+			r.refreshChainHops()
+			r.refreshExitAddresses()
 			r.checkXrayInstances()
+			r.probeHops()
 		}
 	}
 }
@@ -499,49 +877,63 @@ func (r *RoutingService) checkXrayInstances() {
 	r.serverMutex.RLock()
 	defer r.serverMutex.RUnlock()
 	
-	for port, server := range r.servers {
-		if server.Status == "running" {
+	for _, server := range r.servers {
+		if server.Status != "running" || server.RelayNodeID != 0 {
+			continue
+		}
+		for _, rule := range ForwardRules(server) {
+			port := rule.ListenPort
+			if _, kernel := r.kernelPorts[port]; kernel {
+				// 防火墙重载等操作可能清空规则，缺失时重新添加
+				if !r.kernel.present(port) {
+					slog.Warn("检测到内核转发规则缺失，重新添加", "port", port)
+					if err := r.startForwarder(port, server); err != nil {
+						slog.Error("重新添加内核转发规则失败", "port", port, "error", err)
+					}
+				}
+				continue
+			}
 			if instance, exists := r.xrayInstances[port]; !exists || instance == nil {
-				log.Printf("检测到端口 %d 的Xray实例异常，尝试重启", port)
+				slog.Warn("检测到Xray实例异常，尝试重启", "port", port)
 				if err := r.startXrayForwarder(port, server); err != nil {
-					log.Printf("重启端口 %d 的Xray实例失败: %v", port, err)
+					slog.Error("重启Xray实例失败", "port", port, "error", err)
 				}
 			} else {
 				// 检查端口是否仍然可用（实例可能异常但未清理）
-				if err := r.verifyXrayInstance(port, 1*time.Second); err != nil {
-					log.Printf("端口 %d 的Xray实例健康检查失败，尝试重启: %v", port, err)
+				if err := r.verifyXrayInstance(port, r.xrayCheckTimeout()); err != nil {
+					slog.Warn("Xray实例健康检查失败，尝试重启", "port", port, "error", err)
 					instance.Close()
 					delete(r.xrayInstances, port)
 					if err := r.startXrayForwarder(port, server); err != nil {
-						log.Printf("重启端口 %d 的Xray实例失败: %v", port, err)
+						slog.Error("重启Xray实例失败", "port", port, "error", err)
 					}
 				}
 			}
 		}
+		if server.Obfuscation != "" && r.xrayInstances[server.ObfuscationPort] == nil {
+			slog.Warn("检测到混淆入口异常，尝试重启", "port", server.ObfuscationPort)
+			if err := r.startObfuscation(server); err != nil {
+				slog.Error("重启混淆入口失败", "port", server.ObfuscationPort, "error", err)
+			}
+		}
 	}
 }
 
-// checkPortAvailable 检查端口是否可用
+// checkPortAvailable 检查端口是否可用。与Xray监听套接字一样设置SO_REUSEPORT，
+// 平滑重启时上一进程交接的套接字不会被误判为占用
 func (r *RoutingService) checkPortAvailable(port int) error {
+	lc := net.ListenConfig{Control: setReusePort}
+	address := fmt.Sprintf(":%d", port)
+
 	// 检查UDP端口
-	udpAddr, err := net.ResolveUDPAddr("udp", fmt.Sprintf(":%d", port))
-	if err != nil {
-		return err
-	}
-	
-	udpConn, err := net.ListenUDP("udp", udpAddr)
+	udpConn, err := lc.ListenPacket(context.Background(), "udp", address)
 	if err != nil {
 		return fmt.Errorf("UDP端口 %d 被占用", port)
 	}
 	udpConn.Close()
 	
 	// 检查TCP端口
-	tcpAddr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf(":%d", port))
-	if err != nil {
-		return err
-	}
-	
-	tcpListener, err := net.ListenTCP("tcp", tcpAddr)
+	tcpListener, err := lc.Listen(context.Background(), "tcp", address)
 	if err != nil {
 		return fmt.Errorf("TCP端口 %d 被占用", port)
 	}
@@ -569,33 +961,73 @@ func (r *RoutingService) verifyXrayInstance(port int, timeout time.Duration) err
 	return nil
 }
 
-// monitorTraffic 监控流量（估算模式）
-func (r *RoutingService) monitorTraffic(statsKey string, port int) {
-	ticker := time.NewTicker(10 * time.Second)
+// monitorTraffic 每秒读取Xray入站计数器记录实时吞吐量，并周期性汇总流量统计，实例被替换或停止后退出
+func (r *RoutingService) monitorTraffic(statsKey string, port int, serverID uint, targetPort int, instance *core.Instance) {
+	ticker := time.NewTicker(throughputInterval)
 	defer ticker.Stop()
 	
+	// 端口最近一次空闲的时间，此后出现的客户端视为仍在会话中
+	activeSince := time.Now()
+	lastSample := time.Now()
+	var uplink, downlink int64
+	ticks := 0
 	for {
 		select {
 		case <-r.ctx.Done():
 			return
-		case <-ticker.C:
-			// 简单的流量估算（基于连接活跃度）
-			r.estimateTraffic(statsKey, port)
+		case now := <-ticker.C:
+			r.serverMutex.RLock()
+			current := r.xrayInstances[port]
+			r.serverMutex.RUnlock()
+			if current != instance {
+				return
+			}
+
+			up, down := readTrafficCounters(port, instance)
+			r.recordThroughput(serverID, port, up, down, now.Sub(lastSample))
+			lastSample = now
+			uplink += up
+			downlink += down
+
+			if ticks++; ticks < r.trafficCollectTicks() {
+				continue
+			}
+			if r.collectTraffic(statsKey, port, serverID, targetPort, uplink, downlink, activeSince) == 0 {
+				activeSince = time.Now()
+			}
+			uplink, downlink, ticks = 0, 0, 0
 		}
 	}
 }
 
-// estimateTraffic 估算流量数据
-func (r *RoutingService) estimateTraffic(statsKey string, port int) {
-	r.statsMutex.Lock()
-	defer r.statsMutex.Unlock()
-	
-	if stats, exists := r.trafficStats[statsKey]; exists {
-		stats.mutex.Lock()
-		// 模拟流量增长（实际应该基于实际监控数据）
-		stats.LastUpdate = time.Now()
-		stats.mutex.Unlock()
+// collectTraffic 汇总一个周期内的上下行字节数，更新统计并发布流量记录，返回本周期字节数
+func (r *RoutingService) collectTraffic(statsKey string, port int, serverID uint, targetPort int, uplink, downlink int64, activeSince time.Time) int64 {
+	// 上行为客户端发往落地机，下行为落地机返回客户端
+	r.updateStats(statsKey, uplink, downlink, 0, 0)
+
+	total := uplink + downlink
+	if total == 0 || r.pipeline == nil {
+		return total
+	}
+
+	now := time.Now()
+	// UDP会话只在建立时产生访问日志，因此取端口上次空闲以来出现的全部客户端
+	clients := r.pipeline.ActiveClients(port, activeSince.Add(-time.Minute))
+	// 计数器按端口统计，只有一个客户端时才能确定流量归属；
+	// 多个客户端时无法区分各自的流量，记为不带客户端IP的端口流量
+	clientIP := ""
+	if len(clients) == 1 {
+		clientIP = clients[0]
 	}
+	r.pipeline.Publish(FlowRecord{
+		ServerID: serverID,
+		ClientIP: clientIP,
+		SrcPort:  port,
+		DstPort:  targetPort,
+		Bytes:    total,
+		Time:     now,
+	})
+	return total
 }
 
 // GetActiveConnections 获取活跃连接数
@@ -0,0 +1,469 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"l2tp-manager/internal/database"
+
+	xnet "github.com/xtls/xray-core/common/net"
+)
+
+// 转发模式
+const (
+	ForwardModeUserspace = "userspace" // Xray用户态转发(默认)，统计客户端IP和流量
+	ForwardModeKernel    = "kernel"    // iptables DNAT内核转发，不经过用户态，吞吐量更高
+)
+
+// 内核转发使用的iptables自定义链，由面板独占：启动时清空上次进程(包括崩溃退出的进程)遗留的规则，停止时删除
+const (
+	kernelDNATChain    = "L2TPM-DNAT" // nat表，由PREROUTING跳转
+	kernelSNATChain    = "L2TPM-SNAT" // nat表，由POSTROUTING跳转
+	kernelForwardChain = "L2TPM-FWD"  // filter表，由FORWARD跳转，同时用于流量计数
+	kernelRuleComment  = "l2tp-manager"
+
+	kernelIPForwardPath = "/proc/sys/net/ipv4/ip_forward"
+	kernelConntrackPath = "/proc/net/nf_conntrack"
+)
+
+// kernelChains 自定义链及跳转到它的内置链
+var kernelChains = []struct{ table, chain, parent string }{
+	{"nat", kernelDNATChain, "PREROUTING"},
+	{"nat", kernelSNATChain, "POSTROUTING"},
+	{"filter", kernelForwardChain, "FORWARD"},
+}
+
+// kernelCounterPattern 匹配iptables -L -v输出中计数规则的注释，如 /* l2tp-manager:1701:up */
+var kernelCounterPattern = regexp.MustCompile(`/\* ` + kernelRuleComment + `:(\d+):(up|down) \*/`)
+
+// kernelForwarder 通过iptables在中转机内核中转发端口。每条规则都带有面板的注释，
+// 添加的规则按监听端口记录，停止转发时按原样删除
+type kernelForwarder struct {
+	iptables string
+	rules    map[int][][]string // 监听端口 -> 添加规则时的参数(-A ...)
+	counters map[string]int64   // 计数规则注释 -> 上次读取的累计字节数
+	mutex    sync.Mutex
+}
+
+// kernelForward 以内核方式运行的转发端口
+type kernelForward struct {
+	serverID   uint
+	statsKey   string
+	targetPort int
+}
+
+// newKernelForwarder 检查权限和iptables，开启IPv4转发并初始化自定义链，任一步骤失败时返回错误，由调用方改用用户态转发
+func newKernelForwarder() (*kernelForwarder, error) {
+	if os.Geteuid() != 0 {
+		return nil, fmt.Errorf("需要root权限")
+	}
+	path, err := exec.LookPath("iptables")
+	if err != nil {
+		return nil, fmt.Errorf("未找到iptables: %v", err)
+	}
+	if err := os.WriteFile(kernelIPForwardPath, []byte("1"), 0644); err != nil {
+		return nil, fmt.Errorf("开启IPv4转发失败: %v", err)
+	}
+
+	k := &kernelForwarder{
+		iptables: path,
+		rules:    make(map[int][][]string),
+		counters: make(map[string]int64),
+	}
+	for _, c := range kernelChains {
+		// 链已存在时-N失败，随后清空其中遗留的规则
+		k.run("-t", c.table, "-N", c.chain)
+		if _, err := k.run("-t", c.table, "-F", c.chain); err != nil {
+			return nil, err
+		}
+		if _, err := k.run("-t", c.table, "-C", c.parent, "-j", c.chain); err != nil {
+			if _, err := k.run("-t", c.table, "-I", c.parent, "1", "-j", c.chain); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return k, nil
+}
+
+// run 执行iptables命令，-w等待其他程序释放xtables锁
+func (k *kernelForwarder) run(args ...string) (string, error) {
+	output, err := exec.Command(k.iptables, append([]string{"-w"}, args...)...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("iptables %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return string(output), nil
+}
+
+// cleanup 删除全部自定义链及其跳转规则
+func (k *kernelForwarder) cleanup() {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	for _, c := range kernelChains {
+		for {
+			if _, err := k.run("-t", c.table, "-D", c.parent, "-j", c.chain); err != nil {
+				break
+			}
+		}
+		k.run("-t", c.table, "-F", c.chain)
+		if _, err := k.run("-t", c.table, "-X", c.chain); err != nil {
+			slog.Warn("删除内核转发规则链失败", "chain", c.chain, "error", err)
+		}
+	}
+	k.rules = make(map[int][][]string)
+	k.counters = make(map[string]int64)
+}
+
+// kernelRuleSpecs 生成监听端口的转发规则：DNAT到落地机、回程MASQUERADE，以及放行并分别统计上下行的FORWARD规则
+func kernelRuleSpecs(listenPort int, targetIP string, targetPort int, networks []xnet.Network) [][]string {
+	comment := fmt.Sprintf("%s:%d", kernelRuleComment, listenPort)
+	listen, target := strconv.Itoa(listenPort), strconv.Itoa(targetPort)
+
+	var specs [][]string
+	for _, network := range networks {
+		proto := strings.ToLower(network.SystemString())
+		specs = append(specs,
+			[]string{"-t", "nat", "-A", kernelDNATChain, "-p", proto, "--dport", listen,
+				"-m", "addrtype", "--dst-type", "LOCAL",
+				"-m", "comment", "--comment", comment,
+				"-j", "DNAT", "--to-destination", net.JoinHostPort(targetIP, target)},
+			[]string{"-t", "nat", "-A", kernelSNATChain, "-p", proto, "-d", targetIP, "--dport", target,
+				"-m", "conntrack", "--ctstate", "DNAT", "--ctorigdstport", listen,
+				"-m", "comment", "--comment", comment,
+				"-j", "MASQUERADE"},
+			[]string{"-t", "filter", "-A", kernelForwardChain, "-p", proto,
+				"-m", "conntrack", "--ctstate", "DNAT", "--ctorigdstport", listen, "--ctdir", "ORIGINAL",
+				"-m", "comment", "--comment", comment + ":up",
+				"-j", "ACCEPT"},
+			[]string{"-t", "filter", "-A", kernelForwardChain, "-p", proto,
+				"-m", "conntrack", "--ctstate", "DNAT", "--ctorigdstport", listen, "--ctdir", "REPLY",
+				"-m", "comment", "--comment", comment + ":down",
+				"-j", "ACCEPT"},
+		)
+	}
+	return specs
+}
+
+// withAction 将规则参数中的-A替换为指定操作(-C检查、-D删除)
+func withAction(spec []string, action string) []string {
+	args := append([]string{}, spec...)
+	for i, arg := range args {
+		if arg == "-A" {
+			args[i] = action
+			break
+		}
+	}
+	return args
+}
+
+// add 添加监听端口的转发规则，部分失败时撤销已添加的规则
+func (k *kernelForwarder) add(listenPort int, targetIP string, targetPort int, networks []xnet.Network) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.removeLocked(listenPort)
+	specs := kernelRuleSpecs(listenPort, targetIP, targetPort, networks)
+	for i, spec := range specs {
+		if _, err := k.run(spec...); err != nil {
+			for _, added := range specs[:i] {
+				k.run(withAction(added, "-D")...)
+			}
+			return err
+		}
+	}
+	k.rules[listenPort] = specs
+	return nil
+}
+
+// remove 删除监听端口的转发规则
+func (k *kernelForwarder) remove(listenPort int) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.removeLocked(listenPort)
+}
+
+// removeLocked 删除监听端口的转发规则，调用方需持有锁
+func (k *kernelForwarder) removeLocked(listenPort int) {
+	for _, spec := range k.rules[listenPort] {
+		if _, err := k.run(withAction(spec, "-D")...); err != nil {
+			slog.Warn("删除内核转发规则失败", "port", listenPort, "error", err)
+		}
+	}
+	delete(k.rules, listenPort)
+	comment := fmt.Sprintf("%s:%d", kernelRuleComment, listenPort)
+	delete(k.counters, comment+":up")
+	delete(k.counters, comment+":down")
+}
+
+// present 检查监听端口的规则是否仍然全部存在(防火墙重载等操作可能清空规则)
+func (k *kernelForwarder) present(listenPort int) bool {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	specs, exists := k.rules[listenPort]
+	if !exists {
+		return false
+	}
+	for _, spec := range specs {
+		if _, err := k.run(withAction(spec, "-C")...); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// readCounters 读取各监听端口自上次读取以来的上下行字节数。规则重建后计数从零开始，此时取当前值
+func (k *kernelForwarder) readCounters() (map[int][2]int64, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	output, err := k.run("-t", "filter", "-L", kernelForwardChain, "-n", "-v", "-x")
+	if err != nil {
+		return nil, err
+	}
+
+	deltas := make(map[int][2]int64)
+	for _, line := range strings.Split(output, "\n") {
+		match := kernelCounterPattern.FindStringSubmatch(line)
+		fields := strings.Fields(line)
+		if match == nil || len(fields) < 2 {
+			continue
+		}
+		bytes, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		port, _ := strconv.Atoi(match[1])
+		key := fmt.Sprintf("%s:%d:%s", kernelRuleComment, port, match[2])
+		delta := bytes - k.counters[key]
+		if delta < 0 {
+			delta = bytes
+		}
+		k.counters[key] = bytes
+
+		// 同一端口的TCP和UDP规则累加
+		value := deltas[port]
+		if match[2] == "up" {
+			value[0] += delta
+		} else {
+			value[1] += delta
+		}
+		deltas[port] = value
+	}
+	return deltas, nil
+}
+
+// readConntrackClients 从连接跟踪表中读取各监听端口的客户端IP，内核未提供/proc/net/nf_conntrack时返回空
+func readConntrackClients(ports map[int]kernelForward) map[int][]string {
+	clients := make(map[int][]string)
+	file, err := os.Open(kernelConntrackPath)
+	if err != nil {
+		return clients
+	}
+	defer file.Close()
+
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// 每行先是原始方向的src/dst/sport/dport，取第一次出现的值
+		var src string
+		var dport int
+		for _, field := range strings.Fields(scanner.Text()) {
+			if src == "" && strings.HasPrefix(field, "src=") {
+				src = strings.TrimPrefix(field, "src=")
+			}
+			if dport == 0 && strings.HasPrefix(field, "dport=") {
+				dport, _ = strconv.Atoi(strings.TrimPrefix(field, "dport="))
+			}
+		}
+		if _, ok := ports[dport]; !ok || src == "" {
+			continue
+		}
+		key := fmt.Sprintf("%d/%s", dport, src)
+		if !seen[key] {
+			seen[key] = true
+			clients[dport] = append(clients[dport], src)
+		}
+	}
+	return clients
+}
+
+// resolveKernelTarget 解析落地机的IPv4地址，iptables规则只能使用IP
+func resolveKernelTarget(host string) (string, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.To4() == nil {
+			return "", fmt.Errorf("内核转发只支持IPv4落地机")
+		}
+		return ip.String(), nil
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return "", fmt.Errorf("解析落地机地址失败: %v", err)
+	}
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			return ip.String(), nil
+		}
+	}
+	return "", fmt.Errorf("落地机 %s 没有IPv4地址", host)
+}
+
+// SetForwardMode 设置转发模式，需在Start之前调用
+func (r *RoutingService) SetForwardMode(mode string) {
+	r.forwardMode = mode
+}
+
+// ForwardMode 实际使用的转发模式，内核模式初始化失败时为用户态
+func (r *RoutingService) ForwardMode() string {
+	if r.kernel != nil {
+		return ForwardModeKernel
+	}
+	return ForwardModeUserspace
+}
+
+// initKernelForwarder 内核转发模式下初始化iptables规则链，失败时回退到用户态转发
+func (r *RoutingService) initKernelForwarder() {
+	if r.forwardMode != ForwardModeKernel || r.kernel != nil {
+		return
+	}
+	kernel, err := newKernelForwarder()
+	if err != nil {
+		slog.Warn("内核转发不可用，改用Xray用户态转发", "error", err)
+		return
+	}
+	r.kernel = kernel
+	slog.Info("已启用iptables内核转发")
+}
+
+// startForwarder 启动监听端口的转发：内核模式下添加iptables规则，失败时改用Xray用户态转发
+func (r *RoutingService) startForwarder(listenPort int, server *database.L2TPServer) error {
+	// 国家访问策略依赖Xray路由按来源地址过滤，设置了策略的服务器始终使用用户态转发
+	if r.kernel != nil && server.GeoIPMode == "" {
+		err := r.startKernelForwarder(listenPort, server)
+		if err == nil {
+			return nil
+		}
+		slog.Warn("添加内核转发规则失败，该端口改用用户态转发", "port", listenPort, "error", err)
+	}
+	return r.startXrayForwarder(listenPort, server)
+}
+
+// stopForwarder 停止监听端口的转发
+func (r *RoutingService) stopForwarder(listenPort int) error {
+	if _, exists := r.kernelPorts[listenPort]; exists {
+		r.kernel.remove(listenPort)
+		delete(r.kernelPorts, listenPort)
+		slog.Info("内核转发规则已删除", "port", listenPort)
+		return nil
+	}
+	return r.stopXrayForwarder(listenPort)
+}
+
+// startKernelForwarder 添加监听端口的iptables转发规则
+func (r *RoutingService) startKernelForwarder(listenPort int, server *database.L2TPServer) error {
+	rule := forwardRuleFor(server, listenPort)
+	targetHost, targetPort := forwardTarget(server, rule)
+	targetIP, err := resolveKernelTarget(targetHost)
+	if err != nil {
+		return err
+	}
+	// 同一端口此前由用户态转发时先停止，避免监听套接字和DNAT同时存在
+	if _, exists := r.xrayInstances[listenPort]; exists {
+		r.stopXrayForwarder(listenPort)
+	}
+	if err := r.kernel.add(listenPort, targetIP, targetPort, rule.Networks); err != nil {
+		delete(r.kernelPorts, listenPort)
+		return err
+	}
+
+	statsKey := fmt.Sprintf("%s:%d", server.Host, listenPort)
+	r.statsMutex.Lock()
+	if _, exists := r.trafficStats[statsKey]; !exists {
+		r.trafficStats[statsKey] = &TrafficStats{LastUpdate: time.Now()}
+	}
+	r.statsMutex.Unlock()
+
+	r.kernelPorts[listenPort] = kernelForward{serverID: server.ID, statsKey: statsKey, targetPort: rule.TargetPort}
+	slog.Info("内核转发规则已添加", "protocol", rule.Protocol, "port", listenPort, "host", targetIP, "target_port", targetPort)
+	return nil
+}
+
+// monitorKernelTraffic 每秒读取iptables计数器记录各内核转发端口的吞吐量，并周期性汇总流量统计和流量日志
+func (r *RoutingService) monitorKernelTraffic() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(throughputInterval)
+	defer ticker.Stop()
+
+	type portState struct {
+		uplink, downlink int64
+		activeSince      time.Time
+	}
+	states := make(map[int]*portState)
+	lastSample := time.Now()
+	ticks := 0
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case now := <-ticker.C:
+			deltas, err := r.kernel.readCounters()
+			if err != nil {
+				slog.Warn("读取内核转发计数器失败", "error", err)
+				continue
+			}
+
+			r.serverMutex.RLock()
+			ports := make(map[int]kernelForward, len(r.kernelPorts))
+			for port, forward := range r.kernelPorts {
+				ports[port] = forward
+			}
+			r.serverMutex.RUnlock()
+
+			elapsed := now.Sub(lastSample)
+			lastSample = now
+			for port, forward := range ports {
+				state := states[port]
+				if state == nil {
+					state = &portState{activeSince: now}
+					states[port] = state
+				}
+				delta := deltas[port]
+				r.recordThroughput(forward.serverID, port, delta[0], delta[1], elapsed)
+				state.uplink += delta[0]
+				state.downlink += delta[1]
+			}
+			for port := range states {
+				if _, exists := ports[port]; !exists {
+					delete(states, port)
+				}
+			}
+
+			if ticks++; ticks < r.trafficCollectTicks() {
+				continue
+			}
+			ticks = 0
+			if r.pipeline != nil {
+				for port, ips := range readConntrackClients(ports) {
+					r.pipeline.ObserveClients(port, ips)
+				}
+			}
+			for port, state := range states {
+				forward := ports[port]
+				if r.collectTraffic(forward.statsKey, port, forward.serverID, forward.targetPort, state.uplink, state.downlink, state.activeSince) == 0 {
+					state.activeSince = time.Now()
+				}
+				state.uplink, state.downlink = 0, 0
+			}
+		}
+	}
+}
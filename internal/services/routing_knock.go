@@ -0,0 +1,290 @@
+package services
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"l2tp-manager/internal/database"
+)
+
+// 端口敲门使用的iptables自定义链(mangle表，由PREROUTING跳转)，由面板独占，初始化时清空遗留的规则。
+// 放行列表使用xt_recent模块，列表随引用它的最后一条规则删除
+const (
+	knockChain       = "L2TPM-KNOCK"
+	knockRuleComment = "l2tp-manager-knock"
+	knockRecentPath  = "/proc/net/xt_recent/"
+)
+
+// knockRecentName 服务器放行列表在xt_recent中的名称
+func knockRecentName(serverID uint) string {
+	return fmt.Sprintf("l2tpm-knock-%d", serverID)
+}
+
+// knockGate 在中转端口前拦截未敲门的新连接：放行列表中的地址在有效期内可以建立新连接，已建立的连接不受影响。
+// IPv6只添加丢弃规则，敲门只放行IPv4地址
+type knockGate struct {
+	iptables  string
+	ip6tables string                        // 未安装时为空
+	rules     map[uint][][]string           // 服务器ID -> 添加规则时的参数(-A ...)，首个参数为命令
+	sources   map[uint]map[string]time.Time // 服务器ID -> 放行的地址 -> 敲门时间
+	mutex     sync.Mutex
+}
+
+// newKnockGate 检查权限和iptables并初始化自定义链
+func newKnockGate() (*knockGate, error) {
+	if os.Geteuid() != 0 {
+		return nil, fmt.Errorf("需要root权限")
+	}
+	path, err := exec.LookPath("iptables")
+	if err != nil {
+		return nil, fmt.Errorf("未找到iptables: %v", err)
+	}
+	g := &knockGate{
+		iptables: path,
+		rules:    make(map[uint][][]string),
+		sources:  make(map[uint]map[string]time.Time),
+	}
+	if path, err := exec.LookPath("ip6tables"); err == nil {
+		g.ip6tables = path
+	}
+
+	for _, command := range g.commands() {
+		// 链已存在时-N失败，随后清空其中遗留的规则
+		g.run(command, "-t", "mangle", "-N", knockChain)
+		if _, err := g.run(command, "-t", "mangle", "-F", knockChain); err != nil {
+			return nil, err
+		}
+		// 本机发出和已建立的连接不检查
+		for _, spec := range [][]string{
+			{"-t", "mangle", "-A", knockChain, "-i", "lo", "-j", "RETURN"},
+			{"-t", "mangle", "-A", knockChain, "-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-j", "RETURN"},
+		} {
+			if _, err := g.run(command, spec...); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := g.run(command, "-t", "mangle", "-C", "PREROUTING", "-j", knockChain); err != nil {
+			if _, err := g.run(command, "-t", "mangle", "-I", "PREROUTING", "1", "-j", knockChain); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return g, nil
+}
+
+// commands 需要添加规则的iptables命令
+func (g *knockGate) commands() []string {
+	if g.ip6tables == "" {
+		return []string{g.iptables}
+	}
+	return []string{g.iptables, g.ip6tables}
+}
+
+// run 执行iptables命令，-w等待其他程序释放xtables锁
+func (g *knockGate) run(command string, args ...string) (string, error) {
+	output, err := exec.Command(command, append([]string{"-w"}, args...)...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s %s: %v: %s", command, strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return string(output), nil
+}
+
+// knockRuleSpecs 生成服务器的敲门规则：每个中转端口(包括混淆入口)先放行有效期内敲门的地址，再丢弃其他新连接
+func (g *knockGate) knockRuleSpecs(server *database.L2TPServer) [][]string {
+	comment := fmt.Sprintf("%s:%d", knockRuleComment, server.ID)
+	var specs [][]string
+	rules := ForwardRules(server)
+	if rule := obfuscationRule(server); rule != nil {
+		rules = append(rules, *rule)
+	}
+	for _, rule := range rules {
+		listen := strconv.Itoa(rule.ListenPort)
+		for _, network := range rule.Networks {
+			proto := strings.ToLower(network.SystemString())
+			match := []string{"-t", "mangle", "-A", knockChain, "-p", proto, "--dport", listen, "-m", "comment", "--comment", comment}
+			specs = append(specs,
+				append([]string{g.iptables}, append(slices.Clone(match),
+					"-m", "recent", "--name", knockRecentName(server.ID), "--rcheck", "--seconds", strconv.Itoa(knockTTL(server)),
+					"-j", "RETURN")...),
+				append([]string{g.iptables}, append(slices.Clone(match), "-j", "DROP")...),
+			)
+			if g.ip6tables != "" {
+				specs = append(specs, append([]string{g.ip6tables}, append(slices.Clone(match), "-j", "DROP")...))
+			}
+		}
+	}
+	return specs
+}
+
+// add 添加服务器的敲门规则，规则未变化时保留(放行列表随之保留)，部分失败时撤销已添加的规则
+func (g *knockGate) add(server *database.L2TPServer) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	specs := g.knockRuleSpecs(server)
+	if slices.EqualFunc(g.rules[server.ID], specs, slices.Equal) {
+		return nil
+	}
+	g.removeLocked(server.ID)
+	for i, spec := range specs {
+		if _, err := g.run(spec[0], spec[1:]...); err != nil {
+			for _, added := range specs[:i] {
+				g.run(added[0], withAction(added[1:], "-D")...)
+			}
+			return err
+		}
+	}
+	g.rules[server.ID] = specs
+	return nil
+}
+
+// remove 删除服务器的敲门规则和放行列表
+func (g *knockGate) remove(serverID uint) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.removeLocked(serverID)
+}
+
+// removeLocked 删除服务器的敲门规则和放行列表，调用方需持有锁
+func (g *knockGate) removeLocked(serverID uint) {
+	for _, spec := range g.rules[serverID] {
+		if _, err := g.run(spec[0], withAction(spec[1:], "-D")...); err != nil {
+			slog.Warn("删除端口敲门规则失败", "server_id", serverID, "error", err)
+		}
+	}
+	delete(g.rules, serverID)
+	delete(g.sources, serverID)
+}
+
+// authorize 将地址加入服务器的放行列表
+func (g *knockGate) authorize(serverID uint, ip string, now time.Time) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if _, ok := g.rules[serverID]; !ok {
+		return fmt.Errorf("服务器没有端口敲门规则")
+	}
+	if err := os.WriteFile(knockRecentPath+knockRecentName(serverID), []byte("+"+ip+"\n"), 0644); err != nil {
+		return err
+	}
+	if g.sources[serverID] == nil {
+		g.sources[serverID] = make(map[string]time.Time)
+	}
+	g.sources[serverID][ip] = now
+	return nil
+}
+
+// revoke 清空服务器的放行列表
+func (g *knockGate) revoke(serverID uint) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if _, ok := g.rules[serverID]; ok {
+		if err := os.WriteFile(knockRecentPath+knockRecentName(serverID), []byte("/\n"), 0644); err != nil {
+			return err
+		}
+	}
+	delete(g.sources, serverID)
+	return nil
+}
+
+// authorized 服务器放行列表中未过期的地址及其敲门时间，同时删除过期的地址
+func (g *knockGate) authorized(serverID uint, ttl time.Duration, now time.Time) map[string]time.Time {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	result := make(map[string]time.Time)
+	for ip, knockedAt := range g.sources[serverID] {
+		if now.Sub(knockedAt) > ttl {
+			delete(g.sources[serverID], ip)
+			continue
+		}
+		result[ip] = knockedAt
+	}
+	return result
+}
+
+// cleanup 删除自定义链及其跳转规则
+func (g *knockGate) cleanup() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	for _, command := range g.commands() {
+		for {
+			if _, err := g.run(command, "-t", "mangle", "-D", "PREROUTING", "-j", knockChain); err != nil {
+				break
+			}
+		}
+		g.run(command, "-t", "mangle", "-F", knockChain)
+		if _, err := g.run(command, "-t", "mangle", "-X", knockChain); err != nil {
+			slog.Warn("删除端口敲门规则链失败", "command", command, "error", err)
+		}
+	}
+	g.rules = make(map[uint][][]string)
+	g.sources = make(map[uint]map[string]time.Time)
+}
+
+// addKnockGate 为启用端口敲门的服务器添加敲门规则，首次使用时初始化规则链。调用方需持有serverMutex写锁或在启动时调用
+func (r *RoutingService) addKnockGate(server *database.L2TPServer) error {
+	gate := r.knock.Load()
+	if gate == nil {
+		var err error
+		if gate, err = newKnockGate(); err != nil {
+			return err
+		}
+		r.knock.Store(gate)
+	}
+	return gate.add(server)
+}
+
+// removeKnockGate 删除服务器的敲门规则，调用方需持有serverMutex
+func (r *RoutingService) removeKnockGate(serverID uint) {
+	if gate := r.knock.Load(); gate != nil {
+		gate.remove(serverID)
+	}
+}
+
+// knockServer 运行中的服务器，不存在时返回nil
+func (r *RoutingService) knockServer(id uint) *database.L2TPServer {
+	r.serverMutex.RLock()
+	defer r.serverMutex.RUnlock()
+	for _, server := range r.servers {
+		if server.ID == id && server.Status == "running" {
+			copied := *server
+			return &copied
+		}
+	}
+	return nil
+}
+
+// authorizeKnock 放行敲门通过的地址
+func (r *RoutingService) authorizeKnock(serverID uint, ip string, now time.Time) error {
+	gate := r.knock.Load()
+	if gate == nil {
+		return fmt.Errorf("端口敲门规则未初始化")
+	}
+	return gate.authorize(serverID, ip, now)
+}
+
+// revokeKnock 清空服务器的放行列表
+func (r *RoutingService) revokeKnock(serverID uint) error {
+	if gate := r.knock.Load(); gate != nil {
+		return gate.revoke(serverID)
+	}
+	return nil
+}
+
+// knockSources 服务器放行列表中未过期的地址及其敲门时间
+func (r *RoutingService) knockSources(serverID uint, ttl time.Duration) map[string]time.Time {
+	if gate := r.knock.Load(); gate != nil {
+		return gate.authorized(serverID, ttl, time.Now())
+	}
+	return nil
+}
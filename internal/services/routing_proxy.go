@@ -0,0 +1,358 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"time"
+
+	"l2tp-manager/internal/database"
+
+	"github.com/xtls/xray-core/app/dispatcher"
+	"github.com/xtls/xray-core/app/policy"
+	"github.com/xtls/xray-core/app/proxyman"
+	xstats "github.com/xtls/xray-core/app/stats"
+	xnet "github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/common/serial"
+	"github.com/xtls/xray-core/core"
+	featstats "github.com/xtls/xray-core/features/stats"
+	xhttp "github.com/xtls/xray-core/proxy/http"
+	"github.com/xtls/xray-core/proxy/socks"
+	"github.com/xtls/xray-core/proxy/wireguard"
+	"google.golang.org/protobuf/proto"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// proxyTunnelMTU 代理入站出口隧道的MTU
+const proxyTunnelMTU = 1420
+
+// proxyRuntime 代理入站的运行状态
+type proxyRuntime struct {
+	instance  *core.Instance // 为nil表示未运行
+	signature string         // 生成实例的配置，未变化时不重建
+	err       string         // 未运行的原因
+}
+
+// loadProxies 从数据库加载代理入站
+func (r *RoutingService) loadProxies() {
+	if r.db == nil {
+		return
+	}
+
+	var proxies []database.ProxyInbound
+	if err := r.db.Find(&proxies).Error; err != nil {
+		slog.Error("加载代理入站失败", "error", err)
+		return
+	}
+
+	r.serverMutex.Lock()
+	defer r.serverMutex.Unlock()
+
+	r.proxies = make(map[uint]*database.ProxyInbound)
+	for i := range proxies {
+		r.proxies[proxies[i].ID] = &proxies[i]
+	}
+	slog.Info("已加载代理入站", "count", len(proxies))
+}
+
+// ReloadProxy 代理入站创建或变更后按新配置重建
+func (r *RoutingService) ReloadProxy(proxy *database.ProxyInbound) {
+	r.serverMutex.Lock()
+	defer r.serverMutex.Unlock()
+
+	updated := *proxy
+	r.proxies[updated.ID] = &updated
+	r.applyProxy(updated.ID)
+}
+
+// RemoveProxy 停止并移除代理入站
+func (r *RoutingService) RemoveProxy(id uint) {
+	r.serverMutex.Lock()
+	defer r.serverMutex.Unlock()
+
+	r.stopProxy(id)
+	delete(r.proxies, id)
+}
+
+// ProxyStatus 代理入站是否运行中，未运行时返回原因
+func (r *RoutingService) ProxyStatus(id uint) (bool, string) {
+	r.serverMutex.RLock()
+	defer r.serverMutex.RUnlock()
+
+	runtime, exists := r.proxyRuntimes[id]
+	if !exists {
+		return false, "路由服务未启动"
+	}
+	return runtime.instance != nil, runtime.err
+}
+
+// applyExitProxies 出口服务器变更或启停后重新应用以其为出口的代理，调用方需持有serverMutex
+func (r *RoutingService) applyExitProxies(serverID uint) {
+	for id, proxy := range r.proxies {
+		if proxy.ExitServerID == serverID {
+			r.applyProxy(id)
+		}
+	}
+}
+
+// applyProxy 代理已启用且出口服务器运行中时启动代理，否则停止并记录原因；配置未变化时保留运行中的实例。
+// 调用方需持有serverMutex
+func (r *RoutingService) applyProxy(id uint) {
+	proxy, exists := r.proxies[id]
+	if !exists {
+		return
+	}
+
+	var exit *database.L2TPServer
+	for _, server := range r.servers {
+		if server.ID == proxy.ExitServerID {
+			exit = server
+			break
+		}
+	}
+
+	var reason string
+	switch {
+	case !proxy.Enabled:
+		reason = "已停用"
+	case exit == nil:
+		reason = "出口服务器不存在"
+	case exit.Type != ServerTypeWireGuard:
+		reason = "出口服务器不是WireGuard类型"
+	case exit.Status != "running":
+		reason = "出口服务器未运行"
+	}
+	if reason != "" {
+		r.stopProxy(id)
+		r.proxyRuntimes[id] = &proxyRuntime{err: reason}
+		return
+	}
+
+	config, usernames, err := proxyXrayConfig(proxy, exit)
+	if err != nil {
+		r.stopProxy(id)
+		r.proxyRuntimes[id] = &proxyRuntime{err: err.Error()}
+		return
+	}
+	signature := fmt.Sprintf("%s|%d|%s|%s|%s|%s", proxy.Protocol, proxy.ListenPort, proxy.Accounts,
+		exit.Host, exit.WireGuardPrivateKey, exit.WireGuardPeers)
+	if current := r.proxyRuntimes[id]; current != nil && current.instance != nil && current.signature == signature {
+		return
+	}
+
+	r.stopProxy(id)
+	instance, err := r.startProxyInstance(proxy.ListenPort, config)
+	if err != nil {
+		slog.Error("启动代理入站失败", "proxy_id", id, "port", proxy.ListenPort, "error", err)
+		r.proxyRuntimes[id] = &proxyRuntime{err: err.Error()}
+		return
+	}
+	r.proxyRuntimes[id] = &proxyRuntime{instance: instance, signature: signature}
+	slog.Info("代理入站已启动", "proxy_id", id, "protocol", proxy.Protocol, "port", proxy.ListenPort, "exit_server_id", exit.ID)
+
+	go r.monitorProxyTraffic(id, instance, usernames)
+}
+
+// stopProxy 停止代理入站的Xray实例，调用方需持有serverMutex
+func (r *RoutingService) stopProxy(id uint) {
+	runtime, exists := r.proxyRuntimes[id]
+	if !exists {
+		return
+	}
+	if runtime.instance != nil {
+		if err := runtime.instance.Close(); err != nil {
+			slog.Error("关闭代理入站实例出错", "proxy_id", id, "error", err)
+		}
+		slog.Info("代理入站已停止", "proxy_id", id)
+	}
+	delete(r.proxyRuntimes, id)
+}
+
+// startProxyInstance 检查主机资源和端口后创建并启动Xray实例
+func (r *RoutingService) startProxyInstance(port int, config *core.Config) (*core.Instance, error) {
+	if err := r.checkCapacity(); err != nil {
+		return nil, err
+	}
+	if err := r.checkPortAvailable(port); err != nil {
+		return nil, fmt.Errorf("端口 %d 不可用: %v", port, err)
+	}
+	instance, err := core.New(config)
+	if err != nil {
+		return nil, fmt.Errorf("创建Xray实例失败: %v", err)
+	}
+	if err := instance.Start(); err != nil {
+		instance.Close()
+		return nil, fmt.Errorf("启动Xray实例失败: %v", err)
+	}
+	return instance, nil
+}
+
+// proxyXrayConfig 生成代理入站的Xray配置：SOCKS5/HTTP入站按账号认证并统计流量，
+// 出站以指定的WireGuard用户身份连接出口服务器，隧道在用户态实现，不修改中转机的网络配置
+func proxyXrayConfig(proxy *database.ProxyInbound, exit *database.L2TPServer) (*core.Config, []string, error) {
+	peer, err := findWireGuardPeer(exit, proxy.ExitPeer)
+	if err != nil {
+		return nil, nil, err
+	}
+	serverPublicKey, err := wireGuardPublicKey(exit.WireGuardPrivateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	privateKey, err := wireGuardHexKey(peer.PrivateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	publicKey, err := wireGuardHexKey(serverPublicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	accounts, err := parseProxyAccounts(proxy.Accounts)
+	if err != nil {
+		return nil, nil, err
+	}
+	credentials := make(map[string]string, len(accounts))
+	usernames := make([]string, 0, len(accounts))
+	for _, account := range accounts {
+		credentials[account.Username] = account.Password
+		usernames = append(usernames, account.Username)
+	}
+
+	var inbound proto.Message
+	switch proxy.Protocol {
+	case ProxyProtocolHTTP:
+		inbound = &xhttp.ServerConfig{Accounts: credentials}
+	default:
+		inbound = &socks.ServerConfig{
+			AuthType:   socks.AuthType_PASSWORD,
+			Accounts:   credentials,
+			UdpEnabled: true,
+		}
+	}
+
+	config := &core.Config{
+		App: []*serial.TypedMessage{
+			serial.ToTypedMessage(&dispatcher.Config{}),
+			serial.ToTypedMessage(&proxyman.InboundConfig{}),
+			serial.ToTypedMessage(&proxyman.OutboundConfig{}),
+			serial.ToTypedMessage(&xstats.Config{}),
+			// 按账号统计流量，计数器名称为 user>>>账号>>>traffic>>>uplink/downlink
+			serial.ToTypedMessage(&policy.Config{
+				Level: map[uint32]*policy.Policy{
+					0: {Stats: &policy.Policy_Stats{UserUplink: true, UserDownlink: true}},
+				},
+			}),
+		},
+		Inbound: []*core.InboundHandlerConfig{
+			{
+				Tag: fmt.Sprintf("proxy-in-%d", proxy.ID),
+				ReceiverSettings: serial.ToTypedMessage(&proxyman.ReceiverConfig{
+					PortList: &xnet.PortList{Range: []*xnet.PortRange{
+						{From: uint32(proxy.ListenPort), To: uint32(proxy.ListenPort)},
+					}},
+					Listen: xnet.NewIPOrDomain(xnet.AnyIP),
+				}),
+				ProxySettings: serial.ToTypedMessage(inbound),
+			},
+		},
+		Outbound: []*core.OutboundHandlerConfig{
+			{
+				Tag: fmt.Sprintf("exit-%d", exit.ID),
+				ProxySettings: serial.ToTypedMessage(&wireguard.DeviceConfig{
+					SecretKey: privateKey,
+					Endpoint:  []string{peer.Address},
+					Peers: []*wireguard.PeerConfig{
+						{
+							PublicKey:  publicKey,
+							Endpoint:   net.JoinHostPort(exit.Host, strconv.Itoa(WireGuardListenPort)),
+							KeepAlive:  uint32(natKeepalive(exit)),
+							AllowedIps: []string{"0.0.0.0/0"},
+						},
+					},
+					Mtu:      proxyTunnelMTU,
+					IsClient: true,
+				}),
+			},
+		},
+	}
+	return config, usernames, nil
+}
+
+// wireGuardHexKey 将base64编码的WireGuard密钥转换为Xray使用的十六进制
+func wireGuardHexKey(key string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(data) != 32 {
+		return "", fmt.Errorf("无效的WireGuard密钥")
+	}
+	return hex.EncodeToString(data), nil
+}
+
+// monitorProxyTraffic 按流量汇总间隔将账号流量计数器累加到数据库，实例被替换或停止后写入最后一次并退出
+func (r *RoutingService) monitorProxyTraffic(proxyID uint, instance *core.Instance, usernames []string) {
+	for {
+		timer := time.NewTimer(r.trafficCollectInterval())
+		select {
+		case <-r.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			r.serverMutex.RLock()
+			runtime := r.proxyRuntimes[proxyID]
+			_, exists := r.proxies[proxyID]
+			r.serverMutex.RUnlock()
+
+			// 代理已删除时其流量记录已清理，不再写入
+			if exists {
+				r.collectProxyTraffic(proxyID, instance, usernames)
+			}
+			if runtime == nil || runtime.instance != instance {
+				return
+			}
+		}
+	}
+}
+
+// collectProxyTraffic 读取并清零各账号的计数器，累加到账号的流量记录
+func (r *RoutingService) collectProxyTraffic(proxyID uint, instance *core.Instance, usernames []string) {
+	manager, ok := instance.GetFeature(featstats.ManagerType()).(featstats.Manager)
+	if !ok || r.db == nil {
+		return
+	}
+
+	now := time.Now()
+	for _, username := range usernames {
+		var uplink, downlink int64
+		if counter := manager.GetCounter("user>>>" + username + ">>>traffic>>>uplink"); counter != nil {
+			uplink = counter.Set(0)
+		}
+		if counter := manager.GetCounter("user>>>" + username + ">>>traffic>>>downlink"); counter != nil {
+			downlink = counter.Set(0)
+		}
+		if uplink == 0 && downlink == 0 {
+			continue
+		}
+
+		record := database.ProxyTraffic{
+			ProxyID:      proxyID,
+			Username:     username,
+			Uplink:       uplink,
+			Downlink:     downlink,
+			LastActiveAt: &now,
+		}
+		err := r.db.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "proxy_id"}, {Name: "username"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"uplink":         gorm.Expr("proxy_traffics.uplink + excluded.uplink"),
+				"downlink":       gorm.Expr("proxy_traffics.downlink + excluded.downlink"),
+				"last_active_at": now,
+			}),
+		}).Create(&record).Error
+		if err != nil {
+			slog.Error("保存代理流量失败", "proxy_id", proxyID, "username", username, "error", err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"strconv"
+	"time"
+)
+
+// 转发器监控的设置项
+const (
+	SettingXrayCheckInterval      = "xray_check_interval"
+	SettingXrayCheckTimeout       = "xray_check_timeout"
+	SettingXrayVerifyTimeout      = "xray_verify_timeout"
+	SettingTrafficCollectInterval = "traffic_collect_interval"
+)
+
+// routingSettingDefaults 转发器监控设置的默认值，未设置SettingsService时(中转节点、命令行)直接使用
+var routingSettingDefaults = map[string]int{
+	SettingXrayCheckInterval:      15,   // 秒
+	SettingXrayCheckTimeout:       1000, // 毫秒
+	SettingXrayVerifyTimeout:      3000, // 毫秒
+	SettingTrafficCollectInterval: 10,   // 秒
+}
+
+// SetSettings 设置并注册转发器监控的设置项，需在Start之前调用。修改后立即生效，无需重启
+func (r *RoutingService) SetSettings(settings *SettingsService) {
+	settings.Register(SettingDef{Key: SettingXrayCheckInterval, Type: SettingTypeInt, Default: strconv.Itoa(routingSettingDefaults[SettingXrayCheckInterval]), Max: 3600, Description: "检查转发器、内核转发规则和下一跳的间隔(秒)，0表示关闭"})
+	settings.Register(SettingDef{Key: SettingXrayCheckTimeout, Type: SettingTypeInt, Default: strconv.Itoa(routingSettingDefaults[SettingXrayCheckTimeout]), Min: 100, Max: 60000, Description: "定期检查时探测Xray转发端口的超时(毫秒)，超时的实例被重启"})
+	settings.Register(SettingDef{Key: SettingXrayVerifyTimeout, Type: SettingTypeInt, Default: strconv.Itoa(routingSettingDefaults[SettingXrayVerifyTimeout]), Min: 100, Max: 60000, Description: "启动Xray转发器后验证端口的超时(毫秒)"})
+	settings.Register(SettingDef{Key: SettingTrafficCollectInterval, Type: SettingTypeInt, Default: strconv.Itoa(routingSettingDefaults[SettingTrafficCollectInterval]), Min: 1, Max: 3600, Description: "汇总转发流量统计、流量日志和代理账号流量的间隔(秒)"})
+	r.settings = settings
+}
+
+// monitorSetting 读取转发器监控的设置
+func (r *RoutingService) monitorSetting(key string) int {
+	if r.settings == nil {
+		return routingSettingDefaults[key]
+	}
+	return r.settings.Int(key)
+}
+
+// xrayCheckInterval 定期检查转发器的间隔，0表示关闭
+func (r *RoutingService) xrayCheckInterval() time.Duration {
+	return time.Duration(r.monitorSetting(SettingXrayCheckInterval)) * time.Second
+}
+
+// xrayCheckTimeout 定期检查时探测端口的超时
+func (r *RoutingService) xrayCheckTimeout() time.Duration {
+	return time.Duration(r.monitorSetting(SettingXrayCheckTimeout)) * time.Millisecond
+}
+
+// xrayVerifyTimeout 启动转发器后验证端口的超时
+func (r *RoutingService) xrayVerifyTimeout() time.Duration {
+	return time.Duration(r.monitorSetting(SettingXrayVerifyTimeout)) * time.Millisecond
+}
+
+// trafficCollectInterval 汇总流量统计的间隔
+func (r *RoutingService) trafficCollectInterval() time.Duration {
+	return max(time.Duration(r.monitorSetting(SettingTrafficCollectInterval))*time.Second, throughputInterval)
+}
+
+// trafficCollectTicks 每读取多少次计数器汇总一次流量统计和流量日志
+func (r *RoutingService) trafficCollectTicks() int {
+	return int(r.trafficCollectInterval() / throughputInterval)
+}
+
+// settingsChanged 转发器监控设置的变更通知，未设置SettingsService时返回nil(永不触发)
+func (r *RoutingService) settingsChanged(keys ...string) <-chan struct{} {
+	if r.settings == nil {
+		return nil
+	}
+	return r.settings.Watch(keys...)
+}
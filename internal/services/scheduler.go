@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+
+	"l2tp-manager/internal/database"
+	"l2tp-manager/internal/logger"
+
+	"gorm.io/gorm"
+)
+
+// SchedulerService 定时维护任务调度服务
+type SchedulerService struct {
+	db           *gorm.DB
+	l2tpService  *L2TPService
+	auditService *AuditService
+	lastRun      map[uint]time.Time // 服务器ID -> 上次触发的分钟
+	mutex        sync.Mutex
+}
+
+// NewSchedulerService 创建调度服务
+func NewSchedulerService(db *gorm.DB, l2tpService *L2TPService, auditService *AuditService) *SchedulerService {
+	return &SchedulerService{
+		db:           db,
+		l2tpService:  l2tpService,
+		auditService: auditService,
+		lastRun:      make(map[uint]time.Time),
+	}
+}
+
+// Start 启动调度循环，每分钟检查一次定时重启计划和服务器到期
+func (s *SchedulerService) Start(ctx context.Context) {
+	slog.Info("定时维护调度服务已启动")
+
+	for {
+		// 对齐到下一分钟开始
+		now := time.Now()
+		next := now.Truncate(time.Minute).Add(time.Minute)
+		select {
+		case <-ctx.Done():
+			slog.Info("定时维护调度服务正在退出")
+			return
+		case <-time.After(next.Sub(now)):
+			s.runDue(ctx, next)
+			s.l2tpService.NotifyExpired(next.Add(-time.Minute), next)
+			s.l2tpService.NotifyExpiring(next.Add(-time.Minute), next)
+		}
+	}
+}
+
+// runDue 触发当前分钟内到期的定时重启
+func (s *SchedulerService) runDue(ctx context.Context, now time.Time) {
+	var servers []database.L2TPServer
+	if err := s.db.Where("restart_schedule <> ''").Find(&servers).Error; err != nil {
+		slog.Error("加载定时重启计划失败", "error", err)
+		return
+	}
+
+	minute := now.Truncate(time.Minute)
+	for i := range servers {
+		server := servers[i]
+		schedule, err := ParseCron(server.RestartSchedule)
+		if err != nil {
+			slog.Warn("定时重启计划无效", "server_id", server.ID, "error", err)
+			continue
+		}
+		if !schedule.Matches(minute) {
+			continue
+		}
+
+		s.mutex.Lock()
+		if s.lastRun[server.ID].Equal(minute) {
+			s.mutex.Unlock()
+			continue
+		}
+		s.lastRun[server.ID] = minute
+		s.mutex.Unlock()
+
+		go s.runScheduledRestart(ctx, &server)
+	}
+}
+
+// runScheduledRestart 执行一次定时重启(带随机延迟)
+func (s *SchedulerService) runScheduledRestart(ctx context.Context, server *database.L2TPServer) {
+	if server.RestartJitter > 0 {
+		delay := time.Duration(rand.Intn(server.RestartJitter+1)) * time.Second
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+
+	// 延迟期间状态可能已变化，重新读取
+	current, err := s.l2tpService.WithContext(ctx).GetServer(server.ID)
+	if err != nil {
+		return
+	}
+	if current.Status != "running" {
+		s.auditService.Record(current.ID, "scheduled_restart", "system", "skipped",
+			fmt.Sprintf("服务器状态为 %s，跳过定时重启", current.Status))
+		return
+	}
+
+	if current.RestartSkipIfClients {
+		clients, err := s.l2tpService.SSH().WithContext(ctx).GetConnectedClients(current)
+		if err != nil {
+			s.auditService.Record(current.ID, "scheduled_restart", "system", "skipped",
+				fmt.Sprintf("无法获取在线客户端数量，跳过定时重启: %v", err))
+			return
+		}
+		if clients > 0 {
+			s.auditService.Record(current.ID, "scheduled_restart", "system", "skipped",
+				fmt.Sprintf("当前有 %d 个客户端在线，跳过定时重启", clients))
+			return
+		}
+	}
+
+	ctx = logger.WithRequestID(ctx, "schedule-"+logger.NewRequestID())
+	if err := s.l2tpService.RestartServer(ctx, current.ID); err != nil {
+		s.auditService.Record(current.ID, "scheduled_restart", "system", "failed", err.Error())
+		slog.ErrorContext(ctx, "定时重启失败", "server_id", current.ID, "error", err)
+		return
+	}
+
+	s.auditService.Record(current.ID, "scheduled_restart", "system", "success",
+		fmt.Sprintf("按计划 %q 执行重启", current.RestartSchedule))
+	slog.InfoContext(ctx, "服务器已按计划重启", "server_id", current.ID)
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"l2tp-manager/internal/database"
+
+	"gorm.io/gorm"
+)
+
+// 搜索结果类型
+const (
+	SearchTypeServer  = "server"  // 服务器(匹配名称或地址)
+	SearchTypeAccount = "account" // L2TP账号(匹配用户名)
+	SearchTypeAudit   = "audit"   // 最近的审计日志(匹配操作、操作人或详情)
+)
+
+// 搜索参数
+const (
+	SearchDefaultLimit = 10
+	SearchMaxLimit     = 50
+	searchAuditWindow  = 30 * 24 * time.Hour // 只搜索最近30天的审计日志
+)
+
+// SearchResult 一条搜索结果，供命令面板按类型展示和跳转
+type SearchResult struct {
+	Type      string     `json:"type"`
+	ID        uint       `json:"id"`                  // server为服务器ID，audit为日志ID，account为所属服务器ID
+	ServerID  uint       `json:"server_id,omitempty"` // 关联服务器
+	Title     string     `json:"title"`
+	Subtitle  string     `json:"subtitle"`
+	CreatedAt *time.Time `json:"created_at,omitempty"` // 仅audit
+}
+
+// SearchResults 按类型分组的搜索结果
+type SearchResults struct {
+	Query    string         `json:"query"`
+	Servers  []SearchResult `json:"servers"`
+	Accounts []SearchResult `json:"accounts"`
+	Audit    []SearchResult `json:"audit"`
+}
+
+// SearchService 全局搜索
+type SearchService struct {
+	db          *gorm.DB
+	l2tpService *L2TPService
+}
+
+// NewSearchService 创建搜索服务
+func NewSearchService(db *gorm.DB, l2tpService *L2TPService) *SearchService {
+	return &SearchService{db: db, l2tpService: l2tpService}
+}
+
+// Search 在服务器、L2TP账号和最近审计日志中搜索关键词(不区分大小写)，每类最多返回limit条。
+// tenantID大于0时只搜索该租户的服务器及其审计日志
+func (s *SearchService) Search(q string, limit int, tenantID uint) (*SearchResults, error) {
+	q = strings.TrimSpace(q)
+	if q == "" {
+		return nil, fmt.Errorf("搜索关键词不能为空")
+	}
+	if limit <= 0 {
+		limit = SearchDefaultLimit
+	}
+	if limit > SearchMaxLimit {
+		limit = SearchMaxLimit
+	}
+
+	results := &SearchResults{Query: q}
+	var err error
+	if results.Servers, err = s.searchServers(q, limit, tenantID); err != nil {
+		return nil, err
+	}
+	if results.Accounts, err = s.searchAccounts(q, limit, tenantID); err != nil {
+		return nil, err
+	}
+	if results.Audit, err = s.searchAudit(q, limit, tenantID); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// searchServers 按名称或地址匹配服务器
+func (s *SearchService) searchServers(q string, limit int, tenantID uint) ([]SearchResult, error) {
+	var servers []database.L2TPServer
+	like := "%" + q + "%"
+	err := s.db.Scopes(TenantServers(tenantID)).Where("name LIKE ? OR host LIKE ?", like, like).
+		Order("name").Limit(limit).Find(&servers).Error
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]SearchResult, 0, len(servers))
+	for _, server := range servers {
+		results = append(results, SearchResult{
+			Type:     SearchTypeServer,
+			ID:       server.ID,
+			ServerID: server.ID,
+			Title:    server.Name,
+			Subtitle: fmt.Sprintf("%s · 端口%d · %s", server.Host, server.L2TPPort, server.Status),
+		})
+	}
+	return results, nil
+}
+
+// searchAccounts 按用户名匹配L2TP账号，先用LIKE筛出用户配置中包含关键词的服务器再逐个比对用户名
+func (s *SearchService) searchAccounts(q string, limit int, tenantID uint) ([]SearchResult, error) {
+	var servers []database.L2TPServer
+	err := s.db.Scopes(TenantServers(tenantID)).Select("id, name, users").
+		Where("users LIKE ?", "%"+q+"%").
+		Order("name").Find(&servers).Error
+	if err != nil {
+		return nil, err
+	}
+
+	lower := strings.ToLower(q)
+	results := make([]SearchResult, 0)
+	for _, server := range servers {
+		users, err := s.l2tpService.ParseUsers(server.Users)
+		if err != nil {
+			continue
+		}
+		for _, user := range users {
+			if !strings.Contains(strings.ToLower(user.Username), lower) {
+				continue
+			}
+			results = append(results, SearchResult{
+				Type:     SearchTypeAccount,
+				ID:       server.ID,
+				ServerID: server.ID,
+				Title:    user.Username,
+				Subtitle: server.Name,
+			})
+			if len(results) >= limit {
+				return results, nil
+			}
+		}
+	}
+	return results, nil
+}
+
+// searchAudit 在最近的审计日志中匹配操作、操作人或详情，按时间倒序
+func (s *SearchService) searchAudit(q string, limit int, tenantID uint) ([]SearchResult, error) {
+	var logs []database.AuditLog
+	like := "%" + q + "%"
+	err := s.db.Scopes(tenantServerIDs("server_id", tenantID)).Where("created_at >= ?", time.Now().Add(-searchAuditWindow)).
+		Where("action LIKE ? OR username LIKE ? OR detail LIKE ?", like, like, like).
+		Order("created_at DESC").Limit(limit).Find(&logs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]SearchResult, 0, len(logs))
+	for _, entry := range logs {
+		createdAt := entry.CreatedAt
+		results = append(results, SearchResult{
+			Type:      SearchTypeAudit,
+			ID:        entry.ID,
+			ServerID:  entry.ServerID,
+			Title:     entry.Action,
+			Subtitle:  fmt.Sprintf("%s · %s · %s", entry.Username, entry.Result, entry.Detail),
+			CreatedAt: &createdAt,
+		})
+	}
+	return results, nil
+}
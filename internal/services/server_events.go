@@ -0,0 +1,76 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"l2tp-manager/internal/database"
+)
+
+// statusEvents 服务器状态与通知事件的对应关系
+var statusEvents = map[string]string{
+	"running": EventServerStarted,
+	"stopped": EventServerStopped,
+	"error":   EventServerError,
+}
+
+// SetNotifier 设置通知分发服务，服务器生命周期事件将经由它发送到外部渠道
+func (s *L2TPService) SetNotifier(notifier *NotificationService) {
+	s.notifier = notifier
+}
+
+// publish 发布服务器事件，name为空时从数据库补全服务器名称
+func (s *L2TPService) publish(eventType string, serverID uint, name, message string) {
+	s.publishData(eventType, serverID, name, message, nil)
+}
+
+// publishData 发布携带附加数据的服务器事件
+func (s *L2TPService) publishData(eventType string, serverID uint, name, message string, data map[string]interface{}) {
+	if s.notifier == nil {
+		return
+	}
+	if name == "" {
+		var server database.L2TPServer
+		if err := s.db.Unscoped().Select("id", "name").First(&server, serverID).Error; err == nil {
+			name = server.Name
+		}
+	}
+	s.notifier.Publish(Event{
+		Type:       eventType,
+		ServerID:   serverID,
+		ServerName: name,
+		Message:    message,
+		Data:       data,
+	})
+}
+
+// expiryReminderDays 到期前提醒的提前天数
+var expiryReminderDays = []int{7, 3, 1}
+
+// NotifyExpiring 为到期时间在提醒点[from, to)内的服务器发布即将到期事件
+func (s *L2TPService) NotifyExpiring(from, to time.Time) {
+	for _, days := range expiryReminderDays {
+		lead := time.Duration(days) * 24 * time.Hour
+		var servers []database.L2TPServer
+		if err := s.db.Where("expire_date >= ? AND expire_date < ?", from.Add(lead), to.Add(lead)).Find(&servers).Error; err != nil {
+			return
+		}
+		for _, server := range servers {
+			s.publishData(EventServerExpiring, server.ID, server.Name,
+				fmt.Sprintf("服务器 \"%s\" 将于 %d 天后(%s)到期", server.Name, days, server.ExpireDate.Format("2006-01-02 15:04")),
+				map[string]interface{}{"days_left": days, "expire_date": server.ExpireDate})
+		}
+	}
+}
+
+// NotifyExpired 为到期时间落在[from, to)内的服务器发布到期事件
+func (s *L2TPService) NotifyExpired(from, to time.Time) {
+	var servers []database.L2TPServer
+	if err := s.db.Where("expire_date >= ? AND expire_date < ?", from, to).Find(&servers).Error; err != nil {
+		return
+	}
+	for _, server := range servers {
+		s.publish(EventServerExpired, server.ID, server.Name,
+			fmt.Sprintf("服务器 \"%s\" 已于 %s 到期", server.Name, server.ExpireDate.Format("2006-01-02 15:04")))
+	}
+}
@@ -0,0 +1,350 @@
+package services
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"l2tp-manager/internal/database"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 内置设置项
+const (
+	SettingTrashRetentionDays   = "trash_retention_days"
+	SettingTrafficRetentionDays = "traffic_retention_days"
+	SettingHealthCheckInterval  = "health_check_interval"
+	SettingHealthFailThreshold  = "health_fail_threshold"
+	SettingHealthMaxRestarts    = "health_max_restarts"
+	SettingReconcileInterval    = "reconcile_interval"
+	SettingRateLimitServerOps   = "rate_limit_server_ops"
+	SettingRateLimitLogs        = "rate_limit_logs"
+	SettingRateLimitBackup      = "rate_limit_backup"
+)
+
+// 设置值类型
+const (
+	SettingTypeInt    = "int"
+	SettingTypeBool   = "bool"
+	SettingTypeString = "string"
+)
+
+// SettingDef 设置项定义
+type SettingDef struct {
+	Key         string `json:"key"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	Default     string `json:"default"` // 来自环境变量或内置默认值
+	Min         int    `json:"min,omitempty"`
+	Max         int    `json:"max,omitempty"` // 0表示不限制
+	Secret      bool   `json:"secret,omitempty"`
+}
+
+// SettingView 设置项及当前生效值
+type SettingView struct {
+	SettingDef
+	Value      string `json:"value"`
+	Overridden bool   `json:"overridden"` // 是否已在数据库中覆盖默认值
+}
+
+// builtinSettings 内置设置项定义，默认值由NewSettingsService传入
+var builtinSettings = []SettingDef{
+	{Key: SettingTrashRetentionDays, Type: SettingTypeInt, Description: "回收站保留天数，0表示不自动清理"},
+	{Key: SettingTrafficRetentionDays, Type: SettingTypeInt, Description: "流量日志保留天数，0表示不清理"},
+	{Key: SettingHealthCheckInterval, Type: SettingTypeInt, Description: "落地机健康检查间隔(秒)，0表示关闭"},
+	{Key: SettingHealthFailThreshold, Type: SettingTypeInt, Min: 1, Description: "连续失败多少次后自动重启"},
+	{Key: SettingHealthMaxRestarts, Type: SettingTypeInt, Description: "自动重启最大尝试次数"},
+	{Key: SettingReconcileInterval, Type: SettingTypeInt, Description: "期望状态协调间隔(秒)，0表示关闭"},
+	{Key: SettingRateLimitServerOps, Type: SettingTypeInt, Default: "20", Description: "启动/停止/重启服务器每个用户和IP每分钟最多次数，0表示不限制"},
+	{Key: SettingRateLimitLogs, Type: SettingTypeInt, Default: "30", Description: "查看落地机日志每个用户和IP每分钟最多次数，0表示不限制"},
+	{Key: SettingRateLimitBackup, Type: SettingTypeInt, Default: "6", Description: "备份和恢复数据库每个用户和IP每分钟最多次数，0表示不限制"},
+}
+
+// SettingsService 运行时可修改的应用设置，数据库中的值覆盖环境变量默认值
+type SettingsService struct {
+	db       *gorm.DB
+	defaults map[string]string // 配置中指定的默认值，覆盖设置项定义中的默认值
+	base     map[string]string // 设置项定义中的默认值
+	defs     map[string]SettingDef
+	order    []string
+	values   map[string]string
+	watchers map[string][]chan struct{}
+	mutex    sync.RWMutex
+}
+
+// NewSettingsService 创建设置服务，defaults为各设置项的默认值，对之后注册的设置项同样生效
+func NewSettingsService(db *gorm.DB, defaults map[string]string) *SettingsService {
+	s := &SettingsService{
+		db:       db,
+		defaults: defaults,
+		base:     make(map[string]string),
+		defs:     make(map[string]SettingDef),
+		values:   make(map[string]string),
+		watchers: make(map[string][]chan struct{}),
+	}
+	for _, def := range builtinSettings {
+		s.Register(def)
+	}
+
+	var rows []database.Setting
+	if err := db.Find(&rows).Error; err != nil {
+		slog.Warn("加载设置失败，使用默认值", "error", err)
+	}
+	for _, row := range rows {
+		s.values[row.Key] = row.Value
+	}
+	return s
+}
+
+// Register 注册设置项，供各功能模块声明自己的设置
+func (s *SettingsService) Register(def SettingDef) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.base[def.Key] = def.Default
+	if value, ok := s.defaults[def.Key]; ok {
+		def.Default = value
+	}
+	if _, exists := s.defs[def.Key]; !exists {
+		s.order = append(s.order, def.Key)
+	}
+	s.defs[def.Key] = def
+}
+
+// ValidateDefaults 校验配置中指定的默认值，应在各模块注册完设置项后调用
+func (s *SettingsService) ValidateDefaults() error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.validateDefaults(s.defaults)
+}
+
+// validateDefaults 校验默认值，调用方需持有锁
+func (s *SettingsService) validateDefaults(defaults map[string]string) error {
+	for key, value := range defaults {
+		def, ok := s.defs[key]
+		if !ok {
+			return fmt.Errorf("未知的设置项: %s", key)
+		}
+		if err := validateSetting(def, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reload 替换配置中的默认值并重新读取数据库中的设置(包括命令行等在面板外所做的修改)，
+// 生效值有变化的设置项通知订阅者。默认值校验失败时不做任何修改
+func (s *SettingsService) Reload(defaults map[string]string) error {
+	s.mutex.RLock()
+	err := s.validateDefaults(defaults)
+	s.mutex.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	var rows []database.Setting
+	if err := s.db.Find(&rows).Error; err != nil {
+		return fmt.Errorf("加载设置失败: %v", err)
+	}
+	values := make(map[string]string, len(rows))
+	for _, row := range rows {
+		values[row.Key] = row.Value
+	}
+
+	s.mutex.Lock()
+	before := make(map[string]string, len(s.defs))
+	for key := range s.defs {
+		before[key] = s.current(key)
+	}
+	s.defaults = defaults
+	s.values = values
+	var notify []chan struct{}
+	for key, def := range s.defs {
+		def.Default = s.base[key]
+		if value, ok := defaults[key]; ok {
+			def.Default = value
+		}
+		s.defs[key] = def
+		if s.current(key) != before[key] {
+			notify = append(notify, s.watchers[key]...)
+		}
+	}
+	s.mutex.Unlock()
+
+	notifyWatchers(notify)
+	return nil
+}
+
+// Refresh 保留当前默认值重新读取数据库中的设置，用于数据库被整体替换(如恢复备份)之后
+func (s *SettingsService) Refresh() error {
+	s.mutex.RLock()
+	defaults := s.defaults
+	s.mutex.RUnlock()
+	return s.Reload(defaults)
+}
+
+// Get 获取设置的当前值
+func (s *SettingsService) Get(key string) string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.current(key)
+}
+
+// current 设置的当前值，调用方需持有锁
+func (s *SettingsService) current(key string) string {
+	if value, ok := s.values[key]; ok {
+		return value
+	}
+	return s.defs[key].Default
+}
+
+// Int 获取整型设置
+func (s *SettingsService) Int(key string) int {
+	value, _ := strconv.Atoi(s.Get(key))
+	return value
+}
+
+// Bool 获取布尔型设置
+func (s *SettingsService) Bool(key string) bool {
+	value, _ := strconv.ParseBool(s.Get(key))
+	return value
+}
+
+// Seconds 将整型设置作为秒数返回时长
+func (s *SettingsService) Seconds(key string) time.Duration {
+	return time.Duration(s.Int(key)) * time.Second
+}
+
+// List 列出全部设置项，敏感值隐藏
+func (s *SettingsService) List() []SettingView {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	views := make([]SettingView, 0, len(s.order))
+	for _, key := range s.order {
+		def := s.defs[key]
+		value, overridden := s.values[key]
+		if !overridden {
+			value = def.Default
+		}
+		if def.Secret && value != "" {
+			value = secretMask
+		}
+		views = append(views, SettingView{SettingDef: def, Value: value, Overridden: overridden})
+	}
+	return views
+}
+
+// Update 批量更新设置，值为nil表示恢复默认值。全部校验通过后才写入
+func (s *SettingsService) Update(updates map[string]*string) error {
+	s.mutex.RLock()
+	for key, value := range updates {
+		def, ok := s.defs[key]
+		if !ok {
+			s.mutex.RUnlock()
+			return fmt.Errorf("未知的设置项: %s", key)
+		}
+		if value != nil {
+			if err := validateSetting(def, *value); err != nil {
+				s.mutex.RUnlock()
+				return err
+			}
+		}
+	}
+	s.mutex.RUnlock()
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for key, value := range updates {
+			if value == nil {
+				if err := tx.Delete(&database.Setting{}, "key = ?", key).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			if s.defs[key].Secret && *value == secretMask {
+				continue // 未修改的敏感值
+			}
+			row := database.Setting{Key: key, Value: *value, UpdatedAt: time.Now()}
+			if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&row).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	var notify []chan struct{}
+	for key, value := range updates {
+		if value == nil {
+			delete(s.values, key)
+		} else if !(s.defs[key].Secret && *value == secretMask) {
+			s.values[key] = *value
+		}
+		notify = append(notify, s.watchers[key]...)
+	}
+	s.mutex.Unlock()
+
+	notifyWatchers(notify)
+	return nil
+}
+
+// notifyWatchers 通知订阅者，通道已有未处理的通知时跳过
+func notifyWatchers(watchers []chan struct{}) {
+	for _, ch := range watchers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Watch 返回在指定设置变更时收到通知的通道(通知会合并，不会阻塞写入方)
+func (s *SettingsService) Watch(keys ...string) <-chan struct{} {
+	ch := make(chan struct{}, 1)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, key := range keys {
+		s.watchers[key] = append(s.watchers[key], ch)
+	}
+	return ch
+}
+
+// newIntervalTimer 创建按设置间隔触发的定时器，间隔<=0时返回永不触发的定时器
+func newIntervalTimer(interval time.Duration) *time.Timer {
+	if interval <= 0 {
+		timer := time.NewTimer(time.Hour)
+		timer.Stop()
+		return timer
+	}
+	return time.NewTimer(interval)
+}
+
+// validateSetting 校验设置值是否符合定义
+func validateSetting(def SettingDef, value string) error {
+	switch def.Type {
+	case SettingTypeInt:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("设置项 %s 必须是整数", def.Key)
+		}
+		if n < def.Min {
+			return fmt.Errorf("设置项 %s 不能小于 %d", def.Key, def.Min)
+		}
+		if def.Max > 0 && n > def.Max {
+			return fmt.Errorf("设置项 %s 不能大于 %d", def.Key, def.Max)
+		}
+	case SettingTypeBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("设置项 %s 必须是布尔值", def.Key)
+		}
+	}
+	return nil
+}
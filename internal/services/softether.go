@@ -0,0 +1,196 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"l2tp-manager/internal/database"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SoftEther默认配置：siomiz/softethervpn镜像创建的虚拟Hub和SecureNAT的默认地址
+const (
+	softEtherDefaultHub       = "DEFAULT"
+	secureNATDefaultAddress   = "192.168.30.1/24"
+	secureNATDefaultDHCPStart = "192.168.30.10"
+	secureNATDefaultDHCPEnd   = "192.168.30.200"
+	// secureNATDHCPLease SecureNAT分配地址的租期(秒)
+	secureNATDHCPLease = 7200
+	// maxSecureNATDNS SecureNAT的DHCP最多推送两个DNS服务器
+	maxSecureNATDNS = 2
+	// softEtherReadyTimeout 容器启动后等待vpncmd可用的最长时间(秒)
+	softEtherReadyTimeout = 30
+)
+
+// softEtherHubPattern 虚拟Hub名称：字母、数字、下划线、点和连字符
+var softEtherHubPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// softEtherHub L2TP服务器使用的虚拟Hub，未设置时为镜像创建的DEFAULT
+func softEtherHub(server *database.L2TPServer) string {
+	if server.SoftEtherHub == "" {
+		return softEtherDefaultHub
+	}
+	return server.SoftEtherHub
+}
+
+// vpncmdCommand 在落地机容器中执行vpncmd命令，hub为空表示服务器级命令。参数由调用方转义
+func vpncmdCommand(hub, command string, args ...string) string {
+	target := "/SERVER"
+	if hub != "" {
+		target += " /HUB:" + hub
+	}
+	line := fmt.Sprintf("docker exec %s vpncmd localhost %s /CSV /CMD %s", l2tpContainerName, target, command)
+	if len(args) > 0 {
+		line += " " + strings.Join(args, " ")
+	}
+	return line
+}
+
+// secureNATNetwork SecureNAT虚拟主机地址及其网段，未设置时为SoftEther默认值
+func secureNATNetwork(server *database.L2TPServer) (net.IP, *net.IPNet, error) {
+	address := server.SecureNATAddress
+	if address == "" {
+		address = secureNATDefaultAddress
+	}
+	ip, network, err := net.ParseCIDR(address)
+	if err != nil || ip.To4() == nil {
+		return nil, nil, fmt.Errorf("SecureNAT地址必须是IPv4 CIDR格式，如 %s", secureNATDefaultAddress)
+	}
+	return ip.To4(), network, nil
+}
+
+// validateSoftEther 校验L2TP服务器的虚拟Hub、SecureNAT和DHCP地址范围，DNS设置由validateClientDNS校验
+func validateSoftEther(server *database.L2TPServer) error {
+	if server.Type != ServerTypeL2TP {
+		return nil
+	}
+	if server.SoftEtherHub != "" && !softEtherHubPattern.MatchString(server.SoftEtherHub) {
+		return fmt.Errorf("虚拟Hub名称只能包含字母、数字、下划线、点和连字符，最长64个字符")
+	}
+
+	if server.SecureNATDisabled {
+		if server.SecureNATAddress != "" || server.DHCPStart != "" || server.DHCPEnd != "" || server.ClientDNS != "" || server.DNSDomains != "" {
+			return fmt.Errorf("关闭SecureNAT时不能设置SecureNAT地址、DHCP地址范围和DNS服务器")
+		}
+		return nil
+	}
+
+	host, network, err := secureNATNetwork(server)
+	if err != nil {
+		return err
+	}
+	if (server.DHCPStart == "") != (server.DHCPEnd == "") {
+		return fmt.Errorf("DHCP地址范围需要同时设置起始和结束地址")
+	}
+	if server.DHCPStart == "" {
+		if server.SecureNATAddress != "" {
+			return fmt.Errorf("修改SecureNAT地址时需要同时设置DHCP地址范围")
+		}
+		return nil
+	}
+	start, end := net.ParseIP(server.DHCPStart).To4(), net.ParseIP(server.DHCPEnd).To4()
+	if start == nil || end == nil {
+		return fmt.Errorf("DHCP地址范围必须是IPv4地址")
+	}
+	if !network.Contains(start) || !network.Contains(end) {
+		return fmt.Errorf("DHCP地址范围必须在SecureNAT网段 %s 内", network)
+	}
+	if bytes.Compare(start, end) > 0 {
+		return fmt.Errorf("DHCP起始地址不能大于结束地址")
+	}
+	if bytes.Compare(start, host) <= 0 && bytes.Compare(host, end) <= 0 {
+		return fmt.Errorf("DHCP地址范围不能包含SecureNAT地址 %s", host)
+	}
+	return nil
+}
+
+// softEtherCommands 容器启动后在SoftEther中执行的vpncmd命令，未设置虚拟Hub、SecureNAT、DHCP和DNS时为空。
+// 使用自定义虚拟Hub时创建该Hub并在其中创建用户，L2TP/IPsec等未指定Hub的登录进入该Hub，之后删除镜像创建的DEFAULT Hub。
+// hubPassword为新建Hub的管理密码
+func softEtherCommands(server *database.L2TPServer, users []L2TPUser, hubPassword string) ([]string, error) {
+	if server.Type != ServerTypeL2TP {
+		return nil, nil
+	}
+	hub := softEtherHub(server)
+	var commands []string
+
+	if hub != softEtherDefaultHub {
+		commands = append(commands,
+			vpncmdCommand("", "HubCreate", hub, shellQuote("/PASSWORD:"+hubPassword)),
+			vpncmdCommand("", "IPsecEnable", "/L2TP:yes", "/L2TPRAW:yes", "/ETHERIP:no", shellQuote("/PSK:"+server.PSK), "/DEFAULTHUB:"+hub),
+		)
+		if len(users) == 0 {
+			users = []L2TPUser{{Username: "test", Password: "test123"}} // 与容器的默认用户一致
+		}
+		for _, user := range users {
+			commands = append(commands,
+				vpncmdCommand(hub, "UserCreate", shellQuote(user.Username), "/GROUP:none", "/REALNAME:none", "/NOTE:none"),
+				vpncmdCommand(hub, "UserPasswordSet", shellQuote(user.Username), shellQuote("/PASSWORD:"+user.Password)),
+			)
+		}
+		if !server.SecureNATDisabled {
+			commands = append(commands, vpncmdCommand(hub, "SecureNatEnable"))
+		}
+		commands = append(commands, vpncmdCommand("", "HubDelete", softEtherDefaultHub))
+	} else if server.SecureNATDisabled {
+		commands = append(commands, vpncmdCommand(hub, "SecureNatDisable"))
+	}
+	if server.SecureNATDisabled || (server.SecureNATAddress == "" && server.DHCPStart == "" && server.ClientDNS == "") {
+		return commands, nil
+	}
+
+	host, network, err := secureNATNetwork(server)
+	if err != nil {
+		return nil, err
+	}
+	mask := net.IP(network.Mask).String()
+	if server.SecureNATAddress != "" {
+		commands = append(commands, vpncmdCommand(hub, "SecureNatHostSet", "/MAC:none", "/IP:"+host.String(), "/MASK:"+mask))
+	}
+	start, end := server.DHCPStart, server.DHCPEnd
+	if start == "" {
+		start, end = secureNATDefaultDHCPStart, secureNATDefaultDHCPEnd
+	}
+	// 未指定DNS时使用SecureNAT的虚拟DNS代理。L2TP客户端不支持分流DNS，第一个分流域名作为DHCP下发的域名后缀
+	dns := []string{host.String(), "none"}
+	copy(dns, clientDNS(server))
+	domain := "none"
+	if domains := parseDNSDomains(server.DNSDomains); len(domains) > 0 {
+		domain = domains[0]
+	}
+	commands = append(commands, vpncmdCommand(hub, "DhcpSet",
+		"/START:"+start, "/END:"+end, "/MASK:"+mask, fmt.Sprintf("/EXPIRE:%d", secureNATDHCPLease),
+		"/GW:"+host.String(), "/DNS:"+dns[0], "/DNS2:"+dns[1], "/DOMAIN:"+domain, "/LOG:yes"))
+	return commands, nil
+}
+
+// applySoftEtherSettings 容器启动后应用虚拟Hub、SecureNAT、DHCP地址范围和DNS设置，未设置时不执行任何命令。
+// 设置保存在容器内的SoftEther配置中，容器重启后仍然有效，每次启动时重新创建容器并应用
+func (s *SSHService) applySoftEtherSettings(client *ssh.Client, server *database.L2TPServer, users []L2TPUser) error {
+	hubPassword, err := generateSecret(CredentialCharsetAlnum, 24)
+	if err != nil {
+		return err
+	}
+	commands, err := softEtherCommands(server, users, hubPassword)
+	if err != nil || len(commands) == 0 {
+		return err
+	}
+	s.transcript.hide(hubPassword)
+
+	// 等待容器中的SoftEther可以执行vpncmd
+	wait := fmt.Sprintf("for i in $(seq 1 %d); do %s >/dev/null 2>&1 && break; sleep 1; done",
+		softEtherReadyTimeout, vpncmdCommand("", "ServerStatusGet"))
+	if _, err := s.executeCommand(client, wait); err != nil {
+		return err
+	}
+	for _, command := range commands {
+		if _, err := s.executeCommand(client, command); err != nil {
+			return err
+		}
+	}
+	return nil
+}
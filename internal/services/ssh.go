@@ -1,50 +1,154 @@
 package services
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"l2tp-manager/internal/database"
+	"l2tp-manager/internal/logger"
+	"l2tp-manager/internal/metrics"
+	"net"
+	"path"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/crypto/ssh"
 )
 
+// 落地机容器配置
+const (
+	l2tpContainerName = "l2tp-server"
+	l2tpImage         = "siomiz/softethervpn:4.38-alpine"
+)
+
+// panelSigner 面板SSH密钥(ssh.Signer)，由注册脚本安装到落地机，服务器未设置密码时使用
+var panelSigner atomic.Value
+
+// SetPanelSSHKey 设置面板SSH密钥
+func SetPanelSSHKey(signer ssh.Signer) {
+	panelSigner.Store(signer)
+}
+
+// ExitNodeClient 落地机操作接口，由SSHService通过SSH实现，单元测试可替换为模拟实现
+type ExitNodeClient interface {
+	// WithContext 返回绑定ctx的客户端，ctx取消时关闭SSH连接
+	WithContext(ctx context.Context) ExitNodeClient
+	StartL2TPContainerWithCallback(server *database.L2TPServer, statusCallback func(step string, success bool, message string)) error
+	StopL2TPContainerWithCallback(server *database.L2TPServer, statusCallback func(step string, success bool, message string)) error
+	GetContainerStatus(server *database.L2TPServer) (map[string]interface{}, error)
+	GetServerLogs(server *database.L2TPServer, lines int) (string, error)
+	TailServerLogs(server *database.L2TPServer, lines int, since string) (string, error)
+	FollowServerLogs(ctx context.Context, server *database.L2TPServer, tail int, since string, onLine func(line string)) error
+	GetConnectedClients(server *database.L2TPServer) (int, error)
+	GetAccountCounters(server *database.L2TPServer) (map[string]AccountCounter, error)
+	SetAccountsEnabled(server *database.L2TPServer, usernames []string, enabled bool) error
+	ExitNodeStats(server *database.L2TPServer) (*ExitNodeStats, error)
+	RunningImageDigests(server *database.L2TPServer) ([]string, error)
+	InspectDeployment(server *database.L2TPServer, spec *deploymentSpec) (*deployedState, error)
+	SyntheticProbe(server *database.L2TPServer, host string, user L2TPUser, image string) (time.Duration, error)
+	SampleNATTraffic(server *database.L2TPServer, seconds int) (*NATTrafficSample, error)
+}
+
 // SSHService SSH连接服务
-type SSHService struct{}
+type SSHService struct {
+	ctx        context.Context // ctx取消时关闭SSH连接，为nil时不取消
+	trace      *logger.Trace   // 记录连接和命令耗时，用于诊断慢操作，为nil时不记录
+	transcript *Transcript     // 记录连接、命令及其输出，用于排查服务器操作失败，为nil时不记录
+}
 
 // NewSSHService 创建新的SSH服务
 func NewSSHService() *SSHService {
 	return &SSHService{}
 }
 
+// WithContext 返回绑定ctx的SSH服务：ctx取消(客户端断开连接、操作超时或面板关闭)时关闭SSH连接，
+// 正在执行的命令随之失败。ctx中有耗时记录(logger.WithTrace)时记录连接和命令耗时，
+// 有执行记录(服务器操作任务)时记录连接、命令及其输出
+func (s *SSHService) WithContext(ctx context.Context) ExitNodeClient {
+	return &SSHService{ctx: ctx, trace: logger.TraceFrom(ctx), transcript: transcriptFrom(ctx)}
+}
+
+// context 绑定的上下文，未绑定时为context.Background()
+func (s *SSHService) context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+// commandLabel 耗时记录中命令的简短描述：取第一行，最多60个字符
+func commandLabel(command string) string {
+	command, _, _ = strings.Cut(strings.TrimSpace(command), "\n")
+	if runes := []rune(command); len(runes) > 60 {
+		command = string(runes[:60]) + "..."
+	}
+	return command
+}
+
 
 
 // createSSHClient 创建SSH客户端连接
-func (s *SSHService) createSSHClient(server *database.L2TPServer) (*ssh.Client, error) {
+func (s *SSHService) createSSHClient(server *database.L2TPServer) (_ *ssh.Client, err error) {
+	s.transcript.hide(serverSecrets(server)...)
+	var auth []ssh.AuthMethod
+	if server.Password != "" {
+		auth = append(auth, ssh.Password(server.Password))
+	}
+	if signer, ok := panelSigner.Load().(ssh.Signer); ok {
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("SSH连接失败: 未设置密码且面板SSH密钥不可用")
+	}
+
 	config := &ssh.ClientConfig{
-		User: server.Username,
-		Auth: []ssh.AuthMethod{
-			ssh.Password(server.Password),
-		},
+		User:            server.Username,
+		Auth:            auth,
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
 		Timeout:         30 * time.Second,
 	}
 
 	address := fmt.Sprintf("%s:%d", server.Host, server.Port)
-	client, err := ssh.Dial("tcp", address, config)
+	defer s.trace.Track("ssh", "connect "+address)()
+	defer func(start time.Time) { s.transcript.connect(server.Username+"@"+address, start, err) }(time.Now())
+	ctx := s.context()
+	dialer := net.Dialer{Timeout: config.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
 	if err != nil {
 		return nil, fmt.Errorf("SSH连接失败: %v", err)
 	}
+	// 握手期间ctx取消时关闭连接，使握手立即返回
+	stopHandshake := context.AfterFunc(ctx, func() { conn.Close() })
+	clientConn, channels, requests, err := ssh.NewClientConn(conn, address, config)
+	stopHandshake()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("SSH连接失败: %v", err)
+	}
+	client := ssh.NewClient(clientConn, channels, requests)
 
+	// ctx取消时关闭连接，正在执行的命令立即返回；连接关闭后不再等待ctx，并从活动连接中移除
+	stop := context.AfterFunc(ctx, func() { client.Close() })
+	id := sshSessions.add(server, address)
+	go func() {
+		client.Wait()
+		stop()
+		sshSessions.remove(id)
+	}()
 	return client, nil
 }
 
 // executeCommand 执行SSH命令
 func (s *SSHService) executeCommand(client *ssh.Client, command string) (string, error) {
+	defer s.trace.Track("ssh", "exec "+commandLabel(command))()
+	start := time.Now()
 	session, err := client.NewSession()
 	if err != nil {
+		s.transcript.command(command, "", "", start, err)
 		return "", err
 	}
 	defer session.Close()
@@ -55,6 +159,7 @@ func (s *SSHService) executeCommand(client *ssh.Client, command string) (string,
 	session.Stderr = &stderr
 
 	err = session.Run(command)
+	s.transcript.command(command, output.String(), stderr.String(), start, err)
 	if err != nil {
 		if stderr.Len() > 0 {
 			return "", fmt.Errorf("命令执行失败: %v, stderr: %s", err, stderr.String())
@@ -71,7 +176,13 @@ func (s *SSHService) StartL2TPContainer(server *database.L2TPServer) error {
 }
 
 // StartL2TPContainerWithCallback 启动L2TP Docker容器
-func (s *SSHService) StartL2TPContainerWithCallback(server *database.L2TPServer, statusCallback func(step string, success bool, message string)) error {
+func (s *SSHService) StartL2TPContainerWithCallback(server *database.L2TPServer, statusCallback func(step string, success bool, message string)) (err error) {
+	defer func(start time.Time) { metrics.ObserveSSH("start", start, err) }(time.Now())
+
+	if server.Type == ServerTypeWireGuard {
+		return s.startWireGuard(server, statusCallback)
+	}
+
 	client, err := s.createSSHClient(server)
 	if err != nil {
 		if statusCallback != nil {
@@ -97,7 +208,7 @@ func (s *SSHService) StartL2TPContainerWithCallback(server *database.L2TPServer,
 		statusCallback("docker_check", true, "Docker环境检查通过")
 	}
 
-	containerName := "l2tp-server"
+	containerName := serverContainerName(server)
 
 	// 停止并清理现有容器
 	if err := s.cleanupExistingContainer(client, containerName); err != nil {
@@ -122,15 +233,25 @@ func (s *SSHService) StartL2TPContainerWithCallback(server *database.L2TPServer,
 		}
 	}
 
-	// 构建用户环境变量
-	userEnv := s.buildUserEnv(users)
+	// OpenVPN、IKEv2、Shadowsocks和VLESS服务器的配置和证书写入落地机，挂载到容器中
+	if dir, files, err := serverConfigFiles(server, users); err != nil || len(files) > 0 {
+		if err == nil {
+			err = s.writeRemoteFiles(client, dir, files)
+		}
+		if err != nil {
+			if statusCallback != nil {
+				statusCallback("config", false, fmt.Sprintf("写入配置文件失败: %v", err))
+			}
+			return fmt.Errorf("写入配置文件失败: %v", err)
+		}
+	}
 
 	if statusCallback != nil {
 		statusCallback("config", true, "用户配置解析完成")
 	}
 
 	// 拉取Docker镜像
-	pullCmd := "docker pull siomiz/softethervpn:4.38-alpine"
+	pullCmd := "docker pull " + serverImage(server)
 	if _, err := s.executeCommand(client, pullCmd); err != nil {
 		if statusCallback != nil {
 			statusCallback("image_pull", false, fmt.Sprintf("拉取Docker镜像失败: %v", err))
@@ -143,20 +264,7 @@ func (s *SSHService) StartL2TPContainerWithCallback(server *database.L2TPServer,
 	}
 
 	// 构建Docker运行命令
-	dockerCmd := fmt.Sprintf(`docker run -d \
-		--name %s \
-		--restart always \
-		-p 500:500/udp \
-		-p 4500:4500/udp \
-		-p 1701:1701/udp \
-		-e PSK=%s \
-		-e USERS="%s" \
-		--cap-add NET_ADMIN \
-		-v /lib/modules:/lib/modules:ro \
-		siomiz/softethervpn:4.38-alpine`,
-		containerName,
-		server.PSK, 
-		userEnv)
+	dockerCmd := s.dockerRunCommand(server, containerName, users)
 
 	// 启动容器
 	if _, err := s.executeCommand(client, dockerCmd); err != nil {
@@ -180,6 +288,15 @@ func (s *SSHService) StartL2TPContainerWithCallback(server *database.L2TPServer,
 		return fmt.Errorf("容器启动验证失败: %v", err)
 	}
 
+	// 应用L2TP服务器的虚拟Hub、SecureNAT、DHCP地址范围和DNS设置
+	if err := s.applySoftEtherSettings(client, server, users); err != nil {
+		s.cleanupExistingContainer(client, containerName)
+		if statusCallback != nil {
+			statusCallback("container_ready", false, fmt.Sprintf("应用SoftEther设置失败: %v", err))
+		}
+		return fmt.Errorf("应用SoftEther设置失败: %v", err)
+	}
+
 	if statusCallback != nil {
 		statusCallback("container_ready", true, "容器启动验证完成")
 	}
@@ -187,13 +304,106 @@ func (s *SSHService) StartL2TPContainerWithCallback(server *database.L2TPServer,
 	return nil
 }
 
+// dockerRunCommand 构建启动落地机容器的docker run命令
+func (s *SSHService) dockerRunCommand(server *database.L2TPServer, containerName string, users []L2TPUser) string {
+	switch server.Type {
+	case ServerTypeOpenVPN:
+		return openVPNRunCommand(server)
+	case ServerTypeIKEv2:
+		return ikev2RunCommand()
+	case ServerTypeShadowsocks, ServerTypeVLESS:
+		return xrayRunCommand(server)
+	}
+	return fmt.Sprintf(`docker run -d \
+		--name %s \
+		--restart always \
+		%s \
+		-e PSK=%s \
+		-e USERS="%s" \
+		--cap-add NET_ADMIN \
+		-v /lib/modules:/lib/modules:ro \
+		%s`,
+		containerName,
+		containerProtocolArgs(server),
+		server.PSK, 
+		s.buildUserEnv(users),
+		l2tpImage)
+}
+
+// remoteFile 写入落地机配置目录的文件，name为相对配置目录的路径
+type remoteFile struct {
+	name    string
+	content string
+	mode    string
+}
+
+// serverContainerName 落地机上运行VPN服务的容器名称
+func serverContainerName(server *database.L2TPServer) string {
+	switch server.Type {
+	case ServerTypeOpenVPN:
+		return openVPNContainerName
+	case ServerTypeIKEv2:
+		return ikev2ContainerName
+	case ServerTypeShadowsocks, ServerTypeVLESS:
+		return xrayContainerName
+	}
+	return l2tpContainerName
+}
+
+// serverImage 落地机容器使用的镜像
+func serverImage(server *database.L2TPServer) string {
+	switch server.Type {
+	case ServerTypeOpenVPN:
+		return openVPNImage
+	case ServerTypeIKEv2:
+		return ikev2Image
+	case ServerTypeShadowsocks, ServerTypeVLESS:
+		return xrayImage
+	}
+	return l2tpImage
+}
+
+// serverConfigFiles 返回写入落地机并挂载到容器的配置目录和文件，L2TP服务器通过环境变量配置，不需要配置文件
+func serverConfigFiles(server *database.L2TPServer, users []L2TPUser) (string, []remoteFile, error) {
+	switch server.Type {
+	case ServerTypeOpenVPN:
+		files, err := openVPNConfigFiles(server, users)
+		return openVPNConfigDir, files, err
+	case ServerTypeIKEv2:
+		files, err := ikev2ConfigFiles(server, users)
+		return ikev2ConfigDir, files, err
+	case ServerTypeShadowsocks, ServerTypeVLESS:
+		files, err := xrayConfigFiles(server)
+		return xrayConfigDir, files, err
+	}
+	return "", nil, nil
+}
+
+// writeRemoteFiles 将文件写入落地机目录，内容以base64传输，避免密码等内容被shell解析
+func (s *SSHService) writeRemoteFiles(client *ssh.Client, dir string, files []remoteFile) error {
+	commands := []string{fmt.Sprintf("mkdir -p %s", dir)}
+	for _, file := range files {
+		target := path.Join(dir, file.name)
+		commands = append(commands, fmt.Sprintf("mkdir -p %s && echo %s | base64 -d > %s && chmod %s %s",
+			path.Dir(target), base64.StdEncoding.EncodeToString([]byte(file.content)), target, file.mode, target))
+	}
+	_, err := s.executeCommand(client, strings.Join(commands, " && "))
+	return err
+}
+
 // StopL2TPContainer 停止L2TP Docker容器
 func (s *SSHService) StopL2TPContainer(server *database.L2TPServer) error {
 	return s.StopL2TPContainerWithCallback(server, nil)
 }
 
 // StopL2TPContainerWithCallback 停止L2TP Docker容器
-func (s *SSHService) StopL2TPContainerWithCallback(server *database.L2TPServer, statusCallback func(step string, success bool, message string)) error {
+func (s *SSHService) StopL2TPContainerWithCallback(server *database.L2TPServer, statusCallback func(step string, success bool, message string)) (err error) {
+	defer func(start time.Time) { metrics.ObserveSSH("stop", start, err) }(time.Now())
+
+	if server.Type == ServerTypeWireGuard {
+		return s.stopWireGuard(server, statusCallback)
+	}
+
 	client, err := s.createSSHClient(server)
 	if err != nil {
 		if statusCallback != nil {
@@ -207,7 +417,7 @@ func (s *SSHService) StopL2TPContainerWithCallback(server *database.L2TPServer,
 		statusCallback("ssh_connect", true, "SSH连接成功")
 	}
 
-	containerName := "l2tp-server"
+	containerName := serverContainerName(server)
 	
 	// 检查容器是否存在
 	checkCmd := fmt.Sprintf("docker ps -a -q -f name=^/%s$", containerName)
@@ -246,15 +456,21 @@ func (s *SSHService) StopL2TPContainerWithCallback(server *database.L2TPServer,
 }
 
 // GetContainerStatus 获取容器状态信息
-func (s *SSHService) GetContainerStatus(server *database.L2TPServer) (map[string]interface{}, error) {
+func (s *SSHService) GetContainerStatus(server *database.L2TPServer) (_ map[string]interface{}, err error) {
+	defer func(start time.Time) { metrics.ObserveSSH("status", start, err) }(time.Now())
+
 	client, err := s.createSSHClient(server)
 	if err != nil {
 		return nil, err
 	}
 	defer client.Close()
 
+	if server.Type == ServerTypeWireGuard {
+		return s.wireGuardStatus(client), nil
+	}
+
 	status := make(map[string]interface{})
-	containerName := "l2tp-server"
+	containerName := serverContainerName(server)
 
 	// 使用精确的容器名称匹配检查容器是否运行
 	checkCmd := fmt.Sprintf("docker ps -q -f name=^/%s$", containerName)
@@ -291,14 +507,24 @@ func (s *SSHService) GetContainerStatus(server *database.L2TPServer) (map[string
 }
 
 // GetServerLogs 获取服务器日志
-func (s *SSHService) GetServerLogs(server *database.L2TPServer, lines int) (string, error) {
+func (s *SSHService) GetServerLogs(server *database.L2TPServer, lines int) (_ string, err error) {
+	defer func(start time.Time) { metrics.ObserveSSH("logs", start, err) }(time.Now())
+
 	client, err := s.createSSHClient(server)
 	if err != nil {
 		return "", err
 	}
 	defer client.Close()
 
-	containerName := "l2tp-server"
+	if server.Type == ServerTypeWireGuard {
+		output, err := s.executeCommand(client, fmt.Sprintf("journalctl -u %s --no-pager -n %d 2>&1", wireGuardService, lines))
+		if err != nil {
+			return "", fmt.Errorf("获取日志失败: %v", err)
+		}
+		return output, nil
+	}
+
+	containerName := serverContainerName(server)
 	
 	// 首先检查容器是否存在
 	checkCmd := fmt.Sprintf("docker ps -a --filter name=%s --format '{{.Names}}'", containerName)
@@ -317,6 +543,172 @@ func (s *SSHService) GetServerLogs(server *database.L2TPServer, lines int) (stri
 	return output, nil
 }
 
+// TailServerLogs 获取带时间戳的容器日志，since非空时只返回该时间(docker日志时间戳)之后的日志，否则返回最后lines行。
+// WireGuard服务器读取wg-quick服务的journal日志，时间戳转换为相同格式
+func (s *SSHService) TailServerLogs(server *database.L2TPServer, lines int, since string) (_ string, err error) {
+	defer func(start time.Time) { metrics.ObserveSSH("logs", start, err) }(time.Now())
+
+	client, err := s.createSSHClient(server)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	containerName := serverContainerName(server)
+	command := fmt.Sprintf("docker logs --timestamps --tail %d %s 2>&1", lines, containerName)
+	if since != "" {
+		command = fmt.Sprintf("docker logs --timestamps --since %s %s 2>&1", since, containerName)
+	}
+	if server.Type == ServerTypeWireGuard {
+		command = wireGuardLogCommand(lines, since, false)
+	}
+	output, err := s.executeCommand(client, command)
+	if err != nil {
+		return "", fmt.Errorf("获取日志失败: %v", err)
+	}
+	if server.Type == ServerTypeWireGuard {
+		output = journalOutput(output)
+	}
+	return output, nil
+}
+
+// FollowServerLogs 在持久SSH会话中执行 docker logs -f，逐行回调直到ctx取消或容器日志结束。
+// since非空时从该docker时间戳开始，否则从最后tail行开始。WireGuard服务器改为跟随journal日志
+func (s *SSHService) FollowServerLogs(ctx context.Context, server *database.L2TPServer, tail int, since string, onLine func(line string)) error {
+	client, err := s.createSSHClient(server)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	containerName := serverContainerName(server)
+	command := fmt.Sprintf("docker logs -f --timestamps --tail %d %s 2>&1", tail, containerName)
+	if since != "" {
+		command = fmt.Sprintf("docker logs -f --timestamps --since %s %s 2>&1", since, containerName)
+	}
+	if server.Type == ServerTypeWireGuard {
+		// journalctl的输出转换为与docker日志相同的时间戳格式
+		command = wireGuardLogCommand(tail, since, true)
+		follow := onLine
+		onLine = func(line string) { follow(journalLine(line)) }
+	}
+	if err := session.Start(command); err != nil {
+		return fmt.Errorf("跟随日志失败: %v", err)
+	}
+
+	// ctx取消时关闭连接，使读取立即返回，远端进程随会话结束退出
+	stop := context.AfterFunc(ctx, func() { client.Close() })
+	defer stop()
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		onLine(scanner.Text())
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("读取日志失败: %v", err)
+	}
+	if err := session.Wait(); err != nil {
+		return fmt.Errorf("日志跟随已结束: %v", err)
+	}
+	return nil
+}
+
+// GetConnectedClients 获取容器内当前VPN会话数量
+func (s *SSHService) GetConnectedClients(server *database.L2TPServer) (_ int, err error) {
+	defer func(start time.Time) { metrics.ObserveSSH("sessions", start, err) }(time.Now())
+
+	client, err := s.createSSHClient(server)
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+
+	return s.connectedClients(client, server)
+}
+
+// connectedClients 通过已建立的SSH连接统计在线客户端数
+func (s *SSHService) connectedClients(client *ssh.Client, server *database.L2TPServer) (int, error) {
+	if server.Type == ServerTypeWireGuard {
+		return s.wireGuardClients(client)
+	}
+	if server.Type == ServerTypeOpenVPN {
+		return s.openVPNClients(client)
+	}
+	if server.Type == ServerTypeIKEv2 {
+		return s.ikev2Clients(client)
+	}
+	if isXrayServer(server.Type) {
+		return s.xrayClients(client, server)
+	}
+
+	command := vpncmdCommand(softEtherHub(server), "SessionList")
+	output, err := s.executeCommand(client, command)
+	if err != nil {
+		return 0, fmt.Errorf("获取会话列表失败: %v", err)
+	}
+
+	return countSessions(output), nil
+}
+
+// countSessions 统计vpncmd SessionList的CSV输出中的用户会话(忽略表头和SecureNAT等内部会话)
+func countSessions(output string) int {
+	count := 0
+	for i, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		line = strings.TrimSpace(line)
+		if i == 0 || line == "" {
+			continue
+		}
+		if strings.Contains(line, "SecureNAT") || strings.Contains(line, "Local Bridge") {
+			continue
+		}
+		count++
+	}
+	return count
+}
+
+// GetAccountCounters 读取落地机SoftEther各用户的累计传输计数：先列出虚拟Hub中的用户，再逐个执行UserGet
+func (s *SSHService) GetAccountCounters(server *database.L2TPServer) (_ map[string]AccountCounter, err error) {
+	defer func(start time.Time) { metrics.ObserveSSH("accounts", start, err) }(time.Now())
+
+	if server.Type != ServerTypeL2TP {
+		return nil, fmt.Errorf("只有L2TP服务器支持账号流量统计")
+	}
+	client, err := s.createSSHClient(server)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	hub := softEtherHub(server)
+	output, err := s.executeCommand(client, vpncmdCommand(hub, "UserList"))
+	if err != nil {
+		return nil, fmt.Errorf("获取用户列表失败: %v", err)
+	}
+	usernames, err := parseUserNames(output)
+	if err != nil || len(usernames) == 0 {
+		return map[string]AccountCounter{}, err
+	}
+	output, err = s.executeCommand(client, userGetScript(hub, usernames))
+	if err != nil {
+		return nil, fmt.Errorf("获取用户流量失败: %v", err)
+	}
+	return parseUserGet(output), nil
+}
+
 // ensureDockerInstalled 确保Docker已安装并运行
 func (s *SSHService) ensureDockerInstalled(client *ssh.Client) error {
 	// 检查Docker是否已安装并运行
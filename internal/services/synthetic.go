@@ -0,0 +1,262 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"l2tp-manager/internal/database"
+	"l2tp-manager/internal/metrics"
+
+	"gorm.io/gorm"
+)
+
+// 端到端拨测设置项
+const (
+	SettingSyntheticInterval = "synthetic_check_interval"
+	SettingSyntheticEndpoint = "synthetic_check_endpoint"
+	SettingSyntheticImage    = "synthetic_check_image"
+)
+
+// 拨测参数
+const (
+	syntheticSessionTimeout = 30                 // 等待PPP会话建立的秒数
+	syntheticRetention      = 7 * 24 * time.Hour // 拨测记录保留时长
+	syntheticHistoryLimit   = 100
+)
+
+// syntheticProbeScript 在拨测容器内运行：socat将本地1701端口转发到中转入口，xl2tpd和pppd经此建立L2TP会话，
+// ppp0获得地址即视为整条链路可用。镜像中没有xl2tpd时用apk安装
+const syntheticProbeScript = `
+command -v xl2tpd >/dev/null 2>&1 || apk add --no-cache -q xl2tpd ppp-daemon socat >/dev/null 2>&1 || { echo "PROBE_FAIL 安装xl2tpd/pppd/socat失败"; exit 0; }
+esc() { printf '%s' "$1" | sed 's/[\\"]/\\&/g'; }
+mkdir -p /etc/xl2tpd /etc/ppp /var/run/xl2tpd
+cat > /etc/xl2tpd/xl2tpd.conf <<CONF
+[global]
+port = 1702
+[lac probe]
+lns = 127.0.0.1
+pppoptfile = /etc/ppp/options.probe
+length bit = yes
+CONF
+cat > /etc/ppp/options.probe <<CONF
+ipcp-accept-local
+ipcp-accept-remote
+refuse-eap
+noccp
+noauth
+nodefaultroute
+mtu 1400
+mru 1400
+user "$(esc "$PROBE_USER")"
+password "$(esc "$PROBE_PASSWORD")"
+CONF
+socat UDP4-LISTEN:1701,bind=127.0.0.1,reuseaddr UDP4:$PROBE_HOST:$PROBE_PORT &
+xl2tpd -c /etc/xl2tpd/xl2tpd.conf -C /var/run/xl2tpd/l2tp-control -D >/tmp/xl2tpd.log 2>&1 &
+sleep 1
+start=$(cut -d' ' -f1 /proc/uptime)
+echo "c probe" > /var/run/xl2tpd/l2tp-control
+i=0
+while [ $i -lt $((PROBE_TIMEOUT * 5)) ]; do
+  if ip -4 addr show ppp0 2>/dev/null | grep -q inet; then
+    end=$(cut -d' ' -f1 /proc/uptime)
+    echo "PROBE_OK $(awk "BEGIN {printf \"%d\", ($end - $start) * 1000}")"
+    exit 0
+  fi
+  sleep 0.2
+  i=$((i + 1))
+done
+echo "PROBE_FAIL PPP会话未在${PROBE_TIMEOUT}秒内建立"
+tail -n 5 /tmp/xl2tpd.log
+`
+
+// SyntheticService 端到端拨测：定期通过中转入口与落地机建立真实的L2TP会话，验证整条链路可用，而不只是端口可达
+type SyntheticService struct {
+	db          *gorm.DB
+	settings    *SettingsService
+	l2tpService *L2TPService
+}
+
+// NewSyntheticService 创建拨测服务并注册其设置项
+func NewSyntheticService(db *gorm.DB, settings *SettingsService, l2tpService *L2TPService) *SyntheticService {
+	settings.Register(SettingDef{Key: SettingSyntheticInterval, Type: SettingTypeInt, Default: "0", Description: "L2TP端到端拨测间隔(秒)，0表示关闭"})
+	settings.Register(SettingDef{Key: SettingSyntheticEndpoint, Type: SettingTypeString, Description: "由面板本机转发的服务器的拨测入口地址(面板的公网地址)，为空时这些服务器不拨测"})
+	settings.Register(SettingDef{Key: SettingSyntheticImage, Type: SettingTypeString, Default: "alpine:3.20", Description: "在落地机上运行拨测客户端的镜像，未预装xl2tpd、pppd和socat时用apk安装"})
+	return &SyntheticService{db: db, settings: settings, l2tpService: l2tpService}
+}
+
+// Start 按设置的间隔拨测全部运行中的L2TP服务器，间隔修改后立即生效
+func (s *SyntheticService) Start(ctx context.Context) {
+	changed := s.settings.Watch(SettingSyntheticInterval)
+	for {
+		timer := newIntervalTimer(s.settings.Seconds(SettingSyntheticInterval))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-changed:
+			timer.Stop()
+		case <-timer.C:
+			s.checkAll(ctx)
+		}
+	}
+}
+
+// checkAll 并发拨测所有运行中的L2TP服务器并清理过期记录
+func (s *SyntheticService) checkAll(ctx context.Context) {
+	var servers []database.L2TPServer
+	if err := s.db.WithContext(ctx).Where("status = ? AND type = ?", "running", ServerTypeL2TP).Find(&servers).Error; err != nil {
+		slog.Error("加载运行中服务器失败", "error", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i := range servers {
+		wg.Add(1)
+		go func(server *database.L2TPServer) {
+			defer wg.Done()
+			s.check(ctx, server)
+		}(&servers[i])
+	}
+	wg.Wait()
+
+	if err := s.db.Where("created_at < ?", time.Now().Add(-syntheticRetention)).Delete(&database.SyntheticCheck{}).Error; err != nil {
+		slog.Warn("清理拨测记录失败", "error", err)
+	}
+}
+
+// endpoint 客户端连接的中转入口地址：由中转节点转发时为节点的对外地址，本机转发时为设置的面板地址
+func (s *SyntheticService) endpoint(server *database.L2TPServer) (string, error) {
+	if server.RelayNodeID != 0 {
+		var node database.RelayNode
+		if err := s.db.First(&node, server.RelayNodeID).Error; err != nil {
+			return "", fmt.Errorf("中转节点不存在")
+		}
+		return RelayNodeAddress(&node), nil
+	}
+	host := strings.TrimSpace(s.settings.Get(SettingSyntheticEndpoint))
+	if host == "" {
+		return "", fmt.Errorf("未设置拨测入口地址(%s)", SettingSyntheticEndpoint)
+	}
+	return host, nil
+}
+
+// check 拨测一台服务器并保存结果，由成功变为失败时发送通知。ctx取消时中止拨测，结果不保存
+func (s *SyntheticService) check(ctx context.Context, server *database.L2TPServer) *database.SyntheticCheck {
+	record := &database.SyntheticCheck{ServerID: server.ID}
+	err := func() error {
+		var users []L2TPUser
+		if server.Users != "" {
+			if err := json.Unmarshal([]byte(server.Users), &users); err != nil {
+				return fmt.Errorf("解析用户配置失败: %v", err)
+			}
+		}
+		if len(users) == 0 {
+			return fmt.Errorf("服务器没有可用于拨测的用户")
+		}
+		host, err := s.endpoint(server)
+		if err != nil {
+			return err
+		}
+		record.Endpoint = net.JoinHostPort(host, strconv.Itoa(server.L2TPPort))
+		latency, err := s.l2tpService.SSH().WithContext(ctx).SyntheticProbe(server, host, users[0], s.settings.Get(SettingSyntheticImage))
+		record.LatencyMs = latency.Milliseconds()
+		return err
+	}()
+	if ctx.Err() != nil {
+		record.Error = ctx.Err().Error()
+		return record
+	}
+	record.Success = err == nil
+	if err != nil {
+		record.Error = err.Error()
+		slog.Warn("端到端拨测失败", "server_id", server.ID, "error", err)
+	}
+
+	var previous database.SyntheticCheck
+	s.db.Where("server_id = ?", server.ID).Order("id DESC").Limit(1).Find(&previous)
+	if err := s.db.Create(record).Error; err != nil {
+		slog.Error("保存拨测记录失败", "server_id", server.ID, "error", err)
+	}
+
+	if !record.Success && (previous.ID == 0 || previous.Success) {
+		s.l2tpService.publishData(EventSyntheticFailed, server.ID, server.Name,
+			fmt.Sprintf("服务器 \"%s\" 经中转入口 %s 拨测失败: %s", server.Name, record.Endpoint, record.Error),
+			map[string]interface{}{"endpoint": record.Endpoint})
+	}
+	return record
+}
+
+// Run 立即拨测一台运行中的L2TP服务器，请求断开时中止拨测
+func (s *SyntheticService) Run(ctx context.Context, id uint) (*database.SyntheticCheck, error) {
+	var server database.L2TPServer
+	if err := s.db.WithContext(ctx).First(&server, id).Error; err != nil {
+		return nil, fmt.Errorf("服务器不存在")
+	}
+	if server.Type != ServerTypeL2TP {
+		return nil, fmt.Errorf("只支持拨测L2TP服务器")
+	}
+	if server.Status != "running" {
+		return nil, fmt.Errorf("服务器未运行")
+	}
+	return s.check(ctx, &server), nil
+}
+
+// History 服务器最近的拨测记录，最新的在前
+func (s *SyntheticService) History(id uint, limit int) ([]database.SyntheticCheck, error) {
+	if limit <= 0 || limit > syntheticHistoryLimit {
+		limit = syntheticHistoryLimit
+	}
+	records := []database.SyntheticCheck{}
+	err := s.db.Where("server_id = ?", id).Order("id DESC").Limit(limit).Find(&records).Error
+	return records, err
+}
+
+// SyntheticProbe 在落地机上运行一次性的拨测容器，经中转入口host与本服务器建立L2TP会话，返回会话建立耗时
+func (s *SSHService) SyntheticProbe(server *database.L2TPServer, host string, user L2TPUser, image string) (_ time.Duration, err error) {
+	defer func(start time.Time) { metrics.ObserveSSH("synthetic", start, err) }(time.Now())
+
+	client, err := s.createSSHClient(server)
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+
+	name := fmt.Sprintf("l2tp-synthetic-%d", server.ID)
+	command := fmt.Sprintf("modprobe ppp_generic 2>/dev/null; docker rm -f %s >/dev/null 2>&1; "+
+		"timeout %d docker run --rm --name %s --privileged -e PROBE_HOST=%s -e PROBE_PORT=%d -e PROBE_USER=%s -e PROBE_PASSWORD=%s -e PROBE_TIMEOUT=%d %s sh -c %s",
+		name, syntheticSessionTimeout+120, name, shellQuote(host), server.L2TPPort, shellQuote(user.Username), shellQuote(user.Password),
+		syntheticSessionTimeout, shellQuote(image), shellQuote(syntheticProbeScript))
+	output, err := s.executeCommand(client, command)
+	if err != nil {
+		return 0, fmt.Errorf("运行拨测容器失败: %v", err)
+	}
+	return parseProbeOutput(output)
+}
+
+// parseProbeOutput 解析拨测脚本的输出
+func parseProbeOutput(output string) (time.Duration, error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	for i, line := range lines {
+		if ms, ok := strings.CutPrefix(line, "PROBE_OK "); ok {
+			value, err := strconv.ParseInt(strings.TrimSpace(ms), 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("无法解析拨测耗时: %s", ms)
+			}
+			return time.Duration(value) * time.Millisecond, nil
+		}
+		if reason, ok := strings.CutPrefix(line, "PROBE_FAIL "); ok {
+			if detail := strings.TrimSpace(strings.Join(lines[i+1:], "\n")); detail != "" {
+				reason += ": " + detail
+			}
+			return 0, fmt.Errorf("%s", reason)
+		}
+	}
+	return 0, fmt.Errorf("拨测容器没有输出结果")
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// systemd socket activation 传入的第一个文件描述符
+const systemdListenFDStart = 3
+
+// SystemdNotify 通过sd_notify协议向systemd报告状态(如 READY=1)，未由systemd以Type=notify启动时不做任何事
+func SystemdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:] // 抽象命名空间
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("连接systemd通知套接字失败: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("发送systemd通知失败: %v", err)
+	}
+	return nil
+}
+
+// SystemdReloading 通知systemd开始重新加载，配合Type=notify-reload使用，完成后需再发送READY=1
+func SystemdReloading() error {
+	return SystemdNotify(fmt.Sprintf("RELOADING=1\nMONOTONIC_USEC=%d", monotonicMicros()))
+}
+
+// StartSystemdWatchdog 按WATCHDOG_USEC的一半间隔发送心跳，未启用看门狗时直接返回
+func StartSystemdWatchdog(ctx context.Context) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(usec) * time.Microsecond / 2)
+	defer ticker.Stop()
+	slog.Info("已启用systemd看门狗", "interval", time.Duration(usec)*time.Microsecond/2)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := SystemdNotify("WATCHDOG=1"); err != nil {
+				slog.Warn("发送systemd看门狗心跳失败", "error", err)
+			}
+		}
+	}
+}
+
+// systemdListenFiles 接管systemd socket activation传入的套接字，文件名取自LISTEN_FDNAMES，
+// 未命名的为 fd3、fd4...。读取后清除相关环境变量，避免重启后的进程重复接管
+func systemdListenFiles() []*os.File {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil
+	}
+
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	files := make([]*os.File, 0, count)
+	for i := 0; i < count; i++ {
+		fd := systemdListenFDStart + i
+		name := fmt.Sprintf("fd%d", fd)
+		if i < len(names) && names[i] != "" && names[i] != "unknown" {
+			name = names[i]
+		}
+		// systemd传入的描述符未设置FD_CLOEXEC，交由os.File管理后再按需交接
+		files = append(files, os.NewFile(uintptr(fd), name))
+	}
+	return files
+}
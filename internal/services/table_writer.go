@@ -0,0 +1,184 @@
+package services
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 导出格式
+const (
+	ExportFormatCSV  = "csv"
+	ExportFormatXLSX = "xlsx"
+	ExportFormatPDF  = "pdf"
+)
+
+// TableWriter 按行流式写出表格数据
+type TableWriter interface {
+	Write(row []interface{}) error
+	Close() error
+}
+
+// NewTableWriter 创建指定格式的表格写入器，返回写入器和Content-Type
+func NewTableWriter(format string, w io.Writer) (TableWriter, string, error) {
+	switch format {
+	case ExportFormatCSV:
+		// 写入UTF-8 BOM，便于Excel正确识别中文
+		if _, err := w.Write([]byte("\xEF\xBB\xBF")); err != nil {
+			return nil, "", err
+		}
+		return &csvTableWriter{w: csv.NewWriter(w)}, "text/csv; charset=utf-8", nil
+	case ExportFormatXLSX:
+		writer, err := newXLSXTableWriter(w)
+		if err != nil {
+			return nil, "", err
+		}
+		return writer, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", nil
+	case ExportFormatPDF:
+		writer, err := newPDFTableWriter(w)
+		if err != nil {
+			return nil, "", err
+		}
+		return writer, "application/pdf", nil
+	default:
+		return nil, "", fmt.Errorf("不支持的导出格式: %s", format)
+	}
+}
+
+// formatCell 将单元格值格式化为文本。以=、+、-、@、制表符或回车开头的字符串会被表格软件当作公式，
+// 前面加单引号按文本显示，避免导出的服务器名称等内容在打开文件时被执行
+func formatCell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+			return "'" + v
+		}
+		return v
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.Format("2006-01-02 15:04:05")
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// csvTableWriter CSV表格写入器
+type csvTableWriter struct {
+	w    *csv.Writer
+	rows int
+}
+
+// Write 写入一行
+func (c *csvTableWriter) Write(row []interface{}) error {
+	record := make([]string, len(row))
+	for i, value := range row {
+		record[i] = formatCell(value)
+	}
+	if err := c.w.Write(record); err != nil {
+		return err
+	}
+
+	// 定期刷新，避免大数据量时占用过多内存
+	c.rows++
+	if c.rows%1000 == 0 {
+		c.w.Flush()
+	}
+	return c.w.Error()
+}
+
+// Close 刷新缓冲区
+func (c *csvTableWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// xlsx固定部件
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`
+	xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`
+	xlsxSheetHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	xlsxSheetFooter = `</sheetData></worksheet>`
+)
+
+// xlsxTableWriter 单工作表XLSX写入器，工作表内容直接流式写入zip
+type xlsxTableWriter struct {
+	zw    *zip.Writer
+	sheet *bufio.Writer
+}
+
+// newXLSXTableWriter 写入固定部件并打开工作表
+func newXLSXTableWriter(w io.Writer) (*xlsxTableWriter, error) {
+	zw := zip.NewWriter(w)
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	}
+	for _, part := range parts {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.body); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	sheet := bufio.NewWriter(f)
+	if _, err := sheet.WriteString(xlsxSheetHeader); err != nil {
+		return nil, err
+	}
+	return &xlsxTableWriter{zw: zw, sheet: sheet}, nil
+}
+
+// Write 写入一行，数值写为数字单元格，其余写为内联字符串
+func (x *xlsxTableWriter) Write(row []interface{}) error {
+	x.sheet.WriteString("<row>")
+	for _, value := range row {
+		switch v := value.(type) {
+		case int, int64, uint, float64:
+			fmt.Fprintf(x.sheet, "<c><v>%v</v></c>", v)
+		default:
+			x.sheet.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+			xml.EscapeText(x.sheet, []byte(formatCell(v)))
+			x.sheet.WriteString("</t></is></c>")
+		}
+	}
+	_, err := x.sheet.WriteString("</row>")
+	return err
+}
+
+// Close 结束工作表并写入zip目录
+func (x *xlsxTableWriter) Close() error {
+	if _, err := x.sheet.WriteString(xlsxSheetFooter); err != nil {
+		return err
+	}
+	if err := x.sheet.Flush(); err != nil {
+		return err
+	}
+	return x.zw.Close()
+}
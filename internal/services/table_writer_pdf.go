@@ -0,0 +1,241 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PDF版面参数(A4横向，单位pt)
+const (
+	pdfPageWidth    = 842.0
+	pdfPageHeight   = 595.0
+	pdfMargin       = 30.0
+	pdfFontSize     = 9.0
+	pdfRowHeight    = 16.0
+	pdfCellPadding  = 4.0
+	pdfMaxColWidth  = 220.0
+	pdfRowsPerPage  = 31 // (页高-页边距)/行高，扣除表头和页脚
+	pdfFirstPageObj = 6  // 1-5为目录、页面树和字体
+)
+
+// pdfFontObjects 字体对象：Adobe预定义的宋体CID字体(STSong-Light)，阅读器自带，无需嵌入字体即可显示中文
+var pdfFontObjects = []string{
+	"<< /Type /Font /Subtype /Type0 /BaseFont /STSong-Light /Encoding /UniGB-UCS2-H /DescendantFonts [4 0 R] >>",
+	"<< /Type /Font /Subtype /CIDFontType0 /BaseFont /STSong-Light /CIDSystemInfo << /Registry (Adobe) /Ordering (GB1) /Supplement 2 >> /FontDescriptor 5 0 R /DW 1000 /W [1 95 500] >>",
+	"<< /Type /FontDescriptor /FontName /STSong-Light /Flags 6 /FontBBox [-25 -254 1000 880] /ItalicAngle 0 /Ascent 880 /Descent -120 /CapHeight 880 /StemV 93 >>",
+}
+
+// countingWriter 记录已写出的字节数，用于生成PDF交叉引用表
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write 写出并计数
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// pdfTableWriter 表格PDF写入器，首行为表头并在每页重复；列宽按首页内容计算，逐页写出
+type pdfTableWriter struct {
+	w       *countingWriter
+	offsets map[int]int64
+	pages   []int
+	header  []string
+	rows    [][]string
+	widths  []float64
+	err     error
+}
+
+// newPDFTableWriter 写入文件头和字体对象
+func newPDFTableWriter(w io.Writer) (*pdfTableWriter, error) {
+	p := &pdfTableWriter{w: &countingWriter{w: w}, offsets: make(map[int]int64)}
+	if _, err := io.WriteString(p.w, "%PDF-1.4\n%\xe2\xe3\xcf\xd3\n"); err != nil {
+		return nil, err
+	}
+	for i, body := range pdfFontObjects {
+		if err := p.writeObject(3+i, body); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// writeObject 写出一个间接对象并记录偏移
+func (p *pdfTableWriter) writeObject(num int, body string) error {
+	p.offsets[num] = p.w.n
+	_, err := fmt.Fprintf(p.w, "%d 0 obj\n%s\nendobj\n", num, body)
+	return err
+}
+
+// Write 写入一行，凑满一页后写出该页
+func (p *pdfTableWriter) Write(row []interface{}) error {
+	if p.err != nil {
+		return p.err
+	}
+	cells := make([]string, len(row))
+	for i, value := range row {
+		cells[i] = formatCell(value)
+	}
+	if p.header == nil {
+		p.header = cells
+		return nil
+	}
+	p.rows = append(p.rows, cells)
+	if len(p.rows) >= pdfRowsPerPage {
+		p.err = p.flushPage()
+	}
+	return p.err
+}
+
+// pdfTextWidth 估算文本宽度：CJK等全角字符1em，ASCII半角0.5em
+func pdfTextWidth(text string) float64 {
+	width := 0.0
+	for _, r := range text {
+		if r < 0x80 {
+			width += 0.5
+		} else {
+			width += 1
+		}
+	}
+	return width * pdfFontSize
+}
+
+// pdfTruncate 截断文本使其不超过指定宽度
+func pdfTruncate(text string, width float64) string {
+	if pdfTextWidth(text) <= width {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 && pdfTextWidth(string(runes)+"..") > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + ".."
+}
+
+// pdfHex 将文本编码为UCS-2十六进制字符串，超出基本平面的字符替换为问号
+func pdfHex(text string) string {
+	var b strings.Builder
+	b.WriteByte('<')
+	for _, r := range text {
+		if r > 0xFFFF {
+			r = '?'
+		}
+		fmt.Fprintf(&b, "%04X", r)
+	}
+	b.WriteByte('>')
+	return b.String()
+}
+
+// layout 按表头和首页内容计算列宽，总宽超出版心时等比缩小
+func (p *pdfTableWriter) layout() {
+	columns := len(p.header)
+	for _, row := range p.rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+	p.widths = make([]float64, columns)
+	total := 0.0
+	for i := range p.widths {
+		width := 0.0
+		for _, row := range append([][]string{p.header}, p.rows...) {
+			if i < len(row) && pdfTextWidth(row[i]) > width {
+				width = pdfTextWidth(row[i])
+			}
+		}
+		width += 2 * pdfCellPadding
+		if width > pdfMaxColWidth {
+			width = pdfMaxColWidth
+		}
+		p.widths[i] = width
+		total += width
+	}
+	if available := pdfPageWidth - 2*pdfMargin; total > available {
+		for i := range p.widths {
+			p.widths[i] *= available / total
+		}
+	}
+}
+
+// flushPage 将缓冲的行写成一页
+func (p *pdfTableWriter) flushPage() error {
+	if p.widths == nil {
+		p.layout()
+	}
+	tableWidth := 0.0
+	for _, width := range p.widths {
+		tableWidth += width
+	}
+
+	var content strings.Builder
+	y := pdfPageHeight - pdfMargin
+	fmt.Fprintf(&content, "0.9 g %.2f %.2f %.2f %.2f re f 0 g\n", pdfMargin, y-pdfRowHeight, tableWidth, pdfRowHeight)
+	content.WriteString("0.5 w\n")
+	for i, row := range append([][]string{p.header}, p.rows...) {
+		x := pdfMargin
+		for j, width := range p.widths {
+			if j < len(row) && row[j] != "" {
+				text := pdfTruncate(row[j], width-2*pdfCellPadding)
+				fmt.Fprintf(&content, "BT /F1 %.0f Tf %.2f %.2f Td %s Tj ET\n", pdfFontSize, x+pdfCellPadding, y-pdfRowHeight+4.5, pdfHex(text))
+			}
+			x += width
+		}
+		if i == 0 {
+			fmt.Fprintf(&content, "%.2f %.2f m %.2f %.2f l S\n", pdfMargin, y, pdfMargin+tableWidth, y)
+		}
+		y -= pdfRowHeight
+		fmt.Fprintf(&content, "%.2f %.2f m %.2f %.2f l S\n", pdfMargin, y, pdfMargin+tableWidth, y)
+	}
+	footer := fmt.Sprintf("- %d -", len(p.pages)+1)
+	fmt.Fprintf(&content, "BT /F1 %.0f Tf %.2f %.2f Td %s Tj ET\n", pdfFontSize, (pdfPageWidth-pdfTextWidth(footer))/2, pdfMargin/2, pdfHex(footer))
+
+	contentObj := pdfFirstPageObj + 2*len(p.pages)
+	stream := content.String()
+	if err := p.writeObject(contentObj, fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", len(stream), stream)); err != nil {
+		return err
+	}
+	pageObj := contentObj + 1
+	page := fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", pdfPageWidth, pdfPageHeight, contentObj)
+	if err := p.writeObject(pageObj, page); err != nil {
+		return err
+	}
+	p.pages = append(p.pages, pageObj)
+	p.rows = p.rows[:0]
+	return nil
+}
+
+// Close 写出剩余的行、页面树和交叉引用表
+func (p *pdfTableWriter) Close() error {
+	if p.err != nil {
+		return p.err
+	}
+	if len(p.rows) > 0 || len(p.pages) == 0 {
+		if err := p.flushPage(); err != nil {
+			return err
+		}
+	}
+
+	kids := make([]string, len(p.pages))
+	for i, page := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", page)
+	}
+	if err := p.writeObject(2, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages))); err != nil {
+		return err
+	}
+	if err := p.writeObject(1, "<< /Type /Catalog /Pages 2 0 R >>"); err != nil {
+		return err
+	}
+
+	xref := p.w.n
+	size := len(p.offsets) + 1
+	fmt.Fprintf(p.w, "xref\n0 %d\n0000000000 65535 f \n", size)
+	for num := 1; num < size; num++ {
+		fmt.Fprintf(p.w, "%010d 00000 n \n", p.offsets[num])
+	}
+	_, err := fmt.Fprintf(p.w, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", size, xref)
+	return err
+}
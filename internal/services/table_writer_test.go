@@ -0,0 +1,47 @@
+package services
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestFormatCellEscapesFormulas(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{"=HYPERLINK(\"http://example.com\")", "'=HYPERLINK(\"http://example.com\")"},
+		{"+1+1", "'+1+1"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"\r=1", "'\r=1"},
+		{"server-1", "server-1"},
+		{"", ""},
+		{-5, "-5"},
+		{int64(-1024), "-1024"},
+	}
+	for _, tt := range tests {
+		if got := formatCell(tt.value); got != tt.want {
+			t.Errorf("formatCell(%q) = %q, 期望 %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestCSVTableWriterEscapesFormulas(t *testing.T) {
+	var buf bytes.Buffer
+	writer, _, err := NewTableWriter(ExportFormatCSV, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Write([]interface{}{"=1+2", "-3", int64(-3)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimPrefix(buf.String(), "\xEF\xBB\xBF"); got != "'=1+2,'-3,-3\n" {
+		t.Fatalf("CSV内容为 %q", got)
+	}
+}
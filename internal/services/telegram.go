@@ -0,0 +1,342 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"l2tp-manager/internal/database"
+	"l2tp-manager/internal/logger"
+
+	"gorm.io/gorm"
+)
+
+// Telegram设置项
+const (
+	SettingTelegramBotToken     = "telegram_bot_token"
+	SettingTelegramChatIDs      = "telegram_chat_ids"
+	SettingTelegramAllowedUsers = "telegram_allowed_users"
+)
+
+// Telegram轮询参数
+const (
+	telegramPollTimeout = 25 * time.Second // getUpdates长轮询等待时长
+	telegramRetryDelay  = 5 * time.Second  // 请求失败后的重试间隔
+)
+
+// TelegramDefaultEvents 默认推送到Telegram的告警事件
+var TelegramDefaultEvents = []string{
+	EventServerError,
+	EventServerExpiring,
+	EventServerExpired,
+	EventAutoRestart,
+	EventQuotaExceeded,
+	EventAccountSuspended,
+	EventLoginNewIP,
+	EventResourceHigh,
+}
+
+// TelegramService Telegram机器人：推送告警并响应白名单用户的控制命令
+type TelegramService struct {
+	db             *gorm.DB
+	settings       *SettingsService
+	l2tpService    *L2TPService
+	routingService Forwarding
+	auditService   *AuditService
+	apiURL         string
+	client         *http.Client
+}
+
+// NewTelegramService 创建Telegram服务并注册其设置项，apiURL为Bot API地址(支持自建服务)
+func NewTelegramService(db *gorm.DB, settings *SettingsService, l2tpService *L2TPService, routingService Forwarding, auditService *AuditService, apiURL string) *TelegramService {
+	settings.Register(SettingDef{Key: SettingTelegramBotToken, Type: SettingTypeString, Secret: true, Description: "Telegram机器人令牌，为空表示关闭"})
+	settings.Register(SettingDef{Key: SettingTelegramChatIDs, Type: SettingTypeString, Description: "接收告警的Chat ID，逗号分隔"})
+	settings.Register(SettingDef{Key: SettingTelegramAllowedUsers, Type: SettingTypeString, Description: "允许执行命令的Telegram用户ID，逗号分隔"})
+
+	return &TelegramService{
+		db:             db,
+		settings:       settings,
+		l2tpService:    l2tpService,
+		routingService: routingService,
+		auditService:   auditService,
+		apiURL:         strings.TrimSuffix(apiURL, "/"),
+		// 超时需大于长轮询等待时长
+		client: &http.Client{Timeout: telegramPollTimeout + 10*time.Second},
+	}
+}
+
+// Name 渠道名称
+func (t *TelegramService) Name() string {
+	return "telegram"
+}
+
+// Send 将订阅的事件推送到全部配置的Chat
+func (t *TelegramService) Send(event Event) error {
+	token := t.settings.Get(SettingTelegramBotToken)
+	chatIDs := splitList(t.settings.Get(SettingTelegramChatIDs))
+	if token == "" || len(chatIDs) == 0 {
+		return ErrChannelNotConfigured
+	}
+
+	text := fmt.Sprintf("【%s】\n%s\n%s", EventTitle(event.Type), event.Message, event.Time.Format("2006-01-02 15:04:05"))
+	var lastErr error
+	for _, chatID := range chatIDs {
+		if err := t.sendMessage(context.Background(), token, chatID, text); err != nil {
+			lastErr = fmt.Errorf("chat %s: %v", chatID, err)
+		}
+	}
+	return lastErr
+}
+
+// Start 长轮询接收命令，令牌为空时等待设置变更
+func (t *TelegramService) Start(ctx context.Context) {
+	changed := t.settings.Watch(SettingTelegramBotToken)
+	var offset int64
+
+	for {
+		token := t.settings.Get(SettingTelegramBotToken)
+		if token == "" {
+			select {
+			case <-ctx.Done():
+				return
+			case <-changed:
+				offset = 0
+				continue
+			}
+		}
+
+		updates, err := t.getUpdates(ctx, token, offset)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Warn("获取Telegram消息失败", "error", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-changed:
+				offset = 0
+			case <-time.After(telegramRetryDelay):
+			}
+			continue
+		}
+
+		for _, update := range updates {
+			offset = update.UpdateID + 1
+			if update.Message != nil {
+				t.handleMessage(ctx, token, update.Message)
+			}
+		}
+	}
+}
+
+// telegramUpdate getUpdates返回的单条更新
+type telegramUpdate struct {
+	UpdateID int64            `json:"update_id"`
+	Message  *telegramMessage `json:"message"`
+}
+
+// telegramMessage Telegram消息
+type telegramMessage struct {
+	Text string `json:"text"`
+	From struct {
+		ID       int64  `json:"id"`
+		Username string `json:"username"`
+	} `json:"from"`
+	Chat struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+}
+
+// handleMessage 处理一条命令消息，非白名单用户拒绝执行
+func (t *TelegramService) handleMessage(ctx context.Context, token string, msg *telegramMessage) {
+	fields := strings.Fields(msg.Text)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return
+	}
+	// 群组中的命令形如 /status@bot_name
+	command := strings.SplitN(fields[0], "@", 2)[0]
+	arg := strings.TrimSpace(strings.TrimPrefix(msg.Text, fields[0]))
+	chatID := strconv.FormatInt(msg.Chat.ID, 10)
+	userID := strconv.FormatInt(msg.From.ID, 10)
+
+	if !containsString(splitList(t.settings.Get(SettingTelegramAllowedUsers)), userID) {
+		slog.Warn("拒绝未授权的Telegram命令", "telegram_user", userID, "command", command)
+		t.reply(ctx, token, chatID, "无权限执行命令，请将用户ID "+userID+" 加入白名单")
+		return
+	}
+
+	var text string
+	switch command {
+	case "/status":
+		text = t.statusText()
+	case "/start", "/stop":
+		if arg == "" {
+			text = "用法: " + command + " <服务器名称>"
+			break
+		}
+		text = t.control(ctx, command == "/start", arg, "telegram:"+userID)
+	default:
+		text = "可用命令:\n/status 查看服务器状态\n/start <名称> 启动服务器\n/stop <名称> 停止服务器"
+	}
+	t.reply(ctx, token, chatID, text)
+}
+
+// statusText 生成服务器状态摘要
+func (t *TelegramService) statusText() string {
+	servers, err := t.l2tpService.GetServers()
+	if err != nil {
+		return "获取服务器列表失败: " + err.Error()
+	}
+	if len(servers) == 0 {
+		return "暂无服务器"
+	}
+
+	var b strings.Builder
+	running := 0
+	for _, server := range servers {
+		if server.Status == "running" {
+			running++
+		}
+		fmt.Fprintf(&b, "%s: %s (端口 %d)\n", server.Name, server.Status, server.L2TPPort)
+	}
+	fmt.Fprintf(&b, "共 %d 台，运行中 %d 台", len(servers), running)
+	return b.String()
+}
+
+// control 按名称启动或停止服务器
+func (t *TelegramService) control(ctx context.Context, start bool, name, operator string) string {
+	var server database.L2TPServer
+	result := t.db.Where("name = ?", name).Limit(1).Find(&server)
+	if result.Error != nil {
+		return "查询服务器失败: " + result.Error.Error()
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Sprintf("服务器 \"%s\" 不存在", name)
+	}
+
+	ctx = logger.WithRequestID(ctx, "telegram-"+logger.NewRequestID())
+	action, status, verb := "stop", "stopped", "停止"
+	if start {
+		action, status, verb = "start", "running", "启动"
+	}
+	if server.Status == status {
+		return fmt.Sprintf("服务器 \"%s\" 已处于%s状态", name, server.Status)
+	}
+
+	var err error
+	if start {
+		err = t.l2tpService.StartServer(ctx, server.ID)
+	} else {
+		err = t.l2tpService.StopServer(ctx, server.ID)
+	}
+	if err != nil {
+		t.auditService.Record(server.ID, action, operator, "failed", err.Error())
+		return fmt.Sprintf("%s失败: %v", verb, err)
+	}
+
+	// 与面板操作一致，同时更新期望状态和转发器状态
+	t.l2tpService.SetDesiredState(server.ID, status)
+	t.routingService.UpdateServerStatus(server.ID, status)
+	t.auditService.Record(server.ID, action, operator, "success", "Telegram命令")
+	slog.InfoContext(ctx, "Telegram命令已执行", "server_id", server.ID, "action", action, "operator", operator)
+	return fmt.Sprintf("服务器 \"%s\" 正在%s", name, verb)
+}
+
+// reply 回复消息，失败只记录日志
+func (t *TelegramService) reply(ctx context.Context, token, chatID, text string) {
+	if err := t.sendMessage(ctx, token, chatID, text); err != nil {
+		slog.Warn("Telegram消息发送失败", "chat_id", chatID, "error", err)
+	}
+}
+
+// telegramResponse Bot API通用响应
+type telegramResponse struct {
+	OK          bool            `json:"ok"`
+	Description string          `json:"description"`
+	Result      json.RawMessage `json:"result"`
+}
+
+// call 调用Bot API方法
+func (t *TelegramService) call(ctx context.Context, token, method string, params interface{}) (json.RawMessage, error) {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := t.apiURL + "/bot" + url.PathEscape(token) + "/" + method
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		// 错误信息中的URL包含令牌，不能原样返回
+		return nil, fmt.Errorf("请求 %s 失败: %s", method, strings.ReplaceAll(err.Error(), token, secretMask))
+	}
+	defer resp.Body.Close()
+
+	var result telegramResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("解析 %s 响应失败: HTTP %d", method, resp.StatusCode)
+	}
+	if !result.OK {
+		return nil, fmt.Errorf("%s: %s", method, result.Description)
+	}
+	return result.Result, nil
+}
+
+// sendMessage 发送文本消息
+func (t *TelegramService) sendMessage(ctx context.Context, token, chatID, text string) error {
+	_, err := t.call(ctx, token, "sendMessage", map[string]interface{}{
+		"chat_id": chatID,
+		"text":    text,
+	})
+	return err
+}
+
+// getUpdates 长轮询获取新消息
+func (t *TelegramService) getUpdates(ctx context.Context, token string, offset int64) ([]telegramUpdate, error) {
+	raw, err := t.call(ctx, token, "getUpdates", map[string]interface{}{
+		"offset":          offset,
+		"timeout":         int(telegramPollTimeout.Seconds()),
+		"allowed_updates": []string{"message"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var updates []telegramUpdate
+	if err := json.Unmarshal(raw, &updates); err != nil {
+		return nil, err
+	}
+	return updates, nil
+}
+
+// splitList 拆分逗号分隔的列表，忽略空项
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// containsString 判断列表中是否包含指定值
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
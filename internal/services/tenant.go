@@ -0,0 +1,467 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"l2tp-manager/internal/database"
+
+	"gorm.io/gorm"
+)
+
+// tenantEnforceInterval 检查租户月流量配额的间隔
+const tenantEnforceInterval = 5 * time.Minute
+
+// ErrTenantDisabled 租户已停用
+var ErrTenantDisabled = errors.New("租户已停用")
+
+// TenantService 多租户：管理租户和租户用户、服务器归属，以及服务器数量和月流量配额
+type TenantService struct {
+	db          *gorm.DB
+	l2tpService *L2TPService
+	notified    map[uint]string // 租户ID -> 已发送超额通知的月份
+}
+
+// TenantRequest 创建或修改租户的参数
+type TenantRequest struct {
+	Name           string `json:"name" binding:"required"`
+	MaxServers     int    `json:"max_servers" binding:"gte=0"`      // 服务器数量上限，0表示不限
+	TrafficQuotaGB int64  `json:"traffic_quota_gb" binding:"gte=0"` // 每月流量配额(GB)，0表示不限
+	Disabled       bool   `json:"disabled"`
+	Note           string `json:"note"`
+}
+
+// TenantUserRequest 创建租户用户的参数
+type TenantUserRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// TenantUsage 租户及其资源用量
+type TenantUsage struct {
+	database.Tenant
+	Servers       int64 `json:"servers"`     // 服务器数量(不含回收站)
+	Users         int64 `json:"users"`       // 用户数量
+	MonthBytes    int64 `json:"month_bytes"` // 本月至今的流量，含已删除的服务器
+	QuotaExceeded bool  `json:"quota_exceeded"`
+}
+
+// NewTenantService 创建租户服务
+func NewTenantService(db *gorm.DB, l2tpService *L2TPService) *TenantService {
+	return &TenantService{db: db, l2tpService: l2tpService, notified: make(map[uint]string)}
+}
+
+// TenantServers 将服务器查询限定在租户内的gorm作用域，tenantID为0(超级管理员)时不限制
+func TenantServers(tenantID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if tenantID == 0 {
+			return db
+		}
+		return db.Where("tenant_id = ?", tenantID)
+	}
+}
+
+// tenantServerIDs 将按server_id关联服务器的查询(流量、审计等)限定在租户的服务器内，含已删除的服务器
+func tenantServerIDs(column string, tenantID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if tenantID == 0 {
+			return db
+		}
+		servers := db.Session(&gorm.Session{NewDB: true}).Unscoped().
+			Model(&database.L2TPServer{}).Select("id").Where("tenant_id = ?", tenantID)
+		return db.Where(column+" IN (?)", servers)
+	}
+}
+
+// quotaBytes 租户的月流量配额(字节)，0表示不限
+func quotaBytes(tenant *database.Tenant) int64 {
+	return tenant.TrafficQuotaGB * 1024 * 1024 * 1024
+}
+
+// tenantMonthBytes 租户本月至今的流量(按天样本)，含已删除的服务器，避免删除重建绕过配额
+func tenantMonthBytes(db *gorm.DB, tenantID uint, now time.Time) (int64, error) {
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	var total int64
+	err := db.Model(&database.TrafficSample{}).
+		Scopes(tenantServerIDs("server_id", tenantID)).
+		Select("COALESCE(SUM(bytes), 0)").
+		Where("granularity = ? AND bucket >= ?", GranularityDay, month).
+		Scan(&total).Error
+	return total, err
+}
+
+// findTenant 查找租户，不存在时返回错误
+func findTenant(db *gorm.DB, tenantID uint) (*database.Tenant, error) {
+	var tenant database.Tenant
+	if err := db.Limit(1).Find(&tenant, tenantID).Error; err != nil {
+		return nil, err
+	}
+	if tenant.ID == 0 {
+		return nil, fmt.Errorf("租户不存在")
+	}
+	return &tenant, nil
+}
+
+// checkTenantQuota 检查租户存在、未停用且服务器数量未达上限，在创建、恢复和分配服务器的事务中调用
+func checkTenantQuota(tx *gorm.DB, tenantID uint) error {
+	if tenantID == 0 {
+		return nil
+	}
+	tenant, err := findTenant(tx, tenantID)
+	if err != nil {
+		return err
+	}
+	if tenant.Disabled {
+		return ErrTenantDisabled
+	}
+	if tenant.MaxServers <= 0 {
+		return nil
+	}
+	var count int64
+	if err := tx.Model(&database.L2TPServer{}).Where("tenant_id = ?", tenantID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count >= int64(tenant.MaxServers) {
+		return fmt.Errorf("租户 \"%s\" 的服务器数量已达上限 %d", tenant.Name, tenant.MaxServers)
+	}
+	return nil
+}
+
+// checkTenantTraffic 租户本月流量超出配额时拒绝启动服务器
+func checkTenantTraffic(db *gorm.DB, tenantID uint) error {
+	if tenantID == 0 {
+		return nil
+	}
+	tenant, err := findTenant(db, tenantID)
+	if err != nil {
+		return err
+	}
+	if tenant.Disabled {
+		return ErrTenantDisabled
+	}
+	quota := quotaBytes(tenant)
+	if quota <= 0 {
+		return nil
+	}
+	used, err := tenantMonthBytes(db, tenantID, time.Now())
+	if err != nil {
+		return err
+	}
+	if used >= quota {
+		return fmt.Errorf("租户本月流量 %s 已超出配额 %dGB，无法启动服务器", FormatBytes(used), tenant.TrafficQuotaGB)
+	}
+	return nil
+}
+
+// validate 校验租户参数
+func (req *TenantRequest) validate() error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return fmt.Errorf("租户名称不能为空")
+	}
+	if req.MaxServers < 0 || req.TrafficQuotaGB < 0 {
+		return fmt.Errorf("配额不能为负数")
+	}
+	return nil
+}
+
+// usage 统计租户的用量
+func (t *TenantService) usage(tenant database.Tenant) (TenantUsage, error) {
+	usage := TenantUsage{Tenant: tenant}
+	if err := t.db.Model(&database.L2TPServer{}).Where("tenant_id = ?", tenant.ID).Count(&usage.Servers).Error; err != nil {
+		return usage, err
+	}
+	if err := t.db.Model(&database.User{}).Where("tenant_id = ?", tenant.ID).Count(&usage.Users).Error; err != nil {
+		return usage, err
+	}
+	var err error
+	if usage.MonthBytes, err = tenantMonthBytes(t.db, tenant.ID, time.Now()); err != nil {
+		return usage, err
+	}
+	quota := quotaBytes(&tenant)
+	usage.QuotaExceeded = quota > 0 && usage.MonthBytes >= quota
+	return usage, nil
+}
+
+// List 列出全部租户及其用量
+func (t *TenantService) List() ([]TenantUsage, error) {
+	var tenants []database.Tenant
+	if err := t.db.Order("id").Find(&tenants).Error; err != nil {
+		return nil, err
+	}
+	result := make([]TenantUsage, 0, len(tenants))
+	for _, tenant := range tenants {
+		usage, err := t.usage(tenant)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, usage)
+	}
+	return result, nil
+}
+
+// Get 获取租户及其用量
+func (t *TenantService) Get(id uint) (*TenantUsage, error) {
+	tenant, err := findTenant(t.db, id)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := t.usage(*tenant)
+	if err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+// Create 创建租户
+func (t *TenantService) Create(req TenantRequest) (*database.Tenant, error) {
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	var count int64
+	if err := t.db.Model(&database.Tenant{}).Where("name = ?", req.Name).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("租户 \"%s\" 已存在", req.Name)
+	}
+	tenant := &database.Tenant{
+		Name:           req.Name,
+		MaxServers:     req.MaxServers,
+		TrafficQuotaGB: req.TrafficQuotaGB,
+		Disabled:       req.Disabled,
+		Note:           req.Note,
+	}
+	if err := t.db.Create(tenant).Error; err != nil {
+		return nil, err
+	}
+	return tenant, nil
+}
+
+// Update 修改租户名称、配额和停用状态
+func (t *TenantService) Update(id uint, req TenantRequest) (*database.Tenant, error) {
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	tenant, err := findTenant(t.db, id)
+	if err != nil {
+		return nil, err
+	}
+	var count int64
+	if err := t.db.Model(&database.Tenant{}).Where("name = ? AND id != ?", req.Name, id).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("租户 \"%s\" 已存在", req.Name)
+	}
+	tenant.Name = req.Name
+	tenant.MaxServers = req.MaxServers
+	tenant.TrafficQuotaGB = req.TrafficQuotaGB
+	tenant.Disabled = req.Disabled
+	tenant.Note = req.Note
+	if err := t.db.Save(tenant).Error; err != nil {
+		return nil, err
+	}
+	return tenant, nil
+}
+
+// Delete 删除租户及其用户，租户下还有服务器(含回收站)时拒绝删除
+func (t *TenantService) Delete(id uint) error {
+	if _, err := findTenant(t.db, id); err != nil {
+		return err
+	}
+	return t.db.Transaction(func(tx *gorm.DB) error {
+		var servers int64
+		if err := tx.Unscoped().Model(&database.L2TPServer{}).Where("tenant_id = ?", id).Count(&servers).Error; err != nil {
+			return err
+		}
+		if servers > 0 {
+			return fmt.Errorf("租户下还有 %d 台服务器(含回收站)，请先删除或转移", servers)
+		}
+		if err := tx.Where("tenant_id = ?", id).Delete(&database.User{}).Error; err != nil {
+			return err
+		}
+		// 租户的端口池收回为平台共享
+		if err := tx.Model(&database.PortPool{}).Where("tenant_id = ?", id).Update("tenant_id", 0).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&database.Tenant{}, id).Error
+	})
+}
+
+// ListUsers 列出租户的用户
+func (t *TenantService) ListUsers(tenantID uint) ([]database.User, error) {
+	if _, err := findTenant(t.db, tenantID); err != nil {
+		return nil, err
+	}
+	users := []database.User{}
+	err := t.db.Where("tenant_id = ?", tenantID).Order("id").Find(&users).Error
+	return users, err
+}
+
+// CreateUser 为租户创建用户，用户名在全部租户中唯一
+func (t *TenantService) CreateUser(tenantID uint, req TenantUserRequest) (*database.User, error) {
+	if _, err := findTenant(t.db, tenantID); err != nil {
+		return nil, err
+	}
+	req.Username = strings.TrimSpace(req.Username)
+	if req.Username == "" || req.Password == "" {
+		return nil, fmt.Errorf("用户名和密码不能为空")
+	}
+	var count int64
+	if err := t.db.Model(&database.User{}).Where("username = ?", req.Username).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("用户名 \"%s\" 已存在", req.Username)
+	}
+	user := &database.User{Username: req.Username, Password: req.Password, TenantID: tenantID}
+	if err := t.db.Create(user).Error; err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// DeleteUser 删除租户的用户
+func (t *TenantService) DeleteUser(tenantID, userID uint) error {
+	result := t.db.Where("tenant_id = ?", tenantID).Delete(&database.User{}, userID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("用户不存在")
+	}
+	return nil
+}
+
+// AssignServer 将服务器(含回收站中的)分配给租户，tenantID为0表示收回到平台
+func (t *TenantService) AssignServer(serverID, tenantID uint) (*database.L2TPServer, error) {
+	portMutex.Lock()
+	defer portMutex.Unlock()
+
+	var server database.L2TPServer
+	err := t.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Limit(1).Find(&server, serverID).Error; err != nil {
+			return err
+		}
+		if server.ID == 0 {
+			return fmt.Errorf("服务器不存在")
+		}
+		if server.TenantID == tenantID {
+			return nil
+		}
+		if err := checkTenantQuota(tx, tenantID); err != nil {
+			return err
+		}
+		if err := checkPortPools(tx, RelayPorts(&server), tenantID); err != nil {
+			return err
+		}
+		server.TenantID = tenantID
+		return tx.Unscoped().Model(&server).UpdateColumn("tenant_id", tenantID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &server, nil
+}
+
+// Active 检查租户存在且未停用，tenantID为0时直接通过
+func (t *TenantService) Active(tenantID uint) error {
+	if tenantID == 0 {
+		return nil
+	}
+	tenant, err := findTenant(t.db, tenantID)
+	if err != nil {
+		return err
+	}
+	if tenant.Disabled {
+		return ErrTenantDisabled
+	}
+	return nil
+}
+
+// ServerTenant 服务器所属的租户(含回收站中的服务器)，服务器不存在时返回false
+func (t *TenantService) ServerTenant(serverID uint) (uint, bool) {
+	var server database.L2TPServer
+	if err := t.db.Unscoped().Select("id", "tenant_id").Limit(1).Find(&server, serverID).Error; err != nil || server.ID == 0 {
+		return 0, false
+	}
+	return server.TenantID, true
+}
+
+// OwnsServer 服务器是否对租户可见，tenantID为0(超级管理员)时全部可见
+func (t *TenantService) OwnsServer(tenantID, serverID uint) bool {
+	if tenantID == 0 {
+		return true
+	}
+	owner, ok := t.ServerTenant(serverID)
+	return ok && owner == tenantID
+}
+
+// Start 定期检查租户的月流量配额，超额时停止其服务器并发送通知
+func (t *TenantService) Start(ctx context.Context) {
+	ticker := time.NewTicker(tenantEnforceInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := t.enforceQuotas(ctx, time.Now()); err != nil {
+			slog.Error("检查租户流量配额失败", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// enforceQuotas 将超出月流量配额的租户的服务器期望状态设为停止并停止运行中的服务器，每个租户每月通知一次
+func (t *TenantService) enforceQuotas(ctx context.Context, now time.Time) error {
+	var tenants []database.Tenant
+	if err := t.db.Where("traffic_quota_gb > 0").Find(&tenants).Error; err != nil {
+		return err
+	}
+	period := usagePeriod(now)
+	for i := range tenants {
+		tenant := &tenants[i]
+		used, err := tenantMonthBytes(t.db, tenant.ID, now)
+		if err != nil {
+			return err
+		}
+		if used < quotaBytes(tenant) {
+			continue
+		}
+
+		var servers []database.L2TPServer
+		if err := t.db.Where("tenant_id = ? AND (desired_state = ? OR status = ?)", tenant.ID, "running", "running").Find(&servers).Error; err != nil {
+			return err
+		}
+		message := fmt.Sprintf("租户 \"%s\" 本月流量 %s 已超出配额 %dGB，服务器已停止", tenant.Name, FormatBytes(used), tenant.TrafficQuotaGB)
+		for _, server := range servers {
+			if err := t.l2tpService.SetDesiredState(server.ID, "stopped"); err != nil {
+				slog.Error("停止超额租户的服务器失败", "tenant", tenant.Name, "server", server.Name, "error", err)
+				continue
+			}
+			if server.Status == "running" {
+				if err := t.l2tpService.StopServer(ctx, server.ID); err != nil {
+					slog.Warn("停止超额租户的服务器失败", "tenant", tenant.Name, "server", server.Name, "error", err)
+				}
+			}
+			if t.notified[tenant.ID] != period {
+				t.l2tpService.publishData(EventQuotaExceeded, server.ID, server.Name, message, map[string]interface{}{
+					"tenant_id": tenant.ID, "tenant": tenant.Name, "bytes": used, "quota_gb": tenant.TrafficQuotaGB,
+				})
+			}
+		}
+		if t.notified[tenant.ID] != period {
+			t.notified[tenant.ID] = period
+			slog.Warn("租户流量超出配额", "tenant", tenant.Name, "bytes", used, "quota_gb", tenant.TrafficQuotaGB)
+		}
+	}
+	return nil
+}
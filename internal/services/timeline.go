@@ -0,0 +1,197 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"l2tp-manager/internal/database"
+
+	"gorm.io/gorm"
+)
+
+// 时间线事件类型
+const (
+	TimelineStatus    = "status"    // 可用性变化(运行/停止/故障)
+	TimelineOperation = "operation" // 面板操作和计划任务(启动、停止、重启等)
+	TimelineHealth    = "health"    // 健康检查触发的自动重启
+	TimelineConfig    = "config"    // 配置修订
+	TimelineAlert     = "alert"     // 告警触发和恢复
+	TimelineSynthetic = "synthetic" // 端到端拨测失败
+)
+
+// timelineDefaultLimit 时间线默认和最多返回的事件数
+const (
+	timelineDefaultLimit = 200
+	timelineMaxLimit     = 1000
+)
+
+// TimelineEvent 时间线中的一个事件
+type TimelineEvent struct {
+	Time     time.Time `json:"time"`
+	Type     string    `json:"type"`
+	Title    string    `json:"title"`
+	Detail   string    `json:"detail,omitempty"`
+	Result   string    `json:"result,omitempty"`
+	Username string    `json:"username,omitempty"`
+	Source   string    `json:"source"` // 来源记录，如 audit:12、revision:3
+}
+
+// TimelineQuery 时间线查询条件，Types为空表示全部类型
+type TimelineQuery struct {
+	Since time.Time
+	Until time.Time
+	Types []string
+	Limit int
+}
+
+// TimelineService 将服务器的状态变化、操作、配置修订、健康事件和告警汇总为一条按时间排序的时间线
+type TimelineService struct {
+	db *gorm.DB
+}
+
+// NewTimelineService 创建时间线服务
+func NewTimelineService(db *gorm.DB) *TimelineService {
+	return &TimelineService{db: db}
+}
+
+// Timeline 服务器在[Since, Until]内的事件，最新的在前
+func (t *TimelineService) Timeline(serverID uint, q TimelineQuery) ([]TimelineEvent, error) {
+	if q.Limit <= 0 || q.Limit > timelineMaxLimit {
+		q.Limit = timelineDefaultLimit
+	}
+	if q.Until.IsZero() {
+		q.Until = time.Now()
+	}
+	wanted := func(kind string) bool {
+		if len(q.Types) == 0 {
+			return true
+		}
+		for _, t := range q.Types {
+			if t == kind {
+				return true
+			}
+		}
+		return false
+	}
+	// query 按服务器和时间范围查询一种记录，每种最多取Limit条
+	query := func(column string) *gorm.DB {
+		return t.db.Where("server_id = ? AND "+column+" >= ? AND "+column+" <= ?", serverID, q.Since, q.Until).
+			Order(column + " DESC").Limit(q.Limit)
+	}
+
+	events := []TimelineEvent{}
+	if wanted(TimelineStatus) {
+		var changes []database.ServerStatusChange
+		if err := query("changed_at").Find(&changes).Error; err != nil {
+			return nil, err
+		}
+		for _, change := range changes {
+			events = append(events, TimelineEvent{
+				Time:   change.ChangedAt,
+				Type:   TimelineStatus,
+				Title:  "可用性变为 " + change.State,
+				Detail: change.Reason,
+				Source: fmt.Sprintf("status:%d", change.ID),
+			})
+		}
+	}
+
+	if wanted(TimelineOperation) || wanted(TimelineHealth) {
+		var logs []database.AuditLog
+		if err := query("created_at").Find(&logs).Error; err != nil {
+			return nil, err
+		}
+		for _, log := range logs {
+			kind := TimelineOperation
+			if log.Action == "auto_restart" {
+				kind = TimelineHealth
+			}
+			if !wanted(kind) {
+				continue
+			}
+			events = append(events, TimelineEvent{
+				Time:     log.CreatedAt,
+				Type:     kind,
+				Title:    log.Action,
+				Detail:   log.Detail,
+				Result:   log.Result,
+				Username: log.Username,
+				Source:   fmt.Sprintf("audit:%d", log.ID),
+			})
+		}
+	}
+
+	if wanted(TimelineConfig) {
+		var revisions []database.ServerRevision
+		if err := query("created_at").Find(&revisions).Error; err != nil {
+			return nil, err
+		}
+		for _, revision := range revisions {
+			events = append(events, TimelineEvent{
+				Time:     revision.CreatedAt,
+				Type:     TimelineConfig,
+				Title:    fmt.Sprintf("配置修订 v%d (%s)", revision.Version, revision.Action),
+				Detail:   revision.Diff,
+				Username: revision.Username,
+				Source:   fmt.Sprintf("revision:%d", revision.ID),
+			})
+		}
+	}
+
+	if wanted(TimelineAlert) {
+		// 告警按触发时间查询，恢复时间在范围内的单独列出
+		var records []database.AlertRecord
+		err := t.db.Where("server_id = ? AND ((fired_at >= ? AND fired_at <= ?) OR (resolved_at >= ? AND resolved_at <= ?))",
+			serverID, q.Since, q.Until, q.Since, q.Until).Order("fired_at DESC").Limit(q.Limit).Find(&records).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			source := fmt.Sprintf("alert:%d", record.ID)
+			if !record.FiredAt.Before(q.Since) && !record.FiredAt.After(q.Until) {
+				events = append(events, TimelineEvent{
+					Time:   record.FiredAt,
+					Type:   TimelineAlert,
+					Title:  "告警触发: " + record.RuleName,
+					Detail: record.Message,
+					Result: AlertStateFiring,
+					Source: source,
+				})
+			}
+			if record.ResolvedAt != nil && !record.ResolvedAt.Before(q.Since) && !record.ResolvedAt.After(q.Until) {
+				events = append(events, TimelineEvent{
+					Time:   *record.ResolvedAt,
+					Type:   TimelineAlert,
+					Title:  "告警恢复: " + record.RuleName,
+					Detail: record.Message,
+					Result: AlertStateResolved,
+					Source: source,
+				})
+			}
+		}
+	}
+
+	if wanted(TimelineSynthetic) {
+		var checks []database.SyntheticCheck
+		if err := query("created_at").Where("success = ?", false).Find(&checks).Error; err != nil {
+			return nil, err
+		}
+		for _, check := range checks {
+			events = append(events, TimelineEvent{
+				Time:   check.CreatedAt,
+				Type:   TimelineSynthetic,
+				Title:  "端到端拨测失败",
+				Detail: check.Error,
+				Result: "failed",
+				Source: fmt.Sprintf("synthetic:%d", check.ID),
+			})
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.After(events[j].Time) })
+	if len(events) > q.Limit {
+		events = events[:q.Limit]
+	}
+	return events, nil
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"l2tp-manager/internal/database"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 流量样本粒度
+const (
+	GranularityHour = "hour"
+	GranularityDay  = "day"
+)
+
+// TrafficPoint 流量时间序列中的一个点
+type TrafficPoint struct {
+	Time  time.Time `json:"time"`
+	Bytes int64     `json:"bytes"`
+}
+
+// TrafficHistory 流量时间序列
+type TrafficHistory struct {
+	ServerID    uint           `json:"server_id,omitempty"`
+	Range       string         `json:"range"`
+	Granularity string         `json:"granularity"`
+	Points      []TrafficPoint `json:"points"`
+	TotalBytes  int64          `json:"total_bytes"`
+}
+
+// historyRanges 支持的时间范围及对应粒度
+var historyRanges = map[string]struct {
+	duration    time.Duration
+	granularity string
+}{
+	"24h": {24 * time.Hour, GranularityHour},
+	"7d":  {7 * 24 * time.Hour, GranularityHour},
+	"30d": {30 * 24 * time.Hour, GranularityDay},
+	"90d": {90 * 24 * time.Hour, GranularityDay},
+}
+
+// bucketStart 计算时间所在桶的起点
+func bucketStart(t time.Time, granularity string) time.Time {
+	if granularity == GranularityDay {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	}
+	return t.Truncate(time.Hour)
+}
+
+// recordSamples 将一批流量日志累加到小时和天样本中
+func recordSamples(tx *gorm.DB, logs []database.TrafficLog) error {
+	totals := make(map[database.TrafficSample]int64)
+	for _, entry := range logs {
+		for _, granularity := range []string{GranularityHour, GranularityDay} {
+			key := database.TrafficSample{
+				ServerID:    entry.ServerID,
+				Granularity: granularity,
+				Bucket:      bucketStart(entry.CreatedAt, granularity),
+			}
+			totals[key] += entry.Bytes
+		}
+	}
+
+	for key, bytes := range totals {
+		sample := key
+		sample.Bytes = bytes
+		err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "server_id"}, {Name: "granularity"}, {Name: "bucket"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"bytes": gorm.Expr("traffic_samples.bytes + excluded.bytes"),
+			}),
+		}).Create(&sample).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTrafficHistory 获取流量时间序列，serverID为0时汇总全部服务器
+func (s *L2TPService) GetTrafficHistory(serverID uint, rangeName string) (*TrafficHistory, error) {
+	spec, ok := historyRanges[rangeName]
+	if !ok {
+		return nil, fmt.Errorf("不支持的时间范围: %s", rangeName)
+	}
+
+	now := time.Now()
+	start := bucketStart(now.Add(-spec.duration), spec.granularity)
+
+	query := s.db.Model(&database.TrafficSample{}).
+		Select("bucket, SUM(bytes) AS bytes").
+		Where("granularity = ? AND bucket >= ?", spec.granularity, start).
+		Group("bucket").Order("bucket")
+	if serverID > 0 {
+		query = query.Where("server_id = ?", serverID)
+	}
+
+	var rows []struct {
+		Bucket time.Time
+		Bytes  int64
+	}
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	values := make(map[int64]int64, len(rows))
+	for _, row := range rows {
+		values[row.Bucket.Unix()] = row.Bytes
+	}
+
+	// 补齐没有数据的时间桶，便于前端直接绘图
+	history := &TrafficHistory{
+		ServerID:    serverID,
+		Range:       rangeName,
+		Granularity: spec.granularity,
+	}
+	for t := start; !t.After(now); t = nextBucket(t, spec.granularity) {
+		bytes := values[t.Unix()]
+		history.Points = append(history.Points, TrafficPoint{Time: t, Bytes: bytes})
+		history.TotalBytes += bytes
+	}
+
+	return history, nil
+}
+
+// nextBucket 计算下一个时间桶起点
+func nextBucket(t time.Time, granularity string) time.Time {
+	if granularity == GranularityDay {
+		return t.AddDate(0, 0, 1)
+	}
+	return t.Add(time.Hour)
+}
@@ -0,0 +1,279 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"l2tp-manager/internal/database"
+
+	xlog "github.com/xtls/xray-core/common/log"
+	"gorm.io/gorm"
+)
+
+// FlowRecord 转发器按周期上报的流量记录
+type FlowRecord struct {
+	ServerID uint      `json:"server_id"`
+	ClientIP string    `json:"client_ip"`
+	SrcPort  int       `json:"src_port"` // 中转机监听端口
+	DstPort  int       `json:"dst_port"` // 落地机目标端口
+	Bytes    int64     `json:"bytes"`
+	Time     time.Time `json:"time"`
+}
+
+// 批量写入参数
+const (
+	flowBatchSize     = 200
+	flowFlushInterval = 5 * time.Second
+	flowQueueSize     = 4096
+)
+
+// TrafficPipeline 流量日志采集管道：转发器发布记录，批量写入数据库
+type TrafficPipeline struct {
+	db      *gorm.DB
+	records chan FlowRecord
+	dropped int64
+	clients *clientTracker
+	geoip   *GeoIPDatabase // 为流量日志标记客户端国家，未加载时为nil
+}
+
+// NewTrafficPipeline 创建流量日志采集管道，并注册Xray访问日志处理器以识别客户端IP
+func NewTrafficPipeline(db *gorm.DB) *TrafficPipeline {
+	tracker := newClientTracker()
+	xlog.RegisterHandler(tracker)
+
+	return &TrafficPipeline{
+		db:      db,
+		records: make(chan FlowRecord, flowQueueSize),
+		clients: tracker,
+	}
+}
+
+// SetGeoIP 设置GeoIP数据库，此后写入的流量日志标记客户端所属国家/地区
+func (p *TrafficPipeline) SetGeoIP(geoip *GeoIPDatabase) {
+	p.geoip = geoip
+}
+
+// Publish 发布流量记录，队列满时丢弃并计数，避免阻塞转发器
+func (p *TrafficPipeline) Publish(record FlowRecord) {
+	select {
+	case p.records <- record:
+	default:
+		atomic.AddInt64(&p.dropped, 1)
+	}
+}
+
+// Drain 取出队列中最多max条记录，不等待。中转节点不写数据库，由此取出记录上报给面板
+func (p *TrafficPipeline) Drain(max int) []FlowRecord {
+	var records []FlowRecord
+	for len(records) < max {
+		select {
+		case record := <-p.records:
+			records = append(records, record)
+		default:
+			return records
+		}
+	}
+	return records
+}
+
+// Dropped 返回因队列满而丢弃的记录数
+func (p *TrafficPipeline) Dropped() int64 {
+	return atomic.LoadInt64(&p.dropped)
+}
+
+// Run 启动批量写入协程，退出前写入剩余记录
+func (p *TrafficPipeline) Run(ctx context.Context) {
+	ticker := time.NewTicker(flowFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]database.TrafficLog, 0, flowBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		tagCountries(p.geoip, batch)
+		err := p.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.CreateInBatches(batch, flowBatchSize).Error; err != nil {
+				return err
+			}
+			return recordSamples(tx, batch)
+		})
+		if err != nil {
+			slog.Error("写入流量日志失败", "count", len(batch), "error", err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case record := <-p.records:
+					batch = append(batch, toTrafficLog(record))
+				default:
+					flush()
+					return
+				}
+			}
+		case record := <-p.records:
+			batch = append(batch, toTrafficLog(record))
+			if len(batch) >= flowBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// ActiveClients 返回监听端口在指定时间之后出现过的客户端IP
+func (p *TrafficPipeline) ActiveClients(port int, since time.Time) []string {
+	return p.clients.active(port, since)
+}
+
+// ObserveClients 记录不经过Xray的转发端口(内核转发)上出现的客户端IP
+func (p *TrafficPipeline) ObserveClients(port int, ips []string) {
+	p.clients.observe(port, ips...)
+}
+
+// ActiveClientCount 返回指定时间之后在任意(或指定的)监听端口出现过的不同客户端IP数
+func (p *TrafficPipeline) ActiveClientCount(since time.Time, ports ...int) int {
+	return p.clients.count(since, ports...)
+}
+
+// toTrafficLog 转换为数据库模型
+func toTrafficLog(record FlowRecord) database.TrafficLog {
+	return database.TrafficLog{
+		ClientIP:  record.ClientIP,
+		ServerID:  record.ServerID,
+		SrcPort:   record.SrcPort,
+		DstPort:   record.DstPort,
+		Bytes:     record.Bytes,
+		CreatedAt: record.Time,
+	}
+}
+
+// clientTracker 从Xray访问日志中记录各监听端口的客户端IP
+type clientTracker struct {
+	seen  map[int]map[string]time.Time // 监听端口 -> 客户端IP -> 最近出现时间
+	mutex sync.Mutex
+}
+
+// newClientTracker 创建客户端跟踪器
+func newClientTracker() *clientTracker {
+	return &clientTracker{seen: make(map[int]map[string]time.Time)}
+}
+
+// Handle 实现Xray日志处理器接口，只处理访问日志
+func (t *clientTracker) Handle(msg xlog.Message) {
+	access, ok := msg.(*xlog.AccessMessage)
+	if !ok || access.Status != xlog.AccessAccepted {
+		return
+	}
+
+	// 被国家访问策略拒绝的连接不计为客户端
+	if strings.HasSuffix(access.Detour, geoIPBlockTag) {
+		return
+	}
+	port := inboundPort(access.Detour)
+	if port == 0 {
+		return
+	}
+
+	ip := clientIP(access.From)
+	if ip == "" {
+		return
+	}
+	t.observe(port, ip)
+}
+
+// observe 记录客户端在监听端口出现
+func (t *clientTracker) observe(port int, ips ...string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.seen[port] == nil {
+		t.seen[port] = make(map[string]time.Time)
+	}
+	now := time.Now()
+	for _, ip := range ips {
+		t.seen[port][ip] = now
+	}
+}
+
+// active 返回指定时间之后出现过的客户端，并清理更早的记录
+func (t *clientTracker) active(port int, since time.Time) []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var ips []string
+	for ip, last := range t.seen[port] {
+		if last.After(since) {
+			ips = append(ips, ip)
+		} else {
+			delete(t.seen[port], ip)
+		}
+	}
+	return ips
+}
+
+// count 统计指定时间之后在任意端口出现过的不同客户端数(不清理记录)，指定ports时只统计这些端口
+func (t *clientTracker) count(since time.Time, ports ...int) int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	ips := make(map[string]bool)
+	for port, clients := range t.seen {
+		if len(ports) > 0 && !slices.Contains(ports, port) {
+			continue
+		}
+		for ip, last := range clients {
+			if last.After(since) {
+				ips[ip] = true
+			}
+		}
+	}
+	return len(ips)
+}
+
+// inboundPort 从访问日志的路由描述(如 "dokodemo-in-1234 >> direct")中解析监听端口
+func inboundPort(detour string) int {
+	const prefix = "dokodemo-in-"
+	idx := strings.Index(detour, prefix)
+	if idx < 0 {
+		return 0
+	}
+	rest := detour[idx+len(prefix):]
+	if end := strings.IndexAny(rest, " -=>"); end >= 0 {
+		rest = rest[:end]
+	}
+	port, _ := strconv.Atoi(rest)
+	return port
+}
+
+// clientIP 提取访问来源的IP地址
+func clientIP(from interface{}) string {
+	switch addr := from.(type) {
+	case net.Addr:
+		host, _, err := net.SplitHostPort(addr.String())
+		if err != nil {
+			return addr.String()
+		}
+		return host
+	case string:
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return addr
+		}
+		return host
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"l2tp-manager/internal/database"
+
+	"gorm.io/gorm"
+)
+
+// SettingTrafficReportSchedule 流量汇总报告的发送计划
+const SettingTrafficReportSchedule = "traffic_report_schedule"
+
+// TrafficReportRow 流量汇总中单台服务器的数据
+type TrafficReportRow struct {
+	ServerID   uint   `json:"server_id"`
+	ServerName string `json:"server_name"`
+	Bytes      int64  `json:"bytes"`
+}
+
+// TrafficReporter 定期汇总各服务器流量并作为通知事件发布
+type TrafficReporter struct {
+	db       *gorm.DB
+	settings *SettingsService
+	notifier *NotificationService
+	lastRun  time.Time
+}
+
+// NewTrafficReporter 创建流量汇总报告任务并注册其设置项
+func NewTrafficReporter(db *gorm.DB, settings *SettingsService, notifier *NotificationService) *TrafficReporter {
+	settings.Register(SettingDef{Key: SettingTrafficReportSchedule, Type: SettingTypeString, Default: "0 9 * * 1", Description: "每周流量汇总的发送计划(cron表达式)，为空表示关闭"})
+	return &TrafficReporter{db: db, settings: settings, notifier: notifier}
+}
+
+// Start 启动调度，每分钟检查一次发送计划
+func (r *TrafficReporter) Start(ctx context.Context) {
+	for {
+		now := time.Now()
+		next := now.Truncate(time.Minute).Add(time.Minute)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(next.Sub(now)):
+			r.runIfDue(next)
+		}
+	}
+}
+
+// runIfDue 当前分钟匹配发送计划时发布最近7天的流量汇总
+func (r *TrafficReporter) runIfDue(now time.Time) {
+	expr := r.settings.Get(SettingTrafficReportSchedule)
+	if expr == "" {
+		return
+	}
+	schedule, err := ParseCron(expr)
+	if err != nil {
+		slog.Warn("流量汇总计划无效", "error", err)
+		return
+	}
+	minute := now.Truncate(time.Minute)
+	if !schedule.Matches(minute) || r.lastRun.Equal(minute) {
+		return
+	}
+	r.lastRun = minute
+
+	until := bucketStart(minute, GranularityDay)
+	if err := r.Publish(until.AddDate(0, 0, -7), until); err != nil {
+		slog.Error("生成流量汇总失败", "error", err)
+	}
+}
+
+// Summarize 按服务器汇总[since, until)内的流量(按天样本统计)，按流量降序
+func (r *TrafficReporter) Summarize(since, until time.Time) ([]TrafficReportRow, error) {
+	return summarizeTraffic(r.db, since, until, 0)
+}
+
+// summarizeTraffic 按服务器汇总[since, until)内的天样本流量，按流量降序，limit大于0时只取前limit台
+func summarizeTraffic(db *gorm.DB, since, until time.Time, limit int) ([]TrafficReportRow, error) {
+	query := db.Model(&database.TrafficSample{}).
+		Select("traffic_samples.server_id, l2_tp_servers.name AS server_name, SUM(traffic_samples.bytes) AS bytes").
+		Joins("LEFT JOIN l2_tp_servers ON l2_tp_servers.id = traffic_samples.server_id").
+		Where("traffic_samples.granularity = ? AND traffic_samples.bucket >= ? AND traffic_samples.bucket < ?", GranularityDay, since, until).
+		Group("traffic_samples.server_id, l2_tp_servers.name").
+		Order("bytes DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	var rows []TrafficReportRow
+	err := query.Scan(&rows).Error
+	return rows, err
+}
+
+// Publish 汇总流量并发布报告事件
+func (r *TrafficReporter) Publish(since, until time.Time) error {
+	rows, err := r.Summarize(since, until)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for _, row := range rows {
+		total += row.Bytes
+	}
+	r.notifier.Publish(Event{
+		Type: EventTrafficReport,
+		Message: fmt.Sprintf("%s 至 %s 共 %d 台服务器产生流量 %s",
+			since.Format("2006-01-02"), until.AddDate(0, 0, -1).Format("2006-01-02"), len(rows), FormatBytes(total)),
+		Data: map[string]interface{}{
+			"since":   since,
+			"until":   until,
+			"total":   total,
+			"servers": rows,
+		},
+	})
+	return nil
+}
+
+// FormatBytes 将字节数格式化为易读的单位
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.2f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
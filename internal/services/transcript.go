@@ -0,0 +1,245 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"l2tp-manager/internal/database"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// 执行记录条目类型
+const (
+	TranscriptConnect = "connect" // 建立SSH连接
+	TranscriptCommand = "command" // 执行命令
+	TranscriptStep    = "step"    // 步骤结果
+)
+
+const (
+	// transcriptMaxOutput 单个命令的stdout/stderr各保留的字节数，超出时保留末尾
+	transcriptMaxOutput = 16 * 1024
+	// transcriptMaxEntries 一次任务最多记录的条目数
+	transcriptMaxEntries = 500
+)
+
+// transcriptBlob 命令中内联的长base64内容(配置文件、证书等)，记录时隐藏
+var transcriptBlob = regexp.MustCompile(`[A-Za-z0-9+/]{64,}={0,2}`)
+
+// TranscriptEntry 执行记录中的一条：一次SSH连接、一条命令或一个步骤的结果
+type TranscriptEntry struct {
+	Time       time.Time `json:"time"`
+	Phase      string    `json:"phase,omitempty"` // 所属阶段(start/stop)
+	Type       string    `json:"type"`            // connect/command/step
+	Step       string    `json:"step,omitempty"`
+	Command    string    `json:"command,omitempty"` // 命令或连接地址，密码等敏感内容已隐藏
+	Stdout     string    `json:"stdout,omitempty"`
+	Stderr     string    `json:"stderr,omitempty"`
+	ExitCode   *int      `json:"exit_code,omitempty"`
+	Success    bool      `json:"success"`
+	Message    string    `json:"message,omitempty"` // 步骤说明或错误信息
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// Transcript 一次服务器操作的执行记录：建立的SSH连接、执行的命令及其输出和各步骤结果，
+// 用于事后排查失败原因。记录前隐藏服务器密码、PSK和用户密码等敏感内容。各方法对nil安全
+type Transcript struct {
+	entries []TranscriptEntry
+	phase   string
+	secrets secretRedactor
+	dropped int // 超过transcriptMaxEntries未记录的条目数
+	mutex   sync.Mutex
+}
+
+// newTranscript 创建执行记录
+func newTranscript(phase string) *Transcript {
+	return &Transcript{phase: phase}
+}
+
+// transcriptKey 上下文中保存执行记录的键
+type transcriptKey struct{}
+
+// withTranscript 将执行记录放入上下文，使用该上下文的SSHService记录连接和命令
+func withTranscript(ctx context.Context, transcript *Transcript) context.Context {
+	return context.WithValue(ctx, transcriptKey{}, transcript)
+}
+
+// transcriptFrom 获取上下文中的执行记录，没有时返回nil
+func transcriptFrom(ctx context.Context) *Transcript {
+	if ctx == nil {
+		return nil
+	}
+	transcript, _ := ctx.Value(transcriptKey{}).(*Transcript)
+	return transcript
+}
+
+// setPhase 进入下一阶段，之后的条目记为该阶段
+func (t *Transcript) setPhase(phase string) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.phase = phase
+}
+
+// secretRedactor 隐藏文本中的敏感内容，执行记录和操作计划共用
+type secretRedactor struct {
+	secrets []string // 按长度从长到短，避免较短的内容先被替换而漏出较长内容的其余部分
+}
+
+// add 登记需要隐藏的敏感内容及其在命令中经shellQuote转义后的形式，
+// 过短的内容不登记以免误伤正常输出
+func (r *secretRedactor) add(secrets ...string) {
+	for _, secret := range secrets {
+		if len(secret) < 4 {
+			continue
+		}
+		quoted := shellQuote(secret)
+		for _, form := range []string{secret, quoted[1 : len(quoted)-1]} {
+			if !containsString(r.secrets, form) {
+				r.secrets = append(r.secrets, form)
+			}
+		}
+	}
+	sort.SliceStable(r.secrets, func(i, j int) bool {
+		return len(r.secrets[i]) > len(r.secrets[j])
+	})
+}
+
+// redact 将登记的敏感内容替换为******
+func (r *secretRedactor) redact(text string) string {
+	for _, secret := range r.secrets {
+		text = strings.ReplaceAll(text, secret, "******")
+	}
+	return text
+}
+
+// hide 登记需要隐藏的敏感内容
+func (t *Transcript) hide(secrets ...string) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.secrets.add(secrets...)
+}
+
+// redact 隐藏敏感内容和内联的base64内容，需持有锁
+func (t *Transcript) redact(text string) string {
+	text = t.secrets.redact(text)
+	return transcriptBlob.ReplaceAllStringFunc(text, func(blob string) string {
+		return fmt.Sprintf("<已隐藏%d字节>", len(blob))
+	})
+}
+
+// add 追加条目
+func (t *Transcript) add(entry TranscriptEntry) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if len(t.entries) >= transcriptMaxEntries {
+		t.dropped++
+		return
+	}
+	entry.Phase = t.phase
+	entry.Command = t.redact(entry.Command)
+	entry.Stdout = truncateOutput(t.redact(entry.Stdout))
+	entry.Stderr = truncateOutput(t.redact(entry.Stderr))
+	entry.Message = t.redact(entry.Message)
+	t.entries = append(t.entries, entry)
+}
+
+// connect 记录一次SSH连接
+func (t *Transcript) connect(address string, start time.Time, err error) {
+	entry := TranscriptEntry{Time: start, Type: TranscriptConnect, Command: address, Success: err == nil, DurationMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		entry.Message = err.Error()
+	}
+	t.add(entry)
+}
+
+// command 记录一条命令及其输出，命令以非零状态退出时记录退出码
+func (t *Transcript) command(command, stdout, stderr string, start time.Time, err error) {
+	entry := TranscriptEntry{
+		Time:       start,
+		Type:       TranscriptCommand,
+		Command:    command,
+		Stdout:     stdout,
+		Stderr:     stderr,
+		Success:    err == nil,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		code := exitErr.ExitStatus()
+		entry.ExitCode = &code
+	} else if err == nil {
+		code := 0
+		entry.ExitCode = &code
+	}
+	if err != nil {
+		entry.Message = err.Error()
+	}
+	t.add(entry)
+}
+
+// step 记录步骤结果
+func (t *Transcript) step(step string, success bool, message string) {
+	t.add(TranscriptEntry{Time: time.Now(), Type: TranscriptStep, Step: step, Success: success, Message: message})
+}
+
+// Entries 已记录的条目，超出上限的条目以一条说明代替
+func (t *Transcript) Entries() []TranscriptEntry {
+	if t == nil {
+		return []TranscriptEntry{}
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	entries := append([]TranscriptEntry{}, t.entries...)
+	if t.dropped > 0 {
+		entries = append(entries, TranscriptEntry{Time: time.Now(), Type: TranscriptStep, Message: fmt.Sprintf("超过%d条，其余%d条未记录", transcriptMaxEntries, t.dropped)})
+	}
+	return entries
+}
+
+// MarshalJSON 以条目数组序列化，用于保存到数据库
+func (t *Transcript) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Entries())
+}
+
+// truncateOutput 超过transcriptMaxOutput时只保留末尾，错误信息通常在最后
+func truncateOutput(output string) string {
+	if len(output) <= transcriptMaxOutput {
+		return output
+	}
+	omitted := len(output) - transcriptMaxOutput
+	tail := output[omitted:]
+	// 避免从多字节字符中间截断
+	for len(tail) > 0 && tail[0]&0xC0 == 0x80 {
+		tail = tail[1:]
+		omitted++
+	}
+	return fmt.Sprintf("...(省略前%d字节)\n%s", omitted, tail)
+}
+
+// serverSecrets 服务器的SSH密码、PSK、WireGuard私钥和用户密码，记录执行过程和生成执行计划时隐藏
+func serverSecrets(server *database.L2TPServer) []string {
+	secrets := []string{server.Password, server.PSK, server.WireGuardPrivateKey}
+	var users []L2TPUser
+	if server.Users != "" && json.Unmarshal([]byte(server.Users), &users) == nil {
+		for _, user := range users {
+			secrets = append(secrets, user.Password)
+		}
+	}
+	return secrets
+}
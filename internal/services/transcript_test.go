@@ -0,0 +1,45 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTranscriptRedact(t *testing.T) {
+	tests := []struct {
+		name    string
+		secrets []string
+		command string
+	}{
+		{"较短的内容是较长内容的前缀", []string{"psk-secret", "psk-secret-password"}, "echo psk-secret-password"},
+		{"较短的内容在较长内容中间", []string{"middle", "prefix-middle-suffix"}, "login prefix-middle-suffix"},
+		{"shellQuote转义后的密码", []string{"it's-a-secret"}, "echo " + shellQuote("it's-a-secret") + " | chpasswd"},
+		{"转义后的密码嵌在引号字符串中", []string{"pa'ss'word"}, "echo " + shellQuote("user:pa'ss'word")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, order := range [][]string{tt.secrets, {tt.secrets[len(tt.secrets)-1], tt.secrets[0]}} {
+				transcript := newTranscript("start")
+				transcript.hide(order...)
+				transcript.command(tt.command, "", "", time.Now(), nil)
+
+				command := transcript.Entries()[0].Command
+				for _, secret := range tt.secrets {
+					parts := []string{secret, strings.ReplaceAll(secret, "'", `'\''`)}
+					for _, part := range parts {
+						if strings.Contains(command, part) {
+							t.Fatalf("记录的命令 %q 中仍包含 %q", command, part)
+						}
+					}
+				}
+				for _, fragment := range []string{"-password", "-suffix", "prefix-", "word", "secret"} {
+					if strings.Contains(command, fragment) {
+						t.Fatalf("记录的命令 %q 中漏出了 %q", command, fragment)
+					}
+				}
+			}
+		})
+	}
+}
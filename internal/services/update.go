@@ -0,0 +1,332 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 发布资源命名，与 .github/workflows/release.yml 保持一致
+const (
+	updateChecksumAsset  = "checksums.txt"     // sha256sum格式的校验和文件
+	updateSignatureAsset = "checksums.txt.sig" // checksums.txt的Ed25519签名(base64)
+	updateMaxBinarySize  = 200 << 20
+)
+
+// UpdateInfo 版本检查结果
+type UpdateInfo struct {
+	CurrentVersion  string    `json:"current_version"`
+	LatestVersion   string    `json:"latest_version"`
+	UpdateAvailable bool      `json:"update_available"`
+	Asset           string    `json:"asset"` // 当前平台对应的二进制文件名
+	ReleaseURL      string    `json:"release_url"`
+	PublishedAt     time.Time `json:"published_at"`
+	Notes           string    `json:"notes"`
+	Signed          bool      `json:"signed"`         // 是否配置了签名公钥，配置后更新必须通过签名校验
+	AllowUnsigned   bool      `json:"allow_unsigned"` // 未配置签名公钥时是否允许只校验sha256安装
+}
+
+// githubRelease GitHub Releases API返回的发布信息
+type githubRelease struct {
+	TagName     string    `json:"tag_name"`
+	HTMLURL     string    `json:"html_url"`
+	Body        string    `json:"body"`
+	PublishedAt time.Time `json:"published_at"`
+	Assets      []struct {
+		Name               string `json:"name"`
+		BrowserDownloadURL string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// UpdateService 从GitHub Releases检查并安装新版本，安装后重启进程
+type UpdateService struct {
+	version       string
+	repo          string
+	apiURL        string
+	publicKey     ed25519.PublicKey
+	allowUnsigned bool   // 未配置公钥时是否允许只校验sha256安装
+	executable    string // 更新时被替换的可执行文件
+	client        *http.Client
+
+	applying sync.Mutex
+}
+
+// ErrUpdateUnsigned 未配置签名公钥且未允许安装未签名的更新
+var ErrUpdateUnsigned = errors.New("未配置更新签名公钥(UPDATE_PUBLIC_KEY)，拒绝安装未经签名校验的版本；确认只依赖sha256校验时可设置 UPDATE_ALLOW_UNSIGNED=true")
+
+// NewUpdateService 创建更新服务，publicKey为base64编码的Ed25519公钥。
+// 为空时拒绝安装更新，除非allowUnsigned为true(此时只校验sha256)
+func NewUpdateService(version, repo, apiURL, publicKey string, allowUnsigned bool) (*UpdateService, error) {
+	u := &UpdateService{
+		version:       version,
+		repo:          repo,
+		apiURL:        strings.TrimRight(apiURL, "/"),
+		allowUnsigned: allowUnsigned,
+		client:        &http.Client{Timeout: 5 * time.Minute},
+		executable:    executablePath(),
+	}
+	if publicKey != "" {
+		key, err := base64.StdEncoding.DecodeString(publicKey)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("更新签名公钥无效，应为base64编码的32字节Ed25519公钥")
+		}
+		u.publicKey = key
+	}
+	return u, nil
+}
+
+// Version 当前运行的版本
+func (u *UpdateService) Version() string {
+	return u.version
+}
+
+// assetName 当前平台的二进制文件名
+func assetName() string {
+	return fmt.Sprintf("l2tp-manager-%s-%s", runtime.GOOS, runtime.GOARCH)
+}
+
+// Check 查询最新发布版本，与当前版本比较
+func (u *UpdateService) Check(ctx context.Context) (*UpdateInfo, *githubRelease, error) {
+	endpoint := fmt.Sprintf("%s/repos/%s/releases/latest", u.apiURL, u.repo)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", "l2tp-manager-updater")
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("查询最新版本失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("查询最新版本失败: HTTP %d", resp.StatusCode)
+	}
+
+	var release githubRelease
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return nil, nil, fmt.Errorf("解析发布信息失败: %v", err)
+	}
+
+	info := &UpdateInfo{
+		CurrentVersion: u.version,
+		LatestVersion:  release.TagName,
+		Asset:          assetName(),
+		ReleaseURL:     release.HTMLURL,
+		PublishedAt:    release.PublishedAt,
+		Notes:          release.Body,
+		Signed:         u.publicKey != nil,
+		AllowUnsigned:  u.publicKey == nil && u.allowUnsigned,
+	}
+	if newer, ok := compareVersions(release.TagName, u.version); ok {
+		info.UpdateAvailable = newer > 0
+	} else {
+		// 开发版本等无法比较的版本号，只要不同即视为可更新
+		info.UpdateAvailable = release.TagName != "" && release.TagName != u.version
+	}
+	return info, &release, nil
+}
+
+// Apply 下载最新版本的二进制文件，校验后原子替换当前可执行文件，返回安装的版本信息。
+// 替换成功后需通过RestartManager重启使新版本生效
+func (u *UpdateService) Apply(ctx context.Context) (*UpdateInfo, error) {
+	if !u.applying.TryLock() {
+		return nil, fmt.Errorf("正在更新中")
+	}
+	defer u.applying.Unlock()
+
+	if u.publicKey == nil && !u.allowUnsigned {
+		return nil, ErrUpdateUnsigned
+	}
+	if u.executable == "" {
+		return nil, fmt.Errorf("无法确定当前可执行文件路径")
+	}
+	info, release, err := u.Check(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !info.UpdateAvailable {
+		return info, nil
+	}
+
+	assets := make(map[string]string)
+	for _, asset := range release.Assets {
+		assets[asset.Name] = asset.BrowserDownloadURL
+	}
+	binaryURL, ok := assets[info.Asset]
+	if !ok {
+		return nil, fmt.Errorf("发布版本 %s 中没有适用于当前平台的文件 %s", release.TagName, info.Asset)
+	}
+	checksumURL, ok := assets[updateChecksumAsset]
+	if !ok {
+		return nil, fmt.Errorf("发布版本 %s 中缺少校验和文件 %s", release.TagName, updateChecksumAsset)
+	}
+
+	checksums, err := u.download(ctx, checksumURL, 1<<20)
+	if err != nil {
+		return nil, fmt.Errorf("下载校验和文件失败: %v", err)
+	}
+	if u.publicKey != nil {
+		signatureURL, ok := assets[updateSignatureAsset]
+		if !ok {
+			return nil, fmt.Errorf("发布版本 %s 中缺少签名文件 %s", release.TagName, updateSignatureAsset)
+		}
+		signature, err := u.download(ctx, signatureURL, 1<<10)
+		if err != nil {
+			return nil, fmt.Errorf("下载签名文件失败: %v", err)
+		}
+		if err := verifySignature(u.publicKey, checksums, signature); err != nil {
+			return nil, err
+		}
+	}
+	expected, err := lookupChecksum(checksums, info.Asset)
+	if err != nil {
+		return nil, err
+	}
+
+	binary, err := u.download(ctx, binaryURL, updateMaxBinarySize)
+	if err != nil {
+		return nil, fmt.Errorf("下载新版本失败: %v", err)
+	}
+	sum := sha256.Sum256(binary)
+	if hex.EncodeToString(sum[:]) != expected {
+		return nil, fmt.Errorf("新版本文件校验和不匹配")
+	}
+
+	if err := replaceExecutable(u.executable, binary); err != nil {
+		return nil, fmt.Errorf("替换可执行文件失败: %v", err)
+	}
+	slog.Info("新版本已安装，等待重启", "from", u.version, "to", release.TagName)
+	return info, nil
+}
+
+// download 下载文件到内存，超过limit字节时报错
+func (u *UpdateService) download(ctx context.Context, url string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "l2tp-manager-updater")
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("文件超过%d字节", limit)
+	}
+	return data, nil
+}
+
+// verifySignature 校验checksums.txt的Ed25519签名，签名文件为base64编码
+func verifySignature(publicKey ed25519.PublicKey, checksums, signature []byte) error {
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return fmt.Errorf("签名文件格式无效")
+	}
+	if !ed25519.Verify(publicKey, checksums, sig) {
+		return fmt.Errorf("校验和文件签名验证失败")
+	}
+	return nil
+}
+
+// lookupChecksum 从sha256sum格式的校验和文件中查找指定文件的校验和
+func lookupChecksum(checksums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("校验和文件中没有 %s", name)
+}
+
+// replaceExecutable 先写入同目录的临时文件再重命名，保证替换是原子的
+func replaceExecutable(path string, binary []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".update-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()|0o111); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// compareVersions 比较形如v1.2.3的版本号，a较新时返回正数；任一无法解析时ok为false
+func compareVersions(a, b string) (int, bool) {
+	pa, okA := parseVersion(a)
+	pb, okB := parseVersion(b)
+	if !okA || !okB {
+		return 0, false
+	}
+	for i := range pa {
+		if pa[i] != pb[i] {
+			return pa[i] - pb[i], true
+		}
+	}
+	return 0, true
+}
+
+// parseVersion 解析主、次、修订版本号，忽略v前缀和预发布后缀
+func parseVersion(version string) ([3]int, bool) {
+	var parts [3]int
+	version = strings.TrimPrefix(version, "v")
+	version, _, _ = strings.Cut(version, "-")
+	fields := strings.Split(version, ".")
+	if len(fields) == 0 || len(fields) > 3 {
+		return parts, false
+	}
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return parts, false
+		}
+		parts[i] = n
+	}
+	return parts, true
+}
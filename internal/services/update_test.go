@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b   string
+		want   int // 只比较符号
+		wantOK bool
+	}{
+		{"v1.2.3", "v1.2.3", 0, true},
+		{"v1.2.4", "v1.2.3", 1, true},
+		{"v1.10.0", "v1.9.9", 1, true},
+		{"v2.0.0", "v10.0.0", -1, true},
+		{"1.2.3", "v1.2.3", 0, true},
+		{"v1.2", "v1.2.0", 0, true},
+		{"v1", "v1.0.1", -1, true},
+		{"v1.3.0-rc1", "v1.2.9", 1, true},
+		{"v1.2.3-rc1", "v1.2.3", 0, true},
+		{"dev", "v1.2.3", 0, false},
+		{"v1.2.3", "", 0, false},
+		{"v1.2.3.4", "v1.2.3", 0, false},
+		{"v1.x.3", "v1.2.3", 0, false},
+		{"v1.-2.3", "v1.2.3", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := compareVersions(tt.a, tt.b)
+		if ok != tt.wantOK {
+			t.Errorf("compareVersions(%q, %q) ok = %v, 期望 %v", tt.a, tt.b, ok, tt.wantOK)
+			continue
+		}
+		if sign(got) != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, 期望符号 %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// sign 返回整数的符号
+func sign(n int) int {
+	switch {
+	case n > 0:
+		return 1
+	case n < 0:
+		return -1
+	}
+	return 0
+}
+
+func TestLookupChecksum(t *testing.T) {
+	checksums := []byte("ABCDEF0123  l2tp-manager-linux-amd64\n" +
+		"0123456789 *l2tp-manager-linux-arm64\n" +
+		"\n" +
+		"fedcba l2tp-manager-darwin-arm64 extra\n")
+
+	tests := []struct {
+		name    string
+		asset   string
+		want    string
+		wantErr bool
+	}{
+		{"文本模式，校验和转为小写", "l2tp-manager-linux-amd64", "abcdef0123", false},
+		{"二进制模式的*前缀", "l2tp-manager-linux-arm64", "0123456789", false},
+		{"字段数不为2的行被忽略", "l2tp-manager-darwin-arm64", "", true},
+		{"不存在的文件", "l2tp-manager-windows-amd64", "", true},
+		{"文件名需完全匹配", "l2tp-manager-linux", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := lookupChecksum(checksums, tt.asset)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("错误 = %v, 期望出错 %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("校验和 = %q, 期望 %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checksums := []byte("abcdef  l2tp-manager-linux-amd64\n")
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, checksums)) + "\n"
+
+	tests := []struct {
+		name      string
+		key       ed25519.PublicKey
+		checksums []byte
+		signature string
+		wantErr   bool
+	}{
+		{"签名有效", publicKey, checksums, signature, false},
+		{"校验和文件被篡改", publicKey, []byte("000000  l2tp-manager-linux-amd64\n"), signature, true},
+		{"公钥不匹配", otherKey, checksums, signature, true},
+		{"签名不是base64", publicKey, checksums, "not base64!", true},
+		{"签名长度错误", publicKey, checksums, base64.StdEncoding.EncodeToString([]byte("short")), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifySignature(tt.key, tt.checksums, []byte(tt.signature))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("错误 = %v, 期望出错 %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyRefusesUnsignedUpdates(t *testing.T) {
+	u, err := NewUpdateService("v1.0.0", "sky22333/l2tp", "http://127.0.0.1:1", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.Apply(context.Background()); !errors.Is(err, ErrUpdateUnsigned) {
+		t.Fatalf("未配置公钥时错误 = %v, 期望 ErrUpdateUnsigned", err)
+	}
+
+	// 显式允许后不再拒绝，继续查询发布信息(此处因地址不可达而失败)
+	u, err = NewUpdateService("v1.0.0", "sky22333/l2tp", "http://127.0.0.1:1", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.Apply(context.Background()); err == nil || errors.Is(err, ErrUpdateUnsigned) {
+		t.Fatalf("允许未签名更新时错误 = %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"log/slog"
+	"time"
+
+	"l2tp-manager/internal/database"
+
+	"gorm.io/gorm"
+)
+
+// 服务器可用性状态
+const (
+	AvailabilityUp      = "up"
+	AvailabilityDown    = "down"
+	AvailabilityStopped = "stopped"
+)
+
+// statusAvailability 服务器状态对应的可用性，过渡状态不记录
+var statusAvailability = map[string]string{
+	"running": AvailabilityUp,
+	"stopped": AvailabilityStopped,
+	"error":   AvailabilityDown,
+}
+
+// uptimeWindows 统计可用率的时间窗口
+var uptimeWindows = []struct {
+	Name     string
+	Duration time.Duration
+}{
+	{"24h", 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+	{"30d", 30 * 24 * time.Hour},
+}
+
+// uptimeHistoryLimit 可用率报告中返回的最近变化条数
+const uptimeHistoryLimit = 50
+
+// UptimeWindow 一个时间窗口内的可用率
+type UptimeWindow struct {
+	Window        string   `json:"window"`
+	UptimePercent *float64 `json:"uptime_percent"` // 可用时间占监控时间的百分比，窗口内没有监控数据时为null
+	UpSeconds     int64    `json:"up_seconds"`
+	DownSeconds   int64    `json:"down_seconds"`
+	Incidents     int      `json:"incidents"` // 窗口内进入不可用状态的次数
+}
+
+// UptimeReport 服务器的可用率和最近的状态变化
+type UptimeReport struct {
+	ServerID uint                          `json:"server_id"`
+	State    string                        `json:"state"` // 当前可用性，尚无记录时为空
+	Since    *time.Time                    `json:"since,omitempty"`
+	Windows  []UptimeWindow                `json:"windows"`
+	Changes  []database.ServerStatusChange `json:"changes"` // 最近的变化，最新的在前
+}
+
+// UptimeService 记录服务器可用性变化并计算SLA可用率
+type UptimeService struct {
+	db *gorm.DB
+}
+
+// NewUptimeService 创建可用率服务
+func NewUptimeService(db *gorm.DB) *UptimeService {
+	return &UptimeService{db: db}
+}
+
+// SetUptime 设置可用率服务，此后状态变更和健康检查结果将记录为可用性变化
+func (s *L2TPService) SetUptime(uptime *UptimeService) {
+	s.uptime = uptime
+}
+
+// recordAvailability 记录服务器可用性，state为空或未设置可用率服务时忽略
+func (s *L2TPService) recordAvailability(serverID uint, state, reason string) {
+	if s.uptime == nil || state == "" {
+		return
+	}
+	s.uptime.Record(serverID, state, reason)
+}
+
+// Record 可用性与最近一条记录不同时写入变化记录。每次读取数据库中的最新记录，高可用切换后同样适用
+func (u *UptimeService) Record(serverID uint, state, reason string) {
+	var last database.ServerStatusChange
+	if err := u.db.Where("server_id = ?", serverID).Order("changed_at DESC, id DESC").Limit(1).Find(&last).Error; err != nil {
+		slog.Warn("查询服务器可用性记录失败", "server_id", serverID, "error", err)
+		return
+	}
+	if last.ID != 0 && last.State == state {
+		return
+	}
+	change := database.ServerStatusChange{ServerID: serverID, State: state, Reason: reason, ChangedAt: time.Now()}
+	if err := u.db.Create(&change).Error; err != nil {
+		slog.Warn("保存服务器可用性记录失败", "server_id", serverID, "error", err)
+	}
+}
+
+// loadChanges 加载scope限定的服务器在since之后的变化记录，以及每台服务器在since之前的最后一条记录(窗口起点的状态)，
+// 按服务器分组并按时间排序
+func loadChanges(db *gorm.DB, scope func(*gorm.DB) *gorm.DB, since time.Time) (map[uint][]database.ServerStatusChange, error) {
+	var before []database.ServerStatusChange
+	latest := db.Model(&database.ServerStatusChange{}).Scopes(scope).
+		Select("MAX(id)").Where("changed_at < ?", since).Group("server_id")
+	if err := db.Where("id IN (?)", latest).Find(&before).Error; err != nil {
+		return nil, err
+	}
+	var recent []database.ServerStatusChange
+	if err := db.Scopes(scope).Where("changed_at >= ?", since).Order("changed_at, id").Find(&recent).Error; err != nil {
+		return nil, err
+	}
+
+	changes := make(map[uint][]database.ServerStatusChange)
+	for _, change := range append(before, recent...) {
+		changes[change.ServerID] = append(changes[change.ServerID], change)
+	}
+	return changes, nil
+}
+
+// availability 统计[since, now)内处于可用和不可用状态的时长以及进入不可用状态的次数，首条记录之前的时间不计入
+func availability(changes []database.ServerStatusChange, since, now time.Time) (up, down time.Duration, incidents int) {
+	for i, change := range changes {
+		start := change.ChangedAt
+		if start.Before(since) {
+			start = since
+		}
+		end := now
+		if i+1 < len(changes) {
+			end = changes[i+1].ChangedAt
+		}
+		if !end.After(start) {
+			continue
+		}
+		switch change.State {
+		case AvailabilityUp:
+			up += end.Sub(start)
+		case AvailabilityDown:
+			down += end.Sub(start)
+			if !change.ChangedAt.Before(since) {
+				incidents++
+			}
+		}
+	}
+	return up, down, incidents
+}
+
+// summarizeUptime 汇总一组服务器在各时间窗口的可用率
+func summarizeUptime(changes map[uint][]database.ServerStatusChange, now time.Time) []UptimeWindow {
+	windows := make([]UptimeWindow, 0, len(uptimeWindows))
+	for _, w := range uptimeWindows {
+		window := UptimeWindow{Window: w.Name}
+		var up, down time.Duration
+		for _, serverChanges := range changes {
+			u, d, incidents := availability(serverChanges, now.Add(-w.Duration), now)
+			up += u
+			down += d
+			window.Incidents += incidents
+		}
+		window.UpSeconds = int64(up.Seconds())
+		window.DownSeconds = int64(down.Seconds())
+		if up+down > 0 {
+			percent := float64(up) / float64(up+down) * 100
+			window.UptimePercent = &percent
+		}
+		windows = append(windows, window)
+	}
+	return windows
+}
+
+// Report 服务器在24小时、7天和30天内的可用率
+func (u *UptimeService) Report(serverID uint) (*UptimeReport, error) {
+	now := time.Now()
+	scope := func(db *gorm.DB) *gorm.DB { return db.Where("server_id = ?", serverID) }
+	changes, err := loadChanges(u.db, scope, now.Add(-uptimeWindows[len(uptimeWindows)-1].Duration))
+	if err != nil {
+		return nil, err
+	}
+	report := &UptimeReport{ServerID: serverID, Windows: summarizeUptime(changes, now), Changes: []database.ServerStatusChange{}}
+
+	if err := u.db.Where("server_id = ?", serverID).Order("changed_at DESC, id DESC").
+		Limit(uptimeHistoryLimit).Find(&report.Changes).Error; err != nil {
+		return nil, err
+	}
+	if len(report.Changes) > 0 {
+		report.State = report.Changes[0].State
+		report.Since = &report.Changes[0].ChangedAt
+	}
+	return report, nil
+}
+
+// fleetUptime 全部(或租户的)服务器合计的可用率
+func fleetUptime(db *gorm.DB, tenantID uint, now time.Time) ([]UptimeWindow, error) {
+	changes, err := loadChanges(db, tenantServerIDs("server_id", tenantID), now.Add(-uptimeWindows[len(uptimeWindows)-1].Duration))
+	if err != nil {
+		return nil, err
+	}
+	return summarizeUptime(changes, now), nil
+}
@@ -0,0 +1,361 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"l2tp-manager/internal/database"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 用量采集参数
+const (
+	usageSampleInterval = 5 * time.Minute // 在线时长的采样间隔
+	usagePeriodLayout   = "2006-01"
+)
+
+// UsageService 计费用量：按月累计服务器的在线时长和L2TP账号的流量，生成月度用量报告
+type UsageService struct {
+	db            *gorm.DB
+	settings      *SettingsService
+	notifier      *NotificationService
+	sshService    ExitNodeClient
+	lastSample    time.Time
+	lastGenerated string
+	quotaMutex    sync.Mutex // 串行执行账号配额检查和手动恢复
+}
+
+// UsagePeriod 已生成报告的月份
+type UsagePeriod struct {
+	Period      string    `json:"period"`
+	Rows        int64     `gorm:"column:row_count" json:"rows"`
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+// NewUsageService 创建用量统计服务并注册其设置项，sshService用于读取落地机上的账号流量计数和停用超额账号
+func NewUsageService(db *gorm.DB, settings *SettingsService, notifier *NotificationService, sshService ExitNodeClient) *UsageService {
+	settings.Register(SettingDef{Key: SettingAccountUsageInterval, Type: SettingTypeInt, Default: strconv.Itoa(accountUsageDefaultInterval), Max: 86400,
+		Description: fmt.Sprintf("读取落地机L2TP账号流量计数的间隔(秒)，最短%d秒，0表示关闭", minAccountUsageInterval)})
+	return &UsageService{db: db, settings: settings, notifier: notifier, sshService: sshService}
+}
+
+// ParseUsagePeriod 解析月份(YYYY-MM)，返回该月起止时间(本地时区)
+func ParseUsagePeriod(period string) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation(usagePeriodLayout, period, time.Local)
+	if err != nil {
+		return start, start, fmt.Errorf("无效的月份 %q，格式为YYYY-MM", period)
+	}
+	return start, start.AddDate(0, 1, 0), nil
+}
+
+// usagePeriod 时间所在的月份
+func usagePeriod(t time.Time) string {
+	return t.Format(usagePeriodLayout)
+}
+
+// Start 启动用量采集：定期采样在线状态，按设置的间隔读取账号流量计数，每月初生成上月报告
+func (u *UsageService) Start(ctx context.Context) {
+	ticker := time.NewTicker(usageSampleInterval)
+	defer ticker.Stop()
+	go u.collectLoop(ctx)
+
+	for {
+		now := time.Now()
+		if err := u.sampleUptime(now); err != nil {
+			slog.Error("采样服务器在线状态失败", "error", err)
+		}
+		u.generatePrevious(now)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sampleUptime 将距上次采样的时长计入各服务器当月的采样时长，运行中的服务器同时计入在线时长
+func (u *UsageService) sampleUptime(now time.Time) error {
+	elapsed := usageSampleInterval
+	if !u.lastSample.IsZero() && now.Sub(u.lastSample) < 2*usageSampleInterval {
+		elapsed = now.Sub(u.lastSample)
+	}
+	u.lastSample = now
+
+	var servers []database.L2TPServer
+	if err := u.db.Select("id", "status", "billing_anchor_day", "billing_timezone").Find(&servers).Error; err != nil {
+		return err
+	}
+	seconds := int64(elapsed.Seconds())
+	for _, server := range servers {
+		usage := database.ServerUsage{ServerID: server.ID, Period: billingPeriodLabel(&server, now), TrackedSeconds: seconds}
+		if server.Status == "running" {
+			usage.RunningSeconds = seconds
+		}
+		err := u.db.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "server_id"}, {Name: "period"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"tracked_seconds": gorm.Expr("server_usages.tracked_seconds + excluded.tracked_seconds"),
+				"running_seconds": gorm.Expr("server_usages.running_seconds + excluded.running_seconds"),
+			}),
+		}).Create(&usage).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// collectAccounts 读取运行中L2TP服务器各账号的累计传输计数，增量计入当月流量
+func (u *UsageService) collectAccounts(ctx context.Context, now time.Time) {
+	var servers []database.L2TPServer
+	if err := u.db.Where("type = ? AND status = ?", ServerTypeL2TP, "running").Find(&servers).Error; err != nil {
+		slog.Error("查询服务器失败", "error", err)
+		return
+	}
+	for i := range servers {
+		if ctx.Err() != nil {
+			return
+		}
+		counters, err := u.sshService.WithContext(ctx).GetAccountCounters(&servers[i])
+		if err != nil {
+			slog.Warn("读取账号流量计数失败", "server", servers[i].Name, "error", err)
+			continue
+		}
+		if err := u.RecordCounters(&servers[i], counters, now); err != nil {
+			slog.Error("保存账号流量失败", "server", servers[i].Name, "error", err)
+			continue
+		}
+		if err := u.enforceAccountQuotas(ctx, &servers[i], now); err != nil {
+			slog.Error("检查账号流量配额失败", "server", servers[i].Name, "error", err)
+		}
+	}
+}
+
+// RecordCounters 按账号的累计传输计数更新本计费周期的流量。任一方向的计数小于上一次时视为容器重建后清零；
+// 服务器首次采集时只记录基准，之后新出现的账号从零开始计算。升级前只记录了合计计数的账号，首次按方向采集时只计入合计
+func (u *UsageService) RecordCounters(server *database.L2TPServer, counters map[string]AccountCounter, now time.Time) error {
+	serverID, period := server.ID, billingPeriodLabel(server, now)
+	return u.db.Transaction(func(tx *gorm.DB) error {
+		var known int64
+		if err := tx.Model(&database.AccountUsage{}).Where("server_id = ?", serverID).Count(&known).Error; err != nil {
+			return err
+		}
+		for username, counter := range counters {
+			var usage database.AccountUsage
+			if err := tx.Where("server_id = ? AND username = ?", serverID, username).Order("period DESC").Limit(1).Find(&usage).Error; err != nil {
+				return err
+			}
+			missing := usage.ID == 0
+			total := counter.Total()
+
+			var delta, outgoing, incoming int64
+			switch {
+			case missing && known == 0:
+			case missing || total < usage.LastCounter || counter.Outgoing < usage.LastOutgoing || counter.Incoming < usage.LastIncoming:
+				delta, outgoing, incoming = total, counter.Outgoing, counter.Incoming
+			case usage.LastOutgoing == 0 && usage.LastIncoming == 0 && usage.LastCounter > 0:
+				delta = total - usage.LastCounter
+			default:
+				delta = total - usage.LastCounter
+				outgoing, incoming = counter.Outgoing-usage.LastOutgoing, counter.Incoming-usage.LastIncoming
+			}
+
+			if usage.ID == 0 || usage.Period != period {
+				usage = database.AccountUsage{ServerID: serverID, Username: username, Period: period}
+			}
+			usage.Bytes += delta
+			usage.OutgoingBytes += outgoing
+			usage.IncomingBytes += incoming
+			usage.LastCounter, usage.LastOutgoing, usage.LastIncoming = total, counter.Outgoing, counter.Incoming
+			// 停用状态由配额检查和手动恢复单独更新
+			if err := tx.Omit("suspended", "suspended_at", "quota_override").Save(&usage).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// generatePrevious 自动生成上月开始的计费周期的报告：所有服务器的该周期都结束后才生成，已生成过的月份跳过
+func (u *UsageService) generatePrevious(now time.Time) {
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	period := usagePeriod(start.AddDate(0, -1, 0))
+	if u.lastGenerated == period {
+		return
+	}
+	var servers []database.L2TPServer
+	if err := billingServers(u.db).Find(&servers).Error; err != nil {
+		return
+	}
+	for i := range servers {
+		// 起始日较晚或时区较晚的服务器该周期尚未结束，下次检查时再生成
+		if billing, err := BillingPeriodOf(&servers[i], period); err != nil || billing.End.After(now) {
+			return
+		}
+	}
+	var count int64
+	if err := u.db.Model(&database.UsageReport{}).Where("period = ?", period).Count(&count).Error; err != nil {
+		return
+	}
+	u.lastGenerated = period
+	if count > 0 {
+		return
+	}
+	if _, err := u.Generate(period); err != nil {
+		slog.Error("生成月度用量报告失败", "period", period, "error", err)
+		return
+	}
+	slog.Info("已生成月度用量报告", "period", period)
+}
+
+// Generate 生成(或重新生成)指定月份开始的计费周期的用量报告：各服务器的中转流量和在线时长，以及各L2TP账号的流量。
+// 每台服务器按各自的计费周期统计
+func (u *UsageService) Generate(period string) ([]database.UsageReport, error) {
+	if _, _, err := ParseUsagePeriod(period); err != nil {
+		return nil, err
+	}
+
+	var servers []database.L2TPServer
+	if err := billingServers(u.db).Find(&servers).Error; err != nil {
+		return nil, err
+	}
+	traffic, err := sumPeriodTraffic(u.db, servers, period, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	var uptime []database.ServerUsage
+	if err := u.db.Where("period = ?", period).Find(&uptime).Error; err != nil {
+		return nil, err
+	}
+	var accounts []database.AccountUsage
+	if err := u.db.Where("period = ? AND bytes > 0", period).Order("username").Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+
+	// 服务器合计行，包含该周期有流量或在线记录的全部服务器(含已删除的)
+	now := time.Now()
+	indexed := make(map[uint]*database.L2TPServer, len(servers))
+	for i := range servers {
+		indexed[servers[i].ID] = &servers[i]
+	}
+	totals := make(map[uint]*database.UsageReport)
+	row := func(serverID uint) *database.UsageReport {
+		if totals[serverID] == nil {
+			// 已不存在的服务器按自然月
+			server := indexed[serverID]
+			if server == nil {
+				server = &database.L2TPServer{ID: serverID}
+			}
+			billing, _ := BillingPeriodOf(server, period)
+			totals[serverID] = &database.UsageReport{
+				Period: period, ServerID: serverID, ServerName: server.Name,
+				PeriodStart: billing.Start, PeriodEnd: billing.End, GeneratedAt: now,
+			}
+		}
+		return totals[serverID]
+	}
+	for _, t := range traffic {
+		row(t.ServerID).Bytes = t.Bytes
+	}
+	for _, usage := range uptime {
+		r := row(usage.ServerID)
+		r.RunningSeconds = usage.RunningSeconds
+		if usage.TrackedSeconds > 0 {
+			r.UptimePercent = math.Round(float64(usage.RunningSeconds)*10000/float64(usage.TrackedSeconds)) / 100
+		}
+	}
+	for _, account := range accounts {
+		row(account.ServerID)
+	}
+
+	ids := make([]uint, 0, len(totals))
+	for id := range totals {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var reports []database.UsageReport
+	for _, id := range ids {
+		total := totals[id]
+		reports = append(reports, *total)
+		for _, account := range accounts {
+			if account.ServerID == id {
+				reports = append(reports, database.UsageReport{
+					Period: period, ServerID: id, ServerName: total.ServerName, Account: account.Username,
+					PeriodStart: total.PeriodStart, PeriodEnd: total.PeriodEnd, Bytes: account.Bytes, GeneratedAt: now,
+				})
+			}
+		}
+	}
+
+	err = u.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("period = ?", period).Delete(&database.UsageReport{}).Error; err != nil {
+			return err
+		}
+		if len(reports) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(reports, 100).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reports == nil {
+		reports = []database.UsageReport{}
+	}
+	return reports, nil
+}
+
+// Report 读取已生成的月度报告，serverID大于0时只返回该服务器的行
+func (u *UsageService) Report(period string, serverID uint) ([]database.UsageReport, error) {
+	if _, _, err := ParseUsagePeriod(period); err != nil {
+		return nil, err
+	}
+	query := u.db.Where("period = ?", period).Order("id")
+	if serverID > 0 {
+		query = query.Where("server_id = ?", serverID)
+	}
+	reports := []database.UsageReport{}
+	err := query.Find(&reports).Error
+	return reports, err
+}
+
+// Periods 已生成报告的月份，按时间倒序。同一月份的行在一次生成中写入，生成时间相同
+func (u *UsageService) Periods() ([]UsagePeriod, error) {
+	periods := []UsagePeriod{}
+	err := u.db.Model(&database.UsageReport{}).
+		Select("period, COUNT(*) AS row_count, generated_at").
+		Group("period, generated_at").Order("period DESC").Scan(&periods).Error
+	return periods, err
+}
+
+// ExportReport 导出月度报告
+func (u *UsageService) ExportReport(w TableWriter, period string, serverID uint) error {
+	reports, err := u.Report(period, serverID)
+	if err != nil {
+		return err
+	}
+	if err := w.Write([]interface{}{"月份", "服务器ID", "服务器名称", "账号", "周期开始", "周期结束", "流量(字节)", "流量", "在线时长(小时)", "在线率(%)"}); err != nil {
+		return err
+	}
+	for _, r := range reports {
+		hours := math.Round(float64(r.RunningSeconds)/36) / 100
+		row := []interface{}{r.Period, r.ServerID, r.ServerName, r.Account, r.PeriodStart, r.PeriodEnd, r.Bytes, FormatBytes(r.Bytes), hours, r.UptimePercent}
+		if r.Account != "" {
+			row[8], row[9] = "", ""
+		}
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
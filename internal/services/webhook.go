@@ -0,0 +1,331 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"l2tp-manager/internal/database"
+
+	"gorm.io/gorm"
+)
+
+// Webhook投递参数
+const (
+	webhookMaxAttempts   = 5                   // 单个事件最多尝试次数
+	webhookBaseBackoff   = time.Second         // 首次重试等待时间，之后逐次翻倍
+	webhookTimeout       = 10 * time.Second    // 单次请求超时
+	webhookHistoryKeep   = 30 * 24 * time.Hour // 投递记录保留时长
+	webhookResponseLimit = 512                 // 失败时记录的响应体长度上限
+)
+
+// WebhookService 外发Webhook通知渠道
+type WebhookService struct {
+	db     *gorm.DB
+	client *http.Client
+	ctx    context.Context // 控制重试等待和请求取消，由Start设置
+	mutex  sync.RWMutex
+}
+
+// NewWebhookService 创建Webhook服务
+func NewWebhookService(db *gorm.DB) *WebhookService {
+	return &WebhookService{
+		db:     db,
+		client: &http.Client{Timeout: webhookTimeout},
+		ctx:    context.Background(),
+	}
+}
+
+// Name 渠道名称
+func (w *WebhookService) Name() string {
+	return "webhook"
+}
+
+// Start 启动投递记录定期清理，ctx取消后停止未完成的重试
+func (w *WebhookService) Start(ctx context.Context) {
+	w.mutex.Lock()
+	w.ctx = ctx
+	w.mutex.Unlock()
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		result := w.db.Where("created_at < ?", time.Now().Add(-webhookHistoryKeep)).Delete(&database.WebhookDelivery{})
+		if result.Error != nil {
+			slog.Error("清理Webhook投递记录失败", "error", result.Error)
+		} else if result.RowsAffected > 0 {
+			slog.Info("已清理过期的Webhook投递记录", "count", result.RowsAffected)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliveryContext 返回投递使用的上下文
+func (w *WebhookService) deliveryContext() context.Context {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	return w.ctx
+}
+
+// Send 向所有订阅了该事件的Webhook异步投递
+func (w *WebhookService) Send(event Event) error {
+	var hooks []database.Webhook
+	if err := w.db.Where("enabled = ?", true).Find(&hooks).Error; err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	for _, hook := range hooks {
+		if event.Type != EventTest && !eventSubscribed(hook.Events, event.Type) {
+			continue
+		}
+		go w.deliver(hook, event.Type, payload)
+	}
+	return nil
+}
+
+// Test 向指定Webhook同步发送一次测试事件(不重试)，返回投递记录
+func (w *WebhookService) Test(id uint) (*database.WebhookDelivery, error) {
+	var hook database.Webhook
+	if err := w.db.First(&hook, id).Error; err != nil {
+		return nil, fmt.Errorf("Webhook不存在")
+	}
+
+	payload, err := json.Marshal(Event{
+		Type:    EventTest,
+		Message: "这是一条测试消息",
+		Time:    time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	delivery := w.attempt(hook, EventTest, payload, NewDeliveryID(), 1)
+	return &delivery, nil
+}
+
+// deliver 投递事件，失败时按指数退避重试
+func (w *WebhookService) deliver(hook database.Webhook, eventType string, payload []byte) {
+	deliveryID := NewDeliveryID()
+	backoff := webhookBaseBackoff
+
+	for attempt := 1; attempt <= webhookMaxAttempts; attempt++ {
+		delivery := w.attempt(hook, eventType, payload, deliveryID, attempt)
+		if delivery.Success {
+			return
+		}
+		if attempt == webhookMaxAttempts {
+			slog.Warn("Webhook投递最终失败", "webhook_id", hook.ID, "event", eventType,
+				"delivery_id", deliveryID, "attempts", attempt, "error", delivery.Error)
+			return
+		}
+
+		select {
+		case <-w.deliveryContext().Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// attempt 发送一次请求并记录投递结果
+func (w *WebhookService) attempt(hook database.Webhook, eventType string, payload []byte, deliveryID string, attempt int) database.WebhookDelivery {
+	delivery := database.WebhookDelivery{
+		WebhookID:  hook.ID,
+		DeliveryID: deliveryID,
+		EventType:  eventType,
+		Payload:    string(payload),
+		Attempt:    attempt,
+	}
+
+	start := time.Now()
+	statusCode, err := w.post(hook, eventType, payload, deliveryID)
+	delivery.DurationMs = time.Since(start).Milliseconds()
+	delivery.StatusCode = statusCode
+	if err != nil {
+		delivery.Error = err.Error()
+	} else {
+		delivery.Success = true
+	}
+
+	if err := w.db.Create(&delivery).Error; err != nil {
+		slog.Error("保存Webhook投递记录失败", "webhook_id", hook.ID, "error", err)
+	}
+	return delivery
+}
+
+// post 发送签名后的POST请求，非2xx响应视为失败
+func (w *WebhookService) post(hook database.Webhook, eventType string, payload []byte, deliveryID string) (int, error) {
+	req, err := http.NewRequestWithContext(w.deliveryContext(), http.MethodPost, hook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "l2tp-manager-webhook")
+	req.Header.Set("X-L2TP-Event", eventType)
+	req.Header.Set("X-L2TP-Delivery", deliveryID)
+	req.Header.Set("X-L2TP-Timestamp", timestamp)
+	if hook.Secret != "" {
+		req.Header.Set("X-L2TP-Signature", "sha256="+SignWebhook(hook.Secret, timestamp, payload))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseLimit))
+		return resp.StatusCode, fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
+
+// SignWebhook 计算签名: HMAC-SHA256(secret, timestamp + "." + body)的十六进制
+func SignWebhook(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewDeliveryID 生成投递ID，同一事件的重试共用
+func NewDeliveryID() string {
+	return "whd_" + strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// validateWebhook 校验URL和事件列表，并规范化事件列表
+func validateWebhook(hook *database.Webhook) error {
+	hook.Name = strings.TrimSpace(hook.Name)
+	if hook.Name == "" {
+		return fmt.Errorf("名称不能为空")
+	}
+	u, err := url.Parse(hook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("无效的URL，仅支持http/https")
+	}
+
+	var events []string
+	for _, e := range strings.Split(hook.Events, ",") {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		known := false
+		for _, supported := range NotificationEvents {
+			if e == supported {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("不支持的事件类型: %s", e)
+		}
+		events = append(events, e)
+	}
+	hook.Events = strings.Join(events, ",")
+	return nil
+}
+
+// ListWebhooks 获取全部Webhook(密钥已隐藏)
+func (w *WebhookService) ListWebhooks() ([]database.Webhook, error) {
+	var hooks []database.Webhook
+	if err := w.db.Order("id").Find(&hooks).Error; err != nil {
+		return nil, err
+	}
+	for i := range hooks {
+		hooks[i] = *MaskWebhook(&hooks[i])
+	}
+	return hooks, nil
+}
+
+// CreateWebhook 创建Webhook
+func (w *WebhookService) CreateWebhook(hook *database.Webhook) error {
+	hook.ID = 0
+	if err := validateWebhook(hook); err != nil {
+		return err
+	}
+	return w.db.Create(hook).Error
+}
+
+// UpdateWebhook 更新Webhook，密钥为占位符时保留原值
+func (w *WebhookService) UpdateWebhook(id uint, update *database.Webhook) (*database.Webhook, error) {
+	var hook database.Webhook
+	if err := w.db.First(&hook, id).Error; err != nil {
+		return nil, fmt.Errorf("Webhook不存在")
+	}
+	if err := validateWebhook(update); err != nil {
+		return nil, err
+	}
+
+	hook.Name = update.Name
+	hook.URL = update.URL
+	hook.Events = update.Events
+	hook.Enabled = update.Enabled
+	if update.Secret != secretMask {
+		hook.Secret = update.Secret
+	}
+	if err := w.db.Save(&hook).Error; err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+// DeleteWebhook 删除Webhook及其投递记录
+func (w *WebhookService) DeleteWebhook(id uint) error {
+	return w.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&database.Webhook{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("Webhook不存在")
+		}
+		return tx.Where("webhook_id = ?", id).Delete(&database.WebhookDelivery{}).Error
+	})
+}
+
+// Deliveries 获取Webhook最近的投递记录
+func (w *WebhookService) Deliveries(id uint, limit int) ([]database.WebhookDelivery, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	var deliveries []database.WebhookDelivery
+	err := w.db.Where("webhook_id = ?", id).Order("id DESC").Limit(limit).Find(&deliveries).Error
+	return deliveries, err
+}
+
+// MaskWebhook 返回隐藏密钥后的副本
+func MaskWebhook(hook *database.Webhook) *database.Webhook {
+	masked := *hook
+	if masked.Secret != "" {
+		masked.Secret = secretMask
+	}
+	return &masked
+}
@@ -1,44 +1,181 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"l2tp-manager/internal/database"
+	"l2tp-manager/internal/i18n"
+	"l2tp-manager/internal/metrics"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"golang.org/x/time/rate"
+)
+
+// replayBufferSize 每种消息类型保留的最近消息数，供断线重连的客户端补发
+const replayBufferSize = 100
+
+// wsAuthTimeout 未携带token查询参数时，等待首条认证消息的时间
+const wsAuthTimeout = 10 * time.Second
+
+// WebSocket关闭码(应用自定义范围4000-4999)
+const (
+	wsCloseUnauthorized = 4401 // 认证失败
+	wsCloseSlowClient   = 4408 // 发送队列积压被断开，客户端应带since重连补发
+)
+
+// 消息队列参数
+const (
+	wsBroadcastBuffer = 1024             // 分发循环的待广播消息缓冲
+	wsClientQueueSize = 256              // 每个客户端的发送队列长度
+	wsWriteTimeout    = 10 * time.Second // 单条消息写入超时，超时视为连接失效
+)
+
+// 客户端命令限速：每个连接每秒wsCommandRate条，允许突发wsCommandBurst条
+const (
+	wsCommandRate  = 2
+	wsCommandBurst = 5
 )
 
+// WSTopicTraffic 实时吞吐量主题，数据量大且只有当前值有意义，需订阅才推送且不参与补发
+const WSTopicTraffic = "traffic"
+
+// wsTopics 客户端可订阅的主题
+var wsTopics = []string{WSTopicTraffic}
+
 // Client WebSocket客户端信息
 type Client struct {
-	conn *websocket.Conn
-	send chan []byte
+	conn      *websocket.Conn
+	send      chan []byte // 发送队列，由分发循环写入、writeMessages消费
+	evicted   atomic.Bool // 因发送队列积压被断开
+	UserID    uint // 认证用户，供按用户过滤消息
+	Username  string
+	TenantID  uint // 所属租户，租户用户只接收自己服务器的状态消息
+	Language  string // 消息语言，按用户设置或握手请求的Accept-Language确定
+	since     uint64          // 连接时请求补发序号大于该值的消息
+	sinceTime time.Time       // 连接时请求补发该时间之后的消息
+	topics    map[string]bool // 已订阅的主题
+	logTails  map[uint]*logTail // 服务器ID -> 日志跟踪
+	limiter   *rate.Limiter               // 客户端命令限速
+	ctx       context.Context             // 连接断开后取消，用于结束该连接发起的后台任务
+	cancel    context.CancelFunc
+	mutex     sync.RWMutex
+}
+
+// Context 连接的上下文，连接断开后取消
+func (client *Client) Context() context.Context {
+	return client.ctx
+}
+
+// subscribe 订阅或取消订阅主题，忽略未知主题
+func (client *Client) subscribe(topics []string, on bool) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	for _, topic := range topics {
+		if containsString(wsTopics, topic) {
+			client.topics[topic] = on
+		}
+	}
+}
+
+// subscribed 是否订阅了指定主题
+func (client *Client) subscribed(topic string) bool {
+	client.mutex.RLock()
+	defer client.mutex.RUnlock()
+	return client.topics[topic]
+}
+
+// wsEvent 待广播的消息及其序号，Topic非空时只发给订阅者
+type wsEvent struct {
+	Type      string
+	Topic     string
+	Seq       uint64
+	Time      time.Time
+	TenantID  uint // 消息涉及的服务器所属租户，0表示平台或与服务器无关
+	Data      []byte
+	localized map[string][]byte // 语言 -> 翻译后的消息，只在分发循环中读写
 }
 
+// payload 按客户端语言翻译后的消息，同一语言只翻译一次
+func (event *wsEvent) payload(lang string) []byte {
+	if lang == i18n.Default {
+		return event.Data
+	}
+	if data, ok := event.localized[lang]; ok {
+		return data
+	}
+	data := i18n.TranslateJSON(lang, event.Data)
+	event.localized[lang] = data
+	return data
+}
+
+// directMessage 发给单个客户端的消息
+type directMessage struct {
+	client *Client
+	data   []byte
+}
+
+// WSCommand 客户端发送的消息，如 {"type":"subscribe","topics":["traffic"]}
+// 或 {"type":"refresh_status","id":"1","server_id":3}
+type WSCommand struct {
+	Type     string   `json:"type"`
+	ID       string   `json:"id,omitempty"` // 客户端自定义的请求ID，原样带回命令结果
+	Topics   []string `json:"topics,omitempty"`
+	ServerID uint     `json:"server_id,omitempty"`
+	Lines    int      `json:"lines,omitempty"`
+}
+
+// WSCommandResult 命令结果，以command_result类型发回发起命令的客户端
+type WSCommandResult struct {
+	ID      string      `json:"id,omitempty"`
+	Command string      `json:"command"`
+	Result  interface{} `json:"result,omitempty"`
+}
+
+// WSCommandFunc 命令处理函数，在独立协程中执行
+type WSCommandFunc func(client *Client, cmd WSCommand) (interface{}, error)
+
 // WSManager WebSocket管理器
 type WSManager struct {
 	clients    map[*Client]bool
 	register   chan *Client
 	unregister chan *Client
-	broadcast  chan []byte
+	broadcast  chan wsEvent
+	direct     chan directMessage
+	commands   map[string]WSCommandFunc
+	replay     map[string][]wsEvent // 消息类型 -> 最近的消息(按序号递增)
+	seq        atomic.Uint64
 	mutex      sync.RWMutex
+	running    atomic.Bool
+	listeners  map[chan StatusMessage]struct{} // 进程内的事件监听者(如gRPC事件流)
+	listenMutex sync.Mutex
+	serverTenant func(serverID uint) (uint, bool) // 查询服务器所属租户，未设置时视为全部属于平台
+	userLanguage func(userID uint) string          // 查询用户设置的界面语言，为空表示未设置
 }
 
 // StatusMessage 状态消息结构
 type StatusMessage struct {
 	Type     string      `json:"type"`
+	Seq      uint64      `json:"seq"` // 全局递增序号，重连时通过since参数补发
+	Time     time.Time   `json:"time"`
 	ServerID uint        `json:"server_id"`
 	Status   string      `json:"status"`
 	Message  string      `json:"message,omitempty"`
 	Data     interface{} `json:"data,omitempty"`
 }
 
-var (
-	upgrader = websocket.Upgrader{
-		// 使用默认的同源策略检查
-	}
-	wsManager *WSManager
-)
+var upgrader = websocket.Upgrader{
+	// 使用默认的同源策略检查
+}
 
 // NewWSManager 创建WebSocket管理器
 func NewWSManager() *WSManager {
@@ -46,58 +183,245 @@ func NewWSManager() *WSManager {
 		clients:    make(map[*Client]bool),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
-		broadcast:  make(chan []byte),
+		broadcast:  make(chan wsEvent, wsBroadcastBuffer),
+		direct:     make(chan directMessage, wsClientQueueSize),
+		commands:   make(map[string]WSCommandFunc),
+		replay:     make(map[string][]wsEvent),
+		listeners:  make(map[chan StatusMessage]struct{}),
 	}
 }
 
-// Start 启动WebSocket管理器
-func (manager *WSManager) Start() {
+// Start 运行WebSocket管理器的消息分发循环，直到ctx结束；结束时断开全部客户端
+func (manager *WSManager) Start(ctx context.Context) {
+	manager.running.Store(true)
+	defer manager.running.Store(false)
+
 	for {
 		select {
+		case <-ctx.Done():
+			manager.mutex.RLock()
+			clients := make([]*Client, 0, len(manager.clients))
+			for client := range manager.clients {
+				clients = append(clients, client)
+			}
+			manager.mutex.RUnlock()
+			for _, client := range clients {
+				manager.removeClient(client)
+			}
+			return
+
 		case client := <-manager.register:
+			// 在分发循环中补发，保证补发消息与后续实时消息之间不丢失也不乱序
+			manager.replayTo(client)
 			manager.mutex.Lock()
 			manager.clients[client] = true
 			manager.mutex.Unlock()
-			log.Printf("WebSocket客户端已连接，当前连接数: %d", len(manager.clients))
+			slog.Debug("WebSocket客户端已连接", "clients", len(manager.clients))
 			
 		case client := <-manager.unregister:
-			manager.mutex.Lock()
-			if _, ok := manager.clients[client]; ok {
-				delete(manager.clients, client)
-				close(client.send)
+			if manager.removeClient(client) {
+				slog.Debug("WebSocket客户端已断开", "clients", manager.ClientCount())
 			}
-			manager.mutex.Unlock()
-			log.Printf("WebSocket客户端已断开，当前连接数: %d", len(manager.clients))
-			
-		case message := <-manager.broadcast:
-			manager.mutex.RLock()
-			for client := range manager.clients {
-				select {
-				case client.send <- message:
-				default:
-					delete(manager.clients, client)
-					close(client.send)
-				}
+
+		case event := <-manager.broadcast:
+			manager.dispatch(event)
+
+		case msg := <-manager.direct:
+			// 客户端集合只在本循环中修改，此处读取无需加锁
+			if !manager.clients[msg.client] {
+				continue
+			}
+			select {
+			case msg.client.send <- msg.data:
+			default:
+				metrics.WebSocketDroppedMessages.Inc("client_queue_full")
+			}
+		}
+	}
+}
+
+// dispatch 将消息放入各客户端的发送队列。队列已满时：主题消息只对该客户端丢弃
+// (下一次推送会带来最新值)；状态消息则断开该客户端，由其带since重连后从补发缓冲区恢复，
+// 避免慢客户端拖住分发循环或静默丢失状态变化
+func (manager *WSManager) dispatch(event wsEvent) {
+	if event.Topic == "" {
+		buffer := append(manager.replay[event.Type], event)
+		if len(buffer) > replayBufferSize {
+			buffer = buffer[len(buffer)-replayBufferSize:]
+		}
+		manager.replay[event.Type] = buffer
+	}
+
+	// 客户端集合只在分发循环中修改，遍历时持读锁，需要断开的客户端在遍历结束后再移除
+	var slow []*Client
+	manager.mutex.RLock()
+	for client := range manager.clients {
+		if event.Topic != "" && !client.subscribed(event.Topic) {
+			continue
+		}
+		if !client.receives(event) {
+			continue
+		}
+		select {
+		case client.send <- event.payload(client.Language):
+		default:
+			if event.Topic != "" {
+				metrics.WebSocketDroppedMessages.Inc("client_queue_full")
+				continue
+			}
+			slow = append(slow, client)
+		}
+	}
+	manager.mutex.RUnlock()
+
+	for _, client := range slow {
+		client.evicted.Store(true)
+		if manager.removeClient(client) {
+			metrics.WebSocketDroppedMessages.Inc("client_evicted")
+			metrics.WebSocketEvictedClients.Inc()
+			slog.Warn("WebSocket客户端发送队列积压，已断开", "username", client.Username, "type", event.Type)
+		}
+	}
+}
+
+// removeClient 移除客户端并关闭其发送队列，客户端已移除时返回false
+func (manager *WSManager) removeClient(client *Client) bool {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	if _, ok := manager.clients[client]; !ok {
+		return false
+	}
+	delete(manager.clients, client)
+	close(client.send)
+	client.cancel()
+	return true
+}
+
+// replayTo 向新连接的客户端补发错过的消息，未指定since时不补发
+func (manager *WSManager) replayTo(client *Client) {
+	if client.since == 0 && client.sinceTime.IsZero() {
+		return
+	}
+
+	// 客户端记录的序号大于当前序号说明服务已重启，补发缓冲区中的全部消息
+	since := client.since
+	if since > manager.seq.Load() {
+		since = 0
+	}
+
+	var missed []wsEvent
+	for _, buffer := range manager.replay {
+		for _, event := range buffer {
+			if event.Seq > since && event.Time.After(client.sinceTime) && client.receives(event) {
+				missed = append(missed, event)
 			}
-			manager.mutex.RUnlock()
 		}
 	}
+	sort.Slice(missed, func(i, j int) bool { return missed[i].Seq < missed[j].Seq })
+
+	// 只补发发送队列能容纳的最新消息
+	if len(missed) > cap(client.send) {
+		missed = missed[len(missed)-cap(client.send):]
+	}
+	for _, event := range missed {
+		client.send <- event.payload(client.Language)
+	}
+	if len(missed) > 0 {
+		slog.Debug("已向重连的WebSocket客户端补发消息", "count", len(missed))
+	}
+}
+
+// Running 消息分发循环是否在运行
+func (manager *WSManager) Running() bool {
+	return manager.running.Load()
+}
+
+// ClientCount 当前WebSocket连接数
+func (manager *WSManager) ClientCount() int {
+	manager.mutex.RLock()
+	defer manager.mutex.RUnlock()
+	return len(manager.clients)
+}
+
+// TopicSubscribers 订阅了指定主题的连接数
+func (manager *WSManager) TopicSubscribers(topic string) int {
+	manager.mutex.RLock()
+	defer manager.mutex.RUnlock()
+	count := 0
+	for client := range manager.clients {
+		if client.subscribed(topic) {
+			count++
+		}
+	}
+	return count
+}
+
+// wsAuthMessage 首条认证消息
+type wsAuthMessage struct {
+	Type  string `json:"type"`
+	Token string `json:"token"`
 }
 
-// HandleWebSocket 处理WebSocket连接
-func (manager *WSManager) HandleWebSocket(c *gin.Context) {
+// HandleWebSocket 处理WebSocket连接。令牌可通过token查询参数传递(握手前校验)，
+// 或在连接建立后发送 {"type":"auth","token":"..."} 作为首条消息
+func (manager *WSManager) HandleWebSocket(c *gin.Context, authService *AuthService) {
+	var claims *Claims
+	if token := c.Query("token"); token != "" {
+		var err error
+		if claims, err = authService.ValidateToken(token); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"message": "无效的认证令牌",
+			})
+			return
+		}
+	}
+
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
-		log.Printf("WebSocket升级失败: %v", err)
+		slog.Error("WebSocket升级失败", "error", err)
 		return
 	}
 
-	// 创建客户端
+	if claims == nil {
+		if claims, err = authenticateConn(conn, authService); err != nil {
+			slog.Warn("WebSocket认证失败", "client_ip", c.ClientIP(), "error", err)
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(wsCloseUnauthorized, "unauthorized"), time.Now().Add(time.Second))
+			conn.Close()
+			return
+		}
+	}
+
+	// 创建客户端，since为上次收到的消息序号或RFC3339时间，topics为逗号分隔的订阅主题
 	client := &Client{
-		conn: conn,
-		send: make(chan []byte, 256),
+		conn:     conn,
+		send:     make(chan []byte, wsClientQueueSize),
+		UserID:   claims.UserID,
+		Username: claims.Username,
+		TenantID: claims.TenantID,
+		Language: manager.clientLanguage(c, claims.UserID),
+		topics:   make(map[string]bool),
+		logTails: make(map[uint]*logTail),
+		limiter:  rate.NewLimiter(wsCommandRate, wsCommandBurst),
 	}
-	
+	client.ctx, client.cancel = context.WithCancel(context.Background())
+	client.subscribe(splitList(c.Query("topics")), true)
+	if since := c.Query("since"); since != "" {
+		if seq, err := strconv.ParseUint(since, 10, 64); err == nil {
+			client.since = seq
+		} else if t, err := time.Parse(time.RFC3339, since); err == nil {
+			client.sinceTime = t
+		}
+	}
+
+	// 告知客户端认证成功
+	ack, _ := json.Marshal(StatusMessage{Type: "auth_ok", Time: time.Now(), Data: gin.H{"username": claims.Username}})
+	if err := conn.WriteMessage(websocket.TextMessage, ack); err != nil {
+		conn.Close()
+		return
+	}
+
 	// 注册客户端
 	manager.register <- client
 
@@ -106,6 +430,21 @@ func (manager *WSManager) HandleWebSocket(c *gin.Context) {
 	go manager.readMessages(client)
 }
 
+// authenticateConn 读取并校验首条认证消息
+func authenticateConn(conn *websocket.Conn, authService *AuthService) (*Claims, error) {
+	conn.SetReadDeadline(time.Now().Add(wsAuthTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	var msg wsAuthMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		return nil, fmt.Errorf("读取认证消息失败: %v", err)
+	}
+	if msg.Type != "auth" || msg.Token == "" {
+		return nil, fmt.Errorf("首条消息必须是认证消息")
+	}
+	return authService.ValidateToken(msg.Token)
+}
+
 // writeMessages 发送消息到客户端
 func (manager *WSManager) writeMessages(client *Client) {
 	defer func() {
@@ -116,19 +455,24 @@ func (manager *WSManager) writeMessages(client *Client) {
 		select {
 		case message, ok := <-client.send:
 			if !ok {
-				client.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				closeMessage := []byte{}
+				if client.evicted.Load() {
+					closeMessage = websocket.FormatCloseMessage(wsCloseSlowClient, "slow client")
+				}
+				client.conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(time.Second))
 				return
 			}
-			
+
+			client.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
 			if err := client.conn.WriteMessage(websocket.TextMessage, message); err != nil {
-				log.Printf("WebSocket发送消息失败: %v", err)
+				slog.Warn("WebSocket发送消息失败", "error", err)
 				return
 			}
 		}
 	}
 }
 
-// readMessages 接收客户端消息
+// readMessages 接收客户端消息，处理主题订阅和命令
 func (manager *WSManager) readMessages(client *Client) {
 	defer func() {
 		manager.unregister <- client
@@ -136,85 +480,243 @@ func (manager *WSManager) readMessages(client *Client) {
 	}()
 
 	for {
-		_, _, err := client.conn.ReadMessage()
+		_, data, err := client.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("WebSocket读取消息错误: %v", err)
+				slog.Debug("WebSocket读取消息错误", "error", err)
 			}
 			break
 		}
+
+		var cmd WSCommand
+		if !client.limiter.Allow() {
+			json.Unmarshal(data, &cmd)
+			metrics.WebSocketDroppedMessages.Inc("command_rate_limited")
+			manager.reply(client, cmd, nil, fmt.Errorf("命令过于频繁，请稍后再试"))
+			continue
+		}
+		if err := json.Unmarshal(data, &cmd); err != nil || cmd.Type == "" {
+			manager.reply(client, cmd, nil, fmt.Errorf("无效的消息格式"))
+			continue
+		}
+
+		switch cmd.Type {
+		case "subscribe":
+			client.subscribe(cmd.Topics, true)
+		case "unsubscribe":
+			client.subscribe(cmd.Topics, false)
+		default:
+			manager.execute(client, cmd)
+		}
 	}
 }
 
-// BroadcastServerStatus 广播服务器状态变化
-func (manager *WSManager) BroadcastServerStatus(serverID uint, status, message string) {
-	statusMsg := StatusMessage{
-		Type:     "server_status",
-		ServerID: serverID,
-		Status:   status,
-		Message:  message,
+// HandleCommand 注册客户端命令，需在开始接受连接之前调用
+func (manager *WSManager) HandleCommand(name string, handler WSCommandFunc) {
+	manager.commands[name] = handler
+}
+
+// execute 异步执行命令并将结果发回客户端
+func (manager *WSManager) execute(client *Client, cmd WSCommand) {
+	handler, ok := manager.commands[cmd.Type]
+	if !ok {
+		manager.reply(client, cmd, nil, fmt.Errorf("未知命令: %s", cmd.Type))
+		return
 	}
+	go func() {
+		result, err := handler(client, cmd)
+		manager.reply(client, cmd, result, err)
+	}()
+}
 
-	data, err := json.Marshal(statusMsg)
+// reply 发送命令结果
+func (manager *WSManager) reply(client *Client, cmd WSCommand, result interface{}, err error) {
+	msg := StatusMessage{
+		Type:     "command_result",
+		ServerID: cmd.ServerID,
+		Status:   "ok",
+		Data:     WSCommandResult{ID: cmd.ID, Command: cmd.Type, Result: result},
+	}
+	if err != nil {
+		msg.Status = "error"
+		msg.Message = err.Error()
+	}
+	manager.SendTo(client, msg)
+}
+
+// SendTo 向单个客户端发送消息(不分配序号，不参与补发)，客户端断开后丢弃
+func (manager *WSManager) SendTo(client *Client, msg StatusMessage) {
+	msg.Time = time.Now()
+	msg.Message = i18n.Translate(client.Language, msg.Message)
+	data, err := json.Marshal(msg)
 	if err != nil {
-		log.Printf("序列化状态消息失败: %v", err)
+		slog.Error("序列化WebSocket消息失败", "type", msg.Type, "error", err)
 		return
 	}
 
 	select {
-	case manager.broadcast <- data:
-	default:
-		log.Println("WebSocket广播通道已满，跳过消息")
+	case manager.direct <- directMessage{client: client, data: data}:
+	case <-client.ctx.Done():
 	}
 }
 
+// BroadcastServerStatus 广播服务器状态变化
+func (manager *WSManager) BroadcastServerStatus(serverID uint, status, message string) {
+	manager.publish(StatusMessage{
+		Type:     "server_status",
+		ServerID: serverID,
+		Status:   status,
+		Message:  message,
+	})
+}
+
 // BroadcastServerCreated 广播服务器创建
 func (manager *WSManager) BroadcastServerCreated(server interface{}, message string) {
-	statusMsg := StatusMessage{
+	manager.publish(StatusMessage{
 		Type:    "server_created",
 		Message: message,
 		Data:    server,
-	}
-
-	data, err := json.Marshal(statusMsg)
-	if err != nil {
-		log.Printf("序列化服务器创建消息失败: %v", err)
-		return
-	}
-
-	select {
-	case manager.broadcast <- data:
-	default:
-		log.Println("WebSocket广播通道已满，跳过消息")
-	}
+	})
 }
 
 // BroadcastServerUpdated 广播服务器更新
 func (manager *WSManager) BroadcastServerUpdated(server interface{}, message string) {
-	statusMsg := StatusMessage{
+	manager.publish(StatusMessage{
 		Type:    "server_updated",
 		Message: message,
 		Data:    server,
+	})
+}
+
+// BroadcastJobProgress 广播任务进度
+func (manager *WSManager) BroadcastJobProgress(progress JobProgress) {
+	manager.publish(StatusMessage{
+		Type:     "job_progress",
+		ServerID: progress.ServerID,
+		Status:   progress.Status,
+		Message:  progress.Detail,
+		Data:     progress,
+	})
+}
+
+// BroadcastJobFinished 推送任务结束消息，data为任务的最终状态
+func (manager *WSManager) BroadcastJobFinished(job JobView) {
+	manager.publish(StatusMessage{
+		Type:     "job_finished",
+		ServerID: job.ServerID,
+		Status:   job.Status,
+		Message:  job.Error,
+		Data:     job,
+	})
+}
+
+// BroadcastTraffic 向订阅了traffic主题的客户端推送各端口的实时吞吐量
+func (manager *WSManager) BroadcastTraffic(samples []ThroughputSample) {
+	manager.publishTopic(WSTopicTraffic, StatusMessage{
+		Type: "traffic",
+		Data: samples,
+	})
+}
+
+// publish 分配序号并提交消息到分发循环，同时通知进程内的监听者
+func (manager *WSManager) publish(msg StatusMessage) {
+	msg.Seq = manager.seq.Add(1)
+	msg.Time = time.Now()
+	manager.publishTopic("", msg)
+
+	manager.listenMutex.Lock()
+	for listener := range manager.listeners {
+		select {
+		case listener <- msg:
+		default:
+			metrics.WebSocketDroppedMessages.Inc("listener_full")
+		}
 	}
+	manager.listenMutex.Unlock()
+}
+
+// Listen 注册进程内的事件监听，接收与WebSocket客户端相同的状态消息(不含主题消息)，
+// 返回消息通道和取消函数。监听者处理不及时时丢弃消息
+func (manager *WSManager) Listen() (<-chan StatusMessage, func()) {
+	listener := make(chan StatusMessage, wsClientQueueSize)
+	manager.listenMutex.Lock()
+	manager.listeners[listener] = struct{}{}
+	manager.listenMutex.Unlock()
+
+	return listener, func() {
+		manager.listenMutex.Lock()
+		delete(manager.listeners, listener)
+		manager.listenMutex.Unlock()
+	}
+}
+
+// publishTopic 提交消息到分发循环，主题消息不分配序号
+func (manager *WSManager) publishTopic(topic string, msg StatusMessage) {
+	msg.Time = time.Now()
 
-	data, err := json.Marshal(statusMsg)
+	data, err := json.Marshal(msg)
 	if err != nil {
-		log.Printf("序列化服务器更新消息失败: %v", err)
+		slog.Error("序列化WebSocket消息失败", "type", msg.Type, "error", err)
 		return
 	}
 
+	event := wsEvent{Type: msg.Type, Topic: topic, Seq: msg.Seq, Time: msg.Time, TenantID: manager.messageTenant(msg), Data: data, localized: make(map[string][]byte)}
 	select {
-	case manager.broadcast <- data:
+	case manager.broadcast <- event:
 	default:
-		log.Println("WebSocket广播通道已满，跳过消息")
+		metrics.WebSocketDroppedMessages.Inc("broadcast_full")
+		slog.Warn("WebSocket广播缓冲已满，跳过消息", "type", msg.Type)
 	}
 }
 
-// GetWSManager 获取全局WebSocket管理器
-func GetWSManager() *WSManager {
-	if wsManager == nil {
-		wsManager = NewWSManager()
-		go wsManager.Start()
+// SetTenantResolver 设置查询服务器所属租户的函数，用于按租户过滤推送给租户用户的消息
+func (manager *WSManager) SetTenantResolver(resolver func(serverID uint) (uint, bool)) {
+	manager.serverTenant = resolver
+}
+
+// SetLanguageResolver 设置查询用户界面语言的函数，用于翻译推送给该用户的消息
+func (manager *WSManager) SetLanguageResolver(resolver func(userID uint) string) {
+	manager.userLanguage = resolver
+}
+
+// clientLanguage 连接使用的语言：用户设置了界面语言时使用该语言，否则按握手请求的Accept-Language协商
+func (manager *WSManager) clientLanguage(c *gin.Context, userID uint) string {
+	if manager.userLanguage != nil {
+		if lang := manager.userLanguage(userID); lang != "" {
+			return lang
+		}
 	}
-	return wsManager
-} 
\ No newline at end of file
+	return i18n.Negotiate(c.GetHeader("Accept-Language"))
+}
+
+// messageTenant 消息涉及的服务器所属租户
+func (manager *WSManager) messageTenant(msg StatusMessage) uint {
+	if server, ok := msg.Data.(*database.L2TPServer); ok {
+		return server.TenantID
+	}
+	if msg.ServerID == 0 || manager.serverTenant == nil {
+		return 0
+	}
+	tenantID, _ := manager.serverTenant(msg.ServerID)
+	return tenantID
+}
+
+// CanAccessServer 客户端是否可以访问服务器，平台用户可访问全部服务器
+func (manager *WSManager) CanAccessServer(client *Client, serverID uint) bool {
+	if client.TenantID == 0 {
+		return true
+	}
+	if manager.serverTenant == nil {
+		return false
+	}
+	tenantID, ok := manager.serverTenant(serverID)
+	return ok && tenantID == client.TenantID
+}
+
+// receives 客户端是否接收该消息：租户用户只接收自己服务器的状态消息，不接收主题推送
+func (client *Client) receives(event wsEvent) bool {
+	if client.TenantID == 0 {
+		return true
+	}
+	return event.Topic == "" && event.TenantID == client.TenantID
+}
@@ -0,0 +1,466 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"l2tp-manager/internal/database"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/ssh"
+)
+
+// WireGuard落地机配置
+const (
+	WireGuardListenPort = 51820 // 落地机上WireGuard的监听端口(UDP)
+
+	wireGuardInterface  = "wg0"
+	wireGuardService    = "wg-quick@wg0"
+	wireGuardConfigPath = "/etc/wireguard/wg0.conf"
+	wireGuardSubnet     = "10.66.66.0/24"
+	wireGuardAddress    = "10.66.66.%d" // 服务端为.1，客户端从.2开始分配
+	wireGuardMaxPeers   = 253
+	wireGuardClientDNS  = "1.1.1.1"
+	wireGuardKeepalive  = 25 // 默认的客户端保活间隔(秒)，保持NAT映射
+
+	// wireGuardHandshakeWindow 最近握手在此时间内的客户端视为在线(活跃连接每2分钟重新握手)
+	wireGuardHandshakeWindow = 3 * time.Minute
+)
+
+// WireGuardPeer WireGuard客户端，按服务器的用户配置生成，密钥和地址在用户保留期间不变
+type WireGuardPeer struct {
+	Name       string `json:"name"`
+	Address    string `json:"address"` // 隧道内地址
+	PublicKey  string `json:"public_key"`
+	PrivateKey string `json:"private_key,omitempty"`
+}
+
+// generateWireGuardKey 生成WireGuard密钥对(base64编码)
+func generateWireGuardKey() (privateKey, publicKey string, err error) {
+	private := make([]byte, curve25519.ScalarSize)
+	if _, err := rand.Read(private); err != nil {
+		return "", "", err
+	}
+	private[0] &= 248
+	private[31] = (private[31] & 127) | 64
+
+	public, err := curve25519.X25519(private, curve25519.Basepoint)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(private), base64.StdEncoding.EncodeToString(public), nil
+}
+
+// wireGuardPublicKey 由私钥计算公钥
+func wireGuardPublicKey(privateKey string) (string, error) {
+	private, err := base64.StdEncoding.DecodeString(privateKey)
+	if err != nil || len(private) != curve25519.ScalarSize {
+		return "", fmt.Errorf("无效的WireGuard私钥")
+	}
+	public, err := curve25519.X25519(private, curve25519.Basepoint)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(public), nil
+}
+
+// parseWireGuardPeers 解析服务器记录中的WireGuard客户端
+func parseWireGuardPeers(value string) ([]WireGuardPeer, error) {
+	var peers []WireGuardPeer
+	if value == "" {
+		return peers, nil
+	}
+	err := json.Unmarshal([]byte(value), &peers)
+	return peers, err
+}
+
+// prepareWireGuard 为WireGuard服务器生成服务端密钥，并按用户配置同步客户端：
+// 保留仍存在的用户的密钥和地址，为新用户生成密钥并分配地址。existing为更新前的记录，创建时为nil
+func prepareWireGuard(server, existing *database.L2TPServer) error {
+	if server.Type != ServerTypeWireGuard {
+		server.WireGuardPrivateKey = ""
+		server.WireGuardPeers = ""
+		return nil
+	}
+	if existing != nil {
+		server.WireGuardPrivateKey = existing.WireGuardPrivateKey
+		server.WireGuardPeers = existing.WireGuardPeers
+	}
+
+	if server.WireGuardPrivateKey == "" {
+		privateKey, _, err := generateWireGuardKey()
+		if err != nil {
+			return fmt.Errorf("生成WireGuard密钥失败: %v", err)
+		}
+		server.WireGuardPrivateKey = privateKey
+	} else if _, err := wireGuardPublicKey(server.WireGuardPrivateKey); err != nil {
+		return err
+	}
+
+	var users []L2TPUser
+	if server.Users != "" {
+		if err := json.Unmarshal([]byte(server.Users), &users); err != nil {
+			return fmt.Errorf("解析用户配置失败: %v", err)
+		}
+	}
+	if len(users) > wireGuardMaxPeers {
+		return fmt.Errorf("WireGuard服务器最多支持%d个用户", wireGuardMaxPeers)
+	}
+
+	previous, err := parseWireGuardPeers(server.WireGuardPeers)
+	if err != nil {
+		return fmt.Errorf("解析WireGuard客户端失败: %v", err)
+	}
+	kept := make(map[string]WireGuardPeer)
+	for _, user := range users {
+		for _, peer := range previous {
+			if peer.Name == user.Username {
+				kept[peer.Name] = peer
+			}
+		}
+	}
+	usedAddresses := make(map[string]bool)
+	for _, peer := range kept {
+		usedAddresses[peer.Address] = true
+	}
+
+	peers := make([]WireGuardPeer, 0, len(users))
+	seen := make(map[string]bool)
+	next := 2
+	for _, user := range users {
+		if !clientNamePattern.MatchString(user.Username) {
+			return fmt.Errorf("WireGuard用户名 %q 只能包含字母、数字和 . _ @ -，且不超过64个字符", user.Username)
+		}
+		if seen[user.Username] {
+			return fmt.Errorf("用户名 %s 重复", user.Username)
+		}
+		seen[user.Username] = true
+
+		peer, ok := kept[user.Username]
+		if !ok {
+			privateKey, publicKey, err := generateWireGuardKey()
+			if err != nil {
+				return fmt.Errorf("生成WireGuard密钥失败: %v", err)
+			}
+			for usedAddresses[fmt.Sprintf(wireGuardAddress, next)] {
+				next++
+			}
+			peer = WireGuardPeer{
+				Name:       user.Username,
+				Address:    fmt.Sprintf(wireGuardAddress, next),
+				PublicKey:  publicKey,
+				PrivateKey: privateKey,
+			}
+			usedAddresses[peer.Address] = true
+		}
+		peers = append(peers, peer)
+	}
+
+	data, err := json.Marshal(peers)
+	if err != nil {
+		return err
+	}
+	server.WireGuardPeers = string(data)
+	return nil
+}
+
+// wireGuardServerConfig 生成落地机的wg-quick配置，客户端流量经落地机出口NAT
+func wireGuardServerConfig(server *database.L2TPServer) (string, error) {
+	peers, err := parseWireGuardPeers(server.WireGuardPeers)
+	if err != nil {
+		return "", fmt.Errorf("解析WireGuard客户端失败: %v", err)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "[Interface]\n")
+	fmt.Fprintf(&b, "Address = %s/24\n", fmt.Sprintf(wireGuardAddress, 1))
+	fmt.Fprintf(&b, "ListenPort = %d\n", WireGuardListenPort)
+	fmt.Fprintf(&b, "PrivateKey = %s\n", server.WireGuardPrivateKey)
+	fmt.Fprintf(&b, "PostUp = sysctl -w net.ipv4.ip_forward=1; iptables -A FORWARD -i %%i -j ACCEPT; iptables -A FORWARD -o %%i -j ACCEPT; iptables -t nat -A POSTROUTING -s %s ! -o %%i -j MASQUERADE\n", wireGuardSubnet)
+	fmt.Fprintf(&b, "PostDown = iptables -D FORWARD -i %%i -j ACCEPT; iptables -D FORWARD -o %%i -j ACCEPT; iptables -t nat -D POSTROUTING -s %s ! -o %%i -j MASQUERADE\n", wireGuardSubnet)
+	for _, peer := range peers {
+		fmt.Fprintf(&b, "\n[Peer]\n# %s\nPublicKey = %s\nAllowedIPs = %s/32\n", peer.Name, peer.PublicKey, peer.Address)
+		// 设置了保活间隔时服务端也向客户端最近的地址发送保活，保持中转机和出口路径上的映射
+		if server.NATKeepalive > 0 {
+			fmt.Fprintf(&b, "PersistentKeepalive = %d\n", server.NATKeepalive)
+		}
+	}
+	return b.String(), nil
+}
+
+// WireGuardPeers 列出WireGuard服务器的客户端，不包含客户端私钥
+func (s *L2TPService) WireGuardPeers(id uint) ([]WireGuardPeer, error) {
+	server, err := s.GetServer(id)
+	if err != nil {
+		return nil, err
+	}
+	if server.Type != ServerTypeWireGuard {
+		return nil, fmt.Errorf("服务器不是WireGuard类型")
+	}
+	peers, err := parseWireGuardPeers(server.WireGuardPeers)
+	if err != nil {
+		return nil, err
+	}
+	for i := range peers {
+		peers[i].PrivateKey = ""
+	}
+	return peers, nil
+}
+
+// WireGuardClientConfig 生成客户端配置文件，endpointHost为客户端连接的中转机地址，端口为服务器的中转端口
+func (s *L2TPService) WireGuardClientConfig(id uint, name, endpointHost string) (string, error) {
+	server, err := s.GetServer(id)
+	if err != nil {
+		return "", err
+	}
+	if server.Type != ServerTypeWireGuard {
+		return "", fmt.Errorf("服务器不是WireGuard类型")
+	}
+	peer, err := findWireGuardPeer(server, name)
+	if err != nil {
+		return "", err
+	}
+	serverPublicKey, err := wireGuardPublicKey(server.WireGuardPrivateKey)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "[Interface]\n")
+	fmt.Fprintf(&b, "PrivateKey = %s\n", peer.PrivateKey)
+	fmt.Fprintf(&b, "Address = %s/32\n", peer.Address)
+	// wg-quick的DNS中非IP的条目作为搜索域
+	dns := append(clientDNS(server, wireGuardClientDNS), parseDNSDomains(server.DNSDomains)...)
+	fmt.Fprintf(&b, "DNS = %s\n", strings.Join(dns, ", "))
+	fmt.Fprintf(&b, "\n[Peer]\n")
+	fmt.Fprintf(&b, "PublicKey = %s\n", serverPublicKey)
+	fmt.Fprintf(&b, "Endpoint = %s:%d\n", endpointHost, server.L2TPPort)
+	fmt.Fprintf(&b, "AllowedIPs = 0.0.0.0/0\n")
+	fmt.Fprintf(&b, "PersistentKeepalive = %d\n", natKeepalive(server))
+	return b.String(), nil
+}
+
+// findWireGuardPeer 查找WireGuard服务器中指定用户的客户端
+func findWireGuardPeer(server *database.L2TPServer, name string) (*WireGuardPeer, error) {
+	peers, err := parseWireGuardPeers(server.WireGuardPeers)
+	if err != nil {
+		return nil, err
+	}
+	for i := range peers {
+		if peers[i].Name == name {
+			return &peers[i], nil
+		}
+	}
+	return nil, fmt.Errorf("WireGuard用户 %s 不存在", name)
+}
+
+// startWireGuard 在落地机上安装WireGuard、写入配置并启动wg-quick服务，步骤见WireGuardStartSteps
+func (s *SSHService) startWireGuard(server *database.L2TPServer, statusCallback func(step string, success bool, message string)) error {
+	report := func(step string, success bool, message string) {
+		if statusCallback != nil {
+			statusCallback(step, success, message)
+		}
+	}
+
+	client, err := s.createSSHClient(server)
+	if err != nil {
+		report("ssh_connect", false, fmt.Sprintf("SSH连接失败: %v", err))
+		return err
+	}
+	defer client.Close()
+	report("ssh_connect", true, "SSH连接成功")
+
+	if err := s.ensureWireGuardInstalled(client); err != nil {
+		report("wireguard_install", false, fmt.Sprintf("WireGuard安装失败: %v", err))
+		return fmt.Errorf("WireGuard安装失败: %v", err)
+	}
+	report("wireguard_install", true, "WireGuard环境检查通过")
+
+	config, err := wireGuardServerConfig(server)
+	if err != nil {
+		report("config", false, err.Error())
+		return err
+	}
+	writeCmd := fmt.Sprintf("umask 077 && mkdir -p /etc/wireguard && cat > %s <<'WGEOF'\n%sWGEOF", wireGuardConfigPath, config)
+	if _, err := s.executeCommand(client, writeCmd); err != nil {
+		report("config", false, fmt.Sprintf("写入WireGuard配置失败: %v", err))
+		return fmt.Errorf("写入WireGuard配置失败: %v", err)
+	}
+	report("config", true, "WireGuard配置已写入")
+
+	startCmd := fmt.Sprintf("systemctl enable %s && systemctl restart %s", wireGuardService, wireGuardService)
+	if _, err := s.executeCommand(client, startCmd); err != nil {
+		report("service_start", false, fmt.Sprintf("启动WireGuard服务失败: %v", err))
+		return fmt.Errorf("启动WireGuard服务失败: %v", err)
+	}
+	report("service_start", true, "WireGuard服务启动命令执行成功")
+
+	output, err := s.executeCommand(client, fmt.Sprintf("wg show %s listen-port", wireGuardInterface))
+	if err != nil || strings.TrimSpace(output) != strconv.Itoa(WireGuardListenPort) {
+		if err == nil {
+			err = fmt.Errorf("监听端口为 %q", strings.TrimSpace(output))
+		}
+		report("service_ready", false, fmt.Sprintf("WireGuard启动验证失败: %v", err))
+		return fmt.Errorf("WireGuard启动验证失败: %v", err)
+	}
+	report("service_ready", true, "WireGuard启动验证完成")
+	return nil
+}
+
+// stopWireGuard 停止并禁用落地机上的wg-quick服务，步骤见WireGuardStopSteps
+func (s *SSHService) stopWireGuard(server *database.L2TPServer, statusCallback func(step string, success bool, message string)) error {
+	report := func(step string, success bool, message string) {
+		if statusCallback != nil {
+			statusCallback(step, success, message)
+		}
+	}
+
+	client, err := s.createSSHClient(server)
+	if err != nil {
+		report("ssh_connect", false, fmt.Sprintf("SSH连接失败: %v", err))
+		return err
+	}
+	defer client.Close()
+	report("ssh_connect", true, "SSH连接成功")
+
+	if !s.wireGuardActive(client) {
+		report("service_check", true, "WireGuard服务未运行，无需停止")
+		return nil
+	}
+	report("service_check", true, "WireGuard服务运行中，准备停止")
+
+	if _, err := s.executeCommand(client, fmt.Sprintf("systemctl disable --now %s", wireGuardService)); err != nil {
+		report("service_stop", false, fmt.Sprintf("停止WireGuard服务失败: %v", err))
+		return err
+	}
+	report("service_stop", true, "WireGuard服务已停止")
+	return nil
+}
+
+// ensureWireGuardInstalled 确保落地机已安装wireguard-tools和iptables
+func (s *SSHService) ensureWireGuardInstalled(client *ssh.Client) error {
+	if _, err := s.executeCommand(client, "command -v wg-quick && command -v iptables"); err == nil {
+		return nil
+	}
+
+	installCmd := `if command -v apt-get >/dev/null 2>&1; then
+	apt-get update -y && DEBIAN_FRONTEND=noninteractive apt-get install -y wireguard-tools iptables
+elif command -v dnf >/dev/null 2>&1; then
+	dnf install -y wireguard-tools iptables
+elif command -v yum >/dev/null 2>&1; then
+	yum install -y epel-release && yum install -y wireguard-tools iptables
+else
+	echo "不支持的系统，请手动安装wireguard-tools" >&2
+	exit 1
+fi`
+	if _, err := s.executeCommand(client, installCmd); err != nil {
+		return err
+	}
+	_, err := s.executeCommand(client, "command -v wg-quick")
+	return err
+}
+
+// wireGuardActive 检查wg-quick服务是否运行
+func (s *SSHService) wireGuardActive(client *ssh.Client) bool {
+	output, _ := s.executeCommand(client, fmt.Sprintf("systemctl is-active %s || true", wireGuardService))
+	return strings.TrimSpace(output) == "active"
+}
+
+// wireGuardStatus 获取wg-quick服务状态，格式与容器状态一致
+func (s *SSHService) wireGuardStatus(client *ssh.Client) map[string]interface{} {
+	status := map[string]interface{}{"running": s.wireGuardActive(client)}
+	if status["running"] != true {
+		status["message"] = "WireGuard服务未运行"
+		return status
+	}
+	status["message"] = "WireGuard服务运行正常"
+
+	output, err := s.executeCommand(client, fmt.Sprintf(`date -d "$(systemctl show %s -p ActiveEnterTimestamp --value)" +%%s`, wireGuardService))
+	if err == nil {
+		if started, err := strconv.ParseInt(strings.TrimSpace(output), 10, 64); err == nil {
+			status["uptime"] = time.Since(time.Unix(started, 0)).Truncate(time.Second).String()
+		}
+	}
+	return status
+}
+
+// wireGuardClients 统计最近握手仍在有效期内的客户端数量
+func (s *SSHService) wireGuardClients(client *ssh.Client) (int, error) {
+	// 最后一行为落地机当前时间，避免两端时钟偏差
+	output, err := s.executeCommand(client, fmt.Sprintf("wg show %s latest-handshakes && date +%%s", wireGuardInterface))
+	if err != nil {
+		return 0, fmt.Errorf("获取WireGuard握手信息失败: %v", err)
+	}
+	return countWireGuardHandshakes(output), nil
+}
+
+// countWireGuardHandshakes 解析 wg show latest-handshakes 的输出(公钥和握手时间戳，末行为当前时间)
+func countWireGuardHandshakes(output string) int {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	now, err := strconv.ParseInt(strings.TrimSpace(lines[len(lines)-1]), 10, 64)
+	if err != nil {
+		return 0
+	}
+	count := 0
+	for _, line := range lines[:len(lines)-1] {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		handshake, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil || handshake == 0 {
+			continue
+		}
+		if time.Duration(now-handshake)*time.Second <= wireGuardHandshakeWindow {
+			count++
+		}
+	}
+	return count
+}
+
+// wireGuardLogCommand 生成读取wg-quick服务日志的journalctl命令，输出行经journalLine转换为docker日志时间戳格式。
+// since为docker时间戳，非空时从该时刻(按秒)开始，否则从最后lines行开始
+func wireGuardLogCommand(lines int, since string, follow bool) string {
+	command := fmt.Sprintf("journalctl -u %s --no-pager -o short-unix", wireGuardService)
+	if follow {
+		command += " -f"
+	}
+	if t, err := time.Parse(time.RFC3339Nano, since); since != "" && err == nil {
+		command += fmt.Sprintf(" --since @%d", t.Unix())
+	} else {
+		command += fmt.Sprintf(" -n %d", lines)
+	}
+	return command + " 2>&1"
+}
+
+// journalLine 将journalctl short-unix格式开头的时间戳(秒.微秒)转换为docker日志时间戳，便于按字符串比较
+func journalLine(line string) string {
+	field, rest, ok := strings.Cut(line, " ")
+	if !ok {
+		return line
+	}
+	secondsStr, fraction, _ := strings.Cut(field, ".")
+	seconds, err := strconv.ParseInt(secondsStr, 10, 64)
+	if err != nil || len(fraction) > 9 {
+		return line
+	}
+	nanos, err := strconv.ParseInt(fraction+strings.Repeat("0", 9-len(fraction)), 10, 64)
+	if err != nil {
+		return line
+	}
+	return time.Unix(seconds, nanos).UTC().Format("2006-01-02T15:04:05.000000000Z") + " " + rest
+}
+
+// journalOutput 逐行转换journalctl输出
+func journalOutput(output string) string {
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		lines[i] = journalLine(line)
+	}
+	return strings.Join(lines, "\n")
+}
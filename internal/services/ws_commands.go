@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// 日志跟踪参数
+const (
+	wsLogTailInterval     = 5 * time.Second // 拉取新日志的间隔
+	wsLogTailDefaultLines = 100             // 订阅时先发送的最近日志行数
+	wsLogTailMaxLines     = 1000
+	wsMaxLogTails         = 3 // 每个连接同时跟踪的服务器数上限
+)
+
+// logTail 一个连接上的日志跟踪
+type logTail struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// LogTailMessage 日志跟踪推送的数据
+type LogTailMessage struct {
+	Lines []string `json:"lines"`
+}
+
+// RegisterWSCommands 注册WebSocket客户端可用的命令:
+// refresh_status 立即查询服务器实时状态；subscribe_logs/unsubscribe_logs 开始/停止跟踪服务器容器日志
+func RegisterWSCommands(ws *WSManager, l2tpService *L2TPService) {
+	ws.HandleCommand("refresh_status", func(client *Client, cmd WSCommand) (interface{}, error) {
+		if cmd.ServerID == 0 {
+			return nil, fmt.Errorf("缺少server_id")
+		}
+		if !ws.CanAccessServer(client, cmd.ServerID) {
+			return nil, fmt.Errorf("服务器不存在")
+		}
+		return l2tpService.GetServerStatus(cmd.ServerID)
+	})
+
+	ws.HandleCommand("subscribe_logs", func(client *Client, cmd WSCommand) (interface{}, error) {
+		if cmd.ServerID == 0 {
+			return nil, fmt.Errorf("缺少server_id")
+		}
+		if !ws.CanAccessServer(client, cmd.ServerID) {
+			return nil, fmt.Errorf("服务器不存在")
+		}
+		lines := cmd.Lines
+		if lines <= 0 {
+			lines = wsLogTailDefaultLines
+		}
+		if lines > wsLogTailMaxLines {
+			return nil, fmt.Errorf("lines不能超过%d", wsLogTailMaxLines)
+		}
+		if _, err := l2tpService.GetServer(cmd.ServerID); err != nil {
+			return nil, err
+		}
+
+		tail, err := client.startLogTail(cmd.ServerID)
+		if err != nil {
+			return nil, err
+		}
+		go tailServerLogs(tail, ws, client, l2tpService, cmd.ServerID, lines)
+		return nil, nil
+	})
+
+	ws.HandleCommand("unsubscribe_logs", func(client *Client, cmd WSCommand) (interface{}, error) {
+		if !client.stopLogTail(cmd.ServerID, nil) {
+			return nil, fmt.Errorf("未订阅该服务器的日志")
+		}
+		return nil, nil
+	})
+}
+
+// startLogTail 登记日志跟踪，其上下文随取消订阅或断开连接而取消
+func (client *Client) startLogTail(serverID uint) (*logTail, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	if _, ok := client.logTails[serverID]; ok {
+		return nil, fmt.Errorf("已订阅该服务器的日志")
+	}
+	if len(client.logTails) >= wsMaxLogTails {
+		return nil, fmt.Errorf("同时跟踪的日志不能超过%d个", wsMaxLogTails)
+	}
+	tail := &logTail{}
+	tail.ctx, tail.cancel = context.WithCancel(client.ctx)
+	client.logTails[serverID] = tail
+	return tail, nil
+}
+
+// stopLogTail 取消日志跟踪，tail非空时只在其仍为当前跟踪时取消，未订阅时返回false
+func (client *Client) stopLogTail(serverID uint, tail *logTail) bool {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	current, ok := client.logTails[serverID]
+	if !ok || (tail != nil && current != tail) {
+		return false
+	}
+	current.cancel()
+	delete(client.logTails, serverID)
+	return true
+}
+
+// tailServerLogs 先发送最近的日志，之后定期拉取新日志推送给客户端，直到跟踪被取消
+func tailServerLogs(tail *logTail, ws *WSManager, client *Client, l2tpService *L2TPService, serverID uint, lines int) {
+	defer client.stopLogTail(serverID, tail)
+	ctx := tail.ctx
+
+	sshService := l2tpService.SSH()
+	ticker := time.NewTicker(wsLogTailInterval)
+	defer ticker.Stop()
+
+	// since为已推送日志中最新的docker时间戳
+	var since string
+	for {
+		server, err := l2tpService.GetServer(serverID)
+		if err != nil {
+			ws.SendTo(client, StatusMessage{Type: "log_tail", ServerID: serverID, Status: "error", Message: err.Error()})
+			return
+		}
+
+		output, err := sshService.TailServerLogs(server, lines, since)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			slog.Debug("跟踪容器日志失败", "server_id", serverID, "error", err)
+			ws.SendTo(client, StatusMessage{Type: "log_tail", ServerID: serverID, Status: "error", Message: err.Error()})
+		} else if newLines, latest := filterLogLines(output, since); len(newLines) > 0 {
+			since = latest
+			ws.SendTo(client, StatusMessage{Type: "log_tail", ServerID: serverID, Status: "ok", Data: LogTailMessage{Lines: newLines}})
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// filterLogLines 保留时间戳晚于since的日志行，返回这些行和其中最新的时间戳。
+// docker时间戳为固定9位小数的RFC3339格式，可直接按字符串比较
+func filterLogLines(output, since string) ([]string, string) {
+	var lines []string
+	latest := since
+	keep := since == ""
+	for _, line := range strings.Split(strings.TrimRight(output, "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		timestamp, ok := logTimestamp(line)
+		if !ok {
+			// 没有时间戳的行(如多行日志的续行)跟随上一行
+			if keep {
+				lines = append(lines, line)
+			}
+			continue
+		}
+		if keep = since == "" || timestamp > since; !keep {
+			continue
+		}
+		lines = append(lines, line)
+		if timestamp > latest {
+			latest = timestamp
+		}
+	}
+	return lines, latest
+}
@@ -0,0 +1,377 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"l2tp-manager/internal/database"
+
+	"github.com/xtls/xray-core/common/uuid"
+	"github.com/xtls/xray-core/infra/conf"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/ssh"
+)
+
+// Shadowsocks/VLESS落地机配置，容器内运行Xray
+const (
+	xrayContainerName = "xray-server"
+	xrayImage         = "teddysun/xray:1.8.24" // 与面板内置的xray-core版本一致，配置在面板侧用同一版本校验
+
+	xrayConfigDir = "/etc/l2tp-manager/xray" // 落地机上的配置目录，挂载到容器的/etc/xray
+
+	shadowsocksMethod  = "2022-blake3-aes-128-gcm"
+	shadowsocksKeySize = 16 // 2022-blake3-aes-128-gcm的服务端和用户密钥长度
+
+	vlessFlow                = "xtls-rprx-vision"
+	realityDefaultServerName = "www.microsoft.com"
+	realityFingerprint       = "chrome" // 客户端模拟的TLS指纹
+)
+
+// realityServerNamePattern REALITY伪装站点：支持TLS 1.3的外部网站域名
+var realityServerNamePattern = regexp.MustCompile(`^[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)+$`)
+
+// XrayClient Shadowsocks/VLESS用户凭据，Shadowsocks为用户密钥(base64)，VLESS为UUID
+type XrayClient struct {
+	Name string `json:"name"`
+	ID   string `json:"id"`
+}
+
+// XrayCredentials Shadowsocks/VLESS服务器的服务端密钥和用户凭据，凭据在用户保留期间不变
+type XrayCredentials struct {
+	ServerKey  string       `json:"server_key,omitempty"`  // Shadowsocks服务端密钥
+	PrivateKey string       `json:"private_key,omitempty"` // VLESS REALITY私钥(x25519)
+	ShortID    string       `json:"short_id,omitempty"`    // VLESS REALITY短ID
+	Clients    []XrayClient `json:"clients"`
+}
+
+// isXrayServer 判断服务器类型是否由Xray提供服务
+func isXrayServer(serverType string) bool {
+	return serverType == ServerTypeShadowsocks || serverType == ServerTypeVLESS
+}
+
+// parseXrayCredentials 解析服务器记录中的Shadowsocks/VLESS凭据
+func parseXrayCredentials(value string) (*XrayCredentials, error) {
+	credentials := &XrayCredentials{}
+	if value == "" {
+		return credentials, nil
+	}
+	if err := json.Unmarshal([]byte(value), credentials); err != nil {
+		return nil, fmt.Errorf("解析Xray凭据失败: %v", err)
+	}
+	return credentials, nil
+}
+
+// newShadowsocksKey 生成2022-blake3-aes-128-gcm密钥(base64编码)
+func newShadowsocksKey() (string, error) {
+	key := make([]byte, shadowsocksKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// generateRealityKey 生成REALITY密钥对(x25519，URL安全的base64编码，与xray x25519命令一致)
+func generateRealityKey() (privateKey, publicKey string, err error) {
+	private := make([]byte, curve25519.ScalarSize)
+	if _, err := rand.Read(private); err != nil {
+		return "", "", err
+	}
+	private[0] &= 248
+	private[31] = (private[31] & 127) | 64
+
+	public, err := curve25519.X25519(private, curve25519.Basepoint)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(private), base64.RawURLEncoding.EncodeToString(public), nil
+}
+
+// realityPublicKey 由REALITY私钥计算客户端使用的公钥
+func realityPublicKey(privateKey string) (string, error) {
+	private, err := base64.RawURLEncoding.DecodeString(privateKey)
+	if err != nil || len(private) != curve25519.ScalarSize {
+		return "", fmt.Errorf("无效的REALITY私钥")
+	}
+	public, err := curve25519.X25519(private, curve25519.Basepoint)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(public), nil
+}
+
+// newXrayClientID 为用户生成凭据
+func newXrayClientID(serverType string) (string, error) {
+	if serverType == ServerTypeShadowsocks {
+		return newShadowsocksKey()
+	}
+	id := uuid.New()
+	return id.String(), nil
+}
+
+// prepareXray 为Shadowsocks/VLESS服务器生成服务端密钥，并按用户配置同步用户凭据：
+// 保留仍存在的用户的凭据，为新用户生成凭据。服务器类型变更时重新生成全部密钥。existing为更新前的记录，创建时为nil
+func prepareXray(server, existing *database.L2TPServer) error {
+	if !isXrayServer(server.Type) {
+		server.XrayCredentials = ""
+		return nil
+	}
+	if existing != nil {
+		server.XrayCredentials = ""
+		if existing.Type == server.Type {
+			server.XrayCredentials = existing.XrayCredentials
+		}
+	}
+
+	credentials, err := parseXrayCredentials(server.XrayCredentials)
+	if err != nil {
+		return err
+	}
+	if server.Type == ServerTypeShadowsocks && credentials.ServerKey == "" {
+		if credentials.ServerKey, err = newShadowsocksKey(); err != nil {
+			return fmt.Errorf("生成Shadowsocks密钥失败: %v", err)
+		}
+	}
+	if server.Type == ServerTypeVLESS {
+		if credentials.PrivateKey == "" {
+			if credentials.PrivateKey, _, err = generateRealityKey(); err != nil {
+				return fmt.Errorf("生成REALITY密钥失败: %v", err)
+			}
+		} else if _, err := realityPublicKey(credentials.PrivateKey); err != nil {
+			return err
+		}
+		if credentials.ShortID == "" {
+			shortID := make([]byte, 8)
+			if _, err := rand.Read(shortID); err != nil {
+				return err
+			}
+			credentials.ShortID = hex.EncodeToString(shortID)
+		}
+	}
+
+	var users []L2TPUser
+	if server.Users != "" {
+		if err := json.Unmarshal([]byte(server.Users), &users); err != nil {
+			return fmt.Errorf("解析用户配置失败: %v", err)
+		}
+	}
+
+	clients := make([]XrayClient, 0, len(users))
+	seen := make(map[string]bool)
+	for _, user := range users {
+		if !clientNamePattern.MatchString(user.Username) {
+			return fmt.Errorf("%s用户名 %q 只能包含字母、数字和 . _ @ -，且不超过64个字符", serverTypeName(server.Type), user.Username)
+		}
+		if seen[user.Username] {
+			return fmt.Errorf("用户名 %s 重复", user.Username)
+		}
+		seen[user.Username] = true
+
+		client := XrayClient{Name: user.Username}
+		for _, previous := range credentials.Clients {
+			if previous.Name == user.Username {
+				client = previous
+			}
+		}
+		if client.ID == "" {
+			if client.ID, err = newXrayClientID(server.Type); err != nil {
+				return fmt.Errorf("生成用户凭据失败: %v", err)
+			}
+		}
+		clients = append(clients, client)
+	}
+	credentials.Clients = clients
+
+	data, err := json.Marshal(credentials)
+	if err != nil {
+		return err
+	}
+	server.XrayCredentials = string(data)
+	return nil
+}
+
+// xrayServerConfig 生成落地机的Xray配置，用户以用户名作为email区分，并用面板内置的xray-core校验配置
+func xrayServerConfig(server *database.L2TPServer) (string, error) {
+	credentials, err := parseXrayCredentials(server.XrayCredentials)
+	if err != nil {
+		return "", err
+	}
+
+	var inbound map[string]interface{}
+	switch server.Type {
+	case ServerTypeShadowsocks:
+		clients := make([]map[string]interface{}, 0, len(credentials.Clients))
+		for _, client := range credentials.Clients {
+			clients = append(clients, map[string]interface{}{"email": client.Name, "password": client.ID})
+		}
+		inbound = map[string]interface{}{
+			"tag":      "shadowsocks",
+			"port":     ShadowsocksContainerPort,
+			"protocol": "shadowsocks",
+			"settings": map[string]interface{}{
+				"method":   shadowsocksMethod,
+				"password": credentials.ServerKey,
+				"clients":  clients,
+				"network":  "tcp,udp",
+			},
+		}
+	case ServerTypeVLESS:
+		clients := make([]map[string]interface{}, 0, len(credentials.Clients))
+		for _, client := range credentials.Clients {
+			clients = append(clients, map[string]interface{}{"email": client.Name, "id": client.ID, "flow": vlessFlow})
+		}
+		inbound = map[string]interface{}{
+			"tag":      "vless",
+			"port":     VLESSContainerPort,
+			"protocol": "vless",
+			"settings": map[string]interface{}{
+				"clients":    clients,
+				"decryption": "none",
+			},
+			"streamSettings": map[string]interface{}{
+				"network":  "tcp",
+				"security": "reality",
+				"realitySettings": map[string]interface{}{
+					"dest":        net.JoinHostPort(server.RealityServerName, "443"),
+					"serverNames": []string{server.RealityServerName},
+					"privateKey":  credentials.PrivateKey,
+					"shortIds":    []string{credentials.ShortID},
+				},
+			},
+		}
+	default:
+		return "", fmt.Errorf("服务器不是Shadowsocks或VLESS类型")
+	}
+
+	data, err := json.MarshalIndent(map[string]interface{}{
+		"log":       map[string]interface{}{"loglevel": "warning"},
+		"inbounds":  []interface{}{inbound},
+		"outbounds": []interface{}{map[string]interface{}{"tag": "direct", "protocol": "freedom"}},
+	}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	var config conf.Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return "", fmt.Errorf("Xray配置无效: %v", err)
+	}
+	if _, err := config.Build(); err != nil {
+		return "", fmt.Errorf("Xray配置无效: %v", err)
+	}
+	return string(data), nil
+}
+
+// xrayConfigFiles 生成写入落地机配置目录的文件
+func xrayConfigFiles(server *database.L2TPServer) ([]remoteFile, error) {
+	config, err := xrayServerConfig(server)
+	if err != nil {
+		return nil, err
+	}
+	return []remoteFile{{"config.json", config, "600"}}, nil
+}
+
+// xrayRunCommand 构建启动Xray容器的docker run命令，镜像默认读取/etc/xray/config.json
+func xrayRunCommand(server *database.L2TPServer) string {
+	ports := fmt.Sprintf("-p %d:%d/tcp", VLESSContainerPort, VLESSContainerPort)
+	if server.Type == ServerTypeShadowsocks {
+		ports = fmt.Sprintf("-p %[1]d:%[1]d/tcp \\\n\t\t-p %[1]d:%[1]d/udp", ShadowsocksContainerPort)
+	}
+	return fmt.Sprintf(`docker run -d \
+		--name %s \
+		--restart always \
+		%s \
+		-v %s:/etc/xray \
+		%s`,
+		xrayContainerName,
+		ports,
+		xrayConfigDir,
+		xrayImage)
+}
+
+// xrayClients 统计容器内已建立的TCP连接数。Xray不提供在线用户列表，一个客户端可能有多个连接，Shadowsocks的UDP流量不计入
+func (s *SSHService) xrayClients(client *ssh.Client, server *database.L2TPServer) (int, error) {
+	output, err := s.executeCommand(client, fmt.Sprintf("docker exec %s netstat -tn", xrayContainerName))
+	if err != nil {
+		return 0, fmt.Errorf("获取连接列表失败: %v", err)
+	}
+	port := VLESSContainerPort
+	if server.Type == ServerTypeShadowsocks {
+		port = ShadowsocksContainerPort
+	}
+	return countEstablished(output, port), nil
+}
+
+// countEstablished 统计netstat -tn输出中本地端口为port的ESTABLISHED连接
+func countEstablished(output string, port int) int {
+	suffix := ":" + strconv.Itoa(port)
+	count := 0
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 6 && fields[5] == "ESTABLISHED" && strings.HasSuffix(fields[3], suffix) {
+			count++
+		}
+	}
+	return count
+}
+
+// XrayShareLink 生成用户的分享链接(ss://或vless://)，客户端扫码或导入即可使用。
+// endpointHost为客户端连接的中转机地址，端口为服务器的中转端口
+func (s *L2TPService) XrayShareLink(id uint, username, endpointHost string) (string, error) {
+	server, err := s.GetServer(id)
+	if err != nil {
+		return "", err
+	}
+	if !isXrayServer(server.Type) {
+		return "", fmt.Errorf("服务器不是Shadowsocks或VLESS类型")
+	}
+	credentials, err := parseXrayCredentials(server.XrayCredentials)
+	if err != nil {
+		return "", err
+	}
+	var client *XrayClient
+	for i := range credentials.Clients {
+		if credentials.Clients[i].Name == username {
+			client = &credentials.Clients[i]
+		}
+	}
+	if client == nil {
+		return "", fmt.Errorf("用户 %s 不存在", username)
+	}
+
+	link := url.URL{
+		Host:     net.JoinHostPort(endpointHost, strconv.Itoa(server.L2TPPort)),
+		Fragment: server.Name + "-" + username,
+	}
+	if server.Type == ServerTypeShadowsocks {
+		// SIP002：2022系列加密不使用base64，多用户时密码为 服务端密钥:用户密钥
+		link.Scheme = "ss"
+		link.User = url.UserPassword(shadowsocksMethod, credentials.ServerKey+":"+client.ID)
+		return link.String(), nil
+	}
+
+	publicKey, err := realityPublicKey(credentials.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+	link.Scheme = "vless"
+	link.User = url.User(client.ID)
+	link.RawQuery = url.Values{
+		"encryption": {"none"},
+		"flow":       {vlessFlow},
+		"security":   {"reality"},
+		"sni":        {server.RealityServerName},
+		"fp":         {realityFingerprint},
+		"pbk":        {publicKey},
+		"sid":        {credentials.ShortID},
+		"type":       {"tcp"},
+	}.Encode()
+	return link.String(), nil
+}
@@ -3,16 +3,23 @@ package main
 import (
 	"context"
 	"embed"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"l2tp-manager/internal/api"
+	"l2tp-manager/internal/cli"
 	"l2tp-manager/internal/config"
 	"l2tp-manager/internal/database"
+	"l2tp-manager/internal/grpcapi"
+	"l2tp-manager/internal/logger"
 	"l2tp-manager/internal/router"
 	"l2tp-manager/internal/services"
 
@@ -22,35 +29,259 @@ import (
 //go:embed public/*
 var staticFiles embed.FS
 
+// 构建信息，构建时通过 -ldflags "-X main.version=v1.2.3 -X main.commit=... -X main.buildTime=... -X main.xrayVersion=..." 注入，
+// 未注入的提交取go build记录的版本控制信息，Xray-core版本取编译进来的版本
+var (
+	version     = "dev" // 发布版本号
+	commit      = ""
+	buildTime   = ""
+	xrayVersion = ""
+)
+
 func main() {
-	// 加载配置
-	cfg := config.Load()
+	// 解析子命令，未指定时启动管理面板；配置文件可通过 --config 或环境变量 CONFIG_FILE 指定
+	os.Exit(cli.Execute(os.Args[1:], version, serve))
+}
+
+// serve 启动管理面板，收到退出信号后返回
+func serve(cfg *config.Config) {
+	// 初始化结构化日志
+	logBuffer := logger.Setup(os.Stderr, cfg.LogLevel, cfg.LogFormat, cfg.LogBufferSize)
+	logger.SetSlowThreshold(cfg.SlowRequestThreshold())
 
 	// 初始化数据库
-	db, err := database.Initialize(cfg.DatabasePath)
+	db, err := database.Initialize(cfg.DatabaseDriver, cfg.DatabaseDSN())
 	if err != nil {
-		log.Fatal("数据库初始化失败:", err)
+		slog.Error("数据库初始化失败", "error", err)
+		os.Exit(1)
 	}
-	defer func() {
-		if sqlDB, err := db.DB(); err == nil {
-			sqlDB.Close()
-		}
-	}()
+
+	// 初始化运行时设置，配置文件的settings和环境变量作为默认值
+	settingsService := services.NewSettingsService(db, settingDefaults(cfg))
 
 	// 初始化服务
 	authService := services.NewAuthService(cfg.JWTSecret)
-	wsManager := services.GetWSManager()
-	l2tpService := services.NewL2TPService(db, wsManager)
-	routingService := services.NewRoutingService()
+	// WebSocket管理器和SSH客户端由各服务通过构造函数共用，消息分发循环由生命周期管理器启动
+	wsManager := services.NewWSManager()
+	sshService := services.NewSSHService()
+	l2tpService := services.NewL2TPService(db, wsManager, sshService)
+	services.RegisterWSCommands(wsManager, l2tpService)
+	auditService := services.NewAuditService(db)
+	schedulerService := services.NewSchedulerService(db, l2tpService, auditService)
+	notificationService := services.NewNotificationService(settingsService)
+	webhookService := services.NewWebhookService(db)
+	notificationService.Register(webhookService)
+	l2tpService.SetNotifier(notificationService)
+	uptimeService := services.NewUptimeService(db)
+	l2tpService.SetUptime(uptimeService)
+	// 面板自身监听的端口登记到端口登记表，本机转发的服务器和代理不能占用
+	services.SetPanelPorts(cfg.PanelPorts())
+	// 启动/停止/重启等服务器操作登记为任务，可通过任务接口查询
+	jobService := services.NewJobService(wsManager, db)
+	l2tpService.SetJobs(jobService)
+	// PSK和用户密码填写auto时按设置的长度和字符集生成
+	credentialService := services.NewCredentialService(settingsService)
+	l2tpService.SetCredentials(credentialService)
+	healthMonitor := services.NewHealthMonitor(db, l2tpService, wsManager, notificationService, auditService, settingsService)
+	routingService := services.NewRoutingService(wsManager)
+	// 转发器检查间隔、端口探测超时和流量汇总间隔可通过设置在运行时调整
+	routingService.SetSettings(settingsService)
+	telegramService := services.NewTelegramService(db, settingsService, l2tpService, routingService, auditService, cfg.TelegramAPIURL)
+	notificationService.Register(telegramService, services.TelegramDefaultEvents...)
+	notificationService.Register(services.NewEmailService(settingsService), services.EmailDefaultEvents...)
+	// 捕获HTTP处理器、后台任务和服务器操作中的panic，记录调用栈并按设置上报
+	errorReporter := services.NewErrorReporter(settingsService, notificationService, version)
+	l2tpService.SetErrorReporter(errorReporter)
+	trafficReporter := services.NewTrafficReporter(db, settingsService, notificationService)
+	alertService := services.NewAlertService(db, settingsService, notificationService)
+	loginMonitor := services.NewLoginMonitor(db, notificationService)
+	reconciler := services.NewReconciler(db, l2tpService, routingService, settingsService)
 	
+	trafficPipeline := services.NewTrafficPipeline(db)
+	backupService := services.NewBackupService(db, cfg.BackupDir)
+	trafficRetention := services.NewTrafficRetention(db, settingsService)
+	bundleService := services.NewBundleService(db, l2tpService, routingService, backupService, settingsService)
+	
+	// 各模块已注册设置项，校验配置文件中的设置默认值
+	if err := settingsService.ValidateDefaults(); err != nil {
+		slog.Error("配置文件中的settings无效", "error", err)
+		os.Exit(1)
+	}
+
 	// 设置路由服务的数据库连接
 	routingService.SetDatabase(db)
+	routingService.SetTrafficPipeline(trafficPipeline)
+	routingService.SetForwardMode(cfg.ForwardMode)
+	// 面板主机资源监控，磁盘使用率按数据库(Postgres时为备份目录)所在的文件系统统计
+	diskPath := cfg.BackupDir
+	if cfg.DatabaseDriver != "postgres" {
+		diskPath = filepath.Dir(cfg.DatabasePath)
+	}
+	resourceMonitor := services.NewResourceMonitor(settingsService, notificationService, diskPath)
+	routingService.SetResourceMonitor(resourceMonitor)
+
+	// GeoIP数据库加载失败时不影响启动，设置了国家访问策略的服务器将无法启动转发
+	if cfg.GeoIPPath != "" {
+		if geoip, err := services.LoadGeoIP(cfg.GeoIPPath); err != nil {
+			slog.Error("加载GeoIP数据库失败", "path", cfg.GeoIPPath, "error", err)
+		} else {
+			routingService.SetGeoIP(geoip)
+			trafficPipeline.SetGeoIP(geoip)
+			slog.Info("GeoIP数据库已加载", "path", cfg.GeoIPPath, "countries", len(geoip.Countries()))
+		}
+	}
+
+	// 中转节点管理，向节点下发指定给它的服务器转发配置
+	agentHub := services.NewAgentHub(db, routingService, trafficPipeline)
+	routingService.SetAgentHub(agentHub)
+	relayNodeService := services.NewRelayNodeService(db, agentHub, cfg.AgentToken)
+	proxyService := services.NewProxyService(db, routingService)
+	bootstrapService, err := services.NewBootstrapService(db, l2tpService, notificationService)
+	if err != nil {
+		slog.Error("初始化落地机注册服务失败", "error", err)
+		os.Exit(1)
+	}
+
+	usageService := services.NewUsageService(db, settingsService, notificationService, sshService)
+
+	// 多租户，WebSocket按服务器所属租户过滤推送给租户用户的消息
+	tenantService := services.NewTenantService(db, l2tpService)
+	wsManager.SetTenantResolver(tenantService.ServerTenant)
+	portPoolService := services.NewPortPoolService(db)
+	driftService := services.NewDriftService(db, l2tpService)
+	imageService := services.NewImageService(db, l2tpService, cfg.ImageRegistryURL)
+	exitNodeMetrics := services.NewExitNodeMetrics(db, settingsService, sshService)
+	syntheticService := services.NewSyntheticService(db, settingsService, l2tpService)
+	// NAT-T检测的最近结果随服务器状态返回
+	natCheckService := services.NewNATCheckService(db, l2tpService, routingService)
+	l2tpService.SetNATChecks(natCheckService)
+	knockService := services.NewKnockService(settingsService, routingService)
+	timelineService := services.NewTimelineService(db)
+
+	// 用户界面语言，API响应和WebSocket消息按用户设置或Accept-Language翻译
+	preferenceService := services.NewPreferenceService(db)
+	wsManager.SetLanguageResolver(preferenceService.Language)
+
+	// 平滑重启，接管上一进程交接的套接字
+	restartManager := services.NewRestartManager(routingService)
 	
-	// 启动UDP转发服务
-	go routingService.Start()
+	// 后台任务上下文，关闭服务器时取消
+	bgCtx, bgCancel := context.WithCancel(context.Background())
+	defer bgCancel()
+
+	// 高可用模式下只有主节点运行转发器和后台任务，备用节点等待接管
+	var elector *services.LeaderElector
+	if cfg.HAEnabled {
+		elector = services.NewLeaderElector(db, cfg.NodeName())
+	} else {
+		elector = services.NewLeaderElector(nil, cfg.NodeName())
+	}
+
+	// 主节点组件：先启动转发器，转发器就绪后再启动依赖服务器配置的后台任务
+	leaderComponents := services.NewLifecycle()
+	tasksCtx, tasksCancel := context.WithCancel(bgCtx)
+	leaderComponents.Add(services.Component{
+		Name: "routing",
+		Start: func(ctx context.Context) error {
+			// 先释放交接的转发端口占位套接字，避免与新转发器同时绑定时分走流量
+			restartManager.ReleaseForwarderSockets()
+			return routingService.Start(ctx)
+		},
+		Stop: func(ctx context.Context) error {
+			routingService.Stop()
+			return nil
+		},
+	}, services.Component{
+		Name: "tasks",
+		Start: func(ctx context.Context) error {
+			// 恢复上次关闭时中断的服务器操作
+			l2tpService.RecoverInterrupted(ctx)
+
+			// 启动流量日志批量写入
+			errorReporter.Go(tasksCtx, "traffic_pipeline", trafficPipeline.Run)
+
+			// 启动中转节点配置同步
+			errorReporter.Go(tasksCtx, "agent_hub", agentHub.Start)
+
+			// 启动回收站自动清理
+			errorReporter.Go(tasksCtx, "trash_purger", func(ctx context.Context) { l2tpService.StartTrashPurger(ctx, settingsService) })
+
+			// 启动定时维护调度
+			errorReporter.Go(tasksCtx, "scheduler", schedulerService.Start)
+
+			// 启动落地机健康监控
+			errorReporter.Go(tasksCtx, "health", healthMonitor.Start)
+
+			// 启动期望状态协调器
+			errorReporter.Go(tasksCtx, "reconciler", reconciler.Start)
+
+			// 启动流量日志定期清理
+			errorReporter.Go(tasksCtx, "traffic_retention", trafficRetention.Start)
+
+			// 启动自动备份调度
+			errorReporter.Go(tasksCtx, "backup", backupService.Start)
+
+			// 启动Webhook投递记录清理
+			errorReporter.Go(tasksCtx, "webhook", webhookService.Start)
+
+			// 启动Telegram机器人命令轮询
+			errorReporter.Go(tasksCtx, "telegram", telegramService.Start)
+
+			// 启动每周流量汇总
+			errorReporter.Go(tasksCtx, "traffic_reporter", trafficReporter.Start)
+
+			// 启动告警规则评估
+			errorReporter.Go(tasksCtx, "alert", alertService.Start)
+
+			// 启动计费用量采集和月度报告
+			errorReporter.Go(tasksCtx, "usage", usageService.Start)
+
+			// 启动租户月流量配额检查
+			errorReporter.Go(tasksCtx, "tenant", tenantService.Start)
+			errorReporter.Go(tasksCtx, "drift", driftService.Start)
+			errorReporter.Go(tasksCtx, "image", imageService.Start)
+
+			// 启动落地机会话数和容器资源指标采集
+			errorReporter.Go(tasksCtx, "exit_node_metrics", exitNodeMetrics.Start)
+
+			// 启动L2TP端到端拨测
+			errorReporter.Go(tasksCtx, "synthetic", syntheticService.Start)
+
+			// 启动端口敲门包接收
+			errorReporter.Go(tasksCtx, "knock", knockService.Start)
+
+			// 启动面板主机资源检查
+			errorReporter.Go(tasksCtx, "resources", resourceMonitor.Start)
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			tasksCancel()
+			return nil
+		},
+	})
+
+	// 初始化仪表盘汇总
+	dashboardService := services.NewDashboardService(db, routingService, auditService)
+
+	// 初始化全局搜索
+	searchService := services.NewSearchService(db, l2tpService)
+
+	// 初始化版本更新
+	updateService, err := services.NewUpdateService(version, cfg.UpdateRepo, cfg.UpdateAPIURL, cfg.UpdatePublicKey, cfg.UpdateAllowUnsigned)
+	if err != nil {
+		slog.Error("版本更新服务初始化失败", "error", err)
+		os.Exit(1)
+	}
+
+	// 面板组件的启动顺序，前一组件启动完成后才启动下一组件，关闭时逆序停止。
+	// HTTP服务在服务器配置加载、转发器启动之后才开始接受请求，各组件状态通过 /readyz 查询
+	lifecycle := services.NewLifecycle()
 
 	// 初始化API处理器
-	apiHandler := api.NewHandler(authService, l2tpService, routingService, wsManager, db)
+	// 注册Prometheus抓取时采集的指标
+	services.RegisterMetrics(routingService, wsManager)
+
+	apiHandler := api.NewHandler(authService, l2tpService, routingService, wsManager, auditService, backupService, bundleService, settingsService, notificationService, webhookService, loginMonitor, alertService, dashboardService, searchService, updateService, restartManager, agentHub, relayNodeService, proxyService, bootstrapService, usageService, tenantService, portPoolService, driftService, imageService, uptimeService, syntheticService, timelineService, preferenceService, jobService, credentialService, natCheckService, knockService, elector, lifecycle, errorReporter, services.NewBuildInfo(version, commit, buildTime, xrayVersion), logBuffer, db)
 
 	// 设置Gin模式
 	if cfg.Production {
@@ -58,37 +289,227 @@ func main() {
 	}
 
 	// 创建路由器
-	r := router.Setup(apiHandler, staticFiles)
+	r := router.Setup(apiHandler, staticFiles, cfg)
 
 	// 创建HTTP服务器
+	network, address := cfg.ListenAddress()
 	srv := &http.Server{
-		Addr:    ":" + cfg.Port,
+		Addr:    address,
 		Handler: r,
 	}
 
-	// 启动服务器
-	go func() {
-		log.Printf("L2TP中转管理面板启动在端口 %s", cfg.Port)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatal("服务器启动失败:", err)
+	// 创建gRPC管理接口，与HTTP服务共用TLS证书
+	var grpcServer *grpcapi.Server
+	if cfg.GRPCAddress != "" {
+		grpcServer, err = grpcapi.NewServer(authService, l2tpService, routingService, wsManager, auditService, elector, cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			slog.Error("gRPC服务初始化失败", "error", err)
+			os.Exit(1)
 		}
-	}()
+	}
+
+	wsCtx, wsCancel := context.WithCancel(context.Background())
+	var listener net.Listener
+	lifecycle.Add(services.Component{
+		// 数据库在初始化服务时已打开，最后关闭
+		Name: "database",
+		Stop: func(ctx context.Context) error {
+			sqlDB, err := db.DB()
+			if err != nil {
+				return err
+			}
+			return sqlDB.Close()
+		},
+	}, services.Component{
+		Name: "websocket",
+		Start: func(ctx context.Context) error {
+			go wsManager.Start(wsCtx)
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			wsCancel()
+			return nil
+		},
+	}, services.Component{
+		// 关闭时在主节点组件之后停止：等待进行中的服务器操作完成，超时则中止并记为中断
+		Name: "operations",
+		Stop: l2tpService.Shutdown,
+	}, services.Component{
+		// 非高可用模式下直接启动主节点组件；高可用模式下在后台竞选，当选后启动，
+		// 启动失败时退出进程，由systemd重启后重新竞选
+		Name: "leader",
+		Sub:  leaderComponents,
+		Start: func(ctx context.Context) error {
+			if !elector.Enabled() {
+				return leaderComponents.Start(ctx)
+			}
+			go elector.Run(bgCtx, func() {
+				if err := leaderComponents.Start(bgCtx); err != nil {
+					slog.Error("主节点组件启动失败", "error", err)
+					os.Exit(1)
+				}
+			})
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			leaderComponents.Stop(ctx)
+			return nil
+		},
+	}, services.Component{
+		Name: "http",
+		Start: func(ctx context.Context) error {
+			socketMode, _ := cfg.SocketMode()
+			var err error
+			listener, err = restartManager.Listen(network, address, socketMode)
+			if err != nil {
+				return err
+			}
+			go func() {
+				slog.Info("L2TP中转管理面板已启动", "address", listener.Addr().String(), "tls", cfg.TLSEnabled(), "version", version, "role", elector.Role())
+				serve := func() error { return srv.Serve(listener) }
+				if cfg.TLSEnabled() {
+					serve = func() error { return srv.ServeTLS(listener, cfg.TLSCertFile, cfg.TLSKeyFile) }
+				}
+				if err := serve(); err != nil && err != http.ErrServerClosed {
+					slog.Error("HTTP服务异常退出", "error", err)
+					os.Exit(1)
+				}
+			}()
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			return srv.Shutdown(ctx)
+		},
+	})
+	if grpcServer != nil {
+		lifecycle.Add(services.Component{
+			Name: "grpc",
+			Start: func(ctx context.Context) error {
+				grpcListener, err := net.Listen("tcp", cfg.GRPCAddress)
+				if err != nil {
+					return err
+				}
+				go func() {
+					slog.Info("gRPC管理接口已启动", "address", grpcListener.Addr().String(), "tls", cfg.TLSEnabled())
+					if err := grpcServer.Serve(grpcListener); err != nil {
+						slog.Error("gRPC服务异常退出", "error", err)
+					}
+				}()
+				return nil
+			},
+			Stop: func(ctx context.Context) error {
+				grpcServer.Stop(ctx)
+				return nil
+			},
+		})
+	}
+
+	// 按顺序启动各组件，任一组件启动失败时停止已启动的组件并退出
+	if err := lifecycle.Start(bgCtx); err != nil {
+		slog.Error("服务器启动失败", "error", err)
+		os.Exit(1)
+	}
+
+	// 通知systemd服务已就绪，并按需发送看门狗心跳
+	if err := services.SystemdNotify("READY=1"); err != nil {
+		slog.Warn("通知systemd失败", "error", err)
+	}
+	go services.StartSystemdWatchdog(bgCtx)
 
-	// 等待中断信号关闭服务器
+	// 等待中断信号关闭服务器，或收到重启请求；SIGHUP重新加载配置
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-	log.Println("正在关闭服务器...")
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	restart := false
+wait:
+	for {
+		select {
+		case <-hup:
+			reloadConfig(cfg, settingsService)
+		case <-quit:
+			break wait
+		case <-restartManager.Requested():
+			restart = true
+			break wait
+		case <-elector.Lost():
+			// 失去主节点身份后备用节点会立即接管，停止转发器并退出，由systemd重启为备用节点
+			slog.Error("已失去主节点身份，停止转发并退出")
+			leaderComponents.Stop(context.Background())
+			os.Exit(1)
+		}
+	}
+	slog.Info("正在关闭服务器")
+	if restart {
+		services.SystemdReloading()
+	} else {
+		services.SystemdNotify("STOPPING=1")
+	}
 
-	// 设置5秒超时的上下文
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	// 重启时先在停止转发器之前保留HTTP监听套接字并记录运行中的转发端口
+	var handoff *services.Handoff
+	if restart {
+		if handoff, err = restartManager.Prepare(listener); err != nil {
+			slog.Warn("无法保留监听套接字，重启期间服务将短暂中断", "error", err)
+		}
+	}
+
+	// 在关闭超时内逆序停止各组件：先停止接受请求，再等待进行中的服务器操作完成，最后关闭数据库
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout)*time.Second)
 	defer cancel()
 
-	routingService.Stop()
+	bgCancel()
+	lifecycle.Stop(ctx)
 
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatal("服务器强制关闭:", err)
+	if restart {
+		// 转发器已停止，为其端口绑定占位套接字，重启期间转发中断但端口保持绑定
+		if handoff != nil {
+			restartManager.ReserveForwardPorts(handoff)
+		}
+		slog.Info("正在重启")
+		if err := restartManager.Exec(handoff); err != nil {
+			slog.Error("重启失败", "error", err)
+			os.Exit(1)
+		}
 	}
 
-	log.Println("服务器已关闭")
-} 
\ No newline at end of file
+	slog.Info("服务器已关闭")
+} 
+
+// settingDefaults 运行时设置的默认值：配置文件的settings，以及由配置项提供默认值的内置设置
+func settingDefaults(cfg *config.Config) map[string]string {
+	defaults := make(map[string]string, len(cfg.Settings)+6)
+	for key, value := range cfg.Settings {
+		defaults[key] = value
+	}
+	defaults[services.SettingTrashRetentionDays] = strconv.Itoa(cfg.TrashRetentionDays)
+	defaults[services.SettingTrafficRetentionDays] = strconv.Itoa(cfg.TrafficRetentionDays)
+	defaults[services.SettingHealthCheckInterval] = strconv.Itoa(cfg.HealthCheckInterval)
+	defaults[services.SettingHealthFailThreshold] = strconv.Itoa(cfg.HealthFailThreshold)
+	defaults[services.SettingHealthMaxRestarts] = strconv.Itoa(cfg.HealthMaxRestarts)
+	defaults[services.SettingReconcileInterval] = strconv.Itoa(cfg.ReconcileInterval)
+	return defaults
+}
+
+// reloadConfig 重新加载配置(SIGHUP)：日志级别和运行时设置的默认值立即生效，
+// 与启动时的配置相比其他配置项的修改只提示需要重启。加载失败时继续使用当前配置
+func reloadConfig(cfg *config.Config, settingsService *services.SettingsService) {
+	services.SystemdReloading()
+	defer services.SystemdNotify("READY=1")
+
+	next, pending, err := cfg.Reload()
+	if err == nil {
+		err = settingsService.Reload(settingDefaults(next))
+	}
+	if err != nil {
+		slog.Error("重新加载配置失败，继续使用当前配置", "error", err)
+		return
+	}
+
+	logger.SetLevel(next.LogLevel)
+	logger.SetSlowThreshold(next.SlowRequestThreshold())
+	if len(pending) > 0 {
+		slog.Warn("以下配置项已修改，需要重启才能生效", "keys", strings.Join(pending, ", "))
+	}
+	slog.Info("配置已重新加载", "file", next.File)
+}
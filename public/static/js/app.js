@@ -3,6 +3,7 @@ class StateManager {
         this.state = {
             servers: new Map(),
             trafficStats: {},
+            liveTraffic: {},
             systemStatus: {},
             ui: {
                 modals: {},
@@ -130,15 +131,21 @@ class SmartWebSocket {
         this.reconnectDelay = 1000;
         this.isConnected = false;
         this.messageQueue = [];
+        this.lastSeq = 0; // 最近收到的消息序号，重连时用于补发错过的消息
         
         this.connect();
     }
 
     connect() {
         try {
-            this.ws = new WebSocket(this.url);
+            const url = this.lastSeq > 0 ? `${this.url}?since=${this.lastSeq}` : this.url;
+            this.ws = new WebSocket(url);
             
             this.ws.onopen = () => {
+                // 首条消息携带令牌完成认证，避免令牌出现在URL中
+                this.ws.send(JSON.stringify({ type: 'auth', token: localStorage.getItem('l2tp_token') || '' }));
+                // 订阅实时吞吐量，服务端每秒推送一次
+                this.ws.send(JSON.stringify({ type: 'subscribe', topics: ['traffic'] }));
                 console.log('WebSocket连接成功');
                 this.isConnected = true;
                 this.reconnectAttempts = 0;
@@ -150,10 +157,14 @@ class SmartWebSocket {
                 this.handleMessage(JSON.parse(event.data));
             };
 
-            this.ws.onclose = () => {
+            this.ws.onclose = (event) => {
                 console.log('WebSocket连接关闭');
                 this.isConnected = false;
                 this.stateManager.setState('websocket', { connected: false });
+                if (event.code === 4401) {
+                    console.warn('WebSocket认证失败，停止重连');
+                    return;
+                }
                 this.scheduleReconnect();
             };
 
@@ -181,6 +192,10 @@ class SmartWebSocket {
 
     handleMessage(data) {
         const timestamp = Date.now();
+        if (data.seq) {
+            // 记录最新序号(服务重启后序号会从头开始)
+            this.lastSeq = data.seq;
+        }
         
         switch (data.type) {
             case 'server_status':
@@ -199,6 +214,19 @@ class SmartWebSocket {
                     this.stateManager.updateServer(data.data.id, data.data, timestamp);
                 }
                 break;
+            case 'job_progress':
+                if (data.data) {
+                    this.stateManager.updateServer(data.server_id, { job: data.data }, timestamp);
+                }
+                break;
+            case 'job_finished':
+                if (data.data) {
+                    this.stateManager.updateServer(data.server_id, { job: data.data }, timestamp);
+                }
+                break;
+            case 'traffic':
+                this.stateManager.setState('liveTraffic', { samples: data.data || [] });
+                break;
         }
     }
 
@@ -231,6 +259,7 @@ class UIRenderer {
         
         this.stateManager.subscribe('servers', () => this.renderServers());
         this.stateManager.subscribe('trafficStats', () => this.renderTrafficStats());
+        this.stateManager.subscribe('liveTraffic', () => this.renderLiveTraffic());
         this.stateManager.subscribe('systemStatus', () => this.renderSystemStatus());
     }
 
@@ -273,6 +302,7 @@ class UIRenderer {
                 <td>
                     <span class="status status-${server.status}">${this.getStatusText(server.status)}</span>
                     ${server.message ? `<small class="status-message">${this.escapeHtml(server.message)}</small>` : ''}
+                    ${server.job && server.job.status === 'running' ? `<small class="status-message">${server.job.percent}% (${server.job.step_index}/${server.job.step_count})</small>` : ''}
                 </td>
                 <td>${server.expire_date ? this.formatDate(server.expire_date) : '无限期'}</td>
                 <td>
@@ -331,6 +361,27 @@ class UIRenderer {
         `;
     }
 
+    renderLiveTraffic() {
+        const samples = this.stateManager.getState('liveTraffic').samples || [];
+        const container = document.getElementById('liveTrafficContainer');
+        if (!container) return;
+
+        const uplink = samples.reduce((sum, s) => sum + (s.uplink || 0), 0);
+        const downlink = samples.reduce((sum, s) => sum + (s.downlink || 0), 0);
+        container.innerHTML = `
+            <div class="stats-summary">
+                <div class="stat-item">
+                    <h4>实时上行</h4>
+                    <p>${this.formatBytes(uplink)}/s</p>
+                </div>
+                <div class="stat-item">
+                    <h4>实时下行</h4>
+                    <p>${this.formatBytes(downlink)}/s</p>
+                </div>
+            </div>
+        `;
+    }
+
     renderSystemStatus() {
         const status = this.stateManager.getState('systemStatus');
         if (!this.shouldRender('systemStatus', status)) return;
@@ -368,6 +419,7 @@ class UIRenderer {
             'starting': '启动中',
             'stopping': '停止中',
             'error': '错误',
+            'interrupted': '已中断',
             'restarting': '重启中'
         };
         return statusMap[status] || status;
@@ -395,7 +447,8 @@ class UIRenderer {
 class L2TPManager {
     constructor() {
         this.token = localStorage.getItem('l2tp_token') || '';
-        this.apiBase = '/api';
+        // 面板可能部署在子路径下，接口地址相对于页面的<base href>
+        this.apiBase = new URL('api/v1', document.baseURI).pathname;
         this.isLoggedIn = false;
         
         this.stateManager = new StateManager();
@@ -651,7 +704,7 @@ class L2TPManager {
 
         try {
             const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-            const wsUrl = `${protocol}//${window.location.host}/ws/status`;
+            const wsUrl = `${protocol}//${window.location.host}${new URL('ws/status', document.baseURI).pathname}`;
             
             this.smartWebSocket = new SmartWebSocket(wsUrl, this.stateManager);
             
@@ -813,7 +866,7 @@ class L2TPManager {
                 </div>
                 <div class="form-group">
                     <label>密码</label>
-                    <input type="text" class="user-password" value="${password}" placeholder="输入密码" required>
+                    <input type="text" class="user-password" value="${password}" placeholder="输入密码，填写 auto 自动生成" required>
                 </div>
             </div>
             <button type="button" class="btn btn-danger btn-sm remove-user-btn" onclick="l2tpManager.removeUser(this)">删除</button>